@@ -0,0 +1,211 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.mozilla.org/pkcs7"
+)
+
+// With config/aia-chasing, importing an issuer whose chain stops short of a
+// root fetches the missing parent from the caIssuers URLs (RFC 5280 section
+// 4.2.2.1) of the last certificate in its chain, and imports it as another
+// issuer; chain building then attaches it to the chain. This repeats until a
+// root is reached, nothing more can be fetched, or max_depth is reached.
+
+// caIssuers responses are single certificates (DER or PEM) or PKCS#7
+// certs-only bundles; anything larger than this isn't one.
+const maxAIAResponseSize = 1024 * 1024
+
+// maxAIARedirects bounds the redirects followed by a single fetch.
+const maxAIARedirects = 5
+
+// aiaHostAllowed reports whether the host is on the allowlist, either
+// exactly or, for "*.example.com" entries, as any subdomain.
+func aiaHostAllowed(allowedHosts []string, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range allowedHosts {
+		if strings.HasPrefix(allowed, "*.") {
+			if strings.HasSuffix(host, allowed[1:]) && len(host) > len(allowed)-1 {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// chaseAIAParents fetches and imports the missing parents of the given
+// issuers. It returns the ids of the issuers it imported, along with
+// warnings about parents it couldn't fetch.
+func (sc *storageContext) chaseAIAParents(ids []string) ([]string, []string, error) {
+	config, err := sc.getAIAChasingConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !config.Enabled || len(ids) == 0 {
+		return nil, nil, nil
+	}
+
+	client := &http.Client{
+		Timeout: config.FetchTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxAIARedirects {
+				return errors.New("too many redirects")
+			}
+			if !aiaHostAllowed(config.AllowedHosts, req.URL.Hostname()) {
+				return fmt.Errorf("redirected to %v, which isn't on allowed_hosts", req.URL.Hostname())
+			}
+			return nil
+		},
+	}
+
+	var fetched []string
+	var warnings []string
+	for _, id := range ids {
+		for depth := 0; depth < config.MaxDepth; depth++ {
+			issuer, err := sc.fetchIssuerById(issuerID(id))
+			if err != nil {
+				return nil, nil, err
+			}
+
+			// Chain building places the issuer's furthest known ancestor
+			// last; once that is a root, the chain is complete.
+			chain := issuer.CAChain
+			if len(chain) == 0 {
+				chain = []string{issuer.Certificate}
+			}
+			last, err := parseCertificateFromBytes([]byte(chain[len(chain)-1]))
+			if err != nil {
+				return nil, nil, fmt.Errorf("unable to parse the chain of issuer %v: %w", id, err)
+			}
+			if bytes.Equal(last.RawSubject, last.RawIssuer) && last.CheckSignatureFrom(last) == nil {
+				break
+			}
+
+			parent, warning := fetchAIAParent(sc.Context, client, config, last)
+			if err := sc.Context.Err(); err != nil {
+				return nil, nil, err
+			}
+			if parent == nil {
+				warnings = append(warnings, fmt.Sprintf("The chain of issuer %v is incomplete: %v", id, warning))
+				break
+			}
+
+			parentPem := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: parent.Raw}))
+			imported, existing, err := sc.importIssuer(parentPem, "")
+			if err != nil {
+				return nil, nil, fmt.Errorf("unable to import the parent of %v fetched through AIA: %w", last.Subject, err)
+			}
+			if existing {
+				// Already known, but still not part of the chain; nothing
+				// more to be done.
+				break
+			}
+			fetched = append(fetched, imported.ID.String())
+		}
+	}
+
+	return fetched, warnings, nil
+}
+
+// fetchAIAParent fetches the certificate which signed child from its
+// caIssuers URLs. When none can be fetched, it returns why instead.
+func fetchAIAParent(ctx context.Context, client *http.Client, config *aiaChasingConfigEntry, child *x509.Certificate) (*x509.Certificate, string) {
+	if len(child.IssuingCertificateURL) == 0 {
+		return nil, fmt.Sprintf("%v has no caIssuers URL to fetch its parent from", child.Subject)
+	}
+
+	var failures []string
+	for _, rawURL := range child.IssuingCertificateURL {
+		parsed, err := url.Parse(rawURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			failures = append(failures, fmt.Sprintf("%v: not an HTTP(S) URL", rawURL))
+			continue
+		}
+		if !aiaHostAllowed(config.AllowedHosts, parsed.Hostname()) {
+			failures = append(failures, fmt.Sprintf("%v: host isn't on allowed_hosts", rawURL))
+			continue
+		}
+
+		certs, err := fetchAIACertificates(ctx, client, parsed.String())
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%v: %v", rawURL, err))
+			continue
+		}
+
+		for _, cert := range certs {
+			if cert.BasicConstraintsValid && cert.IsCA && child.CheckSignatureFrom(cert) == nil {
+				return cert, ""
+			}
+		}
+		failures = append(failures, fmt.Sprintf("%v: no certificate returned signed %v", rawURL, child.Subject))
+	}
+
+	return nil, fmt.Sprintf("unable to fetch the parent of %v: %v", child.Subject, strings.Join(failures, "; "))
+}
+
+func fetchAIACertificates(ctx context.Context, client *http.Client, target string) ([]*x509.Certificate, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxAIAResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxAIAResponseSize {
+		return nil, fmt.Errorf("response exceeds %v bytes", maxAIAResponseSize)
+	}
+
+	return parseAIACertificates(body)
+}
+
+// parseAIACertificates parses a caIssuers response: PEM or DER
+// certificates, or a PKCS#7 certs-only bundle.
+func parseAIACertificates(body []byte) ([]*x509.Certificate, error) {
+	if block, rest := pem.Decode(body); block != nil {
+		var certs []*x509.Certificate
+		for ; block != nil; block, rest = pem.Decode(rest) {
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse PEM certificate: %w", err)
+			}
+			certs = append(certs, cert)
+		}
+		return certs, nil
+	}
+
+	if certs, err := x509.ParseCertificates(body); err == nil {
+		return certs, nil
+	}
+
+	p7, err := pkcs7.Parse(body)
+	if err != nil {
+		return nil, errors.New("response is neither a certificate nor a PKCS#7 bundle")
+	}
+	return p7.Certificates, nil
+}
@@ -3,17 +3,21 @@ package pki
 import (
 	"context"
 	"fmt"
+	"path"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	atomic2 "go.uber.org/atomic"
+
 	"github.com/hashicorp/vault/sdk/helper/consts"
 
 	"github.com/armon/go-metrics"
 	"github.com/hashicorp/vault/helper/metricsutil"
 	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
@@ -85,25 +89,61 @@ func Backend(conf *logical.BackendConfig) *backend {
 				"issuer/+/crl/delta/der",
 				"issuer/+/crl/delta/pem",
 				"issuer/+/crl/delta",
+				"issuer/+/crl/reason/+/der",
+				"issuer/+/crl/reason/+/pem",
+				"issuer/+/crl/reason/+",
+				"issuer/+/crl/partition/+/der",
+				"issuer/+/crl/partition/+/pem",
+				"issuer/+/crl/partition/+",
+				"issuer/+/crl/partition/+/delta/der",
+				"issuer/+/crl/partition/+/delta/pem",
+				"issuer/+/crl/partition/+/delta",
 				"issuer/+/pem",
 				"issuer/+/der",
 				"issuer/+/json",
 				"issuers/", // LIST operations append a '/' to the requested path
 				"ocsp",     // OCSP POST
 				"ocsp/*",   // OCSP GET
+				"enrollment/issue",
+				"enrollment/sign",
+				"revoke-with-signature",
+				"est/cacerts",
+				"est/simpleenroll",
+				"est/simplereenroll",
+				"est/+/cacerts",
+				"est/+/simpleenroll",
+				"est/+/simplereenroll",
+				"scep/pkiclient.exe",
+				"scep/+/pkiclient.exe",
+				"cmp",
+				"cmp/+",
 			},
 
 			LocalStorage: []string{
 				revokedPath,
+				revocationIndexPath,
+				rotatedRevocationsPath,
+				certMetadataPath,
+				signRequestPrefix,
+				roleUsagePrefix,
+				usageStatsPrefix,
 				deltaWALPath,
 				legacyCRLPath,
 				"crls/",
 				"certs/",
+				localClusterIDPath,
+				unifiedRevocationQueuePath,
+				clusterConfigPath,
 			},
 
 			Root: []string{
 				"root",
 				"root/sign-self-issued",
+				"migrate/export",
+				"migrate/import",
+				"backup/export",
+				"backup/restore",
+				"pkcs12/export/*",
 			},
 
 			SealWrapStorage: []string{
@@ -124,22 +164,70 @@ func Backend(conf *logical.BackendConfig) *backend {
 			pathConfigCA(&b),
 			pathConfigCRL(&b),
 			pathConfigURLs(&b),
+			pathConfigCluster(&b),
+			pathConfigEvents(&b),
+			pathConfigExpiryNotifications(&b),
+			pathConfigPublish(&b),
+			pathPublishStatus(&b),
+			pathConfigCT(&b),
+			pathConfigAIAChasing(&b),
+			pathConfigEst(&b),
+			pathConfigScep(&b),
+			pathConfigCmp(&b),
+			pathConfigMount(&b),
 			pathSignVerbatim(&b),
 			pathSign(&b),
 			pathIssue(&b),
+			pathSignValidate(&b),
+			pathIssueValidate(&b),
+			pathRenew(&b),
 			pathRotateCRL(&b),
+			pathCRLBuilderState(&b),
 			pathRevoke(&b),
 			pathRevokeWithKey(&b),
+			pathRevokeWithSignature(&b),
+			pathUnrevoke(&b),
+			pathImportCRL(&b),
 			pathTidy(&b),
+			pathTidyCancel(&b),
+			pathConfigAutoTidy(&b),
 			pathTidyStatus(&b),
+			pathMigrateExport(&b),
+			pathMigrateImport(&b),
+			pathBackupExport(&b),
+			pathBackupRestore(&b),
+
+			// Enrollment APIs
+			pathEnrollmentTokenCreate(&b),
+			pathListEnrollmentTokens(&b),
+			pathEnrollmentToken(&b),
+			pathEnrollmentIssue(&b),
+			pathEnrollmentSign(&b),
+			pathListSignRequests(&b),
+			pathSignRequest(&b),
+			pathSignRequestApprove(&b),
+			pathSignRequestDeny(&b),
+			pathEstCACerts(&b),
+			pathEstSimpleEnroll(&b),
+			pathEstSimpleReenroll(&b),
+			pathScep(&b),
+			pathScepChallenge(&b),
+			pathCmp(&b),
 
 			// Issuer APIs
 			pathListIssuers(&b),
 			pathGetIssuer(&b),
 			pathGetIssuerCRL(&b),
+			pathGetIssuerReasonCRL(&b),
+			pathGetIssuerPartitionCRL(&b),
+			pathIssuerHealth(&b),
+			pathHealthCheck(&b),
+			pathStats(&b),
 			pathImportIssuer(&b),
 			pathIssuerIssue(&b),
 			pathIssuerSign(&b),
+			pathIssuerIssueValidate(&b),
+			pathIssuerSignValidate(&b),
 			pathIssuerSignIntermediate(&b),
 			pathIssuerSignSelfIssued(&b),
 			pathIssuerSignVerbatim(&b),
@@ -147,8 +235,17 @@ func Backend(conf *logical.BackendConfig) *backend {
 			pathRotateRoot(&b),
 			pathIssuerGenerateIntermediate(&b),
 			pathCrossSignIntermediate(&b),
+			pathIssuerCrossSignCSR(&b),
+			pathIssuerCrossSignImport(&b),
+			pathIssuerRotateKeyGenerate(&b),
+			pathIssuerRotateKeyImport(&b),
+			pathIssuerExportPKCS12(&b),
 			pathConfigIssuers(&b),
 			pathReplaceRoot(&b),
+			pathRootRotation(&b),
+			pathRootRotationGenerate(&b),
+			pathRootRotationCrossSign(&b),
+			pathRootRotationComplete(&b),
 			pathRevokeIssuer(&b),
 
 			// Key APIs
@@ -156,7 +253,9 @@ func Backend(conf *logical.BackendConfig) *backend {
 			pathKey(&b),
 			pathGenerateKey(&b),
 			pathImportKey(&b),
+			pathImportCloudKMSKey(&b),
 			pathConfigKeys(&b),
+			pathKeyTypes(&b),
 
 			// Fetch APIs have been lowered to favor the newer issuer API endpoints
 			pathFetchCA(&b),
@@ -166,6 +265,10 @@ func Backend(conf *logical.BackendConfig) *backend {
 			pathFetchValidRaw(&b),
 			pathFetchValid(&b),
 			pathFetchListCerts(&b),
+			pathListRevokedCerts(&b),
+			pathSearchCerts(&b),
+			pathCertsByCN(&b),
+			pathCertsBySAN(&b),
 
 			// OCSP APIs
 			buildPathOcspGet(&b),
@@ -180,16 +283,28 @@ func Backend(conf *logical.BackendConfig) *backend {
 		InitializeFunc: b.initialize,
 		Invalidate:     b.invalidate,
 		PeriodicFunc:   b.periodicFunc,
+		Clean:          b.cleanup,
 	}
 
 	b.tidyCASGuard = new(uint32)
+	b.tidyCancelCAS = new(uint32)
 	b.tidyStatus = &tidyStatus{state: tidyStatusInactive}
+	b.lastTidy = time.Now()
 	b.storage = conf.StorageView
 	b.backendUUID = conf.BackendUUID
 
 	b.pkiStorageVersion.Store(0)
 
 	b.crlBuilder = newCRLBuilder()
+	b.ocspCache = newOcspResponseCache()
+	b.issuerCache = newIssuerCache()
+	b.roleUsageLocks = locksutil.CreateLocks()
+	b.events = newEventPublisher()
+	b.crlPublisher = newCRLPublisher()
+	b.cloudKMSSigners = newCloudKMSSigners()
+	b.revocationIndexReady = atomic2.NewBool(false)
+	b.certMetadataReady = atomic2.NewBool(false)
+	b.usageStats = newUsageStatsTracker()
 
 	return &b
 }
@@ -201,15 +316,51 @@ type backend struct {
 	storage           logical.Storage
 	revokeStorageLock sync.RWMutex
 	tidyCASGuard      *uint32
+	tidyCancelCAS     *uint32
 
 	tidyStatusLock sync.RWMutex
 	tidyStatus     *tidyStatus
+	// lastTidy is when the last tidy operation, manual or automatic,
+	// started; guarded by tidyStatusLock.
+	lastTidy time.Time
 
 	pkiStorageVersion atomic.Value
 	crlBuilder        *crlBuilder
+	ocspCache         *ocspResponseCache
+	issuerCache       *issuerCache
+	events            *eventPublisher
+	crlPublisher      *crlPublisher
+	cloudKMSSigners   *cloudKMSSigners
 
 	// Write lock around issuers and keys.
 	issuersLock sync.RWMutex
+
+	// Lock around redeeming enrollment passwords.
+	enrollmentLock sync.Mutex
+
+	// Lock around deciding on sign requests held for approval.
+	signRequestLock sync.Mutex
+
+	// Lock around advancing the staged root rotation.
+	rootRotationLock sync.Mutex
+
+	// Per-role locks around tracking roles' issuances against their limits,
+	// so that roles don't contend with each other.
+	roleUsageLocks []*locksutil.LockEntry
+
+	// Lock around updates to the revocation index, whether it has been
+	// built, and the journal of changes made while it is being built; see
+	// revocation_index.go.
+	revocationIndexLock    sync.Mutex
+	revocationIndexReady   *atomic2.Bool
+	revocationIndexJournal map[string]*revocationInfo
+
+	// Whether certificates stored before the certificate metadata store
+	// existed have been summarized; see cert_metadata.go.
+	certMetadataReady *atomic2.Bool
+
+	// Changes to the usage statistics not yet flushed; see stats.go.
+	usageStats *usageStatsTracker
 }
 
 type (
@@ -222,24 +373,32 @@ const (
 	tidyStatusStarted
 	tidyStatusFinished
 	tidyStatusError
+	tidyStatusCancelling
+	tidyStatusCancelled
 )
 
 type tidyStatus struct {
 	// Parameters used to initiate the operation
-	safetyBuffer      int
-	tidyCertStore     bool
-	tidyRevokedCerts  bool
-	tidyRevokedAssocs bool
+	safetyBuffer       int
+	tidyCertStore      bool
+	tidyRevokedCerts   bool
+	tidyRevokedAssocs  bool
+	tidyExpiredIssuers bool
+	issuerSafetyBuffer int
 
 	// Status
-	state                   tidyStatusState
-	err                     error
-	timeStarted             time.Time
-	timeFinished            time.Time
-	message                 string
-	certStoreDeletedCount   uint
-	revokedCertDeletedCount uint
-	missingIssuerCertCount  uint
+	state                    tidyStatusState
+	err                      error
+	timeStarted              time.Time
+	timeFinished             time.Time
+	message                  string
+	resumed                  bool
+	certStoreExaminedCount   uint
+	certStoreDeletedCount    uint
+	revokedCertExaminedCount uint
+	revokedCertDeletedCount  uint
+	missingIssuerCertCount   uint
+	issuerDeletedCount       uint
 }
 
 const backendHelp = `
@@ -321,6 +480,15 @@ func (b *backend) initialize(ctx context.Context, _ *logical.InitializationReque
 	// Load up our current pki storage state, no matter the host type we are on.
 	b.updatePkiStorageVersion(ctx, false)
 
+	// Pick up any CRL rebuild the previously active node didn't get to.
+	// CRLs are cluster-local, so this applies to performance secondaries
+	// regardless of whether the mount is local.
+	if !b.System().ReplicationState().HasState(consts.ReplicationDRSecondary | consts.ReplicationPerformanceStandby) {
+		if err := b.crlBuilder.loadRebuildIntent(sc); err != nil {
+			return err
+		}
+	}
+
 	// Early exit if not a primary cluster or performance secondary with a local mount.
 	if b.System().ReplicationState().HasState(consts.ReplicationDRSecondary|consts.ReplicationPerformanceStandby) ||
 		(!b.System().LocalMount() && b.System().ReplicationState().HasState(consts.ReplicationPerformanceSecondary)) {
@@ -377,6 +545,7 @@ func (b *backend) invalidate(ctx context.Context, key string) {
 		// and reset its compatibility mode and rebuild the CRL locally. Kick it off
 		// as a go routine to not block this call due to the lock grabbing
 		// within updatePkiStorageVersion.
+		b.issuerCache.flush()
 		go func() {
 			b.Logger().Info("Detected a migration completed, resetting pki storage version")
 			b.updatePkiStorageVersion(ctx, true)
@@ -386,19 +555,46 @@ func (b *backend) invalidate(ctx context.Context, key string) {
 		// If an issuer has changed on the primary, we need to schedule an update of our CRL,
 		// the primary cluster would have done it already, but the CRL is cluster specific so
 		// force a rebuild of ours.
+		b.ocspCache.flush()
+		b.issuerCache.flush()
 		if !b.useLegacyBundleCaStorage() {
 			b.crlBuilder.requestRebuildIfActiveNode(b)
 		} else {
 			b.Logger().Debug("Ignoring invalidation updates for issuer as the PKI migration has yet to complete.")
 		}
+	case strings.HasPrefix(key, revokedPath):
+		b.ocspCache.invalidateSerial(strings.TrimPrefix(key, revokedPath))
+	case strings.HasPrefix(key, unifiedRevocationPath):
+		// Revocations by other clusters, keyed by their cluster id, change
+		// the status reported with ocsp_unified.
+		b.ocspCache.invalidateSerial(path.Base(key))
 	case key == "config/crl":
 		// We may need to reload our OCSP status flag
 		b.crlBuilder.markConfigDirty()
+		b.ocspCache.flush()
+	case strings.HasPrefix(key, keyPrefix):
+		// Issuers' keys are cached along with them.
+		b.issuerCache.flush()
+		// And cloud KMS keys deleted on another node leave their signers.
+		if err := b.cloudKMSSigners.evictUnreferenced(b.makeStorageContext(ctx, b.storage)); err != nil {
+			b.Logger().Warn("unable to stop signers of removed cloud KMS keys", "error", err)
+		}
 	case key == storageIssuerConfig:
 		b.crlBuilder.invalidateCRLBuildTime()
+		b.issuerCache.flush()
 	}
 }
 
+func (b *backend) cleanup(_ context.Context) {
+	b.crlBuilder.stopBackgroundWorker()
+	b.events.stopWorker()
+	b.crlPublisher.stopWorker()
+	b.cloudKMSSigners.stop()
+
+	// Stop any running tidy, leaving its checkpoint to resume from.
+	atomic.CompareAndSwapUint32(b.tidyCancelCAS, tidyCancelNone, tidyCancelInterrupt)
+}
+
 func (b *backend) periodicFunc(ctx context.Context, request *logical.Request) error {
 	// First attempt to reload the CRL configuration.
 	sc := b.makeStorageContext(ctx, request.Storage)
@@ -406,6 +602,12 @@ func (b *backend) periodicFunc(ctx context.Context, request *logical.Request) er
 		return err
 	}
 
+	// Every node answers OCSP requests, so every node pre-signs its own
+	// responses; this doesn't modify storage.
+	if err := b.presignOcspResponses(sc); err != nil {
+		b.Logger().Warn("unable to pre-sign OCSP responses", "error", err)
+	}
+
 	// As we're (below) modifying the backing storage, we need to ensure
 	// we're not on a standby/secondary node.
 	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby) ||
@@ -413,23 +615,94 @@ func (b *backend) periodicFunc(ctx context.Context, request *logical.Request) er
 		return nil
 	}
 
-	// Check if we're set to auto rebuild and a CRL is set to expire.
-	if err := b.crlBuilder.checkForAutoRebuild(sc); err != nil {
-		return err
+	// Transfer unified revocation entries queued while the replicated store
+	// couldn't be written, as on a performance secondary; they stay queued
+	// until it can.
+	if err := sc.transferUnifiedRevocationQueue(); err != nil {
+		b.Logger().Warn("unable to transfer queued unified revocation entries", "error", err)
+	}
+
+	// Resume any tidy operation interrupted by a restart or seal.
+	if err := b.resumeTidyIfRequired(ctx, request.Storage); err != nil {
+		b.Logger().Warn("unable to resume tidy operation", "error", err)
+	}
+
+	// Then start an automatic tidy, if one is due.
+	if err := b.runAutoTidyIfRequired(sc); err != nil {
+		b.Logger().Warn("unable to start auto-tidy operation", "error", err)
 	}
 
-	// Then attempt to rebuild the CRLs if required.
-	if err := b.crlBuilder.rebuildIfForced(ctx, b, request); err != nil {
+	// Build the revocation index used for CRL building, if this mount
+	// predates it.
+	if err := b.buildRevocationIndexIfRequired(ctx, request.Storage); err != nil {
 		return err
 	}
 
-	// If a delta CRL was rebuilt above as part of the complete CRL rebuild,
-	// this will be a no-op. However, if we do need to rebuild delta CRLs,
-	// this would cause us to do so.
-	if err := b.crlBuilder.rebuildDeltaCRLsIfForced(sc); err != nil {
+	// Likewise, summarize certificates issued before the certificate
+	// metadata store existed. Failing to do so only affects searches.
+	if err := b.buildCertMetadataIfRequired(ctx, request.Storage); err != nil {
+		b.Logger().Warn("unable to build certificate metadata store", "error", err)
+	}
+
+	// And keep the usage statistics current; they only inform operators.
+	if err := b.buildUsageStatsIfRequired(ctx, request.Storage); err != nil {
+		b.Logger().Warn("unable to build usage statistics", "error", err)
+	} else if err := sc.flushUsageStats(); err != nil {
+		b.Logger().Warn("unable to flush usage statistics", "error", err)
+	}
+
+	// Drop sign requests which were never decided on, or whose decision
+	// is no longer of interest.
+	if err := b.tidyExpiredSignRequests(sc); err != nil {
+		b.Logger().Warn("unable to remove expired sign requests", "error", err)
+	}
+
+	// Publish how long each issuer has left, so rollovers can be alerted on.
+	// Failing to do so shouldn't block CRL maintenance below.
+	if err := emitIssuerExpiryMetrics(sc); err != nil {
+		b.Logger().Warn("unable to emit issuer expiry metrics", "error", err)
+	}
+
+	// Likewise, publish events for certificates nearing expiry. The scan
+	// state is replicated, so only the primary cluster scans.
+	if !b.System().ReplicationState().HasState(consts.ReplicationPerformanceSecondary) {
+		if err := b.publishExpiringCertEvents(sc, false); err != nil {
+			b.Logger().Warn("unable to publish certificate expiry events", "error", err)
+		}
+		if err := b.notifyExpiringCerts(sc, false, expiryNotificationScanBatchSize); err != nil {
+			b.Logger().Warn("unable to notify of certificates nearing expiry", "error", err)
+		}
+	}
+
+	cfg, err := b.crlBuilder.getConfigWithUpdate(sc)
+	if err != nil {
 		return err
 	}
 
+	if cfg.BackgroundRebuild {
+		// Leave rebuilding to the dedicated worker, so that long rebuilds
+		// don't hold up the periodic function.
+		b.crlBuilder.startBackgroundWorker(b)
+		b.crlBuilder.wakeBackgroundWorker()
+	} else {
+		// Check if we're set to auto rebuild and a CRL is set to expire.
+		if err := b.crlBuilder.checkForAutoRebuild(sc); err != nil {
+			return err
+		}
+
+		// Then attempt to rebuild the CRLs if required.
+		if err := b.crlBuilder.rebuildIfForced(ctx, b, request); err != nil {
+			return err
+		}
+
+		// If a delta CRL was rebuilt above as part of the complete CRL rebuild,
+		// this will be a no-op. However, if we do need to rebuild delta CRLs,
+		// this would cause us to do so.
+		if err := b.crlBuilder.rebuildDeltaCRLsIfForced(sc); err != nil {
+			return err
+		}
+	}
+
 	// Check if the CRL was invalidated due to issuer swap and update
 	// accordingly.
 	if err := b.crlBuilder.flushCRLBuildTimeInvalidation(sc); err != nil {
@@ -9,8 +9,11 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
@@ -20,6 +23,8 @@ import (
 	"math/big"
 	mathrand "math/rand"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"reflect"
@@ -27,6 +32,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -45,7 +51,11 @@ import (
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/hashicorp/vault/vault"
 	"github.com/mitchellh/mapstructure"
+	"go.mozilla.org/pkcs7"
+	"golang.org/x/crypto/cryptobyte"
+	cbbasn1 "golang.org/x/crypto/cryptobyte/asn1"
 	"golang.org/x/net/idna"
+	"software.sslmate.com/src/go-pkcs12"
 )
 
 var stepCount = 0
@@ -3557,6 +3567,7 @@ func TestReadWriteDeleteRoles(t *testing.T) {
 		"allowed_uri_sans_template":          false,
 		"enforce_hostnames":                  true,
 		"policy_identifiers":                 []interface{}{},
+		"policy_identifiers_critical":        false,
 		"require_cn":                         true,
 		"allowed_domains_template":           false,
 		"allow_token_displayname":            false,
@@ -3581,17 +3592,33 @@ func TestReadWriteDeleteRoles(t *testing.T) {
 		"allow_bare_domains":                 false,
 		"allow_ip_sans":                      true,
 		"ext_key_usage_oids":                 []interface{}{},
+		"allowed_extension_oids":             []interface{}{},
+		"denied_extension_oids":              []interface{}{},
+		"issuance_policy":                    "",
 		"allow_any_name":                     false,
 		"ext_key_usage":                      []interface{}{},
 		"key_bits":                           json.Number("2048"),
 		"max_ttl":                            json.Number("0"),
 		"no_store":                           false,
 		"organization":                       []interface{}{},
+		"common_name_template":               "",
+		"ou_template":                        []interface{}{},
+		"organization_template":              []interface{}{},
+		"ocsp_must_staple":                   false,
+		"no_ext_key_usage":                   false,
 		"province":                           []interface{}{},
 		"street_address":                     []interface{}{},
 		"code_signing_flag":                  false,
 		"issuer_ref":                         "default",
+		"allowed_issuers":                    []interface{}{},
+		"crl_partition":                      "",
+		"allow_not_before":                   false,
 		"cn_validations":                     []interface{}{"email", "hostname"},
+		"require_approval":                   false,
+		"approval_ttl":                       json.Number("86400"),
+		"issuance_rate_limit":                json.Number("0"),
+		"issuance_rate_period":               json.Number("3600"),
+		"max_active_certificates":            json.Number("0"),
 	}
 
 	if diff := deep.Equal(expectedData, resp.Data); len(diff) > 0 {
@@ -3882,9 +3909,15 @@ func TestBackend_RevokePlusTidy_Intermediate(t *testing.T) {
 			"time_started":                          nil,
 			"time_finished":                         nil,
 			"message":                               nil,
+			"resumed":                               false,
+			"cert_store_examined_count":             json.Number("1"),
 			"cert_store_deleted_count":              json.Number("1"),
+			"revoked_cert_examined_count":           json.Number("1"),
 			"revoked_cert_deleted_count":            json.Number("1"),
 			"missing_issuer_cert_count":             json.Number("0"),
+			"tidy_expired_issuers":                  false,
+			"issuer_safety_buffer":                  json.Number("31536000"),
+			"issuer_deleted_count":                  json.Number("0"),
 		}
 		// Let's copy the times from the response so that we can use deep.Equal()
 		timeStarted, ok := tidyStatus.Data["time_started"]
@@ -3963,6 +3996,113 @@ func TestBackend_RevokePlusTidy_Intermediate(t *testing.T) {
 	}
 }
 
+func waitForTidyToFinish(t *testing.T, b *backend, s logical.Storage) *logical.Response {
+	t.Helper()
+
+	var resp *logical.Response
+	var err error
+	for i := 0; i < 100; i++ {
+		resp, err = CBRead(b, s, "tidy-status")
+		requireSuccessNonNilResponse(t, resp, err)
+		switch resp.Data["state"] {
+		case "Finished", "Error", "Cancelled":
+			return resp
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("tidy did not finish: %v", resp.Data)
+	return nil
+}
+
+func TestTidyCancelAndResume(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	_, err = CBWrite(b, s, "roles/test", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"ttl":              "1h",
+	})
+	require.NoError(t, err)
+
+	var serials []string
+	for i := 0; i < 3; i++ {
+		resp, err = CBWrite(b, s, "issue/test", map[string]interface{}{
+			"common_name": "test.example.com",
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		serials = append(serials, normalizeSerial(resp.Data["serial_number"].(string)))
+	}
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": serials[0],
+	})
+	require.NoError(t, err)
+
+	// Nothing to cancel.
+	resp, err = CBWrite(b, s, "tidy-cancel", nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.Warnings)
+
+	// Hold the tidy up before it examines any revocation, then cancel it.
+	b.revokeStorageLock.Lock()
+	_, err = CBWrite(b, s, "tidy", map[string]interface{}{
+		"tidy_revoked_certs": true,
+	})
+	require.NoError(t, err)
+
+	resp, err = CBWrite(b, s, "tidy-cancel", nil)
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, "Cancelling", resp.Data["state"])
+	b.revokeStorageLock.Unlock()
+
+	resp = waitForTidyToFinish(t, b, s)
+	require.Equal(t, "Cancelled", resp.Data["state"])
+	require.Equal(t, uint(0), resp.Data["revoked_cert_examined_count"])
+
+	entry, err := s.Get(ctx, tidyCheckpointPath)
+	require.NoError(t, err)
+	require.Nil(t, entry, "cancelled tidy operations shouldn't be resumed")
+
+	// Record a checkpoint as an interrupted tidy would have, part way
+	// through the certificate store, and let the periodic function resume
+	// it.
+	certs, err := s.List(ctx, "certs/")
+	require.NoError(t, err)
+	sort.Strings(certs)
+	require.Len(t, certs, 4)
+
+	checkpoint := newTidyCheckpoint(&tidyConfig{
+		CertStore:    true,
+		RevokedCerts: true,
+		SafetyBuffer: 72 * time.Hour,
+	})
+	checkpoint.LastSerial = certs[1]
+	checkpoint.CertStoreExaminedCount = 2
+	entry, err = logical.StorageEntryJSON(tidyCheckpointPath, checkpoint)
+	require.NoError(t, err)
+	require.NoError(t, s.Put(ctx, entry))
+
+	require.NoError(t, b.periodicFunc(ctx, &logical.Request{Storage: s}))
+
+	resp = waitForTidyToFinish(t, b, s)
+	require.Equal(t, "Finished", resp.Data["state"])
+	require.Equal(t, true, resp.Data["resumed"])
+	require.Equal(t, uint(4), resp.Data["cert_store_examined_count"])
+	require.Equal(t, uint(1), resp.Data["revoked_cert_examined_count"])
+	require.Equal(t, uint(0), resp.Data["cert_store_deleted_count"])
+	require.Equal(t, true, resp.Data["tidy_cert_store"])
+
+	entry, err = s.Get(ctx, tidyCheckpointPath)
+	require.NoError(t, err)
+	require.Nil(t, entry)
+}
+
 func TestBackend_Root_FullCAChain(t *testing.T) {
 	t.Parallel()
 	testCases := []struct {
@@ -5352,3 +5492,5072 @@ var (
 	edCAKey   string
 	edCACert  string
 )
+
+func TestIssuerExpiryWarning(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"issuer_name": "root",
+		"key_type":    "ec",
+		"ttl":         "48h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	_, err = CBWrite(b, s, "roles/local-testing", map[string]interface{}{
+		"allow_any_name":    true,
+		"enforce_hostnames": false,
+		"key_type":          "ec",
+		"ttl":               "1h",
+	})
+	require.NoError(t, err)
+
+	// Without a threshold, no warning should be present.
+	resp, err = CBWrite(b, s, "issue/local-testing", map[string]interface{}{
+		"common_name": "test.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Empty(t, resp.Warnings)
+
+	// A threshold shorter than the remaining validity shouldn't warn either.
+	resp, err = CBPatch(b, s, "issuer/root", map[string]interface{}{
+		"expiry_warning_threshold": "24h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, int64(86400), resp.Data["expiry_warning_threshold"])
+
+	resp, err = CBWrite(b, s, "issue/local-testing", map[string]interface{}{
+		"common_name": "test.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Empty(t, resp.Warnings)
+
+	// Negative thresholds are rejected.
+	_, err = CBPatch(b, s, "issuer/root", map[string]interface{}{
+		"expiry_warning_threshold": "-1h",
+	})
+	require.Error(t, err)
+
+	// Once within the threshold, issuance and signing both warn.
+	resp, err = CBPatch(b, s, "issuer/root", map[string]interface{}{
+		"expiry_warning_threshold": "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, int64(259200), resp.Data["expiry_warning_threshold"])
+
+	resp, err = CBWrite(b, s, "issue/local-testing", map[string]interface{}{
+		"common_name": "test.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Len(t, resp.Warnings, 1)
+	require.Contains(t, resp.Warnings[0], "expiry_warning_threshold")
+
+	resp, err = CBWrite(b, s, "intermediate/generate/internal", map[string]interface{}{
+		"common_name": "int example.com",
+		"key_type":    "ec",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	csr := resp.Data["csr"].(string)
+
+	resp, err = CBWrite(b, s, "root/sign-intermediate", map[string]interface{}{
+		"csr":         csr,
+		"common_name": "int example.com",
+		"ttl":         "1h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	found := false
+	for _, warning := range resp.Warnings {
+		if strings.Contains(warning, "expiry_warning_threshold") {
+			found = true
+		}
+	}
+	require.True(t, found, "expected expiry warning in %v", resp.Warnings)
+
+	// Emitting the expiry gauges should succeed for all issuers.
+	sc := b.makeStorageContext(ctx, s)
+	require.NoError(t, emitIssuerExpiryMetrics(sc))
+}
+
+func TestCAOnlyMount(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBRead(b, s, "config/mount")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, false, resp.Data["ca_only"])
+
+	resp, err = CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"issuer_name": "root",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	_, err = CBWrite(b, s, "roles/local-testing", map[string]interface{}{
+		"allow_any_name":    true,
+		"enforce_hostnames": false,
+		"key_type":          "ec",
+		"ttl":               "1h",
+	})
+	require.NoError(t, err)
+
+	resp, err = CBWrite(b, s, "issue/local-testing", map[string]interface{}{
+		"common_name": "test.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	serial := resp.Data["serial_number"].(string)
+
+	resp, err = CBWrite(b, s, "config/mount", map[string]interface{}{
+		"ca_only": true,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, true, resp.Data["ca_only"])
+
+	// All leaf issuance and signing paths are refused.
+	resp, err = CBWrite(b, s, "intermediate/generate/internal", map[string]interface{}{
+		"common_name": "int example.com",
+		"key_type":    "ec",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	csr := resp.Data["csr"].(string)
+
+	for _, path := range []string{
+		"issue/local-testing",
+		"sign/local-testing",
+		"sign-verbatim",
+		"issuer/root/issue/local-testing",
+		"issuer/root/sign/local-testing",
+		"issuer/root/sign-verbatim",
+	} {
+		_, err = CBWrite(b, s, path, map[string]interface{}{
+			"common_name": "test.example.com",
+			"csr":         csr,
+		})
+		require.Error(t, err, "expected %v to be refused", path)
+		require.Contains(t, err.Error(), "CA-only", "on path %v", path)
+	}
+
+	// Intermediates can still be signed, and revocation and CRLs still work.
+	resp, err = CBWrite(b, s, "root/sign-intermediate", map[string]interface{}{
+		"csr":         csr,
+		"common_name": "int example.com",
+		"ttl":         "1h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	resp, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": serial,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	crl := getParsedCrlFromBackend(t, b, s, "crl")
+	requireSerialNumberInCRL(t, crl.TBSCertList, serial)
+
+	// Disabling the mode restores issuance.
+	_, err = CBWrite(b, s, "config/mount", map[string]interface{}{
+		"ca_only": false,
+	})
+	require.NoError(t, err)
+
+	resp, err = CBWrite(b, s, "issue/local-testing", map[string]interface{}{
+		"common_name": "test.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+}
+
+func TestMigrateMountMerge(t *testing.T) {
+	t.Parallel()
+	bSrc, sSrc := createBackendWithStorage(t)
+	bDst, sDst := createBackendWithStorage(t)
+
+	resp, err := CBWrite(bSrc, sSrc, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"issuer_name": "team-root",
+		"key_name":    "team-key",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	srcIssuerId := resp.Data["issuer_id"].(issuerID)
+
+	_, err = CBWrite(bSrc, sSrc, "roles/team", map[string]interface{}{
+		"allow_any_name":  true,
+		"issuer_ref":      string(srcIssuerId),
+		"allowed_issuers": string(srcIssuerId),
+		"key_type":        "ec",
+		"ttl":             "1h",
+	})
+	require.NoError(t, err)
+	_, err = CBWrite(bSrc, sSrc, "roles/shared", map[string]interface{}{
+		"allow_any_name": true,
+		"ttl":            "1h",
+	})
+	require.NoError(t, err)
+
+	resp, err = CBWrite(bSrc, sSrc, "issue/team", map[string]interface{}{
+		"common_name": "revoked.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	revokedSerial := resp.Data["serial_number"].(string)
+	resp, err = CBWrite(bSrc, sSrc, "revoke", map[string]interface{}{
+		"serial_number": revokedSerial,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	// The destination has its own issuer and a conflicting role.
+	resp, err = CBWrite(bDst, sDst, "root/generate/internal", map[string]interface{}{
+		"common_name": "other root example.com",
+		"issuer_name": "platform-root",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	_, err = CBWrite(bDst, sDst, "roles/shared", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"ttl":              "1h",
+	})
+	require.NoError(t, err)
+
+	resp, err = CBRead(bSrc, sSrc, "migrate/export")
+	requireSuccessNonNilResponse(t, resp, err)
+	bundle := resp.Data["bundle"].(string)
+	require.NotEmpty(t, bundle)
+
+	resp, err = CBWrite(bDst, sDst, "migrate/import", map[string]interface{}{
+		"bundle": bundle,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Len(t, resp.Data["imported_keys"], 1)
+	require.Len(t, resp.Data["imported_issuers"], 1)
+	require.Equal(t, []string{"team"}, resp.Data["imported_roles"])
+	require.Equal(t, 2, resp.Data["imported_certs"])
+	require.Equal(t, 1, resp.Data["imported_revocations"])
+	conflicts := resp.Data["conflicts"].([]string)
+	require.Len(t, conflicts, 1)
+	require.Contains(t, conflicts[0], `role "shared"`)
+	dstIssuerId := resp.Data["imported_issuers"].([]string)[0]
+
+	// The issuer keeps its name and the role follows it to its new ID.
+	resp, err = CBRead(bDst, sDst, "issuer/team-root")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, dstIssuerId, string(resp.Data["issuer_id"].(issuerID)))
+	require.NotEmpty(t, resp.Data["key_id"])
+
+	resp, err = CBRead(bDst, sDst, "roles/team")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, dstIssuerId, resp.Data["issuer_ref"])
+	require.Equal(t, []string{dstIssuerId}, resp.Data["allowed_issuers"])
+
+	resp, err = CBWrite(bDst, sDst, "issue/team", map[string]interface{}{
+		"common_name": "merged.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	// The revocation carries over onto the imported issuer's CRL.
+	crl := getParsedCrlFromBackend(t, bDst, sDst, "issuer/team-root/crl/der")
+	requireSerialNumberInCRL(t, crl.TBSCertList, revokedSerial)
+
+	// Imported certificates are indexed for searches.
+	resp, err = CBReq(bDst, sDst, logical.ListOperation, "certs/search", map[string]interface{}{
+		"common_name": "revoked.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, []string{revokedSerial}, resp.Data["keys"])
+
+	// Merging again is a no-op, besides the still-conflicting role.
+	resp, err = CBWrite(bDst, sDst, "migrate/import", map[string]interface{}{
+		"bundle": bundle,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Empty(t, resp.Data["imported_keys"])
+	require.Empty(t, resp.Data["imported_issuers"])
+	require.Empty(t, resp.Data["imported_roles"])
+	require.Equal(t, 0, resp.Data["imported_certs"])
+	require.Equal(t, 0, resp.Data["imported_revocations"])
+	require.Len(t, resp.Data["conflicts"], 1)
+
+	// Certificates filed under another serial number are skipped.
+	rawBundle, err := base64.StdEncoding.DecodeString(bundle)
+	require.NoError(t, err)
+	var tampered mountMergeBundle
+	require.NoError(t, json.Unmarshal(rawBundle, &tampered))
+	for _, certBytes := range tampered.Certs {
+		tampered.Certs = map[string][]byte{"01-02-03": certBytes}
+		break
+	}
+	rawBundle, err = json.Marshal(tampered)
+	require.NoError(t, err)
+	resp, err = CBWrite(bDst, sDst, "migrate/import", map[string]interface{}{
+		"bundle": base64.StdEncoding.EncodeToString(rawBundle),
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, 0, resp.Data["imported_certs"])
+	conflicts = resp.Data["conflicts"].([]string)
+	require.Len(t, conflicts, 2)
+	require.Contains(t, conflicts[1], "certificate 01-02-03")
+	resp, err = CBRead(bDst, sDst, "cert/01:02:03")
+	require.NoError(t, err)
+	require.Nil(t, resp)
+
+	_, err = CBWrite(bDst, sDst, "migrate/import", map[string]interface{}{
+		"bundle": "not-a-bundle",
+	})
+	require.Error(t, err)
+}
+
+func TestMountBackupRestore(t *testing.T) {
+	t.Parallel()
+	bSrc, sSrc := createBackendWithStorage(t)
+	bDst, sDst := createBackendWithStorage(t)
+
+	resp, err := CBWrite(bSrc, sSrc, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"issuer_name": "team-root",
+		"key_name":    "team-key",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	srcIssuerId := resp.Data["issuer_id"].(issuerID)
+	srcKeyId := resp.Data["key_id"].(keyID)
+
+	_, err = CBWrite(bSrc, sSrc, "roles/team", map[string]interface{}{
+		"allow_any_name": true,
+		"issuer_ref":     string(srcIssuerId),
+		"key_type":       "ec",
+		"ttl":            "1h",
+	})
+	require.NoError(t, err)
+	_, err = CBWrite(bSrc, sSrc, "config/urls", map[string]interface{}{
+		"issuing_certificates": "http://pki.example.com/v1/pki/ca",
+	})
+	require.NoError(t, err)
+
+	resp, err = CBWrite(bSrc, sSrc, "issue/team", map[string]interface{}{
+		"common_name": "revoked.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	revokedSerial := resp.Data["serial_number"].(string)
+	_, err = CBWrite(bSrc, sSrc, "revoke", map[string]interface{}{
+		"serial_number": revokedSerial,
+	})
+	require.NoError(t, err)
+
+	// Backups are only exported encrypted.
+	_, err = CBWrite(bSrc, sSrc, "backup/export", map[string]interface{}{})
+	require.ErrorContains(t, err, "missing password")
+
+	resp, err = CBWrite(bSrc, sSrc, "backup/export", map[string]interface{}{
+		"password": "correct horse battery staple",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, 1, resp.Data["keys"])
+	require.Equal(t, 1, resp.Data["issuers"])
+	require.Equal(t, 1, resp.Data["roles"])
+	require.Equal(t, 2, resp.Data["certs"])
+	require.Equal(t, 1, resp.Data["revocations"])
+	bundle := resp.Data["bundle"].(string)
+	require.NotContains(t, bundle, "team-root")
+
+	_, err = CBWrite(bDst, sDst, "backup/restore", map[string]interface{}{
+		"bundle":   bundle,
+		"password": "wrong",
+	})
+	require.ErrorContains(t, err, "unable to decrypt bundle")
+
+	resp, err = CBWrite(bDst, sDst, "backup/restore", map[string]interface{}{
+		"bundle":   bundle,
+		"password": "correct horse battery staple",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, []string{srcKeyId.String()}, resp.Data["restored_keys"])
+	require.Equal(t, []string{srcIssuerId.String()}, resp.Data["restored_issuers"])
+	require.Equal(t, []string{"team"}, resp.Data["restored_roles"])
+	require.Equal(t, 2, resp.Data["restored_certs"])
+	require.Equal(t, 1, resp.Data["restored_revocations"])
+
+	// Identifiers, names, defaults and configuration carry over as-is.
+	resp, err = CBRead(bDst, sDst, "issuer/team-root")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, srcIssuerId, resp.Data["issuer_id"])
+	require.Equal(t, srcKeyId, resp.Data["key_id"])
+
+	resp, err = CBRead(bDst, sDst, "config/issuers")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, srcIssuerId, resp.Data["default"])
+
+	resp, err = CBRead(bDst, sDst, "config/urls")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, []string{"http://pki.example.com/v1/pki/ca"}, resp.Data["issuing_certificates"])
+
+	resp, err = CBRead(bDst, sDst, "roles/team")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, srcIssuerId.String(), resp.Data["issuer_ref"])
+
+	resp, err = CBRead(bDst, sDst, "cert/"+revokedSerial)
+	requireSuccessNonNilResponse(t, resp, err)
+	require.NotZero(t, resp.Data["revocation_time"])
+
+	crl := getParsedCrlFromBackend(t, bDst, sDst, "issuer/team-root/crl/der")
+	requireSerialNumberInCRL(t, crl.TBSCertList, revokedSerial)
+
+	resp, err = CBWrite(bDst, sDst, "issue/team", map[string]interface{}{
+		"common_name": "restored.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	// The destination is no longer empty.
+	_, err = CBWrite(bDst, sDst, "backup/restore", map[string]interface{}{
+		"bundle":   bundle,
+		"password": "correct horse battery staple",
+	})
+	require.ErrorContains(t, err, "empty mount")
+
+	_, err = CBWrite(bDst, sDst, "backup/restore", map[string]interface{}{
+		"bundle":   "not-a-bundle",
+		"password": "correct horse battery staple",
+	})
+	require.Error(t, err)
+}
+
+// Verify that backups are exported and restored in parts, in order.
+func TestMountBackupParts(t *testing.T) {
+	t.Parallel()
+	bSrc, sSrc := createBackendWithStorage(t)
+	bDst, sDst := createBackendWithStorage(t)
+
+	resp, err := CBWrite(bSrc, sSrc, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"issuer_name": "root",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	_, err = CBWrite(bSrc, sSrc, "roles/example", map[string]interface{}{
+		"allow_any_name": true,
+		"key_type":       "ec",
+		"ttl":            "1h",
+	})
+	require.NoError(t, err)
+
+	var serials []string
+	for i := 0; i < 5; i++ {
+		resp, err = CBWrite(bSrc, sSrc, "issue/example", map[string]interface{}{
+			"common_name": fmt.Sprintf("leaf-%d.example.com", i),
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		serials = append(serials, resp.Data["serial_number"].(string))
+	}
+	for _, serial := range serials[3:] {
+		_, err = CBWrite(bSrc, sSrc, "revoke", map[string]interface{}{
+			"serial_number": serial,
+		})
+		require.NoError(t, err)
+	}
+
+	_, err = CBWrite(bSrc, sSrc, "backup/export", map[string]interface{}{
+		"password": "correct horse battery staple",
+		"after":    serials[0],
+	})
+	require.ErrorContains(t, err, "must be given together")
+
+	// The root and five leaves make up six serial numbers, in three parts;
+	// only the first carries the mount's state.
+	var bundles []string
+	var backupId, after string
+	certs, revocations := 0, 0
+	for {
+		resp, err = CBWrite(bSrc, sSrc, "backup/export", map[string]interface{}{
+			"password":  "correct horse battery staple",
+			"backup_id": backupId,
+			"after":     after,
+			"limit":     2,
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		require.LessOrEqual(t, resp.Data["certs"], 2)
+		if backupId == "" {
+			require.Equal(t, 1, resp.Data["issuers"])
+			require.Equal(t, 1, resp.Data["roles"])
+			backupId = resp.Data["backup_id"].(string)
+		} else {
+			require.Equal(t, 0, resp.Data["issuers"])
+			require.Equal(t, backupId, resp.Data["backup_id"])
+		}
+		certs += resp.Data["certs"].(int)
+		revocations += resp.Data["revocations"].(int)
+		bundles = append(bundles, resp.Data["bundle"].(string))
+
+		after = resp.Data["next_after"].(string)
+		if after == "" {
+			break
+		}
+	}
+	require.Len(t, bundles, 3)
+	require.Equal(t, 6, certs)
+	require.Equal(t, 2, revocations)
+
+	restore := func(bundle string) (*logical.Response, error) {
+		return CBWrite(bDst, sDst, "backup/restore", map[string]interface{}{
+			"bundle":   bundle,
+			"password": "correct horse battery staple",
+		})
+	}
+
+	// Parts are restored in order, starting with the first.
+	_, err = restore(bundles[1])
+	require.ErrorContains(t, err, "restore its first part first")
+
+	resp, err = restore(bundles[0])
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Len(t, resp.Data["restored_issuers"], 1)
+	require.NotEmpty(t, resp.Data["next_after"])
+
+	_, err = restore(bundles[2])
+	require.ErrorContains(t, err, "is expected next")
+	_, err = restore(bundles[0])
+	require.ErrorContains(t, err, "restore its part after serial")
+
+	for _, bundle := range bundles[1:] {
+		resp, err = restore(bundle)
+		requireSuccessNonNilResponse(t, resp, err)
+		require.Empty(t, resp.Data["restored_issuers"])
+	}
+	require.Empty(t, resp.Data["next_after"])
+
+	for _, serial := range serials {
+		resp, err = CBRead(bDst, sDst, "cert/"+serial)
+		requireSuccessNonNilResponse(t, resp, err)
+	}
+	crl := getParsedCrlFromBackend(t, bDst, sDst, "issuer/root/crl/der")
+	require.Len(t, crl.TBSCertList.RevokedCertificates, 2)
+	for _, serial := range serials[3:] {
+		requireSerialNumberInCRL(t, crl.TBSCertList, serial)
+	}
+
+	// Once complete, the restored mount is like any other.
+	_, err = restore(bundles[1])
+	require.ErrorContains(t, err, "isn't being restored from")
+}
+
+// Verify that backups leave out cloud KMS credentials, which restoring then
+// requires.
+func TestMountBackupCloudKMSCredentials(t *testing.T) {
+	t.Parallel()
+	bSrc, sSrc := createBackendWithStorage(t)
+	bDst, sDst := createBackendWithStorage(t)
+
+	var signatures int32
+	server, _ := newFakeAWSKMS(t, &signatures)
+	resp, err := CBWrite(bSrc, sSrc, "keys/import/cloud-kms", map[string]interface{}{
+		"key_name":   "cloud",
+		"provider":   "aws",
+		"kms_key":    "alias/pki-root",
+		"region":     "us-east-1",
+		"endpoint":   server.URL,
+		"access_key": "AKIAEXAMPLE",
+		"secret_key": "kms secret",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	keyId := resp.Data["key_id"].(keyID)
+
+	resp, err = CBWrite(bSrc, sSrc, "backup/export", map[string]interface{}{
+		"password": "correct horse battery staple",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.NotEmpty(t, resp.Warnings)
+	bundle := resp.Data["bundle"].(string)
+
+	plaintext, err := openMountBackup(bundle, "correct horse battery staple")
+	require.NoError(t, err)
+	require.NotContains(t, string(plaintext), "kms secret")
+
+	restore := func(credentials map[string]interface{}) (*logical.Response, error) {
+		return CBWrite(bDst, sDst, "backup/restore", map[string]interface{}{
+			"bundle":                bundle,
+			"password":              "correct horse battery staple",
+			"cloud_kms_credentials": credentials,
+		})
+	}
+
+	_, err = restore(nil)
+	require.ErrorContains(t, err, "requires its credentials")
+	_, err = restore(map[string]interface{}{
+		"not-a-key": map[string]interface{}{"secret_key": "kms secret"},
+	})
+	require.ErrorContains(t, err, "isn't in the bundle")
+	_, err = restore(map[string]interface{}{
+		keyId.String(): map[string]interface{}{"password": "kms secret"},
+	})
+	require.ErrorContains(t, err, "unknown credential")
+
+	resp, err = restore(map[string]interface{}{
+		keyId.String(): map[string]interface{}{"secret_key": "kms secret"},
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, []string{keyId.String()}, resp.Data["restored_keys"])
+
+	key, err := bDst.makeStorageContext(ctx, sDst).fetchKeyById(keyId)
+	require.NoError(t, err)
+	ref, ok := parseCloudKMSKeyRef([]byte(key.PrivateKey))
+	require.True(t, ok)
+	require.Equal(t, "kms secret", ref.SecretKey)
+	require.Equal(t, "AKIAEXAMPLE", ref.AccessKey)
+}
+
+func TestEnrollmentPasswords(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	_, err = CBWrite(b, s, "roles/devices", map[string]interface{}{
+		"allowed_domains":    "devices.example.com",
+		"allow_subdomains":   true,
+		"allowed_other_sans": oidUserPrincipalName + ";UTF8:*",
+		"key_type":           "ec",
+		"ttl":                "1h",
+	})
+	require.NoError(t, err)
+
+	// Minting requires an existing role.
+	_, err = CBWrite(b, s, "enrollment/token", map[string]interface{}{
+		"role": "missing",
+	})
+	require.Error(t, err)
+
+	resp, err = CBWrite(b, s, "enrollment/token", map[string]interface{}{
+		"role":          "devices",
+		"allowed_names": "sensor-*.devices.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	password := resp.Data["challenge_password"].(string)
+	tokenId := resp.Data["token_id"].(string)
+	require.Equal(t, 1, resp.Data["uses_remaining"])
+
+	resp, err = CBList(b, s, "enrollment/tokens")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, []string{tokenId}, resp.Data["keys"])
+
+	resp, err = CBRead(b, s, "enrollment/token/"+tokenId)
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, "devices", resp.Data["role"])
+	require.NotContains(t, resp.Data, "challenge_password")
+
+	// Wrong passwords and names outside the password's constraints fail,
+	// without consuming the password.
+	_, err = CBWrite(b, s, "enrollment/issue", map[string]interface{}{
+		"challenge_password": tokenId + ".wrong",
+		"common_name":        "sensor-1.devices.example.com",
+	})
+	require.Error(t, err)
+
+	_, err = CBWrite(b, s, "enrollment/issue", map[string]interface{}{
+		"challenge_password": password,
+		"common_name":        "camera-1.devices.example.com",
+	})
+	require.Error(t, err)
+
+	// Other names, such as User Principal Names, are names too.
+	_, err = CBWrite(b, s, "enrollment/issue", map[string]interface{}{
+		"challenge_password":   password,
+		"common_name":          "sensor-1.devices.example.com",
+		"user_principal_names": "admin@corp.example.com",
+	})
+	require.ErrorContains(t, err, "not allowed by this challenge password")
+
+	_, err = CBWrite(b, s, "enrollment/issue", map[string]interface{}{
+		"challenge_password": password,
+		"common_name":        "sensor-1.devices.example.com",
+		"other_sans":         oidUserPrincipalName + ";UTF8:admin@corp.example.com",
+	})
+	require.ErrorContains(t, err, "not allowed by this challenge password")
+
+	resp, err = CBWrite(b, s, "enrollment/issue", map[string]interface{}{
+		"challenge_password": password,
+		"common_name":        "sensor-1.devices.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.NotEmpty(t, resp.Data["certificate"])
+
+	// Single use: the password is gone now.
+	_, err = CBWrite(b, s, "enrollment/issue", map[string]interface{}{
+		"challenge_password": password,
+		"common_name":        "sensor-2.devices.example.com",
+	})
+	require.Error(t, err)
+
+	resp, err = CBRead(b, s, "enrollment/token/"+tokenId)
+	require.NoError(t, err)
+	require.Nil(t, resp)
+
+	// Signing checks the CSR's names too.
+	resp, err = CBWrite(b, s, "enrollment/token", map[string]interface{}{
+		"role":          "devices",
+		"allowed_names": "sensor-*.devices.example.com",
+		"num_uses":      2,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	password = resp.Data["challenge_password"].(string)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	buildCSR := func(cn string) string {
+		csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: cn},
+		}, key)
+		require.NoError(t, err)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}))
+	}
+
+	_, err = CBWrite(b, s, "enrollment/sign", map[string]interface{}{
+		"challenge_password": password,
+		"csr":                buildCSR("camera-1.devices.example.com"),
+	})
+	require.Error(t, err)
+
+	upnTemplate := &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "sensor-3.devices.example.com"},
+	}
+	require.NoError(t, handleOtherCSRSANs(upnTemplate, map[string][]string{
+		oidUserPrincipalName: {"admin@corp.example.com"},
+	}))
+	upnCSR, err := x509.CreateCertificateRequest(rand.Reader, upnTemplate, key)
+	require.NoError(t, err)
+	_, err = CBWrite(b, s, "enrollment/sign", map[string]interface{}{
+		"challenge_password": password,
+		"csr":                string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: upnCSR})),
+	})
+	require.ErrorContains(t, err, "not allowed by this challenge password")
+
+	resp, err = CBWrite(b, s, "enrollment/sign", map[string]interface{}{
+		"challenge_password": password,
+		"csr":                buildCSR("sensor-3.devices.example.com"),
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	cert := parseCert(t, resp.Data["certificate"].(string))
+	require.Equal(t, "sensor-3.devices.example.com", cert.Subject.CommonName)
+
+	// Passwords can be revoked ahead of use.
+	resp, err = CBList(b, s, "enrollment/tokens")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Len(t, resp.Data["keys"], 1)
+	_, err = CBDelete(b, s, "enrollment/token/"+resp.Data["keys"].([]string)[0])
+	require.NoError(t, err)
+
+	_, err = CBWrite(b, s, "enrollment/sign", map[string]interface{}{
+		"challenge_password": password,
+		"csr":                buildCSR("sensor-4.devices.example.com"),
+	})
+	require.Error(t, err)
+
+	// Requests refused by the role give the use back.
+	resp, err = CBWrite(b, s, "enrollment/token", map[string]interface{}{
+		"role": "devices",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	password = resp.Data["challenge_password"].(string)
+	tokenId = resp.Data["token_id"].(string)
+
+	_, err = CBWrite(b, s, "enrollment/issue", map[string]interface{}{
+		"challenge_password": password,
+		"common_name":        "sensor-5.example.org",
+	})
+	require.Error(t, err)
+
+	resp, err = CBRead(b, s, "enrollment/token/"+tokenId)
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, 1, resp.Data["uses_remaining"])
+
+	resp, err = CBWrite(b, s, "enrollment/issue", map[string]interface{}{
+		"challenge_password": password,
+		"common_name":        "sensor-5.devices.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+}
+
+func TestAutoTidy(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	// Defaults leave auto-tidy disabled.
+	resp, err := CBRead(b, s, "config/auto-tidy")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, false, resp.Data["enabled"])
+	require.Equal(t, 12*60*60, resp.Data["interval_duration"])
+	require.Equal(t, 72*60*60, resp.Data["safety_buffer"])
+
+	// Enabling auto-tidy requires at least one operation.
+	resp, err = CBWrite(b, s, "config/auto-tidy", map[string]interface{}{
+		"enabled": true,
+	})
+	require.Error(t, err)
+
+	resp, err = CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	_, err = CBWrite(b, s, "roles/test", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"ttl":              "1s",
+		"max_ttl":          "1s",
+	})
+	require.NoError(t, err)
+	resp, err = CBWrite(b, s, "issue/test", map[string]interface{}{
+		"common_name": "test.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	leafSerial := normalizeSerial(resp.Data["serial_number"].(string))
+
+	resp, err = CBWrite(b, s, "config/auto-tidy", map[string]interface{}{
+		"enabled":           true,
+		"interval_duration": "1s",
+		"tidy_cert_store":   true,
+		"safety_buffer":     "1s",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, true, resp.Data["enabled"])
+	require.Equal(t, 1, resp.Data["interval_duration"])
+	require.Equal(t, true, resp.Data["tidy_cert_store"])
+	require.Equal(t, false, resp.Data["tidy_revoked_certs"])
+
+	// Once the leaf is past its safety buffer, the periodic function tidies
+	// it without any explicit call to tidy.
+	time.Sleep(3 * time.Second)
+	require.NoError(t, b.periodicFunc(ctx, &logical.Request{Storage: s}))
+
+	resp = waitForTidyToFinish(t, b, s)
+	require.Equal(t, "Finished", resp.Data["state"])
+	require.Equal(t, true, resp.Data["tidy_cert_store"])
+	require.Equal(t, uint(1), resp.Data["cert_store_deleted_count"])
+
+	resp, err = CBRead(b, s, "cert/"+leafSerial)
+	require.NoError(t, err)
+	require.Nil(t, resp)
+
+	// Disabling auto-tidy stops further runs.
+	_, err = CBWrite(b, s, "config/auto-tidy", map[string]interface{}{
+		"enabled": false,
+	})
+	require.NoError(t, err)
+	time.Sleep(1500 * time.Millisecond)
+	lastTidy := b.getLastTidy()
+	require.NoError(t, b.periodicFunc(ctx, &logical.Request{Storage: s}))
+	require.Equal(t, lastTidy, b.getLastTidy())
+}
+
+func TestTidyExpiredIssuers(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	// A short-lived root which will expire, and a long-lived one to be the
+	// default.
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "expiring root example.com",
+		"key_type":    "ec",
+		"ttl":         "2s",
+		"issuer_name": "expiring",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	expiringID := resp.Data["issuer_id"].(issuerID)
+
+	resp, err = CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+		"issuer_name": "current",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	currentID := resp.Data["issuer_id"].(issuerID)
+
+	_, err = CBWrite(b, s, "config/issuers", map[string]interface{}{
+		"default": "current",
+	})
+	require.NoError(t, err)
+
+	_, err = CBRead(b, s, "crl/rotate")
+	require.NoError(t, err)
+
+	sc := b.makeStorageContext(ctx, s)
+	crlConfig, err := sc.getLocalCRLConfig()
+	require.NoError(t, err)
+	expiringCRL, ok := crlConfig.IssuerIDCRLMap[expiringID]
+	require.True(t, ok)
+	entry, err := s.Get(ctx, "crls/"+expiringCRL.String())
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+
+	// The expiring issuer is kept while within its buffer.
+	_, err = CBWrite(b, s, "tidy", map[string]interface{}{
+		"tidy_expired_issuers": true,
+	})
+	require.NoError(t, err)
+	resp = waitForTidyToFinish(t, b, s)
+	require.Equal(t, "Finished", resp.Data["state"])
+	require.Equal(t, true, resp.Data["tidy_expired_issuers"])
+	require.Equal(t, 365*24*60*60, resp.Data["issuer_safety_buffer"])
+	require.Equal(t, uint(0), resp.Data["issuer_deleted_count"])
+
+	// A deleted issuer's final CRL is tidied once it expires.
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"retired_issuer_crl_expiry": "1s",
+	})
+	require.NoError(t, err)
+	resp, err = CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "retired root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	retiredID := resp.Data["issuer_id"].(issuerID)
+	_, err = CBRead(b, s, "crl/rotate")
+	require.NoError(t, err)
+	_, err = CBDelete(b, s, "issuer/"+retiredID.String())
+	require.NoError(t, err)
+	entry, err = s.Get(ctx, retiredCRLPath+retiredID.String())
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+
+	time.Sleep(3 * time.Second)
+
+	_, err = CBWrite(b, s, "tidy", map[string]interface{}{
+		"tidy_expired_issuers": true,
+		"issuer_safety_buffer": "1s",
+	})
+	require.NoError(t, err)
+	resp = waitForTidyToFinish(t, b, s)
+	require.Equal(t, "Finished", resp.Data["state"])
+	require.Equal(t, uint(1), resp.Data["issuer_deleted_count"])
+
+	issuers, err := sc.listIssuers()
+	require.NoError(t, err)
+	require.NotContains(t, issuers, expiringID)
+	require.Contains(t, issuers, currentID)
+
+	// Its CRL went along with it.
+	entry, err = s.Get(ctx, "crls/"+expiringCRL.String())
+	require.NoError(t, err)
+	require.Nil(t, entry)
+	crlConfig, err = sc.getLocalCRLConfig()
+	require.NoError(t, err)
+	require.NotContains(t, crlConfig.IssuerIDCRLMap, expiringID)
+	require.Contains(t, crlConfig.IssuerIDCRLMap, currentID)
+
+	// No final CRL is built for an expired issuer, and the expired final
+	// CRL of the deleted one is gone.
+	retired, err := s.List(ctx, retiredCRLPath)
+	require.NoError(t, err)
+	require.Empty(t, retired)
+}
+
+func TestTemplatedAIAURLs(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	aiaData := map[string]interface{}{
+		"crl_distribution_points": "{{cluster_path}}/issuer/{{issuer_id}}/crl/der",
+		"issuing_certificates":    "{{cluster_path}}/issuer/{{issuer_id}}/der",
+		"ocsp_servers":            "{{cluster_path}}/ocsp",
+		"enable_templating":       true,
+	}
+
+	// Templates using the cluster path require it to be set.
+	_, err := CBWrite(b, s, "config/urls", aiaData)
+	require.Error(t, err)
+
+	_, err = CBWrite(b, s, "config/cluster", map[string]interface{}{
+		"path": "not a url",
+	})
+	require.Error(t, err)
+
+	resp, err := CBWrite(b, s, "config/cluster", map[string]interface{}{
+		"path": "http://localhost:8200/v1/pki",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, "http://localhost:8200/v1/pki", resp.Data["path"])
+
+	_, err = CBWrite(b, s, "config/urls", aiaData)
+	require.NoError(t, err)
+	resp, err = CBRead(b, s, "config/urls")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, true, resp.Data["enable_templating"])
+	require.Equal(t, []string{"{{cluster_path}}/ocsp"}, resp.Data["ocsp_servers"])
+
+	// Unknown template parameters are rejected.
+	_, err = CBWrite(b, s, "config/urls", map[string]interface{}{
+		"ocsp_servers": "{{cluster_path}}/{{unknown}}",
+	})
+	require.Error(t, err)
+
+	// Self-signed roots don't know their issuer ID yet, so don't get the
+	// templated URLs.
+	resp, err = CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rootID := resp.Data["issuer_id"].(issuerID)
+	rootCert := parseCert(t, resp.Data["certificate"].(string))
+	require.Empty(t, rootCert.OCSPServer)
+	require.Empty(t, rootCert.IssuingCertificateURL)
+	require.Empty(t, rootCert.CRLDistributionPoints)
+
+	_, err = CBWrite(b, s, "roles/test", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"ttl":              "1h",
+	})
+	require.NoError(t, err)
+
+	resp, err = CBWrite(b, s, "issue/test", map[string]interface{}{
+		"common_name": "test.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	leafCert := parseCert(t, resp.Data["certificate"].(string))
+	require.Equal(t, []string{"http://localhost:8200/v1/pki/ocsp"}, leafCert.OCSPServer)
+	require.Equal(t, []string{"http://localhost:8200/v1/pki/issuer/" + rootID.String() + "/der"}, leafCert.IssuingCertificateURL)
+	require.Equal(t, []string{"http://localhost:8200/v1/pki/issuer/" + rootID.String() + "/crl/der"}, leafCert.CRLDistributionPoints)
+
+	// Once the cluster path is gone, issuance fails rather than producing
+	// certificates with broken URLs.
+	_, err = CBWrite(b, s, "config/cluster", map[string]interface{}{
+		"path": "",
+	})
+	require.NoError(t, err)
+	_, err = CBWrite(b, s, "issue/test", map[string]interface{}{
+		"common_name": "test.example.com",
+	})
+	require.Error(t, err)
+}
+
+func TestEST(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rootCert := parseCert(t, resp.Data["certificate"].(string))
+
+	_, err = CBWrite(b, s, "roles/devices", map[string]interface{}{
+		"allowed_domains":  "devices.example.com",
+		"allow_subdomains": true,
+		"key_type":         "any",
+		"ttl":              "1h",
+	})
+	require.NoError(t, err)
+
+	estRequest := func(op logical.Operation, path string, csr []byte, headers map[string][]string, peer *x509.Certificate) *logical.Response {
+		req := &logical.Request{
+			Operation:  op,
+			Path:       path,
+			Storage:    s,
+			Headers:    headers,
+			Connection: &logical.Connection{},
+			MountPoint: "pki/",
+		}
+		if csr != nil {
+			req.HTTPRequest = httptest.NewRequest(http.MethodPost, "/v1/pki/"+path, strings.NewReader(base64.StdEncoding.EncodeToString(csr)))
+		}
+		if peer != nil {
+			req.Connection.ConnState = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{peer}}
+		}
+
+		resp, err := b.HandleRequest(ctx, req)
+		require.NoError(t, err)
+		require.NotNil(t, resp)
+		return resp
+	}
+	requireStatus := func(resp *logical.Response, status int) {
+		t.Helper()
+		require.Equal(t, status, resp.Data[logical.HTTPStatusCode], "body: %s", resp.Data[logical.HTTPRawBody])
+	}
+	parseCerts := func(resp *logical.Response) []*x509.Certificate {
+		t.Helper()
+		requireStatus(resp, http.StatusOK)
+		require.Equal(t, []string{"base64"}, resp.Headers["Content-Transfer-Encoding"])
+		der, err := base64.StdEncoding.DecodeString(string(resp.Data[logical.HTTPRawBody].([]byte)))
+		require.NoError(t, err)
+
+		var contentInfo struct {
+			ContentType asn1.ObjectIdentifier
+			Content     struct {
+				Version          int
+				DigestAlgorithms asn1.RawValue
+				ContentInfo      asn1.RawValue
+				Certificates     []asn1.RawValue `asn1:"tag:0"`
+				SignerInfos      asn1.RawValue
+			} `asn1:"explicit,tag:0"`
+		}
+		_, err = asn1.Unmarshal(der, &contentInfo)
+		require.NoError(t, err)
+		require.True(t, contentInfo.ContentType.Equal(oidPkcs7SignedData))
+
+		var certs []*x509.Certificate
+		for _, raw := range contentInfo.Content.Certificates {
+			cert, err := x509.ParseCertificate(raw.FullBytes)
+			require.NoError(t, err)
+			certs = append(certs, cert)
+		}
+		return certs
+	}
+	newCSR := func(cn string) (crypto.Signer, []byte) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: cn},
+			DNSNames: []string{cn},
+		}, key)
+		require.NoError(t, err)
+		return key, csr
+	}
+	basicAuth := func(password string) map[string][]string {
+		return map[string][]string{
+			"Authorization": {"Basic " + base64.StdEncoding.EncodeToString([]byte("device:"+password))},
+		}
+	}
+
+	// EST is disabled by default.
+	requireStatus(estRequest(logical.ReadOperation, "est/cacerts", nil, nil, nil), http.StatusNotFound)
+
+	// Labels must map to existing roles.
+	_, err = CBWrite(b, s, "config/est", map[string]interface{}{
+		"enabled":       true,
+		"label_to_role": map[string]string{"routers": "missing"},
+	})
+	require.Error(t, err)
+
+	resp, err = CBWrite(b, s, "config/est", map[string]interface{}{
+		"enabled":       true,
+		"default_role":  "devices",
+		"label_to_role": map[string]string{"routers": "devices"},
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, true, resp.Data["enable_basic_auth"])
+	require.Equal(t, false, resp.Data["enable_cert_auth"])
+
+	for _, path := range []string{"est/cacerts", "est/routers/cacerts"} {
+		certs := parseCerts(estRequest(logical.ReadOperation, path, nil, nil, nil))
+		require.Len(t, certs, 1)
+		require.True(t, rootCert.Equal(certs[0]))
+	}
+	requireStatus(estRequest(logical.ReadOperation, "est/unknown/cacerts", nil, nil, nil), http.StatusNotFound)
+
+	// Enrolling requires authentication.
+	_, csr := newCSR("router1.devices.example.com")
+	resp = estRequest(logical.UpdateOperation, "est/routers/simpleenroll", csr, nil, nil)
+	requireStatus(resp, http.StatusUnauthorized)
+	require.Equal(t, []string{`Basic realm="est"`}, resp.Headers["WWW-Authenticate"])
+
+	resp, err = CBWrite(b, s, "enrollment/token", map[string]interface{}{
+		"role": "devices",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	password := resp.Data["challenge_password"].(string)
+
+	requireStatus(estRequest(logical.UpdateOperation, "est/routers/simpleenroll", csr, basicAuth("wrong.password"), nil), http.StatusUnauthorized)
+
+	certs := parseCerts(estRequest(logical.UpdateOperation, "est/routers/simpleenroll", csr, basicAuth(password), nil))
+	require.Len(t, certs, 1)
+	issued := certs[0]
+	require.Equal(t, "router1.devices.example.com", issued.Subject.CommonName)
+	require.NoError(t, issued.CheckSignatureFrom(rootCert))
+
+	// The enrollment password was single-use.
+	requireStatus(estRequest(logical.UpdateOperation, "est/routers/simpleenroll", csr, basicAuth(password), nil), http.StatusUnauthorized)
+
+	// Re-enrollment requires the certificate being renewed, matching the
+	// CSR.
+	_, renewCSR := newCSR("router1.devices.example.com")
+	requireStatus(estRequest(logical.UpdateOperation, "est/routers/simplereenroll", renewCSR, nil, nil), http.StatusUnauthorized)
+
+	_, otherCSR := newCSR("router2.devices.example.com")
+	requireStatus(estRequest(logical.UpdateOperation, "est/routers/simplereenroll", otherCSR, nil, issued), http.StatusBadRequest)
+
+	certs = parseCerts(estRequest(logical.UpdateOperation, "est/routers/simplereenroll", renewCSR, nil, issued))
+	require.Len(t, certs, 1)
+	require.Equal(t, "router1.devices.example.com", certs[0].Subject.CommonName)
+	require.NotEqual(t, issued.SerialNumber, certs[0].SerialNumber)
+
+	// With cert auth enabled, certificates issued by this mount
+	// authenticate enrollments for their own identity only.
+	requireStatus(estRequest(logical.UpdateOperation, "est/simpleenroll", renewCSR, nil, issued), http.StatusUnauthorized)
+	resp, err = CBWrite(b, s, "config/est", map[string]interface{}{
+		"enable_cert_auth": true,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	requireStatus(estRequest(logical.UpdateOperation, "est/simpleenroll", otherCSR, nil, issued), http.StatusBadRequest)
+	certs = parseCerts(estRequest(logical.UpdateOperation, "est/simpleenroll", renewCSR, nil, issued))
+	require.Equal(t, "router1.devices.example.com", certs[0].Subject.CommonName)
+
+	// Uses of enrollment passwords are given back when issuance fails.
+	resp, err = CBWrite(b, s, "enrollment/token", map[string]interface{}{
+		"role": "devices",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	password = resp.Data["challenge_password"].(string)
+	_, deniedCSR := newCSR("router3.example.com")
+	requireStatus(estRequest(logical.UpdateOperation, "est/simpleenroll", deniedCSR, basicAuth(password), nil), http.StatusBadRequest)
+	parseCerts(estRequest(logical.UpdateOperation, "est/simpleenroll", otherCSR, basicAuth(password), nil))
+	requireStatus(estRequest(logical.UpdateOperation, "est/simpleenroll", otherCSR, basicAuth(password), nil), http.StatusUnauthorized)
+
+	// Certificates issued under another role, or not for client
+	// authentication, are rejected.
+	_, err = CBWrite(b, s, "roles/others", map[string]interface{}{
+		"allowed_domains":  "devices.example.com",
+		"allow_subdomains": true,
+		"key_type":         "ec",
+		"ttl":              "1h",
+	})
+	require.NoError(t, err)
+	_, err = CBWrite(b, s, "roles/servers", map[string]interface{}{
+		"allowed_domains":  "devices.example.com",
+		"allow_subdomains": true,
+		"key_type":         "ec",
+		"client_flag":      false,
+		"ttl":              "1h",
+	})
+	require.NoError(t, err)
+	resp, err = CBWrite(b, s, "config/est", map[string]interface{}{
+		"label_to_role": map[string]string{"routers": "devices", "servers": "servers"},
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	resp, err = CBWrite(b, s, "issue/others", map[string]interface{}{
+		"common_name": "router1.devices.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	requireStatus(estRequest(logical.UpdateOperation, "est/routers/simplereenroll", renewCSR, nil, parseCert(t, resp.Data["certificate"].(string))), http.StatusUnauthorized)
+
+	resp, err = CBWrite(b, s, "issue/servers", map[string]interface{}{
+		"common_name": "router1.devices.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	requireStatus(estRequest(logical.UpdateOperation, "est/servers/simplereenroll", renewCSR, nil, parseCert(t, resp.Data["certificate"].(string))), http.StatusUnauthorized)
+
+	// Revoked certificates are rejected.
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": serialFromCert(issued),
+	})
+	require.NoError(t, err)
+	requireStatus(estRequest(logical.UpdateOperation, "est/simplereenroll", renewCSR, nil, issued), http.StatusUnauthorized)
+
+	// Certificates from elsewhere are rejected.
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	selfSignedTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "router1.devices.example.com"},
+		DNSNames:     []string{"router1.devices.example.com"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	selfSignedDer, err := x509.CreateCertificate(rand.Reader, selfSignedTemplate, selfSignedTemplate, otherKey.Public(), otherKey)
+	require.NoError(t, err)
+	selfSigned, err := x509.ParseCertificate(selfSignedDer)
+	require.NoError(t, err)
+	requireStatus(estRequest(logical.UpdateOperation, "est/simplereenroll", renewCSR, nil, selfSigned), http.StatusUnauthorized)
+}
+
+func TestSCEP(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "rsa",
+		"key_bits":    2048,
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rootCert := parseCert(t, resp.Data["certificate"].(string))
+
+	_, err = CBWrite(b, s, "roles/devices", map[string]interface{}{
+		"allowed_domains":  "devices.example.com",
+		"allow_subdomains": true,
+		"key_type":         "any",
+		"ttl":              "1h",
+	})
+	require.NoError(t, err)
+	_, err = CBWrite(b, s, "roles/phones", map[string]interface{}{
+		"allowed_domains":  "phones.example.com",
+		"allow_subdomains": true,
+		"key_type":         "any",
+		"ttl":              "1h",
+	})
+	require.NoError(t, err)
+
+	scepRequest := func(path string, operation string, message []byte, get bool) *logical.Response {
+		req := &logical.Request{
+			Operation:  logical.ReadOperation,
+			Path:       path,
+			Storage:    s,
+			Data:       map[string]interface{}{"operation": operation},
+			Connection: &logical.Connection{},
+			MountPoint: "pki/",
+		}
+		if message != nil && get {
+			req.Data["message"] = base64.StdEncoding.EncodeToString(message)
+		} else if message != nil {
+			req.Operation = logical.UpdateOperation
+			req.Data = nil
+			req.HTTPRequest = httptest.NewRequest(http.MethodPost, "/v1/pki/"+path+"?operation="+operation, bytes.NewReader(message))
+		}
+
+		resp, err := b.HandleRequest(ctx, req)
+		require.NoError(t, err)
+		require.NotNil(t, resp)
+		return resp
+	}
+	requireStatus := func(resp *logical.Response, status int) {
+		t.Helper()
+		require.Equal(t, status, resp.Data[logical.HTTPStatusCode], "body: %s", resp.Data[logical.HTTPRawBody])
+	}
+
+	// newDevice generates a key, along with the self-signed certificate a
+	// device signs its initial enrollment with.
+	newDevice := func(cn string) (*rsa.PrivateKey, *x509.Certificate) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: cn},
+			NotBefore:    time.Now().Add(-time.Minute),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+		require.NoError(t, err)
+		cert, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		return key, cert
+	}
+	// newCSR builds a CSR carrying the given challenge password, which the
+	// standard library can't encode.
+	newCSR := func(key *rsa.PrivateKey, cn string, challenge string) []byte {
+		der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: cn},
+			DNSNames: []string{cn},
+		}, key)
+		require.NoError(t, err)
+		csr, err := x509.ParseCertificateRequest(der)
+		require.NoError(t, err)
+
+		// Keep the attributes (the extension request) of the original.
+		input := cryptobyte.String(csr.RawTBSCertificateRequest)
+		var original, existing cryptobyte.String
+		require.True(t, input.ReadASN1(&original, cbbasn1.SEQUENCE))
+		require.True(t, original.SkipASN1(cbbasn1.INTEGER))
+		require.True(t, original.SkipASN1(cbbasn1.SEQUENCE))
+		require.True(t, original.SkipASN1(cbbasn1.SEQUENCE))
+		require.True(t, original.ReadASN1(&existing, cbbasn1.Tag(0).Constructed().ContextSpecific()))
+
+		var tbs cryptobyte.Builder
+		tbs.AddASN1(cbbasn1.SEQUENCE, func(tbs *cryptobyte.Builder) {
+			tbs.AddASN1Int64(0)
+			tbs.AddBytes(csr.RawSubject)
+			tbs.AddBytes(csr.RawSubjectPublicKeyInfo)
+			tbs.AddASN1(cbbasn1.Tag(0).Constructed().ContextSpecific(), func(attributes *cryptobyte.Builder) {
+				attributes.AddBytes(existing)
+				if challenge == "" {
+					return
+				}
+				attributes.AddASN1(cbbasn1.SEQUENCE, func(attribute *cryptobyte.Builder) {
+					attribute.AddASN1ObjectIdentifier(oidChallengePassword)
+					attribute.AddASN1(cbbasn1.SET, func(values *cryptobyte.Builder) {
+						values.AddASN1(cbbasn1.UTF8String, func(value *cryptobyte.Builder) {
+							value.AddBytes([]byte(challenge))
+						})
+					})
+				})
+			})
+		})
+		tbsBytes, err := tbs.Bytes()
+		require.NoError(t, err)
+
+		digest := sha256.Sum256(tbsBytes)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+
+		var out cryptobyte.Builder
+		out.AddASN1(cbbasn1.SEQUENCE, func(out *cryptobyte.Builder) {
+			out.AddBytes(tbsBytes)
+			out.AddASN1(cbbasn1.SEQUENCE, func(algorithm *cryptobyte.Builder) {
+				algorithm.AddASN1ObjectIdentifier(asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11})
+				algorithm.AddASN1NULL()
+			})
+			out.AddASN1BitString(signature)
+		})
+		csrBytes, err := out.Bytes()
+		require.NoError(t, err)
+		return csrBytes
+	}
+	newMessage := func(messageType string, csr []byte, key *rsa.PrivateKey, signer *x509.Certificate) ([]byte, []byte) {
+		envelope, err := pkcs7.Encrypt(csr, []*x509.Certificate{rootCert})
+		require.NoError(t, err)
+
+		nonce := make([]byte, 16)
+		_, err = rand.Read(nonce)
+		require.NoError(t, err)
+
+		signedData, err := pkcs7.NewSignedData(envelope)
+		require.NoError(t, err)
+		require.NoError(t, signedData.AddSigner(signer, key, pkcs7.SignerInfoConfig{
+			ExtraSignedAttributes: []pkcs7.Attribute{
+				{Type: oidScepMessageType, Value: messageType},
+				{Type: oidScepTransactionID, Value: "transaction-1"},
+				{Type: oidScepSenderNonce, Value: nonce},
+			},
+		}))
+		message, err := signedData.Finish()
+		require.NoError(t, err)
+		return message, nonce
+	}
+	// parseReply verifies the CertRep message and returns its status and,
+	// on success, the issued certificate.
+	parseReply := func(resp *logical.Response, nonce []byte, key *rsa.PrivateKey, signer *x509.Certificate) (string, *x509.Certificate) {
+		t.Helper()
+		requireStatus(resp, http.StatusOK)
+		require.Equal(t, scepContentTypeMessage, resp.Data[logical.HTTPContentType])
+
+		p7, err := pkcs7.Parse(resp.Data[logical.HTTPRawBody].([]byte))
+		require.NoError(t, err)
+		require.NoError(t, p7.Verify())
+		require.True(t, rootCert.Equal(p7.GetOnlySigner()))
+
+		var messageType, status, transactionID string
+		var recipientNonce []byte
+		require.NoError(t, p7.UnmarshalSignedAttribute(oidScepMessageType, &messageType))
+		require.NoError(t, p7.UnmarshalSignedAttribute(oidScepPkiStatus, &status))
+		require.NoError(t, p7.UnmarshalSignedAttribute(oidScepTransactionID, &transactionID))
+		require.NoError(t, p7.UnmarshalSignedAttribute(oidScepRecipientNonce, &recipientNonce))
+		require.Equal(t, scepMessageTypeCertRep, messageType)
+		require.Equal(t, "transaction-1", transactionID)
+		require.Equal(t, nonce, recipientNonce)
+		if status != scepStatusSuccess {
+			return status, nil
+		}
+
+		// The issued certificate is encrypted with AES, as advertised,
+		// without changing the pkcs7 library's package-wide default.
+		aesOID, err := asn1.Marshal(pkcs7.OIDEncryptionAlgorithmAES128CBC)
+		require.NoError(t, err)
+		require.True(t, bytes.Contains(p7.Content, aesOID))
+		require.Equal(t, pkcs7.EncryptionAlgorithmDESCBC, pkcs7.ContentEncryptionAlgorithm)
+
+		envelope, err := pkcs7.Parse(p7.Content)
+		require.NoError(t, err)
+		degenerate, err := envelope.Decrypt(signer, key)
+		require.NoError(t, err)
+		certs, err := pkcs7.Parse(degenerate)
+		require.NoError(t, err)
+		require.Len(t, certs.Certificates, 1)
+		return status, certs.Certificates[0]
+	}
+
+	// SCEP is disabled by default.
+	requireStatus(scepRequest("scep/pkiclient.exe", scepOperationGetCACert, nil, true), http.StatusNotFound)
+
+	// Some challenge must be usable.
+	_, err = CBWrite(b, s, "config/scep", map[string]interface{}{
+		"enabled":                  true,
+		"default_role":             "devices",
+		"allow_dynamic_challenges": false,
+	})
+	require.Error(t, err)
+
+	resp, err = CBWrite(b, s, "config/scep", map[string]interface{}{
+		"enabled":           true,
+		"default_role":      "devices",
+		"label_to_role":     map[string]string{"phones": "phones"},
+		"static_challenges": map[string]string{"devices": "static-secret"},
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, []string{"devices"}, resp.Data["static_challenge_roles"])
+	require.Equal(t, true, resp.Data["allow_dynamic_challenges"])
+
+	resp = scepRequest("scep/pkiclient.exe", scepOperationGetCACaps, nil, true)
+	requireStatus(resp, http.StatusOK)
+	require.Contains(t, string(resp.Data[logical.HTTPRawBody].([]byte)), "POSTPKIOperation")
+
+	resp = scepRequest("scep/phones/pkiclient.exe", scepOperationGetCACert, nil, true)
+	requireStatus(resp, http.StatusOK)
+	require.Equal(t, scepContentTypeCACert, resp.Data[logical.HTTPContentType])
+	require.Equal(t, rootCert.Raw, resp.Data[logical.HTTPRawBody])
+	requireStatus(scepRequest("scep/unknown/pkiclient.exe", scepOperationGetCACert, nil, true), http.StatusNotFound)
+
+	// Enroll with the static challenge, over both POST and GET.
+	key, signer := newDevice("router1.devices.example.com")
+	message, nonce := newMessage(scepMessageTypePKCSReq, newCSR(key, "router1.devices.example.com", "wrong-secret"), key, signer)
+	status, _ := parseReply(scepRequest("scep/pkiclient.exe", scepOperationPKIOperation, message, false), nonce, key, signer)
+	require.Equal(t, scepStatusFailure, status)
+
+	message, nonce = newMessage(scepMessageTypePKCSReq, newCSR(key, "router1.devices.example.com", "static-secret"), key, signer)
+	status, issued := parseReply(scepRequest("scep/pkiclient.exe", scepOperationPKIOperation, message, false), nonce, key, signer)
+	require.Equal(t, scepStatusSuccess, status)
+	require.Equal(t, "router1.devices.example.com", issued.Subject.CommonName)
+	require.NoError(t, issued.CheckSignatureFrom(rootCert))
+
+	message, nonce = newMessage(scepMessageTypePKCSReq, newCSR(key, "router1.devices.example.com", "static-secret"), key, signer)
+	status, _ = parseReply(scepRequest("scep/pkiclient.exe", scepOperationPKIOperation, message, true), nonce, key, signer)
+	require.Equal(t, scepStatusSuccess, status)
+
+	// The static challenge is bound to its role.
+	phoneKey, phoneSigner := newDevice("phone1.phones.example.com")
+	message, nonce = newMessage(scepMessageTypePKCSReq, newCSR(phoneKey, "phone1.phones.example.com", "static-secret"), phoneKey, phoneSigner)
+	status, _ = parseReply(scepRequest("scep/phones/pkiclient.exe", scepOperationPKIOperation, message, false), nonce, phoneKey, phoneSigner)
+	require.Equal(t, scepStatusFailure, status)
+
+	// Dynamic challenges are single-use, and bound to the label's role.
+	resp, err = CBWrite(b, s, "scep/phones/challenge", map[string]interface{}{})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, "phones", resp.Data["role"])
+	challenge := resp.Data["challenge"].(string)
+
+	message, nonce = newMessage(scepMessageTypePKCSReq, newCSR(key, "router1.devices.example.com", challenge), key, signer)
+	status, _ = parseReply(scepRequest("scep/pkiclient.exe", scepOperationPKIOperation, message, false), nonce, key, signer)
+	require.Equal(t, scepStatusFailure, status)
+
+	// Enrollments the role refuses give the use back.
+	message, nonce = newMessage(scepMessageTypePKCSReq, newCSR(phoneKey, "phone1.example.org", challenge), phoneKey, phoneSigner)
+	status, _ = parseReply(scepRequest("scep/phones/pkiclient.exe", scepOperationPKIOperation, message, false), nonce, phoneKey, phoneSigner)
+	require.Equal(t, scepStatusFailure, status)
+
+	message, nonce = newMessage(scepMessageTypePKCSReq, newCSR(phoneKey, "phone1.phones.example.com", challenge), phoneKey, phoneSigner)
+	status, phoneCert := parseReply(scepRequest("scep/phones/pkiclient.exe", scepOperationPKIOperation, message, false), nonce, phoneKey, phoneSigner)
+	require.Equal(t, scepStatusSuccess, status)
+	require.Equal(t, "phone1.phones.example.com", phoneCert.Subject.CommonName)
+
+	message, nonce = newMessage(scepMessageTypePKCSReq, newCSR(phoneKey, "phone1.phones.example.com", challenge), phoneKey, phoneSigner)
+	status, _ = parseReply(scepRequest("scep/phones/pkiclient.exe", scepOperationPKIOperation, message, false), nonce, phoneKey, phoneSigner)
+	require.Equal(t, scepStatusFailure, status)
+
+	// Initial enrollments must be signed with the key of the CSR.
+	otherKey, _ := newDevice("router2.devices.example.com")
+	message, nonce = newMessage(scepMessageTypePKCSReq, newCSR(otherKey, "router2.devices.example.com", "static-secret"), key, signer)
+	status, _ = parseReply(scepRequest("scep/pkiclient.exe", scepOperationPKIOperation, message, false), nonce, key, signer)
+	require.Equal(t, scepStatusFailure, status)
+
+	// Renewals are signed with the certificate being renewed, and need no
+	// challenge.
+	newKey, _ := newDevice("router1.devices.example.com")
+	message, nonce = newMessage(scepMessageTypeRenewalReq, newCSR(newKey, "router1.devices.example.com", ""), key, issued)
+	status, renewed := parseReply(scepRequest("scep/pkiclient.exe", scepOperationPKIOperation, message, false), nonce, key, issued)
+	require.Equal(t, scepStatusSuccess, status)
+	require.Equal(t, "router1.devices.example.com", renewed.Subject.CommonName)
+	require.NotEqual(t, issued.SerialNumber, renewed.SerialNumber)
+
+	message, nonce = newMessage(scepMessageTypeRenewalReq, newCSR(newKey, "router1.devices.example.com", ""), key, signer)
+	status, _ = parseReply(scepRequest("scep/pkiclient.exe", scepOperationPKIOperation, message, false), nonce, key, signer)
+	require.Equal(t, scepStatusFailure, status)
+}
+
+func TestCMP(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rootCert := parseCert(t, resp.Data["certificate"].(string))
+
+	_, err = CBWrite(b, s, "roles/devices", map[string]interface{}{
+		"allowed_domains":  "devices.example.com",
+		"allow_subdomains": true,
+		"key_type":         "any",
+		"ttl":              "1h",
+	})
+	require.NoError(t, err)
+
+	cmpRequest := func(path string, message []byte) *logical.Response {
+		req := &logical.Request{
+			Operation:   logical.UpdateOperation,
+			Path:        path,
+			Storage:     s,
+			Connection:  &logical.Connection{},
+			MountPoint:  "pki/",
+			HTTPRequest: httptest.NewRequest(http.MethodPost, "/v1/pki/"+path, bytes.NewReader(message)),
+		}
+
+		resp, err := b.HandleRequest(ctx, req)
+		require.NoError(t, err)
+		require.NotNil(t, resp)
+		return resp
+	}
+	sequenceContents := func(der []byte) []byte {
+		input := cryptobyte.String(der)
+		var contents cryptobyte.String
+		require.True(t, input.ReadASN1(&contents, cbbasn1.SEQUENCE))
+		return contents
+	}
+	ecdsaWithSHA256 := pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}}
+	sign := func(key *ecdsa.PrivateKey, data []byte) []byte {
+		digest := sha256.Sum256(data)
+		signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		require.NoError(t, err)
+		return signature
+	}
+
+	// newCertReq builds the body of a certificate request for the key and
+	// name, with signature-based proof of possession.
+	newCertReq := func(bodyTag int, key *ecdsa.PrivateKey, cn string, validPOP bool) asn1.RawValue {
+		subject, err := asn1.Marshal(pkix.Name{CommonName: cn}.ToRDNSequence())
+		require.NoError(t, err)
+		publicKey, err := x509.MarshalPKIXPublicKey(key.Public())
+		require.NoError(t, err)
+		san, err := asn1.Marshal([]asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte(cn)}})
+		require.NoError(t, err)
+		extensions, err := asn1.Marshal([]pkix.Extension{{Id: asn1.ObjectIdentifier{2, 5, 29, 17}, Value: san}})
+		require.NoError(t, err)
+
+		var builder cryptobyte.Builder
+		builder.AddASN1(cbbasn1.SEQUENCE, func(certReq *cryptobyte.Builder) {
+			certReq.AddASN1Int64(0)
+			certReq.AddASN1(cbbasn1.SEQUENCE, func(template *cryptobyte.Builder) {
+				template.AddASN1(cbbasn1.Tag(5).Constructed().ContextSpecific(), func(name *cryptobyte.Builder) {
+					name.AddBytes(subject)
+				})
+				template.AddASN1(cbbasn1.Tag(6).Constructed().ContextSpecific(), func(spki *cryptobyte.Builder) {
+					spki.AddBytes(sequenceContents(publicKey))
+				})
+				template.AddASN1(cbbasn1.Tag(9).Constructed().ContextSpecific(), func(exts *cryptobyte.Builder) {
+					exts.AddBytes(sequenceContents(extensions))
+				})
+			})
+		})
+		certReq, err := builder.Bytes()
+		require.NoError(t, err)
+
+		signed := certReq
+		if !validPOP {
+			signed = []byte("something else")
+		}
+		popo, err := asn1.MarshalWithParams(cmpPOPOSigningKey{
+			Algorithm: ecdsaWithSHA256,
+			Signature: asn1.BitString{Bytes: sign(key, signed), BitLength: len(sign(key, signed)) * 8},
+		}, "tag:1")
+		require.NoError(t, err)
+
+		messages, err := asn1.Marshal([]cmpCertReqMsg{{CertReq: asn1.RawValue{FullBytes: certReq}, Popo: asn1.RawValue{FullBytes: popo}}})
+		require.NoError(t, err)
+		return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: bodyTag, IsCompound: true, Bytes: messages}
+	}
+
+	pbmParams := func() cmpPBMParameter {
+		return cmpPBMParameter{
+			Salt:           []byte("0123456789abcdef"),
+			OWF:            pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}},
+			IterationCount: 500,
+			MAC:            pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}},
+		}
+	}
+
+	// newMessage protects the body, with a MAC when a secret is given, or
+	// otherwise a signature by the given certificate.
+	newMessage := func(body asn1.RawValue, secret string, key *ecdsa.PrivateKey, cert *x509.Certificate, implicitConfirm bool) ([]byte, []byte) {
+		nonce := make([]byte, 16)
+		_, err := rand.Read(nonce)
+		require.NoError(t, err)
+
+		header := cmpPKIHeader{
+			PVNO:          2,
+			Sender:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: []byte{0x30, 0x00}},
+			Recipient:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: rootCert.RawSubject},
+			SenderKID:     []byte("device"),
+			TransactionID: []byte("transaction-1"),
+			SenderNonce:   nonce,
+		}
+		if implicitConfirm {
+			header.GeneralInfo = []cmpInfoTypeAndValue{{InfoType: oidCmpImplicitConfirm, InfoValue: asn1.NullRawValue}}
+		}
+		params := pbmParams()
+		if secret != "" {
+			paramBytes, err := asn1.Marshal(params)
+			require.NoError(t, err)
+			header.ProtectionAlg = pkix.AlgorithmIdentifier{Algorithm: oidCmpPasswordBasedMac, Parameters: asn1.RawValue{FullBytes: paramBytes}}
+		} else if cert != nil {
+			header.ProtectionAlg = ecdsaWithSHA256
+		}
+
+		headerBytes, err := asn1.Marshal(header)
+		require.NoError(t, err)
+		bodyBytes, err := asn1.Marshal(body)
+		require.NoError(t, err)
+
+		message := cmpPKIMessage{
+			Header: asn1.RawValue{FullBytes: headerBytes},
+			Body:   asn1.RawValue{FullBytes: bodyBytes},
+		}
+		protectedPart := cmpProtectedPart(headerBytes, bodyBytes)
+		var protection []byte
+		if secret != "" {
+			protection, err = cmpPasswordBasedMac(&params, []byte(secret), protectedPart)
+			require.NoError(t, err)
+		} else if cert != nil {
+			protection = sign(key, protectedPart)
+			message.ExtraCerts = []asn1.RawValue{{FullBytes: cert.Raw}}
+		}
+		if protection != nil {
+			message.Protection = asn1.BitString{Bytes: protection, BitLength: len(protection) * 8}
+		}
+
+		messageBytes, err := asn1.Marshal(message)
+		require.NoError(t, err)
+		return messageBytes, nonce
+	}
+
+	// parseReply verifies the response's protection, with a MAC when a
+	// secret is given or otherwise a signature by the root, and returns
+	// its header and body.
+	parseReply := func(resp *logical.Response, nonce []byte, secret string) (*cmpPKIHeader, asn1.RawValue) {
+		t.Helper()
+		require.Equal(t, http.StatusOK, resp.Data[logical.HTTPStatusCode], "body: %s", resp.Data[logical.HTTPRawBody])
+		require.Equal(t, cmpContentType, resp.Data[logical.HTTPContentType])
+
+		var message cmpPKIMessage
+		rest, err := asn1.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &message)
+		require.NoError(t, err)
+		require.Empty(t, rest)
+		var header cmpPKIHeader
+		_, err = asn1.Unmarshal(message.Header.FullBytes, &header)
+		require.NoError(t, err)
+		require.Equal(t, nonce, header.RecipNonce)
+		require.Equal(t, []byte("transaction-1"), header.TransactionID)
+
+		protectedPart := cmpProtectedPart(message.Header.FullBytes, message.Body.FullBytes)
+		if secret != "" {
+			require.True(t, header.ProtectionAlg.Algorithm.Equal(oidCmpPasswordBasedMac))
+			var params cmpPBMParameter
+			_, err = asn1.Unmarshal(header.ProtectionAlg.Parameters.FullBytes, &params)
+			require.NoError(t, err)
+			mac, err := cmpPasswordBasedMac(&params, []byte(secret), protectedPart)
+			require.NoError(t, err)
+			require.Equal(t, mac, message.Protection.RightAlign())
+		} else {
+			require.NoError(t, rootCert.CheckSignature(x509.ECDSAWithSHA256, protectedPart, message.Protection.RightAlign()))
+		}
+
+		return &header, message.Body
+	}
+	parseCertRep := func(body asn1.RawValue, tag int) *x509.Certificate {
+		t.Helper()
+		if body.Tag == cmpBodyError {
+			var errorMsg cmpErrorMsgContent
+			_, err := asn1.Unmarshal(body.Bytes, &errorMsg)
+			require.NoError(t, err)
+			t.Fatalf("unexpected error response: %s", errorMsg.PKIStatusInfo.StatusString[0].Bytes)
+		}
+		require.Equal(t, tag, body.Tag)
+
+		var rep cmpCertRepMessage
+		_, err := asn1.Unmarshal(body.Bytes, &rep)
+		require.NoError(t, err)
+		require.Len(t, rep.Response, 1)
+		require.Equal(t, cmpStatusAccepted, rep.Response[0].Status.Status)
+		cert, err := x509.ParseCertificate(rep.Response[0].CertifiedKeyPair.CertOrEncCert.Bytes)
+		require.NoError(t, err)
+		return cert
+	}
+	requireRejected := func(body asn1.RawValue, failInfo int) {
+		t.Helper()
+		require.Equal(t, cmpBodyError, body.Tag)
+		var errorMsg cmpErrorMsgContent
+		_, err := asn1.Unmarshal(body.Bytes, &errorMsg)
+		require.NoError(t, err)
+		require.Equal(t, cmpStatusRejection, errorMsg.PKIStatusInfo.Status)
+		require.Equal(t, 1, errorMsg.PKIStatusInfo.FailInfo.At(failInfo))
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	// CMP is disabled by default.
+	message, _ := newMessage(newCertReq(cmpBodyIR, key, "router1.devices.example.com", true), "shared-secret", nil, nil, false)
+	resp = cmpRequest("cmp", message)
+	require.Equal(t, http.StatusNotFound, resp.Data[logical.HTTPStatusCode])
+
+	resp, err = CBWrite(b, s, "config/cmp", map[string]interface{}{
+		"enabled":        true,
+		"label_to_role":  map[string]string{"routers": "devices"},
+		"shared_secrets": map[string]string{"devices": "shared-secret"},
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, []string{"devices"}, resp.Data["shared_secret_roles"])
+	require.Equal(t, true, resp.Data["enable_signature_protection"])
+
+	// Initial registration, protected with the shared secret.
+	message, nonce := newMessage(newCertReq(cmpBodyIR, key, "router1.devices.example.com", true), "shared-secret", nil, nil, false)
+	_, body := parseReply(cmpRequest("cmp/routers", message), nonce, "shared-secret")
+	issued := parseCertRep(body, cmpBodyIP)
+	require.Equal(t, "router1.devices.example.com", issued.Subject.CommonName)
+	require.Equal(t, []string{"router1.devices.example.com"}, issued.DNSNames)
+	require.NoError(t, issued.CheckSignatureFrom(rootCert))
+
+	// Confirming the certificate is acknowledged.
+	message, nonce = newMessage(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: cmpBodyCertConf, IsCompound: true, Bytes: []byte{0x30, 0x00}}, "shared-secret", nil, nil, false)
+	_, body = parseReply(cmpRequest("cmp/routers", message), nonce, "shared-secret")
+	require.Equal(t, cmpBodyPKIConf, body.Tag)
+
+	// Implicit confirmation is granted when requested.
+	message, nonce = newMessage(newCertReq(cmpBodyCR, key, "router1.devices.example.com", true), "shared-secret", nil, nil, true)
+	header, body := parseReply(cmpRequest("cmp/routers", message), nonce, "shared-secret")
+	parseCertRep(body, cmpBodyCP)
+	require.Len(t, header.GeneralInfo, 1)
+	require.True(t, header.GeneralInfo[0].InfoType.Equal(oidCmpImplicitConfirm))
+
+	// Requests with a wrong secret, no protection or no valid proof of
+	// possession are rejected.
+	message, nonce = newMessage(newCertReq(cmpBodyIR, key, "router1.devices.example.com", true), "wrong-secret", nil, nil, false)
+	resp = cmpRequest("cmp/routers", message)
+	_, body = parseReply(resp, nonce, "")
+	requireRejected(body, cmpFailBadMessageCheck)
+
+	message, nonce = newMessage(newCertReq(cmpBodyIR, key, "router1.devices.example.com", true), "", nil, nil, false)
+	_, body = parseReply(cmpRequest("cmp/routers", message), nonce, "")
+	requireRejected(body, cmpFailNotAuthorized)
+
+	message, nonce = newMessage(newCertReq(cmpBodyIR, key, "router1.devices.example.com", false), "shared-secret", nil, nil, false)
+	_, body = parseReply(cmpRequest("cmp/routers", message), nonce, "shared-secret")
+	requireRejected(body, cmpFailBadPOP)
+
+	// The role's restrictions still apply.
+	message, nonce = newMessage(newCertReq(cmpBodyIR, key, "router1.example.org", true), "shared-secret", nil, nil, false)
+	_, body = parseReply(cmpRequest("cmp/routers", message), nonce, "shared-secret")
+	requireRejected(body, cmpFailBadRequest)
+
+	// Key updates must be signed with the certificate being updated, and
+	// keep its identity.
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	message, nonce = newMessage(newCertReq(cmpBodyKUR, newKey, "router1.devices.example.com", true), "shared-secret", nil, nil, false)
+	_, body = parseReply(cmpRequest("cmp/routers", message), nonce, "shared-secret")
+	requireRejected(body, cmpFailNotAuthorized)
+
+	message, nonce = newMessage(newCertReq(cmpBodyKUR, newKey, "router2.devices.example.com", true), "", key, issued, false)
+	_, body = parseReply(cmpRequest("cmp/routers", message), nonce, "")
+	requireRejected(body, cmpFailBadCertTemplate)
+
+	message, nonce = newMessage(newCertReq(cmpBodyKUR, newKey, "router1.devices.example.com", true), "", key, issued, false)
+	_, body = parseReply(cmpRequest("cmp/routers", message), nonce, "")
+	updated := parseCertRep(body, cmpBodyKUP)
+	require.NotEqual(t, issued.SerialNumber, updated.SerialNumber)
+	require.True(t, newKey.PublicKey.Equal(updated.PublicKey))
+
+	// Certificates protecting initial and certification requests are bound
+	// to their identity too.
+	for _, tag := range []int{cmpBodyIR, cmpBodyCR} {
+		message, nonce = newMessage(newCertReq(tag, newKey, "router2.devices.example.com", true), "", key, issued, false)
+		_, body = parseReply(cmpRequest("cmp/routers", message), nonce, "")
+		requireRejected(body, cmpFailBadCertTemplate)
+
+		message, nonce = newMessage(newCertReq(tag, newKey, "router1.devices.example.com", true), "", key, issued, false)
+		_, body = parseReply(cmpRequest("cmp/routers", message), nonce, "")
+		require.Equal(t, "router1.devices.example.com", parseCertRep(body, tag+1).Subject.CommonName)
+	}
+
+	// Revoked certificates can't protect requests.
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": serialFromCert(issued),
+	})
+	require.NoError(t, err)
+	message, nonce = newMessage(newCertReq(cmpBodyKUR, newKey, "router1.devices.example.com", true), "", key, issued, false)
+	_, body = parseReply(cmpRequest("cmp/routers", message), nonce, "")
+	requireRejected(body, cmpFailSignerNotTrusted)
+}
+
+func TestCustomExtensions(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	// Extensions Vault sets itself can't be allowed.
+	_, err = CBWrite(b, s, "roles/vendor", map[string]interface{}{
+		"allowed_domains":        "example.com",
+		"allow_subdomains":       true,
+		"allowed_extension_oids": "2.5.29.17",
+	})
+	require.Error(t, err)
+	_, err = CBWrite(b, s, "roles/vendor", map[string]interface{}{
+		"allowed_domains":        "example.com",
+		"allow_subdomains":       true,
+		"allowed_extension_oids": "not-an-oid",
+	})
+	require.Error(t, err)
+
+	_, err = CBWrite(b, s, "roles/vendor", map[string]interface{}{
+		"allowed_domains":        "example.com",
+		"allow_subdomains":       true,
+		"allowed_extension_oids": "1.3.6.1.4.1.311.20.2,1.3.6.1.4.1.99999.1",
+		"key_type":               "ec",
+	})
+	require.NoError(t, err)
+	resp, err = CBRead(b, s, "roles/vendor")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, []string{"1.3.6.1.4.1.311.20.2", "1.3.6.1.4.1.99999.1"}, resp.Data["allowed_extension_oids"])
+
+	templateName, err := asn1.Marshal("Machine")
+	require.NoError(t, err)
+	vendorValue, err := asn1.Marshal(42)
+	require.NoError(t, err)
+	templateExt := "1.3.6.1.4.1.311.20.2:" + base64.StdEncoding.EncodeToString(templateName)
+	vendorExt := "1.3.6.1.4.1.99999.1;critical:" + base64.StdEncoding.EncodeToString(vendorValue)
+
+	extensionsOf := func(cert *x509.Certificate) map[string]pkix.Extension {
+		exts := make(map[string]pkix.Extension, len(cert.Extensions))
+		for _, ext := range cert.Extensions {
+			exts[ext.Id.String()] = ext
+		}
+		return exts
+	}
+
+	// Issuing adds the requested extensions to the leaf.
+	resp, err = CBWrite(b, s, "issue/vendor", map[string]interface{}{
+		"common_name":       "host.example.com",
+		"custom_extensions": templateExt + "," + vendorExt,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	exts := extensionsOf(parseCert(t, resp.Data["certificate"].(string)))
+	require.Equal(t, templateName, exts["1.3.6.1.4.1.311.20.2"].Value)
+	require.False(t, exts["1.3.6.1.4.1.311.20.2"].Critical)
+	require.Equal(t, vendorValue, exts["1.3.6.1.4.1.99999.1"].Value)
+	require.True(t, exts["1.3.6.1.4.1.99999.1"].Critical)
+
+	// So does signing.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "host.example.com"}}, key)
+	require.NoError(t, err)
+	resp, err = CBWrite(b, s, "sign/vendor", map[string]interface{}{
+		"csr":               string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+		"custom_extensions": []string{templateExt},
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	exts = extensionsOf(parseCert(t, resp.Data["certificate"].(string)))
+	require.Equal(t, templateName, exts["1.3.6.1.4.1.311.20.2"].Value)
+
+	// Extensions the role doesn't allow, reserved extensions and malformed
+	// values are rejected.
+	for _, ext := range []string{
+		"1.3.6.1.4.1.99999.2:" + base64.StdEncoding.EncodeToString(vendorValue),
+		"2.5.29.19;critical:" + base64.StdEncoding.EncodeToString([]byte{0x30, 0x03, 0x01, 0x01, 0xff}),
+		"1.3.6.1.4.1.99999.1:not base64!",
+		"1.3.6.1.4.1.99999.1:" + base64.StdEncoding.EncodeToString([]byte{0x04, 0x05, 0x00}),
+		"1.3.6.1.4.1.99999.1;optional:" + base64.StdEncoding.EncodeToString(vendorValue),
+		vendorExt + "," + vendorExt,
+	} {
+		resp, err = CBWrite(b, s, "issue/vendor", map[string]interface{}{
+			"common_name":       "host.example.com",
+			"custom_extensions": ext,
+		})
+		require.Error(t, err, "extension: %s", ext)
+	}
+
+	// Denied OIDs take precedence over allowing any OID.
+	_, err = CBWrite(b, s, "roles/vendor", map[string]interface{}{
+		"allowed_domains":        "example.com",
+		"allow_subdomains":       true,
+		"allowed_extension_oids": "*",
+		"denied_extension_oids":  "1.3.6.1.4.1.99999.1",
+	})
+	require.NoError(t, err)
+	resp, err = CBWrite(b, s, "issue/vendor", map[string]interface{}{
+		"common_name":       "host.example.com",
+		"custom_extensions": "1.3.6.1.4.1.99999.2:" + base64.StdEncoding.EncodeToString(vendorValue),
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	_, err = CBWrite(b, s, "issue/vendor", map[string]interface{}{
+		"common_name":       "host.example.com",
+		"custom_extensions": vendorExt,
+	})
+	require.Error(t, err)
+	_, err = CBWrite(b, s, "issue/vendor", map[string]interface{}{
+		"common_name":       "host.example.com",
+		"custom_extensions": "2.5.29.17:" + base64.StdEncoding.EncodeToString(templateName),
+	})
+	require.Error(t, err)
+}
+
+func TestIssuancePolicy(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	// Policies must compile, and evaluate to a bool or a string.
+	for _, policy := range []string{"cert.common_name ==", "1 + 1", "unknown_variable"} {
+		_, err = CBWrite(b, s, "roles/web", map[string]interface{}{
+			"allowed_domains":  "example.com",
+			"allow_subdomains": true,
+			"issuance_policy":  policy,
+		})
+		require.Error(t, err, "policy: %s", policy)
+
+		resp, err = CBWrite(b, s, "config/mount", map[string]interface{}{
+			"issuance_policy": policy,
+		})
+		require.Error(t, err, "policy: %s", policy)
+	}
+
+	_, err = CBWrite(b, s, "roles/web", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"key_type":         "ec",
+		"max_ttl":          "24h",
+		"issuance_policy": `cert.dns_names.all(name, name.startsWith("web-")) ? ` +
+			`(ttl <= duration("12h") ? "" : "web certificates may be valid for at most 12h") : ` +
+			`"web certificates must be named web-*"`,
+	})
+	require.NoError(t, err)
+	resp, err = CBRead(b, s, "roles/web")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Contains(t, resp.Data["issuance_policy"], "web-")
+
+	resp, err = CBWrite(b, s, "issue/web", map[string]interface{}{
+		"common_name": "web-1.example.com",
+		"ttl":         "1h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	_, err = CBWrite(b, s, "issue/web", map[string]interface{}{
+		"common_name": "db-1.example.com",
+		"ttl":         "1h",
+	})
+	require.ErrorContains(t, err, "issuance denied by the role's issuance policy: web certificates must be named web-*")
+
+	_, err = CBWrite(b, s, "issue/web", map[string]interface{}{
+		"common_name": "web-1.example.com",
+		"ttl":         "20h",
+	})
+	require.ErrorContains(t, err, "web certificates may be valid for at most 12h")
+
+	// The CSR is available when signing.
+	_, err = CBWrite(b, s, "roles/web", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"key_type":         "any",
+		"issuance_policy":  `csr.key_type == "ec" && csr.key_bits >= 384`,
+	})
+	require.NoError(t, err)
+	newCSR := func(curve elliptic.Curve) string {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		require.NoError(t, err)
+		csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "web-2.example.com"}}, key)
+		require.NoError(t, err)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}))
+	}
+	resp, err = CBWrite(b, s, "sign/web", map[string]interface{}{
+		"csr": newCSR(elliptic.P384()),
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	_, err = CBWrite(b, s, "sign/web", map[string]interface{}{
+		"csr": newCSR(elliptic.P256()),
+	})
+	require.ErrorContains(t, err, "issuance denied by the role's issuance policy: the request does not satisfy it")
+
+	// The mount's policy applies in addition to the role's, but not to CAs.
+	resp, err = CBWrite(b, s, "config/mount", map[string]interface{}{
+		"issuance_policy": `!cert.common_name.endsWith(".internal.example.com")`,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, `!cert.common_name.endsWith(".internal.example.com")`, resp.Data["issuance_policy"])
+
+	_, err = CBWrite(b, s, "roles/web", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+	})
+	require.NoError(t, err)
+	resp, err = CBWrite(b, s, "issue/web", map[string]interface{}{
+		"common_name": "web.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	_, err = CBWrite(b, s, "issue/web", map[string]interface{}{
+		"common_name": "db.internal.example.com",
+	})
+	require.ErrorContains(t, err, "issuance denied by the mount's issuance policy")
+
+	resp, err = CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root.internal.example.com",
+		"issuer_name": "internal",
+		"key_type":    "ec",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	// Evaluation is bounded: expensive policies fail rather than running
+	// for as long as they take.
+	_, err = CBWrite(b, s, "roles/web", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"issuance_policy":  `cert.dns_names.all(x, cert.dns_names.all(y, cert.dns_names.all(z, x + y + z != "")))`,
+	})
+	require.NoError(t, err)
+	var altNames []string
+	for i := 0; i < 200; i++ {
+		altNames = append(altNames, fmt.Sprintf("web-%d.example.com", i))
+	}
+	_, err = CBWrite(b, s, "issue/web", map[string]interface{}{
+		"common_name": "web.example.com",
+		"alt_names":   strings.Join(altNames, ","),
+	})
+	require.ErrorContains(t, err, "the role's issuance policy could not be evaluated")
+	require.ErrorContains(t, err, "cost limit exceeded")
+}
+
+func TestNameConstraints(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	_, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name":         "root example.com",
+		"key_type":            "ec",
+		"permitted_ip_ranges": "not-a-cidr",
+	})
+	require.ErrorContains(t, err, "invalid permitted_ip_ranges")
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name":               "root example.com",
+		"key_type":                  "ec",
+		"ttl":                       "72h",
+		"permitted_dns_domains":     "example.com",
+		"excluded_dns_domains":      "secret.example.com",
+		"permitted_ip_ranges":       "10.0.0.0/8,fd00::/8",
+		"excluded_ip_ranges":        "10.255.0.0/16",
+		"permitted_email_addresses": "example.com",
+		"excluded_email_addresses":  "admin@example.com",
+		"permitted_uri_domains":     ".example.com",
+		"excluded_uri_domains":      "secret.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	root := parseCert(t, resp.Data["certificate"].(string))
+	require.True(t, root.PermittedDNSDomainsCritical)
+	require.Equal(t, []string{"example.com"}, root.PermittedDNSDomains)
+	require.Equal(t, []string{"secret.example.com"}, root.ExcludedDNSDomains)
+	require.Len(t, root.PermittedIPRanges, 2)
+	require.Equal(t, "10.0.0.0/8", root.PermittedIPRanges[0].String())
+	require.Equal(t, "fd00::/8", root.PermittedIPRanges[1].String())
+	require.Equal(t, "10.255.0.0/16", root.ExcludedIPRanges[0].String())
+	require.Equal(t, []string{"example.com"}, root.PermittedEmailAddresses)
+	require.Equal(t, []string{"admin@example.com"}, root.ExcludedEmailAddresses)
+	require.Equal(t, []string{".example.com"}, root.PermittedURIDomains)
+	require.Equal(t, []string{"secret.example.com"}, root.ExcludedURIDomains)
+
+	// Intermediates can be further constrained, and the extension left
+	// non-critical when requested.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "int example.com"}}, key)
+	require.NoError(t, err)
+	resp, err = CBWrite(b, s, "root/sign-intermediate", map[string]interface{}{
+		"csr":                       string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+		"common_name":               "int example.com",
+		"ttl":                       "48h",
+		"permitted_dns_domains":     "apps.example.com",
+		"excluded_ip_ranges":        "10.1.0.0/16",
+		"name_constraints_critical": false,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	intermediate := parseCert(t, resp.Data["certificate"].(string))
+	require.False(t, intermediate.PermittedDNSDomainsCritical)
+	require.Equal(t, []string{"apps.example.com"}, intermediate.PermittedDNSDomains)
+	require.Equal(t, "10.1.0.0/16", intermediate.ExcludedIPRanges[0].String())
+	require.Empty(t, intermediate.ExcludedDNSDomains)
+
+	// Leaves outside of the constraints don't verify.
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(intermediate)
+	for name, valid := range map[string]bool{
+		"web.apps.example.com": true,
+		"web.example.com":      false,
+		"web.example.org":      false,
+	} {
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: name},
+			DNSNames:     []string{name},
+			NotBefore:    time.Now().Add(-time.Minute),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, intermediate, key.Public(), key)
+		require.NoError(t, err)
+		leaf, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+
+		_, err = leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+		if valid {
+			require.NoError(t, err, "name: %s", name)
+		} else {
+			require.Error(t, err, "name: %s", name)
+		}
+	}
+}
+
+func TestCrossSignWorkflow(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root a",
+		"issuer_name": "root-a",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rootAID := resp.Data["issuer_id"].(issuerID)
+	rootAKeyID := resp.Data["key_id"].(keyID)
+	rootA := parseCert(t, resp.Data["certificate"].(string))
+
+	resp, err = CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root b",
+		"issuer_name": "root-b",
+		"key_type":    "rsa",
+		"ttl":         "96h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rootBPem := resp.Data["certificate"].(string)
+
+	// The CSR carries root A's subject and is signed by its key.
+	resp, err = CBWrite(b, s, "issuer/root-a/cross-sign/csr", map[string]interface{}{})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, rootAID, resp.Data["issuer_id"])
+	require.Equal(t, rootAKeyID, resp.Data["key_id"])
+	block, _ := pem.Decode([]byte(resp.Data["csr"].(string)))
+	require.NotNil(t, block)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	require.NoError(t, err)
+	require.NoError(t, csr.CheckSignature())
+	require.Equal(t, rootA.RawSubject, csr.RawSubject)
+
+	resp, err = CBWrite(b, s, "issuer/root-b/sign-intermediate", map[string]interface{}{
+		"csr":            resp.Data["csr"],
+		"use_csr_values": true,
+		"ttl":            "48h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	crossSignedPem := resp.Data["certificate"].(string)
+
+	// Certificates other than a cross-signed copy of root A are rejected.
+	_, err = CBWrite(b, s, "issuer/root-a/cross-sign/import", map[string]interface{}{
+		"certificate": rootBPem,
+	})
+	require.ErrorContains(t, err, "does not match")
+	_, err = CBWrite(b, s, "issuer/root-a/cross-sign/import", map[string]interface{}{
+		"certificate": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootA.Raw})),
+	})
+	require.ErrorContains(t, err, "not a cross-signed certificate")
+
+	// The chain given must include the cross-signing CA; nothing is
+	// imported otherwise.
+	_, err = CBWrite(b, s, "issuer/root-a/cross-sign/import", map[string]interface{}{
+		"certificate": crossSignedPem + "\n" + string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootA.Raw})),
+	})
+	require.ErrorContains(t, err, "was not signed by any of the provided chain certificates")
+	resp, err = CBList(b, s, "issuers")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Len(t, resp.Data["keys"], 2)
+
+	resp, err = CBWrite(b, s, "issuer/root-a/cross-sign/import", map[string]interface{}{
+		"certificate": crossSignedPem + "\n" + rootBPem,
+		"issuer_name": "root-a-cross",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, rootAID, resp.Data["cross_signed_from"])
+	require.Equal(t, rootAKeyID, resp.Data["key_id"])
+	require.Equal(t, "root-a-cross", resp.Data["issuer_name"])
+	require.Len(t, resp.Data["imported_issuers"], 1)
+
+	// The cross-signed variant chains to root B, the self-signed variant
+	// lists it as a sibling, and both share their CRL.
+	resp, err = CBRead(b, s, "issuer/root-a-cross")
+	requireSuccessNonNilResponse(t, resp, err)
+	crossChain := strings.Join(resp.Data["ca_chain"].([]string), "\n")
+	require.Contains(t, crossChain, strings.TrimSpace(rootBPem))
+
+	resp, err = CBRead(b, s, "issuer/root-a")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Contains(t, strings.Join(resp.Data["ca_chain"].([]string), "\n"), strings.TrimSpace(crossSignedPem))
+
+	resp, err = CBRead(b, s, "issuer/root-a/crl")
+	requireSuccessNonNilResponse(t, resp, err)
+	rootACRL := resp.Data["crl"]
+	resp, err = CBRead(b, s, "issuer/root-a-cross/crl")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, rootACRL, resp.Data["crl"])
+}
+
+func TestIssuerPKCS12(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"issuer_name": "root",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	root := parseCert(t, resp.Data["certificate"].(string))
+
+	resp, err = CBWrite(b, s, "intermediate/generate/internal", map[string]interface{}{
+		"common_name": "int example.com",
+		"key_type":    "rsa",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	resp, err = CBWrite(b, s, "issuer/root/sign-intermediate", map[string]interface{}{
+		"csr":         resp.Data["csr"],
+		"common_name": "int example.com",
+		"ttl":         "48h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	resp, err = CBWrite(b, s, "intermediate/set-signed", map[string]interface{}{
+		"certificate": resp.Data["certificate"],
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	intID := resp.Data["imported_issuers"].([]string)[0]
+	_, err = CBWrite(b, s, "issuer/"+intID, map[string]interface{}{
+		"issuer_name": "int",
+	})
+	require.NoError(t, err)
+
+	// Keys must be marked exportable first, which can't be undone.
+	_, err = CBWrite(b, s, "pkcs12/export/int", map[string]interface{}{
+		"password": "hunter2",
+	})
+	require.ErrorContains(t, err, "is not exportable")
+	for _, ref := range []string{"int", "root"} {
+		resp, err = CBRead(b, s, "issuer/"+ref)
+		requireSuccessNonNilResponse(t, resp, err)
+		keyID := string(resp.Data["key_id"].(keyID))
+		resp, err = CBWrite(b, s, "key/"+keyID, map[string]interface{}{
+			"exportable": true,
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		require.Empty(t, resp.Warnings)
+		require.Equal(t, true, resp.Data["exportable"])
+		_, err = CBWrite(b, s, "key/"+keyID, map[string]interface{}{
+			"exportable": false,
+		})
+		require.ErrorContains(t, err, "can't be made non-exportable")
+	}
+
+	_, err = CBWrite(b, s, "pkcs12/export/int", map[string]interface{}{})
+	require.ErrorContains(t, err, "missing password")
+	_, err = CBWrite(b, s, "pkcs12/export/int", map[string]interface{}{
+		"password":   "hunter2",
+		"encryption": "none",
+	})
+	require.ErrorContains(t, err, "unknown encryption")
+	resp, err = CBWrite(b, s, "pkcs12/export/missing", map[string]interface{}{
+		"password": "hunter2",
+	})
+	require.ErrorContains(t, err, "unable to resolve issuer id for reference: missing")
+	require.True(t, resp.IsError())
+
+	for _, encryption := range []string{"aes256", "des3", "rc2"} {
+		resp, err = CBWrite(b, s, "pkcs12/export/int", map[string]interface{}{
+			"password":   "hunter2",
+			"encryption": encryption,
+		})
+		requireSuccessNonNilResponse(t, resp, err, encryption)
+		pfxData, err := base64.StdEncoding.DecodeString(resp.Data["pkcs12"].(string))
+		require.NoError(t, err)
+
+		key, cert, caCerts, err := pkcs12.DecodeChain(pfxData, "hunter2")
+		require.NoError(t, err, encryption)
+		require.Equal(t, "int example.com", cert.Subject.CommonName)
+		require.Len(t, caCerts, 1)
+		require.Equal(t, root.Raw, caCerts[0].Raw)
+		equal, err := certutil.ComparePublicKeys(cert.PublicKey, key.(crypto.Signer).Public())
+		require.NoError(t, err)
+		require.True(t, equal)
+	}
+
+	resp, err = CBWrite(b, s, "pkcs12/export/root", map[string]interface{}{
+		"password":      "hunter2",
+		"include_chain": false,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rootPKCS12 := resp.Data["pkcs12"].(string)
+
+	// The bundle can be imported into another mount, along with its key,
+	// but only with the right password and through the bundle endpoint.
+	b2, s2 := createBackendWithStorage(t)
+	_, err = CBWrite(b2, s2, "issuers/import/bundle", map[string]interface{}{
+		"pkcs12_bundle":   rootPKCS12,
+		"pkcs12_password": "wrong",
+	})
+	require.ErrorContains(t, err, "password incorrect")
+	_, err = CBWrite(b2, s2, "issuers/import/cert", map[string]interface{}{
+		"pkcs12_bundle":   rootPKCS12,
+		"pkcs12_password": "hunter2",
+	})
+	require.ErrorContains(t, err, "private keys found")
+
+	resp, err = CBWrite(b2, s2, "issuers/import/bundle", map[string]interface{}{
+		"pkcs12_bundle":   rootPKCS12,
+		"pkcs12_password": "hunter2",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Len(t, resp.Data["imported_issuers"], 1)
+	require.Len(t, resp.Data["imported_keys"], 1)
+
+	resp, err = CBRead(b2, s2, "issuer/default")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, root.Raw, parseCert(t, resp.Data["certificate"].(string)).Raw)
+	require.NotEmpty(t, resp.Data["key_id"])
+}
+
+func TestKeyTypes(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBRead(b, s, "key-types")
+	requireSuccessNonNilResponse(t, resp, err)
+	keyTypes := resp.Data["key_types"].(map[string]interface{})
+	rsaInfo := keyTypes["rsa"].(map[string]interface{})
+	require.True(t, rsaInfo["available"].(bool))
+	require.Equal(t, 2048, rsaInfo["default_key_bits"])
+	require.Contains(t, rsaInfo["signature_algorithms"], "sha256withrsapss")
+	require.False(t, keyTypes["ed448"].(map[string]interface{})["available"].(bool))
+	require.Contains(t, keyTypes, "mldsa65-ecdsa-p256")
+	sigAlgs := resp.Data["signature_algorithms"].(map[string]interface{})
+	require.True(t, sigAlgs["pureed25519"].(map[string]interface{})["available"].(bool))
+	require.False(t, sigAlgs["pureed448"].(map[string]interface{})["available"].(bool))
+
+	// Known but unavailable key types and algorithms are rejected as such,
+	// rather than as unknown.
+	_, err = CBWrite(b, s, "roles/ed448", map[string]interface{}{
+		"key_type": "ed448",
+	})
+	require.ErrorContains(t, err, "not supported by this build of Vault")
+	_, err = CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "mldsa65-ecdsa-p256",
+	})
+	require.ErrorContains(t, err, "not supported by this build of Vault")
+	_, err = CBWrite(b, s, "keys/generate/internal", map[string]interface{}{
+		"key_type": "ed448",
+	})
+	require.ErrorContains(t, err, "not supported by this build of Vault")
+
+	resp, err = CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ed25519",
+		"issuer_name": "root",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	_, err = CBPatch(b, s, "issuer/root", map[string]interface{}{
+		"revocation_signature_algorithm": "pureed448",
+	})
+	require.ErrorContains(t, err, "not supported by this build of Vault")
+	_, err = CBWrite(b, s, "issuer/root", map[string]interface{}{
+		"revocation_signature_algorithm": "pureed448",
+	})
+	require.ErrorContains(t, err, "not supported by this build of Vault")
+	_, err = CBWrite(b, s, "issuer/root", map[string]interface{}{
+		"revocation_signature_algorithm": "ed25519",
+	})
+	require.NoError(t, err)
+}
+
+func TestCertSearch(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "48h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rootSerial := resp.Data["serial_number"].(string)
+
+	for _, role := range []string{"web", "api"} {
+		_, err = CBWrite(b, s, "roles/"+role, map[string]interface{}{
+			"allowed_domains":  "example.com",
+			"allow_subdomains": true,
+			"max_ttl":          "720h",
+		})
+		require.NoError(t, err)
+	}
+
+	issue := func(role string, data map[string]interface{}) string {
+		resp, err := CBWrite(b, s, "issue/"+role, data)
+		requireSuccessNonNilResponse(t, resp, err)
+		return resp.Data["serial_number"].(string)
+	}
+	webShort := issue("web", map[string]interface{}{
+		"common_name": "www.example.com",
+		"alt_names":   "static.example.com",
+		"ttl":         "1h",
+	})
+	webLong := issue("web", map[string]interface{}{
+		"common_name": "WWW.example.com",
+		"ttl":         "36h",
+	})
+	apiLong := issue("api", map[string]interface{}{
+		"common_name": "api.example.com",
+		"alt_names":   "www.example.com",
+		"ttl":         "36h",
+	})
+
+	search := func(data map[string]interface{}) []string {
+		resp, err := CBReq(b, s, logical.ListOperation, "certs/search", data)
+		requireSuccessNonNilResponse(t, resp, err)
+		if resp.Data["keys"] == nil {
+			return nil
+		}
+		return resp.Data["keys"].([]string)
+	}
+
+	// Names are matched case-insensitively, and results are ordered by
+	// expiry.
+	require.Equal(t, []string{webShort, webLong}, search(map[string]interface{}{"common_name": "www.example.com"}))
+	require.Equal(t, []string{webLong}, search(map[string]interface{}{"common_name": "www.example.com", "expires_after": time.Now().Add(12 * time.Hour).Format(time.RFC3339)}))
+	// The common name is also included as a SAN.
+	require.ElementsMatch(t, []string{webShort, webLong, apiLong}, search(map[string]interface{}{"san": "WWW.EXAMPLE.COM"}))
+	require.Equal(t, []string{webShort}, search(map[string]interface{}{"san": "static.example.com"}))
+	require.Equal(t, []string{apiLong}, search(map[string]interface{}{"san": "www.example.com", "role": "api"}))
+	require.Equal(t, []string{webShort}, search(map[string]interface{}{"common_name": "www.example.com", "limit": 1}))
+	require.Equal(t, []string{webShort}, search(map[string]interface{}{"expires_before": time.Now().Add(2 * time.Hour).Format(time.RFC3339)}))
+	require.ElementsMatch(t, []string{webLong, apiLong}, search(map[string]interface{}{
+		"expires_after":  time.Now().Add(12 * time.Hour).Format(time.RFC3339),
+		"expires_before": time.Now().Add(40 * time.Hour).Format(time.RFC3339),
+	}))
+	require.Equal(t, []string{apiLong}, search(map[string]interface{}{"serial_prefix": apiLong[:len(apiLong)-3]}))
+	require.Equal(t, []string{apiLong}, search(map[string]interface{}{"serial_prefix": strings.ReplaceAll(apiLong, ":", "-")}))
+	require.Empty(t, search(map[string]interface{}{"common_name": "missing.example.com"}))
+
+	resp, err = CBReq(b, s, logical.ListOperation, "certs/search", map[string]interface{}{"serial_prefix": apiLong})
+	requireSuccessNonNilResponse(t, resp, err)
+	info := resp.Data["key_info"].(map[string]interface{})[apiLong].(map[string]interface{})
+	require.Equal(t, "api", info["role"])
+	require.Equal(t, "api.example.com", info["common_name"])
+	require.Equal(t, []string{"api.example.com", "www.example.com"}, info["dns_names"])
+	require.NotEmpty(t, info["issuer_id"])
+
+	_, err = CBReq(b, s, logical.ListOperation, "certs/search", map[string]interface{}{"role": "web"})
+	require.ErrorContains(t, err, "at least one of")
+	_, err = CBReq(b, s, logical.ListOperation, "certs/search", map[string]interface{}{"expires_after": "tomorrow"})
+	require.ErrorContains(t, err, "could not be decoded")
+
+	// Certificates stored before the metadata store existed are summarized
+	// by the periodic function, without their role.
+	ctx := context.Background()
+	sc := b.makeStorageContext(ctx, s)
+	require.NoError(t, sc.deleteCertMetadata(rootSerial))
+	require.NoError(t, sc.deleteCertMetadata(webLong))
+	require.Equal(t, []string{webShort}, search(map[string]interface{}{"common_name": "www.example.com"}))
+	require.Empty(t, search(map[string]interface{}{"common_name": "root example.com"}))
+	require.NoError(t, s.Delete(ctx, certMetadataReadyPath))
+	b.certMetadataReady.Store(false)
+	resp, err = CBReq(b, s, logical.ListOperation, "certs/search", map[string]interface{}{"common_name": "www.example.com"})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.NotEmpty(t, resp.Warnings)
+
+	require.NoError(t, b.buildCertMetadataIfRequired(ctx, s))
+	require.Equal(t, []string{webShort, webLong}, search(map[string]interface{}{"common_name": "www.example.com"}))
+	require.Equal(t, []string{rootSerial}, search(map[string]interface{}{"common_name": "root example.com"}))
+	require.Equal(t, []string{webShort}, search(map[string]interface{}{"common_name": "www.example.com", "role": "web"}))
+}
+
+func TestCertsByName(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "48h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rootId := string(resp.Data["issuer_id"].(issuerID))
+
+	_, err = CBWrite(b, s, "roles/web", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"max_ttl":          "720h",
+	})
+	require.NoError(t, err)
+
+	issue := func(data map[string]interface{}) string {
+		resp, err := CBWrite(b, s, "issue/web", data)
+		requireSuccessNonNilResponse(t, resp, err)
+		return resp.Data["serial_number"].(string)
+	}
+	short := issue(map[string]interface{}{
+		"common_name": "www.example.com",
+		"ip_sans":     "10.0.0.1",
+		"ttl":         "1h",
+	})
+	long := issue(map[string]interface{}{
+		"common_name": "api.example.com",
+		"alt_names":   "www.example.com",
+		"ttl":         "36h",
+	})
+	upper := issue(map[string]interface{}{
+		"common_name": "WWW.example.com",
+		"ttl":         "12h",
+	})
+
+	lookup := func(path string) *logical.Response {
+		resp, err := CBRead(b, s, path)
+		requireSuccessNonNilResponse(t, resp, err)
+		return resp
+	}
+
+	// Common names are told apart from SANs, names are matched
+	// case-insensitively, and results are ordered by expiry.
+	resp = lookup("certs/by-cn/www.example.com")
+	require.Equal(t, []string{short, upper}, resp.Data["keys"])
+	info := resp.Data["key_info"].(map[string]interface{})[short].(map[string]interface{})
+	require.Equal(t, "web", info["role"])
+	require.Equal(t, rootId, string(info["issuer_id"].(issuerID)))
+	require.Equal(t, "www.example.com", info["common_name"])
+	require.NotEmpty(t, info["not_after"])
+
+	resp = lookup("certs/by-san/WWW.EXAMPLE.COM")
+	require.Equal(t, []string{short, upper, long}, resp.Data["keys"])
+
+	require.Equal(t, []string{long}, lookup("certs/by-cn/api.example.com").Data["keys"])
+	require.Equal(t, []string{short}, lookup("certs/by-san/10.0.0.1").Data["keys"])
+	require.Empty(t, lookup("certs/by-cn/10.0.0.1").Data["keys"])
+	require.Empty(t, lookup("certs/by-san/missing.example.com").Data["keys"])
+
+	_, err = CBRead(b, s, "certs/by-san/")
+	require.ErrorContains(t, err, "must be given")
+}
+
+func TestSignRequestApproval(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"issuer_name": "root",
+		"ttl":         "48h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	_, err = CBWrite(b, s, "roles/high-value", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"key_type":         "ec",
+		"require_approval": true,
+		"approval_ttl":     "1h",
+		"ttl":              "1h",
+	})
+	require.NoError(t, err)
+	resp, err = CBRead(b, s, "roles/high-value")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, true, resp.Data["require_approval"])
+	require.Equal(t, int64(3600), resp.Data["approval_ttl"])
+
+	_, err = CBWrite(b, s, "issue/high-value", map[string]interface{}{
+		"common_name": "pay.example.com",
+	})
+	require.ErrorContains(t, err, "requires approval")
+
+	// Requests are submitted by one entity...
+	submit := func(commonName string) string {
+		_, _, csrPem := generateCSR(t, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: commonName},
+		}, "ec", 256)
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation:   logical.UpdateOperation,
+			Path:        "issuer/root/sign/high-value",
+			Data:        map[string]interface{}{"csr": csrPem, "common_name": commonName},
+			Storage:     s,
+			MountPoint:  "pki/",
+			EntityID:    "requester-entity",
+			DisplayName: "requester",
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		require.Equal(t, "pending", resp.Data["status"])
+		require.NotContains(t, resp.Data, "certificate")
+		return resp.Data["request_id"].(string)
+	}
+	approved := submit("pay.example.com")
+	denied := submit("ledger.example.com")
+	stale := submit("old.example.com")
+
+	resp, err = CBList(b, s, "sign-requests")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.ElementsMatch(t, []string{approved, denied, stale}, resp.Data["keys"])
+	require.Equal(t, "pay.example.com", resp.Data["key_info"].(map[string]interface{})[approved].(map[string]interface{})["common_name"])
+
+	// ...and can't be approved by it.
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "sign-request/" + approved + "/approve",
+		Storage:    s,
+		MountPoint: "pki/",
+		EntityID:   "requester-entity",
+	})
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+	require.Contains(t, resp.Error().Error(), "by their requester")
+
+	resp, err = CBWrite(b, s, "sign-request/"+approved+"/approve", nil)
+	requireSuccessNonNilResponse(t, resp, err)
+	cert := parseCert(t, resp.Data["certificate"].(string))
+	require.Equal(t, "pay.example.com", cert.Subject.CommonName)
+
+	// The requester collects the certificate once approved; the request
+	// was signed by the issuer it named, and recorded against them.
+	resp, err = CBRead(b, s, "sign-request/"+approved)
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, "approved", resp.Data["status"])
+	require.Equal(t, cert.Raw, parseCert(t, resp.Data["certificate"].(string)).Raw)
+	resp, err = CBReq(b, s, logical.ListOperation, "certs/search", map[string]interface{}{"common_name": "pay.example.com"})
+	requireSuccessNonNilResponse(t, resp, err)
+	info := resp.Data["key_info"].(map[string]interface{})[serialFromCert(cert)].(map[string]interface{})
+	require.Equal(t, "requester-entity", info["requester_entity_id"])
+	require.Equal(t, "high-value", info["role"])
+
+	_, err = CBWrite(b, s, "sign-request/"+approved+"/approve", nil)
+	require.ErrorContains(t, err, "already approved")
+
+	resp, err = CBWrite(b, s, "sign-request/"+denied+"/deny", map[string]interface{}{
+		"reason": "not a production service",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, "denied", resp.Data["status"])
+	_, err = CBWrite(b, s, "sign-request/"+denied+"/approve", nil)
+	require.ErrorContains(t, err, "already denied")
+	resp, err = CBRead(b, s, "sign-request/"+denied)
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, "not a production service", resp.Data["denial_reason"])
+	require.NotContains(t, resp.Data, "certificate")
+
+	// Requests left undecided past the role's approval_ttl expire.
+	ctx := context.Background()
+	sc := b.makeStorageContext(ctx, s)
+	request, err := sc.fetchSignRequest(stale)
+	require.NoError(t, err)
+	request.Expiration = time.Now().Add(-time.Minute)
+	require.NoError(t, sc.writeSignRequest(request))
+	_, err = CBWrite(b, s, "sign-request/"+stale+"/approve", nil)
+	require.ErrorContains(t, err, "has expired")
+
+	request, err = sc.fetchSignRequest(denied)
+	require.NoError(t, err)
+	request.Expiration = time.Now().Add(-time.Minute)
+	require.NoError(t, sc.writeSignRequest(request))
+	require.NoError(t, b.tidyExpiredSignRequests(sc))
+	resp, err = CBList(b, s, "sign-requests")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, []string{approved}, resp.Data["keys"])
+}
+
+func TestRoleIssuanceLimits(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "48h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	_, err = CBWrite(b, s, "roles/rate", map[string]interface{}{
+		"allow_any_name":       true,
+		"no_store":             true,
+		"ttl":                  "1h",
+		"issuance_rate_limit":  2,
+		"issuance_rate_period": "10m",
+	})
+	require.NoError(t, err)
+	_, err = CBWrite(b, s, "roles/active", map[string]interface{}{
+		"allow_any_name":          true,
+		"ttl":                     "1h",
+		"max_active_certificates": 2,
+	})
+	require.NoError(t, err)
+	_, err = CBWrite(b, s, "roles/negative", map[string]interface{}{
+		"max_active_certificates": -1,
+	})
+	require.ErrorContains(t, err, "must not be negative")
+
+	issue := func(role string) (*logical.Response, error) {
+		return CBWrite(b, s, "issue/"+role, map[string]interface{}{
+			"common_name": "client.example.com",
+		})
+	}
+
+	// Requests failing once their issuance was reserved release it.
+	ctx := context.Background()
+	sc := b.makeStorageContext(ctx, s)
+	_, err = CBWrite(b, s, "issue/rate", map[string]interface{}{
+		"common_name": "client.example.com",
+		"ip_sans":     "not-an-ip",
+	})
+	require.Error(t, err)
+	usage, err := sc.fetchRoleUsage("rate")
+	require.NoError(t, err)
+	require.Equal(t, 0, usage.WindowCount)
+	require.Equal(t, int64(0), usage.active())
+
+	for i := 0; i < 2; i++ {
+		resp, err = issue("rate")
+		requireSuccessNonNilResponse(t, resp, err)
+	}
+	resp, err = issue("rate")
+	require.ErrorIs(t, err, logical.ErrRateLimitQuotaExceeded)
+	require.Contains(t, resp.Error().Error(), "limit of 2 certificates issued per 10m0s")
+
+	// Signing is limited alike, and doesn't record refused requests.
+	_, _, csrPem := generateCSR(t, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "client.example.com"},
+	}, "ec", 256)
+	_, err = CBWrite(b, s, "sign/rate", map[string]interface{}{"csr": csrPem})
+	require.ErrorIs(t, err, logical.ErrRateLimitQuotaExceeded)
+
+	// Once the issuances fall out of the sliding window, more are allowed.
+	usage, err = sc.fetchRoleUsage("rate")
+	require.NoError(t, err)
+	require.Equal(t, 2, usage.WindowCount)
+	require.Equal(t, int64(2), usage.active())
+	usage.WindowStart = usage.WindowStart.Add(-20 * time.Minute)
+	require.NoError(t, sc.writeRoleUsage("rate", usage))
+	resp, err = issue("rate")
+	requireSuccessNonNilResponse(t, resp, err)
+
+	// Unexpired certificates are limited regardless of the rate.
+	for i := 0; i < 2; i++ {
+		resp, err = issue("active")
+		requireSuccessNonNilResponse(t, resp, err)
+	}
+	resp, err = issue("active")
+	require.ErrorIs(t, err, logical.ErrRateLimitQuotaExceeded)
+	require.Contains(t, resp.Error().Error(), "limit of 2 unexpired certificates")
+	_, err = CBWrite(b, s, "sign-verbatim/active", map[string]interface{}{"csr": csrPem})
+	require.ErrorIs(t, err, logical.ErrRateLimitQuotaExceeded)
+
+	usage, err = sc.fetchRoleUsage("active")
+	require.NoError(t, err)
+	require.Equal(t, int64(2), usage.active())
+	expired := map[int64]int64{}
+	for hour, count := range usage.ActiveByHour {
+		expired[hour-int64((3*time.Hour).Seconds())] = count
+	}
+	usage.ActiveByHour = expired
+	require.NoError(t, sc.writeRoleUsage("active", usage))
+	resp, err = issue("active")
+	requireSuccessNonNilResponse(t, resp, err)
+
+	// Deleting the role forgets its usage.
+	_, err = CBDelete(b, s, "roles/active")
+	require.NoError(t, err)
+	entry, err := s.Get(ctx, roleUsagePrefix+"active")
+	require.NoError(t, err)
+	require.Nil(t, entry)
+}
+
+func TestRenewCertificate(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "48h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	_, err = CBWrite(b, s, "roles/web", map[string]interface{}{
+		"allow_any_name":         true,
+		"key_type":               "ec",
+		"ttl":                    "1h",
+		"max_ttl":                "4h",
+		"allowed_uri_sans":       "spiffe://example.com/*",
+		"allowed_extension_oids": "1.3.6.1.4.1.99999.1",
+	})
+	require.NoError(t, err)
+
+	vendorValue, err := asn1.Marshal(42)
+	require.NoError(t, err)
+	resp, err = CBWrite(b, s, "issue/web", map[string]interface{}{
+		"common_name":          "web.example.com",
+		"alt_names":            "www.example.com",
+		"ip_sans":              "10.0.0.1",
+		"uri_sans":             "spiffe://example.com/web",
+		"exclude_cn_from_sans": true,
+		"custom_extensions":    "1.3.6.1.4.1.99999.1;critical:" + base64.StdEncoding.EncodeToString(vendorValue),
+		"ttl":                  "3h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	original := parseCert(t, resp.Data["certificate"].(string))
+	originalSerial := resp.Data["serial_number"].(string)
+
+	requireSameAttributes := func(renewed *x509.Certificate) {
+		t.Helper()
+		require.NotEqual(t, original.SerialNumber, renewed.SerialNumber)
+		require.Equal(t, original.Subject.CommonName, renewed.Subject.CommonName)
+		require.Equal(t, original.DNSNames, renewed.DNSNames)
+		require.Equal(t, original.IPAddresses, renewed.IPAddresses)
+		require.Equal(t, original.URIs, renewed.URIs)
+		found := false
+		for _, ext := range renewed.Extensions {
+			if ext.Id.String() == "1.3.6.1.4.1.99999.1" {
+				found = true
+				require.True(t, ext.Critical)
+				require.Equal(t, vendorValue, ext.Value)
+			}
+		}
+		require.True(t, found, "custom extension missing from renewed certificate")
+		require.InDelta(t, original.NotAfter.Sub(original.NotBefore).Seconds(), renewed.NotAfter.Sub(renewed.NotBefore).Seconds(), 5)
+	}
+
+	originalKey, err := certutil.ParsePEMBundle(resp.Data["private_key"].(string))
+	require.NoError(t, err)
+
+	// renew runs the request as presenting the given TLS client
+	// certificate, if any.
+	renew := func(path string, data map[string]interface{}, peer *x509.Certificate) (*logical.Response, error) {
+		req := &logical.Request{
+			Operation:  logical.UpdateOperation,
+			Path:       path,
+			Data:       data,
+			Storage:    s,
+			Connection: &logical.Connection{},
+			MountPoint: "pki/",
+		}
+		if peer != nil {
+			req.Connection.ConnState = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{peer}}
+		}
+		resp, err := b.HandleRequest(context.Background(), req)
+		if err == nil && resp.IsError() {
+			err = resp.Error()
+		}
+		return resp, err
+	}
+	csrFor := func(key crypto.Signer) string {
+		csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "other.example.com"}}, key)
+		require.NoError(t, err)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}))
+	}
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	// Serial numbers are public: renewing requires proof of possession of
+	// the original key.
+	_, err = renew("renew/web/"+originalSerial, nil, nil)
+	require.ErrorContains(t, err, "proof of possession")
+	_, err = renew("renew/web/"+originalSerial, map[string]interface{}{"csr": csrFor(newKey)}, nil)
+	require.ErrorContains(t, err, "proof of possession")
+
+	// Presenting the original certificate, a new key is generated.
+	resp, err = renew("renew/web/"+originalSerial, nil, original)
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, originalSerial, resp.Data["renewed_from"])
+	require.NotEmpty(t, resp.Data["private_key"])
+	renewed := parseCert(t, resp.Data["certificate"].(string))
+	requireSameAttributes(renewed)
+	renewedSerial := resp.Data["serial_number"].(string)
+
+	// The old and new certificates are linked in their metadata.
+	sc := b.makeStorageContext(context.Background(), s)
+	meta, err := sc.fetchCertMetadata(originalSerial)
+	require.NoError(t, err)
+	require.Equal(t, renewedSerial, meta.RenewedBy)
+	meta, err = sc.fetchCertMetadata(renewedSerial)
+	require.NoError(t, err)
+	require.Equal(t, originalSerial, meta.RenewedFrom)
+	require.Equal(t, "web", meta.Role)
+
+	// A CSR signed by the original key proves possession of it, and only
+	// supplies the key; the names still come from the original.
+	resp, err = renew("renew/web/"+normalizeSerial(originalSerial), map[string]interface{}{
+		"csr": csrFor(originalKey.PrivateKey),
+		"ttl": "2h",
+	}, nil)
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Empty(t, resp.Data["private_key"])
+	renewed = parseCert(t, resp.Data["certificate"].(string))
+	require.Equal(t, "web.example.com", renewed.Subject.CommonName)
+	require.True(t, original.PublicKey.(*ecdsa.PublicKey).Equal(renewed.PublicKey))
+	require.InDelta(t, (2 * time.Hour).Seconds(), time.Until(renewed.NotAfter).Seconds(), 60)
+
+	// With the original certificate presented, the key may change.
+	resp, err = renew("renew/web/"+originalSerial, map[string]interface{}{"csr": csrFor(newKey)}, original)
+	requireSuccessNonNilResponse(t, resp, err)
+	require.True(t, newKey.PublicKey.Equal(parseCert(t, resp.Data["certificate"].(string)).PublicKey))
+
+	// Certificates can only be renewed through the role they were issued
+	// through, so that policies on other roles' paths can't be bypassed.
+	_, err = CBWrite(b, s, "roles/other", map[string]interface{}{
+		"allow_any_name": true,
+		"key_type":       "ec",
+	})
+	require.NoError(t, err)
+	_, err = renew("renew/other/"+originalSerial, nil, original)
+	require.ErrorContains(t, err, "can only be renewed through it")
+	_, err = renew("renew/missing/"+originalSerial, nil, original)
+	require.ErrorContains(t, err, "unknown role")
+
+	// Renewals remain subject to the role's policy.
+	_, err = CBWrite(b, s, "roles/web", map[string]interface{}{
+		"allow_any_name":   true,
+		"key_type":         "ec",
+		"allowed_uri_sans": "spiffe://example.com/*",
+	})
+	require.NoError(t, err)
+	_, err = renew("renew/web/"+originalSerial, nil, original)
+	require.ErrorContains(t, err, "1.3.6.1.4.1.99999.1")
+
+	// Revoked certificates can't be renewed, and nor can unknown ones.
+	resp, err = CBWrite(b, s, "revoke", map[string]interface{}{"serial_number": renewedSerial})
+	requireSuccessNonNilResponse(t, resp, err)
+	_, err = renew("renew/web/"+renewedSerial, nil, renewed)
+	require.ErrorContains(t, err, "is revoked")
+	_, err = renew("renew/web/01:02:03", nil, nil)
+	require.ErrorContains(t, err, "not found")
+}
+
+func TestSerialNumberConfig(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	// Invalid formats are rejected.
+	for _, data := range []map[string]interface{}{
+		{"serial_number_bits": 32},
+		{"serial_number_bits": -1},
+		{"serial_number_prefix": "not hex"},
+		{"serial_number_prefix": "00:01"},
+		{"serial_number_prefix": "01", "serial_number_bits": 100},
+	} {
+		_, err := CBWrite(b, s, "config/mount", data)
+		require.Error(t, err, "expected %v to be rejected", data)
+	}
+
+	// A mount-wide prefix applies to roots and leaves alike.
+	resp, err := CBWrite(b, s, "config/mount", map[string]interface{}{
+		"serial_number_prefix": "7A",
+		"serial_number_bits":   64,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, "7a", resp.Data["serial_number_prefix"])
+	require.Equal(t, 64, resp.Data["serial_number_bits"])
+
+	resp, err = CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"issuer_name": "root",
+		"key_type":    "ec",
+		"ttl":         "48h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Len(t, parseCert(t, resp.Data["certificate"].(string)).SerialNumber.Bytes(), 9)
+	require.True(t, strings.HasPrefix(resp.Data["serial_number"].(string), "7a:"))
+
+	_, err = CBWrite(b, s, "roles/example", map[string]interface{}{
+		"allow_any_name": true,
+		"key_type":       "ec",
+		"ttl":            "1h",
+	})
+	require.NoError(t, err)
+	issue := func() []byte {
+		resp, err := CBWrite(b, s, "issue/example", map[string]interface{}{
+			"common_name": "host.example.com",
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		return parseCert(t, resp.Data["certificate"].(string)).SerialNumber.Bytes()
+	}
+	serial := issue()
+	require.Len(t, serial, 9)
+	require.Equal(t, byte(0x7a), serial[0])
+
+	// The issuer's settings take precedence over the mount's.
+	resp, err = CBPatch(b, s, "issuer/root", map[string]interface{}{
+		"serial_number_prefix": "01:02",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, "01:02", resp.Data["serial_number_prefix"])
+	serial = issue()
+	require.Len(t, serial, 10)
+	require.Equal(t, []byte{0x01, 0x02}, serial[:2])
+
+	resp, err = CBPatch(b, s, "issuer/root", map[string]interface{}{
+		"serial_number_bits": 128,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	serial = issue()
+	require.Len(t, serial, 18)
+	require.Equal(t, []byte{0x01, 0x02}, serial[:2])
+
+	_, err = CBPatch(b, s, "issuer/root", map[string]interface{}{
+		"serial_number_bits": 63,
+	})
+	require.ErrorContains(t, err, "at least 64 random bits")
+
+	// Without any prefix, serial numbers are random again.
+	_, err = CBPatch(b, s, "issuer/root", map[string]interface{}{
+		"serial_number_prefix": "",
+		"serial_number_bits":   0,
+	})
+	require.NoError(t, err)
+	_, err = CBWrite(b, s, "config/mount", map[string]interface{}{
+		"serial_number_prefix": "",
+		"serial_number_bits":   0,
+	})
+	require.NoError(t, err)
+	resp, err = CBRead(b, s, "issuer/root")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, 0, resp.Data["serial_number_bits"])
+	require.Equal(t, "", resp.Data["serial_number_prefix"])
+	require.LessOrEqual(t, len(issue()), 20)
+}
+
+func TestCertificateTransparency(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "48h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rootCert := parseCert(t, resp.Data["certificate"].(string))
+
+	_, err = CBWrite(b, s, "roles/example", map[string]interface{}{
+		"allow_any_name": true,
+		"key_type":       "ec",
+		"ttl":            "1h",
+	})
+	require.NoError(t, err)
+
+	// A fake log, recording the precertificates submitted to it and
+	// signing its SCTs with logKey, unless signing with badKey.
+	logKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	logKeyDer, err := x509.MarshalPKIXPublicKey(logKey.Public())
+	require.NoError(t, err)
+	logPublicKey := base64.StdEncoding.EncodeToString(logKeyDer)
+	badKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	var lock sync.Mutex
+	var submitted []*x509.Certificate
+	var lastSignature []byte
+	signWithBadKey := false
+	logID := sha256.Sum256(logKeyDer)
+	log := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/ct/v1/add-pre-chain", r.URL.Path)
+		var body struct {
+			Chain []string `json:"chain"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Len(t, body.Chain, 2)
+		der, err := base64.StdEncoding.DecodeString(body.Chain[0])
+		require.NoError(t, err)
+		precert, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		issuer, err := base64.StdEncoding.DecodeString(body.Chain[1])
+		require.NoError(t, err)
+		require.Equal(t, rootCert.Raw, issuer)
+
+		// The signed data of an SCT for a precertificate; see RFC 6962
+		// section 3.2.
+		tbs, err := precertificateTBSWithoutPoison(der)
+		require.NoError(t, err)
+		issuerKeyHash := sha256.Sum256(rootCert.RawSubjectPublicKeyInfo)
+		signed := []byte{0, 0, 0, 0, 0x01, 0x8b, 0xcf, 0xe5, 0x68, 0x00, 0, 1}
+		signed = append(signed, issuerKeyHash[:]...)
+		signed = append(signed, byte(len(tbs)>>16), byte(len(tbs)>>8), byte(len(tbs)))
+		signed = append(signed, tbs...)
+		signed = append(signed, 0, 0)
+		digest := sha256.Sum256(signed)
+
+		lock.Lock()
+		defer lock.Unlock()
+		submitted = append(submitted, precert)
+		signer := logKey
+		if signWithBadKey {
+			signer = badKey
+		}
+		sig, err := ecdsa.SignASN1(rand.Reader, signer, digest[:])
+		require.NoError(t, err)
+		lastSignature = append([]byte{4, 3, byte(len(sig) >> 8), byte(len(sig))}, sig...)
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sct_version": 0,
+			"id":          base64.StdEncoding.EncodeToString(logID[:]),
+			"timestamp":   1700000000000,
+			"extensions":  "",
+			"signature":   base64.StdEncoding.EncodeToString(lastSignature),
+		})
+	}))
+	defer log.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	resp, err = CBRead(b, s, "config/ct")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, false, resp.Data["enabled"])
+	require.Equal(t, "deny", resp.Data["failure_policy"])
+	_, err = CBWrite(b, s, "config/ct", map[string]interface{}{"enabled": true})
+	require.ErrorContains(t, err, "log_urls is required")
+	_, err = CBWrite(b, s, "config/ct", map[string]interface{}{
+		"enabled":         true,
+		"log_urls":        log.URL,
+		"log_public_keys": logPublicKey,
+		"min_scts":        2,
+	})
+	require.ErrorContains(t, err, "can not exceed the number of logs")
+	_, err = CBWrite(b, s, "config/ct", map[string]interface{}{
+		"enabled":  true,
+		"log_urls": log.URL,
+	})
+	require.ErrorContains(t, err, "log_public_keys must give the public key of each of the 1 logs")
+	_, err = CBWrite(b, s, "config/ct", map[string]interface{}{
+		"enabled":         true,
+		"log_urls":        log.URL,
+		"log_public_keys": "bm90IGEga2V5",
+	})
+	require.ErrorContains(t, err, "invalid key given in log_public_keys")
+
+	resp, err = CBWrite(b, s, "config/ct", map[string]interface{}{
+		"enabled":         true,
+		"log_urls":        log.URL + "/",
+		"log_public_keys": logPublicKey,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, []string{log.URL}, resp.Data["log_urls"])
+	require.Equal(t, []string{logPublicKey}, resp.Data["log_public_keys"])
+
+	extensionsOf := func(cert *x509.Certificate, without string) []pkix.Extension {
+		var exts []pkix.Extension
+		for _, ext := range cert.Extensions {
+			if ext.Id.String() != without {
+				exts = append(exts, ext)
+			}
+		}
+		return exts
+	}
+
+	// The precertificate submitted is the certificate issued, with the
+	// poison in place of the SCT list.
+	resp, err = CBWrite(b, s, "issue/example", map[string]interface{}{
+		"common_name": "host.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	cert := parseCert(t, resp.Data["certificate"].(string))
+	require.Len(t, submitted, 1)
+	precert := submitted[0]
+	require.Equal(t, cert.SerialNumber, precert.SerialNumber)
+	require.Equal(t, cert.NotBefore, precert.NotBefore)
+	require.Equal(t, extensionsOf(cert, certutil.SCTListOID.String()), extensionsOf(precert, certutil.PrecertificatePoisonOID.String()))
+	require.NoError(t, precert.CheckSignatureFrom(rootCert))
+
+	var sctList []byte
+	for _, ext := range cert.Extensions {
+		require.False(t, ext.Id.Equal(certutil.PrecertificatePoisonOID))
+		if ext.Id.Equal(certutil.SCTListOID) {
+			_, err := asn1.Unmarshal(ext.Value, &sctList)
+			require.NoError(t, err)
+		}
+	}
+	expectedSCT := append([]byte{0}, logID[:]...)
+	expectedSCT = append(expectedSCT, 0, 0, 0x01, 0x8b, 0xcf, 0xe5, 0x68, 0x00, 0, 0)
+	expectedSCT = append(expectedSCT, lastSignature...)
+	require.Equal(t, append([]byte{0, byte(len(expectedSCT) + 2), 0, byte(len(expectedSCT))}, expectedSCT...), sctList)
+
+	// SCTs which don't verify against the log's key are refused.
+	lock.Lock()
+	signWithBadKey = true
+	lock.Unlock()
+	_, err = CBWrite(b, s, "issue/example", map[string]interface{}{
+		"common_name": "host.example.com",
+	})
+	require.ErrorContains(t, err, "log returned an SCT whose signature doesn't verify")
+	lock.Lock()
+	signWithBadKey = false
+	lock.Unlock()
+	badKeyDer, err := x509.MarshalPKIXPublicKey(badKey.Public())
+	require.NoError(t, err)
+	_, err = CBWrite(b, s, "config/ct", map[string]interface{}{
+		"log_public_keys": base64.StdEncoding.EncodeToString(badKeyDer),
+	})
+	require.NoError(t, err)
+	_, err = CBWrite(b, s, "issue/example", map[string]interface{}{
+		"common_name": "host.example.com",
+	})
+	require.ErrorContains(t, err, "log ID not matching its public key")
+	_, err = CBWrite(b, s, "config/ct", map[string]interface{}{
+		"log_public_keys": logPublicKey,
+	})
+	require.NoError(t, err)
+	lock.Lock()
+	submitted = submitted[:1]
+	lock.Unlock()
+
+	// CA certificates aren't submitted.
+	resp, err = CBWrite(b, s, "intermediate/generate/internal", map[string]interface{}{
+		"common_name": "int example.com",
+		"key_type":    "ec",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	resp, err = CBWrite(b, s, "root/sign-intermediate", map[string]interface{}{
+		"csr": resp.Data["csr"],
+		"ttl": "24h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Len(t, submitted, 1)
+
+	// Too few SCTs fail the request, unless the failure policy allows it.
+	_, err = CBWrite(b, s, "config/ct", map[string]interface{}{
+		"log_urls":        []string{log.URL, failing.URL},
+		"log_public_keys": []string{logPublicKey, logPublicKey},
+		"min_scts":        2,
+	})
+	require.NoError(t, err)
+	_, err = CBWrite(b, s, "issue/example", map[string]interface{}{
+		"common_name": "host.example.com",
+	})
+	require.ErrorContains(t, err, "only 1 of the required 2 Certificate Transparency logs returned an SCT")
+
+	_, err = CBWrite(b, s, "config/ct", map[string]interface{}{
+		"failure_policy": "allow",
+	})
+	require.NoError(t, err)
+	resp, err = CBWrite(b, s, "issue/example", map[string]interface{}{
+		"common_name": "host.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.NotEmpty(t, resp.Warnings)
+	require.Contains(t, strings.Join(resp.Warnings, "\n"), "failure_policy is \"allow\"")
+	found := false
+	for _, ext := range parseCert(t, resp.Data["certificate"].(string)).Extensions {
+		found = found || ext.Id.Equal(certutil.SCTListOID)
+	}
+	require.True(t, found)
+}
+
+func TestRoleSubjectTemplates(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "48h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	// Templates are checked when the role is written.
+	_, err = CBWrite(b, s, "roles/bad", map[string]interface{}{
+		"common_name_template": "{{request.not_a_parameter}}.example.com",
+	})
+	require.ErrorContains(t, err, `unknown request parameter "not_a_parameter"`)
+	_, err = CBWrite(b, s, "roles/bad", map[string]interface{}{
+		"ou_template": "{{identity.entity.name",
+	})
+	require.ErrorContains(t, err, "ou_template is not a valid template")
+
+	_, err = CBWrite(b, s, "roles/svc", map[string]interface{}{
+		"allowed_domains":        "svc.internal",
+		"allow_subdomains":       true,
+		"common_name_template":   "{{identity.entity.name}}.svc.internal",
+		"ou_template":            "{{identity.entity.metadata.team}},static",
+		"organization_template":  "{{request.serial_number}} Corp",
+		"allowed_serial_numbers": "*",
+		"key_type":               "ec",
+	})
+	require.NoError(t, err)
+
+	// Without an entity, identity templates can't be rendered.
+	_, err = CBWrite(b, s, "issue/svc", map[string]interface{}{
+		"common_name": "anything.svc.internal",
+	})
+	require.ErrorContains(t, err, "the request has no entity")
+
+	b.System().(*logical.StaticSystemView).EntityVal = &logical.Entity{
+		ID:       "entity-id",
+		Name:     "billing",
+		Metadata: map[string]string{"team": "payments"},
+	}
+	issue := func(data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation:  logical.UpdateOperation,
+			Path:       "issue/svc",
+			Data:       data,
+			Storage:    s,
+			MountPoint: "pki/",
+			EntityID:   "entity-id",
+		})
+	}
+
+	// The requested common name is ignored in favour of the template's.
+	resp, err = issue(map[string]interface{}{
+		"common_name":   "other.svc.internal",
+		"serial_number": "Acme",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	cert := parseCert(t, resp.Data["certificate"].(string))
+	require.Equal(t, "billing.svc.internal", cert.Subject.CommonName)
+	require.Equal(t, []string{"billing.svc.internal"}, cert.DNSNames)
+	require.ElementsMatch(t, []string{"payments", "static"}, cert.Subject.OrganizationalUnit)
+	require.Equal(t, []string{"Acme Corp"}, cert.Subject.Organization)
+
+	// Request parameters are substituted verbatim, never templated.
+	resp, err = issue(map[string]interface{}{
+		"serial_number": "{{identity.entity.name}}",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	cert = parseCert(t, resp.Data["certificate"].(string))
+	require.Equal(t, []string{"{{identity.entity.name}} Corp"}, cert.Subject.Organization)
+
+	// The rendered common name is still subject to the role's restrictions.
+	b.System().(*logical.StaticSystemView).EntityVal.Name = "billing team"
+	resp, err = issue(map[string]interface{}{})
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+	require.Contains(t, resp.Error().Error(), "common name billing team.svc.internal not allowed")
+}
+
+func TestUserPrincipalNames(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "48h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	_, err = CBWrite(b, s, "roles/smartcard", map[string]interface{}{
+		"allowed_domains":    "example.com",
+		"allow_subdomains":   true,
+		"allowed_other_sans": "1.3.6.1.4.1.311.20.2.3;UTF8:*@corp.example.com",
+		"ext_key_usage_oids": "1.3.6.1.4.1.311.20.2.2",
+		"key_type":           "ec",
+	})
+	require.NoError(t, err)
+
+	getUPNs := func(cert *x509.Certificate) []string {
+		others, err := getOtherSANsFromX509Extensions(cert.Extensions)
+		require.NoError(t, err)
+		var upns []string
+		for _, other := range others {
+			require.Equal(t, oidUserPrincipalName, other.oid)
+			upns = append(upns, other.value)
+		}
+		return upns
+	}
+
+	resp, err = CBWrite(b, s, "issue/smartcard", map[string]interface{}{
+		"common_name":          "alice.example.com",
+		"user_principal_names": "alice@corp.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	cert := parseCert(t, resp.Data["certificate"].(string))
+	require.Equal(t, []string{"alice@corp.example.com"}, getUPNs(cert))
+	require.Equal(t, []string{"alice.example.com"}, cert.DNSNames)
+
+	// UPNs are subject to the role's allowed_other_sans.
+	_, err = CBWrite(b, s, "issue/smartcard", map[string]interface{}{
+		"common_name":          "alice.example.com",
+		"user_principal_names": "alice@example.org",
+	})
+	require.ErrorContains(t, err, "other SAN alice@example.org not allowed for OID 1.3.6.1.4.1.311.20.2.3 by this role")
+
+	// UPNs requested in a CSR are honored when signing with use_csr_sans.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	sans := &x509.Certificate{DNSNames: []string{"bob.example.com"}}
+	require.NoError(t, handleOtherSANs(sans, map[string][]string{
+		oidUserPrincipalName: {"bob@corp.example.com"},
+	}))
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:         pkix.Name{CommonName: "bob.example.com"},
+		ExtraExtensions: sans.ExtraExtensions,
+	}, key)
+	require.NoError(t, err)
+	csrPem := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}))
+
+	resp, err = CBWrite(b, s, "sign/smartcard", map[string]interface{}{
+		"csr": csrPem,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	cert = parseCert(t, resp.Data["certificate"].(string))
+	require.Equal(t, []string{"bob@corp.example.com"}, getUPNs(cert))
+	require.Equal(t, []string{"bob.example.com"}, cert.DNSNames)
+
+	// Without use_csr_sans, the CSR's UPNs are ignored.
+	_, err = CBPatch(b, s, "roles/smartcard", map[string]interface{}{
+		"use_csr_sans": false,
+	})
+	require.NoError(t, err)
+	resp, err = CBWrite(b, s, "sign/smartcard", map[string]interface{}{
+		"csr": csrPem,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	cert = parseCert(t, resp.Data["certificate"].(string))
+	require.Empty(t, getUPNs(cert))
+}
+
+func TestOCSPMustStaple(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "48h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	_, err = CBWrite(b, s, "roles/staple", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"ocsp_must_staple": true,
+		"key_type":         "ec",
+	})
+	require.NoError(t, err)
+
+	// Without OCSP servers, clients couldn't fetch a response to staple.
+	_, err = CBWrite(b, s, "issue/staple", map[string]interface{}{
+		"common_name": "www.example.com",
+	})
+	require.ErrorContains(t, err, "the issuer has no OCSP servers configured")
+
+	_, err = CBWrite(b, s, "config/urls", map[string]interface{}{
+		"ocsp_servers": "http://localhost:8200/v1/pki/ocsp",
+	})
+	require.NoError(t, err)
+
+	resp, err = CBWrite(b, s, "issue/staple", map[string]interface{}{
+		"common_name": "www.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	cert := parseCert(t, resp.Data["certificate"].(string))
+	require.Equal(t, []string{"http://localhost:8200/v1/pki/ocsp"}, cert.OCSPServer)
+	found := false
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}) {
+			var features []int
+			_, err := asn1.Unmarshal(ext.Value, &features)
+			require.NoError(t, err)
+			require.Equal(t, []int{5}, features)
+			found = true
+		}
+	}
+	require.True(t, found)
+
+	// Nor can the mount's responder be disabled.
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"ocsp_disable": true,
+	})
+	require.NoError(t, err)
+	_, err = CBWrite(b, s, "issue/staple", map[string]interface{}{
+		"common_name": "www.example.com",
+	})
+	require.ErrorContains(t, err, "OCSP is disabled on this mount")
+
+	// Roles without the flag are unaffected.
+	_, err = CBPatch(b, s, "roles/staple", map[string]interface{}{
+		"ocsp_must_staple": false,
+	})
+	require.NoError(t, err)
+	resp, err = CBWrite(b, s, "issue/staple", map[string]interface{}{
+		"common_name": "www.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	cert = parseCert(t, resp.Data["certificate"].(string))
+	for _, ext := range cert.Extensions {
+		require.False(t, ext.Id.Equal(asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}))
+	}
+}
+
+func TestRoleExtKeyUsage(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "48h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	// Vendor EKUs combine with the named ones, including Microsoft's.
+	_, err = CBWrite(b, s, "roles/vendor", map[string]interface{}{
+		"allowed_domains":    "example.com",
+		"allow_subdomains":   true,
+		"server_flag":        false,
+		"client_flag":        false,
+		"ext_key_usage":      "MicrosoftCommercialCodeSigning,MicrosoftKernelCodeSigning",
+		"ext_key_usage_oids": "1.3.6.1.4.1.311.10.3.12,1.3.6.1.4.1.99999.1",
+		"key_type":           "ec",
+	})
+	require.NoError(t, err)
+	resp, err = CBWrite(b, s, "issue/vendor", map[string]interface{}{
+		"common_name": "www.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	cert := parseCert(t, resp.Data["certificate"].(string))
+	require.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageMicrosoftCommercialCodeSigning, x509.ExtKeyUsageMicrosoftKernelCodeSigning}, cert.ExtKeyUsage)
+	require.Equal(t, []asn1.ObjectIdentifier{{1, 3, 6, 1, 4, 1, 311, 10, 3, 12}, {1, 3, 6, 1, 4, 1, 99999, 1}}, cert.UnknownExtKeyUsage)
+
+	// no_ext_key_usage omits the extension despite the default flags.
+	_, err = CBWrite(b, s, "roles/none", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"no_ext_key_usage": true,
+		"key_type":         "ec",
+	})
+	require.NoError(t, err)
+	resp, err = CBWrite(b, s, "issue/none", map[string]interface{}{
+		"common_name": "www.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	cert = parseCert(t, resp.Data["certificate"].(string))
+	require.Empty(t, cert.ExtKeyUsage)
+	require.Empty(t, cert.UnknownExtKeyUsage)
+	for _, ext := range cert.Extensions {
+		require.False(t, ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 37}))
+	}
+
+	_, err = CBPatch(b, s, "roles/none", map[string]interface{}{
+		"ext_key_usage_oids": "1.3.6.1.4.1.99999.1",
+	})
+	require.ErrorContains(t, err, `"no_ext_key_usage" can't be combined`)
+}
+
+func TestIssuerHealthCheck(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	findingChecks := func(resp *logical.Response) []string {
+		var checks []string
+		for _, finding := range resp.Data["findings"].([]map[string]interface{}) {
+			checks = append(checks, finding["check"].(string)+"/"+finding["severity"].(string))
+		}
+		return checks
+	}
+
+	// An empty mount is healthy.
+	resp, err := CBRead(b, s, "health-check")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, true, resp.Data["healthy"])
+	require.Empty(t, resp.Data["findings"])
+
+	resp, err = CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"issuer_name": "root",
+		"not_after":   time.Now().Add(365 * 24 * time.Hour).UTC().Format(time.RFC3339),
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rootId := resp.Data["issuer_id"].(issuerID)
+
+	resp, err = CBRead(b, s, "issuer/root/health")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, rootId.String(), resp.Data["issuer_id"])
+	require.Equal(t, true, resp.Data["healthy"])
+	require.Empty(t, resp.Data["findings"])
+	require.InDelta(t, 364, resp.Data["days_until_expiry"], 1)
+	require.NotEmpty(t, resp.Data["crl_next_update"])
+
+	// An intermediate whose root is elsewhere has an incomplete chain, and
+	// one expiring soon is flagged.
+	b2, s2 := createBackendWithStorage(t)
+	resp, err = CBWrite(b2, s2, "root/generate/internal", map[string]interface{}{
+		"common_name": "other root example.com",
+		"key_type":    "ec",
+		"not_after":   time.Now().Add(365 * 24 * time.Hour).UTC().Format(time.RFC3339),
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	resp, err = CBWrite(b, s, "intermediate/generate/internal", map[string]interface{}{
+		"common_name": "intermediate example.com",
+		"key_type":    "ec",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	resp, err = CBWrite(b2, s2, "root/sign-intermediate", map[string]interface{}{
+		"csr": resp.Data["csr"],
+		"ttl": "240h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	resp, err = CBWrite(b, s, "intermediate/set-signed", map[string]interface{}{
+		"certificate": resp.Data["certificate"],
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	intId := resp.Data["imported_issuers"].([]string)[0]
+	_, err = CBPatch(b, s, "issuer/"+intId, map[string]interface{}{
+		"issuer_name": "int",
+	})
+	require.NoError(t, err)
+
+	resp, err = CBRead(b, s, "issuer/int/health")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, true, resp.Data["healthy"])
+	require.ElementsMatch(t, []string{"chain/warning", "expiry/warning"}, findingChecks(resp))
+
+	// Expired CRLs are critical.
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"expiry": "1s",
+	})
+	require.NoError(t, err)
+	_, err = CBRead(b, s, "crl/rotate")
+	require.NoError(t, err)
+	time.Sleep(2 * time.Second)
+
+	resp, err = CBRead(b, s, "health-check")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, false, resp.Data["healthy"])
+	require.ElementsMatch(t, []string{"crl/critical", "chain/warning", "expiry/warning", "crl/critical"}, findingChecks(resp))
+	require.Len(t, resp.Data["issuers"], 2)
+	require.Equal(t, false, resp.Data["issuers"].(map[string]interface{})[rootId.String()].(map[string]interface{})["healthy"])
+
+	_, err = CBRead(b, s, "issuer/missing/health")
+	require.ErrorContains(t, err, "unable to find PKI issuer for reference: missing")
+}
+
+func TestRootRotation(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	// Nothing to rotate yet.
+	resp, err := CBRead(b, s, "root/rotation")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, rootRotationStateNone, resp.Data["state"])
+
+	resp, err = CBWrite(b, s, "root/rotation/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+	})
+	require.ErrorContains(t, err, "no default issuer")
+
+	resp, err = CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"issuer_name": "current",
+		"ttl":         "8760h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	currentId := resp.Data["issuer_id"].(issuerID)
+
+	_, err = CBWrite(b, s, "roles/pinned", map[string]interface{}{
+		"allow_any_name": true,
+		"issuer_ref":     "current",
+	})
+	require.NoError(t, err)
+
+	// Steps out of order fail.
+	resp, err = CBWrite(b, s, "root/rotation/cross-sign", map[string]interface{}{})
+	require.ErrorContains(t, err, "must be in state")
+	resp, err = CBWrite(b, s, "root/rotation/complete", map[string]interface{}{})
+	require.ErrorContains(t, err, "must be in state")
+	resp, err = CBDelete(b, s, "root/rotation")
+	require.ErrorContains(t, err, "no root rotation is in progress")
+
+	resp, err = CBWrite(b, s, "root/rotation/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "8760h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	nextId := resp.Data["issuer_id"].(issuerID)
+	require.NotEqual(t, currentId, nextId)
+
+	resp, err = CBRead(b, s, "issuer/next")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, nextId, resp.Data["issuer_id"])
+
+	resp, err = CBRead(b, s, "root/rotation")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, rootRotationStateGenerated, resp.Data["state"])
+	require.Equal(t, currentId.String(), resp.Data["current_issuer"])
+	require.Equal(t, nextId.String(), resp.Data["next_issuer"])
+
+	// Only one rotation at a time, and the default is unchanged.
+	_, err = CBWrite(b, s, "root/rotation/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"issuer_name": "another",
+	})
+	require.ErrorContains(t, err, "already in progress")
+	resp, err = CBRead(b, s, "config/issuers")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, currentId, resp.Data["default"])
+
+	resp, err = CBWrite(b, s, "root/rotation/cross-sign", map[string]interface{}{})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, rootRotationStateCrossSigned, resp.Data["state"])
+	currentCrossId := issuerID(resp.Data["current_cross_signed"].(string))
+	nextCrossId := issuerID(resp.Data["next_cross_signed"].(string))
+
+	// Each cross-signed certificate has the subject and key of one root,
+	// signed by the other.
+	fetchCert := func(ref string) *x509.Certificate {
+		resp, err := CBRead(b, s, "issuer/"+ref+"/json")
+		requireSuccessNonNilResponse(t, resp, err)
+		return parseCert(t, resp.Data["certificate"].(string))
+	}
+	currentCert := fetchCert(currentId.String())
+	nextCert := fetchCert(nextId.String())
+	currentCross := fetchCert(currentCrossId.String())
+	nextCross := fetchCert(nextCrossId.String())
+
+	require.Equal(t, currentCert.RawSubject, currentCross.RawSubject)
+	require.Equal(t, currentCert.SubjectKeyId, currentCross.SubjectKeyId)
+	require.NoError(t, currentCross.CheckSignatureFrom(nextCert))
+	require.Equal(t, nextCert.RawSubject, nextCross.RawSubject)
+	require.Equal(t, nextCert.SubjectKeyId, nextCross.SubjectKeyId)
+	require.NoError(t, nextCross.CheckSignatureFrom(currentCert))
+
+	resp, err = CBRead(b, s, "issuer/"+nextCrossId.String())
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, nextId, resp.Data["cross_signed_from"])
+
+	// Both cross-signed certificates are kept for revocation.
+	resp, err = CBList(b, s, "certs")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Contains(t, resp.Data["keys"], serialFromCert(currentCross))
+	require.Contains(t, resp.Data["keys"], serialFromCert(nextCross))
+
+	resp, err = CBWrite(b, s, "root/rotation/complete", map[string]interface{}{})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, rootRotationStateCompleted, resp.Data["state"])
+	require.Len(t, resp.Warnings, 1, "expected a warning about the pinned role: %v", resp.Warnings)
+	require.Contains(t, resp.Warnings[0], `"current"`)
+
+	resp, err = CBRead(b, s, "config/issuers")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, nextId, resp.Data["default"])
+
+	resp, err = CBWrite(b, s, "issue/pinned", map[string]interface{}{
+		"common_name": "leaf.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	leafCert := parseCert(t, resp.Data["certificate"].(string))
+	require.NoError(t, leafCert.CheckSignatureFrom(currentCert))
+
+	// A new rotation may start from the completed one, and be aborted.
+	resp, err = CBWrite(b, s, "root/rotation/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"issuer_name": "after-next",
+		"ttl":         "8760h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	afterNextId := resp.Data["issuer_id"].(issuerID)
+
+	resp, err = CBRead(b, s, "root/rotation")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, nextId.String(), resp.Data["current_issuer"])
+
+	resp, err = CBDelete(b, s, "root/rotation")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.NotEmpty(t, resp.Warnings)
+
+	resp, err = CBRead(b, s, "root/rotation")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, rootRotationStateNone, resp.Data["state"])
+
+	resp, err = CBRead(b, s, "issuer/"+afterNextId.String())
+	requireSuccessNonNilResponse(t, resp, err)
+}
+
+func TestAIAChasing(t *testing.T) {
+	t.Parallel()
+	bRoot, sRoot := createBackendWithStorage(t)
+
+	resp, err := CBWrite(bRoot, sRoot, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rootPem := resp.Data["certificate"].(string)
+	rootCert := parseCert(t, rootPem)
+
+	// Serves the root over HTTP, as its caIssuers URL.
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		if r.URL.Path != "/root.crt" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pkix-cert")
+		w.Write(rootCert.Raw)
+	}))
+	defer server.Close()
+
+	_, err = CBWrite(bRoot, sRoot, "config/urls", map[string]interface{}{
+		"issuing_certificates": server.URL + "/root.crt",
+	})
+	require.NoError(t, err)
+
+	// Signs an intermediate for the mount, returning only its certificate.
+	signIntermediate := func(b *backend, s logical.Storage) string {
+		resp, err := CBWrite(b, s, "intermediate/generate/internal", map[string]interface{}{
+			"common_name": "intermediate example.com",
+			"key_type":    "ec",
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+
+		resp, err = CBWrite(bRoot, sRoot, "root/sign-intermediate", map[string]interface{}{
+			"csr":    resp.Data["csr"],
+			"format": "pem",
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		return resp.Data["certificate"].(string)
+	}
+
+	b, s := createBackendWithStorage(t)
+	resp, err = CBRead(b, s, "config/aia-chasing")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, false, resp.Data["enabled"])
+	require.Equal(t, defaultAIAChasingMaxDepth, resp.Data["max_depth"])
+	_, err = CBWrite(b, s, "config/aia-chasing", map[string]interface{}{"enabled": true})
+	require.ErrorContains(t, err, "allowed_hosts is required")
+	_, err = CBWrite(b, s, "config/aia-chasing", map[string]interface{}{
+		"enabled":       true,
+		"allowed_hosts": "https://pki.example.com",
+	})
+	require.ErrorContains(t, err, "invalid host given in allowed_hosts")
+
+	// Disabled, nothing is fetched.
+	resp, err = CBWrite(b, s, "intermediate/set-signed", map[string]interface{}{
+		"certificate": signIntermediate(b, s),
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Empty(t, resp.Data["fetched_issuers"])
+	require.Equal(t, int32(0), atomic.LoadInt32(&fetches))
+
+	// Enabled, but the caIssuers URL's host isn't allowed.
+	b, s = createBackendWithStorage(t)
+	_, err = CBWrite(b, s, "config/aia-chasing", map[string]interface{}{
+		"enabled":       true,
+		"allowed_hosts": "*.example.com",
+	})
+	require.NoError(t, err)
+	resp, err = CBWrite(b, s, "intermediate/set-signed", map[string]interface{}{
+		"certificate": signIntermediate(b, s),
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Empty(t, resp.Data["fetched_issuers"])
+	require.NotEmpty(t, resp.Warnings)
+	require.Contains(t, resp.Warnings[0], "host isn't on allowed_hosts")
+	require.Equal(t, int32(0), atomic.LoadInt32(&fetches))
+
+	// Allowed, the root is fetched and completes the chain.
+	b, s = createBackendWithStorage(t)
+	resp, err = CBWrite(b, s, "config/aia-chasing", map[string]interface{}{
+		"enabled":       true,
+		"allowed_hosts": "127.0.0.1",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, []string{"127.0.0.1"}, resp.Data["allowed_hosts"])
+
+	resp, err = CBWrite(b, s, "intermediate/set-signed", map[string]interface{}{
+		"certificate": signIntermediate(b, s),
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	for _, warning := range resp.Warnings {
+		require.NotContains(t, warning, "incomplete")
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+	fetched := resp.Data["fetched_issuers"].([]string)
+	require.Len(t, fetched, 1)
+	imported := resp.Data["imported_issuers"].([]string)
+	require.Len(t, imported, 2)
+	require.Equal(t, "", resp.Data["mapping"].(map[string]string)[fetched[0]])
+
+	resp, err = CBRead(b, s, "issuer/"+fetched[0])
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, strings.TrimSpace(rootPem), strings.TrimSpace(resp.Data["certificate"].(string)))
+
+	resp, err = CBRead(b, s, "issuer/"+imported[0])
+	requireSuccessNonNilResponse(t, resp, err)
+	chain := resp.Data["ca_chain"].([]string)
+	require.Len(t, chain, 2)
+	require.Equal(t, strings.TrimSpace(rootPem), strings.TrimSpace(chain[1]))
+
+	// Fetches are abandoned along with the request.
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = fetchAIACertificates(cancelledCtx, server.Client(), server.URL+"/root.crt")
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+}
+
+func TestParseAIACertificates(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	cert := parseCert(t, resp.Data["certificate"].(string))
+
+	p7, err := encodePkcs7CertsOnly([][]byte{cert.Raw})
+	require.NoError(t, err)
+
+	for name, body := range map[string][]byte{
+		"der":   cert.Raw,
+		"pem":   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		"pkcs7": p7,
+	} {
+		certs, err := parseAIACertificates(body)
+		require.NoError(t, err, name)
+		require.Len(t, certs, 1, name)
+		require.Equal(t, cert.Raw, certs[0].Raw, name)
+	}
+
+	_, err = parseAIACertificates([]byte("not a certificate"))
+	require.Error(t, err)
+
+	require.True(t, aiaHostAllowed([]string{"*.example.com"}, "pki.example.com"))
+	require.True(t, aiaHostAllowed([]string{"pki.example.com"}, "PKI.example.com."))
+	require.False(t, aiaHostAllowed([]string{"*.example.com"}, "example.com"))
+	require.False(t, aiaHostAllowed([]string{"*.example.com"}, "pki.badexample.com"))
+	require.False(t, aiaHostAllowed([]string{"pki.example.com"}, "other.example.com"))
+}
+
+func TestUsageStats(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+	ctx := context.Background()
+	sc := b.makeStorageContext(ctx, s)
+
+	// Until built, only the changes seen by this node are reported.
+	resp, err := CBRead(b, s, "stats")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, int64(0), resp.Data["stored_certs"])
+	require.Equal(t, "", resp.Data["tracking_since"])
+	require.NotEmpty(t, resp.Warnings)
+
+	resp, err = CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	// Building counts what is already stored.
+	require.NoError(t, b.buildUsageStatsIfRequired(ctx, s))
+	resp, err = CBRead(b, s, "stats")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Empty(t, resp.Warnings)
+	require.Equal(t, int64(1), resp.Data["stored_certs"])
+	require.Equal(t, int64(0), resp.Data["issued"])
+	require.NotEqual(t, "", resp.Data["tracking_since"])
+	rootBytes := resp.Data["stored_cert_bytes"].(int64)
+	require.Greater(t, rootBytes, int64(0))
+
+	for _, role := range []map[string]interface{}{
+		{"name": "stored"},
+		{"name": "unstored", "no_store": true},
+	} {
+		_, err = CBWrite(b, s, "roles/"+role["name"].(string), map[string]interface{}{
+			"allow_any_name": true,
+			"key_type":       "ec",
+			"ttl":            "1h",
+			"no_store":       role["no_store"],
+		})
+		require.NoError(t, err)
+	}
+
+	var serials []string
+	for i := 0; i < 3; i++ {
+		resp, err = CBWrite(b, s, "issue/stored", map[string]interface{}{
+			"common_name": "stored.example.com",
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		serials = append(serials, resp.Data["serial_number"].(string))
+	}
+	resp, err = CBWrite(b, s, "issue/unstored", map[string]interface{}{
+		"common_name": "unstored.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": serials[0],
+	})
+	require.NoError(t, err)
+
+	// Pending changes are reported before being flushed, and are kept once
+	// flushed.
+	for _, flush := range []bool{false, true} {
+		if flush {
+			require.NoError(t, sc.flushUsageStats())
+			require.Equal(t, usageStatsEntry{}, b.usageStats.peek())
+		}
+
+		resp, err = CBRead(b, s, "stats")
+		requireSuccessNonNilResponse(t, resp, err)
+		require.Equal(t, int64(4), resp.Data["stored_certs"])
+		require.Equal(t, int64(1), resp.Data["revoked_certs"])
+		require.Equal(t, int64(4), resp.Data["issued"])
+		require.Equal(t, map[string]int64{"stored": 3, "unstored": 1}, resp.Data["issued_by_role"])
+		require.Greater(t, resp.Data["stored_cert_bytes"].(int64), rootBytes)
+		require.Greater(t, resp.Data["revoked_cert_bytes"].(int64), int64(0))
+		require.Equal(t, resp.Data["stored_cert_bytes"].(int64)+resp.Data["revoked_cert_bytes"].(int64), resp.Data["estimated_storage_bytes"])
+	}
+
+	// The counts match storage.
+	certs, err := s.List(ctx, "certs/")
+	require.NoError(t, err)
+	require.Len(t, certs, 4)
+	revoked, err := s.List(ctx, revokedPath)
+	require.NoError(t, err)
+	require.Len(t, revoked, 1)
+
+	// Removing revocations and certificates is counted too.
+	require.NoError(t, deleteRevocationEntry(sc, revoked[0]))
+	resp, err = CBRead(b, s, "stats")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, int64(0), resp.Data["revoked_certs"])
+	require.Equal(t, int64(0), resp.Data["revoked_cert_bytes"])
+}
+
+func TestRoleAllowedIssuers(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	for _, name := range []string{"internal", "partner"} {
+		resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+			"common_name": name + " root example.com",
+			"issuer_name": name,
+			"key_type":    "ec",
+			"ttl":         "72h",
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+	}
+	_, err := CBWrite(b, s, "config/issuers", map[string]interface{}{
+		"default": "internal",
+	})
+	require.NoError(t, err)
+
+	// The role's own issuer must be allowed.
+	_, err = CBWrite(b, s, "roles/internal", map[string]interface{}{
+		"allow_any_name":  true,
+		"key_type":        "ec",
+		"ttl":             "1h",
+		"issuer_ref":      "partner",
+		"allowed_issuers": "internal",
+	})
+	require.ErrorContains(t, err, "isn't among allowed_issuers")
+
+	resp, err := CBWrite(b, s, "roles/internal", map[string]interface{}{
+		"allow_any_name":  true,
+		"key_type":        "ec",
+		"ttl":             "1h",
+		"allowed_issuers": "internal,missing",
+	})
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	require.Len(t, resp.Warnings, 1)
+	require.Contains(t, resp.Warnings[0], "missing")
+
+	resp, err = CBRead(b, s, "roles/internal")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, []string{"internal", "missing"}, resp.Data["allowed_issuers"])
+
+	// Issuing from the default (allowed) issuer and naming it explicitly
+	// work; naming another issuer doesn't.
+	resp, err = CBWrite(b, s, "issue/internal", map[string]interface{}{
+		"common_name": "default.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	resp, err = CBWrite(b, s, "issuer/internal/issue/internal", map[string]interface{}{
+		"common_name": "explicit.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	_, err = CBWrite(b, s, "issuer/partner/issue/internal", map[string]interface{}{
+		"common_name": "partner.example.com",
+	})
+	require.ErrorContains(t, err, "allowed_issuers")
+
+	// Nor does the default issuer once it leaves the list.
+	_, err = CBWrite(b, s, "config/issuers", map[string]interface{}{
+		"default": "partner",
+	})
+	require.NoError(t, err)
+	_, err = CBWrite(b, s, "issue/internal", map[string]interface{}{
+		"common_name": "default.example.com",
+	})
+	require.ErrorContains(t, err, "allowed_issuers")
+
+	// Roles without allowed_issuers may issue from any issuer.
+	_, err = CBWrite(b, s, "roles/any", map[string]interface{}{
+		"allow_any_name": true,
+		"key_type":       "ec",
+		"ttl":            "1h",
+	})
+	require.NoError(t, err)
+	resp, err = CBWrite(b, s, "issuer/internal/issue/any", map[string]interface{}{
+		"common_name": "any.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+}
+
+func TestIssueSignValidate(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rootId := resp.Data["issuer_id"].(issuerID)
+
+	_, err = CBWrite(b, s, "config/urls", map[string]interface{}{
+		"crl_distribution_points": "http://localhost/v1/pki/crl",
+	})
+	require.NoError(t, err)
+
+	_, err = CBWrite(b, s, "roles/test", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"key_type":         "ec",
+		"ttl":              "1h",
+	})
+	require.NoError(t, err)
+
+	before, err := CBList(b, s, "certs")
+	require.NoError(t, err)
+
+	resp, err = CBWrite(b, s, "issue/test/validate", map[string]interface{}{
+		"common_name": "www.example.com",
+		"alt_names":   "api.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, rootId, resp.Data["issuer_id"])
+	require.Equal(t, "www.example.com", resp.Data["common_name"])
+	require.ElementsMatch(t, []string{"www.example.com", "api.example.com"}, resp.Data["dns_names"])
+	require.Equal(t, "ec", resp.Data["key_type"])
+	require.Equal(t, 256, resp.Data["key_bits"])
+	require.Equal(t, []string{"ServerAuth", "ClientAuth"}, resp.Data["ext_key_usage"])
+	require.Contains(t, resp.Data["key_usage"], "DigitalSignature")
+	require.Equal(t, []string{"http://localhost/v1/pki/crl"}, resp.Data["crl_distribution_points"])
+	require.NotContains(t, resp.Data, "certificate")
+	require.NotContains(t, resp.Data, "private_key")
+
+	notAfter, err := time.Parse(time.RFC3339, resp.Data["not_after"].(string))
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(time.Hour), notAfter, time.Minute)
+
+	// Role checks still apply.
+	_, err = CBWrite(b, s, "issue/test/validate", map[string]interface{}{
+		"common_name": "www.example.org",
+	})
+	require.ErrorContains(t, err, "common name www.example.org not allowed")
+	_, err = CBWrite(b, s, "issuer/default/issue/test/validate", map[string]interface{}{
+		"common_name": "www.example.com",
+		"ttl":         "100h",
+	})
+	require.ErrorContains(t, err, "beyond the expiration of the CA certificate")
+
+	// Signing takes the key from the CSR.
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "csr.example.com"},
+	}, key)
+	require.NoError(t, err)
+	csrPem := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}))
+
+	resp, err = CBWrite(b, s, "sign/test/validate", map[string]interface{}{
+		"csr": csrPem,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, "csr.example.com", resp.Data["common_name"])
+	require.Equal(t, "ec", resp.Data["key_type"])
+	require.Equal(t, 384, resp.Data["key_bits"])
+
+	// Roles requiring approval are validated, but nothing is queued.
+	_, err = CBWrite(b, s, "roles/approved", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"key_type":         "ec",
+		"require_approval": true,
+	})
+	require.NoError(t, err)
+	resp, err = CBWrite(b, s, "issuer/default/sign/approved/validate", map[string]interface{}{
+		"csr": csrPem,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.NotEmpty(t, resp.Warnings)
+	_, err = CBWrite(b, s, "issue/approved/validate", map[string]interface{}{
+		"common_name": "www.example.com",
+	})
+	require.ErrorContains(t, err, "requires approval")
+
+	pending, err := CBList(b, s, "sign-requests")
+	require.NoError(t, err)
+	if pending != nil {
+		require.Empty(t, pending.Data["keys"])
+	}
+
+	after, err := CBList(b, s, "certs")
+	require.NoError(t, err)
+	require.Equal(t, before.Data["keys"], after.Data["keys"])
+}
+
+func TestNotBeforeControls(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name":         "root example.com",
+		"key_type":            "ec",
+		"ttl":                 "72h",
+		"not_before_duration": "3h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	resp, err = CBWrite(b, s, "config/mount", map[string]interface{}{
+		"max_not_before_duration": "1h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, int64(3600), resp.Data["max_not_before_duration"])
+
+	// Roles may not backdate further than the mount allows.
+	_, err = CBWrite(b, s, "roles/test", map[string]interface{}{
+		"allow_any_name":      true,
+		"key_type":            "ec",
+		"not_before_duration": "2h",
+	})
+	require.ErrorContains(t, err, "max_not_before_duration")
+
+	_, err = CBWrite(b, s, "roles/test", map[string]interface{}{
+		"allow_any_name":      true,
+		"key_type":            "ec",
+		"not_before_duration": "10m",
+	})
+	require.NoError(t, err)
+
+	resp, err = CBWrite(b, s, "issue/test", map[string]interface{}{
+		"common_name": "example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	cert := parseCert(t, resp.Data["certificate"].(string))
+	require.WithinDuration(t, time.Now().Add(-10*time.Minute), cert.NotBefore, time.Minute)
+
+	// Explicit not_before requires the role to allow it.
+	notBefore := time.Now().Add(-30 * time.Minute).UTC().Truncate(time.Second)
+	_, err = CBWrite(b, s, "issue/test", map[string]interface{}{
+		"common_name": "example.com",
+		"not_before":  notBefore.Format(time.RFC3339),
+	})
+	require.ErrorContains(t, err, "allow_not_before")
+
+	_, err = CBWrite(b, s, "roles/test", map[string]interface{}{
+		"allow_any_name":      true,
+		"key_type":            "ec",
+		"not_before_duration": "10m",
+		"allow_not_before":    true,
+	})
+	require.NoError(t, err)
+
+	resp, err = CBWrite(b, s, "issue/test", map[string]interface{}{
+		"common_name": "example.com",
+		"not_before":  notBefore.Format(time.RFC3339),
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	cert = parseCert(t, resp.Data["certificate"].(string))
+	require.True(t, notBefore.Equal(cert.NotBefore), "expected notBefore %v, got %v", notBefore, cert.NotBefore)
+
+	resp, err = CBWrite(b, s, "issue/test/validate", map[string]interface{}{
+		"common_name": "example.com",
+		"not_before":  notBefore.Format(time.RFC3339),
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, notBefore.Format(time.RFC3339), resp.Data["not_before"])
+
+	_, err = CBWrite(b, s, "issue/test", map[string]interface{}{
+		"common_name": "example.com",
+		"not_before":  time.Now().Add(-90 * time.Minute).UTC().Format(time.RFC3339),
+	})
+	require.ErrorContains(t, err, "max_not_before_duration")
+
+	_, err = CBWrite(b, s, "issue/test", map[string]interface{}{
+		"common_name": "example.com",
+		"not_before":  time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+	})
+	require.ErrorContains(t, err, "future")
+
+	// Roles written before the mount's cap was lowered are held to it.
+	_, err = CBWrite(b, s, "config/mount", map[string]interface{}{
+		"max_not_before_duration": "5m",
+	})
+	require.NoError(t, err)
+
+	resp, err = CBWrite(b, s, "issue/test", map[string]interface{}{
+		"common_name": "example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	cert = parseCert(t, resp.Data["certificate"].(string))
+	require.WithinDuration(t, time.Now().Add(-5*time.Minute), cert.NotBefore, time.Minute)
+}
+
+func TestMountLeafNotAfterBehavior(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "2h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rootCert := parseCert(t, resp.Data["certificate"].(string))
+
+	_, err = CBWrite(b, s, "roles/test", map[string]interface{}{
+		"allow_any_name": true,
+		"key_type":       "ec",
+		"max_ttl":        "10h",
+	})
+	require.NoError(t, err)
+
+	issue := map[string]interface{}{
+		"common_name": "example.com",
+		"ttl":         "5h",
+	}
+
+	// The issuer's default of err applies until the mount overrides it.
+	_, err = CBWrite(b, s, "issue/test", issue)
+	require.ErrorContains(t, err, "beyond the expiration of the CA certificate")
+
+	_, err = CBWrite(b, s, "config/mount", map[string]interface{}{
+		"leaf_not_after_behavior": "sometimes",
+	})
+	require.ErrorContains(t, err, "leaf_not_after_behavior")
+
+	resp, err = CBWrite(b, s, "config/mount", map[string]interface{}{
+		"leaf_not_after_behavior": "truncate",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, "truncate", resp.Data["leaf_not_after_behavior"])
+
+	resp, err = CBWrite(b, s, "issue/test", issue)
+	requireSuccessNonNilResponse(t, resp, err)
+	cert := parseCert(t, resp.Data["certificate"].(string))
+	require.True(t, rootCert.NotAfter.Equal(cert.NotAfter))
+	require.Empty(t, resp.Warnings)
+
+	_, err = CBWrite(b, s, "config/mount", map[string]interface{}{
+		"leaf_not_after_behavior": "permit",
+	})
+	require.NoError(t, err)
+
+	resp, err = CBWrite(b, s, "issue/test", issue)
+	requireSuccessNonNilResponse(t, resp, err)
+	cert = parseCert(t, resp.Data["certificate"].(string))
+	require.True(t, cert.NotAfter.After(rootCert.NotAfter))
+	require.Len(t, resp.Warnings, 1)
+	require.Contains(t, resp.Warnings[0], "beyond that of its issuer")
+
+	resp, err = CBWrite(b, s, "issue/test/validate", issue)
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Len(t, resp.Warnings, 1)
+
+	// Clearing the mount's setting defers to the issuer's again.
+	_, err = CBWrite(b, s, "config/mount", map[string]interface{}{
+		"leaf_not_after_behavior": "",
+	})
+	require.NoError(t, err)
+
+	_, err = CBWrite(b, s, "issue/test", issue)
+	require.ErrorContains(t, err, "beyond the expiration of the CA certificate")
+}
+
+func TestDefaultIssuerFallbacks(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	issuerCerts := make(map[string]*x509.Certificate)
+	for _, name := range []string{"primary", "backup", "gone"} {
+		resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+			"common_name": name + " root example.com",
+			"issuer_name": name,
+			"key_type":    "ec",
+			"ttl":         "72h",
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		issuerCerts[name] = parseCert(t, resp.Data["certificate"].(string))
+	}
+
+	resp, err := CBWrite(b, s, "config/issuers", map[string]interface{}{
+		"default":           "primary",
+		"default_fallbacks": "backup,primary",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	backupId := resp.Data["default_fallbacks"].([]issuerID)[0]
+	require.Equal(t, []issuerID{backupId}, resp.Data["default_fallbacks"])
+
+	_, err = CBWrite(b, s, "config/issuers", map[string]interface{}{
+		"default_fallbacks": "missing",
+	})
+	require.ErrorContains(t, err, "missing")
+
+	// Changing the default keeps the fallbacks.
+	_, err = CBWrite(b, s, "config/issuers", map[string]interface{}{
+		"default": "primary",
+	})
+	require.NoError(t, err)
+	resp, err = CBRead(b, s, "config/issuers")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, []issuerID{backupId}, resp.Data["default_fallbacks"])
+
+	_, err = CBWrite(b, s, "roles/web", map[string]interface{}{
+		"allow_any_name": true,
+		"key_type":       "ec",
+		"ttl":            "1h",
+	})
+	require.NoError(t, err)
+
+	issue := func() (*x509.Certificate, []string) {
+		resp, err := CBWrite(b, s, "issue/web", map[string]interface{}{
+			"common_name": "web.example.com",
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		return parseCert(t, resp.Data["certificate"].(string)), resp.Warnings
+	}
+
+	cert, warnings := issue()
+	require.NoError(t, cert.CheckSignatureFrom(issuerCerts["primary"]))
+	require.Empty(t, warnings)
+
+	// A revocation by a since-deleted issuer, left unassigned.
+	resp, err = CBWrite(b, s, "issuer/gone/issue/web", map[string]interface{}{
+		"common_name": "gone.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	goneSerial := resp.Data["serial_number"].(string)
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": goneSerial,
+	})
+	require.NoError(t, err)
+	_, err = CBDelete(b, s, "issuer/gone")
+	require.NoError(t, err)
+	_, err = CBRead(b, s, "crl/rotate")
+	require.NoError(t, err)
+
+	crl := getParsedCrlFromBackend(t, b, s, "issuer/primary/crl/der")
+	requireSerialNumberInCRL(t, crl.TBSCertList, goneSerial)
+
+	// Once the default can neither issue nor sign CRLs, the fallback
+	// stands in for it.
+	_, err = CBPatch(b, s, "issuer/primary", map[string]interface{}{
+		"usage": "read-only",
+	})
+	require.NoError(t, err)
+
+	cert, warnings = issue()
+	require.NoError(t, cert.CheckSignatureFrom(issuerCerts["backup"]))
+	require.Len(t, warnings, 1)
+	require.Contains(t, warnings[0], "fallback default issuer")
+
+	_, err = CBRead(b, s, "crl/rotate")
+	require.NoError(t, err)
+	crl = getParsedCrlFromBackend(t, b, s, "issuer/backup/crl/der")
+	requireSerialNumberInCRL(t, crl.TBSCertList, goneSerial)
+
+	// Deleting a fallback removes it from the list.
+	_, err = CBDelete(b, s, "issuer/backup")
+	require.NoError(t, err)
+	resp, err = CBRead(b, s, "config/issuers")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Empty(t, resp.Data["default_fallbacks"])
+
+	// Without a usable fallback, the default's own error is reported.
+	_, err = CBWrite(b, s, "issue/web", map[string]interface{}{
+		"common_name": "web.example.com",
+	})
+	require.ErrorContains(t, err, "usage")
+}
+
+func TestGenerateIntermediateManagedKey(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	// The key lives in the managed key, so is referenced rather than
+	// described.
+	_, err := CBWrite(b, s, "intermediate/generate/kms", map[string]interface{}{
+		"common_name": "int example.com",
+	})
+	require.ErrorContains(t, err, "missing argument managed_key_name or managed_key_id")
+
+	_, err = CBWrite(b, s, "intermediate/generate/kms", map[string]interface{}{
+		"common_name":      "int example.com",
+		"managed_key_name": "hsm",
+		"managed_key_id":   "de4e0b23-2a5b-4e0b-a5a4-fb5c1eb5c2b6",
+	})
+	require.ErrorContains(t, err, "only one argument")
+
+	_, err = CBWrite(b, s, "intermediate/generate/kms", map[string]interface{}{
+		"common_name":      "int example.com",
+		"managed_key_name": "hsm",
+		"key_type":         "ec",
+	})
+	require.ErrorContains(t, err, "key_type nor key_bits")
+
+	// Nothing is stored when the managed key can't be used.
+	_, err = CBWrite(b, s, "intermediate/generate/kms", map[string]interface{}{
+		"common_name":      "int example.com",
+		"managed_key_name": "hsm",
+	})
+	require.Error(t, err)
+	resp, err := CBList(b, s, "keys")
+	require.NoError(t, err)
+	require.Empty(t, resp.Data["keys"])
+
+	// Cloud KMS keys on the mount are referenced by name.
+	var signatures int32
+	server, kmsKey := newFakeAWSKMS(t, &signatures)
+	resp, err = CBWrite(b, s, "keys/import/cloud-kms", map[string]interface{}{
+		"key_name":   "cloud",
+		"provider":   "aws",
+		"kms_key":    "alias/pki-int",
+		"region":     "us-east-1",
+		"endpoint":   server.URL,
+		"access_key": "AKIAEXAMPLE",
+		"secret_key": "secret",
+	})
+	requireSuccessNonNilResponse(t, resp, err, "failed importing cloud KMS key")
+	keyId := resp.Data["key_id"].(keyID)
+
+	resp, err = CBWrite(b, s, "intermediate/generate/kms", map[string]interface{}{
+		"common_name":      "int example.com",
+		"managed_key_name": "cloud",
+	})
+	requireSuccessNonNilResponse(t, resp, err, "failed generating intermediate with cloud KMS key")
+	require.Equal(t, keyId, resp.Data["key_id"])
+	require.NotContains(t, resp.Data, "private_key")
+	csrPem := resp.Data["csr"].(string)
+	block, _ := pem.Decode([]byte(csrPem))
+	require.NotNil(t, block)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	require.NoError(t, err)
+	require.NoError(t, csr.CheckSignature())
+	equal, err := certutil.ComparePublicKeysAndType(csr.PublicKey, kmsKey.Public())
+	require.NoError(t, err)
+	require.True(t, equal, "CSR's public key doesn't match the cloud KMS key")
+
+	// Once signed elsewhere and imported, leaves and CRLs are signed by the
+	// cloud KMS key.
+	bRoot, sRoot := createBackendWithStorage(t)
+	resp, err = CBWrite(bRoot, sRoot, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	root := parseCert(t, resp.Data["certificate"].(string))
+
+	resp, err = CBWrite(bRoot, sRoot, "root/sign-intermediate", map[string]interface{}{
+		"csr": csrPem,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	intCert := resp.Data["certificate"].(string)
+	intermediate := parseCert(t, intCert)
+	require.NoError(t, intermediate.CheckSignatureFrom(root))
+
+	resp, err = CBWrite(b, s, "intermediate/set-signed", map[string]interface{}{
+		"certificate": intCert,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Len(t, resp.Data["imported_issuers"], 1)
+
+	_, err = CBWrite(b, s, "roles/example", map[string]interface{}{
+		"allow_any_name": true,
+		"key_type":       "ec",
+		"ttl":            "1h",
+	})
+	require.NoError(t, err)
+
+	before := atomic.LoadInt32(&signatures)
+	resp, err = CBWrite(b, s, "issue/example", map[string]interface{}{
+		"common_name": "leaf.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	leaf := parseCert(t, resp.Data["certificate"].(string))
+	require.NoError(t, leaf.CheckSignatureFrom(intermediate))
+
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": resp.Data["serial_number"],
+	})
+	require.NoError(t, err)
+
+	crl := getParsedCrlFromBackend(t, b, s, "crl")
+	require.NoError(t, intermediate.CheckCRLSignature(crl))
+	require.Len(t, crl.TBSCertList.RevokedCertificates, 1)
+	require.GreaterOrEqual(t, atomic.LoadInt32(&signatures)-before, int32(2))
+}
+
+func TestIssuerRotateKeyWorkflow(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root x1",
+		"issuer_name": "root-x1",
+		"key_type":    "ec",
+		"ttl":         "96h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	resp, err = CBWrite(b, s, "intermediate/generate/internal", map[string]interface{}{
+		"common_name": "int x1",
+		"key_type":    "ec",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	resp, err = CBWrite(b, s, "issuer/root-x1/sign-intermediate", map[string]interface{}{
+		"csr":            resp.Data["csr"],
+		"use_csr_values": true,
+		"ttl":            "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	resp, err = CBWrite(b, s, "intermediate/set-signed", map[string]interface{}{
+		"certificate": resp.Data["certificate"],
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	intID := issuerID(resp.Data["imported_issuers"].([]string)[0])
+	_, err = CBPatch(b, s, "issuer/"+intID.String(), map[string]interface{}{
+		"issuer_name": "int-x1",
+	})
+	require.NoError(t, err)
+
+	resp, err = CBRead(b, s, "issuer/int-x1")
+	requireSuccessNonNilResponse(t, resp, err)
+	oldKeyID := resp.Data["key_id"].(keyID)
+	intCert := parseCert(t, resp.Data["certificate"].(string))
+
+	_, err = CBWrite(b, s, "roles/leaf", map[string]interface{}{
+		"allow_any_name": true,
+		"issuer_ref":     "int-x1",
+	})
+	require.NoError(t, err)
+	resp, err = CBWrite(b, s, "issue/leaf", map[string]interface{}{
+		"common_name": "before.example.com",
+		"ttl":         "1h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	oldLeafSerial := resp.Data["serial_number"].(string)
+	resp, err = CBWrite(b, s, "issue/leaf", map[string]interface{}{
+		"common_name": "revoked-before.example.com",
+		"ttl":         "1h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	revokedBeforeSerial := resp.Data["serial_number"].(string)
+	resp, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": revokedBeforeSerial,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	sc := b.makeStorageContext(context.Background(), s)
+	crlConfig, err := sc.getLocalCRLConfig()
+	require.NoError(t, err)
+	intCRLID := crlConfig.IssuerIDCRLMap[intID]
+	require.NotEmpty(t, intCRLID)
+
+	// Importing without a pending key fails.
+	_, err = CBWrite(b, s, "issuer/int-x1/rotate-key/import", map[string]interface{}{
+		"certificate": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: intCert.Raw})),
+	})
+	require.ErrorContains(t, err, "no pending key")
+
+	resp, err = CBWrite(b, s, "issuer/int-x1/rotate-key/generate/internal", map[string]interface{}{})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, intID, resp.Data["issuer_id"])
+	newKeyID := resp.Data["key_id"].(keyID)
+	require.NotEqual(t, oldKeyID, newKeyID)
+	require.NotContains(t, resp.Data, "private_key")
+	block, _ := pem.Decode([]byte(resp.Data["csr"].(string)))
+	require.NotNil(t, block)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	require.NoError(t, err)
+	require.Equal(t, intCert.RawSubject, csr.RawSubject)
+	require.Equal(t, x509.ECDSA, csr.PublicKeyAlgorithm)
+
+	// The pending key can't be deleted out from under the rotation, and
+	// the issuer keeps issuing with its current key until the import.
+	_, err = CBDelete(b, s, "key/"+newKeyID.String())
+	require.Error(t, err)
+	resp, err = CBRead(b, s, "issuer/int-x1")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, oldKeyID, resp.Data["key_id"])
+	require.Equal(t, newKeyID, resp.Data["pending_key_id"])
+
+	resp, err = CBWrite(b, s, "issuer/root-x1/sign-intermediate", map[string]interface{}{
+		"csr":            string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr.Raw})),
+		"use_csr_values": true,
+		"ttl":            "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rotatedPem := resp.Data["certificate"].(string)
+
+	// A certificate over another key is rejected.
+	_, err = CBWrite(b, s, "issuer/int-x1/rotate-key/import", map[string]interface{}{
+		"certificate": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: intCert.Raw})),
+	})
+	require.ErrorContains(t, err, "pending key")
+
+	// Retrying after an attempt which failed past creating the previous
+	// issuer reuses it.
+	intEntry, err := sc.fetchIssuerById(intID)
+	require.NoError(t, err)
+	partial := *intEntry
+	partial.ID = genIssuerId()
+	partial.Name = ""
+	partial.PendingKeyID = ""
+	partial.RotatedFrom = intID
+	partial.Usage.ToggleUsage(IssuanceUsage)
+	require.NoError(t, sc.writeIssuer(&partial))
+
+	resp, err = CBWrite(b, s, "issuer/int-x1/rotate-key/import", map[string]interface{}{
+		"certificate": rotatedPem,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, intID, resp.Data["issuer_id"])
+	require.Equal(t, "int-x1", resp.Data["issuer_name"])
+	require.Equal(t, newKeyID, resp.Data["key_id"])
+	require.Empty(t, resp.Data["pending_key_id"])
+	previousID := resp.Data["previous_issuer_id"].(issuerID)
+	require.Equal(t, partial.ID, previousID)
+	issuers, err := sc.listIssuers()
+	require.NoError(t, err)
+	require.Len(t, issuers, 3)
+
+	// The previous certificate and key remain, but no longer issue.
+	resp, err = CBRead(b, s, "issuer/"+previousID.String())
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, oldKeyID, resp.Data["key_id"])
+	require.NotContains(t, resp.Data["usage"], "issuing-certificates")
+
+	// The issuer keeps its CRL, now signed with the new key.
+	crlConfig, err = sc.getLocalCRLConfig()
+	require.NoError(t, err)
+	require.Equal(t, intCRLID, crlConfig.IssuerIDCRLMap[intID])
+	require.NotEqual(t, intCRLID, crlConfig.IssuerIDCRLMap[previousID])
+
+	rotated := parseCert(t, rotatedPem)
+	crl := getParsedCrlFromBackend(t, b, s, "issuer/int-x1/crl/der")
+	require.NoError(t, rotated.CheckCRLSignature(crl))
+	require.Empty(t, crl.TBSCertList.RevokedCertificates)
+
+	// Revocations recorded before the rotation moved to the previous
+	// issuer, along with its key.
+	revEntry, err := fetchCertBySerial(sc.Context, b, &logical.Request{Storage: s}, revokedPath, revokedBeforeSerial)
+	require.NoError(t, err)
+	var revInfo revocationInfo
+	require.NoError(t, revEntry.DecodeJSON(&revInfo))
+	require.Equal(t, previousID, revInfo.CertificateIssuer)
+	crl = getParsedCrlFromBackend(t, b, s, "issuer/"+previousID.String()+"/crl/der")
+	require.NoError(t, intCert.CheckCRLSignature(crl))
+	require.Len(t, crl.TBSCertList.RevokedCertificates, 1)
+
+	// Roles referencing the issuer now issue from the new key, and
+	// certificates from the previous key can still be revoked.
+	resp, err = CBWrite(b, s, "issue/leaf", map[string]interface{}{
+		"common_name": "after.example.com",
+		"ttl":         "1h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	leaf := parseCert(t, resp.Data["certificate"].(string))
+	require.NoError(t, leaf.CheckSignatureFrom(rotated))
+
+	resp, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": oldLeafSerial,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	crl = getParsedCrlFromBackend(t, b, s, "issuer/"+previousID.String()+"/crl/der")
+	require.NoError(t, intCert.CheckCRLSignature(crl))
+	require.Len(t, crl.TBSCertList.RevokedCertificates, 2)
+}
+
+func TestPKI_PKCS7Format(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	requirePKCS7 := func(bundle string, expected ...*x509.Certificate) {
+		block, rest := pem.Decode([]byte(bundle))
+		require.NotNil(t, block, "expected a PEM encoded PKCS#7 bundle: %v", bundle)
+		require.Equal(t, "PKCS7", block.Type)
+		require.Empty(t, rest)
+
+		p7, err := pkcs7.Parse(block.Bytes)
+		require.NoError(t, err)
+		require.Len(t, p7.Certificates, len(expected))
+		for i, cert := range expected {
+			require.Equal(t, cert.Raw, p7.Certificates[i].Raw)
+		}
+	}
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "Root X1",
+		"ttl":         "720h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	root := parseCert(t, resp.Data["certificate"].(string))
+
+	// Generation has no chain to bundle, so doesn't offer the format.
+	_, err = CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "Root X2",
+		"format":      "pkcs7",
+	})
+	require.ErrorContains(t, err, `must be "pem", "der", or "pem_bundle"`)
+	require.NotContains(t, pathGenerateRoot(b).Fields["format"].AllowedValues, "pkcs7")
+	require.NotContains(t, pathGenerateIntermediate(b).Fields["format"].AllowedValues, "pkcs7")
+	require.Contains(t, pathSignIntermediate(b).Fields["format"].AllowedValues, "pkcs7")
+	require.Contains(t, pathIssue(b).Fields["format"].AllowedValues, "pkcs7")
+
+	resp, err = CBWrite(b, s, "intermediate/generate/internal", map[string]interface{}{
+		"common_name": "Int X1",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	csr := resp.Data["csr"].(string)
+
+	resp, err = CBWrite(b, s, "root/sign-intermediate", map[string]interface{}{
+		"csr":    csr,
+		"format": "pkcs7",
+		"ttl":    "360h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	p7Block, _ := pem.Decode([]byte(resp.Data["certificate"].(string)))
+	require.NotNil(t, p7Block)
+	p7, err := pkcs7.Parse(p7Block.Bytes)
+	require.NoError(t, err)
+	require.Len(t, p7.Certificates, 2)
+	intCert := p7.Certificates[0]
+	requirePKCS7(resp.Data["certificate"].(string), intCert, root)
+	require.Equal(t, strings.TrimSpace(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}))), resp.Data["issuing_ca"])
+
+	resp, err = CBWrite(b, s, "intermediate/set-signed", map[string]interface{}{
+		"certificate": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: intCert.Raw})),
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	intId := resp.Data["imported_issuers"].([]string)[0]
+	_, err = CBWrite(b, s, "config/issuers", map[string]interface{}{"default": intId})
+	require.NoError(t, err)
+
+	_, err = CBWrite(b, s, "roles/example", map[string]interface{}{
+		"allow_any_name": true,
+		"ttl":            "1h",
+	})
+	require.NoError(t, err)
+
+	// Issued leaves are bundled with their full chain, the private key
+	// being returned separately.
+	resp, err = CBWrite(b, s, "issue/example", map[string]interface{}{
+		"common_name": "leaf.example.com",
+		"format":      "pkcs7",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	block, _ := pem.Decode([]byte(resp.Data["certificate"].(string)))
+	require.NotNil(t, block)
+	p7, err = pkcs7.Parse(block.Bytes)
+	require.NoError(t, err)
+	leaf := p7.Certificates[0]
+	require.Equal(t, "leaf.example.com", leaf.Subject.CommonName)
+	requirePKCS7(resp.Data["certificate"].(string), leaf, intCert, root)
+	require.NotEmpty(t, resp.Data["private_key"])
+	require.Len(t, resp.Data["ca_chain"], 2)
+
+	// As are signed ones.
+	csrKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	leafCSR, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "signed.example.com"},
+	}, csrKey)
+	require.NoError(t, err)
+	resp, err = CBWrite(b, s, "sign/example", map[string]interface{}{
+		"csr":    string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: leafCSR})),
+		"format": "pkcs7",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	block, _ = pem.Decode([]byte(resp.Data["certificate"].(string)))
+	require.NotNil(t, block)
+	p7, err = pkcs7.Parse(block.Bytes)
+	require.NoError(t, err)
+	requirePKCS7(resp.Data["certificate"].(string), p7.Certificates[0], intCert, root)
+	require.NotContains(t, resp.Data, "private_key")
+
+	// The default issuer's chain, as JSON and raw.
+	resp, err = CBReq(b, s, logical.ReadOperation, "cert/ca_chain", map[string]interface{}{"format": "pkcs7"})
+	requireSuccessNonNilResponse(t, resp, err)
+	requirePKCS7(resp.Data["certificate"].(string), intCert, root)
+	require.Equal(t, resp.Data["certificate"], resp.Data["ca_chain"])
+
+	resp, err = CBReq(b, s, logical.ReadOperation, "ca_chain", map[string]interface{}{"format": "pkcs7"})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, "application/x-pkcs7-certificates", resp.Data[logical.HTTPContentType])
+	p7, err = pkcs7.Parse(resp.Data[logical.HTTPRawBody].([]byte))
+	require.NoError(t, err)
+	require.Len(t, p7.Certificates, 2)
+
+	resp, err = CBReq(b, s, logical.ReadOperation, "ca_chain", map[string]interface{}{})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, "application/pkix-cert", resp.Data[logical.HTTPContentType])
+}
+
+func BenchmarkIssuance(bench *testing.B) {
+	b, s := createBackendWithStorage(bench)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"issuer_name": "root",
+		"ttl":         "48h",
+	})
+	if err != nil || resp == nil {
+		bench.Fatalf("failed generating root: %v", err)
+	}
+	_, err = CBWrite(b, s, "roles/bench", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"issuer_ref":       "root",
+		"key_type":         "ec",
+		"ttl":              "1h",
+	})
+	if err != nil {
+		bench.Fatalf("failed writing role: %v", err)
+	}
+
+	bench.ResetTimer()
+	bench.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			resp, err := CBWrite(b, s, "issue/bench", map[string]interface{}{
+				"common_name": "www.example.com",
+			})
+			if err != nil || resp == nil {
+				bench.Errorf("failed issuing certificate: %v", err)
+				return
+			}
+		}
+	})
+}
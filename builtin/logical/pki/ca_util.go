@@ -32,7 +32,7 @@ func getGenerationParams(sc *storageContext, data *framework.FieldData) (exporte
 	}
 
 	format = getFormat(data)
-	if format == "" {
+	if format == "" || format == "pkcs7" {
 		errorResp = logical.ErrorResponse(
 			`the "format" path parameter must be "pem", "der", or "pem_bundle"`)
 		return
@@ -86,7 +86,11 @@ func generateCABundle(sc *storageContext, input *inputBundle, data *certutil.Cre
 		if err != nil {
 			return nil, err
 		}
-		return generateManagedKeyCABundle(ctx, b, keyId, data, randomSource)
+		keyId, err = sc.resolveCloudKMSKeyId(keyId)
+		if err != nil {
+			return nil, err
+		}
+		return generateAnyManagedKeyCABundle(ctx, b, keyId, data, randomSource)
 	}
 
 	if existingKeyRequested(input) {
@@ -101,11 +105,11 @@ func generateCABundle(sc *storageContext, input *inputBundle, data *certutil.Cre
 		}
 
 		if keyEntry.isManagedPrivateKey() {
-			keyId, err := keyEntry.getManagedKeyUUID()
+			keyId, err := keyEntry.getManagedKeyRef()
 			if err != nil {
 				return nil, err
 			}
-			return generateManagedKeyCABundle(ctx, b, keyId, data, randomSource)
+			return generateAnyManagedKeyCABundle(ctx, b, keyId, data, randomSource)
 		}
 
 		return certutil.CreateCertificateWithKeyGenerator(data, randomSource, existingKeyGeneratorFromBytes(keyEntry))
@@ -123,8 +127,12 @@ func generateCSRBundle(sc *storageContext, input *inputBundle, data *certutil.Cr
 		if err != nil {
 			return nil, err
 		}
+		keyId, err = sc.resolveCloudKMSKeyId(keyId)
+		if err != nil {
+			return nil, err
+		}
 
-		return generateManagedKeyCSRBundle(ctx, b, keyId, data, addBasicConstraints, randomSource)
+		return generateAnyManagedKeyCSRBundle(ctx, b, keyId, data, addBasicConstraints, randomSource)
 	}
 
 	if existingKeyRequested(input) {
@@ -139,11 +147,11 @@ func generateCSRBundle(sc *storageContext, input *inputBundle, data *certutil.Cr
 		}
 
 		if key.isManagedPrivateKey() {
-			keyId, err := key.getManagedKeyUUID()
+			keyId, err := key.getManagedKeyRef()
 			if err != nil {
 				return nil, err
 			}
-			return generateManagedKeyCSRBundle(ctx, b, keyId, data, addBasicConstraints, randomSource)
+			return generateAnyManagedKeyCSRBundle(ctx, b, keyId, data, addBasicConstraints, randomSource)
 		}
 
 		return certutil.CreateCSRWithKeyGenerator(data, addBasicConstraints, randomSource, existingKeyGeneratorFromBytes(key))
@@ -152,13 +160,42 @@ func generateCSRBundle(sc *storageContext, input *inputBundle, data *certutil.Cr
 	return certutil.CreateCSRWithRandomSource(data, addBasicConstraints, randomSource)
 }
 
+// parseCABundle parses a stored CA bundle. Its PrivateKey is always a
+// crypto.Signer: for software keys, one parsed from the stored key; for
+// managed keys (PKCS#11 HSMs, cloud KMS), one backed by the managed key
+// itself, so that callers (issuance, CRL and OCSP signing) share a single
+// code path and never need the raw private key.
 func parseCABundle(ctx context.Context, b *backend, bundle *certutil.CertBundle) (*certutil.ParsedCertBundle, error) {
 	if bundle.PrivateKeyType == certutil.ManagedPrivateKey {
-		return parseManagedKeyCABundle(ctx, b, bundle)
+		return bundle.ToParsedCertBundleWithExtractor(managedKeySignerExtractor(ctx, b))
 	}
 	return bundle.ToParsedCertBundle()
 }
 
+// managedKeySignerExtractor sets the parsed bundle's private key to a
+// signer backed by the managed key referenced from the bundle.
+func managedKeySignerExtractor(ctx context.Context, b *backend) certutil.PrivateKeyExtractor {
+	return func(c *certutil.CertBundle, parsedBundle *certutil.ParsedCertBundle) error {
+		if len(c.PrivateKey) == 0 {
+			return nil
+		}
+
+		keyId, err := extractAnyManagedKeyId([]byte(c.PrivateKey))
+		if err != nil {
+			return fmt.Errorf("unable to determine managed key id: %w", err)
+		}
+
+		signer, err := getAnyManagedKeySigner(ctx, b, keyId)
+		if err != nil {
+			return fmt.Errorf("unable to load signer for managed key %v: %w", keyId, err)
+		}
+
+		parsedBundle.PrivateKeyType = certutil.ManagedPrivateKey
+		parsedBundle.PrivateKey = signer
+		return nil
+	}
+}
+
 func (sc *storageContext) getKeyTypeAndBitsForRole(data *framework.FieldData) (string, int, error) {
 	exportedStr := data.Get("exported").(string)
 	var keyType string
@@ -187,8 +224,12 @@ func (sc *storageContext) getKeyTypeAndBitsForRole(data *framework.FieldData) (s
 		if err != nil {
 			return "", 0, errors.New("unable to determine managed key id" + err.Error())
 		}
+		keyId, err = sc.resolveCloudKMSKeyId(keyId)
+		if err != nil {
+			return "", 0, err
+		}
 
-		pubKeyManagedKey, err := getManagedKeyPublicKey(sc.Context, sc.Backend, keyId)
+		pubKeyManagedKey, err := getAnyManagedKeyPublicKey(sc.Context, sc.Backend, keyId)
 		if err != nil {
 			return "", 0, errors.New("failed to lookup public key from managed key: " + err.Error())
 		}
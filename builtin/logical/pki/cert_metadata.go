@@ -0,0 +1,305 @@
+package pki
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// Finding the certificates issued for a given name otherwise requires
+// listing, loading and parsing every entry under certs/. Alongside each
+// stored certificate, a summary of its issuance is kept under
+// cert-metadata/entries/, and indexed:
+//
+//   - by name (common name and every SAN, lower-cased and hashed so that
+//     any value makes for a valid storage key), under cert-metadata/names/,
+//     and
+//   - by the UTC day of its NotAfter, under cert-metadata/expiry/,
+//
+// with one empty entry per serial number under each. Serial number prefixes
+// are matched by listing cert-metadata/entries/.
+//
+// Certificates stored before the metadata store existed are summarized once
+// by buildCertMetadataIfRequired; the requester and role of those are
+// unknown.
+const (
+	certMetadataPath       = "cert-metadata/"
+	certMetadataEntryPath  = certMetadataPath + "entries/"
+	certMetadataNamePath   = certMetadataPath + "names/"
+	certMetadataExpiryPath = certMetadataPath + "expiry/"
+	certMetadataReadyPath  = certMetadataPath + "ready"
+
+	certMetadataExpiryLayout = "20060102"
+)
+
+// certMetadata summarizes the issuance of a stored certificate.
+type certMetadata struct {
+	SerialNumber         string    `json:"serial_number"`
+	IssuerID             issuerID  `json:"issuer_id,omitempty"`
+	Role                 string    `json:"role,omitempty"`
+	RequesterEntityID    string    `json:"requester_entity_id,omitempty"`
+	RequesterDisplayName string    `json:"requester_display_name,omitempty"`
+	CommonName           string    `json:"common_name"`
+	DNSNames             []string  `json:"dns_names,omitempty"`
+	IPAddresses          []string  `json:"ip_addresses,omitempty"`
+	EmailAddresses       []string  `json:"email_addresses,omitempty"`
+	URIs                 []string  `json:"uri_sans,omitempty"`
+	NotBefore            time.Time `json:"not_before"`
+	NotAfter             time.Time `json:"not_after"`
+	IssuedAt             time.Time `json:"issued_at,omitempty"`
+	RenewedFrom          string    `json:"renewed_from,omitempty"`
+	RenewedBy            string    `json:"renewed_by,omitempty"`
+	CRLPartition         string    `json:"crl_partition,omitempty"`
+}
+
+// newCertMetadata summarizes cert, issued by issuer through role (either of
+// which may be empty) in response to req (which may be nil).
+func newCertMetadata(cert *x509.Certificate, issuer issuerID, role string, req *logical.Request) *certMetadata {
+	meta := &certMetadata{
+		SerialNumber:   serialFromCert(cert),
+		IssuerID:       issuer,
+		Role:           role,
+		CommonName:     cert.Subject.CommonName,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		NotBefore:      cert.NotBefore.UTC(),
+		NotAfter:       cert.NotAfter.UTC(),
+	}
+	for _, ip := range cert.IPAddresses {
+		meta.IPAddresses = append(meta.IPAddresses, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		meta.URIs = append(meta.URIs, uri.String())
+	}
+	if req != nil {
+		meta.RequesterEntityID = req.EntityID
+		meta.RequesterDisplayName = req.DisplayName
+		meta.IssuedAt = time.Now().UTC()
+	}
+	return meta
+}
+
+// sans returns all of the certificate's subject alternative names.
+func (m *certMetadata) sans() []string {
+	var sans []string
+	sans = append(sans, m.DNSNames...)
+	sans = append(sans, m.IPAddresses...)
+	sans = append(sans, m.EmailAddresses...)
+	sans = append(sans, m.URIs...)
+	return sans
+}
+
+// names returns the distinct index keys of the certificate's common name
+// and subject alternative names.
+func (m *certMetadata) names() []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, name := range append([]string{m.CommonName}, m.sans()...) {
+		if name == "" {
+			continue
+		}
+		key := certMetadataNameKey(name)
+		if !seen[key] {
+			seen[key] = true
+			names = append(names, key)
+		}
+	}
+	return names
+}
+
+func (m *certMetadata) hasSAN(san string) bool {
+	for _, value := range m.sans() {
+		if strings.EqualFold(value, san) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *certMetadata) toResponseData() map[string]interface{} {
+	data := map[string]interface{}{
+		"serial_number":          m.SerialNumber,
+		"issuer_id":              m.IssuerID,
+		"role":                   m.Role,
+		"requester_entity_id":    m.RequesterEntityID,
+		"requester_display_name": m.RequesterDisplayName,
+		"common_name":            m.CommonName,
+		"dns_names":              nonNilStrings(m.DNSNames),
+		"ip_addresses":           nonNilStrings(m.IPAddresses),
+		"email_addresses":        nonNilStrings(m.EmailAddresses),
+		"uri_sans":               nonNilStrings(m.URIs),
+		"not_before":             m.NotBefore.Format(time.RFC3339),
+		"not_after":              m.NotAfter.Format(time.RFC3339),
+	}
+	if !m.IssuedAt.IsZero() {
+		data["issued_at"] = m.IssuedAt.Format(time.RFC3339)
+	}
+	if m.RenewedFrom != "" {
+		data["renewed_from"] = m.RenewedFrom
+	}
+	if m.RenewedBy != "" {
+		data["renewed_by"] = m.RenewedBy
+	}
+	return data
+}
+
+// certMetadataNameKey returns the index key for a common name or SAN.
+func certMetadataNameKey(name string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(name))))
+	return hex.EncodeToString(sum[:])
+}
+
+func certMetadataExpiryKey(notAfter time.Time) string {
+	return notAfter.UTC().Format(certMetadataExpiryLayout)
+}
+
+// certMetadataSerialKey returns the storage form of a serial number, in
+// either its colon- or hyphen-separated form.
+func certMetadataSerialKey(serial string) string {
+	return strings.ToLower(strings.ReplaceAll(serial, ":", "-"))
+}
+
+// writeCertMetadata stores and indexes the metadata of a certificate. It
+// should be written before the certificate itself, so that
+// buildCertMetadataIfRequired never summarizes a newly issued certificate
+// in its place.
+func (sc *storageContext) writeCertMetadata(meta *certMetadata) error {
+	serial := certMetadataSerialKey(meta.SerialNumber)
+
+	entry, err := logical.StorageEntryJSON(certMetadataEntryPath+serial, meta)
+	if err != nil {
+		return fmt.Errorf("error creating certificate metadata entry: %w", err)
+	}
+	if err := sc.Storage.Put(sc.Context, entry); err != nil {
+		return fmt.Errorf("error saving certificate metadata: %w", err)
+	}
+
+	for _, name := range meta.names() {
+		if err := sc.Storage.Put(sc.Context, &logical.StorageEntry{Key: certMetadataNamePath + name + "/" + serial}); err != nil {
+			return fmt.Errorf("error indexing certificate metadata: %w", err)
+		}
+	}
+	if err := sc.Storage.Put(sc.Context, &logical.StorageEntry{Key: certMetadataExpiryPath + certMetadataExpiryKey(meta.NotAfter) + "/" + serial}); err != nil {
+		return fmt.Errorf("error indexing certificate metadata: %w", err)
+	}
+
+	return nil
+}
+
+func (sc *storageContext) fetchCertMetadata(serial string) (*certMetadata, error) {
+	entry, err := sc.Storage.Get(sc.Context, certMetadataEntryPath+certMetadataSerialKey(serial))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching certificate metadata: %w", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var meta certMetadata
+	if err := entry.DecodeJSON(&meta); err != nil {
+		return nil, fmt.Errorf("error decoding certificate metadata for serial %v: %w", serial, err)
+	}
+	return &meta, nil
+}
+
+// deleteCertMetadata removes the metadata of a certificate, and its index
+// entries, if present.
+func (sc *storageContext) deleteCertMetadata(serial string) error {
+	meta, err := sc.fetchCertMetadata(serial)
+	if err != nil || meta == nil {
+		return err
+	}
+
+	serial = certMetadataSerialKey(serial)
+	for _, name := range meta.names() {
+		if err := sc.Storage.Delete(sc.Context, certMetadataNamePath+name+"/"+serial); err != nil {
+			return fmt.Errorf("error removing certificate metadata index entry: %w", err)
+		}
+	}
+	if err := sc.Storage.Delete(sc.Context, certMetadataExpiryPath+certMetadataExpiryKey(meta.NotAfter)+"/"+serial); err != nil {
+		return fmt.Errorf("error removing certificate metadata index entry: %w", err)
+	}
+
+	return sc.Storage.Delete(sc.Context, certMetadataEntryPath+serial)
+}
+
+func (sc *storageContext) isCertMetadataReady() (bool, error) {
+	if sc.Backend.certMetadataReady.Load() {
+		return true, nil
+	}
+
+	entry, err := sc.Storage.Get(sc.Context, certMetadataReadyPath)
+	if err != nil {
+		return false, err
+	}
+	if entry == nil {
+		return false, nil
+	}
+
+	// Once built, the store is never removed, so this can be cached.
+	sc.Backend.certMetadataReady.Store(true)
+	return true, nil
+}
+
+// buildCertMetadataIfRequired summarizes every certificate under certs/
+// lacking metadata, if this hasn't been done yet.
+func (b *backend) buildCertMetadataIfRequired(ctx context.Context, storage logical.Storage) error {
+	sc := b.makeStorageContext(ctx, storage)
+	if ready, err := sc.isCertMetadataReady(); err != nil || ready {
+		return err
+	}
+
+	start := time.Now()
+	b.Logger().Info("Building PKI certificate metadata store.")
+
+	serials, err := storage.List(ctx, "certs/")
+	if err != nil {
+		return fmt.Errorf("error fetching list of certs: %w", err)
+	}
+
+	built := 0
+	for _, serial := range serials {
+		if existing, err := sc.fetchCertMetadata(serial); err != nil || existing != nil {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		certEntry, err := storage.Get(ctx, "certs/"+serial)
+		if err != nil {
+			return fmt.Errorf("error fetching certificate %q: %w", serial, err)
+		}
+		if certEntry == nil || len(certEntry.Value) == 0 {
+			continue
+		}
+		cert, err := x509.ParseCertificate(certEntry.Value)
+		if err != nil {
+			b.Logger().Warn("unable to parse stored certificate; skipping it in the certificate metadata store", "serial", serial, "error", err)
+			continue
+		}
+
+		if err := sc.writeCertMetadata(newCertMetadata(cert, "", "", nil)); err != nil {
+			return err
+		}
+		built++
+	}
+
+	err = storage.Put(ctx, &logical.StorageEntry{
+		Key:   certMetadataReadyPath,
+		Value: []byte(time.Now().UTC().Format(time.RFC3339)),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to mark certificate metadata store as built: %w", err)
+	}
+	b.certMetadataReady.Store(true)
+
+	b.Logger().Info("Built PKI certificate metadata store.", "entries", built, "duration", time.Since(start))
+	return nil
+}
@@ -38,6 +38,23 @@ type inputBundle struct {
 	role    *roleEntry
 	req     *logical.Request
 	apiData *framework.FieldData
+
+	// mountIssuancePolicy is the mount-wide issuance policy leaf
+	// certificates are checked against, along with the role's.
+	mountIssuancePolicy string
+
+	// maxNotBeforeDuration, when set, is the furthest the mount lets leaf
+	// certificates be backdated.
+	maxNotBeforeDuration time.Duration
+
+	// ctSubmission, when Certificate Transparency is enabled, submits the
+	// precertificate of a leaf certificate to the configured logs.
+	ctSubmission *ctSubmission
+
+	// csrPossessionVerified is set by callers which verified proof of
+	// possession of the CSR's key themselves, such as CMP, whose requests
+	// carry a CRMF certificate template rather than a signed CSR.
+	csrPossessionVerified bool
 }
 
 var (
@@ -68,6 +85,10 @@ var (
 
 	// OIDs for X.509 certificate extensions used below.
 	oidExtensionSubjectAltName = []int{2, 5, 29, 17}
+
+	// The otherName OID of Microsoft's User Principal Name, used to map
+	// certificates to accounts in smartcard logon.
+	oidUserPrincipalName = "1.3.6.1.4.1.311.20.2.3"
 )
 
 func getFormat(data *framework.FieldData) string {
@@ -76,12 +97,28 @@ func getFormat(data *framework.FieldData) string {
 	case "pem":
 	case "der":
 	case "pem_bundle":
+	case "pkcs7":
 	default:
 		format = ""
 	}
 	return format
 }
 
+// encodePkcs7CertsPEM encodes the certificates as a PEM encoded,
+// degenerate (certs-only) PKCS#7 SignedData: the .p7b bundles Windows and
+// Java deployment tooling expect certificate chains in.
+func encodePkcs7CertsPEM(certs [][]byte) (string, error) {
+	p7, err := encodePkcs7CertsOnly(certs)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode PKCS#7 bundle: %w", err)
+	}
+
+	return strings.TrimSpace(string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PKCS7",
+		Bytes: p7,
+	}))), nil
+}
+
 // fetchCAInfo will fetch the CA info, will return an error if no ca info exists, this does NOT support
 // loading using the legacyBundleShimID and should be used with care. This should be called only once
 // within the request path otherwise you run the risk of a race condition with the issuer migration on perf-secondaries.
@@ -94,7 +131,11 @@ func (sc *storageContext) fetchCAInfo(issuerRef string, usage issuerUsage) (*cer
 		issuerId = legacyBundleShimID
 	} else {
 		var err error
-		issuerId, err = sc.resolveIssuerReference(issuerRef)
+		if issuerRef == defaultRef && usage != ReadOnlyUsage {
+			issuerId, _, err = sc.resolveUsableDefaultIssuer(usage)
+		} else {
+			issuerId, err = sc.resolveIssuerReference(issuerRef)
+		}
 		if err != nil {
 			// Usually a bad label from the user or mis-configured default.
 			return nil, errutil.UserError{Err: err.Error()}
@@ -107,7 +148,7 @@ func (sc *storageContext) fetchCAInfo(issuerRef string, usage issuerUsage) (*cer
 // fetchCAInfoByIssuerId will fetch the CA info, will return an error if no ca info exists for the given issuerId.
 // This does support the loading using the legacyBundleShimID
 func (sc *storageContext) fetchCAInfoByIssuerId(issuerId issuerID, usage issuerUsage) (*certutil.CAInfoBundle, error) {
-	entry, bundle, err := sc.fetchCertBundleByIssuerId(issuerId, true)
+	entry, parsedBundle, err := sc.fetchSigningIssuer(issuerId)
 	if err != nil {
 		switch err.(type) {
 		case errutil.UserError:
@@ -123,11 +164,6 @@ func (sc *storageContext) fetchCAInfoByIssuerId(issuerId issuerID, usage issuerU
 		return nil, errutil.InternalError{Err: fmt.Sprintf("error while attempting to use issuer %v: %v", issuerId, err)}
 	}
 
-	parsedBundle, err := parseCABundle(sc.Context, sc.Backend, bundle)
-	if err != nil {
-		return nil, errutil.InternalError{Err: err.Error()}
-	}
-
 	if parsedBundle.Certificate == nil {
 		return nil, errutil.InternalError{Err: "stored CA information not able to be parsed"}
 	}
@@ -135,11 +171,18 @@ func (sc *storageContext) fetchCAInfoByIssuerId(issuerId issuerID, usage issuerU
 		return nil, errutil.UserError{Err: fmt.Sprintf("unable to fetch corresponding key for issuer %v; unable to use this issuer for signing", issuerId)}
 	}
 
+	serialPrefix, serialBits, err := sc.serialNumberFormat(entry)
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch serial number configuration: %v", err)}
+	}
+
 	caInfo := &certutil.CAInfoBundle{
 		ParsedCertBundle:     *parsedBundle,
 		URLs:                 nil,
 		LeafNotAfterBehavior: entry.LeafNotAfterBehavior,
 		RevocationSigAlg:     entry.RevocationSigAlg,
+		SerialNumberBits:     serialBits,
+		SerialNumberPrefix:   serialPrefix,
 	}
 
 	entries, err := entry.GetAIAURLs(sc)
@@ -634,6 +677,112 @@ func parseOtherSANs(others []string) (map[string][]string, error) {
 	return result, nil
 }
 
+// reservedExtensionOIDs are the extensions Vault sets itself, subject to
+// the role's restrictions, which can't be supplied as custom extensions.
+var reservedExtensionOIDs = map[string]string{
+	"2.5.29.14":         "subject key identifier",
+	"2.5.29.15":         "key usage",
+	"2.5.29.17":         "subject alternative name",
+	"2.5.29.19":         "basic constraints",
+	"2.5.29.30":         "name constraints",
+	"2.5.29.31":         "CRL distribution points",
+	"2.5.29.32":         "certificate policies",
+	"2.5.29.35":         "authority key identifier",
+	"2.5.29.37":         "extended key usage",
+	"1.3.6.1.5.5.7.1.1": "authority information access",
+
+	"1.3.6.1.4.1.11129.2.4.2": "signed certificate timestamp list",
+	"1.3.6.1.4.1.11129.2.4.3": "precertificate poison",
+}
+
+// ocspMustStapleExtension is the RFC 7633 TLS Feature extension carrying
+// status_request (5), which tells clients to require a stapled OCSP
+// response.
+var ocspMustStapleExtension = pkix.Extension{
+	Id:    asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24},
+	Value: []byte{0x30, 0x03, 0x02, 0x01, 0x05},
+}
+
+// validateOCSPMustStaple checks that certificates from the issuer can
+// actually have OCSP responses stapled: they must carry an OCSP server and
+// the mount's responder must not be disabled.
+func validateOCSPMustStaple(sc *storageContext, caInfo *certutil.CAInfoBundle) error {
+	if caInfo.URLs == nil || len(caInfo.URLs.OCSPServers) == 0 {
+		return errutil.UserError{Err: "the role requires OCSP Must-Staple, but the issuer has no OCSP servers configured"}
+	}
+	config, err := sc.Backend.crlBuilder.getConfigWithUpdate(sc)
+	if err != nil {
+		return fmt.Errorf("error fetching revocation configuration: %w", err)
+	}
+	if config.OcspDisable {
+		return errutil.UserError{Err: "the role requires OCSP Must-Staple, but OCSP is disabled on this mount"}
+	}
+	return nil
+}
+
+// parseCustomExtensions parses custom extensions of the form
+// <oid>[;critical]:<base64 DER value>.
+func parseCustomExtensions(input []string) ([]pkix.Extension, error) {
+	var result []pkix.Extension
+	seen := make(map[string]struct{}, len(input))
+	for _, entry := range input {
+		splitValue := strings.SplitN(entry, ":", 2)
+		if len(splitValue) != 2 {
+			return nil, fmt.Errorf("expected a colon in custom extension %q", entry)
+		}
+
+		oidStr, critical := splitValue[0], false
+		if splitOID := strings.SplitN(oidStr, ";", 2); len(splitOID) == 2 {
+			if !strings.EqualFold(splitOID[1], "critical") {
+				return nil, fmt.Errorf("unknown flag %q in custom extension %q", splitOID[1], entry)
+			}
+			oidStr, critical = splitOID[0], true
+		}
+
+		oid, err := certutil.StringToOid(oidStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID in custom extension %q: %w", entry, err)
+		}
+		if _, ok := seen[oidStr]; ok {
+			return nil, fmt.Errorf("custom extension %s was requested more than once", oidStr)
+		}
+		seen[oidStr] = struct{}{}
+
+		value, err := base64.StdEncoding.DecodeString(splitValue[1])
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode the value of custom extension %s as base64: %w", oidStr, err)
+		}
+		var raw asn1.RawValue
+		if rest, err := asn1.Unmarshal(value, &raw); err != nil || len(rest) > 0 {
+			return nil, fmt.Errorf("the value of custom extension %s is not a single DER-encoded value", oidStr)
+		}
+
+		result = append(result, pkix.Extension{Id: oid, Critical: critical, Value: value})
+	}
+
+	return result, nil
+}
+
+// validateCustomExtensions checks if the requested custom extensions are
+// allowed by the role, returning the OID of the first one which isn't, if
+// any.
+func validateCustomExtensions(data *inputBundle, requested []pkix.Extension) string {
+	for _, ext := range requested {
+		oidStr := ext.Id.String()
+		if _, reserved := reservedExtensionOIDs[oidStr]; reserved {
+			return oidStr
+		}
+		if strutil.StrListContains(data.role.DeniedExtensionOIDs, oidStr) {
+			return oidStr
+		}
+		if !strutil.StrListContains(data.role.AllowedExtensionOIDs, "*") && !strutil.StrListContains(data.role.AllowedExtensionOIDs, oidStr) {
+			return oidStr
+		}
+	}
+
+	return ""
+}
+
 func validateSerialNumber(data *inputBundle, serialNumber string) string {
 	valid := false
 	if len(data.role.AllowedSerialNumbers) > 0 {
@@ -662,6 +811,27 @@ func generateCert(sc *storageContext,
 	caSign *certutil.CAInfoBundle,
 	isCA bool,
 	randomSource io.Reader) (*certutil.ParsedCertBundle, error,
+) {
+	data, err := prepareGenerateCert(sc, input, caSign, isCA)
+	if err != nil {
+		return nil, err
+	}
+
+	parsedBundle, err := generateCABundle(sc, input, data, randomSource)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsedBundle, nil
+}
+
+// prepareGenerateCert validates a request to generate a certificate (and
+// its key) against its role and policies, returning the parameters it
+// would be created with.
+func prepareGenerateCert(sc *storageContext,
+	input *inputBundle,
+	caSign *certutil.CAInfoBundle,
+	isCA bool) (*certutil.CreationBundle, error,
 ) {
 	ctx := sc.Context
 	b := sc.Backend
@@ -682,33 +852,83 @@ func generateCert(sc *storageContext,
 		return nil, errutil.InternalError{Err: "nil parameters received from parameter bundle generation"}
 	}
 
+	if !isCA {
+		if err := checkIssuancePolicies(input, data, data.Params.KeyType, data.Params.KeyBits); err != nil {
+			return nil, err
+		}
+	}
+
 	if isCA {
 		data.Params.IsCA = isCA
-		data.Params.PermittedDNSDomains = input.apiData.Get("permitted_dns_domains").([]string)
+		if err := addNameConstraints(input.apiData, data.Params); err != nil {
+			return nil, err
+		}
 
 		if data.SigningBundle == nil {
 			// Generating a self-signed root certificate. Since we have no
-			// issuer entry yet, we default to the global URLs.
+			// issuer entry yet, we default to the global URLs, unless they
+			// are templated on the (yet unknown) issuer.
 			entries, err := getGlobalAIAURLs(ctx, sc.Storage)
 			if err != nil {
 				return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch URL information: %v", err)}
 			}
-			data.Params.URLs = entries
+			data.Params.URLs = &certutil.URLEntries{}
+			if !entries.EnableTemplating {
+				data.Params.URLs, err = entries.toURLEntries(sc, issuerID(""))
+				if err != nil {
+					return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch URL information: %v", err)}
+				}
+			}
 
 			if input.role.MaxPathLength == nil {
 				data.Params.MaxPathLength = -1
 			} else {
 				data.Params.MaxPathLength = *input.role.MaxPathLength
 			}
+
+			// Nor are there issuer serial number settings; use the mount's.
+			data.Params.SerialNumberPrefix, data.Params.SerialNumberBits, err = sc.serialNumberFormat(&issuerEntry{})
+			if err != nil {
+				return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch serial number configuration: %v", err)}
+			}
 		}
 	}
 
-	parsedBundle, err := generateCABundle(sc, input, data, randomSource)
-	if err != nil {
-		return nil, err
+	return data, nil
+}
+
+// addNameConstraints sets the requested name constraints of a CA
+// certificate on its creation parameters.
+func addNameConstraints(apiData *framework.FieldData, params *certutil.CreationParameters) error {
+	params.PermittedDNSDomains = apiData.Get("permitted_dns_domains").([]string)
+	params.ExcludedDNSDomains = apiData.Get("excluded_dns_domains").([]string)
+	params.PermittedEmailAddresses = apiData.Get("permitted_email_addresses").([]string)
+	params.ExcludedEmailAddresses = apiData.Get("excluded_email_addresses").([]string)
+	params.PermittedURIDomains = apiData.Get("permitted_uri_domains").([]string)
+	params.ExcludedURIDomains = apiData.Get("excluded_uri_domains").([]string)
+	params.NonCriticalNameConstraints = !apiData.Get("name_constraints_critical").(bool)
+
+	var err error
+	if params.PermittedIPRanges, err = parseIPRanges(apiData.Get("permitted_ip_ranges").([]string)); err != nil {
+		return errutil.UserError{Err: fmt.Sprintf("invalid permitted_ip_ranges: %v", err)}
+	}
+	if params.ExcludedIPRanges, err = parseIPRanges(apiData.Get("excluded_ip_ranges").([]string)); err != nil {
+		return errutil.UserError{Err: fmt.Sprintf("invalid excluded_ip_ranges: %v", err)}
 	}
 
-	return parsedBundle, nil
+	return nil
+}
+
+func parseIPRanges(ranges []string) ([]*net.IPNet, error) {
+	var result []*net.IPNet
+	for _, cidr := range ranges {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a range in CIDR notation", cidr)
+		}
+		result = append(result, ipNet)
+	}
+	return result, nil
 }
 
 // N.B.: This is only meant to be used for generating intermediate CAs.
@@ -738,6 +958,27 @@ func signCert(b *backend,
 	caSign *certutil.CAInfoBundle,
 	isCA bool,
 	useCSRValues bool) (*certutil.ParsedCertBundle, error,
+) {
+	creation, err := prepareSignCert(b, data, caSign, isCA, useCSRValues)
+	if err != nil {
+		return nil, err
+	}
+
+	parsedBundle, err := certutil.SignCertificate(creation)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsedBundle, nil
+}
+
+// prepareSignCert validates a request to sign a CSR against its role and
+// policies, returning the parameters its certificate would be signed with.
+func prepareSignCert(b *backend,
+	data *inputBundle,
+	caSign *certutil.CAInfoBundle,
+	isCA bool,
+	useCSRValues bool) (*certutil.CreationBundle, error,
 ) {
 	if data.role == nil {
 		return nil, errutil.InternalError{Err: "no role found in data bundle"}
@@ -914,16 +1155,17 @@ func signCert(b *backend,
 	creation.Params.IsCA = isCA
 	creation.Params.UseCSRValues = useCSRValues
 
-	if isCA {
-		creation.Params.PermittedDNSDomains = data.apiData.Get("permitted_dns_domains").([]string)
-	}
+	creation.CSRPossessionVerified = data.csrPossessionVerified
 
-	parsedBundle, err := certutil.SignCertificate(creation)
-	if err != nil {
+	if isCA {
+		if err := addNameConstraints(data.apiData, creation.Params); err != nil {
+			return nil, err
+		}
+	} else if err := checkIssuancePolicies(data, creation, actualKeyType, actualKeyBits); err != nil {
 		return nil, err
 	}
 
-	return parsedBundle, nil
+	return creation, nil
 }
 
 // otherNameRaw describes a name related to a certificate which is not in one
@@ -1045,10 +1287,19 @@ func generateCreationBundle(b *backend, data *inputBundle, caSign *certutil.CAIn
 	dnsNames := []string{}
 	emailAddresses := []string{}
 	{
-		if csr != nil && data.role.UseCSRCommonName {
+		if data.role.CommonNameTemplate != "" {
+			rendered, err := renderSubjectTemplate(b, data, data.role.CommonNameTemplate)
+			if err != nil {
+				return nil, err
+			}
+			cn = rendered
+			if cn == "" && data.role.RequireCN {
+				return nil, errutil.UserError{Err: "the role's common_name_template rendered an empty common name"}
+			}
+		} else if csr != nil && data.role.UseCSRCommonName {
 			cn = csr.Subject.CommonName
 		}
-		if cn == "" {
+		if cn == "" && data.role.CommonNameTemplate == "" {
 			cn = data.apiData.Get("common_name").(string)
 			if cn == "" && data.role.RequireCN {
 				return nil, errutil.UserError{Err: `the common_name field is required, or must be provided in a CSR with "use_csr_common_name" set to true, unless "require_cn" is set to false`}
@@ -1160,6 +1411,11 @@ func generateCreationBundle(b *backend, data *inputBundle, caSign *certutil.CAIn
 	if sans := data.apiData.Get("other_sans").([]string); len(sans) > 0 {
 		otherSANsInput = sans
 	}
+	if upns, ok := data.apiData.GetOk("user_principal_names"); ok {
+		for _, upn := range upns.([]string) {
+			otherSANsInput = append(otherSANsInput, oidUserPrincipalName+";UTF8:"+upn)
+		}
+	}
 	if data.role.UseCSRSANs && csr != nil && len(csr.Extensions) > 0 {
 		others, err := getOtherSANsFromX509Extensions(csr.Extensions)
 		if err != nil {
@@ -1189,6 +1445,23 @@ func generateCreationBundle(b *backend, data *inputBundle, caSign *certutil.CAIn
 		}
 	}
 
+	// Get and verify any custom extensions
+	var customExtensions []pkix.Extension
+	if extsRaw, ok := data.apiData.GetOk("custom_extensions"); ok && len(extsRaw.([]string)) > 0 {
+		requested, err := parseCustomExtensions(extsRaw.([]string))
+		if err != nil {
+			return nil, errutil.UserError{Err: fmt.Errorf("could not parse requested custom extension: %w", err).Error()}
+		}
+		if badOID := validateCustomExtensions(data, requested); len(badOID) > 0 {
+			return nil, errutil.UserError{Err: fmt.Sprintf(
+				"custom extension %s not allowed by this role", badOID)}
+		}
+		customExtensions = requested
+	}
+	if data.role.OCSPMustStaple {
+		customExtensions = append(customExtensions, ocspMustStapleExtension)
+	}
+
 	// Get and verify any IP SANs
 	ipAddresses := []net.IP{}
 	{
@@ -1289,6 +1562,20 @@ func generateCreationBundle(b *backend, data *inputBundle, caSign *certutil.CAIn
 		StreetAddress:      strutil.RemoveDuplicatesStable(data.role.StreetAddress, false),
 		PostalCode:         strutil.RemoveDuplicatesStable(data.role.PostalCode, false),
 	}
+	if len(data.role.OUTemplate) > 0 {
+		ou, err := renderSubjectTemplates(b, data, data.role.OUTemplate)
+		if err != nil {
+			return nil, err
+		}
+		subject.OrganizationalUnit = strutil.RemoveDuplicatesStable(ou, false)
+	}
+	if len(data.role.OrganizationTemplate) > 0 {
+		organization, err := renderSubjectTemplates(b, data, data.role.OrganizationTemplate)
+		if err != nil {
+			return nil, err
+		}
+		subject.Organization = strutil.RemoveDuplicatesStable(organization, false)
+	}
 
 	// Get the TTL and verify it against the max allowed
 	var ttl time.Duration
@@ -1357,6 +1644,41 @@ func generateCreationBundle(b *backend, data *inputBundle, caSign *certutil.CAIn
 		}
 	}
 
+	// Work out how far to backdate the certificate: by the role's
+	// not_before_duration, or to the requested not_before when the role
+	// allows one, within the mount's cap either way.
+	notBeforeDuration := data.role.NotBeforeDuration
+	var notBefore time.Time
+	{
+		notBeforeRaw, ok := data.apiData.GetOk("not_before")
+		if ok && notBeforeRaw.(string) != "" {
+			if !data.role.AllowNotBefore {
+				return nil, errutil.UserError{Err: "not_before may not be set, as the role doesn't have allow_not_before set"}
+			}
+
+			notBefore, err = time.Parse(time.RFC3339, notBeforeRaw.(string))
+			if err != nil {
+				return nil, errutil.UserError{Err: fmt.Sprintf("unable to parse not_before: %v", err)}
+			}
+
+			now := time.Now()
+			if notBefore.After(now) {
+				return nil, errutil.UserError{Err: fmt.Sprintf("not_before %s may not be in the future", notBefore.Format(time.RFC3339))}
+			}
+			if data.maxNotBeforeDuration > 0 && now.Sub(notBefore) > data.maxNotBeforeDuration {
+				return nil, errutil.UserError{Err: fmt.Sprintf("not_before %s is backdated further than the mount's max_not_before_duration of %v", notBefore.Format(time.RFC3339), data.maxNotBeforeDuration)}
+			}
+			if !notBefore.Before(notAfter) {
+				return nil, errutil.UserError{Err: "not_before must be before the certificate's notAfter"}
+			}
+			if caSign != nil && notBefore.Before(caSign.Certificate.NotBefore) {
+				return nil, errutil.UserError{Err: fmt.Sprintf("not_before %s precedes the issuing certificate's notBefore of %s", notBefore.Format(time.RFC3339), caSign.Certificate.NotBefore.Format(time.RFC3339))}
+			}
+		} else if data.maxNotBeforeDuration > 0 && notBeforeDuration > data.maxNotBeforeDuration {
+			notBeforeDuration = data.maxNotBeforeDuration
+		}
+	}
+
 	// Parse SKID from the request for cross-signing.
 	var skid []byte
 	{
@@ -1395,8 +1717,11 @@ func generateCreationBundle(b *backend, data *inputBundle, caSign *certutil.CAIn
 			ExtKeyUsage:                   parseExtKeyUsages(data.role),
 			ExtKeyUsageOIDs:               data.role.ExtKeyUsageOIDs,
 			PolicyIdentifiers:             data.role.PolicyIdentifiers,
+			PolicyIdentifiersCritical:     data.role.PolicyIdentifiersCritical,
+			CustomExtensions:              customExtensions,
 			BasicConstraintsValidForNonCA: data.role.BasicConstraintsValidForNonCA,
-			NotBeforeDuration:             data.role.NotBeforeDuration,
+			NotBeforeDuration:             notBeforeDuration,
+			NotBefore:                     notBefore,
 			ForceAppendCaChain:            caSign != nil,
 			SKID:                          skid,
 		},
@@ -1413,6 +1738,13 @@ func generateCreationBundle(b *backend, data *inputBundle, caSign *certutil.CAIn
 	// This will have been read in from the getGlobalAIAURLs function
 	creation.Params.URLs = caSign.URLs
 
+	creation.Params.SerialNumberBits = caSign.SerialNumberBits
+	creation.Params.SerialNumberPrefix = caSign.SerialNumberPrefix
+
+	if data.ctSubmission != nil {
+		creation.Params.PrecertificateHandler = data.ctSubmission.submit
+	}
+
 	// If the max path length in the role is not nil, it was specified at
 	// generation time with the max_path_length parameter; otherwise derive it
 	// from the signing certificate
@@ -1593,6 +1593,56 @@ var chainBuildingTestCases = []CBTestScenario{
 			CBIssueLeaf{Issuer: "cross-a-b"},
 		},
 	},
+	{
+		// Two roots sharing a subject but not a key, each cross-signed by
+		// the other, as when a root is rotated in place. Each root and its
+		// cross-signed copy form a clique, and the two cliques are each
+		// other's parents without any cycle between them.
+		Steps: []CBTestStep{
+			CBGenerateRoot{
+				Key:        "key-root-a",
+				Name:       "root-a",
+				CommonName: "root",
+			},
+			CBGenerateRoot{
+				Key:        "key-root-b",
+				Name:       "root-b",
+				CommonName: "root",
+			},
+			CBGenerateIntermediate{
+				Key:        "key-root-b",
+				Existing:   true,
+				Name:       "cross-a-b",
+				CommonName: "root",
+				SKID:       "root-b",
+				Parent:     "root-a",
+			},
+			CBGenerateIntermediate{
+				Key:        "key-root-a",
+				Existing:   true,
+				Name:       "cross-b-a",
+				CommonName: "root",
+				SKID:       "root-a",
+				Parent:     "root-b",
+			},
+			CBValidateChain{
+				Chains: map[string][]string{
+					"root-a":    {"self", "cross-b-a", "root-b-clique", "root-b-clique"},
+					"cross-b-a": {"self", "root-b-clique", "root-b-clique", "root-a"},
+					"root-b":    {"self", "cross-a-b", "root-a-clique", "root-a-clique"},
+					"cross-a-b": {"self", "root-a-clique", "root-a-clique", "root-b"},
+				},
+				Aliases: map[string]string{
+					"root-a-clique": "root-a,cross-b-a",
+					"root-b-clique": "root-b,cross-a-b",
+				},
+			},
+			CBIssueLeaf{Issuer: "root-a"},
+			CBIssueLeaf{Issuer: "root-b"},
+			CBIssueLeaf{Issuer: "cross-a-b"},
+			CBIssueLeaf{Issuer: "cross-b-a"},
+		},
+	},
 }
 
 func Test_CAChainBuilding(t *testing.T) {
@@ -590,6 +590,26 @@ func processAnyCliqueOrCycle(
 					closure[cycleNode] = true
 				}
 			}
+
+			// Cliques can also be each other's parents without any cycle
+			// between them: two roots sharing a subject but not a key, each
+			// cross-signed by the other, form two cliques (each root with
+			// its cross-signed copy) that must be processed together.
+			for _, cliqueNode := range cliqueNodes {
+				for _, parent := range issuerIdParentsMap[cliqueNode] {
+					parentCliqueId, ok := issuerIdCliqueMap[parent]
+					if !ok || parentCliqueId == cliqueId {
+						continue
+					}
+
+					for _, parentCliqueNode := range allCliques[parentCliqueId] {
+						if containsAnyIssuer(issuerIdParentsMap[parentCliqueNode], cliqueNodes) {
+							cliquesToProcess = append(cliquesToProcess, parent)
+							break
+						}
+					}
+				}
+			}
 		}
 
 		// Before we begin, we need to compute the _parents_ of the nodes in
@@ -644,7 +664,15 @@ func processAnyCliqueOrCycle(
 					includedParentCerts[entry.Certificate] = true
 
 					// First add nodes from this clique, then all cycles, and then
-					// all other cliques.
+					// all other cliques. A cross-signed copy on the clique was
+					// signed by another clique, though, so that one goes first.
+					if !containsAnyIssuer(issuerIdParentsMap[node], clique) {
+						for _, otherClique := range cliques {
+							if !containsIssuer(otherClique, node) {
+								addNodeCertsToEntry(issuerIdEntryMap, issuerIdChildrenMap, includedParentCerts, entry, otherClique)
+							}
+						}
+					}
 					addNodeCertsToEntry(issuerIdEntryMap, issuerIdChildrenMap, includedParentCerts, entry, clique)
 					addNodeCertsToEntry(issuerIdEntryMap, issuerIdChildrenMap, includedParentCerts, entry, cycles...)
 					addNodeCertsToEntry(issuerIdEntryMap, issuerIdChildrenMap, includedParentCerts, entry, cliques...)
@@ -936,6 +964,16 @@ func containsIssuer(collection []issuerID, target issuerID) bool {
 	return false
 }
 
+func containsAnyIssuer(collection []issuerID, targets []issuerID) bool {
+	for _, target := range targets {
+		if containsIssuer(collection, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func appendCycleIfNotExisting(knownCycles [][]issuerID, candidate []issuerID) [][]issuerID {
 	// There's two ways to do cycle detection: canonicalize the cycles,
 	// rewriting them to have the least (or max) element first or just
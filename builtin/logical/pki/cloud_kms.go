@@ -0,0 +1,995 @@
+package pki
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	gcpkms "cloud.google.com/go/kms/apiv1"
+	"github.com/Azure/azure-sdk-for-go/services/keyvault/v7.0/keyvault"
+	"github.com/Azure/go-autorest/autorest/azure/auth"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awskms "github.com/aws/aws-sdk-go/service/kms"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/go-secure-stdlib/awsutil"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"google.golang.org/api/option"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+)
+
+// Cloud KMS keys are entries of the key subsystem whose private half lives
+// in a cloud provider's KMS (AWS KMS, GCP Cloud KMS or Azure Key Vault):
+// the mount only stores a reference to the provider's key, along with the
+// credentials to reach it, and every signature (leaf certificates, CRLs,
+// OCSP responses) is computed by the provider.
+//
+// They are stored as managed keys, so that every code path keeping managed
+// key material inside the mount (exports, backups, PKCS#12 bundles) applies
+// to them as well; the stored private key is a "CLOUD KMS KEY" PEM block
+// holding the JSON encoded reference.
+//
+// Signing calls go through a per-key limiter which bounds the number of
+// requests in flight, adapting that bound to the provider's observed
+// latency so that bursts of issuance don't trip its request throttling.
+
+const (
+	cloudKMSProviderAWS   = "aws"
+	cloudKMSProviderGCP   = "gcp"
+	cloudKMSProviderAzure = "azure"
+
+	cloudKMSKeyBlockType = "CLOUD KMS KEY"
+
+	// cloudKMSRequestTimeout bounds any single call to a provider.
+	cloudKMSRequestTimeout = 30 * time.Second
+
+	// cloudKMSMaxInFlight is the upper bound of the limiter's adaptive
+	// limit on concurrent signing requests.
+	cloudKMSMaxInFlight = 32
+
+	// azureKeyVaultResource is the OAuth resource of Azure Key Vault.
+	azureKeyVaultResource = "https://vault.azure.net"
+)
+
+var allCloudKMSProviders = []interface{}{cloudKMSProviderAWS, cloudKMSProviderGCP, cloudKMSProviderAzure}
+
+// cloudKMSKeyRef references a key held by a cloud KMS.
+type cloudKMSKeyRef struct {
+	Provider string `json:"provider"`
+	// Key is the AWS key ID or ARN, the GCP CryptoKeyVersion resource name,
+	// or the versioned Azure key identifier.
+	Key string `json:"key"`
+
+	Region       string `json:"region,omitempty"`
+	Endpoint     string `json:"endpoint,omitempty"`
+	AccessKey    string `json:"access_key,omitempty"`
+	SecretKey    string `json:"secret_key,omitempty"`
+	Credentials  string `json:"credentials,omitempty"`
+	TenantID     string `json:"tenant_id,omitempty"`
+	ClientID     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+func (r *cloudKMSKeyRef) String() string {
+	return r.Provider + ":" + r.Key
+}
+
+func (r *cloudKMSKeyRef) validate() error {
+	if r.Key == "" {
+		return errors.New("key is required")
+	}
+
+	switch r.Provider {
+	case cloudKMSProviderAWS:
+		if r.Region == "" {
+			return errors.New("region is required with the aws provider")
+		}
+	case cloudKMSProviderGCP:
+		if !strings.HasPrefix(r.Key, "projects/") || !strings.Contains(r.Key, "/cryptoKeyVersions/") {
+			return errors.New("key must be the resource name of a CryptoKeyVersion with the gcp provider")
+		}
+	case cloudKMSProviderAzure:
+		if _, _, _, err := r.azureKeyParts(); err != nil {
+			return err
+		}
+		if r.ClientID != "" && (r.ClientSecret == "" || r.TenantID == "") {
+			return errors.New("client_secret and tenant_id are required along with client_id")
+		}
+	default:
+		return fmt.Errorf("unknown provider %q; must be one of aws, gcp or azure", r.Provider)
+	}
+
+	return nil
+}
+
+// azureKeyParts splits a versioned Azure key identifier,
+// https://<vault>.vault.azure.net/keys/<name>/<version>, into the vault's
+// base URL, the key's name and its version.
+func (r *cloudKMSKeyRef) azureKeyParts() (string, string, string, error) {
+	keyURL, err := url.Parse(r.Key)
+	if err != nil || keyURL.Scheme != "https" || keyURL.Host == "" {
+		return "", "", "", errors.New("key must be an Azure key identifier URL with the azure provider")
+	}
+
+	parts := strings.Split(strings.Trim(keyURL.Path, "/"), "/")
+	if len(parts) != 3 || parts[0] != "keys" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", errors.New("key must be a versioned Azure key identifier, https://<vault>/keys/<name>/<version>, with the azure provider")
+	}
+
+	return keyURL.Scheme + "://" + keyURL.Host, parts[1], parts[2], nil
+}
+
+// fingerprint identifies the reference, credentials included, so that a
+// reference rewritten with other credentials gets a new signer.
+func (r *cloudKMSKeyRef) fingerprint() string {
+	encoded, _ := json.Marshal(r)
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// withoutCredentials returns a copy of the reference without the secrets
+// it holds, and whether there were any.
+func (r *cloudKMSKeyRef) withoutCredentials() (*cloudKMSKeyRef, bool) {
+	stripped := *r
+	stripped.SecretKey = ""
+	stripped.Credentials = ""
+	stripped.ClientSecret = ""
+	return &stripped, stripped != *r
+}
+
+// setCredentials fills in the secrets removed by withoutCredentials from
+// the given map, keyed like the import parameters.
+func (r *cloudKMSKeyRef) setCredentials(credentials map[string]interface{}) error {
+	for name, value := range credentials {
+		secret, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("credential %q must be a string", name)
+		}
+
+		switch name {
+		case "secret_key":
+			r.SecretKey = secret
+		case "credentials":
+			r.Credentials = secret
+		case "client_secret":
+			r.ClientSecret = secret
+		default:
+			return fmt.Errorf("unknown credential %q; must be one of secret_key, credentials or client_secret", name)
+		}
+	}
+
+	return r.validate()
+}
+
+func (r *cloudKMSKeyRef) toPEM() (string, error) {
+	encoded, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(pem.EncodeToMemory(&pem.Block{
+		Type:  cloudKMSKeyBlockType,
+		Bytes: encoded,
+	}))), nil
+}
+
+// parseCloudKMSKeyRef returns the cloud KMS key reference held by a stored
+// managed key, if any. Besides the "CLOUD KMS KEY" blocks we write, it
+// accepts "PRIVATE KEY" blocks, as that's the block type certutil gives to
+// managed keys when building CSR bundles.
+func parseCloudKMSKeyRef(privateKeyBytes []byte) (*cloudKMSKeyRef, bool) {
+	block, _ := pem.Decode(privateKeyBytes)
+	if block == nil || (block.Type != cloudKMSKeyBlockType && block.Type != "PRIVATE KEY") {
+		return nil, false
+	}
+
+	var ref cloudKMSKeyRef
+	if err := json.Unmarshal(block.Bytes, &ref); err != nil {
+		return nil, false
+	}
+	if ref.validate() != nil {
+		return nil, false
+	}
+
+	return &ref, true
+}
+
+// The following helpers extend the managed key helpers to cloud KMS keys:
+// references to them take the place of managed key IDs, dispatching to the
+// cloud KMS signer when given one.
+
+func extractAnyManagedKeyId(privateKeyBytes []byte) (managedKeyId, error) {
+	if ref, ok := parseCloudKMSKeyRef(privateKeyBytes); ok {
+		return ref, nil
+	}
+	return extractManagedKeyId(privateKeyBytes)
+}
+
+func getAnyManagedKeyPublicKey(ctx context.Context, b *backend, keyId managedKeyId) (crypto.PublicKey, error) {
+	if ref, ok := keyId.(*cloudKMSKeyRef); ok {
+		signer, err := b.cloudKMSSigners.get(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		return signer.Public(), nil
+	}
+	return getManagedKeyPublicKey(ctx, b, keyId)
+}
+
+func getAnyManagedKeySigner(ctx context.Context, b *backend, keyId managedKeyId) (crypto.Signer, error) {
+	if ref, ok := keyId.(*cloudKMSKeyRef); ok {
+		return b.cloudKMSSigners.get(ctx, ref)
+	}
+	return getManagedKeySigner(ctx, b, keyId)
+}
+
+// resolveCloudKMSKeyId lets the kms generation types use the mount's cloud
+// KMS keys: managed key names and IDs naming one of them resolve to its
+// reference, while all others are left for the managed key helpers.
+func (sc *storageContext) resolveCloudKMSKeyId(keyId managedKeyId) (managedKeyId, error) {
+	if keyId.String() == defaultRef {
+		return keyId, nil
+	}
+
+	id, err := sc.resolveKeyReference(keyId.String())
+	if err != nil {
+		if id == KeyRefNotFound {
+			return keyId, nil
+		}
+		return nil, err
+	}
+
+	key, err := sc.fetchKeyById(id)
+	if err != nil {
+		return nil, err
+	}
+	if !key.isCloudKMSKey() {
+		return keyId, nil
+	}
+
+	ref, _ := parseCloudKMSKeyRef([]byte(key.PrivateKey))
+	return ref, nil
+}
+
+func generateAnyManagedKeyCABundle(ctx context.Context, b *backend, keyId managedKeyId, data *certutil.CreationBundle, randomSource io.Reader) (*certutil.ParsedCertBundle, error) {
+	ref, ok := keyId.(*cloudKMSKeyRef)
+	if !ok {
+		return generateManagedKeyCABundle(ctx, b, keyId, data, randomSource)
+	}
+
+	generator, err := cloudKMSKeyGenerator(ctx, b, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle, err := certutil.CreateCertificateWithKeyGenerator(data, randomSource, generator)
+	if err != nil {
+		return nil, err
+	}
+	bundle.PrivateKeyFormat = cloudKMSKeyBlockType
+	return bundle, nil
+}
+
+func generateAnyManagedKeyCSRBundle(ctx context.Context, b *backend, keyId managedKeyId, data *certutil.CreationBundle, addBasicConstraints bool, randomSource io.Reader) (*certutil.ParsedCSRBundle, error) {
+	ref, ok := keyId.(*cloudKMSKeyRef)
+	if !ok {
+		return generateManagedKeyCSRBundle(ctx, b, keyId, data, addBasicConstraints, randomSource)
+	}
+
+	generator, err := cloudKMSKeyGenerator(ctx, b, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return certutil.CreateCSRWithKeyGenerator(data, addBasicConstraints, randomSource, generator)
+}
+
+// cloudKMSKeyGenerator "generates" the cloud KMS key for certutil, handing
+// it the key's signer and its encoded reference as private key bytes.
+func cloudKMSKeyGenerator(ctx context.Context, b *backend, ref *cloudKMSKeyRef) (certutil.KeyGenerator, error) {
+	signer, err := b.cloudKMSSigners.get(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(_ string, _ int, container certutil.ParsedPrivateKeyContainer, _ io.Reader) error {
+		container.SetParsedPrivateKey(signer, certutil.ManagedPrivateKey, encoded)
+		return nil
+	}, nil
+}
+
+// cloudKMSClient is a provider's API, bound to a single key.
+type cloudKMSClient interface {
+	// describe returns the key's public key and the signature algorithms
+	// the key supports.
+	describe(ctx context.Context) (crypto.PublicKey, []x509.SignatureAlgorithm, error)
+	// sign signs the digest with the given algorithm, returning the
+	// signature in its X.509 encoding.
+	sign(ctx context.Context, digest []byte, algorithm x509.SignatureAlgorithm) ([]byte, error)
+	close()
+}
+
+func newCloudKMSClient(ref *cloudKMSKeyRef) (cloudKMSClient, error) {
+	switch ref.Provider {
+	case cloudKMSProviderAWS:
+		return newAWSKMSClient(ref)
+	case cloudKMSProviderGCP:
+		return newGCPKMSClient(ref)
+	case cloudKMSProviderAzure:
+		return newAzureKMSClient(ref)
+	default:
+		return nil, fmt.Errorf("unknown cloud KMS provider %q", ref.Provider)
+	}
+}
+
+// cloudKMSSigners caches the signers of the mount's cloud KMS keys, so that
+// each key's public key and capabilities are discovered once and all its
+// signing requests go through one limiter.
+type cloudKMSSigners struct {
+	lock    sync.Mutex
+	signers map[string]*cloudKMSSigner
+
+	// newClient is overridden by tests.
+	newClient func(ref *cloudKMSKeyRef) (cloudKMSClient, error)
+}
+
+func newCloudKMSSigners() *cloudKMSSigners {
+	return &cloudKMSSigners{
+		signers:   make(map[string]*cloudKMSSigner),
+		newClient: newCloudKMSClient,
+	}
+}
+
+func (s *cloudKMSSigners) get(ctx context.Context, ref *cloudKMSKeyRef) (*cloudKMSSigner, error) {
+	fingerprint := ref.fingerprint()
+
+	s.lock.Lock()
+	signer, ok := s.signers[fingerprint]
+	s.lock.Unlock()
+	if ok {
+		return signer, nil
+	}
+
+	// Reach the provider without holding the lock, so that a slow or
+	// unreachable key doesn't hold up signing with every other key.
+	client, err := s.newClient(ref)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create %v KMS client: %w", ref.Provider, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cloudKMSRequestTimeout)
+	defer cancel()
+
+	publicKey, algorithms, err := client.describe(ctx)
+	if err != nil {
+		client.close()
+		return nil, fmt.Errorf("unable to fetch public key of cloud KMS key %v: %w", ref, err)
+	}
+	if len(algorithms) == 0 {
+		client.close()
+		return nil, fmt.Errorf("cloud KMS key %v supports no signature algorithm usable for certificates", ref)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Another request may have described the key meanwhile.
+	if existing, ok := s.signers[fingerprint]; ok {
+		client.close()
+		return existing, nil
+	}
+
+	signer = &cloudKMSSigner{
+		ref:        ref,
+		publicKey:  publicKey,
+		algorithms: algorithms,
+		limiter:    newCloudKMSLimiter(client),
+	}
+	s.signers[fingerprint] = signer
+	return signer, nil
+}
+
+// evict stops and forgets the signer of the given reference, if any.
+func (s *cloudKMSSigners) evict(ref *cloudKMSKeyRef) {
+	fingerprint := ref.fingerprint()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if signer, ok := s.signers[fingerprint]; ok {
+		signer.limiter.stop()
+		delete(s.signers, fingerprint)
+	}
+}
+
+// retain stops and forgets the signers of all references but the given
+// ones, identified by their fingerprints.
+func (s *cloudKMSSigners) retain(fingerprints map[string]bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for fingerprint, signer := range s.signers {
+		if !fingerprints[fingerprint] {
+			signer.limiter.stop()
+			delete(s.signers, fingerprint)
+		}
+	}
+}
+
+// evictUnreferenced stops the signers of cloud KMS keys no longer present
+// in the mount, as after a key was deleted on another node.
+func (s *cloudKMSSigners) evictUnreferenced(sc *storageContext) error {
+	s.lock.Lock()
+	empty := len(s.signers) == 0
+	s.lock.Unlock()
+	if empty {
+		return nil
+	}
+
+	keyIds, err := sc.listKeys()
+	if err != nil {
+		return err
+	}
+
+	fingerprints := make(map[string]bool, len(keyIds))
+	for _, keyId := range keyIds {
+		key, err := sc.fetchKeyById(keyId)
+		if err != nil {
+			return err
+		}
+		if ref, ok := parseCloudKMSKeyRef([]byte(key.PrivateKey)); ok {
+			fingerprints[ref.fingerprint()] = true
+		}
+	}
+
+	s.retain(fingerprints)
+	return nil
+}
+
+func (s *cloudKMSSigners) stop() {
+	s.retain(nil)
+}
+
+// cloudKMSSigner is the crypto.Signer of a cloud KMS key.
+type cloudKMSSigner struct {
+	ref        *cloudKMSKeyRef
+	publicKey  crypto.PublicKey
+	algorithms []x509.SignatureAlgorithm
+	limiter    *cloudKMSLimiter
+}
+
+func (s *cloudKMSSigner) Public() crypto.PublicKey {
+	return s.publicKey
+}
+
+func (s *cloudKMSSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	algorithm, err := signatureAlgorithmForSignerOpts(s.publicKey, opts)
+	if err != nil {
+		return nil, err
+	}
+	if !s.supports(algorithm) {
+		return nil, fmt.Errorf("cloud KMS key %v does not support %v signatures; supported: %v", s.ref, algorithm, s.signatureAlgorithmNames())
+	}
+
+	return s.limiter.sign(digest, algorithm)
+}
+
+func (s *cloudKMSSigner) supports(algorithm x509.SignatureAlgorithm) bool {
+	for _, supported := range s.algorithms {
+		if supported == algorithm {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *cloudKMSSigner) signatureAlgorithmNames() []string {
+	var names []string
+	for _, algorithm := range s.algorithms {
+		names = append(names, algorithm.String())
+	}
+	return names
+}
+
+// signatureAlgorithmForSignerOpts maps the options crypto/x509 signs with
+// to the signature algorithm they stand for.
+func signatureAlgorithmForSignerOpts(publicKey crypto.PublicKey, opts crypto.SignerOpts) (x509.SignatureAlgorithm, error) {
+	hash := opts.HashFunc()
+
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		_, pss := opts.(*rsa.PSSOptions)
+		switch {
+		case hash == crypto.SHA256 && pss:
+			return x509.SHA256WithRSAPSS, nil
+		case hash == crypto.SHA384 && pss:
+			return x509.SHA384WithRSAPSS, nil
+		case hash == crypto.SHA512 && pss:
+			return x509.SHA512WithRSAPSS, nil
+		case hash == crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+		case hash == crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+		case hash == crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+	case *ecdsa.PublicKey:
+		switch hash {
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256, nil
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384, nil
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512, nil
+		}
+	default:
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported cloud KMS public key type %T", publicKey)
+	}
+
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported hash function %v for cloud KMS signatures", hash)
+}
+
+// cloudKMSLimiter bounds the number of concurrent signing requests sent
+// for one key, as a semaphore whose size adapts to the provider's latency:
+// it grows by one while requests complete about as fast as usual with all
+// slots taken, and halves when a request takes markedly longer, a sign of
+// throttling. A request is sent as soon as a slot frees up, rather than
+// waiting on the other requests in flight.
+type cloudKMSLimiter struct {
+	client cloudKMSClient
+
+	lock sync.Mutex
+	// slotFreed is signaled whenever a request completes, or the limit
+	// grows, freeing a slot.
+	slotFreed *sync.Cond
+	stopped   bool
+	inFlight  int
+	// limit bounds inFlight.
+	limit int
+	// latency is the moving average of request latencies.
+	latency time.Duration
+}
+
+func newCloudKMSLimiter(client cloudKMSClient) *cloudKMSLimiter {
+	limiter := &cloudKMSLimiter{
+		client: client,
+		limit:  1,
+	}
+	limiter.slotFreed = sync.NewCond(&limiter.lock)
+	return limiter
+}
+
+func (c *cloudKMSLimiter) sign(digest []byte, algorithm x509.SignatureAlgorithm) ([]byte, error) {
+	c.lock.Lock()
+	for !c.stopped && c.inFlight >= c.limit {
+		c.slotFreed.Wait()
+	}
+	if c.stopped {
+		c.lock.Unlock()
+		return nil, errors.New("cloud KMS signer was stopped")
+	}
+	c.inFlight++
+	saturated := c.inFlight >= c.limit
+	c.lock.Unlock()
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), cloudKMSRequestTimeout)
+	defer cancel()
+
+	signature, err := c.client.sign(ctx, digest, algorithm)
+	c.release(saturated, time.Since(start))
+	return signature, err
+}
+
+// release frees the slot of a request which completed in the given time,
+// adjusting the limit; saturated tells whether the request took the last
+// free slot. Only saturated requests grow the limit, so that a key signing
+// once in a while doesn't end up allowed bursts it never proved the
+// provider accepts.
+func (c *cloudKMSLimiter) release(saturated bool, latency time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.inFlight--
+	c.observe(saturated, latency)
+	if c.stopped && c.inFlight == 0 {
+		c.client.close()
+	}
+	c.slotFreed.Broadcast()
+}
+
+// observe adjusts the limit after a request completed in the given time.
+// The caller must hold the lock.
+func (c *cloudKMSLimiter) observe(saturated bool, latency time.Duration) {
+	switch {
+	case c.latency == 0:
+		c.latency = latency
+		return
+	case latency > 2*c.latency:
+		c.limit = c.limit / 2
+		if c.limit < 1 {
+			c.limit = 1
+		}
+	case saturated && c.limit < cloudKMSMaxInFlight:
+		c.limit++
+	}
+
+	c.latency = (7*c.latency + latency) / 8
+}
+
+// stats returns the current limit and average request latency.
+func (c *cloudKMSLimiter) stats() (int, time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.limit, c.latency
+}
+
+// stop refuses further requests, closing the client once those in flight
+// complete.
+func (c *cloudKMSLimiter) stop() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.stopped {
+		return
+	}
+	c.stopped = true
+	if c.inFlight == 0 {
+		c.client.close()
+	}
+	c.slotFreed.Broadcast()
+}
+
+type awsKMSClient struct {
+	client *awskms.KMS
+	keyId  string
+}
+
+var awsKMSSigningAlgorithms = map[string]x509.SignatureAlgorithm{
+	awskms.SigningAlgorithmSpecRsassaPkcs1V15Sha256: x509.SHA256WithRSA,
+	awskms.SigningAlgorithmSpecRsassaPkcs1V15Sha384: x509.SHA384WithRSA,
+	awskms.SigningAlgorithmSpecRsassaPkcs1V15Sha512: x509.SHA512WithRSA,
+	awskms.SigningAlgorithmSpecRsassaPssSha256:      x509.SHA256WithRSAPSS,
+	awskms.SigningAlgorithmSpecRsassaPssSha384:      x509.SHA384WithRSAPSS,
+	awskms.SigningAlgorithmSpecRsassaPssSha512:      x509.SHA512WithRSAPSS,
+	awskms.SigningAlgorithmSpecEcdsaSha256:          x509.ECDSAWithSHA256,
+	awskms.SigningAlgorithmSpecEcdsaSha384:          x509.ECDSAWithSHA384,
+	awskms.SigningAlgorithmSpecEcdsaSha512:          x509.ECDSAWithSHA512,
+}
+
+func newAWSKMSClient(ref *cloudKMSKeyRef) (cloudKMSClient, error) {
+	credsConfig := &awsutil.CredentialsConfig{
+		AccessKey: ref.AccessKey,
+		SecretKey: ref.SecretKey,
+	}
+	creds, err := credsConfig.GenerateCredentialChain()
+	if err != nil {
+		return nil, err
+	}
+
+	awsConfig := &aws.Config{
+		Credentials: creds,
+		HTTPClient:  cleanhttp.DefaultClient(),
+		Region:      aws.String(ref.Region),
+	}
+	if ref.Endpoint != "" {
+		awsConfig.Endpoint = aws.String(ref.Endpoint)
+	}
+
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &awsKMSClient{
+		client: awskms.New(sess),
+		keyId:  ref.Key,
+	}, nil
+}
+
+func (c *awsKMSClient) describe(ctx context.Context) (crypto.PublicKey, []x509.SignatureAlgorithm, error) {
+	out, err := c.client.GetPublicKeyWithContext(ctx, &awskms.GetPublicKeyInput{
+		KeyId: aws.String(c.keyId),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if aws.StringValue(out.KeyUsage) != awskms.KeyUsageTypeSignVerify {
+		return nil, nil, fmt.Errorf("key usage is %v rather than %v", aws.StringValue(out.KeyUsage), awskms.KeyUsageTypeSignVerify)
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(out.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var algorithms []x509.SignatureAlgorithm
+	for _, name := range out.SigningAlgorithms {
+		if algorithm, ok := awsKMSSigningAlgorithms[aws.StringValue(name)]; ok {
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+
+	return publicKey, algorithms, nil
+}
+
+func (c *awsKMSClient) sign(ctx context.Context, digest []byte, algorithm x509.SignatureAlgorithm) ([]byte, error) {
+	var spec string
+	for name, candidate := range awsKMSSigningAlgorithms {
+		if candidate == algorithm {
+			spec = name
+		}
+	}
+
+	out, err := c.client.SignWithContext(ctx, &awskms.SignInput{
+		KeyId:            aws.String(c.keyId),
+		Message:          digest,
+		MessageType:      aws.String(awskms.MessageTypeDigest),
+		SigningAlgorithm: aws.String(spec),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Signature, nil
+}
+
+func (c *awsKMSClient) close() {}
+
+type gcpKMSClient struct {
+	client *gcpkms.KeyManagementClient
+	name   string
+}
+
+// GCP keys support a single algorithm, fixed at the key's creation.
+var gcpKMSSigningAlgorithms = map[kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm]x509.SignatureAlgorithm{
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_2048_SHA256:   x509.SHA256WithRSAPSS,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_3072_SHA256:   x509.SHA256WithRSAPSS,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA256:   x509.SHA256WithRSAPSS,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA512:   x509.SHA512WithRSAPSS,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_2048_SHA256: x509.SHA256WithRSA,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_3072_SHA256: x509.SHA256WithRSA,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA256: x509.SHA256WithRSA,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA512: x509.SHA512WithRSA,
+	kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256:        x509.ECDSAWithSHA256,
+	kmspb.CryptoKeyVersion_EC_SIGN_P384_SHA384:        x509.ECDSAWithSHA384,
+}
+
+func newGCPKMSClient(ref *cloudKMSKeyRef) (cloudKMSClient, error) {
+	var opts []option.ClientOption
+	if ref.Credentials != "" {
+		opts = append(opts, option.WithCredentialsJSON([]byte(ref.Credentials)))
+	}
+	if ref.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(ref.Endpoint))
+	}
+
+	// The client outlives the request creating it, so don't tie it to the
+	// request's context.
+	client, err := gcpkms.NewKeyManagementClient(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gcpKMSClient{
+		client: client,
+		name:   ref.Key,
+	}, nil
+}
+
+func (c *gcpKMSClient) describe(ctx context.Context) (crypto.PublicKey, []x509.SignatureAlgorithm, error) {
+	out, err := c.client.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: c.name})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	block, _ := pem.Decode([]byte(out.Pem))
+	if block == nil {
+		return nil, nil, errors.New("unable to decode public key PEM")
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var algorithms []x509.SignatureAlgorithm
+	if algorithm, ok := gcpKMSSigningAlgorithms[out.Algorithm]; ok {
+		algorithms = append(algorithms, algorithm)
+	}
+
+	return publicKey, algorithms, nil
+}
+
+func (c *gcpKMSClient) sign(ctx context.Context, digest []byte, algorithm x509.SignatureAlgorithm) ([]byte, error) {
+	request := &kmspb.AsymmetricSignRequest{Name: c.name}
+	switch algorithm {
+	case x509.SHA256WithRSA, x509.SHA256WithRSAPSS, x509.ECDSAWithSHA256:
+		request.Digest = &kmspb.Digest{Digest: &kmspb.Digest_Sha256{Sha256: digest}}
+	case x509.ECDSAWithSHA384:
+		request.Digest = &kmspb.Digest{Digest: &kmspb.Digest_Sha384{Sha384: digest}}
+	case x509.SHA512WithRSA, x509.SHA512WithRSAPSS:
+		request.Digest = &kmspb.Digest{Digest: &kmspb.Digest_Sha512{Sha512: digest}}
+	default:
+		return nil, fmt.Errorf("unsupported signature algorithm %v", algorithm)
+	}
+
+	out, err := c.client.AsymmetricSign(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Signature, nil
+}
+
+func (c *gcpKMSClient) close() {
+	c.client.Close()
+}
+
+type azureKMSClient struct {
+	client   keyvault.BaseClient
+	vaultURL string
+	name     string
+	version  string
+}
+
+var azureKMSSigningAlgorithms = map[x509.SignatureAlgorithm]keyvault.JSONWebKeySignatureAlgorithm{
+	x509.SHA256WithRSA:    keyvault.RS256,
+	x509.SHA384WithRSA:    keyvault.RS384,
+	x509.SHA512WithRSA:    keyvault.RS512,
+	x509.SHA256WithRSAPSS: keyvault.PS256,
+	x509.SHA384WithRSAPSS: keyvault.PS384,
+	x509.SHA512WithRSAPSS: keyvault.PS512,
+	x509.ECDSAWithSHA256:  keyvault.ES256,
+	x509.ECDSAWithSHA384:  keyvault.ES384,
+	x509.ECDSAWithSHA512:  keyvault.ES512,
+}
+
+func newAzureKMSClient(ref *cloudKMSKeyRef) (cloudKMSClient, error) {
+	vaultURL, name, version, err := ref.azureKeyParts()
+	if err != nil {
+		return nil, err
+	}
+
+	client := keyvault.New()
+	if ref.ClientID != "" {
+		config := auth.NewClientCredentialsConfig(ref.ClientID, ref.ClientSecret, ref.TenantID)
+		config.Resource = azureKeyVaultResource
+		client.Authorizer, err = config.Authorizer()
+	} else {
+		client.Authorizer, err = auth.NewAuthorizerFromEnvironmentWithResource(azureKeyVaultResource)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &azureKMSClient{
+		client:   client,
+		vaultURL: vaultURL,
+		name:     name,
+		version:  version,
+	}, nil
+}
+
+func (c *azureKMSClient) describe(ctx context.Context) (crypto.PublicKey, []x509.SignatureAlgorithm, error) {
+	out, err := c.client.GetKey(ctx, c.vaultURL, c.name, c.version)
+	if err != nil {
+		return nil, nil, err
+	}
+	if out.Key == nil {
+		return nil, nil, errors.New("response holds no key")
+	}
+
+	jwk := out.Key
+	switch jwk.Kty {
+	case keyvault.RSA, keyvault.RSAHSM:
+		n, err := decodeJWKInt(jwk.N)
+		if err != nil {
+			return nil, nil, err
+		}
+		e, err := decodeJWKInt(jwk.E)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		publicKey := &rsa.PublicKey{N: n, E: int(e.Int64())}
+		return publicKey, []x509.SignatureAlgorithm{
+			x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA,
+			x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS,
+		}, nil
+	case keyvault.EC, keyvault.ECHSM:
+		var curve elliptic.Curve
+		var algorithm x509.SignatureAlgorithm
+		switch jwk.Crv {
+		case keyvault.P256:
+			curve, algorithm = elliptic.P256(), x509.ECDSAWithSHA256
+		case keyvault.P384:
+			curve, algorithm = elliptic.P384(), x509.ECDSAWithSHA384
+		case keyvault.P521:
+			curve, algorithm = elliptic.P521(), x509.ECDSAWithSHA512
+		default:
+			return nil, nil, fmt.Errorf("unsupported curve %v", jwk.Crv)
+		}
+
+		x, err := decodeJWKInt(jwk.X)
+		if err != nil {
+			return nil, nil, err
+		}
+		y, err := decodeJWKInt(jwk.Y)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		publicKey := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		return publicKey, []x509.SignatureAlgorithm{algorithm}, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported key type %v", jwk.Kty)
+	}
+}
+
+func (c *azureKMSClient) sign(ctx context.Context, digest []byte, algorithm x509.SignatureAlgorithm) ([]byte, error) {
+	value := base64.RawURLEncoding.EncodeToString(digest)
+	out, err := c.client.Sign(ctx, c.vaultURL, c.name, c.version, keyvault.KeySignParameters{
+		Algorithm: azureKMSSigningAlgorithms[algorithm],
+		Value:     &value,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out.Result == nil {
+		return nil, errors.New("response holds no signature")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(*out.Result)
+	if err != nil {
+		return nil, err
+	}
+
+	switch algorithm {
+	case x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512:
+		// Key Vault returns the raw r || s concatenation JWS uses; X.509
+		// wants the ASN.1 encoding.
+		half := len(signature) / 2
+		return asn1.Marshal(struct{ R, S *big.Int }{
+			R: new(big.Int).SetBytes(signature[:half]),
+			S: new(big.Int).SetBytes(signature[half:]),
+		})
+	default:
+		return signature, nil
+	}
+}
+
+func (c *azureKMSClient) close() {}
+
+func decodeJWKInt(value *string) (*big.Int, error) {
+	if value == nil {
+		return nil, errors.New("missing key parameter")
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(*value, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(decoded), nil
+}
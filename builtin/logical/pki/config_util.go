@@ -50,9 +50,8 @@ func (sc *storageContext) updateDefaultIssuerId(id issuerID) error {
 		newDefault := id
 		now := time.Now().UTC()
 
-		err := sc.setIssuersConfig(&issuerConfigEntry{
-			DefaultIssuerId: newDefault,
-		})
+		config.DefaultIssuerId = newDefault
+		err := sc.setIssuersConfig(config)
 		if err != nil {
 			return err
 		}
@@ -99,3 +98,64 @@ func (sc *storageContext) updateDefaultIssuerId(id issuerID) error {
 
 	return nil
 }
+
+// resolveUsableDefaultIssuer returns the first of the default issuer and
+// its fallbacks (in order) which can currently serve the given usage: it
+// is unexpired, allowed the usage, and has a key. When none can, the
+// default issuer itself is returned, so that using it reports why not.
+// The returned bool is whether a fallback was chosen.
+func (sc *storageContext) resolveUsableDefaultIssuer(usage issuerUsage) (issuerID, bool, error) {
+	config, err := sc.getIssuersConfig()
+	if err != nil {
+		return issuerID("config-error"), false, err
+	}
+	if len(config.DefaultIssuerId) == 0 && len(config.DefaultFallbacks) == 0 {
+		return IssuerRefNotFound, false, fmt.Errorf("no default issuer currently configured")
+	}
+
+	candidates := append([]issuerID{config.DefaultIssuerId}, config.DefaultFallbacks...)
+	for index, id := range candidates {
+		if len(id) == 0 {
+			continue
+		}
+
+		usable, err := sc.isIssuerUsable(id, usage)
+		if err != nil {
+			return issuerID("issuer-read"), false, err
+		}
+		if usable {
+			return id, index > 0, nil
+		}
+	}
+
+	if len(config.DefaultIssuerId) == 0 {
+		return IssuerRefNotFound, false, fmt.Errorf("no default issuer currently configured, and no fallback default issuer is usable")
+	}
+	return config.DefaultIssuerId, false, nil
+}
+
+// isIssuerUsable reports whether the issuer exists, is unexpired, is
+// allowed the given usage, and has a key to serve it with.
+func (sc *storageContext) isIssuerUsable(id issuerID, usage issuerUsage) (bool, error) {
+	entry, err := sc.Storage.Get(sc.Context, issuerPrefix+id.String())
+	if err != nil {
+		return false, err
+	}
+	if entry == nil {
+		return false, nil
+	}
+
+	var issuer issuerEntry
+	if err := entry.DecodeJSON(&issuer); err != nil {
+		return false, fmt.Errorf("unable to decode issuer %v: %w", id, err)
+	}
+	if len(issuer.KeyID) == 0 || issuer.EnsureUsage(usage) != nil {
+		return false, nil
+	}
+
+	cert, err := issuer.GetCertificate()
+	if err != nil {
+		return false, err
+	}
+	return time.Now().Before(cert.NotAfter), nil
+}
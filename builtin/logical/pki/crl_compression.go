@@ -0,0 +1,130 @@
+package pki
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// With compress_crls, CRLs under crls/ are stored gzip compressed. Stored
+// CRLs may be either compressed or not (e.g., those built before the
+// option was enabled) and are told apart by the gzip magic number: a DER
+// CRL always starts with a SEQUENCE tag (0x30) instead.
+//
+// Compressed DER CRLs are served as-is to clients which accept gzip, with
+// a Content-Encoding header; this requires the Accept-Encoding request
+// header and the Content-Encoding response header to be allowed on the
+// mount. Everyone else is served the decompressed CRL.
+const (
+	headerAcceptEncoding  = "Accept-Encoding"
+	headerContentEncoding = "Content-Encoding"
+	headerVary            = "Vary"
+
+	gzipEncoding = "gzip"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// isCompressedCRL reports whether the stored CRL is gzip compressed.
+func isCompressedCRL(stored []byte) bool {
+	return bytes.HasPrefix(stored, gzipMagic)
+}
+
+// compressCRL gzip compresses a DER CRL for storage.
+func compressCRL(crlBytes []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(crlBytes); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressCRL returns the DER form of a stored CRL, whether compressed or
+// not.
+func decompressCRL(stored []byte) ([]byte, error) {
+	if !isCompressedCRL(stored) {
+		return stored, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(stored))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress stored CRL: %w", err)
+	}
+	defer reader.Close()
+
+	crlBytes, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress stored CRL: %w", err)
+	}
+	return crlBytes, nil
+}
+
+// writeCRL stores a DER CRL at path, compressing it if requested.
+func writeCRL(sc *storageContext, path string, crlBytes []byte, compress bool) error {
+	value := crlBytes
+	if compress {
+		compressed, err := compressCRL(crlBytes)
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error compressing CRL: %s", err)}
+		}
+		value = compressed
+	}
+
+	return sc.Storage.Put(sc.Context, &logical.StorageEntry{
+		Key:   path,
+		Value: value,
+	})
+}
+
+// acceptsGzip reports whether the client will accept a gzip encoded
+// response, per its (passed through) Accept-Encoding header.
+func acceptsGzip(req *logical.Request) bool {
+	for _, value := range req.Headers[headerAcceptEncoding] {
+		for _, coding := range strings.Split(value, ",") {
+			params := strings.Split(coding, ";")
+			if !strings.EqualFold(strings.TrimSpace(params[0]), gzipEncoding) {
+				continue
+			}
+
+			rejected := false
+			for _, param := range params[1:] {
+				param = strings.ReplaceAll(param, " ", "")
+				if param == "q=0" || strings.HasPrefix(param, "q=0.") && strings.Trim(param[len("q=0."):], "0") == "" {
+					rejected = true
+				}
+			}
+			if !rejected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// crlResponseBody returns the body to serve for a stored CRL: as-is, when
+// compressed and the client accepts gzip, along with the response headers
+// to set; or else decompressed. Only raw DER responses may be served
+// compressed.
+func crlResponseBody(req *logical.Request, stored []byte, rawDER bool) ([]byte, map[string][]string, error) {
+	if rawDER && isCompressedCRL(stored) && acceptsGzip(req) {
+		return stored, map[string][]string{
+			headerContentEncoding: {gzipEncoding},
+			headerVary:            {headerAcceptEncoding},
+		}, nil
+	}
+
+	crlBytes, err := decompressCRL(stored)
+	if err != nil {
+		return nil, nil, err
+	}
+	return crlBytes, nil, nil
+}
@@ -0,0 +1,161 @@
+package pki
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+	cbbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// Raw CRL responses carry an ETag and a Last-Modified header, letting
+// clients polling the CRL revalidate their copy with If-None-Match or
+// If-Modified-Since rather than downloading it again. Both are derived
+// from the stored CRL itself: Last-Modified is its thisUpdate, and the
+// ETag a digest of its signature, as every newly signed CRL differs in
+// it. Only the outer structure of the CRL is decoded, so this stays cheap
+// for large CRLs.
+//
+// As with If-Modified-Since, the If-None-Match request header must be
+// passed through to the mount, and the ETag and Last-Modified response
+// headers allowed on it.
+const (
+	headerETag        = "ETag"
+	headerIfNoneMatch = "If-None-Match"
+)
+
+// crlValidators are the validators of a raw CRL response.
+type crlValidators struct {
+	etag         string
+	lastModified time.Time
+}
+
+// getCRLValidators returns the validators for serving the given DER CRL
+// as the given representation (such as "der", "der-gzip" or "pem"); each
+// representation has its own ETag.
+func getCRLValidators(crlBytes []byte, representation string) (*crlValidators, error) {
+	input := cryptobyte.String(crlBytes)
+	var crl, tbs cryptobyte.String
+	var signature []byte
+	if !input.ReadASN1(&crl, cbbasn1.SEQUENCE) ||
+		!crl.ReadASN1(&tbs, cbbasn1.SEQUENCE) ||
+		!crl.SkipASN1(cbbasn1.SEQUENCE) ||
+		!crl.ReadASN1BitStringAsBytes(&signature) {
+		return nil, fmt.Errorf("malformed CRL")
+	}
+
+	// Skip the optional version, the signature algorithm and the issuer
+	// to get to thisUpdate.
+	if !tbs.SkipOptionalASN1(cbbasn1.INTEGER) ||
+		!tbs.SkipASN1(cbbasn1.SEQUENCE) ||
+		!tbs.SkipASN1(cbbasn1.SEQUENCE) {
+		return nil, fmt.Errorf("malformed CRL")
+	}
+
+	var thisUpdate time.Time
+	if tbs.PeekASN1Tag(cbbasn1.UTCTime) {
+		if !tbs.ReadASN1UTCTime(&thisUpdate) {
+			return nil, fmt.Errorf("malformed CRL thisUpdate")
+		}
+	} else if !tbs.ReadASN1GeneralizedTime(&thisUpdate) {
+		return nil, fmt.Errorf("malformed CRL thisUpdate")
+	}
+
+	digest := sha256.Sum256(signature)
+	return &crlValidators{
+		etag:         fmt.Sprintf(`"%s-%s"`, hex.EncodeToString(digest[:16]), representation),
+		lastModified: thisUpdate,
+	}, nil
+}
+
+// getServedCRLValidators returns the validators of the response body
+// served for a stored CRL, as returned by crlResponseBody.
+func getServedCRLValidators(stored []byte, body []byte, pem bool, headers map[string][]string) (*crlValidators, error) {
+	representation := crlRepresentation(pem, headers)
+
+	crlBytes := body
+	if isCompressedCRL(body) {
+		var err error
+		if crlBytes, err = decompressCRL(stored); err != nil {
+			return nil, err
+		}
+	}
+
+	return getCRLValidators(crlBytes, representation)
+}
+
+// headers returns the response headers carrying the validators.
+func (v *crlValidators) headers() map[string][]string {
+	return map[string][]string{
+		headerETag:         {v.etag},
+		headerLastModified: {v.lastModified.UTC().Format(http.TimeFormat)},
+	}
+}
+
+// notModified reports whether the client's copy, per its conditional
+// request headers, is still current. If-None-Match takes precedence over
+// If-Modified-Since, per RFC 7232.
+func (v *crlValidators) notModified(req *logical.Request) bool {
+	if hasHeader(headerIfNoneMatch, req) {
+		for _, value := range req.Headers[headerIfNoneMatch] {
+			for _, tag := range strings.Split(value, ",") {
+				tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+				if tag == "*" || tag == v.etag {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	if hasHeader(headerIfModifiedSince, req) {
+		ifModifiedSince, err := parseIfNotModifiedSince(req)
+		if err != nil {
+			return false
+		}
+		return !v.lastModified.Truncate(time.Second).After(ifModifiedSince)
+	}
+
+	return false
+}
+
+// crlNotModifiedResponse is the response to a conditional request for a
+// raw CRL which the client already has.
+func crlNotModifiedResponse(validators *crlValidators) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "",
+			logical.HTTPStatusCode:  http.StatusNotModified,
+		},
+		Headers: validators.headers(),
+	}
+}
+
+// crlRepresentation names the representation served for a stored CRL, for
+// its ETag.
+func crlRepresentation(pem bool, headers map[string][]string) string {
+	if pem {
+		return "pem"
+	}
+	if len(headers[headerContentEncoding]) > 0 {
+		return "der-" + headers[headerContentEncoding][0]
+	}
+	return "der"
+}
+
+// mergeHeaders adds the extra headers to headers, allocating it if nil.
+func mergeHeaders(headers map[string][]string, extra map[string][]string) map[string][]string {
+	if headers == nil {
+		headers = make(map[string][]string, len(extra))
+	}
+	for name, values := range extra {
+		headers[name] = values
+	}
+	return headers
+}
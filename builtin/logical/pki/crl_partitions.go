@@ -0,0 +1,234 @@
+package pki
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+)
+
+// Roles may place the certificates they issue into a named CRL partition.
+// Revocations of those certificates are then left off the issuer's complete
+// and delta CRLs, and instead go onto a separate CRL per partition, so that
+// the revocations of high-volume, short-lived certificates don't bloat the
+// CRL other certificates depend on.
+//
+// A certificate's partition is recorded in its metadata at issuance and
+// copied onto its revocation entry; partitioned certificates point to their
+// partition's CRL through the partition_crl_distribution_points URLs. Each
+// partition has its own complete CRL, built alongside the issuer's complete
+// CRL, and its own delta CRL, built alongside the issuer's delta CRL.
+
+// partitionCRLPathSuffix is appended, along with the partition's name, to a
+// CRL's storage path to find its partition CRLs.
+const partitionCRLPathSuffix = "-partition-"
+
+// partitionDeltaCRLPathSuffix is appended, along with the partition's name,
+// to a CRL's storage path to find its partitions' delta CRLs. It precedes the
+// partition's name, as partition names may themselves end in "-delta".
+const partitionDeltaCRLPathSuffix = deltaCRLPathSuffix + partitionCRLPathSuffix
+
+var crlPartitionNameRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9_-]*[a-zA-Z0-9])?$`)
+
+func validateCRLPartitionName(name string) error {
+	if !crlPartitionNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid CRL partition %q: names may contain only letters, digits, hyphens and underscores, and must start and end with a letter or digit", name)
+	}
+	return nil
+}
+
+// listCRLPartitions returns the CRL partitions roles presently issue into,
+// along with any others holding revocations.
+func (sc *storageContext) listCRLPartitions(revoked map[string]map[issuerID][]pkix.RevokedCertificate) ([]string, error) {
+	roles, err := sc.Storage.List(sc.Context, "role/")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list roles: %w", err)
+	}
+
+	var partitions []string
+	for _, name := range roles {
+		entry, err := sc.Storage.Get(sc.Context, "role/"+name)
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch role %v: %w", name, err)
+		}
+		if entry == nil {
+			continue
+		}
+
+		var role roleEntry
+		if err := entry.DecodeJSON(&role); err != nil {
+			return nil, fmt.Errorf("unable to decode role %v: %w", name, err)
+		}
+		if role.CRLPartition != "" && !strutil.StrListContains(partitions, role.CRLPartition) {
+			partitions = append(partitions, role.CRLPartition)
+		}
+	}
+
+	for partition := range revoked {
+		if !strutil.StrListContains(partitions, partition) {
+			partitions = append(partitions, partition)
+		}
+	}
+
+	sort.Strings(partitions)
+	return partitions, nil
+}
+
+// applyCRLPartitionURLs points the CRL distribution points of certificates
+// issued into the given partition at the partition's CRL, when
+// partition_crl_distribution_points are configured.
+func (sc *storageContext) applyCRLPartitionURLs(signingBundle *certutil.CAInfoBundle, issuerRef string, partition string) error {
+	config, err := getGlobalAIAURLs(sc.Context, sc.Storage)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("unable to fetch URL information: %v", err)}
+	}
+	if len(config.PartitionCRLDistributionPoints) == 0 {
+		return nil
+	}
+
+	issuerId := legacyBundleShimID
+	if !sc.Backend.useLegacyBundleCaStorage() {
+		issuerId, err = sc.resolveIssuerReference(issuerRef)
+		if err != nil {
+			return err
+		}
+	}
+
+	cdps, err := config.partitionCRLDistributionPoints(sc, issuerId, partition)
+	if err != nil {
+		return errutil.UserError{Err: err.Error()}
+	}
+
+	urls := &certutil.URLEntries{CRLDistributionPoints: cdps}
+	if signingBundle.URLs != nil {
+		urls.IssuingCertificates = signingBundle.URLs.IssuingCertificates
+		urls.OCSPServers = signingBundle.URLs.OCSPServers
+	}
+	signingBundle.URLs = urls
+	return nil
+}
+
+// buildPartitionCRLs builds, alongside a complete or delta CRL, the CRL of
+// each partition, containing only the revocations of certificates issued
+// into it. These share the issuer's CRL number and lifetime, and partition
+// delta CRLs refer to the last complete CRL like the issuer's delta CRL;
+// their critical issuingDistributionPoint names the partition's distribution
+// points, when configured, and limits their scope to end-entity certificates.
+func buildPartitionCRLs(sc *storageContext, crlInfo *crlConfig, thisIssuerId issuerID, partitions []string, revoked map[string][]pkix.RevokedCertificate, identifier crlID, crlNumber int64, isDelta bool, lastCompleteNumber int64) error {
+	if !isDelta {
+		if err := deletePartitionCRLs(sc, identifier, partitions); err != nil {
+			return err
+		}
+	}
+
+	if len(partitions) == 0 {
+		return nil
+	}
+
+	expiry := crlInfo.Expiry
+	pathSuffix := partitionCRLPathSuffix
+	var extensions []pkix.Extension
+	if isDelta {
+		if crlInfo.DeltaExpiry != "" {
+			expiry = crlInfo.DeltaExpiry
+		}
+		pathSuffix = partitionDeltaCRLPathSuffix
+
+		ext, err := certutil.CreateDeltaCRLIndicatorExt(lastCompleteNumber)
+		if err != nil {
+			return fmt.Errorf("could not create crl delta indicator extension: %v", err)
+		}
+		extensions = append(extensions, ext)
+	}
+
+	crlLifetime, err := time.ParseDuration(expiry)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error parsing CRL duration of %s", expiry)}
+	}
+
+	signingBundle, caErr := sc.fetchCAInfoByIssuerId(thisIssuerId, CRLSigningUsage)
+	if caErr != nil {
+		switch caErr.(type) {
+		case errutil.UserError:
+			return errutil.UserError{Err: fmt.Sprintf("could not fetch the CA certificate: %s", caErr)}
+		default:
+			return errutil.InternalError{Err: fmt.Sprintf("error fetching CA certificate: %s", caErr)}
+		}
+	}
+
+	urlConfig, err := getGlobalAIAURLs(sc.Context, sc.Storage)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("unable to fetch URL information: %v", err)}
+	}
+
+	now := time.Now()
+	for _, partition := range partitions {
+		idp := &crlIDPConfig{OnlyContainsUserCerts: true}
+		if len(urlConfig.PartitionCRLDistributionPoints) > 0 {
+			idp.URIs, err = urlConfig.partitionCRLDistributionPoints(sc, thisIssuerId, partition)
+			if err != nil {
+				return errutil.InternalError{Err: fmt.Sprintf("error resolving distribution points of CRL partition %v: %s", partition, err)}
+			}
+		}
+
+		ext, err := idpExtension(idp, -1)
+		if err != nil {
+			return err
+		}
+
+		var entries []pkix.RevokedCertificate
+		if !crlInfo.Disable {
+			entries = revoked[partition]
+		}
+
+		crlBytes, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+			RevokedCertificates: entries,
+			Number:              big.NewInt(crlNumber),
+			ThisUpdate:          now,
+			NextUpdate:          now.Add(crlLifetime),
+			SignatureAlgorithm:  signingBundle.RevocationSigAlg,
+			ExtraExtensions:     append([]pkix.Extension{*ext}, extensions...),
+		}, signingBundle.Certificate, signingBundle.PrivateKey)
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error creating new CRL for partition %v: %s", partition, err)}
+		}
+
+		if err := writeCRL(sc, "crls/"+identifier.String()+pathSuffix+partition, crlBytes, crlInfo.CompressCRLs); err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error storing CRL for partition %v: %s", partition, err)}
+		}
+	}
+
+	return nil
+}
+
+// deletePartitionCRLs removes the partition CRLs, complete and delta, of the
+// given CRL, except for those partitions which are kept.
+func deletePartitionCRLs(sc *storageContext, identifier crlID, keep []string) error {
+	crls, err := sc.Storage.List(sc.Context, "crls/")
+	if err != nil {
+		return fmt.Errorf("unable to list CRLs: %w", err)
+	}
+
+	for _, prefix := range []string{identifier.String() + partitionCRLPathSuffix, identifier.String() + partitionDeltaCRLPathSuffix} {
+		for _, name := range crls {
+			if !strings.HasPrefix(name, prefix) || strutil.StrListContains(keep, strings.TrimPrefix(name, prefix)) {
+				continue
+			}
+
+			if err := sc.Storage.Delete(sc.Context, "crls/"+name); err != nil {
+				return fmt.Errorf("unable to remove CRL of partition %v: %w", strings.TrimPrefix(name, prefix), err)
+			}
+		}
+	}
+
+	return nil
+}
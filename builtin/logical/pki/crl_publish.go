@@ -0,0 +1,493 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-secure-stdlib/awsutil"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"google.golang.org/api/option"
+)
+
+// With config/publish, the mount pushes its CRLs and issuer certificates to
+// external object storage (an S3, GCS or Azure bucket, or any HTTP server
+// accepting PUTs) whenever they're rebuilt, so that CDP and AIA URLs may
+// point at a CDN in front of it rather than at Vault.
+//
+// For each issuer, three objects are published, named after its ID and
+// prefixed by the configured prefix:
+//
+//	<issuer_id>.crt        the issuer's certificate, DER encoded
+//	<issuer_id>.crl        its complete CRL, DER encoded
+//	<issuer_id>-delta.crl  its delta CRL, when delta CRLs are enabled
+//
+// Only the primary cluster publishes. Like events, objects are published
+// asynchronously by a background worker after the CRLs were persisted, so
+// CRL builds neither wait on nor fail because of the target. Failed uploads
+// are retried a few times; the outcome of the last upload of each object is
+// kept, in memory, for publish/status.
+const (
+	publishTargetHTTP  = "http"
+	publishTargetS3    = "s3"
+	publishTargetGCS   = "gcs"
+	publishTargetAzure = "azure"
+
+	// publishQueueSize bounds the number of batches pending upload.
+	publishQueueSize = 64
+
+	publishAttempts      = 3
+	publishUploadTimeout = 30 * time.Second
+	publishRetryBackoff  = 2 * time.Second
+
+	contentTypePkixCert = "application/pkix-cert"
+	contentTypePkixCRL  = "application/pkix-crl"
+)
+
+var allPublishTargets = []string{publishTargetHTTP, publishTargetS3, publishTargetGCS, publishTargetAzure}
+
+type publishedObject struct {
+	name        string
+	body        []byte
+	contentType string
+}
+
+type publishBatch struct {
+	config  *publishConfigEntry
+	objects []*publishedObject
+}
+
+// publishStatus records the outcome of the last upload of an object.
+type publishStatus struct {
+	LastAttempt time.Time
+	LastSuccess time.Time
+	LastError   string
+	Attempts    int
+}
+
+type crlPublisher struct {
+	queue  chan *publishBatch
+	worker stoppableWorker
+
+	statusLock sync.RWMutex
+	status     map[string]*publishStatus
+}
+
+func newCRLPublisher() *crlPublisher {
+	return &crlPublisher{
+		queue:  make(chan *publishBatch, publishQueueSize),
+		status: make(map[string]*publishStatus),
+	}
+}
+
+// publishIssuerArtifacts queues the given issuers' CRLs for upload, when
+// publishing is enabled: only their delta CRLs after a delta rebuild, and
+// otherwise their complete CRLs and certificates as well. Errors are logged
+// rather than returned, as the CRLs have already been rebuilt.
+func (b *backend) publishIssuerArtifacts(sc *storageContext, issuers []issuerID, deltaOnly bool) {
+	// Performance secondaries build CRLs of their own, which would
+	// otherwise overwrite the primary's at the shared target.
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceSecondary) {
+		return
+	}
+
+	config, err := sc.getPublishConfig()
+	if err != nil {
+		b.Logger().Warn("unable to fetch publish configuration; not publishing CRLs", "error", err)
+		return
+	}
+	if !config.Enabled || len(issuers) == 0 {
+		return
+	}
+
+	objects, err := sc.collectPublishedObjects(issuers, deltaOnly)
+	if err != nil {
+		b.Logger().Warn("unable to gather CRLs and certificates to publish", "error", err)
+		return
+	}
+	if len(objects) == 0 {
+		return
+	}
+
+	b.crlPublisher.startWorker(b.Logger())
+
+	select {
+	case b.crlPublisher.queue <- &publishBatch{config: config, objects: objects}:
+	default:
+		b.Logger().Warn("publish queue is full; not publishing CRLs", "objects", len(objects))
+	}
+}
+
+// collectPublishedObjects reads the objects to publish for the given
+// issuers from storage.
+func (sc *storageContext) collectPublishedObjects(issuers []issuerID, deltaOnly bool) ([]*publishedObject, error) {
+	crlConfig, err := sc.getLocalCRLConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []*publishedObject
+	for _, issuerId := range issuers {
+		crlId, ok := crlConfig.IssuerIDCRLMap[issuerId]
+		if !ok || len(crlId) == 0 {
+			continue
+		}
+
+		if !deltaOnly {
+			issuer, err := sc.fetchIssuerById(issuerId)
+			if err != nil {
+				return nil, err
+			}
+			cert, err := issuer.GetCertificate()
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse certificate of issuer %v: %w", issuerId, err)
+			}
+			objects = append(objects, &publishedObject{
+				name:        issuerId.String() + ".crt",
+				body:        cert.Raw,
+				contentType: contentTypePkixCert,
+			})
+
+			crlBytes, err := sc.fetchStoredCRL("crls/" + crlId.String())
+			if err != nil {
+				return nil, err
+			}
+			if crlBytes != nil {
+				objects = append(objects, &publishedObject{
+					name:        issuerId.String() + ".crl",
+					body:        crlBytes,
+					contentType: contentTypePkixCRL,
+				})
+			}
+		}
+
+		deltaBytes, err := sc.fetchStoredCRL("crls/" + crlId.String() + deltaCRLPathSuffix)
+		if err != nil {
+			return nil, err
+		}
+		if deltaBytes != nil {
+			objects = append(objects, &publishedObject{
+				name:        issuerId.String() + "-delta.crl",
+				body:        deltaBytes,
+				contentType: contentTypePkixCRL,
+			})
+		}
+	}
+
+	return objects, nil
+}
+
+// fetchStoredCRL returns the DER CRL stored at path, or nil if there's none.
+func (sc *storageContext) fetchStoredCRL(path string) ([]byte, error) {
+	entry, err := sc.Storage.Get(sc.Context, path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch CRL %v: %w", path, err)
+	}
+	if entry == nil || len(entry.Value) == 0 {
+		return nil, nil
+	}
+
+	return decompressCRL(entry.Value)
+}
+
+// startWorker launches the goroutine uploading queued batches, if it isn't
+// running already.
+func (p *crlPublisher) startWorker(logger hclog.Logger) {
+	p.worker.start(func(ctx context.Context) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case batch := <-p.queue:
+				p.publish(ctx, logger, batch)
+			}
+		}
+	})
+}
+
+// stopWorker stops the upload worker, if running, abandoning any upload in
+// progress; batches still queued are dropped.
+func (p *crlPublisher) stopWorker() {
+	p.worker.stop()
+}
+
+// publish uploads each object of the batch to its target, retrying failed
+// uploads until the worker is stopped.
+func (p *crlPublisher) publish(ctx context.Context, logger hclog.Logger, batch *publishBatch) {
+	target, err := newPublishTarget(ctx, batch.config)
+	if err != nil {
+		logger.Warn("unable to set up publish target; not publishing CRLs", "type", batch.config.Type, "error", err)
+		for _, object := range batch.objects {
+			p.recordStatus(batch.config.objectName(object.name), 0, err)
+		}
+		return
+	}
+	defer target.close()
+
+	for _, object := range batch.objects {
+		name := batch.config.objectName(object.name)
+
+		var attempts int
+		for attempts = 1; attempts <= publishAttempts; attempts++ {
+			err = p.upload(ctx, target, name, object)
+			if err == nil || attempts == publishAttempts {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Duration(attempts) * publishRetryBackoff):
+			}
+		}
+
+		p.recordStatus(name, attempts, err)
+		if err != nil {
+			logger.Warn("unable to publish object", "name", name, "attempts", attempts, "error", err)
+		}
+	}
+}
+
+func (p *crlPublisher) upload(ctx context.Context, target publishTarget, name string, object *publishedObject) error {
+	ctx, cancel := context.WithTimeout(ctx, publishUploadTimeout)
+	defer cancel()
+
+	return target.put(ctx, name, object.body, object.contentType)
+}
+
+func (p *crlPublisher) recordStatus(name string, attempts int, err error) {
+	p.statusLock.Lock()
+	defer p.statusLock.Unlock()
+
+	status, ok := p.status[name]
+	if !ok {
+		status = &publishStatus{}
+		p.status[name] = status
+	}
+
+	status.LastAttempt = time.Now().UTC()
+	status.Attempts = attempts
+	if err != nil {
+		status.LastError = err.Error()
+	} else {
+		status.LastSuccess = status.LastAttempt
+		status.LastError = ""
+	}
+}
+
+// statusResponseData describes the outcome of the last upload of each
+// object published by this node.
+func (p *crlPublisher) statusResponseData() map[string]interface{} {
+	p.statusLock.RLock()
+	defer p.statusLock.RUnlock()
+
+	var names []string
+	for name := range p.status {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	objects := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		status := p.status[name]
+		entry := map[string]interface{}{
+			"last_attempt": status.LastAttempt.Format(time.RFC3339),
+			"last_success": "",
+			"last_error":   status.LastError,
+			"attempts":     status.Attempts,
+		}
+		if !status.LastSuccess.IsZero() {
+			entry["last_success"] = status.LastSuccess.Format(time.RFC3339)
+		}
+		objects[name] = entry
+	}
+
+	return map[string]interface{}{
+		"objects":         objects,
+		"pending_batches": len(p.queue),
+	}
+}
+
+// publishTarget uploads objects to external storage.
+type publishTarget interface {
+	put(ctx context.Context, name string, body []byte, contentType string) error
+	close()
+}
+
+func newPublishTarget(ctx context.Context, config *publishConfigEntry) (publishTarget, error) {
+	switch config.Type {
+	case publishTargetHTTP:
+		return &httpPublishTarget{
+			client:  cleanhttp.DefaultClient(),
+			baseURL: strings.TrimSuffix(config.URL, "/"),
+		}, nil
+	case publishTargetS3:
+		return newS3PublishTarget(config)
+	case publishTargetGCS:
+		return newGCSPublishTarget(ctx, config)
+	case publishTargetAzure:
+		return newAzurePublishTarget(config)
+	default:
+		return nil, fmt.Errorf("unknown publish target type %q", config.Type)
+	}
+}
+
+// httpPublishTarget PUTs each object to its name under a base URL.
+type httpPublishTarget struct {
+	client  *http.Client
+	baseURL string
+}
+
+func (t *httpPublishTarget) put(ctx context.Context, name string, body []byte, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, t.baseURL+"/"+name, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("server responded with status %v", resp.StatusCode)
+	}
+	return nil
+}
+
+func (t *httpPublishTarget) close() {}
+
+type s3PublishTarget struct {
+	client *s3.S3
+	bucket string
+}
+
+func newS3PublishTarget(config *publishConfigEntry) (publishTarget, error) {
+	credsConfig := &awsutil.CredentialsConfig{
+		AccessKey: config.AccessKey,
+		SecretKey: config.SecretKey,
+	}
+	creds, err := credsConfig.GenerateCredentialChain()
+	if err != nil {
+		return nil, err
+	}
+
+	awsConfig := &aws.Config{
+		Credentials: creds,
+		HTTPClient:  cleanhttp.DefaultClient(),
+		Region:      aws.String(config.Region),
+	}
+	if config.Endpoint != "" {
+		awsConfig.Endpoint = aws.String(config.Endpoint)
+		awsConfig.S3ForcePathStyle = aws.Bool(true)
+	}
+
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3PublishTarget{
+		client: s3.New(sess),
+		bucket: config.Bucket,
+	}, nil
+}
+
+func (t *s3PublishTarget) put(ctx context.Context, name string, body []byte, contentType string) error {
+	_, err := t.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(t.bucket),
+		Key:         aws.String(name),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String(contentType),
+	})
+	return err
+}
+
+func (t *s3PublishTarget) close() {}
+
+type gcsPublishTarget struct {
+	client *storage.Client
+	bucket string
+}
+
+func newGCSPublishTarget(ctx context.Context, config *publishConfigEntry) (publishTarget, error) {
+	var opts []option.ClientOption
+	if config.Credentials != "" {
+		opts = append(opts, option.WithCredentialsJSON([]byte(config.Credentials)))
+	}
+	if config.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(config.Endpoint))
+	}
+
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gcsPublishTarget{
+		client: client,
+		bucket: config.Bucket,
+	}, nil
+}
+
+func (t *gcsPublishTarget) put(ctx context.Context, name string, body []byte, contentType string) error {
+	w := t.client.Bucket(t.bucket).Object(name).NewWriter(ctx)
+	w.ContentType = contentType
+	if _, err := w.Write(body); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (t *gcsPublishTarget) close() {
+	t.client.Close()
+}
+
+type azurePublishTarget struct {
+	container azblob.ContainerURL
+}
+
+func newAzurePublishTarget(config *publishConfigEntry) (publishTarget, error) {
+	credential, err := azblob.NewSharedKeyCredential(config.AccountName, config.AccountKey)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", config.AccountName)
+	}
+	containerURL, err := url.Parse(strings.TrimSuffix(endpoint, "/") + "/" + config.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return &azurePublishTarget{
+		container: azblob.NewContainerURL(*containerURL, azblob.NewPipeline(credential, azblob.PipelineOptions{})),
+	}, nil
+}
+
+func (t *azurePublishTarget) put(ctx context.Context, name string, body []byte, contentType string) error {
+	_, err := azblob.UploadBufferToBlockBlob(ctx, body, t.container.NewBlockBlobURL(name), azblob.UploadToBlockBlobOptions{
+		BlobHTTPHeaders: azblob.BlobHTTPHeaders{ContentType: contentType},
+	})
+	return err
+}
+
+func (t *azurePublishTarget) close() {}
@@ -0,0 +1,287 @@
+package pki
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"golang.org/x/crypto/ocsp"
+)
+
+// reasonCRLPathSuffix is appended, along with the reason's name, to a CRL's
+// storage path to find its reason-partitioned CRLs.
+const reasonCRLPathSuffix = "-reason-"
+
+var (
+	oidExtensionReasonCode               = asn1.ObjectIdentifier{2, 5, 29, 21}
+	oidExtensionIssuingDistributionPoint = asn1.ObjectIdentifier{2, 5, 29, 28}
+	namedRevocationReasons               = map[string]int{
+		"unspecified":            ocsp.Unspecified,
+		"key_compromise":         ocsp.KeyCompromise,
+		"ca_compromise":          ocsp.CACompromise,
+		"affiliation_changed":    ocsp.AffiliationChanged,
+		"superseded":             ocsp.Superseded,
+		"cessation_of_operation": ocsp.CessationOfOperation,
+		"privilege_withdrawn":    ocsp.PrivilegeWithdrawn,
+		"aa_compromise":          ocsp.AACompromise,
+		"certificate_hold":       ocsp.CertificateHold,
+	}
+)
+
+// revocationReasonNames lists the accepted reason names, for error messages.
+func revocationReasonNames() string {
+	var names []string
+	for name := range namedRevocationReasons {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// revocationReasonName returns the name of a reason code, as accepted by
+// parseRevocationReason.
+func revocationReasonName(reason int) string {
+	for name, code := range namedRevocationReasons {
+		if code == reason {
+			return name
+		}
+	}
+	return fmt.Sprintf("unknown (%d)", reason)
+}
+
+func parseRevocationReason(name string) (int, error) {
+	reason, ok := namedRevocationReasons[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return 0, fmt.Errorf("unknown revocation reason %q; valid values are %v", name, revocationReasonNames())
+	}
+	return reason, nil
+}
+
+// validateReasonPartitions checks the reasons CRLs may be partitioned by.
+// Partitioning by unspecified isn't meaningful: those entries are exactly
+// the ones relying parties can't filter on.
+func validateReasonPartitions(names []string) error {
+	for _, name := range names {
+		reason, err := parseRevocationReason(name)
+		if err != nil {
+			return err
+		}
+		if reason == ocsp.Unspecified {
+			return fmt.Errorf("CRLs cannot be partitioned by the unspecified reason")
+		}
+	}
+	return nil
+}
+
+// addReasonCodeExtension attaches the CRL entry reasonCode extension (RFC
+// 5280 Section 5.3.1). It is omitted for the unspecified reason, as the RFC
+// recommends.
+func addReasonCodeExtension(revoked *pkix.RevokedCertificate, reason int) error {
+	if reason == ocsp.Unspecified {
+		return nil
+	}
+
+	value, err := asn1.Marshal(asn1.Enumerated(reason))
+	if err != nil {
+		return fmt.Errorf("unable to encode CRL entry reason code: %w", err)
+	}
+
+	revoked.Extensions = append(revoked.Extensions, pkix.Extension{
+		Id:    oidExtensionReasonCode,
+		Value: value,
+	})
+	return nil
+}
+
+// revokedCertReason returns the reason code of a CRL entry, defaulting to
+// unspecified.
+func revokedCertReason(revoked pkix.RevokedCertificate) int {
+	for _, ext := range revoked.Extensions {
+		if !ext.Id.Equal(oidExtensionReasonCode) {
+			continue
+		}
+
+		var reason asn1.Enumerated
+		if rest, err := asn1.Unmarshal(ext.Value, &reason); err == nil && len(rest) == 0 {
+			return int(reason)
+		}
+	}
+	return ocsp.Unspecified
+}
+
+// issuingDistributionPoint is the RFC 5280 Section 5.2.5 extension, less
+// the indirectCRL and onlyContainsAttributeCerts fields which never apply
+// to CRLs built here.
+type issuingDistributionPoint struct {
+	DistributionPoint     distributionPointName `asn1:"optional,tag:0"`
+	OnlyContainsUserCerts bool                  `asn1:"optional,tag:1"`
+	OnlyContainsCACerts   bool                  `asn1:"optional,tag:2"`
+	OnlySomeReasons       asn1.BitString        `asn1:"optional,tag:3"`
+}
+
+// generalNameURITag is the uniformResourceIdentifier GeneralName choice.
+const generalNameURITag = 6
+
+// distributionPointName holds the fullName choice of a DistributionPointName,
+// as URIs.
+type distributionPointName struct {
+	FullName []asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// idpExtension builds the critical issuingDistributionPoint extension from
+// the configured values, if any, and the reason the CRL is partitioned by,
+// if any (pass -1 otherwise). Absent both, no extension is needed.
+func idpExtension(idp *crlIDPConfig, reason int) (*pkix.Extension, error) {
+	var value issuingDistributionPoint
+	if idp != nil {
+		for _, uri := range idp.URIs {
+			value.DistributionPoint.FullName = append(value.DistributionPoint.FullName, asn1.RawValue{
+				Tag:   generalNameURITag,
+				Class: asn1.ClassContextSpecific,
+				Bytes: []byte(uri),
+			})
+		}
+		value.OnlyContainsUserCerts = idp.OnlyContainsUserCerts
+		value.OnlyContainsCACerts = idp.OnlyContainsCACerts
+	}
+	if reason >= 0 {
+		value.OnlySomeReasons = reasonFlags(reason)
+	}
+
+	if len(value.DistributionPoint.FullName) == 0 && !value.OnlyContainsUserCerts && !value.OnlyContainsCACerts && value.OnlySomeReasons.BitLength == 0 {
+		return nil, nil
+	}
+
+	encoded, err := asn1.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode issuing distribution point: %w", err)
+	}
+
+	return &pkix.Extension{
+		Id:       oidExtensionIssuingDistributionPoint,
+		Critical: true,
+		Value:    encoded,
+	}, nil
+}
+
+// reasonFlags builds the ReasonFlags bit string holding just the reason.
+func reasonFlags(reason int) asn1.BitString {
+	// ReasonFlags bits match the reason codes, except for the two codes
+	// following the (unused in ReasonFlags) removeFromCRL code.
+	bit := reason
+	if reason > ocsp.RemoveFromCRL {
+		bit = reason - 2
+	}
+
+	flags := asn1.BitString{
+		Bytes:     make([]byte, bit/8+1),
+		BitLength: bit + 1,
+	}
+	flags.Bytes[bit/8] |= 0x80 >> uint(bit%8)
+	return flags
+}
+
+// filterRevokedByReason returns the entries revoked for the given reason.
+func filterRevokedByReason(revoked []pkix.RevokedCertificate, reason int) []pkix.RevokedCertificate {
+	var filtered []pkix.RevokedCertificate
+	for _, entry := range revoked {
+		if revokedCertReason(entry) == reason {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
+
+// buildReasonPartitionedCRLs builds, alongside a complete CRL, one CRL per
+// configured reason partition containing only the entries revoked for that
+// reason. These share the complete CRL's number and lifetime, but carry an
+// issuingDistributionPoint limiting their scope to the reason.
+func buildReasonPartitionedCRLs(sc *storageContext, crlInfo *crlConfig, thisIssuerId issuerID, revoked []pkix.RevokedCertificate, identifier crlID, crlNumber int64) error {
+	if err := deleteReasonPartitionedCRLs(sc, identifier, crlInfo.ReasonPartitions); err != nil {
+		return err
+	}
+
+	if len(crlInfo.ReasonPartitions) == 0 {
+		return nil
+	}
+
+	crlLifetime, err := time.ParseDuration(crlInfo.Expiry)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error parsing CRL duration of %s", crlInfo.Expiry)}
+	}
+
+	signingBundle, caErr := sc.fetchCAInfoByIssuerId(thisIssuerId, CRLSigningUsage)
+	if caErr != nil {
+		switch caErr.(type) {
+		case errutil.UserError:
+			return errutil.UserError{Err: fmt.Sprintf("could not fetch the CA certificate: %s", caErr)}
+		default:
+			return errutil.InternalError{Err: fmt.Sprintf("error fetching CA certificate: %s", caErr)}
+		}
+	}
+
+	idp, err := sc.getCRLIDPConfig(crlInfo, thisIssuerId)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, name := range crlInfo.ReasonPartitions {
+		reason, err := parseRevocationReason(name)
+		if err != nil {
+			return err
+		}
+
+		ext, err := idpExtension(idp, reason)
+		if err != nil {
+			return err
+		}
+
+		var partition []pkix.RevokedCertificate
+		if !crlInfo.Disable {
+			partition = filterRevokedByReason(revoked, reason)
+		}
+
+		crlBytes, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+			RevokedCertificates: partition,
+			Number:              big.NewInt(crlNumber),
+			ThisUpdate:          now,
+			NextUpdate:          now.Add(crlLifetime),
+			SignatureAlgorithm:  signingBundle.RevocationSigAlg,
+			ExtraExtensions:     []pkix.Extension{*ext},
+		}, signingBundle.Certificate, signingBundle.PrivateKey)
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error creating new %v CRL: %s", name, err)}
+		}
+
+		if err := writeCRL(sc, "crls/"+identifier.String()+reasonCRLPathSuffix+name, crlBytes, crlInfo.CompressCRLs); err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error storing %v CRL: %s", name, err)}
+		}
+	}
+
+	return nil
+}
+
+// deleteReasonPartitionedCRLs removes the reason-partitioned CRLs of the
+// given CRL, except for those partitions which are kept.
+func deleteReasonPartitionedCRLs(sc *storageContext, identifier crlID, keep []string) error {
+	for name := range namedRevocationReasons {
+		if strutil.StrListContains(keep, name) {
+			continue
+		}
+
+		if err := sc.Storage.Delete(sc.Context, "crls/"+identifier.String()+reasonCRLPathSuffix+name); err != nil {
+			return fmt.Errorf("unable to remove %v CRL: %w", name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,199 @@
+package pki
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// retiredCRLPath holds the final CRLs of deleted issuers, keyed by issuer
+// ID. Like the other CRLs, these live in cluster-local storage (under
+// crls/).
+const retiredCRLPath = "crls/retired/"
+
+// buildRetiredIssuerCRL signs one final CRL on behalf of an issuer that is
+// about to be deleted or lose its CRL signing usage, valid for the
+// configured retired_issuer_crl_expiry rather than the usual CRL expiry.
+// Without this, the issuer's last CRL either disappears along with it or is
+// left to expire mid-validity, while certificates it issued may still be in
+// the field.
+//
+// The CRL is written to writePath; the returned bool is false when no CRL
+// was built, because the feature is disabled, the issuer never had a CRL,
+// or an equivalent issuer will continue to maintain the shared CRL.
+//
+// Callers must hold the issuers lock and call this prior to modifying the
+// issuer, as signing requires its CRL signing usage.
+func buildRetiredIssuerCRL(sc *storageContext, issuer *issuerEntry, writePath string) (bool, error) {
+	cfg, err := sc.Backend.crlBuilder.getConfigWithUpdate(sc)
+	if err != nil {
+		return false, err
+	}
+
+	if cfg.Disable || cfg.RetiredIssuerCRLExpiry == "" {
+		return false, nil
+	}
+
+	if err := issuer.EnsureUsage(CRLSigningUsage); err != nil {
+		return false, nil
+	}
+
+	// Once the issuer has expired, so have all the certificates it issued,
+	// and a CRL it signs couldn't be validated anyways.
+	issuerCert, err := issuer.GetCertificate()
+	if err != nil {
+		return false, fmt.Errorf("unable to parse issuer's certificate: %w", err)
+	}
+	if time.Now().After(issuerCert.NotAfter) {
+		return false, nil
+	}
+
+	lifetime, err := time.ParseDuration(cfg.RetiredIssuerCRLExpiry)
+	if err != nil {
+		return false, errutil.InternalError{Err: fmt.Sprintf("error parsing retired issuer CRL duration of %s", cfg.RetiredIssuerCRLExpiry)}
+	}
+
+	cb := sc.Backend.crlBuilder
+	cb._builder.Lock()
+	defer cb._builder.Unlock()
+
+	crlConfig, err := sc.getLocalCRLConfig()
+	if err != nil {
+		return false, fmt.Errorf("unable to fetch cluster-local CRL configuration: %v", err)
+	}
+
+	crlIdentifier, ok := crlConfig.IssuerIDCRLMap[issuer.ID]
+	if !ok || len(crlIdentifier) == 0 {
+		return false, nil
+	}
+
+	// When another issuer with the same key and subject can still sign
+	// CRLs, the shared CRL stays maintained and nothing needs doing.
+	for otherId, otherCRL := range crlConfig.IssuerIDCRLMap {
+		if otherId == issuer.ID || otherCRL != crlIdentifier {
+			continue
+		}
+
+		other, err := sc.fetchIssuerById(otherId)
+		if err != nil {
+			return false, err
+		}
+		if other.EnsureUsage(CRLSigningUsage) == nil {
+			return false, nil
+		}
+	}
+
+	// Bring the complete CRL up to date first, so that any revocations
+	// pending an auto-rebuild are included in the final CRL.
+	if err := buildAnyCRLs(sc, false, false); err != nil {
+		return false, err
+	}
+
+	crlConfig, err = sc.getLocalCRLConfig()
+	if err != nil {
+		return false, fmt.Errorf("unable to fetch cluster-local CRL configuration: %v", err)
+	}
+
+	crlEntry, err := sc.Storage.Get(sc.Context, "crls/"+crlIdentifier.String())
+	if err != nil {
+		return false, err
+	}
+	if crlEntry == nil || len(crlEntry.Value) == 0 {
+		return false, nil
+	}
+
+	lastCRLBytes, err := decompressCRL(crlEntry.Value)
+	if err != nil {
+		return false, err
+	}
+
+	lastCRL, err := x509.ParseDERCRL(lastCRLBytes)
+	if err != nil {
+		return false, fmt.Errorf("unable to parse issuer's current CRL: %v", err)
+	}
+
+	signingBundle, err := sc.fetchCAInfoByIssuerId(issuer.ID, CRLSigningUsage)
+	if err != nil {
+		return false, fmt.Errorf("unable to fetch issuer for signing its final CRL: %v", err)
+	}
+
+	crlNumber := crlConfig.CRLNumberMap[crlIdentifier]
+	crlConfig.CRLNumberMap[crlIdentifier] += 1
+
+	now := time.Now()
+	nextUpdate := now.Add(lifetime)
+	crlBytes, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		RevokedCertificates: lastCRL.TBSCertList.RevokedCertificates,
+		Number:              big.NewInt(crlNumber),
+		ThisUpdate:          now,
+		NextUpdate:          nextUpdate,
+		SignatureAlgorithm:  signingBundle.RevocationSigAlg,
+	}, signingBundle.Certificate, signingBundle.PrivateKey)
+	if err != nil {
+		return false, errutil.InternalError{Err: fmt.Sprintf("error creating final CRL: %s", err)}
+	}
+
+	if err := sc.Storage.Put(sc.Context, &logical.StorageEntry{
+		Key:   writePath,
+		Value: crlBytes,
+	}); err != nil {
+		return false, errutil.InternalError{Err: fmt.Sprintf("error storing final CRL: %s", err)}
+	}
+
+	crlConfig.CRLExpirationMap[crlIdentifier] = nextUpdate
+	crlConfig.LastModified = now.UTC()
+	if err := sc.setLocalCRLConfig(crlConfig); err != nil {
+		return false, fmt.Errorf("unable to persist updated cluster-local CRL config: %v", err)
+	}
+
+	return true, nil
+}
+
+// fetchRetiredIssuerCRL returns the final CRL of a deleted issuer, if one
+// was built.
+func (sc *storageContext) fetchRetiredIssuerCRL(id issuerID) ([]byte, error) {
+	entry, err := sc.Storage.Get(sc.Context, retiredCRLPath+string(id))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	return entry.Value, nil
+}
+
+// tidyRetiredIssuerCRLs removes the final CRLs of deleted issuers which
+// expired more than safetyBuffer ago, returning how many were removed.
+func tidyRetiredIssuerCRLs(sc *storageContext, safetyBuffer time.Duration) (int, error) {
+	ids, err := sc.Storage.List(sc.Context, retiredCRLPath)
+	if err != nil {
+		return 0, fmt.Errorf("unable to list final CRLs of deleted issuers: %w", err)
+	}
+
+	removed := 0
+	for _, id := range ids {
+		crlBytes, err := sc.fetchRetiredIssuerCRL(issuerID(id))
+		if err != nil {
+			return removed, err
+		}
+		if len(crlBytes) > 0 {
+			crl, err := x509.ParseRevocationList(crlBytes)
+			if err == nil && !time.Now().After(crl.NextUpdate.Add(safetyBuffer)) {
+				continue
+			}
+		}
+
+		if err := sc.Storage.Delete(sc.Context, retiredCRLPath+id); err != nil {
+			return removed, fmt.Errorf("unable to remove final CRL of deleted issuer %v: %w", id, err)
+		}
+		removed++
+	}
+
+	return removed, nil
+}
@@ -2,19 +2,37 @@ package pki
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sort"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/vault/api"
 	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/hashicorp/vault/vault"
 
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
 )
 
 func TestBackend_CRL_EnableDisableRoot(t *testing.T) {
@@ -293,6 +311,28 @@ func crlEnableDisableTestForBackend(t *testing.T, b *backend, s logical.Storage,
 		if lenDeltaList != 0 {
 			t.Fatalf("expected zero revoked certificates on the delta CRL due to complete CRL rebuild, found %d", lenDeltaList)
 		}
+
+		// Only the delta CRL may carry the delta CRL indicator, which
+		// references the complete CRL's number.
+		for _, ext := range certList.Extensions {
+			require.False(t, ext.Id.Equal(certutil.DeltaCRLIndicatorOID), "complete CRL carries the delta CRL indicator")
+		}
+		var completeNumber, baseNumber *big.Int
+		for _, ext := range certList.Extensions {
+			if ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 20}) {
+				_, err := asn1.Unmarshal(ext.Value, &completeNumber)
+				require.NoError(t, err)
+			}
+		}
+		for _, ext := range deltaList.Extensions {
+			if ext.Id.Equal(certutil.DeltaCRLIndicatorOID) {
+				_, err := asn1.Unmarshal(ext.Value, &baseNumber)
+				require.NoError(t, err)
+			}
+		}
+		require.NotNil(t, completeNumber)
+		require.NotNil(t, baseNumber, "delta CRL lacks the delta CRL indicator")
+		require.Equal(t, completeNumber, baseNumber)
 	}
 
 	revoke := func(serialIndex int) {
@@ -421,6 +461,501 @@ func TestCrlRebuilder(t *testing.T) {
 		"initial crl time: %#v not before next crl rebuild time: %#v", crl1.ThisUpdate, crl3.ThisUpdate)
 }
 
+func TestDeltaCRLExpiry(t *testing.T) {
+	ctx := context.Background()
+	b, s := createBackendWithStorage(t)
+	sc := b.makeStorageContext(ctx, s)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "Root X1",
+		"key_type":    "ec",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	// Delta CRLs must outlive their rebuild interval and can't outlive the
+	// complete CRL.
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"auto_rebuild":           true,
+		"enable_delta":           true,
+		"delta_rebuild_interval": "15m",
+		"delta_expiry":           "10m",
+	})
+	require.Error(t, err)
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"auto_rebuild": true,
+		"enable_delta": true,
+		"delta_expiry": "96h",
+	})
+	require.Error(t, err)
+
+	resp, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"auto_rebuild":           true,
+		"enable_delta":           true,
+		"delta_rebuild_interval": "15m",
+		"delta_expiry":           "1h",
+	})
+	requireSuccessNilResponse(t, resp, err)
+
+	resp, err = CBRead(b, s, "config/crl")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, "1h", resp.Data["delta_expiry"])
+
+	resp, err = CBRead(b, s, "crl/rotate")
+	requireSuccessNonNilResponse(t, resp, err)
+
+	// The delta CRL gets its own, shorter lifetime, tracked separately from
+	// the complete CRL's.
+	complete := getParsedCrlFromBackend(t, b, s, "crl").TBSCertList
+	delta := getParsedCrlFromBackend(t, b, s, "crl/delta").TBSCertList
+	require.Equal(t, 72*time.Hour, complete.NextUpdate.Sub(complete.ThisUpdate))
+	require.Equal(t, time.Hour, delta.NextUpdate.Sub(delta.ThisUpdate))
+
+	localConfig, err := sc.getLocalCRLConfig()
+	require.NoError(t, err)
+	require.Len(t, localConfig.CRLExpirationMap, 1)
+	require.Len(t, localConfig.DeltaExpirationMap, 1)
+	for id, expiry := range localConfig.DeltaExpirationMap {
+		require.True(t, expiry.Before(localConfig.CRLExpirationMap[id]))
+	}
+
+	// Without new revocations or an expiring delta CRL, nothing happens.
+	require.NoError(t, b.crlBuilder.rebuildDeltaCRLsIfForced(sc))
+	same := getParsedCrlFromBackend(t, b, s, "crl/delta").TBSCertList
+	require.Equal(t, delta.ThisUpdate, same.ThisUpdate)
+
+	// Once the delta CRL comes within the rebuild interval of its expiry,
+	// it is rebuilt, even without new revocations and without touching the
+	// complete CRL.
+	for id := range localConfig.DeltaExpirationMap {
+		localConfig.DeltaExpirationMap[id] = time.Now().Add(5 * time.Minute)
+	}
+	require.NoError(t, sc.setLocalCRLConfig(localConfig))
+
+	require.NoError(t, b.crlBuilder.rebuildDeltaCRLsIfForced(sc))
+	rebuilt := getParsedCrlFromBackend(t, b, s, "crl/delta").TBSCertList
+	require.NotEqual(t, delta.Raw, rebuilt.Raw)
+	require.True(t, rebuilt.NextUpdate.After(time.Now().Add(50*time.Minute)))
+
+	sameComplete := getParsedCrlFromBackend(t, b, s, "crl").TBSCertList
+	require.Equal(t, complete.Raw, sameComplete.Raw)
+
+	localConfig, err = sc.getLocalCRLConfig()
+	require.NoError(t, err)
+	for _, expiry := range localConfig.DeltaExpirationMap {
+		require.True(t, expiry.After(time.Now().Add(50*time.Minute)))
+	}
+}
+
+func TestRetiredIssuerCRL(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "config/crl", map[string]interface{}{
+		"retired_issuer_crl_expiry": "8760h",
+	})
+	requireSuccessNilResponse(t, resp, err)
+
+	resp, err = CBRead(b, s, "config/crl")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, "8760h", resp.Data["retired_issuer_crl_expiry"])
+
+	newIssuerWithRevokedLeaf := func(name string) (string, string) {
+		resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+			"common_name": name,
+			"issuer_name": name,
+			"key_type":    "ec",
+			"ttl":         "72h",
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		issuerId := string(resp.Data["issuer_id"].(issuerID))
+
+		_, err = CBWrite(b, s, "roles/"+name, map[string]interface{}{
+			"allow_any_name": true,
+			"issuer_ref":     name,
+		})
+		require.NoError(t, err)
+
+		resp, err = CBWrite(b, s, "issue/"+name, map[string]interface{}{
+			"common_name": "leaf.example.com",
+			"ttl":         "1h",
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		serial := resp.Data["serial_number"].(string)
+
+		resp, err = CBWrite(b, s, "revoke", map[string]interface{}{
+			"serial_number": serial,
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+
+		return issuerId, serial
+	}
+
+	requireFinalCRL := func(issuerId string, serial string) {
+		crl := getParsedCrlFromBackend(t, b, s, "issuer/"+issuerId+"/crl/der").TBSCertList
+		require.Equal(t, 8760*time.Hour, crl.NextUpdate.Sub(crl.ThisUpdate))
+		require.True(t, requireSerialNumberInCRL(t, crl, serial))
+	}
+
+	// Deleting an issuer leaves its final CRL behind, reachable by ID.
+	deletedId, deletedSerial := newIssuerWithRevokedLeaf("deleted")
+	resp, err = CBDelete(b, s, "issuer/"+deletedId)
+	requireSuccessNonNilResponse(t, resp, err)
+	require.NotEmpty(t, resp.Warnings)
+	requireFinalCRL(deletedId, deletedSerial)
+
+	_, err = CBRead(b, s, "issuer/deleted/crl/der")
+	require.Error(t, err)
+
+	// Archiving an issuer by removing its CRL signing usage replaces its
+	// (otherwise frozen) CRL with the final one.
+	archivedId, archivedSerial := newIssuerWithRevokedLeaf("archived")
+	resp, err = CBPatch(b, s, "issuer/archived", map[string]interface{}{
+		"usage": "read-only,issuing-certificates,ocsp-signing",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	requireFinalCRL(archivedId, archivedSerial)
+
+	// Later rebuilds leave the archived issuer's final CRL alone.
+	resp, err = CBRead(b, s, "crl/rotate")
+	requireSuccessNonNilResponse(t, resp, err)
+	requireFinalCRL(archivedId, archivedSerial)
+
+	// Without the option, nothing is left behind on deletion.
+	resp, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"retired_issuer_crl_expiry": "",
+	})
+	requireSuccessNilResponse(t, resp, err)
+
+	plainId, _ := newIssuerWithRevokedLeaf("plain")
+	resp, err = CBDelete(b, s, "issuer/"+plainId)
+	requireSuccessNonNilResponse(t, resp, err)
+	_, err = CBRead(b, s, "issuer/"+plainId+"/crl/der")
+	require.Error(t, err)
+}
+
+func TestReasonPartitionedCRLs(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "Root X1",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	_, err = CBWrite(b, s, "roles/local", map[string]interface{}{
+		"allow_any_name": true,
+		"ttl":            "1h",
+	})
+	require.NoError(t, err)
+
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"reason_partitions": "unspecified",
+	})
+	require.Error(t, err)
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"reason_partitions": "bogus",
+	})
+	require.Error(t, err)
+
+	resp, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"reason_partitions": "Key_Compromise,superseded",
+	})
+	requireSuccessNilResponse(t, resp, err)
+
+	resp, err = CBRead(b, s, "config/crl")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, []string{"key_compromise", "superseded"}, resp.Data["reason_partitions"])
+
+	revokeLeaf := func(reason string) string {
+		resp, err := CBWrite(b, s, "issue/local", map[string]interface{}{
+			"common_name": "leaf.example.com",
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		serial := resp.Data["serial_number"].(string)
+
+		data := map[string]interface{}{"serial_number": serial}
+		if reason != "" {
+			data["reason"] = reason
+		}
+		resp, err = CBWrite(b, s, "revoke", data)
+		requireSuccessNonNilResponse(t, resp, err)
+		return serial
+	}
+
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": "01:02",
+		"reason":        "bogus",
+	})
+	require.Error(t, err)
+
+	compromised := revokeLeaf("key_compromise")
+	superseded := revokeLeaf("superseded")
+	unspecified := revokeLeaf("")
+
+	// The complete CRL carries every entry, with reason codes where known.
+	complete := getParsedCrlFromBackend(t, b, s, "crl").TBSCertList
+	require.Len(t, complete.RevokedCertificates, 3)
+	for _, entry := range complete.RevokedCertificates {
+		serial := serialFromBigInt(entry.SerialNumber)
+		switch serial {
+		case compromised:
+			require.Equal(t, ocsp.KeyCompromise, revokedCertReason(entry))
+		case superseded:
+			require.Equal(t, ocsp.Superseded, revokedCertReason(entry))
+		case unspecified:
+			require.Empty(t, entry.Extensions)
+		}
+	}
+
+	// Each partition carries only its own entries, scoped by a critical
+	// issuingDistributionPoint.
+	for reason, serial := range map[int]string{
+		ocsp.KeyCompromise: compromised,
+		ocsp.Superseded:    superseded,
+	} {
+		name := map[int]string{ocsp.KeyCompromise: "key_compromise", ocsp.Superseded: "superseded"}[reason]
+		partition := getParsedCrlFromBackend(t, b, s, "issuer/default/crl/reason/"+name+"/der").TBSCertList
+		require.Len(t, partition.RevokedCertificates, 1)
+		require.Equal(t, serial, serialFromBigInt(partition.RevokedCertificates[0].SerialNumber))
+
+		var found bool
+		for _, ext := range partition.Extensions {
+			if !ext.Id.Equal(oidExtensionIssuingDistributionPoint) {
+				continue
+			}
+			found = true
+			require.True(t, ext.Critical)
+
+			var idp issuingDistributionPoint
+			_, err := asn1.Unmarshal(ext.Value, &idp)
+			require.NoError(t, err)
+			require.Equal(t, 1, idp.OnlySomeReasons.At(reason))
+			require.Equal(t, reason+1, idp.OnlySomeReasons.BitLength)
+		}
+		require.True(t, found)
+	}
+
+	// Reasons which aren't partitioned have no CRL.
+	resp, err = CBRead(b, s, "issuer/default/crl/reason/ca_compromise/der")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, 204, resp.Data[logical.HTTPStatusCode])
+
+	_, err = CBRead(b, s, "issuer/default/crl/reason/bogus/der")
+	require.Error(t, err)
+
+	// Dropping the partitions removes their CRLs.
+	resp, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"reason_partitions": "",
+	})
+	requireSuccessNilResponse(t, resp, err)
+
+	resp, err = CBRead(b, s, "issuer/default/crl/reason/key_compromise/der")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, 204, resp.Data[logical.HTTPStatusCode])
+}
+
+func TestCRLPartitions(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "Root X1",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rootId := resp.Data["issuer_id"].(issuerID)
+
+	_, err = CBWrite(b, s, "config/urls", map[string]interface{}{
+		"partition_crl_distribution_points": "http://localhost/{{issuer_id}}/{{crl_partition}}",
+	})
+	require.ErrorContains(t, err, "partition_crl_distribution_points")
+
+	resp, err = CBWrite(b, s, "config/urls", map[string]interface{}{
+		"enable_templating":                 true,
+		"crl_distribution_points":           "http://localhost/v1/pki/crl",
+		"partition_crl_distribution_points": "http://localhost/v1/pki/issuer/{{issuer_id}}/crl/partition/{{crl_partition}}/der",
+	})
+	requireSuccessNilResponse(t, resp, err)
+
+	_, err = CBWrite(b, s, "roles/workloads", map[string]interface{}{
+		"allow_any_name": true,
+		"crl_partition":  "bad.name",
+	})
+	require.ErrorContains(t, err, "invalid CRL partition")
+
+	_, err = CBWrite(b, s, "roles/servers", map[string]interface{}{
+		"allow_any_name": true,
+		"ttl":            "1h",
+	})
+	require.NoError(t, err)
+	resp, err = CBWrite(b, s, "roles/workloads", map[string]interface{}{
+		"allow_any_name": true,
+		"ttl":            "1h",
+		"crl_partition":  "workloads",
+	})
+	require.NoError(t, err)
+	require.Nil(t, resp)
+
+	resp, err = CBRead(b, s, "roles/workloads")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, "workloads", resp.Data["crl_partition"])
+
+	// Partitions in use get a CRL, even before any revocations.
+	_, err = CBRead(b, s, "crl/rotate")
+	require.NoError(t, err)
+	partitionCRL := getParsedCrlFromBackend(t, b, s, "issuer/default/crl/partition/workloads/der").TBSCertList
+	require.Empty(t, partitionCRL.RevokedCertificates)
+
+	issueLeaf := func(role string) (string, *x509.Certificate) {
+		resp, err := CBWrite(b, s, "issue/"+role, map[string]interface{}{
+			"common_name": role + ".example.com",
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		return resp.Data["serial_number"].(string), parseCert(t, resp.Data["certificate"].(string))
+	}
+
+	serverSerial, serverCert := issueLeaf("servers")
+	workloadSerial, workloadCert := issueLeaf("workloads")
+	partitionURL := "http://localhost/v1/pki/issuer/" + rootId.String() + "/crl/partition/workloads/der"
+	require.Equal(t, []string{"http://localhost/v1/pki/crl"}, serverCert.CRLDistributionPoints)
+	require.Equal(t, []string{partitionURL}, workloadCert.CRLDistributionPoints)
+
+	for _, serial := range []string{serverSerial, workloadSerial} {
+		resp, err = CBWrite(b, s, "revoke", map[string]interface{}{"serial_number": serial})
+		requireSuccessNonNilResponse(t, resp, err)
+	}
+
+	// The partitioned revocation is only on the partition's CRL.
+	complete := getParsedCrlFromBackend(t, b, s, "crl").TBSCertList
+	require.Len(t, complete.RevokedCertificates, 1)
+	require.Equal(t, serverSerial, serialFromBigInt(complete.RevokedCertificates[0].SerialNumber))
+
+	partitionCRL = getParsedCrlFromBackend(t, b, s, "issuer/default/crl/partition/workloads/der").TBSCertList
+	require.Len(t, partitionCRL.RevokedCertificates, 1)
+	require.Equal(t, workloadSerial, serialFromBigInt(partitionCRL.RevokedCertificates[0].SerialNumber))
+
+	var found bool
+	for _, ext := range partitionCRL.Extensions {
+		if !ext.Id.Equal(oidExtensionIssuingDistributionPoint) {
+			continue
+		}
+		found = true
+		require.True(t, ext.Critical)
+
+		var idp issuingDistributionPoint
+		_, err := asn1.Unmarshal(ext.Value, &idp)
+		require.NoError(t, err)
+		require.True(t, idp.OnlyContainsUserCerts)
+		require.Len(t, idp.DistributionPoint.FullName, 1)
+		require.Equal(t, partitionURL, string(idp.DistributionPoint.FullName[0].Bytes))
+	}
+	require.True(t, found)
+
+	// Partitions no role uses keep their CRL while they hold revocations;
+	// unknown partitions have none.
+	_, err = CBDelete(b, s, "roles/workloads")
+	require.NoError(t, err)
+	_, err = CBRead(b, s, "crl/rotate")
+	require.NoError(t, err)
+	partitionCRL = getParsedCrlFromBackend(t, b, s, "issuer/default/crl/partition/workloads/der").TBSCertList
+	require.Len(t, partitionCRL.RevokedCertificates, 1)
+
+	resp, err = CBRead(b, s, "issuer/default/crl/partition/other/der")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, 204, resp.Data[logical.HTTPStatusCode])
+
+	_, err = CBRead(b, s, "issuer/default/crl/partition/bad.name/der")
+	require.Error(t, err)
+}
+
+func TestCRLPartitionDeltas(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+	sc := b.makeStorageContext(ctx, s)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "Root X1",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	resp, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"auto_rebuild": true,
+		"enable_delta": true,
+		"delta_expiry": "1h",
+	})
+	requireSuccessNilResponse(t, resp, err)
+
+	// A partition whose name ends in -delta mustn't collide with the delta
+	// CRL of another.
+	for _, partition := range []string{"workloads", "workloads-delta"} {
+		_, err = CBWrite(b, s, "roles/"+partition, map[string]interface{}{
+			"allow_any_name": true,
+			"ttl":            "1h",
+			"crl_partition":  partition,
+		})
+		require.NoError(t, err)
+	}
+
+	_, err = CBRead(b, s, "crl/rotate")
+	require.NoError(t, err)
+
+	resp, err = CBWrite(b, s, "issue/workloads", map[string]interface{}{
+		"common_name": "workloads.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	serial := resp.Data["serial_number"].(string)
+
+	resp, err = CBWrite(b, s, "revoke", map[string]interface{}{"serial_number": serial})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.NoError(t, b.crlBuilder.rebuildDeltaCRLs(sc, false))
+
+	// The revocation reaches the partition's delta CRL before its complete
+	// CRL is rebuilt, and stays off the issuer's delta CRL.
+	complete := getParsedCrlFromBackend(t, b, s, "issuer/default/crl/partition/workloads/der").TBSCertList
+	require.Empty(t, complete.RevokedCertificates)
+
+	delta := getParsedCrlFromBackend(t, b, s, "issuer/default/crl/partition/workloads/delta/der").TBSCertList
+	require.Len(t, delta.RevokedCertificates, 1)
+	require.Equal(t, serial, serialFromBigInt(delta.RevokedCertificates[0].SerialNumber))
+	require.Equal(t, time.Hour, delta.NextUpdate.Sub(delta.ThisUpdate))
+
+	var completeNumber, baseNumber *big.Int
+	for _, ext := range complete.Extensions {
+		if ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 20}) {
+			_, err := asn1.Unmarshal(ext.Value, &completeNumber)
+			require.NoError(t, err)
+		}
+		require.False(t, ext.Id.Equal(certutil.DeltaCRLIndicatorOID), "complete partition CRL carries the delta CRL indicator")
+	}
+	for _, ext := range delta.Extensions {
+		if ext.Id.Equal(certutil.DeltaCRLIndicatorOID) {
+			_, err := asn1.Unmarshal(ext.Value, &baseNumber)
+			require.NoError(t, err)
+		}
+	}
+	require.NotNil(t, completeNumber)
+	require.NotNil(t, baseNumber, "partition delta CRL lacks the delta CRL indicator")
+	require.Equal(t, completeNumber, baseNumber)
+
+	issuerDelta := getParsedCrlFromBackend(t, b, s, "crl/delta").TBSCertList
+	require.Empty(t, issuerDelta.RevokedCertificates)
+
+	other := getParsedCrlFromBackend(t, b, s, "issuer/default/crl/partition/workloads-delta/der").TBSCertList
+	require.Empty(t, other.RevokedCertificates)
+	otherDelta := getParsedCrlFromBackend(t, b, s, "issuer/default/crl/partition/workloads-delta/delta/der").TBSCertList
+	require.Empty(t, otherDelta.RevokedCertificates)
+
+	// Rebuilding the complete CRLs moves the revocation onto the partition's
+	// complete CRL and empties its delta CRL.
+	_, err = CBRead(b, s, "crl/rotate")
+	require.NoError(t, err)
+	complete = getParsedCrlFromBackend(t, b, s, "issuer/default/crl/partition/workloads/der").TBSCertList
+	require.Len(t, complete.RevokedCertificates, 1)
+	delta = getParsedCrlFromBackend(t, b, s, "issuer/default/crl/partition/workloads/delta/der").TBSCertList
+	require.Empty(t, delta.RevokedCertificates)
+}
+
 func TestBYOC(t *testing.T) {
 	t.Parallel()
 
@@ -700,6 +1235,93 @@ func TestPoP(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestPoPSignature(t *testing.T) {
+	t.Parallel()
+
+	for _, keyType := range []string{"rsa", "ec", "ed25519"} {
+		b, s := createBackendWithStorage(t)
+
+		resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+			"common_name": "root example.com",
+			"key_type":    "ec",
+			"ttl":         "72h",
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+
+		_, err = CBWrite(b, s, "roles/local-testing", map[string]interface{}{
+			"allow_any_name":    true,
+			"enforce_hostnames": false,
+			"key_type":          keyType,
+			"ttl":               "75s",
+			"no_store":          "true",
+		})
+		require.NoError(t, err)
+
+		issue := func() (string, crypto.Signer, string) {
+			resp, err := CBWrite(b, s, "issue/local-testing", map[string]interface{}{
+				"common_name": "testing",
+			})
+			requireSuccessNonNilResponse(t, resp, err)
+
+			keyBlock, _ := pem.Decode([]byte(resp.Data["private_key"].(string)))
+			require.NotNil(t, keyBlock)
+			signer, _, err := certutil.ParseDERKey(keyBlock.Bytes)
+			require.NoError(t, err)
+			return resp.Data["certificate"].(string), signer, resp.Data["serial_number"].(string)
+		}
+
+		sign := func(signer crypto.Signer, serial string, reason string, timestamp string) string {
+			message := revocationSignatureMessage(serial, reason, timestamp)
+			var digest []byte
+			opts := crypto.Hash(0)
+			if keyType == "ed25519" {
+				digest = message
+			} else {
+				hashed := sha256.Sum256(message)
+				digest = hashed[:]
+				opts = crypto.SHA256
+			}
+			signature, err := signer.Sign(rand.Reader, digest, opts)
+			require.NoError(t, err)
+			return base64.StdEncoding.EncodeToString(signature)
+		}
+
+		now := time.Now().Format(time.RFC3339)
+		cert, signer, serial := issue()
+		_, otherSigner, _ := issue()
+
+		// Signatures by another key, over another reason, or which are
+		// stale are all refused.
+		for _, request := range []map[string]interface{}{
+			{"reason": "superseded", "timestamp": now, "signature": sign(otherSigner, serial, "superseded", now)},
+			{"reason": "key_compromise", "timestamp": now, "signature": sign(signer, serial, "superseded", now)},
+			{
+				"reason":    "superseded",
+				"timestamp": time.Now().Add(-time.Hour).Format(time.RFC3339),
+				"signature": sign(signer, serial, "superseded", time.Now().Add(-time.Hour).Format(time.RFC3339)),
+			},
+			{"reason": "superseded", "timestamp": now},
+		} {
+			request["certificate"] = cert
+			_, err = CBWrite(b, s, "revoke-with-signature", request)
+			require.Error(t, err, "key type %v", keyType)
+		}
+
+		resp, err = CBWrite(b, s, "revoke-with-signature", map[string]interface{}{
+			"certificate": cert,
+			"reason":      "superseded",
+			"timestamp":   now,
+			"signature":   sign(signer, serial, "superseded", now),
+		})
+		requireSuccessNonNilResponse(t, resp, err, "key type %v", keyType)
+
+		crl := getParsedCrlFromBackend(t, b, s, "crl")
+		requireSerialNumberInCRL(t, crl.TBSCertList, serial)
+		require.Len(t, crl.TBSCertList.RevokedCertificates, 1)
+		require.Equal(t, ocsp.Superseded, revokedCertReason(crl.TBSCertList.RevokedCertificates[0]))
+	}
+}
+
 func TestIssuerRevocation(t *testing.T) {
 	t.Parallel()
 
@@ -1278,6 +1900,42 @@ func TestTidyIssuerAssociation(t *testing.T) {
 	require.Equal(t, newRootID, string(leafInfo.CertificateIssuer))
 }
 
+func TestTidyRevocationIssuerAssociationsSynonym(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "Root R1",
+		"key_type":    "ec",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	// The synonym starts the same tidy operation.
+	resp, err = CBWrite(b, s, "tidy", map[string]interface{}{
+		"tidy_revocation_issuer_associations": true,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	resp = waitForTidyToFinish(t, b, s)
+	require.Equal(t, "Finished", resp.Data["state"])
+	require.Equal(t, true, resp.Data["tidy_revoked_cert_issuer_associations"])
+
+	// In the auto-tidy configuration, it sets the option either way, unless
+	// the option itself is given.
+	for _, test := range []struct {
+		data     map[string]interface{}
+		expected bool
+	}{
+		{map[string]interface{}{"tidy_revocation_issuer_associations": true}, true},
+		{map[string]interface{}{"tidy_revocation_issuer_associations": false}, false},
+		{map[string]interface{}{"tidy_revoked_cert_issuer_associations": true, "tidy_revocation_issuer_associations": false}, true},
+	} {
+		test.data["tidy_cert_store"] = true
+		resp, err = CBWrite(b, s, "config/auto-tidy", test.data)
+		requireSuccessNonNilResponse(t, resp, err)
+		require.Equal(t, test.expected, resp.Data["tidy_revoked_cert_issuer_associations"], "given %v", test.data)
+	}
+}
+
 func requestCrlFromBackend(t *testing.T, s logical.Storage, b *backend) *logical.Response {
 	crlReq := &logical.Request{
 		Operation: logical.ReadOperation,
@@ -1290,3 +1948,1806 @@ func requestCrlFromBackend(t *testing.T, s logical.Storage, b *backend) *logical
 	require.False(t, resp.IsError(), "crl error response: %v", resp)
 	return resp
 }
+
+func TestCRLBuilderState(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	issuerId := string(resp.Data["issuer_id"].(issuerID))
+
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"auto_rebuild": true,
+		"enable_delta": true,
+	})
+	require.NoError(t, err)
+
+	resp, err = CBRead(b, s, "crl/rotate")
+	requireSuccessNonNilResponse(t, resp, err)
+
+	resp, err = CBRead(b, s, "crl/builder-state")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, false, resp.Data["force_rebuild_pending"])
+	require.Equal(t, false, resp.Data["build_in_progress"])
+	require.Equal(t, true, resp.Data["loaded_config_matches_stored"])
+	require.NotEmpty(t, resp.Data["last_delta_rebuild_check"])
+
+	crls := resp.Data["crls"].(map[string]interface{})
+	require.Len(t, crls, 1)
+	for _, rawInfo := range crls {
+		info := rawInfo.(map[string]interface{})
+		require.Equal(t, []string{issuerId}, info["issuers"])
+		require.NotEmpty(t, info["expiration"])
+		require.NotEmpty(t, info["last_build"])
+		require.NotEmpty(t, info["delta_expiration"])
+		require.NotEmpty(t, info["last_delta_build"])
+	}
+
+	// A config change landing in storage without an invalidation (as can
+	// happen on a secondary) shows up as a mismatch until reloaded.
+	entry, err := logical.StorageEntryJSON("config/crl", &crlConfig{
+		Version: 1,
+		Expiry:  "24h",
+		Disable: true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.Put(ctx, entry))
+
+	resp, err = CBRead(b, s, "crl/builder-state")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, false, resp.Data["loaded_config_matches_stored"])
+	require.Equal(t, false, resp.Data["loaded_config"].(map[string]interface{})["disable"])
+	require.Equal(t, true, resp.Data["stored_config"].(map[string]interface{})["disable"])
+
+	b.crlBuilder.markConfigDirty()
+	b.crlBuilder.requestRebuildIfActiveNode(b)
+	resp, err = CBRead(b, s, "crl/builder-state")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, true, resp.Data["config_dirty"])
+	require.Equal(t, true, resp.Data["force_rebuild_pending"])
+}
+
+func TestCRLRebuildIntentSurvivesFailover(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+	sc := b.makeStorageContext(ctx, s)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	// Requesting a rebuild persists the intent before returning.
+	b.crlBuilder.requestRebuildIfActiveNode(b)
+	entry, err := s.Get(ctx, crlRebuildIntentPath)
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+
+	// A new backend instance over the same storage (as on the node taking
+	// over) picks the rebuild up on initialization.
+	config := logical.TestBackendConfig()
+	config.StorageView = s
+	b2 := Backend(config)
+	require.NoError(t, b2.Setup(ctx, config))
+	require.False(t, b2.crlBuilder.forceRebuild.Load())
+	require.NoError(t, b2.initialize(ctx, &logical.InitializationRequest{Storage: s}))
+	require.True(t, b2.crlBuilder.forceRebuild.Load())
+
+	// Completing the rebuild clears it.
+	req := &logical.Request{Storage: s}
+	require.NoError(t, b2.crlBuilder.rebuildIfForced(ctx, b2, req))
+	require.False(t, b2.crlBuilder.forceRebuild.Load())
+	entry, err = sc.Storage.Get(ctx, crlRebuildIntentPath)
+	require.NoError(t, err)
+	require.Nil(t, entry)
+}
+
+func TestCertificateHoldAndUnrevoke(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	_, err = CBWrite(b, s, "roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"ttl":              "1h",
+	})
+	require.NoError(t, err)
+
+	issue := func() string {
+		resp, err := CBWrite(b, s, "issue/example", map[string]interface{}{
+			"common_name": "test.example.com",
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		return resp.Data["serial_number"].(string)
+	}
+
+	// Place a certificate on hold; it shows up on the CRL with that reason.
+	held := issue()
+	resp, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": held,
+		"reason":        "certificate_hold",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	crl := getParsedCrlFromBackend(t, b, s, "crl")
+	requireSerialNumberInCRL(t, crl.TBSCertList, held)
+	require.Len(t, crl.TBSCertList.RevokedCertificates, 1)
+	require.Equal(t, ocsp.CertificateHold, revokedCertReason(crl.TBSCertList.RevokedCertificates[0]))
+
+	// Releasing it removes it from storage and the rebuilt CRL.
+	resp, err = CBWrite(b, s, "unrevoke", map[string]interface{}{
+		"serial_number": held,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	crl = getParsedCrlFromBackend(t, b, s, "crl")
+	require.Empty(t, crl.TBSCertList.RevokedCertificates)
+	entry, err := s.Get(ctx, revokedPath+normalizeSerial(held))
+	require.NoError(t, err)
+	require.Nil(t, entry)
+
+	// Unrevoking a certificate that isn't revoked fails.
+	_, err = CBWrite(b, s, "unrevoke", map[string]interface{}{
+		"serial_number": held,
+	})
+	require.Error(t, err)
+
+	// Other revocations are final.
+	revoked := issue()
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": revoked,
+		"reason":        "key_compromise",
+	})
+	require.NoError(t, err)
+	_, err = CBWrite(b, s, "unrevoke", map[string]interface{}{
+		"serial_number": revoked,
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cannot be unrevoked")
+
+	// A certificate on hold can be revoked for good, after which it can no
+	// longer be released.
+	escalated := issue()
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": escalated,
+		"reason":        "certificate_hold",
+	})
+	require.NoError(t, err)
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": escalated,
+		"reason":        "superseded",
+	})
+	require.NoError(t, err)
+	_, err = CBWrite(b, s, "unrevoke", map[string]interface{}{
+		"serial_number": escalated,
+	})
+	require.Error(t, err)
+
+	crl = getParsedCrlFromBackend(t, b, s, "crl")
+	reasons := make(map[string]int)
+	for _, revokedCert := range crl.TBSCertList.RevokedCertificates {
+		reasons[serialFromBigInt(revokedCert.SerialNumber)] = revokedCertReason(revokedCert)
+	}
+	require.Equal(t, map[string]int{
+		revoked:   ocsp.KeyCompromise,
+		escalated: ocsp.Superseded,
+	}, reasons)
+}
+
+func TestCRLBackgroundRebuild(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+	defer b.Cleanup(ctx)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	// Without auto_rebuild, CRLs nearing expiry are still rebuilt by the
+	// background worker.
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"expiry":                    "1m",
+		"auto_rebuild_grace_period": "59s",
+		"background_rebuild":        true,
+	})
+	require.NoError(t, err)
+
+	resp, err = CBRead(b, s, "config/crl")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, true, resp.Data["background_rebuild"])
+	require.Equal(t, false, resp.Data["auto_rebuild"])
+
+	resp, err = CBRead(b, s, "crl/rotate")
+	requireSuccessNonNilResponse(t, resp, err)
+
+	nextCRLNumber := func() uint64 {
+		resp, err := CBRead(b, s, "crl/builder-state")
+		requireSuccessNonNilResponse(t, resp, err)
+		crls := resp.Data["crls"].(map[string]interface{})
+		require.Len(t, crls, 1)
+		for _, info := range crls {
+			return uint64(info.(map[string]interface{})["next_crl_number"].(int64))
+		}
+		return 0
+	}
+	initial := nextCRLNumber()
+
+	require.Eventually(t, func() bool {
+		require.NoError(t, b.periodicFunc(ctx, &logical.Request{Storage: s}))
+		return nextCRLNumber() > initial
+	}, 10*time.Second, 250*time.Millisecond)
+	require.True(t, b.crlBuilder.worker.running())
+
+	b.Cleanup(ctx)
+	require.False(t, b.crlBuilder.worker.running())
+}
+
+func TestStoppableWorker(t *testing.T) {
+	t.Parallel()
+
+	var w stoppableWorker
+	started := make(chan struct{})
+	exited := make(chan struct{})
+	run := func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		close(exited)
+	}
+
+	w.start(run)
+	<-started
+	require.True(t, w.running())
+
+	// Starting again is a no-op while running.
+	w.start(func(ctx context.Context) { t.Error("started a second goroutine") })
+
+	// Stopping doesn't block on the goroutine, but cancels it.
+	w.stop()
+	require.False(t, w.running())
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker goroutine wasn't canceled")
+	}
+
+	// Stopping again is a no-op, and the worker can be restarted.
+	w.stop()
+	restarted := make(chan struct{})
+	w.start(func(ctx context.Context) { close(restarted) })
+	<-restarted
+	w.stop()
+}
+
+func TestRevocationIndex(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	_, err = CBWrite(b, s, "roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"ttl":              "1h",
+	})
+	require.NoError(t, err)
+
+	issueAndRevoke := func(reason string) string {
+		resp, err := CBWrite(b, s, "issue/example", map[string]interface{}{
+			"common_name": "test.example.com",
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		serial := resp.Data["serial_number"].(string)
+
+		resp, err = CBWrite(b, s, "revoke", map[string]interface{}{
+			"serial_number": serial,
+			"reason":        reason,
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		return serial
+	}
+
+	requireCRLReasons := func(expected map[string]int) {
+		crl := getParsedCrlFromBackend(t, b, s, "crl")
+		reasons := make(map[string]int)
+		for _, revokedCert := range crl.TBSCertList.RevokedCertificates {
+			reasons[serialFromBigInt(revokedCert.SerialNumber)] = revokedCertReason(revokedCert)
+		}
+		require.Equal(t, expected, reasons)
+	}
+
+	// Revocations predating the index are picked up when it is built.
+	before := issueAndRevoke("key_compromise")
+	ready, err := b.makeStorageContext(ctx, s).isRevocationIndexReady()
+	require.NoError(t, err)
+	require.False(t, ready)
+
+	require.NoError(t, b.periodicFunc(ctx, &logical.Request{Storage: s}))
+	ready, err = b.makeStorageContext(ctx, s).isRevocationIndexReady()
+	require.NoError(t, err)
+	require.True(t, ready)
+
+	shard, err := b.makeStorageContext(ctx, s).fetchRevocationIndexShard(revocationIndexShardName(before))
+	require.NoError(t, err)
+	require.Contains(t, shard.Entries, normalizeSerial(before))
+
+	// Later revocations, changes of reason, and unrevocations are
+	// reflected in CRLs built from the index.
+	after := issueAndRevoke("superseded")
+	held := issueAndRevoke("certificate_hold")
+	released := issueAndRevoke("certificate_hold")
+	requireCRLReasons(map[string]int{
+		before:   ocsp.KeyCompromise,
+		after:    ocsp.Superseded,
+		held:     ocsp.CertificateHold,
+		released: ocsp.CertificateHold,
+	})
+
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": held,
+		"reason":        "cessation_of_operation",
+	})
+	require.NoError(t, err)
+	_, err = CBWrite(b, s, "unrevoke", map[string]interface{}{
+		"serial_number": released,
+	})
+	require.NoError(t, err)
+	requireCRLReasons(map[string]int{
+		before: ocsp.KeyCompromise,
+		after:  ocsp.Superseded,
+		held:   ocsp.CessationOfOperation,
+	})
+
+	// Built from the index, the CRL no longer requires loading (and so
+	// parsing) each revoked certificate.
+	storagePath := revokedPath + normalizeSerial(before)
+	entry, err := s.Get(ctx, storagePath)
+	require.NoError(t, err)
+	var revInfo revocationInfo
+	require.NoError(t, entry.DecodeJSON(&revInfo))
+	revInfo.CertificateBytes = []byte("not a certificate")
+	entry, err = logical.StorageEntryJSON(storagePath, revInfo)
+	require.NoError(t, err)
+	require.NoError(t, s.Put(ctx, entry))
+
+	resp, err = CBRead(b, s, "crl/rotate")
+	requireSuccessNonNilResponse(t, resp, err)
+	requireCRLReasons(map[string]int{
+		before: ocsp.KeyCompromise,
+		after:  ocsp.Superseded,
+		held:   ocsp.CessationOfOperation,
+	})
+
+	// A revocation whose index entry went missing, as when it failed
+	// between the two writes, is repaired by revoking it again.
+	sc := b.makeStorageContext(ctx, s)
+	name := revocationIndexShardName(normalizeSerial(after))
+	shard, err = sc.fetchRevocationIndexShard(name)
+	require.NoError(t, err)
+	delete(shard.Entries, normalizeSerial(after))
+	require.NoError(t, sc.writeRevocationIndexShard(name, shard))
+
+	resp, err = CBRead(b, s, "crl/rotate")
+	requireSuccessNonNilResponse(t, resp, err)
+	requireCRLReasons(map[string]int{
+		before: ocsp.KeyCompromise,
+		held:   ocsp.CessationOfOperation,
+	})
+
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": after,
+	})
+	require.NoError(t, err)
+	requireCRLReasons(map[string]int{
+		before: ocsp.KeyCompromise,
+		after:  ocsp.Superseded,
+		held:   ocsp.CessationOfOperation,
+	})
+}
+
+// Verify that serials sharing a prefix, as with serial_number_prefix, are
+// still spread across revocation index shards.
+func TestRevocationIndexShardName(t *testing.T) {
+	t.Parallel()
+
+	shards := make(map[string]bool)
+	for i := 0; i < 256; i++ {
+		name := revocationIndexShardName(fmt.Sprintf("ab-cd-ef-00-00-%02x", i))
+		require.Len(t, name, revocationIndexShardDigits)
+		shards[name] = true
+	}
+	require.Greater(t, len(shards), 200)
+
+	require.Equal(t, revocationIndexShardName("ab:cd:ef"), revocationIndexShardName("AB-CD-EF"))
+}
+
+// Verify that changes made while the revocation index is being built are
+// applied to it, rather than blocking on the build.
+func TestRevocationIndexJournal(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+	sc := b.makeStorageContext(ctx, s)
+
+	kept := &revocationInfo{RevocationTimeUTC: time.Now().UTC(), Reason: ocsp.KeyCompromise}
+	removed := &revocationInfo{RevocationTimeUTC: time.Now().UTC()}
+	require.NoError(t, writeRevocationEntry(sc, "01-02", removed))
+
+	// Revocations are journaled, rather than indexed, during a build.
+	b.revocationIndexJournal = make(map[string]*revocationInfo)
+	require.NoError(t, writeRevocationEntry(sc, "01-01", kept))
+	require.NoError(t, deleteRevocationEntry(sc, "01-02"))
+	require.Len(t, b.revocationIndexJournal, 2)
+	require.Nil(t, b.revocationIndexJournal["01-02"])
+
+	// And a concurrent build leaves it to the one in progress.
+	require.NoError(t, buildRevocationIndex(sc))
+	ready, err := sc.isRevocationIndexReady()
+	require.NoError(t, err)
+	require.False(t, ready)
+
+	// Once the build runs, the index reflects both.
+	b.revocationIndexJournal = nil
+	require.NoError(t, buildRevocationIndex(sc))
+	require.Nil(t, b.revocationIndexJournal)
+	shard, err := sc.fetchRevocationIndexShard(revocationIndexShardName("01-01"))
+	require.NoError(t, err)
+	require.Contains(t, shard.Entries, "01-01")
+	require.Equal(t, ocsp.KeyCompromise, shard.Entries["01-01"].Reason)
+	require.NotContains(t, shard.Entries, "01-02")
+}
+
+func TestMaxCRLEntries(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	_, err = CBWrite(b, s, "roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"ttl":              "1h",
+	})
+	require.NoError(t, err)
+
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"max_crl_entries_behavior": "drop",
+	})
+	require.Error(t, err)
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"max_crl_entries": -1,
+	})
+	require.Error(t, err)
+
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"max_crl_entries": 2,
+	})
+	require.NoError(t, err)
+	resp, err = CBRead(b, s, "config/crl")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, 2, resp.Data["max_crl_entries"])
+	require.Equal(t, "error", resp.Data["max_crl_entries_behavior"])
+
+	var serials []string
+	for i := 0; i < 3; i++ {
+		resp, err := CBWrite(b, s, "issue/example", map[string]interface{}{
+			"common_name": "test.example.com",
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		serials = append(serials, resp.Data["serial_number"].(string))
+	}
+
+	for _, serial := range serials[:2] {
+		_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+			"serial_number": serial,
+		})
+		require.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The third revocation is recorded, but the CRL can't be built.
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": serials[2],
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "max_crl_entries")
+	entry, err := s.Get(ctx, revokedPath+normalizeSerial(serials[2]))
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+
+	crl := getParsedCrlFromBackend(t, b, s, "crl")
+	require.Len(t, crl.TBSCertList.RevokedCertificates, 2)
+
+	// Truncating keeps the most recent revocations instead.
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"max_crl_entries_behavior": "truncate",
+	})
+	require.NoError(t, err)
+	resp, err = CBRead(b, s, "crl/rotate")
+	requireSuccessNonNilResponse(t, resp, err)
+
+	crl = getParsedCrlFromBackend(t, b, s, "crl")
+	require.Len(t, crl.TBSCertList.RevokedCertificates, 2)
+	requireSerialNumberInCRL(t, crl.TBSCertList, serials[1])
+	requireSerialNumberInCRL(t, crl.TBSCertList, serials[2])
+}
+
+func TestAllowExpiredCertRevocation(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	_, err = CBWrite(b, s, "roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"ttl":              "1h",
+	})
+	require.NoError(t, err)
+
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"expired_cert_revocation_window": "-1h",
+	})
+	require.Error(t, err)
+
+	resp, err = CBWrite(b, s, "issue/example", map[string]interface{}{
+		"common_name": "test.example.com",
+		"ttl":         "2s",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	serial := resp.Data["serial_number"].(string)
+	time.Sleep(3 * time.Second)
+
+	// By default, expired certificates are refused.
+	resp, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": serial,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	require.NotEmpty(t, resp.Warnings)
+	require.Contains(t, resp.Warnings[0], "already expired")
+
+	// Nor are they accepted once outside the window.
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"allow_expired_cert_revocation":  true,
+		"expired_cert_revocation_window": "1ms",
+	})
+	require.NoError(t, err)
+	resp, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": serial,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.Warnings)
+
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"expired_cert_revocation_window": "1h",
+	})
+	require.NoError(t, err)
+	resp, err = CBRead(b, s, "config/crl")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, true, resp.Data["allow_expired_cert_revocation"])
+	require.Equal(t, "1h", resp.Data["expired_cert_revocation_window"])
+
+	// Auto-tidy would remove the revocation of a certificate expired for
+	// longer than its safety_buffer, so that limits the window too.
+	_, err = CBWrite(b, s, "config/auto-tidy", map[string]interface{}{
+		"enabled":            true,
+		"tidy_revoked_certs": true,
+		"safety_buffer":      "1s",
+	})
+	require.NoError(t, err)
+	resp, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": serial,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.Warnings)
+
+	_, err = CBWrite(b, s, "config/auto-tidy", map[string]interface{}{
+		"safety_buffer": "1h",
+	})
+	require.NoError(t, err)
+
+	resp, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": serial,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Empty(t, resp.Warnings)
+	require.NotNil(t, resp.Data["revocation_time"])
+
+	crl := getParsedCrlFromBackend(t, b, s, "crl")
+	requireSerialNumberInCRL(t, crl.TBSCertList, serial)
+}
+
+func TestListRevokedCerts(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"issuer_name": "root-1",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	resp, err = CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"issuer_name": "root-2",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	issuer2 := resp.Data["issuer_id"].(issuerID)
+
+	var serials []string
+	var midpoint time.Time
+	for i, issuer := range []string{"root-1", "root-1", "root-2"} {
+		_, err = CBWrite(b, s, "roles/example-"+issuer, map[string]interface{}{
+			"allowed_domains":  "example.com",
+			"allow_subdomains": true,
+			"issuer_ref":       issuer,
+			"ttl":              "1h",
+		})
+		require.NoError(t, err)
+
+		resp, err = CBWrite(b, s, "issue/example-"+issuer, map[string]interface{}{
+			"common_name": "test.example.com",
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		serial := resp.Data["serial_number"].(string)
+		serials = append(serials, serial)
+
+		if i == 2 {
+			time.Sleep(1100 * time.Millisecond)
+			midpoint = time.Now()
+		}
+		_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+			"serial_number": serial,
+			"reason":        "superseded",
+		})
+		require.NoError(t, err)
+	}
+	sort.Strings(serials)
+
+	list := func(data map[string]interface{}) []string {
+		resp, err := CBReq(b, s, logical.ListOperation, "certs/revoked", data)
+		requireSuccessNonNilResponse(t, resp, err)
+		if resp.Data["keys"] == nil {
+			return nil
+		}
+		return resp.Data["keys"].([]string)
+	}
+
+	for _, indexed := range []bool{false, true} {
+		if indexed {
+			require.NoError(t, b.buildRevocationIndexIfRequired(ctx, s))
+		}
+
+		require.Equal(t, serials, list(map[string]interface{}{}))
+
+		// Paging.
+		require.Equal(t, serials[:2], list(map[string]interface{}{"limit": 2}))
+		require.Equal(t, serials[2:], list(map[string]interface{}{"limit": 2, "after": serials[1]}))
+
+		// Filtering by issuer and by revocation time.
+		resp, err := CBReq(b, s, logical.ListOperation, "certs/revoked", map[string]interface{}{"issuer_ref": "root-2"})
+		requireSuccessNonNilResponse(t, resp, err)
+		require.Len(t, resp.Data["keys"], 1)
+		info := resp.Data["key_info"].(map[string]interface{})[resp.Data["keys"].([]string)[0]].(map[string]interface{})
+		require.Equal(t, issuer2, info["issuer_id"])
+		require.Equal(t, "superseded", info["reason"])
+		require.NotEmpty(t, info["revocation_time_rfc3339"])
+
+		require.Len(t, list(map[string]interface{}{"revoked_after": midpoint.Format(time.RFC3339)}), 1)
+		require.Len(t, list(map[string]interface{}{"revoked_before": midpoint.Format(time.RFC3339)}), 2)
+	}
+
+	_, err = CBReq(b, s, logical.ListOperation, "certs/revoked", map[string]interface{}{"revoked_after": "yesterday"})
+	require.Error(t, err)
+}
+
+func TestRevocationMetadata(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	_, err = CBWrite(b, s, "roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"ttl":              "1h",
+	})
+	require.NoError(t, err)
+
+	var serials []string
+	for i := 0; i < 2; i++ {
+		resp, err := CBWrite(b, s, "issue/example", map[string]interface{}{
+			"common_name": "test.example.com",
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		serials = append(serials, resp.Data["serial_number"].(string))
+	}
+
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": serials[0],
+		"ticket_id":     "SEC-1234",
+		"requester":     "alice@example.com",
+		"note":          "key found in public repository",
+	})
+	require.NoError(t, err)
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": serials[1],
+	})
+	require.NoError(t, err)
+
+	expected := map[string]interface{}{
+		"ticket_id": "SEC-1234",
+		"requester": "alice@example.com",
+		"note":      "key found in public repository",
+	}
+
+	resp, err = CBRead(b, s, "cert/"+serials[0])
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, expected, resp.Data["revocation_metadata"])
+
+	resp, err = CBRead(b, s, "cert/"+serials[1])
+	requireSuccessNonNilResponse(t, resp, err)
+	require.NotContains(t, resp.Data, "revocation_metadata")
+
+	for _, indexed := range []bool{false, true} {
+		if indexed {
+			require.NoError(t, b.buildRevocationIndexIfRequired(ctx, s))
+		}
+
+		resp, err = CBList(b, s, "certs/revoked")
+		requireSuccessNonNilResponse(t, resp, err)
+		keyInfo := resp.Data["key_info"].(map[string]interface{})
+		require.Equal(t, expected, keyInfo[serials[0]].(map[string]interface{})["revocation_metadata"])
+		require.NotContains(t, keyInfo[serials[1]], "revocation_metadata")
+	}
+}
+
+func TestCompressedCRLs(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	_, err = CBWrite(b, s, "roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"ttl":              "1h",
+	})
+	require.NoError(t, err)
+
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"compress_crls": true,
+	})
+	require.NoError(t, err)
+	resp, err = CBRead(b, s, "config/crl")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, true, resp.Data["compress_crls"])
+
+	resp, err = CBWrite(b, s, "issue/example", map[string]interface{}{
+		"common_name": "test.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	serial := resp.Data["serial_number"].(string)
+
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": serial,
+	})
+	require.NoError(t, err)
+
+	// The stored CRL is compressed...
+	sc := b.makeStorageContext(ctx, s)
+	crlPath, err := sc.resolveIssuerCRLPath(defaultRef)
+	require.NoError(t, err)
+	entry, err := s.Get(ctx, crlPath)
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+	require.True(t, isCompressedCRL(entry.Value))
+
+	// ...but served decompressed by default.
+	for _, path := range []string{"crl", "issuer/default/crl/der"} {
+		crl := getParsedCrlFromBackend(t, b, s, path)
+		requireSerialNumberInCRL(t, crl.TBSCertList, serial)
+	}
+	resp, err = CBRead(b, s, "crl/pem")
+	requireSuccessNonNilResponse(t, resp, err)
+	block, _ := pem.Decode(resp.Data[logical.HTTPRawBody].([]byte))
+	require.NotNil(t, block)
+	_, err = x509.ParseDERCRL(block.Bytes)
+	require.NoError(t, err)
+
+	// Clients accepting gzip get the compressed DER CRL as stored.
+	for _, path := range []string{"crl", "issuer/default/crl/der"} {
+		resp, err = b.HandleRequest(ctx, &logical.Request{
+			Operation:  logical.ReadOperation,
+			Path:       path,
+			Storage:    s,
+			MountPoint: "pki/",
+			Headers: map[string][]string{
+				"Accept-Encoding": {"br;q=1.0, gzip;q=0.8"},
+			},
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		require.Equal(t, []string{"gzip"}, resp.Headers["Content-Encoding"])
+		body := resp.Data[logical.HTTPRawBody].([]byte)
+		require.Equal(t, entry.Value, body)
+
+		der, err := decompressCRL(body)
+		require.NoError(t, err)
+		crl, err := x509.ParseDERCRL(der)
+		require.NoError(t, err)
+		requireSerialNumberInCRL(t, crl.TBSCertList, serial)
+	}
+
+	// Unless they've refused it.
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation:  logical.ReadOperation,
+		Path:       "crl",
+		Storage:    s,
+		MountPoint: "pki/",
+		Headers: map[string][]string{
+			"Accept-Encoding": {"gzip;q=0"},
+		},
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Empty(t, resp.Headers["Content-Encoding"])
+	require.False(t, isCompressedCRL(resp.Data[logical.HTTPRawBody].([]byte)))
+}
+
+func TestCRLIssuingDistributionPoint(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	getIDP := func(path string) *issuingDistributionPoint {
+		crl := getParsedCrlFromBackend(t, b, s, path)
+		for _, ext := range crl.TBSCertList.Extensions {
+			if !ext.Id.Equal(oidExtensionIssuingDistributionPoint) {
+				continue
+			}
+			require.True(t, ext.Critical)
+
+			var idp issuingDistributionPoint
+			rest, err := asn1.Unmarshal(ext.Value, &idp)
+			require.NoError(t, err)
+			require.Empty(t, rest)
+			return &idp
+		}
+		return nil
+	}
+	uris := func(idp *issuingDistributionPoint) []string {
+		var ret []string
+		for _, name := range idp.DistributionPoint.FullName {
+			require.Equal(t, generalNameURITag, name.Tag)
+			ret = append(ret, string(name.Bytes))
+		}
+		return ret
+	}
+
+	// No extension by default.
+	require.Nil(t, getIDP("crl"))
+
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"idp_only_contains_user_certs": true,
+		"idp_only_contains_ca_certs":   true,
+	})
+	require.Error(t, err)
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"idp_uris": "not a url",
+	})
+	require.Error(t, err)
+
+	// Setting the extension rotates the CRL, including delta CRLs.
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"idp_uris":                     "http://crl.example.com/root.crl",
+		"idp_only_contains_user_certs": true,
+		"auto_rebuild":                 true,
+		"enable_delta":                 true,
+	})
+	require.NoError(t, err)
+	resp, err = CBRead(b, s, "config/crl")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, []string{"http://crl.example.com/root.crl"}, resp.Data["idp_uris"])
+	require.Equal(t, true, resp.Data["idp_only_contains_user_certs"])
+
+	idp := getIDP("crl")
+	require.NotNil(t, idp)
+	require.Equal(t, []string{"http://crl.example.com/root.crl"}, uris(idp))
+	require.True(t, idp.OnlyContainsUserCerts)
+	require.False(t, idp.OnlyContainsCACerts)
+
+	idp = getIDP("crl/delta")
+	require.NotNil(t, idp)
+	require.Equal(t, []string{"http://crl.example.com/root.crl"}, uris(idp))
+
+	// Issuers may override the mount-wide values.
+	resp, err = CBPatch(b, s, "issuer/default", map[string]interface{}{
+		"idp_uris": "http://crl.example.com/override.crl",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, []string{"http://crl.example.com/override.crl"}, resp.Data["idp_uris"])
+	require.Equal(t, false, resp.Data["idp_only_contains_user_certs"])
+
+	resp, err = CBRead(b, s, "crl/rotate")
+	requireSuccessNonNilResponse(t, resp, err)
+	idp = getIDP("issuer/default/crl/der")
+	require.NotNil(t, idp)
+	require.Equal(t, []string{"http://crl.example.com/override.crl"}, uris(idp))
+	require.False(t, idp.OnlyContainsUserCerts)
+
+	// Clearing the override restores them.
+	resp, err = CBPatch(b, s, "issuer/default", map[string]interface{}{
+		"idp_uris": "",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, []string{}, resp.Data["idp_uris"])
+
+	resp, err = CBRead(b, s, "crl/rotate")
+	requireSuccessNonNilResponse(t, resp, err)
+	idp = getIDP("crl")
+	require.NotNil(t, idp)
+	require.Equal(t, []string{"http://crl.example.com/root.crl"}, uris(idp))
+	require.True(t, idp.OnlyContainsUserCerts)
+}
+
+func TestCRLSigningWithManagedKey(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	keyId := resp.Data["key_id"].(keyID)
+
+	// Software keys sign through the same signer path.
+	sc := b.makeStorageContext(ctx, s)
+	issuerId := resp.Data["issuer_id"].(issuerID)
+	caInfo, err := sc.fetchCAInfoByIssuerId(issuerId, CRLSigningUsage)
+	require.NoError(t, err)
+	require.NotNil(t, caInfo.PrivateKey)
+	require.Equal(t, certutil.ECPrivateKey, caInfo.PrivateKeyType)
+
+	_, err = CBRead(b, s, "crl/rotate")
+	require.NoError(t, err)
+
+	// Reference a managed key instead; signing now goes through the managed
+	// key signer, which is unavailable here, rather than failing to parse
+	// the raw private key.
+	key, err := sc.fetchKeyById(keyId)
+	require.NoError(t, err)
+	key.PrivateKeyType = certutil.ManagedPrivateKey
+	key.PrivateKey = "managed-key-uuid"
+	require.NoError(t, sc.writeKey(*key))
+
+	_, err = sc.fetchCAInfoByIssuerId(issuerId, CRLSigningUsage)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "managed key")
+
+	_, err = CBRead(b, s, "crl/rotate")
+	require.Error(t, err)
+}
+
+func TestCRLConditionalRequests(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	fetch := func(path string, headers map[string][]string) *logical.Response {
+		resp, err := b.HandleRequest(ctx, &logical.Request{
+			Operation:  logical.ReadOperation,
+			Path:       path,
+			Storage:    s,
+			Headers:    headers,
+			MountPoint: "pki/",
+		})
+		require.NoError(t, err)
+		require.NotNil(t, resp)
+		return resp
+	}
+
+	for _, path := range []string{"crl", "crl/pem", "issuer/default/crl/der", "issuer/default/crl/pem"} {
+		t.Logf("path: %v", path)
+
+		resp = fetch(path, nil)
+		require.Equal(t, 200, resp.Data[logical.HTTPStatusCode])
+		require.Len(t, resp.Headers[headerETag], 1)
+		require.Len(t, resp.Headers[headerLastModified], 1)
+		etag := resp.Headers[headerETag][0]
+		lastModified := resp.Headers[headerLastModified][0]
+
+		// The Last-Modified time is the CRL's thisUpdate.
+		crl, err := x509.ParseRevocationList(resp.Data[logical.HTTPRawBody].([]byte))
+		if strings.HasSuffix(path, "pem") {
+			block, _ := pem.Decode(resp.Data[logical.HTTPRawBody].([]byte))
+			require.NotNil(t, block)
+			crl, err = x509.ParseRevocationList(block.Bytes)
+		}
+		require.NoError(t, err)
+		require.Equal(t, crl.ThisUpdate.UTC().Format(http.TimeFormat), lastModified)
+
+		resp = fetch(path, map[string][]string{headerIfNoneMatch: {etag}})
+		require.Equal(t, 304, resp.Data[logical.HTTPStatusCode])
+		require.Equal(t, etag, resp.Headers[headerETag][0])
+
+		resp = fetch(path, map[string][]string{headerIfNoneMatch: {`"other", W/` + etag}})
+		require.Equal(t, 304, resp.Data[logical.HTTPStatusCode])
+
+		resp = fetch(path, map[string][]string{headerIfNoneMatch: {`"other"`}})
+		require.Equal(t, 200, resp.Data[logical.HTTPStatusCode])
+
+		resp = fetch(path, map[string][]string{headerIfModifiedSince: {lastModified}})
+		require.Equal(t, 304, resp.Data[logical.HTTPStatusCode])
+
+		// If-None-Match takes precedence over If-Modified-Since.
+		resp = fetch(path, map[string][]string{
+			headerIfNoneMatch:     {`"other"`},
+			headerIfModifiedSince: {lastModified},
+		})
+		require.Equal(t, 200, resp.Data[logical.HTTPStatusCode])
+	}
+
+	// DER and PEM representations have distinct ETags.
+	derETag := fetch("crl", nil).Headers[headerETag][0]
+	require.NotEqual(t, derETag, fetch("crl/pem", nil).Headers[headerETag][0])
+
+	// A newly built CRL has a new ETag.
+	time.Sleep(1 * time.Second)
+	_, err = CBRead(b, s, "crl/rotate")
+	require.NoError(t, err)
+	resp = fetch("crl", map[string][]string{headerIfNoneMatch: {derETag}})
+	require.Equal(t, 200, resp.Data[logical.HTTPStatusCode])
+	require.NotEqual(t, derETag, resp.Headers[headerETag][0])
+}
+
+func TestRevocationEvents(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	// Deliveries must be signed with the configured hmac_key.
+	const hmacKey = "webhook secret"
+	received := make(chan pkiEvent, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mac := hmac.New(sha256.New, []byte(hmacKey))
+		mac.Write(body)
+		if r.Header.Get("X-Vault-PKI-Signature") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var event pkiEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- event
+	}))
+	defer server.Close()
+
+	nextEvent := func() pkiEvent {
+		select {
+		case event := <-received:
+			return event
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for event")
+		}
+		return pkiEvent{}
+	}
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rootId := string(resp.Data["issuer_id"].(issuerID))
+
+	resp, err = CBWrite(b, s, "roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"ttl":              "1h",
+	})
+	require.NoError(t, err)
+
+	// Invalid configurations are rejected.
+	_, err = CBWrite(b, s, "config/events", map[string]interface{}{
+		"enabled": true,
+	})
+	require.Error(t, err)
+	_, err = CBWrite(b, s, "config/events", map[string]interface{}{
+		"webhook_url": server.URL,
+		"event_types": "pki/unknown",
+	})
+	require.Error(t, err)
+
+	resp, err = CBWrite(b, s, "config/events", map[string]interface{}{
+		"enabled":     true,
+		"webhook_url": server.URL,
+		"hmac_key":    hmacKey,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, []string{}, resp.Data["event_types"])
+
+	resp, err = CBRead(b, s, "config/events")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, true, resp.Data["enabled"])
+	require.Equal(t, server.URL, resp.Data["webhook_url"])
+	require.Equal(t, true, resp.Data["hmac_key_set"])
+	require.NotContains(t, resp.Data, "hmac_key")
+
+	resp, err = CBWrite(b, s, "issue/example", map[string]interface{}{
+		"common_name": "test.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	serial := resp.Data["serial_number"].(string)
+
+	resp, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": serial,
+		"reason":        "key_compromise",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	// Without auto-rebuild, the revocation rebuilds the CRLs first.
+	var revokeEvent *pkiEvent
+	var rebuildEvents []pkiEvent
+	for revokeEvent == nil {
+		event := nextEvent()
+		switch event.Type {
+		case eventTypeRevoke:
+			revokeEvent = &event
+		case eventTypeCRLRebuild:
+			rebuildEvents = append(rebuildEvents, event)
+		case eventTypeIssue:
+		default:
+			t.Fatalf("unexpected event type: %v", event.Type)
+		}
+	}
+
+	require.Equal(t, serial, revokeEvent.Data["serial_number"])
+	require.Equal(t, rootId, revokeEvent.Data["issuer_id"])
+	require.Equal(t, "key_compromise", revokeEvent.Data["reason"])
+	require.NotEmpty(t, revokeEvent.Data["revocation_time_rfc3339"])
+
+	require.NotEmpty(t, rebuildEvents)
+	require.Equal(t, false, rebuildEvents[0].Data["delta"])
+	require.Equal(t, []interface{}{rootId}, rebuildEvents[0].Data["issuer_ids"])
+	require.NotZero(t, rebuildEvents[0].Data["crl_number"])
+
+	// Revoking the certificate again publishes no further revocation event.
+	resp, err = CBWrite(b, s, "config/events", map[string]interface{}{
+		"event_types": eventTypeRevoke,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": serial,
+	})
+	require.NoError(t, err)
+
+	resp, err = CBWrite(b, s, "issue/example", map[string]interface{}{
+		"common_name": "other.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	otherSerial := resp.Data["serial_number"].(string)
+
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": otherSerial,
+	})
+	require.NoError(t, err)
+
+	event := nextEvent()
+	require.Equal(t, eventTypeRevoke, event.Type)
+	require.Equal(t, otherSerial, event.Data["serial_number"])
+	require.Equal(t, "unspecified", event.Data["reason"])
+}
+
+func TestCertificateLifecycleEvents(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	received := make(chan pkiEvent, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event pkiEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- event
+	}))
+	defer server.Close()
+
+	nextEvent := func() pkiEvent {
+		select {
+		case event := <-received:
+			return event
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for event")
+		}
+		return pkiEvent{}
+	}
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rootId := string(resp.Data["issuer_id"].(issuerID))
+
+	_, err = CBWrite(b, s, "roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"key_type":         "ec",
+		"ttl":              "1h",
+	})
+	require.NoError(t, err)
+
+	resp, err = CBRead(b, s, "config/events")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, int64(7*24*60*60), resp.Data["expiry_window"])
+
+	// The root expires well outside of the window.
+	resp, err = CBWrite(b, s, "config/events", map[string]interface{}{
+		"enabled":       true,
+		"webhook_url":   server.URL,
+		"event_types":   "pki/issue,pki/sign,pki/expiring",
+		"expiry_window": "2h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, int64(2*60*60), resp.Data["expiry_window"])
+
+	resp, err = CBWrite(b, s, "issue/example", map[string]interface{}{
+		"common_name": "issued.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	issuedSerial := resp.Data["serial_number"].(string)
+
+	event := nextEvent()
+	require.Equal(t, eventTypeIssue, event.Type)
+	require.Equal(t, issuedSerial, event.Data["serial_number"])
+	require.Equal(t, rootId, event.Data["issuer_id"])
+	require.Equal(t, "example", event.Data["role"])
+	require.Equal(t, "issued.example.com", event.Data["common_name"])
+	require.NotEmpty(t, event.Data["not_after"])
+
+	_, _, csrPem := generateCSR(t, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "signed.example.com"},
+	}, "ec", 256)
+	resp, err = CBWrite(b, s, "sign/example", map[string]interface{}{
+		"csr": csrPem,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	signedSerial := resp.Data["serial_number"].(string)
+
+	event = nextEvent()
+	require.Equal(t, eventTypeSign, event.Type)
+	require.Equal(t, signedSerial, event.Data["serial_number"])
+
+	resp, err = CBWrite(b, s, "issue/example", map[string]interface{}{
+		"common_name": "revoked.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	revokedSerial := resp.Data["serial_number"].(string)
+	require.Equal(t, eventTypeIssue, nextEvent().Type)
+
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": revokedSerial,
+	})
+	require.NoError(t, err)
+
+	// The expiry scan publishes an event for each unrevoked certificate
+	// within the window, once.
+	sc := b.makeStorageContext(ctx, s)
+	require.NoError(t, b.publishExpiringCertEvents(sc, true))
+
+	expiring := map[string]pkiEvent{}
+	for len(expiring) < 2 {
+		event := nextEvent()
+		require.Equal(t, eventTypeExpiring, event.Type)
+		expiring[event.Data["serial_number"].(string)] = event
+	}
+	require.Contains(t, expiring, issuedSerial)
+	require.Contains(t, expiring, signedSerial)
+	require.Equal(t, "issued.example.com", expiring[issuedSerial].Data["common_name"])
+	require.NotZero(t, expiring[issuedSerial].Data["expires_in"])
+
+	require.NoError(t, b.publishExpiringCertEvents(sc, true))
+	select {
+	case event := <-received:
+		t.Fatalf("unexpected event after repeated scan: %v", event)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	_, err = CBWrite(b, s, "config/events", map[string]interface{}{
+		"expiry_window": "-1",
+	})
+	require.ErrorContains(t, err, "negative")
+}
+
+func TestExpiryNotifications(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	received := make(chan pkiEvent, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event pkiEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- event
+	}))
+	defer server.Close()
+
+	nextEvent := func() pkiEvent {
+		select {
+		case event := <-received:
+			return event
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for event")
+		}
+		return pkiEvent{}
+	}
+	requireNoEvent := func() {
+		select {
+		case event := <-received:
+			t.Fatalf("unexpected event: %v", event)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "48h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	_, err = CBWrite(b, s, "roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"key_type":         "ec",
+		"ttl":              "1h",
+	})
+	require.NoError(t, err)
+
+	resp, err = CBRead(b, s, "config/expiry-notifications")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, false, resp.Data["enabled"])
+	require.Equal(t, int64(30*24*60*60), resp.Data["expiry_window"])
+
+	_, err = CBWrite(b, s, "config/expiry-notifications", map[string]interface{}{
+		"expiry_window": "0",
+	})
+	require.ErrorContains(t, err, "must be positive")
+
+	_, err = CBWrite(b, s, "config/expiry-notifications", map[string]interface{}{
+		"webhook_url": "not a url",
+	})
+	require.ErrorContains(t, err, "invalid URL")
+
+	// The root expires outside of the window.
+	resp, err = CBWrite(b, s, "config/expiry-notifications", map[string]interface{}{
+		"enabled":       true,
+		"webhook_url":   server.URL,
+		"expiry_window": "46h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, int64(46*60*60), resp.Data["expiry_window"])
+
+	var sharedSerials []string
+	for i := 0; i < 2; i++ {
+		resp, err = CBWrite(b, s, "issue/example", map[string]interface{}{
+			"common_name": "shared.example.com",
+		})
+		requireSuccessNonNilResponse(t, resp, err)
+		sharedSerials = append(sharedSerials, resp.Data["serial_number"].(string))
+	}
+	sort.Strings(sharedSerials)
+
+	resp, err = CBWrite(b, s, "issue/example", map[string]interface{}{
+		"common_name": "other.example.com",
+		"ttl":         "45h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	otherSerial := resp.Data["serial_number"].(string)
+
+	resp, err = CBWrite(b, s, "issue/example", map[string]interface{}{
+		"common_name": "revoked.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": resp.Data["serial_number"],
+	})
+	require.NoError(t, err)
+
+	sc := b.makeStorageContext(ctx, s)
+
+	// With a batch size of one, each run looks at a single certificate,
+	// even within a day; groups are notified of once the scan completes.
+	require.NoError(t, b.notifyExpiringCerts(sc, true, 1))
+	requireNoEvent()
+
+	state, err := sc.getExpiryNotificationScanState()
+	require.NoError(t, err)
+	require.True(t, state.InProgress)
+	require.NotEmpty(t, state.ResumeAfter)
+
+	// Unforced runs resume the scan.
+	runs := 1
+	for state.InProgress {
+		require.NoError(t, b.notifyExpiringCerts(sc, false, 1))
+		runs++
+		state, err = sc.getExpiryNotificationScanState()
+		require.NoError(t, err)
+	}
+	require.GreaterOrEqual(t, runs, 4)
+
+	events := map[string]pkiEvent{}
+	for i := 0; i < 2; i++ {
+		event := nextEvent()
+		require.Equal(t, eventTypeExpiryNote, event.Type)
+		require.Equal(t, "example", event.Data["role"])
+		events[event.Data["common_name"].(string)] = event
+	}
+	requireNoEvent()
+
+	event := events["shared.example.com"]
+	require.Equal(t, float64(2), event.Data["count"])
+	require.Equal(t, []interface{}{sharedSerials[0], sharedSerials[1]}, event.Data["serial_numbers"])
+	require.NotEmpty(t, event.Data["earliest_not_after"])
+
+	event = events["other.example.com"]
+	require.Equal(t, float64(1), event.Data["count"])
+	require.Equal(t, []interface{}{otherSerial}, event.Data["serial_numbers"])
+
+	resp, err = CBRead(b, s, "config/expiry-notifications")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.NotEmpty(t, resp.Data["last_scan"])
+	require.NotEmpty(t, resp.Data["scanned_until"])
+
+	// Certificates are notified of once, and completed scans aren't due
+	// again until the scan interval has passed.
+	require.NoError(t, b.notifyExpiringCerts(sc, false, expiryNotificationScanBatchSize))
+	require.NoError(t, b.notifyExpiringCerts(sc, true, expiryNotificationScanBatchSize))
+	requireNoEvent()
+}
+
+func TestCRLPublishing(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	type upload struct {
+		name        string
+		body        []byte
+		contentType string
+	}
+	uploads := make(chan upload, 64)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		uploads <- upload{name: r.URL.Path, body: body, contentType: r.Header.Get("Content-Type")}
+	}))
+	defer server.Close()
+
+	// waitFor returns the next upload of the named object.
+	waitFor := func(name string) upload {
+		for {
+			select {
+			case u := <-uploads:
+				if u.name == name {
+					return u
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("timed out waiting for upload of %v", name)
+			}
+		}
+	}
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rootId := string(resp.Data["issuer_id"].(issuerID))
+	rootCert := parseCert(t, resp.Data["certificate"].(string))
+
+	_, err = CBWrite(b, s, "roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"ttl":              "1h",
+	})
+	require.NoError(t, err)
+
+	// Invalid configurations are rejected.
+	_, err = CBWrite(b, s, "config/publish", map[string]interface{}{
+		"enabled": true,
+	})
+	require.ErrorContains(t, err, "type is required")
+	_, err = CBWrite(b, s, "config/publish", map[string]interface{}{
+		"type": "ftp",
+	})
+	require.ErrorContains(t, err, "unknown type")
+	_, err = CBWrite(b, s, "config/publish", map[string]interface{}{
+		"enabled": true,
+		"type":    "s3",
+		"bucket":  "crls",
+	})
+	require.ErrorContains(t, err, "region is required")
+
+	// Enabling publishing uploads the present CRL and certificate.
+	resp, err = CBWrite(b, s, "config/publish", map[string]interface{}{
+		"enabled":    true,
+		"type":       "http",
+		"url":        server.URL + "/bucket",
+		"prefix":     "pki/",
+		"secret_key": "unused",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, "http", resp.Data["type"])
+	require.NotContains(t, resp.Data, "secret_key")
+
+	cert := waitFor("/bucket/pki/" + rootId + ".crt")
+	require.Equal(t, rootCert.Raw, cert.body)
+	require.Equal(t, "application/pkix-cert", cert.contentType)
+
+	crl := waitFor("/bucket/pki/" + rootId + ".crl")
+	require.Equal(t, "application/pkix-crl", crl.contentType)
+	parsedCRL, err := x509.ParseRevocationList(crl.body)
+	require.NoError(t, err)
+	require.NoError(t, parsedCRL.CheckSignatureFrom(rootCert))
+	require.Empty(t, parsedCRL.RevokedCertificates)
+
+	// Revocations republish the rebuilt CRL.
+	resp, err = CBWrite(b, s, "issue/example", map[string]interface{}{
+		"common_name": "test.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	serial := resp.Data["serial_number"].(string)
+
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": serial,
+	})
+	require.NoError(t, err)
+
+	crl = waitFor("/bucket/pki/" + rootId + ".crl")
+	parsedCRL, err = x509.ParseRevocationList(crl.body)
+	require.NoError(t, err)
+	require.Len(t, parsedCRL.RevokedCertificates, 1)
+	require.Equal(t, serial, serialFromBigInt(parsedCRL.RevokedCertificates[0].SerialNumber))
+
+	resp, err = CBRead(b, s, "publish/status")
+	requireSuccessNonNilResponse(t, resp, err)
+	objects := resp.Data["objects"].(map[string]interface{})
+	require.Contains(t, objects, "pki/"+rootId+".crt")
+	status := objects["pki/"+rootId+".crl"].(map[string]interface{})
+	require.Equal(t, "", status["last_error"])
+	require.NotEmpty(t, status["last_success"])
+	require.Equal(t, 1, status["attempts"])
+}
+
+func TestImportExternalCRL(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "ec",
+		"ttl":         "72h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	rootId := resp.Data["issuer_id"].(issuerID)
+
+	_, err = CBWrite(b, s, "roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"ttl":              "1h",
+	})
+	require.NoError(t, err)
+
+	resp, err = CBWrite(b, s, "issue/example", map[string]interface{}{
+		"common_name": "test.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	localSerial := parseCert(t, resp.Data["certificate"].(string)).SerialNumber
+
+	// Build a CRL from an external CA signed by this mount's issuer,
+	// listing one certificate of this mount as well.
+	externalKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	externalCSR, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "legacy CA"},
+	}, externalKey)
+	require.NoError(t, err)
+	resp, err = CBWrite(b, s, "root/sign-intermediate", map[string]interface{}{
+		"csr":            string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: externalCSR})),
+		"use_csr_values": true,
+		"ttl":            "24h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	externalCA := parseCert(t, resp.Data["certificate"].(string))
+	externalDer := externalCA.Raw
+
+	revokedAt := time.Now().Add(-10 * time.Minute).UTC().Truncate(time.Second)
+	compromised := pkix.RevokedCertificate{SerialNumber: big.NewInt(0x1001), RevocationTime: revokedAt}
+	require.NoError(t, addReasonCodeExtension(&compromised, ocsp.KeyCompromise))
+	crlDer, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(7),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+		RevokedCertificates: []pkix.RevokedCertificate{
+			compromised,
+			{SerialNumber: big.NewInt(0x1002), RevocationTime: revokedAt},
+			{SerialNumber: localSerial, RevocationTime: revokedAt},
+		},
+	}, externalCA, externalKey)
+	require.NoError(t, err)
+	crlPem := string(pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crlDer}))
+
+	_, err = CBWrite(b, s, "crl/import", map[string]interface{}{
+		"crl": "not a crl",
+	})
+	require.Error(t, err)
+
+	// The CRL's signature is verified, by default against the issuer the
+	// revocations are imported for.
+	externalPem := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: externalDer}))
+	_, err = CBWrite(b, s, "crl/import", map[string]interface{}{
+		"crl": crlPem,
+	})
+	require.ErrorContains(t, err, "unable to verify the crl's signature")
+	// crl_issuer must be signed by the issuer the revocations are imported
+	// for: a self-made CA, even one signing the CRL, is refused.
+	selfMadeTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "legacy CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	selfMadeDer, err := x509.CreateCertificate(rand.Reader, selfMadeTemplate, selfMadeTemplate, externalKey.Public(), externalKey)
+	require.NoError(t, err)
+	_, err = CBWrite(b, s, "crl/import", map[string]interface{}{
+		"crl":        crlPem,
+		"crl_issuer": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: selfMadeDer})),
+	})
+	require.ErrorContains(t, err, "crl_issuer must be the certificate of issuer")
+	resp, err = CBList(b, s, "certs/revoked")
+	require.NoError(t, err)
+	require.Empty(t, resp.Data["keys"])
+
+	resp, err = CBWrite(b, s, "crl/import", map[string]interface{}{
+		"crl":        crlPem,
+		"crl_issuer": externalPem,
+		"note":       "migrated from legacy CA",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, 2, resp.Data["imported_revocations"])
+	require.Equal(t, 1, resp.Data["skipped_revocations"])
+	require.NotEmpty(t, resp.Warnings)
+
+	// The imported revocations are on the default issuer's CRL, with their
+	// reasons; the certificate of this mount isn't.
+	checkImported := func() {
+		crl := getParsedCrlFromBackend(t, b, s, "issuer/default/crl/der")
+		entries := map[string]pkix.RevokedCertificate{}
+		for _, entry := range crl.TBSCertList.RevokedCertificates {
+			entries[serialFromBigInt(entry.SerialNumber)] = entry
+		}
+		require.Len(t, entries, 2)
+		require.Contains(t, entries, serialFromBigInt(big.NewInt(0x1002)))
+		entry, ok := entries[serialFromBigInt(big.NewInt(0x1001))]
+		require.True(t, ok)
+		require.Equal(t, ocsp.KeyCompromise, revokedCertReason(entry))
+		require.True(t, revokedAt.Equal(entry.RevocationTime))
+	}
+	checkImported()
+
+	resp, err = CBList(b, s, "certs/revoked")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Len(t, resp.Data["keys"], 2)
+
+	// Importing again, as base64-encoded DER, skips everything.
+	resp, err = CBWrite(b, s, "crl/import", map[string]interface{}{
+		"crl":        base64.StdEncoding.EncodeToString(crlDer),
+		"crl_issuer": externalPem,
+		"issuer_ref": string(rootId),
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, 0, resp.Data["imported_revocations"])
+	require.Equal(t, 3, resp.Data["skipped_revocations"])
+
+	// CRLs of the issuer itself verify without crl_issuer.
+	resp, err = CBRead(b, s, "issuer/default/crl")
+	requireSuccessNonNilResponse(t, resp, err)
+	resp, err = CBWrite(b, s, "crl/import", map[string]interface{}{
+		"crl": resp.Data["crl"],
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, 0, resp.Data["imported_revocations"])
+	require.Equal(t, 2, resp.Data["skipped_revocations"])
+
+	// Tidy leaves the imported revocations in place.
+	_, err = CBWrite(b, s, "tidy", map[string]interface{}{
+		"tidy_revoked_certs":                    true,
+		"tidy_revoked_cert_issuer_associations": true,
+		"safety_buffer":                         "1s",
+	})
+	require.NoError(t, err)
+	status := waitForTidyToFinish(t, b, s)
+	require.Equal(t, "Finished", status.Data["state"])
+	checkImported()
+}
@@ -8,10 +8,14 @@ import (
 	"crypto/x509/pkix"
 	"fmt"
 	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/armon/go-metrics"
 	atomic2 "go.uber.org/atomic"
 
 	"github.com/hashicorp/vault/sdk/helper/consts"
@@ -19,6 +23,7 @@ import (
 	"github.com/hashicorp/vault/sdk/helper/certutil"
 	"github.com/hashicorp/vault/sdk/helper/errutil"
 	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/ocsp"
 )
 
 const (
@@ -28,13 +33,37 @@ const (
 	deltaWALLastBuildSerial       = deltaWALPath + deltaWALLastBuildSerialName
 	deltaWALLastRevokedSerialName = "last-revoked-serial"
 	deltaWALLastRevokedSerial     = deltaWALPath + deltaWALLastRevokedSerialName
+
+	// crlRebuildIntentPath marks that a rebuild was requested but hasn't yet
+	// completed, so that a node becoming active (e.g., after failover)
+	// picks it up. It lives under crls/ and is thus cluster-local.
+	crlRebuildIntentPath = "crls/rebuild-intent"
 )
 
 type revocationInfo struct {
-	CertificateBytes  []byte    `json:"certificate_bytes"`
-	RevocationTime    int64     `json:"revocation_time"`
-	RevocationTimeUTC time.Time `json:"revocation_time_utc"`
-	CertificateIssuer issuerID  `json:"issuer_id"`
+	CertificateBytes  []byte              `json:"certificate_bytes"`
+	RevocationTime    int64               `json:"revocation_time"`
+	RevocationTimeUTC time.Time           `json:"revocation_time_utc"`
+	CertificateIssuer issuerID            `json:"issuer_id"`
+	Reason            int                 `json:"reason,omitempty"`
+	Metadata          *revocationMetadata `json:"metadata,omitempty"`
+	CRLPartition      string              `json:"crl_partition,omitempty"`
+}
+
+// revocationMetadata is operator-supplied context recorded alongside a
+// revocation, for traceability.
+type revocationMetadata struct {
+	TicketID  string `json:"ticket_id,omitempty"`
+	Requester string `json:"requester,omitempty"`
+	Note      string `json:"note,omitempty"`
+}
+
+func (m *revocationMetadata) responseData() map[string]interface{} {
+	return map[string]interface{}{
+		"ticket_id": m.TicketID,
+		"requester": m.Requester,
+		"note":      m.Note,
+	}
 }
 
 type (
@@ -72,6 +101,10 @@ type crlBuilder struct {
 	forceRebuild          *atomic2.Bool
 	lastDeltaRebuildCheck time.Time
 
+	// Serializes persisting and clearing the rebuild intent, so that a
+	// request made while a rebuild completes isn't cleared with it.
+	_intent sync.Mutex
+
 	_config sync.RWMutex
 	dirty   *atomic2.Bool
 	config  crlConfig
@@ -79,6 +112,10 @@ type crlBuilder struct {
 	// Whether to invalidate our LastModifiedTime due to write on the
 	// global issuance config.
 	invalidate *atomic2.Bool
+
+	// State of the background rebuild worker; see crl_worker.go.
+	worker     stoppableWorker
+	workerWake chan struct{}
 }
 
 const (
@@ -96,6 +133,7 @@ func newCRLBuilder() *crlBuilder {
 		dirty:                 atomic2.NewBool(true),
 		config:                defaultCrlConfig,
 		invalidate:            atomic2.NewBool(false),
+		workerWake:            make(chan struct{}, 1),
 	}
 }
 
@@ -148,19 +186,97 @@ func (cb *crlBuilder) getConfigWithUpdate(sc *storageContext) (*crlConfig, error
 	return &configCopy, nil
 }
 
+// describeState reports the builder's in-memory state alongside the
+// persisted configuration it is derived from, for diagnosing CRLs which
+// aren't being rebuilt as expected. Unlike getConfigWithUpdate, this does
+// not reload the configuration, so a stale loaded config remains visible.
+func (cb *crlBuilder) describeState(sc *storageContext) (map[string]interface{}, error) {
+	storedConfig, err := sc.getRevocationConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	cb._config.RLock()
+	loadedConfig := cb.config
+	cb._config.RUnlock()
+
+	state := map[string]interface{}{
+		"config_dirty":                    cb.dirty.Load(),
+		"force_rebuild_pending":           cb.forceRebuild.Load(),
+		"build_time_invalidation_pending": cb.invalidate.Load(),
+		"background_worker_running":       cb.worker.running(),
+		"loaded_config":                   crlConfigResponseData(&loadedConfig),
+		"stored_config":                   crlConfigResponseData(storedConfig),
+		"loaded_config_matches_stored":    reflect.DeepEqual(loadedConfig, *storedConfig),
+	}
+
+	// Don't wait on an in-progress build; a build which never finishes is
+	// exactly what somebody calling this may be trying to find.
+	if cb._builder.TryLock() {
+		state["build_in_progress"] = false
+		state["last_delta_rebuild_check"] = cb.lastDeltaRebuildCheck.UTC().Format(time.RFC3339)
+		cb._builder.Unlock()
+	} else {
+		state["build_in_progress"] = true
+	}
+
+	localConfig, err := sc.getLocalCRLConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch cluster-local CRL configuration: %v", err)
+	}
+
+	formatTime := func(t time.Time, ok bool) string {
+		if !ok || t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+
+	crls := make(map[string]interface{}, len(localConfig.CRLNumberMap))
+	for id, nextNumber := range localConfig.CRLNumberMap {
+		var issuers []string
+		for issuerId, crlId := range localConfig.IssuerIDCRLMap {
+			if crlId == id {
+				issuers = append(issuers, issuerId.String())
+			}
+		}
+		sort.Strings(issuers)
+
+		expiration, haveExpiration := localConfig.CRLExpirationMap[id]
+		deltaExpiration, haveDeltaExpiration := localConfig.DeltaExpirationMap[id]
+		lastBuild, haveLastBuild := localConfig.CRLBuildTimeMap[id]
+		lastDeltaBuild, haveLastDeltaBuild := localConfig.DeltaBuildTimeMap[id]
+
+		crls[id.String()] = map[string]interface{}{
+			"issuers":              issuers,
+			"next_crl_number":      nextNumber,
+			"last_complete_number": localConfig.LastCompleteNumberMap[id],
+			"expiration":           formatTime(expiration, haveExpiration),
+			"delta_expiration":     formatTime(deltaExpiration, haveDeltaExpiration),
+			"last_build":           formatTime(lastBuild, haveLastBuild),
+			"last_delta_build":     formatTime(lastDeltaBuild, haveLastDeltaBuild),
+		}
+	}
+	state["crls"] = crls
+	state["last_modified"] = formatTime(localConfig.LastModified, true)
+
+	return state, nil
+}
+
 func (cb *crlBuilder) checkForAutoRebuild(sc *storageContext) error {
 	cfg, err := cb.getConfigWithUpdate(sc)
 	if err != nil {
 		return err
 	}
 
-	if cfg.Disable || !cfg.AutoRebuild || cb.forceRebuild.Load() {
-		// Not enabled, not on auto-rebuilder, or we're already scheduled to
-		// rebuild so there's no point to interrogate CRL values...
+	if cfg.Disable || (!cfg.AutoRebuild && !cfg.BackgroundRebuild) || cb.forceRebuild.Load() {
+		// Not enabled, not on auto- or background rebuilding, or we're
+		// already scheduled to rebuild so there's no point to interrogate
+		// CRL values...
 		return nil
 	}
 
-	// Auto-Rebuild is enabled. We need to check each issuer's CRL and see
+	// Auto- or background rebuilding is enabled. We need to check each issuer's CRL and see
 	// if its about to expire. If it is, we've gotta rebuild it (and well,
 	// every other CRL since we don't have a fine-toothed rebuilder).
 	//
@@ -266,8 +382,66 @@ func (cb *crlBuilder) requestRebuildIfActiveNode(b *backend) {
 	}
 
 	b.Logger().Info("Scheduling PKI CRL rebuild.")
+
+	// The flag is lost should this node step down before the rebuild
+	// happens, so persist it as well.
+	cb.persistRebuildIntent(b)
+
+	// With background rebuilding, there's no need to wait for a request.
+	cb.wakeBackgroundWorker()
+}
+
+// persistRebuildIntent sets the rebuild flag and persists it. This is
+// called from storage invalidation, so the write is bounded by a short
+// timeout rather than the request's context.
+func (cb *crlBuilder) persistRebuildIntent(b *backend) {
+	cb._intent.Lock()
+	defer cb._intent.Unlock()
+
 	// Set the flag to 1, we don't care if we aren't the ones that actually swap it to 1.
 	cb.forceRebuild.Store(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := b.storage.Put(ctx, &logical.StorageEntry{
+		Key:   crlRebuildIntentPath,
+		Value: []byte(time.Now().UTC().Format(time.RFC3339)),
+	})
+	if err != nil {
+		b.Logger().Warn("Unable to persist scheduled PKI CRL rebuild; it may be lost on leadership change.", "error", err)
+	}
+}
+
+// clearRebuildIntent removes the persisted rebuild intent once a rebuild
+// has completed, unless another rebuild was requested in the meantime.
+func (cb *crlBuilder) clearRebuildIntent(sc *storageContext) {
+	cb._intent.Lock()
+	defer cb._intent.Unlock()
+
+	if cb.forceRebuild.Load() {
+		return
+	}
+
+	if err := sc.Storage.Delete(sc.Context, crlRebuildIntentPath); err != nil {
+		sc.Backend.Logger().Warn("Unable to clear persisted PKI CRL rebuild request; an extra rebuild may occur on leadership change.", "error", err)
+	}
+}
+
+// loadRebuildIntent schedules a rebuild requested on a previously active
+// node but not completed there.
+func (cb *crlBuilder) loadRebuildIntent(sc *storageContext) error {
+	entry, err := sc.Storage.Get(sc.Context, crlRebuildIntentPath)
+	if err != nil {
+		return fmt.Errorf("unable to check for a pending CRL rebuild: %w", err)
+	}
+
+	if entry != nil {
+		sc.Backend.Logger().Info("Scheduling PKI CRL rebuild requested prior to becoming active.", "requested_at", string(entry.Value))
+		cb.forceRebuild.Store(true)
+	}
+
+	return nil
 }
 
 func (cb *crlBuilder) _doRebuild(ctx context.Context, b *backend, request *logical.Request, forceNew bool, ignoreForceFlag bool) error {
@@ -284,7 +458,11 @@ func (cb *crlBuilder) _doRebuild(ctx context.Context, b *backend, request *logic
 
 		// if forceRebuild was requested, that should force a complete rebuild even if requested not too by forceNew
 		myForceNew := forceBuildFlag || forceNew
-		return buildCRLs(ctx, b, request, myForceNew)
+		if err := buildCRLs(ctx, b, request, myForceNew); err != nil {
+			return err
+		}
+
+		cb.clearRebuildIntent(b.makeStorageContext(ctx, request.Storage))
 	}
 
 	return nil
@@ -320,21 +498,22 @@ func (cb *crlBuilder) clearDeltaWAL(sc *storageContext, walSerials []string) err
 }
 
 func (cb *crlBuilder) rebuildDeltaCRLsIfForced(sc *storageContext) error {
-	// Delta CRLs use the same expiry duration as the complete CRL. Because
-	// we always rebuild the complete CRL and then the delta CRL, we can
-	// be assured that the delta CRL always expires after a complete CRL,
-	// and that rebuilding the complete CRL will trigger a fresh delta CRL
-	// build of its own.
+	// Delta CRLs are rebuilt on their own schedule, independently of the
+	// complete CRL. There are two reasons to rebuild them: new revocations
+	// have occurred since the last delta CRL was built (which we check for
+	// once every delta rebuild interval), or a delta CRL is about to expire.
 	//
-	// This guarantee means we can avoid checking delta CRL expiry. Thus,
-	// we only need to rebuild the delta CRL when we have new revocations,
-	// within our time window for updating it.
+	// Rebuilding the complete CRL always triggers a fresh delta CRL build
+	// of its own, so when the delta CRL shares the complete CRL's lifetime,
+	// the latter should never trigger. But delta CRLs may be given a much
+	// shorter lifetime (via delta_expiry), in which case we must keep them
+	// valid even absent new revocations.
 	cfg, err := cb.getConfigWithUpdate(sc)
 	if err != nil {
 		return err
 	}
 
-	if !cfg.EnableDelta {
+	if !cfg.EnableDelta || cfg.Disable {
 		// We explicitly do not update the last check time here, as we
 		// want to persist the last rebuild window if it hasn't been set.
 		return nil
@@ -349,9 +528,17 @@ func (cb *crlBuilder) rebuildDeltaCRLsIfForced(sc *storageContext) error {
 	cb._builder.Lock()
 	defer cb._builder.Unlock()
 
+	now := time.Now()
+	expiring, err := cb.deltaCRLsExpiring(sc, now, deltaRebuildDuration)
+	if err != nil {
+		return err
+	}
+	if expiring {
+		return cb.rebuildDeltaCRLsHoldingLock(sc, false)
+	}
+
 	// Last is setup during newCRLBuilder(...), so we don't need to deal with
 	// a zero condition.
-	now := time.Now()
 	last := cb.lastDeltaRebuildCheck
 	nextRebuildCheck := last.Add(deltaRebuildDuration)
 	if now.Before(nextRebuildCheck) {
@@ -413,6 +600,29 @@ func (cb *crlBuilder) rebuildDeltaCRLsIfForced(sc *storageContext) error {
 	return cb.rebuildDeltaCRLsHoldingLock(sc, false)
 }
 
+// deltaCRLsExpiring reports whether any delta CRL expires within the given
+// grace period. Expirations are tracked in the cluster-local CRL config, so
+// this survives restarts of the backend.
+func (cb *crlBuilder) deltaCRLsExpiring(sc *storageContext, now time.Time, grace time.Duration) (bool, error) {
+	if sc.Backend.useLegacyBundleCaStorage() {
+		// Delta CRLs aren't built with the legacy bundle.
+		return false, nil
+	}
+
+	crlConfig, err := sc.getLocalCRLConfig()
+	if err != nil {
+		return false, fmt.Errorf("error checking for delta CRL expiry: unable to fetch cluster-local CRL configuration: %v", err)
+	}
+
+	for _, value := range crlConfig.DeltaExpirationMap {
+		if value.IsZero() || now.After(value.Add(-1*grace)) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
 func (cb *crlBuilder) rebuildDeltaCRLs(sc *storageContext, forceNew bool) error {
 	cb._builder.Lock()
 	defer cb._builder.Unlock()
@@ -468,8 +678,38 @@ func fetchIssuerMapForRevocationChecking(sc *storageContext) (map[issuerID]*x509
 	return issuerIDCertMap, nil
 }
 
+// expiredRevocationAllowed reports whether the already-expired certificate
+// may still be revoked under allow_expired_cert_revocation and
+// expired_cert_revocation_window. When auto-tidy removes revocations, the
+// window is further limited to its safety_buffer: the revocation of a
+// certificate expired for longer would be removed by the next tidy.
+func expiredRevocationAllowed(sc *storageContext, config *crlConfig, cert *x509.Certificate) (bool, error) {
+	if !config.AllowExpiredRevocation {
+		return false, nil
+	}
+
+	var window time.Duration
+	if config.ExpiredRevocationWindow != "" {
+		var err error
+		window, err = time.ParseDuration(config.ExpiredRevocationWindow)
+		if err != nil {
+			return false, nil
+		}
+	}
+
+	tidyConfig, err := sc.getAutoTidyConfig()
+	if err != nil {
+		return false, fmt.Errorf("error fetching auto-tidy configuration: %w", err)
+	}
+	if tidyConfig.Enabled && tidyConfig.RevokedCerts && (window == 0 || tidyConfig.SafetyBuffer < window) {
+		window = tidyConfig.SafetyBuffer
+	}
+
+	return window == 0 || time.Now().Before(cert.NotAfter.Add(window)), nil
+}
+
 // Revokes a cert, and tries to be smart about error recovery
-func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial string, fromLease bool) (*logical.Response, error) {
+func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial string, reason int, metadata *revocationMetadata, fromLease bool) (*logical.Response, error) {
 	// As this backend is self-contained and this function does not hook into
 	// third parties to manage users or resources, if the mount is tainted,
 	// revocation doesn't matter anyways -- the CRL that would be written will
@@ -499,7 +739,16 @@ func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial st
 		}
 	}
 
+	// Fetch the config and see if we need to rebuild the CRL. If we have
+	// auto building enabled, we will wait for the next rebuild period to
+	// actually rebuild it.
+	config, err := b.crlBuilder.getConfigWithUpdate(sc)
+	if err != nil {
+		return nil, fmt.Errorf("error building CRL: while updating config: %v", err)
+	}
+
 	alreadyRevoked := false
+	reasonChanged := false
 	var revInfo revocationInfo
 
 	revEntry, err := fetchCertBySerial(ctx, b, req, revokedPath, serial)
@@ -518,6 +767,22 @@ func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial st
 		if err != nil {
 			return nil, fmt.Errorf("error decoding existing revocation info")
 		}
+
+		// A certificate on hold may be revoked for good by revoking it
+		// again with a different reason.
+		if revInfo.Reason == ocsp.CertificateHold && reason != ocsp.CertificateHold {
+			reasonChanged = true
+			revInfo.Reason = reason
+			if metadata != nil {
+				revInfo.Metadata = metadata
+			}
+
+			if err := writeRevocationEntry(sc, normalizeSerial(serial), &revInfo); err != nil {
+				return nil, fmt.Errorf("error saving revoked certificate to new location: %w", err)
+			}
+		} else if err := sc.ensureRevocationIndexed(normalizeSerial(serial), &revInfo); err != nil {
+			return nil, fmt.Errorf("error repairing revocation index: %w", err)
+		}
 	}
 
 	if !alreadyRevoked {
@@ -550,11 +815,21 @@ func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial st
 		}
 
 		// Add a little wiggle room because leases are stored with a second
-		// granularity
+		// granularity. Leases are revoked upon expiry, so those never place
+		// expired certificates on the CRL.
 		if cert.NotAfter.Before(time.Now().Add(2 * time.Second)) {
-			response := &logical.Response{}
-			response.AddWarning(fmt.Sprintf("certificate with serial %s already expired; refusing to add to CRL", serial))
-			return response, nil
+			allowed := false
+			if !fromLease {
+				allowed, err = expiredRevocationAllowed(sc, config, cert)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if !allowed {
+				response := &logical.Response{}
+				response.AddWarning(fmt.Sprintf("certificate with serial %s already expired; refusing to add to CRL", serial))
+				return response, nil
+			}
 		}
 
 		// Compatibility: Don't revoke CAs if they had leases. New CAs going
@@ -567,28 +842,39 @@ func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial st
 		revInfo.CertificateBytes = certEntry.Value
 		revInfo.RevocationTime = currTime.Unix()
 		revInfo.RevocationTimeUTC = currTime.UTC()
+		revInfo.Reason = reason
+		revInfo.Metadata = metadata
+
+		// Certificates issued into a CRL partition are listed on its CRL.
+		certMeta, err := sc.fetchCertMetadata(serial)
+		if err != nil {
+			return nil, err
+		}
+		if certMeta != nil {
+			revInfo.CRLPartition = certMeta.CRLPartition
+		}
 
 		// We may not find an issuer with this certificate; that's fine so
 		// ignore the return value.
 		associateRevokedCertWithIsssuer(&revInfo, cert, issuerIDCertMap)
 
-		revEntry, err = logical.StorageEntryJSON(revokedPath+normalizeSerial(serial), revInfo)
-		if err != nil {
-			return nil, fmt.Errorf("error creating revocation entry")
+		if err := writeRevocationEntry(sc, normalizeSerial(serial), &revInfo); err != nil {
+			return nil, fmt.Errorf("error saving revoked certificate to new location: %w", err)
 		}
+	}
 
-		err = req.Storage.Put(ctx, revEntry)
+	if config.UnifiedRevocation && len(revInfo.CertificateBytes) > 0 {
+		// Written even if the certificate was already revoked, so that
+		// revocations predating unified_revocation can be backfilled.
+		// Revocations imported from external CRLs have no certificate
+		// and aren't unified.
+		cert, err := x509.ParseCertificate(revInfo.CertificateBytes)
 		if err != nil {
-			return nil, fmt.Errorf("error saving revoked certificate to new location")
+			return nil, fmt.Errorf("error parsing revoked certificate: %w", err)
+		}
+		if err := writeUnifiedRevocationEntry(sc, serial, &revInfo, cert.NotAfter); err != nil {
+			return nil, fmt.Errorf("error saving unified revocation entry: %w", err)
 		}
-	}
-
-	// Fetch the config and see if we need to rebuild the CRL. If we have
-	// auto building enabled, we will wait for the next rebuild period to
-	// actually rebuild it.
-	config, err := b.crlBuilder.getConfigWithUpdate(sc)
-	if err != nil {
-		return nil, fmt.Errorf("error building CRL: while updating config: %v", err)
 	}
 
 	if !config.AutoRebuild {
@@ -605,7 +891,7 @@ func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial st
 				return nil, fmt.Errorf("error encountered during CRL building: %w", crlErr)
 			}
 		}
-	} else if !alreadyRevoked {
+	} else if !alreadyRevoked || reasonChanged {
 		// Regardless of whether or not we've presently enabled Delta CRLs,
 		// we should always write the Delta WAL in case it is enabled in the
 		// future. We could trigger another full CRL rebuild instead (to avoid
@@ -617,7 +903,8 @@ func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial st
 		// Otherwise, the re-revocation may appear on both an existing CRL and
 		// on a delta CRL, or a serial may be skipped from the delta CRL if
 		// there's an A->B->A revocation pattern and the delta was rebuilt
-		// after the first cert.
+		// after the first cert. The exception is a certificate on hold
+		// being revoked for good: its new reason must reach the delta CRL.
 		//
 		// Currently we don't store any data in the WAL entry.
 		var walInfo deltaWALInfo
@@ -643,6 +930,19 @@ func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial st
 		}
 	}
 
+	if !alreadyRevoked || reasonChanged {
+		event := map[string]interface{}{
+			"serial_number":   denormalizeSerial(serial),
+			"issuer_id":       string(revInfo.CertificateIssuer),
+			"reason":          revocationReasonName(revInfo.Reason),
+			"revocation_time": revInfo.RevocationTime,
+		}
+		if !revInfo.RevocationTimeUTC.IsZero() {
+			event["revocation_time_rfc3339"] = revInfo.RevocationTimeUTC.Format(time.RFC3339Nano)
+		}
+		b.publishEvent(sc, eventTypeRevoke, event)
+	}
+
 	resp := &logical.Response{
 		Data: map[string]interface{}{
 			"revocation_time": revInfo.RevocationTime,
@@ -654,6 +954,148 @@ func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial st
 	return resp, nil
 }
 
+// unrevokeCert releases a certificate from hold, removing its revocation
+// entry and rebuilding the CRLs. Only certificates revoked with the
+// certificateHold reason may be unrevoked; other revocations are final.
+func unrevokeCert(ctx context.Context, b *backend, req *logical.Request, serial string) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+
+	revEntry, err := fetchCertBySerial(ctx, b, req, revokedPath, serial)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
+	}
+	if revEntry == nil {
+		return logical.ErrorResponse(fmt.Sprintf("certificate with serial %s is not revoked", serial)), nil
+	}
+
+	var revInfo revocationInfo
+	if err := revEntry.DecodeJSON(&revInfo); err != nil {
+		return nil, fmt.Errorf("error decoding existing revocation info")
+	}
+	if revInfo.Reason != ocsp.CertificateHold {
+		return logical.ErrorResponse(fmt.Sprintf("certificate with serial %s was not revoked with the certificate_hold reason and cannot be unrevoked", serial)), nil
+	}
+
+	if err := deleteRevocationEntry(sc, strings.TrimPrefix(revEntry.Key, revokedPath)); err != nil {
+		return nil, err
+	}
+
+	// The delta WAL entry, if it hasn't yet been consumed, would otherwise
+	// point the next delta CRL build at a serial which is no longer
+	// revoked.
+	if err := req.Storage.Delete(ctx, deltaWALPath+normalizeSerial(serial)); err != nil {
+		return nil, fmt.Errorf("error removing delta CRL WAL entry: %w", err)
+	}
+
+	config, err := b.crlBuilder.getConfigWithUpdate(sc)
+	if err != nil {
+		return nil, fmt.Errorf("error building CRL: while updating config: %v", err)
+	}
+
+	if config.UnifiedRevocation {
+		if err := deleteUnifiedRevocationEntry(sc, serial); err != nil {
+			return nil, fmt.Errorf("error removing unified revocation entry: %w", err)
+		}
+	}
+
+	// Unlike revocation, always rebuild the complete CRLs right away, even
+	// with auto_rebuild enabled: a delta CRL can't express the removal of
+	// an entry from its base, and relying parties should stop rejecting the
+	// certificate as soon as possible.
+	crlErr := b.crlBuilder.rebuild(ctx, b, req, false)
+	if crlErr != nil {
+		switch crlErr.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(fmt.Sprintf("Error during CRL building: %s", crlErr)), nil
+		default:
+			return nil, fmt.Errorf("error encountered during CRL building: %w", crlErr)
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"serial_number": serial,
+		},
+	}, nil
+}
+
+// importCRLRevocations records the revocations listed on an external CRL,
+// such as that of a CA being migrated into this mount, associating them
+// with the given issuer so they appear on its CRL. Only the serial number,
+// revocation time and reason of each revocation are known, so the
+// resulting entries carry no certificate. Serials already revoked here, or
+// belonging to certificates issued by this mount (including its issuers),
+// are skipped. The caller must hold the revocation storage lock and
+// rebuild the CRLs afterwards.
+func importCRLRevocations(sc *storageContext, req *logical.Request, crl *pkix.CertificateList, issuerId issuerID, metadata *revocationMetadata) (*logical.Response, error) {
+	issuerIDCertMap, err := fetchIssuerMapForRevocationChecking(sc)
+	if err != nil {
+		return nil, err
+	}
+	issuerSerials := make(map[string]struct{}, len(issuerIDCertMap))
+	for _, cert := range issuerIDCertMap {
+		issuerSerials[serialFromCert(cert)] = struct{}{}
+	}
+
+	resp := &logical.Response{}
+	imported := 0
+	var skipped []string
+	for _, revoked := range crl.TBSCertList.RevokedCertificates {
+		serial := serialFromBigInt(revoked.SerialNumber)
+
+		if _, isIssuer := issuerSerials[serial]; isIssuer {
+			skipped = append(skipped, serial)
+			continue
+		}
+
+		revEntry, err := fetchCertBySerial(sc.Context, sc.Backend, req, revokedPath, serial)
+		if err != nil {
+			return nil, err
+		}
+		if revEntry != nil {
+			skipped = append(skipped, serial)
+			continue
+		}
+
+		certEntry, err := fetchCertBySerial(sc.Context, sc.Backend, req, "certs/", serial)
+		if err != nil {
+			return nil, err
+		}
+		if certEntry != nil {
+			// Revoke those through /revoke instead, should they need to be.
+			skipped = append(skipped, serial)
+			continue
+		}
+
+		revInfo := revocationInfo{
+			RevocationTime:    revoked.RevocationTime.Unix(),
+			RevocationTimeUTC: revoked.RevocationTime.UTC(),
+			CertificateIssuer: issuerId,
+			Reason:            revokedCertReason(revoked),
+			Metadata:          metadata,
+		}
+		if err := writeRevocationEntry(sc, normalizeSerial(serial), &revInfo); err != nil {
+			return nil, fmt.Errorf("error saving imported revocation of serial %s: %w", serial, err)
+		}
+		imported += 1
+	}
+
+	if len(skipped) > 0 {
+		resp.AddWarning(fmt.Sprintf("skipped %d serial numbers which were already revoked or belong to certificates in this mount: %v", len(skipped), strings.Join(skipped, ", ")))
+	}
+
+	resp.Data = map[string]interface{}{
+		"imported_revocations": imported,
+		"skipped_revocations":  len(skipped),
+	}
+	return resp, nil
+}
+
 func buildCRLs(ctx context.Context, b *backend, req *logical.Request, forceNew bool) error {
 	sc := b.makeStorageContext(ctx, req.Storage)
 	return buildAnyCRLs(sc, forceNew, false)
@@ -735,6 +1177,14 @@ func buildAnyCRLs(sc *storageContext, forceNew bool, isDelta bool) error {
 		return fmt.Errorf("error building CRLs: while getting the default config: %v", err)
 	}
 
+	// Revocations which can't be assigned to an issuer go on the default
+	// issuer's CRL or, when it can't sign CRLs, on that of the first
+	// fallback default issuer which can.
+	unassignedIssuerId := config.DefaultIssuerId
+	if fallbackId, fellBack, err := sc.resolveUsableDefaultIssuer(CRLSigningUsage); err == nil && fellBack {
+		unassignedIssuerId = fallbackId
+	}
+
 	// We map issuerID->entry for fast lookup and also issuerID->Cert for
 	// signature verification and correlation of revoked certs.
 	issuerIDEntryMap := make(map[issuerID]*issuerEntry, len(issuers))
@@ -786,6 +1236,19 @@ func buildAnyCRLs(sc *storageContext, forceNew bool, isDelta bool) error {
 		keySubjectIssuersMap[thisEntry.KeyID][subject] = append(keySubjectIssuersMap[thisEntry.KeyID][subject], issuer)
 	}
 
+	// Revocations recorded on this cluster before an issuer's key was
+	// rotated elsewhere belong to the issuer holding its previous key.
+	if !isDelta {
+		for _, entry := range issuerIDEntryMap {
+			if entry.RotatedFrom == "" {
+				continue
+			}
+			if err := sc.moveRotatedRevocations(entry); err != nil {
+				return fmt.Errorf("error building CRLs: unable to move revocations to issuer %v: %v", entry.ID, err)
+			}
+		}
+	}
+
 	// Fetch the cluster-local CRL mapping so we know where to write the
 	// CRLs.
 	crlConfig, err := sc.getLocalCRLConfig()
@@ -830,15 +1293,38 @@ func buildAnyCRLs(sc *storageContext, forceNew bool, isDelta bool) error {
 	// these certificates to an issuer. Some certificates will not be
 	// assignable (if they were issued by a since-deleted issuer), so we need
 	// a separate pool for those.
-	unassignedCerts, revokedCertsMap, err := getRevokedCertEntries(sc, issuerIDCertMap, isDelta)
+	unassignedCerts, revokedCertsMap, partitionedCertsMap, err := getRevokedCertEntries(sc, issuerIDCertMap, isDelta)
 	if err != nil {
 		return fmt.Errorf("error building CRLs: unable to get revoked certificate entries: %v", err)
 	}
 
+	// Partition CRLs are built alongside complete and delta CRLs; see
+	// crl_partitions.go.
+	var crlPartitions []string
+	if !wasLegacy {
+		crlPartitions, err = sc.listCRLPartitions(partitionedCertsMap)
+		if err != nil {
+			return fmt.Errorf("error building CRLs: unable to list CRL partitions: %v", err)
+		}
+	}
+
 	if err := augmentWithRevokedIssuers(issuerIDEntryMap, issuerIDCertMap, revokedCertsMap); err != nil {
 		return fmt.Errorf("error building CRLs: unable to parse revoked issuers: %v", err)
 	}
 
+	// Delta CRL expirations are tracked separately from the complete CRL's,
+	// as they're rebuilt on their own schedule. We only keep entries for the
+	// delta CRLs built this round, so that CRLs which are no longer built
+	// (e.g., because their issuers lost CRL signing usage) don't continually
+	// trigger rebuilds once they expire.
+	deltaExpirations := make(map[crlID]time.Time)
+	deltaBuildTimes := make(map[crlID]time.Time)
+
+	// Events for the CRLs built, and the issuers whose CRLs were built,
+	// published once the updated CRL config has been persisted.
+	var rebuildEvents []map[string]interface{}
+	var publishedIssuers []issuerID
+
 	// Now we can call buildCRL once, on an arbitrary/representative issuer
 	// from each of these (keyID, subject) sets.
 	for _, subjectIssuersMap := range keySubjectIssuersMap {
@@ -848,6 +1334,7 @@ func buildAnyCRLs(sc *storageContext, forceNew bool, isDelta bool) error {
 			}
 
 			var revokedCerts []pkix.RevokedCertificate
+			partitionedCerts := make(map[string][]pkix.RevokedCertificate)
 			representative := issuerID("")
 			var crlIdentifier crlID
 			var crlIdIssuer issuerID
@@ -860,13 +1347,14 @@ func buildAnyCRLs(sc *storageContext, forceNew bool, isDelta bool) error {
 					continue
 				}
 
-				// Prefer to use the default as the representative of this
-				// set, if it is a member.
+				// Prefer to use the default (or the fallback standing in
+				// for it) as the representative of this set, if it is a
+				// member.
 				//
 				// If it is, we'll also pull in the unassigned certs to remain
 				// compatible with Vault's earlier, potentially questionable
 				// behavior.
-				if issuerId == config.DefaultIssuerId {
+				if issuerId == unassignedIssuerId {
 					if len(unassignedCerts) > 0 {
 						revokedCerts = append(revokedCerts, unassignedCerts...)
 					}
@@ -884,6 +1372,9 @@ func buildAnyCRLs(sc *storageContext, forceNew bool, isDelta bool) error {
 				if thisRevoked, ok := revokedCertsMap[issuerId]; ok && len(thisRevoked) > 0 {
 					revokedCerts = append(revokedCerts, thisRevoked...)
 				}
+				for partition, thisPartitioned := range partitionedCertsMap {
+					partitionedCerts[partition] = append(partitionedCerts[partition], thisPartitioned[issuerId]...)
+				}
 
 				// Finally, check our crlIdentifier.
 				if thisCRLId, ok := crlConfig.IssuerIDCRLMap[issuerId]; ok && len(thisCRLId) > 0 {
@@ -939,10 +1430,36 @@ func buildAnyCRLs(sc *storageContext, forceNew bool, isDelta bool) error {
 				return fmt.Errorf("error building CRLs: unable to build CRL for issuer (%v): %v", representative, err)
 			}
 
-			crlConfig.CRLExpirationMap[crlIdentifier] = *nextUpdate
+			if !isDelta && !wasLegacy {
+				if err := buildReasonPartitionedCRLs(sc, globalCRLConfig, representative, revokedCerts, crlIdentifier, crlNumber); err != nil {
+					return fmt.Errorf("error building CRLs: unable to build reason-partitioned CRLs for issuer (%v): %v", representative, err)
+				}
+			}
+			if !wasLegacy {
+				if err := buildPartitionCRLs(sc, globalCRLConfig, representative, crlPartitions, partitionedCerts, crlIdentifier, crlNumber, isDelta, lastCompleteNumber); err != nil {
+					return fmt.Errorf("error building CRLs: unable to build partition CRLs for issuer (%v): %v", representative, err)
+				}
+			}
+
 			if !isDelta {
+				crlConfig.CRLExpirationMap[crlIdentifier] = *nextUpdate
+				crlConfig.CRLBuildTimeMap[crlIdentifier] = crlConfig.LastModified
 				crlConfig.LastCompleteNumberMap[crlIdentifier] = crlNumber
-			} else if !haveLast {
+			} else {
+				deltaExpirations[crlIdentifier] = *nextUpdate
+				deltaBuildTimes[crlIdentifier] = crlConfig.LastModified
+			}
+
+			publishedIssuers = append(publishedIssuers, issuersSet...)
+			rebuildEvents = append(rebuildEvents, map[string]interface{}{
+				"crl_id":      string(crlIdentifier),
+				"issuer_ids":  issuersSet,
+				"crl_number":  crlNumber,
+				"delta":       isDelta,
+				"next_update": nextUpdate.Format(time.RFC3339),
+			})
+
+			if isDelta && !haveLast {
 				// Since we're writing this config anyways, save our guess
 				// as to the last CRL number.
 				crlConfig.LastCompleteNumberMap[crlIdentifier] = lastCompleteNumber
@@ -951,43 +1468,20 @@ func buildAnyCRLs(sc *storageContext, forceNew bool, isDelta bool) error {
 	}
 
 	// Before persisting our updated CRL config, check to see if we have
-	// any dangling references. If we have any issuers that don't exist,
-	// remove them, remembering their CRLs IDs. If we've completely removed
-	// all issuers pointing to that CRL number, we can remove it from the
-	// number map and from storage.
+	// any dangling references.
 	//
 	// Note that we persist the last generated CRL for a specified issuer
 	// if it is later disabled for CRL generation. This mirrors the old
 	// root deletion behavior, but using soft issuer deletes. If there is an
 	// alternate, equivalent issuer however, we'll keep updating the shared
 	// CRL; all equivalent issuers must have their CRLs disabled.
-	for mapIssuerId := range crlConfig.IssuerIDCRLMap {
-		stillHaveIssuer := false
-		for _, listedIssuerId := range issuers {
-			if mapIssuerId == listedIssuerId {
-				stillHaveIssuer = true
-				break
-			}
-		}
-
-		if !stillHaveIssuer {
-			delete(crlConfig.IssuerIDCRLMap, mapIssuerId)
-		}
+	if err := cleanupDanglingCRLs(sc, crlConfig, issuers); err != nil {
+		return fmt.Errorf("error building CRLs: %w", err)
 	}
-	for crlId := range crlConfig.CRLNumberMap {
-		stillHaveIssuerForID := false
-		for _, remainingCRL := range crlConfig.IssuerIDCRLMap {
-			if remainingCRL == crlId {
-				stillHaveIssuerForID = true
-				break
-			}
-		}
 
-		if !stillHaveIssuerForID {
-			if err := sc.Storage.Delete(sc.Context, "crls/"+crlId.String()); err != nil {
-				return fmt.Errorf("error building CRLs: unable to clean up deleted issuers' CRL: %v", err)
-			}
-		}
+	if isDelta {
+		crlConfig.DeltaExpirationMap = deltaExpirations
+		crlConfig.DeltaBuildTimeMap = deltaBuildTimes
 	}
 
 	// Finally, persist our potentially updated local CRL config. Only do this
@@ -998,6 +1492,17 @@ func buildAnyCRLs(sc *storageContext, forceNew bool, isDelta bool) error {
 		}
 	}
 
+	// Performance secondaries rebuild CRLs of their own, which would
+	// otherwise be reported alongside the primary's.
+	if !sc.Backend.System().ReplicationState().HasState(consts.ReplicationPerformanceSecondary) {
+		for _, event := range rebuildEvents {
+			sc.Backend.publishEvent(sc, eventTypeCRLRebuild, event)
+		}
+	}
+	if !wasLegacy {
+		sc.Backend.publishIssuerArtifacts(sc, publishedIssuers, isDelta)
+	}
+
 	if !isDelta {
 		// After we've confirmed the primary CRLs have built OK, go ahead and
 		// clear the delta CRL WAL and rebuild it.
@@ -1033,6 +1538,52 @@ func buildAnyCRLs(sc *storageContext, forceNew bool, isDelta bool) error {
 	return nil
 }
 
+// cleanupDanglingCRLs removes references to issuers which don't exist any
+// more from the cluster-local CRL config, remembering their CRLs IDs. If
+// all issuers pointing to a CRL were removed, the CRL is removed from
+// storage. The caller persists the updated config.
+func cleanupDanglingCRLs(sc *storageContext, crlConfig *localCRLConfigEntry, issuers []issuerID) error {
+	for mapIssuerId := range crlConfig.IssuerIDCRLMap {
+		stillHaveIssuer := false
+		for _, listedIssuerId := range issuers {
+			if mapIssuerId == listedIssuerId {
+				stillHaveIssuer = true
+				break
+			}
+		}
+
+		if !stillHaveIssuer {
+			delete(crlConfig.IssuerIDCRLMap, mapIssuerId)
+		}
+	}
+	for crlId := range crlConfig.CRLNumberMap {
+		stillHaveIssuerForID := false
+		for _, remainingCRL := range crlConfig.IssuerIDCRLMap {
+			if remainingCRL == crlId {
+				stillHaveIssuerForID = true
+				break
+			}
+		}
+
+		if !stillHaveIssuerForID {
+			if err := sc.Storage.Delete(sc.Context, "crls/"+crlId.String()); err != nil {
+				return fmt.Errorf("unable to clean up deleted issuers' CRL: %v", err)
+			}
+			if err := sc.Storage.Delete(sc.Context, "crls/"+crlId.String()+deltaCRLPathSuffix); err != nil {
+				return fmt.Errorf("unable to clean up deleted issuers' delta CRL: %v", err)
+			}
+			if err := deleteReasonPartitionedCRLs(sc, crlId, nil); err != nil {
+				return fmt.Errorf("unable to clean up deleted issuers' CRL: %v", err)
+			}
+			if err := deletePartitionCRLs(sc, crlId, nil); err != nil {
+				return fmt.Errorf("unable to clean up deleted issuers' CRL: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
 func isRevInfoIssuerValid(revInfo *revocationInfo, issuerIDCertMap map[issuerID]*x509.Certificate) bool {
 	if len(revInfo.CertificateIssuer) > 0 {
 		issuerId := revInfo.CertificateIssuer
@@ -1058,9 +1609,36 @@ func associateRevokedCertWithIsssuer(revInfo *revocationInfo, revokedCert *x509.
 	return false
 }
 
-func getRevokedCertEntries(sc *storageContext, issuerIDCertMap map[issuerID]*x509.Certificate, isDelta bool) ([]pkix.RevokedCertificate, map[issuerID][]pkix.RevokedCertificate, error) {
+// getRevokedCertEntries loads the CRL entries of all revoked certificates
+// (or, for delta CRLs, of those revoked since the last complete CRL),
+// grouped by issuer. Entries which couldn't be associated with an issuer are
+// returned separately, as are those of certificates issued into a CRL
+// partition, by partition; the latter are left off delta CRLs.
+func getRevokedCertEntries(sc *storageContext, issuerIDCertMap map[issuerID]*x509.Certificate, isDelta bool) ([]pkix.RevokedCertificate, map[issuerID][]pkix.RevokedCertificate, map[string]map[issuerID][]pkix.RevokedCertificate, error) {
 	var unassignedCerts []pkix.RevokedCertificate
 	revokedCertsMap := make(map[issuerID][]pkix.RevokedCertificate)
+	partitionedCertsMap := make(map[string]map[issuerID][]pkix.RevokedCertificate)
+
+	// Build a mapping of issuer serial -> certificate.
+	issuerSerialCertMap := make(map[string][]*x509.Certificate, len(issuerIDCertMap))
+	for _, cert := range issuerIDCertMap {
+		serialStr := serialFromCert(cert)
+		issuerSerialCertMap[serialStr] = append(issuerSerialCertMap[serialStr], cert)
+	}
+
+	// Complete CRLs are built from the revocation index when available,
+	// rather than loading and parsing every revoked certificate on each
+	// rebuild; see revocation_index.go. This is why no cache of parsed
+	// entries is kept between rebuilds.
+	if !isDelta {
+		indexReady, err := sc.isRevocationIndexReady()
+		if err != nil {
+			return nil, nil, nil, errutil.InternalError{Err: fmt.Sprintf("error checking revocation index: %s", err)}
+		}
+		if indexReady {
+			return getIndexedRevokedCertEntries(sc, issuerIDCertMap, issuerSerialCertMap)
+		}
+	}
 
 	listingPath := revokedPath
 	if isDelta {
@@ -1069,14 +1647,7 @@ func getRevokedCertEntries(sc *storageContext, issuerIDCertMap map[issuerID]*x50
 
 	revokedSerials, err := sc.Storage.List(sc.Context, listingPath)
 	if err != nil {
-		return nil, nil, errutil.InternalError{Err: fmt.Sprintf("error fetching list of revoked certs: %s", err)}
-	}
-
-	// Build a mapping of issuer serial -> certificate.
-	issuerSerialCertMap := make(map[string][]*x509.Certificate, len(issuerIDCertMap))
-	for _, cert := range issuerIDCertMap {
-		serialStr := serialFromCert(cert)
-		issuerSerialCertMap[serialStr] = append(issuerSerialCertMap[serialStr], cert)
+		return nil, nil, nil, errutil.InternalError{Err: fmt.Sprintf("error fetching list of revoked certs: %s", err)}
 	}
 
 	for _, serial := range revokedSerials {
@@ -1085,106 +1656,157 @@ func getRevokedCertEntries(sc *storageContext, issuerIDCertMap map[issuerID]*x50
 			continue
 		}
 
-		var revInfo revocationInfo
-		revokedEntry, err := sc.Storage.Get(sc.Context, revokedPath+serial)
+		newRevCert, issuerId, partition, err := loadRevokedCertEntry(sc, serial, issuerIDCertMap, issuerSerialCertMap)
 		if err != nil {
-			return nil, nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch revoked cert with serial %s: %s", serial, err)}
+			return nil, nil, nil, err
 		}
 
-		if revokedEntry == nil {
-			return nil, nil, errutil.InternalError{Err: fmt.Sprintf("revoked certificate entry for serial %s is nil", serial)}
-		}
-		if revokedEntry.Value == nil || len(revokedEntry.Value) == 0 {
-			// TODO: In this case, remove it and continue? How likely is this to
-			// happen? Alternately, could skip it entirely, or could implement a
-			// delete function so that there is a way to remove these
-			return nil, nil, errutil.InternalError{Err: fmt.Sprintf("found revoked serial but actual certificate is empty")}
+		if newRevCert == nil {
+			continue
 		}
 
-		err = revokedEntry.DecodeJSON(&revInfo)
-		if err != nil {
-			return nil, nil, errutil.InternalError{Err: fmt.Sprintf("error decoding revocation entry for serial %s: %s", serial, err)}
+		if issuerId == "" {
+			// If the parent isn't found, add it to the unassigned bucket.
+			unassignedCerts = append(unassignedCerts, *newRevCert)
+		} else if partition != "" {
+			addPartitionedCertEntry(partitionedCertsMap, partition, issuerId, *newRevCert)
+		} else {
+			revokedCertsMap[issuerId] = append(revokedCertsMap[issuerId], *newRevCert)
 		}
+	}
 
-		revokedCert, err := x509.ParseCertificate(revInfo.CertificateBytes)
-		if err != nil {
-			return nil, nil, errutil.InternalError{Err: fmt.Sprintf("unable to parse stored revoked certificate with serial %s: %s", serial, err)}
-		}
+	return unassignedCerts, revokedCertsMap, partitionedCertsMap, nil
+}
 
-		// We want to skip issuer certificate's revocationEntries for two
-		// reasons:
-		//
-		// 1. We canonically use augmentWithRevokedIssuers to handle this
-		//    case and this entry is just a backup. This prevents the issue
-		//    of duplicate serial numbers on the CRL from both paths.
-		// 2. We want to avoid a root's serial from appearing on its own
-		//    CRL. If it is a cross-signed or re-issued variant, this is OK,
-		//    but in the case we mark the root itself as "revoked", we want
-		//    to avoid it appearing on the CRL as that is definitely
-		//    undefined/little-supported behavior.
-		//
-		// This hash map lookup should be faster than byte comparison against
-		// each issuer proactively.
-		if candidates, present := issuerSerialCertMap[serialFromCert(revokedCert)]; present {
-			revokedCertIsIssuer := false
-			for _, candidate := range candidates {
-				if bytes.Equal(candidate.Raw, revokedCert.Raw) {
-					revokedCertIsIssuer = true
-					break
-				}
-			}
+// loadRevokedCertEntry loads the revocation entry stored for serial and
+// builds its CRL entry, returning the issuer it belongs to (or an empty
+// issuer when none could be found) and the CRL partition it belongs to (if
+// any). A nil entry is returned if the revoked
+// certificate shouldn't appear on any CRL.
+func loadRevokedCertEntry(sc *storageContext, serial string, issuerIDCertMap map[issuerID]*x509.Certificate, issuerSerialCertMap map[string][]*x509.Certificate) (*pkix.RevokedCertificate, issuerID, string, error) {
+	var revInfo revocationInfo
+	revokedEntry, err := sc.Storage.Get(sc.Context, revokedPath+serial)
+	if err != nil {
+		return nil, "", "", errutil.InternalError{Err: fmt.Sprintf("unable to fetch revoked cert with serial %s: %s", serial, err)}
+	}
 
-			if revokedCertIsIssuer {
-				continue
+	if revokedEntry == nil {
+		return nil, "", "", errutil.InternalError{Err: fmt.Sprintf("revoked certificate entry for serial %s is nil", serial)}
+	}
+	if revokedEntry.Value == nil || len(revokedEntry.Value) == 0 {
+		// TODO: In this case, remove it and continue? How likely is this to
+		// happen? Alternately, could skip it entirely, or could implement a
+		// delete function so that there is a way to remove these
+		return nil, "", "", errutil.InternalError{Err: fmt.Sprintf("found revoked serial but actual certificate is empty")}
+	}
+
+	err = revokedEntry.DecodeJSON(&revInfo)
+	if err != nil {
+		return nil, "", "", errutil.InternalError{Err: fmt.Sprintf("error decoding revocation entry for serial %s: %s", serial, err)}
+	}
+
+	if len(revInfo.CertificateBytes) == 0 {
+		// Imported from an external CRL; see importCRLRevocations.
+		newRevCert, issuerId, err := loadImportedRevokedCertEntry(serial, &revInfo, issuerIDCertMap)
+		return newRevCert, issuerId, "", err
+	}
+
+	revokedCert, err := x509.ParseCertificate(revInfo.CertificateBytes)
+	if err != nil {
+		return nil, "", "", errutil.InternalError{Err: fmt.Sprintf("unable to parse stored revoked certificate with serial %s: %s", serial, err)}
+	}
+
+	// We want to skip issuer certificate's revocationEntries for two
+	// reasons:
+	//
+	// 1. We canonically use augmentWithRevokedIssuers to handle this
+	//    case and this entry is just a backup. This prevents the issue
+	//    of duplicate serial numbers on the CRL from both paths.
+	// 2. We want to avoid a root's serial from appearing on its own
+	//    CRL. If it is a cross-signed or re-issued variant, this is OK,
+	//    but in the case we mark the root itself as "revoked", we want
+	//    to avoid it appearing on the CRL as that is definitely
+	//    undefined/little-supported behavior.
+	//
+	// This hash map lookup should be faster than byte comparison against
+	// each issuer proactively.
+	if candidates, present := issuerSerialCertMap[serialFromCert(revokedCert)]; present {
+		for _, candidate := range candidates {
+			if bytes.Equal(candidate.Raw, revokedCert.Raw) {
+				return nil, "", "", nil
 			}
 		}
+	}
 
-		// NOTE: We have to change this to UTC time because the CRL standard
-		// mandates it but Go will happily encode the CRL without this.
-		newRevCert := pkix.RevokedCertificate{
-			SerialNumber: revokedCert.SerialNumber,
-		}
-		if !revInfo.RevocationTimeUTC.IsZero() {
-			newRevCert.RevocationTime = revInfo.RevocationTimeUTC
-		} else {
-			newRevCert.RevocationTime = time.Unix(revInfo.RevocationTime, 0).UTC()
-		}
+	// NOTE: We have to change this to UTC time because the CRL standard
+	// mandates it but Go will happily encode the CRL without this.
+	newRevCert := pkix.RevokedCertificate{
+		SerialNumber: revokedCert.SerialNumber,
+	}
+	if !revInfo.RevocationTimeUTC.IsZero() {
+		newRevCert.RevocationTime = revInfo.RevocationTimeUTC
+	} else {
+		newRevCert.RevocationTime = time.Unix(revInfo.RevocationTime, 0).UTC()
+	}
+	if err := addReasonCodeExtension(&newRevCert, revInfo.Reason); err != nil {
+		return nil, "", "", errutil.InternalError{Err: fmt.Sprintf("error building CRL entry for serial %s: %s", serial, err)}
+	}
 
-		// If we have a CertificateIssuer field on the revocation entry,
-		// prefer it to manually checking each issuer signature, assuming it
-		// appears valid. It's highly unlikely for two different issuers
-		// to have the same id (after the first was deleted).
-		if isRevInfoIssuerValid(&revInfo, issuerIDCertMap) {
-			revokedCertsMap[revInfo.CertificateIssuer] = append(revokedCertsMap[revInfo.CertificateIssuer], newRevCert)
-			continue
+	// If we have a CertificateIssuer field on the revocation entry,
+	// prefer it to manually checking each issuer signature, assuming it
+	// appears valid. It's highly unlikely for two different issuers
+	// to have the same id (after the first was deleted).
+	if isRevInfoIssuerValid(&revInfo, issuerIDCertMap) {
+		return &newRevCert, revInfo.CertificateIssuer, revInfo.CRLPartition, nil
+	}
 
-			// Otherwise, fall through and update the entry.
-		}
+	// Otherwise, we need to assign the revoked certificate to an issuer.
+	foundParent := associateRevokedCertWithIsssuer(&revInfo, revokedCert, issuerIDCertMap)
+	if !foundParent {
+		return &newRevCert, "", revInfo.CRLPartition, nil
+	}
 
-		// Now we need to assign the revoked certificate to an issuer.
-		foundParent := associateRevokedCertWithIsssuer(&revInfo, revokedCert, issuerIDCertMap)
-		if !foundParent {
-			// If the parent isn't found, add it to the unassigned bucket.
-			unassignedCerts = append(unassignedCerts, newRevCert)
-		} else {
-			revokedCertsMap[revInfo.CertificateIssuer] = append(revokedCertsMap[revInfo.CertificateIssuer], newRevCert)
+	// When the CertificateIssuer field wasn't found on the existing
+	// entry (or was invalid), and we've found a new value for it,
+	// we should update the entry to make future CRL builds faster.
+	if err := writeRevocationEntry(sc, serial, &revInfo); err != nil {
+		return nil, "", "", fmt.Errorf("error updating revoked certificate at existing location: %v: %w", serial, err)
+	}
 
-			// When the CertificateIssuer field wasn't found on the existing
-			// entry (or was invalid), and we've found a new value for it,
-			// we should update the entry to make future CRL builds faster.
-			revokedEntry, err = logical.StorageEntryJSON(revokedPath+serial, revInfo)
-			if err != nil {
-				return nil, nil, fmt.Errorf("error creating revocation entry for existing cert: %v", serial)
-			}
+	return &newRevCert, revInfo.CertificateIssuer, revInfo.CRLPartition, nil
+}
 
-			err = sc.Storage.Put(sc.Context, revokedEntry)
-			if err != nil {
-				return nil, nil, fmt.Errorf("error updating revoked certificate at existing location: %v", serial)
-			}
-		}
+// loadImportedRevokedCertEntry builds the CRL entry for a revocation
+// imported from an external CRL, which has no certificate: it stays on the
+// CRL of the issuer it was imported for, or, once that issuer is gone, is
+// left unassigned (and so placed on the default issuer's CRL).
+func loadImportedRevokedCertEntry(serial string, revInfo *revocationInfo, issuerIDCertMap map[issuerID]*x509.Certificate) (*pkix.RevokedCertificate, issuerID, error) {
+	serialNumber, err := serialFromRevocationIndexKey(serial)
+	if err != nil {
+		return nil, "", errutil.InternalError{Err: err.Error()}
 	}
 
-	return unassignedCerts, revokedCertsMap, nil
+	newRevCert := pkix.RevokedCertificate{
+		SerialNumber:   serialNumber,
+		RevocationTime: revInfo.RevocationTimeUTC,
+	}
+	if err := addReasonCodeExtension(&newRevCert, revInfo.Reason); err != nil {
+		return nil, "", errutil.InternalError{Err: fmt.Sprintf("error building CRL entry for serial %s: %s", serial, err)}
+	}
+
+	if !isRevInfoIssuerValid(revInfo, issuerIDCertMap) {
+		return &newRevCert, "", nil
+	}
+	return &newRevCert, revInfo.CertificateIssuer, nil
+}
+
+// addPartitionedCertEntry adds the CRL entry of a certificate issued into a
+// CRL partition to the entries of its partition and issuer.
+func addPartitionedCertEntry(partitionedCertsMap map[string]map[issuerID][]pkix.RevokedCertificate, partition string, issuerId issuerID, entry pkix.RevokedCertificate) {
+	if _, ok := partitionedCertsMap[partition]; !ok {
+		partitionedCertsMap[partition] = make(map[issuerID][]pkix.RevokedCertificate)
+	}
+	partitionedCertsMap[partition][issuerId] = append(partitionedCertsMap[partition][issuerId], entry)
 }
 
 func augmentWithRevokedIssuers(issuerIDEntryMap map[issuerID]*issuerEntry, issuerIDCertMap map[issuerID]*x509.Certificate, revokedCertsMap map[issuerID][]pkix.RevokedCertificate) error {
@@ -1221,14 +1843,66 @@ func augmentWithRevokedIssuers(issuerIDEntryMap map[issuerID]*issuerEntry, issue
 	return nil
 }
 
+// crlEntryLimitWarningRatio is the fraction of max_crl_entries beyond which
+// CRL builds warn that the limit is being approached.
+const crlEntryLimitWarningRatio = 0.9
+
+// enforceCRLEntryLimit applies the max_crl_entries limit to a CRL's entries,
+// per max_crl_entries_behavior: either failing the build or keeping only the
+// most recent revocations. It also publishes the CRL's size and warns as the
+// limit is approached, so operators can act before it's reached.
+func enforceCRLEntryLimit(sc *storageContext, crlInfo *crlConfig, identifier crlID, isDelta bool, revoked []pkix.RevokedCertificate) ([]pkix.RevokedCertificate, error) {
+	labels := []metrics.Label{
+		{Name: "crl_id", Value: identifier.String()},
+		{Name: "delta", Value: strconv.FormatBool(isDelta)},
+	}
+	metrics.SetGaugeWithLabels([]string{"secrets", "pki", "crl", "entries"}, float32(len(revoked)), labels)
+
+	limit := crlInfo.MaxCRLEntries
+	if limit <= 0 {
+		return revoked, nil
+	}
+
+	if float64(len(revoked)) >= crlEntryLimitWarningRatio*float64(limit) {
+		metrics.IncrCounterWithLabels([]string{"secrets", "pki", "crl", "near_entry_limit"}, 1, labels)
+		sc.Backend.Logger().Warn("CRL is approaching or exceeding its maximum number of entries", "crl_id", identifier, "delta", isDelta, "entries", len(revoked), "max_crl_entries", limit)
+	}
+
+	if len(revoked) <= limit {
+		return revoked, nil
+	}
+
+	if crlInfo.MaxCRLEntriesBehavior != crlEntryLimitTruncate {
+		return nil, errutil.UserError{Err: fmt.Sprintf("CRL %v would have %d entries, exceeding max_crl_entries (%d); tidy expired revocations or raise the limit", identifier, len(revoked), limit)}
+	}
+
+	// Keep the most recent revocations; older revoked certificates are the
+	// likeliest to have expired since.
+	truncated := make([]pkix.RevokedCertificate, len(revoked))
+	copy(truncated, revoked)
+	sort.SliceStable(truncated, func(i, j int) bool {
+		return truncated[i].RevocationTime.After(truncated[j].RevocationTime)
+	})
+	truncated = truncated[:limit]
+
+	metrics.IncrCounterWithLabels([]string{"secrets", "pki", "crl", "truncated_entries"}, float32(len(revoked)-limit), labels)
+	sc.Backend.Logger().Warn("CRL exceeded its maximum number of entries; omitting the oldest revocations", "crl_id", identifier, "delta", isDelta, "entries", len(revoked), "omitted", len(revoked)-limit, "max_crl_entries", limit)
+	return truncated, nil
+}
+
 // Builds a CRL by going through the list of revoked certificates and building
 // a new CRL with the stored revocation times and serial numbers.
 func buildCRL(sc *storageContext, crlInfo *crlConfig, forceNew bool, thisIssuerId issuerID, revoked []pkix.RevokedCertificate, identifier crlID, crlNumber int64, isDelta bool, lastCompleteNumber int64) (*time.Time, error) {
 	var revokedCerts []pkix.RevokedCertificate
 
-	crlLifetime, err := time.ParseDuration(crlInfo.Expiry)
+	expiry := crlInfo.Expiry
+	if isDelta && crlInfo.DeltaExpiry != "" {
+		expiry = crlInfo.DeltaExpiry
+	}
+
+	crlLifetime, err := time.ParseDuration(expiry)
 	if err != nil {
-		return nil, errutil.InternalError{Err: fmt.Sprintf("error parsing CRL duration of %s", crlInfo.Expiry)}
+		return nil, errutil.InternalError{Err: fmt.Sprintf("error parsing CRL duration of %s", expiry)}
 	}
 
 	if crlInfo.Disable {
@@ -1247,7 +1921,10 @@ func buildCRL(sc *storageContext, crlInfo *crlConfig, forceNew bool, thisIssuerI
 		goto WRITE
 	}
 
-	revokedCerts = revoked
+	revokedCerts, err = enforceCRLEntryLimit(sc, crlInfo, identifier, isDelta, revoked)
+	if err != nil {
+		return nil, err
+	}
 
 WRITE:
 	signingBundle, caErr := sc.fetchCAInfoByIssuerId(thisIssuerId, CRLSigningUsage)
@@ -1263,9 +1940,30 @@ WRITE:
 	now := time.Now()
 	nextUpdate := now.Add(crlLifetime)
 
-	ext, err := certutil.CreateDeltaCRLIndicatorExt(lastCompleteNumber)
+	// Only delta CRLs carry the delta CRL indicator (RFC 5280 Section
+	// 5.2.4); relying parties would otherwise treat the complete CRL as a
+	// delta against itself.
+	var extensions []pkix.Extension
+	if isDelta {
+		ext, err := certutil.CreateDeltaCRLIndicatorExt(lastCompleteNumber)
+		if err != nil {
+			return nil, fmt.Errorf("could not create crl delta indicator extension: %v", err)
+		}
+		extensions = append(extensions, ext)
+	}
+
+	// Delta CRLs share the scope, and so the issuingDistributionPoint, of
+	// their complete CRL (RFC 5280 Section 5.2.4).
+	idp, err := sc.getCRLIDPConfig(crlInfo, thisIssuerId)
 	if err != nil {
-		return nil, fmt.Errorf("could not create crl delta indicator extension: %v", err)
+		return nil, err
+	}
+	idpExt, err := idpExtension(idp, -1)
+	if err != nil {
+		return nil, errutil.InternalError{Err: err.Error()}
+	}
+	if idpExt != nil {
+		extensions = append(extensions, *idpExt)
 	}
 
 	revocationListTemplate := &x509.RevocationList{
@@ -1274,7 +1972,7 @@ WRITE:
 		ThisUpdate:          now,
 		NextUpdate:          nextUpdate,
 		SignatureAlgorithm:  signingBundle.RevocationSigAlg,
-		ExtraExtensions:     []pkix.Extension{ext},
+		ExtraExtensions:     extensions,
 	}
 
 	crlBytes, err := x509.CreateRevocationList(rand.Reader, revocationListTemplate, signingBundle.Certificate, signingBundle.PrivateKey)
@@ -1292,11 +1990,7 @@ WRITE:
 		writePath += deltaCRLPathSuffix
 	}
 
-	err = sc.Storage.Put(sc.Context, &logical.StorageEntry{
-		Key:   writePath,
-		Value: crlBytes,
-	})
-	if err != nil {
+	if err := writeCRL(sc, writePath, crlBytes, crlInfo.CompressCRLs); err != nil {
 		return nil, errutil.InternalError{Err: fmt.Sprintf("error storing CRL: %s", err)}
 	}
 
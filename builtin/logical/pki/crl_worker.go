@@ -0,0 +1,100 @@
+package pki
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// crlWorkerInterval is how often the background CRL rebuild worker
+	// checks for CRLs to rebuild absent any other trigger.
+	crlWorkerInterval = 1 * time.Minute
+
+	// crlWorkerTimeout bounds a single pass of the background worker; large
+	// CRLs can take far longer to build than a periodic function may run.
+	crlWorkerTimeout = 30 * time.Minute
+)
+
+// startBackgroundWorker launches the goroutine performing CRL rebuilds when
+// background_rebuild is enabled, if it isn't running already. Rather than
+// waiting for a read or write to notice that a rebuild is required, the
+// worker rebuilds CRLs as soon as they're scheduled or near expiry, even on
+// otherwise idle mounts, and without blocking the periodic function.
+func (cb *crlBuilder) startBackgroundWorker(b *backend) {
+	cb.worker.start(func(ctx context.Context) {
+		b.Logger().Debug("Starting background PKI CRL rebuild worker.")
+
+		ticker := time.NewTicker(crlWorkerInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-cb.workerWake:
+			}
+
+			cb.backgroundRebuild(ctx, b)
+		}
+	})
+}
+
+// stopBackgroundWorker stops the background worker, if running, canceling
+// any pass in progress.
+func (cb *crlBuilder) stopBackgroundWorker() {
+	cb.worker.stop()
+}
+
+// wakeBackgroundWorker asks the background worker, if running, to check
+// for CRLs to rebuild now. This never blocks; if a pass is already pending,
+// it will observe whatever prompted this call.
+func (cb *crlBuilder) wakeBackgroundWorker() {
+	if !cb.worker.running() {
+		return
+	}
+
+	select {
+	case cb.workerWake <- struct{}{}:
+	default:
+	}
+}
+
+// backgroundRebuild performs one pass of the background worker, doing the
+// CRL maintenance the periodic function otherwise would.
+func (cb *crlBuilder) backgroundRebuild(ctx context.Context, b *backend) {
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby) ||
+		b.System().ReplicationState().HasState(consts.ReplicationDRSecondary) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, crlWorkerTimeout)
+	defer cancel()
+
+	sc := b.makeStorageContext(ctx, b.storage)
+	cfg, err := cb.getConfigWithUpdate(sc)
+	if err != nil {
+		b.Logger().Error("Background PKI CRL rebuild failed to load CRL configuration.", "error", err)
+		return
+	}
+	if !cfg.BackgroundRebuild {
+		return
+	}
+
+	if err := cb.checkForAutoRebuild(sc); err != nil {
+		b.Logger().Error("Background PKI CRL rebuild failed to check CRL expiration.", "error", err)
+		return
+	}
+
+	if err := cb.rebuildIfForced(ctx, b, &logical.Request{Storage: b.storage}); err != nil {
+		b.Logger().Error("Background PKI CRL rebuild failed.", "error", err)
+		return
+	}
+
+	if err := cb.rebuildDeltaCRLsIfForced(sc); err != nil {
+		b.Logger().Error("Background PKI delta CRL rebuild failed.", "error", err)
+	}
+}
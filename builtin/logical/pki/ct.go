@@ -0,0 +1,397 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"golang.org/x/crypto/cryptobyte"
+	cbbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// With config/ct, leaf certificates are submitted to Certificate
+// Transparency logs (RFC 6962) as they are issued: certutil signs a
+// precertificate, which is submitted to every configured log through its
+// add-pre-chain endpoint, and the SCTs returned are embedded in the final
+// certificate, which differs from the precertificate only by that
+// extension in place of the poison.
+//
+// Each SCT is verified against the public key configured for its log
+// before being embedded; an SCT which doesn't verify counts as a failed
+// submission.
+
+// ctSubmission submits the precertificate of a single certificate to the
+// configured logs.
+type ctSubmission struct {
+	config *ctConfigEntry
+	client *http.Client
+
+	// chain is the DER of the issuer and the rest of its chain, submitted
+	// after the precertificate.
+	chain [][]byte
+
+	// logKeys are the public keys of the logs, in the order of their URLs;
+	// issuerKeyHash is the hash of the issuer's public key, which SCTs
+	// for precertificates sign.
+	logKeys       []crypto.PublicKey
+	issuerKeyHash [32]byte
+
+	// warnings report failed submissions which the failure policy
+	// tolerated, to be added to the response.
+	warnings []string
+}
+
+// addChainResponse is a log's response to add-pre-chain; see RFC 6962
+// section 4.1.
+type addChainResponse struct {
+	SCTVersion uint8  `json:"sct_version"`
+	ID         string `json:"id"`
+	Timestamp  uint64 `json:"timestamp"`
+	Extensions string `json:"extensions"`
+	Signature  string `json:"signature"`
+}
+
+// newCTSubmission returns a submission for a certificate signed by the
+// given CA, or nil if Certificate Transparency is disabled.
+func newCTSubmission(sc *storageContext, caInfo *certutil.CAInfoBundle) (*ctSubmission, error) {
+	config, err := sc.getCTConfig()
+	if err != nil {
+		return nil, err
+	}
+	if !config.Enabled || len(config.LogURLs) == 0 {
+		return nil, nil
+	}
+
+	chain := [][]byte{caInfo.CertificateBytes}
+	for _, caCert := range caInfo.CAChain {
+		if !bytes.Equal(caCert.Bytes, caInfo.CertificateBytes) {
+			chain = append(chain, caCert.Bytes)
+		}
+	}
+
+	// Configurations written before log keys were required have none; the
+	// logs' SCTs then fail verification.
+	logKeys := make([]crypto.PublicKey, len(config.LogURLs))
+	for i, encoded := range config.LogPublicKeys {
+		if i >= len(logKeys) {
+			break
+		}
+		if logKeys[i], err = parseCTLogPublicKey(encoded); err != nil {
+			return nil, err
+		}
+	}
+
+	return &ctSubmission{
+		config:        config,
+		client:        &http.Client{Timeout: config.SubmissionTimeout},
+		chain:         chain,
+		logKeys:       logKeys,
+		issuerKeyHash: sha256.Sum256(caInfo.Certificate.RawSubjectPublicKeyInfo),
+	}, nil
+}
+
+// parseCTLogPublicKey parses a log's public key, given as the base64 of
+// its DER SubjectPublicKeyInfo, as published in log lists.
+func parseCTLogPublicKey(encoded string) (crypto.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log public key: %w", err)
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log public key: %w", err)
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported log public key type %T; logs use ECDSA or RSA keys", key)
+	}
+}
+
+// submit is the certutil.PrecertificateHandler submitting the
+// precertificate to every log concurrently, and returning the SCT list
+// extension.
+func (s *ctSubmission) submit(precert []byte) ([]pkix.Extension, error) {
+	chain := make([]string, 0, len(s.chain)+1)
+	chain = append(chain, base64.StdEncoding.EncodeToString(precert))
+	for _, cert := range s.chain {
+		chain = append(chain, base64.StdEncoding.EncodeToString(cert))
+	}
+	body, err := json.Marshal(map[string][]string{"chain": chain})
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to encode precertificate submission: %v", err)}
+	}
+	tbs, err := precertificateTBSWithoutPoison(precert)
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to prepare precertificate for SCT verification: %v", err)}
+	}
+
+	scts := make([][]byte, len(s.config.LogURLs))
+	errs := make([]error, len(s.config.LogURLs))
+	var wg sync.WaitGroup
+	for i, logURL := range s.config.LogURLs {
+		wg.Add(1)
+		go func(i int, logURL string) {
+			defer wg.Done()
+			scts[i], errs[i] = s.submitToLog(logURL, s.logKeys[i], body, tbs)
+		}(i, logURL)
+	}
+	wg.Wait()
+
+	var received [][]byte
+	var failures []string
+	for i, sct := range scts {
+		if errs[i] != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", s.config.LogURLs[i], errs[i]))
+			continue
+		}
+		received = append(received, sct)
+	}
+
+	if len(received) < s.config.MinSCTs {
+		msg := fmt.Sprintf("only %d of the required %d Certificate Transparency logs returned an SCT: %v", len(received), s.config.MinSCTs, failures)
+		if s.config.FailurePolicy != ctFailurePolicyAllow {
+			return nil, errutil.UserError{Err: msg}
+		}
+		s.warnings = append(s.warnings, msg+"; issuing the certificate regardless, as failure_policy is \"allow\"")
+	} else if len(failures) > 0 {
+		s.warnings = append(s.warnings, fmt.Sprintf("some Certificate Transparency logs didn't return an SCT: %v", failures))
+	}
+
+	if len(received) == 0 {
+		return nil, nil
+	}
+
+	extension, err := marshalSCTList(received)
+	if err != nil {
+		return nil, errutil.InternalError{Err: err.Error()}
+	}
+	return []pkix.Extension{extension}, nil
+}
+
+// submitToLog submits the chain to the log's add-pre-chain endpoint,
+// verifies the SCT it returns for the precertificate with the given TBS
+// (less the poison) against the log's key, and returns its TLS encoding.
+func (s *ctSubmission) submitToLog(logURL string, logKey crypto.PublicKey, body []byte, tbs []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.SubmissionTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, logURL+"/ct/v1/add-pre-chain", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("log responded with status %v", resp.StatusCode)
+	}
+
+	var result addChainResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("unable to decode log response: %w", err)
+	}
+	if err := result.verify(logKey, s.issuerKeyHash, tbs); err != nil {
+		return nil, err
+	}
+	return result.marshalSCT()
+}
+
+// verify checks that the SCT was issued by the log with the given key, for
+// the precertificate with the given issuer key hash and TBS (less the
+// poison); see RFC 6962 section 3.2.
+func (r *addChainResponse) verify(logKey crypto.PublicKey, issuerKeyHash [32]byte, tbs []byte) error {
+	if logKey == nil {
+		return fmt.Errorf("no public key is configured for the log; unable to verify its SCT")
+	}
+	if r.SCTVersion != 0 {
+		return fmt.Errorf("log returned an SCT of unsupported version %d", r.SCTVersion)
+	}
+
+	keyDer, err := x509.MarshalPKIXPublicKey(logKey)
+	if err != nil {
+		return fmt.Errorf("unable to encode log public key: %w", err)
+	}
+	expectedID := sha256.Sum256(keyDer)
+	if logID, err := base64.StdEncoding.DecodeString(r.ID); err != nil || !bytes.Equal(logID, expectedID[:]) {
+		return fmt.Errorf("log returned an SCT with a log ID not matching its public key")
+	}
+
+	extensions, err := base64.StdEncoding.DecodeString(r.Extensions)
+	if err != nil || len(extensions) > 0xffff {
+		return fmt.Errorf("log returned invalid SCT extensions")
+	}
+	if len(tbs) > 0xffffff {
+		return fmt.Errorf("precertificate too long to verify its SCT")
+	}
+
+	// The DigitallySigned struct: hash and signature algorithms, then the
+	// length-prefixed signature.
+	signature, err := base64.StdEncoding.DecodeString(r.Signature)
+	if err != nil || len(signature) < 4 || int(binary.BigEndian.Uint16(signature[2:4])) != len(signature)-4 {
+		return fmt.Errorf("log returned an invalid SCT signature")
+	}
+	const hashSHA256, signatureRSA, signatureECDSA = 4, 1, 3
+	if signature[0] != hashSHA256 {
+		return fmt.Errorf("log returned an SCT signed with unsupported hash algorithm %d", signature[0])
+	}
+
+	var signed bytes.Buffer
+	signed.WriteByte(r.SCTVersion)
+	signed.WriteByte(0) // signature_type: certificate_timestamp
+	binary.Write(&signed, binary.BigEndian, r.Timestamp)
+	binary.Write(&signed, binary.BigEndian, uint16(1)) // entry_type: precert_entry
+	signed.Write(issuerKeyHash[:])
+	signed.Write([]byte{byte(len(tbs) >> 16), byte(len(tbs) >> 8), byte(len(tbs))})
+	signed.Write(tbs)
+	binary.Write(&signed, binary.BigEndian, uint16(len(extensions)))
+	signed.Write(extensions)
+	digest := sha256.Sum256(signed.Bytes())
+
+	switch key := logKey.(type) {
+	case *ecdsa.PublicKey:
+		if signature[1] != signatureECDSA || !ecdsa.VerifyASN1(key, digest[:], signature[4:]) {
+			return fmt.Errorf("log returned an SCT whose signature doesn't verify")
+		}
+	case *rsa.PublicKey:
+		if signature[1] != signatureRSA || rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature[4:]) != nil {
+			return fmt.Errorf("log returned an SCT whose signature doesn't verify")
+		}
+	default:
+		return fmt.Errorf("unsupported log public key type %T", logKey)
+	}
+	return nil
+}
+
+// precertificateTBSWithoutPoison returns the DER of the precertificate's
+// TBSCertificate with the poison extension removed, which SCTs for it
+// sign.
+func precertificateTBSWithoutPoison(precert []byte) ([]byte, error) {
+	cert, err := x509.ParseCertificate(precert)
+	if err != nil {
+		return nil, err
+	}
+
+	input := cryptobyte.String(cert.RawTBSCertificate)
+	var tbs cryptobyte.String
+	if !input.ReadASN1(&tbs, cbbasn1.SEQUENCE) {
+		return nil, fmt.Errorf("malformed TBSCertificate")
+	}
+
+	var builder cryptobyte.Builder
+	builder.AddASN1(cbbasn1.SEQUENCE, func(out *cryptobyte.Builder) {
+		for !tbs.Empty() {
+			var field cryptobyte.String
+			var tag cbbasn1.Tag
+			if !tbs.ReadAnyASN1Element(&field, &tag) {
+				out.SetError(fmt.Errorf("malformed TBSCertificate"))
+				return
+			}
+			if tag != cbbasn1.Tag(3).Constructed().ContextSpecific() {
+				out.AddBytes(field)
+				continue
+			}
+
+			// The extensions: an explicitly tagged sequence of them.
+			var wrapped, extensions cryptobyte.String
+			if !field.ReadASN1(&wrapped, tag) || !wrapped.ReadASN1(&extensions, cbbasn1.SEQUENCE) {
+				out.SetError(fmt.Errorf("malformed TBSCertificate extensions"))
+				return
+			}
+			out.AddASN1(tag, func(out *cryptobyte.Builder) {
+				out.AddASN1(cbbasn1.SEQUENCE, func(out *cryptobyte.Builder) {
+					for !extensions.Empty() {
+						var extension cryptobyte.String
+						if !extensions.ReadASN1Element(&extension, cbbasn1.SEQUENCE) {
+							out.SetError(fmt.Errorf("malformed TBSCertificate extension"))
+							return
+						}
+						contents := extension
+						var oid asn1.ObjectIdentifier
+						if !contents.ReadASN1(&contents, cbbasn1.SEQUENCE) || !contents.ReadASN1ObjectIdentifier(&oid) {
+							out.SetError(fmt.Errorf("malformed TBSCertificate extension"))
+							return
+						}
+						if !oid.Equal(certutil.PrecertificatePoisonOID) {
+							out.AddBytes(extension)
+						}
+					}
+				})
+			})
+		}
+	})
+	return builder.Bytes()
+}
+
+// marshalSCT returns the TLS encoding of the SignedCertificateTimestamp
+// (RFC 6962 section 3.2), as embedded in certificates.
+func (r *addChainResponse) marshalSCT() ([]byte, error) {
+	logID, err := base64.StdEncoding.DecodeString(r.ID)
+	if err != nil || len(logID) != 32 {
+		return nil, fmt.Errorf("log returned an invalid log ID")
+	}
+	extensions, err := base64.StdEncoding.DecodeString(r.Extensions)
+	if err != nil || len(extensions) > 0xffff {
+		return nil, fmt.Errorf("log returned invalid SCT extensions")
+	}
+	// The signature is a TLS-encoded DigitallySigned struct already.
+	signature, err := base64.StdEncoding.DecodeString(r.Signature)
+	if err != nil || len(signature) < 4 {
+		return nil, fmt.Errorf("log returned an invalid SCT signature")
+	}
+
+	var sct bytes.Buffer
+	sct.WriteByte(r.SCTVersion)
+	sct.Write(logID)
+	binary.Write(&sct, binary.BigEndian, r.Timestamp)
+	binary.Write(&sct, binary.BigEndian, uint16(len(extensions)))
+	sct.Write(extensions)
+	sct.Write(signature)
+	return sct.Bytes(), nil
+}
+
+// marshalSCTList returns the certificate extension embedding the given
+// SCTs (RFC 6962 section 3.3).
+func marshalSCTList(scts [][]byte) (pkix.Extension, error) {
+	var list bytes.Buffer
+	for _, sct := range scts {
+		if len(sct) > 0xffff {
+			return pkix.Extension{}, fmt.Errorf("SCT too long to embed")
+		}
+		binary.Write(&list, binary.BigEndian, uint16(len(sct)))
+		list.Write(sct)
+	}
+	if list.Len() > 0xffff {
+		return pkix.Extension{}, fmt.Errorf("SCT list too long to embed")
+	}
+
+	var serialized bytes.Buffer
+	binary.Write(&serialized, binary.BigEndian, uint16(list.Len()))
+	serialized.Write(list.Bytes())
+
+	value, err := asn1.Marshal(serialized.Bytes())
+	if err != nil {
+		return pkix.Extension{}, fmt.Errorf("unable to encode SCT list: %w", err)
+	}
+	return pkix.Extension{Id: certutil.SCTListOID, Value: value}, nil
+}
@@ -0,0 +1,306 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// With config/events, the mount publishes structured events about the
+// lifecycle of its certificates (their issuance, revocation and upcoming
+// expiry) and about CRL rebuilds, by POSTing them as JSON to a webhook, so
+// that downstream systems can react to them rather than polling CRLs or
+// scraping the audit log.
+//
+// Expiry events are found by a periodic scan of the certificate metadata
+// store, which publishes an event for each stored, unrevoked certificate
+// once it comes within the configured expiry window; certificates issued by
+// roles with no_store set aren't covered.
+//
+// Events are published after the change they describe was persisted, and
+// delivered asynchronously by a background worker, so neither revocations
+// nor CRL builds wait on (or fail because of) the webhook. Delivery is best
+// effort: failed deliveries are retried a few times, and events are dropped
+// when the queue is full or the mount is unmounted or sealed. With an
+// hmac_key configured, each delivery carries an HMAC-SHA256 of its body in
+// the eventSignatureHeader header, so that the webhook can authenticate it.
+const (
+	eventTypeIssue      = "pki/issue"
+	eventTypeSign       = "pki/sign"
+	eventTypeRevoke     = "pki/revoke"
+	eventTypeExpiring   = "pki/expiring"
+	eventTypeExpiryNote = "pki/expiry-notification"
+	eventTypeCRLRebuild = "pki/crl-rebuild"
+
+	// eventQueueSize bounds the number of events pending delivery.
+	eventQueueSize = 1024
+
+	eventDeliveryAttempts = 3
+	eventDeliveryTimeout  = 10 * time.Second
+	eventRetryBackoff     = 1 * time.Second
+
+	// eventSignatureHeader carries "sha256=" followed by the hex-encoded
+	// HMAC-SHA256 of the request body, keyed with the configured hmac_key.
+	eventSignatureHeader = "X-Vault-PKI-Signature"
+
+	// eventExpiryScanInterval is how often the certificate metadata store
+	// is scanned for certificates coming within the expiry window.
+	eventExpiryScanInterval = 1 * time.Hour
+	eventExpiryScanPath     = "events/expiry-scan"
+)
+
+var allEventTypes = []string{eventTypeIssue, eventTypeSign, eventTypeRevoke, eventTypeExpiring, eventTypeExpiryNote, eventTypeCRLRebuild}
+
+// expiryScanState records how far the expiry scan has progressed: expiry
+// events have been published for certificates expiring up to
+// ScannedUntil.
+type expiryScanState struct {
+	LastScan     time.Time `json:"last_scan"`
+	ScannedUntil time.Time `json:"scanned_until"`
+}
+
+type pkiEvent struct {
+	Type string                 `json:"type"`
+	Time time.Time              `json:"time"`
+	Data map[string]interface{} `json:"data"`
+}
+
+type queuedEvent struct {
+	webhookURL string
+	hmacKey    string
+	event      *pkiEvent
+}
+
+type eventPublisher struct {
+	client *http.Client
+
+	queue  chan *queuedEvent
+	worker stoppableWorker
+}
+
+func newEventPublisher() *eventPublisher {
+	return &eventPublisher{
+		client: &http.Client{Timeout: eventDeliveryTimeout},
+		queue:  make(chan *queuedEvent, eventQueueSize),
+	}
+}
+
+// publishEvent queues the event of the given type for delivery, if events
+// of that type are enabled. Errors are logged rather than returned, as the
+// change being described has already taken place.
+func (b *backend) publishEvent(sc *storageContext, eventType string, data map[string]interface{}) {
+	config, err := sc.getEventsConfig()
+	if err != nil {
+		b.Logger().Warn("unable to fetch events configuration; not publishing event", "type", eventType, "error", err)
+		return
+	}
+
+	if !config.publishes(eventType) {
+		return
+	}
+
+	b.queueEvent(config.WebhookURL, config.HMACKey, eventType, data)
+}
+
+// queueEvent queues the event for delivery to the given webhook, signed
+// with hmacKey if it isn't empty.
+func (b *backend) queueEvent(webhookURL string, hmacKey string, eventType string, data map[string]interface{}) {
+	b.events.startWorker(b.Logger())
+
+	queued := &queuedEvent{
+		webhookURL: webhookURL,
+		hmacKey:    hmacKey,
+		event: &pkiEvent{
+			Type: eventType,
+			Time: time.Now().UTC(),
+			Data: data,
+		},
+	}
+
+	select {
+	case b.events.queue <- queued:
+	default:
+		b.Logger().Warn("event queue is full; dropping event", "type", eventType)
+	}
+}
+
+// startWorker launches the goroutine delivering queued events, if it
+// isn't running already.
+func (p *eventPublisher) startWorker(logger hclog.Logger) {
+	p.worker.start(func(ctx context.Context) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case queued := <-p.queue:
+				p.deliver(ctx, logger, queued)
+			}
+		}
+	})
+}
+
+// stopWorker stops the delivery worker, if running, abandoning any
+// delivery in progress; events still queued are dropped.
+func (p *eventPublisher) stopWorker() {
+	p.worker.stop()
+}
+
+// deliver POSTs the event to its webhook, retrying failed attempts until
+// the worker is stopped.
+func (p *eventPublisher) deliver(ctx context.Context, logger hclog.Logger, queued *queuedEvent) {
+	body, err := json.Marshal(queued.event)
+	if err != nil {
+		logger.Warn("unable to encode event; dropping it", "type", queued.event.Type, "error", err)
+		return
+	}
+
+	for attempt := 1; attempt <= eventDeliveryAttempts; attempt++ {
+		err = p.post(ctx, queued.webhookURL, queued.hmacKey, body)
+		if err == nil {
+			return
+		}
+
+		if attempt < eventDeliveryAttempts {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Duration(attempt) * eventRetryBackoff):
+			}
+		}
+	}
+
+	logger.Warn("unable to deliver event; dropping it", "type", queued.event.Type, "attempts", eventDeliveryAttempts, "error", err)
+}
+
+func (p *eventPublisher) post(ctx context.Context, webhookURL string, hmacKey string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, eventDeliveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if hmacKey != "" {
+		req.Header.Set(eventSignatureHeader, signEventBody(hmacKey, body))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %v", resp.StatusCode)
+	}
+	return nil
+}
+
+// signEventBody returns the eventSignatureHeader value for the body.
+func signEventBody(hmacKey string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(hmacKey))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// issuanceEvent describes a newly issued or signed certificate.
+func issuanceEvent(cert *x509.Certificate, issuer issuerID, role string) map[string]interface{} {
+	return map[string]interface{}{
+		"serial_number": serialFromCert(cert),
+		"issuer_id":     string(issuer),
+		"role":          role,
+		"common_name":   cert.Subject.CommonName,
+		"not_before":    cert.NotBefore.UTC().Format(time.RFC3339),
+		"not_after":     cert.NotAfter.UTC().Format(time.RFC3339),
+	}
+}
+
+// publishExpiringCertEvents publishes an expiry event for each stored,
+// unrevoked certificate which came within the expiry window since the last
+// scan. Scans run at most every eventExpiryScanInterval, unless forced.
+func (b *backend) publishExpiringCertEvents(sc *storageContext, force bool) error {
+	config, err := sc.getEventsConfig()
+	if err != nil {
+		return err
+	}
+	if !config.publishes(eventTypeExpiring) || config.ExpiryWindow <= 0 {
+		return nil
+	}
+
+	var state expiryScanState
+	entry, err := sc.Storage.Get(sc.Context, eventExpiryScanPath)
+	if err != nil {
+		return fmt.Errorf("unable to fetch expiry scan state: %w", err)
+	}
+	if entry != nil {
+		if err := entry.DecodeJSON(&state); err != nil {
+			return fmt.Errorf("unable to decode expiry scan state: %w", err)
+		}
+	}
+
+	now := time.Now().UTC()
+	if !force && now.Sub(state.LastScan) < eventExpiryScanInterval {
+		return nil
+	}
+
+	// Certificates which expired before this scan aren't of interest.
+	from := state.ScannedUntil
+	if from.Before(now) {
+		from = now
+	}
+	until := now.Add(config.ExpiryWindow)
+
+	if until.After(from) {
+		serials, err := listCertMetadataExpiring(sc, from, until)
+		if err != nil {
+			return fmt.Errorf("unable to list expiring certificates: %w", err)
+		}
+
+		for _, serial := range serials {
+			meta, err := sc.fetchCertMetadata(serial)
+			if err != nil {
+				return err
+			}
+			if meta == nil || !meta.NotAfter.After(from) || meta.NotAfter.After(until) {
+				continue
+			}
+
+			revoked, err := sc.Storage.Get(sc.Context, revokedPath+normalizeSerial(serial))
+			if err != nil {
+				return fmt.Errorf("unable to fetch revocation status of %v: %w", serial, err)
+			}
+			if revoked != nil {
+				continue
+			}
+
+			b.publishEvent(sc, eventTypeExpiring, map[string]interface{}{
+				"serial_number": meta.SerialNumber,
+				"issuer_id":     string(meta.IssuerID),
+				"role":          meta.Role,
+				"common_name":   meta.CommonName,
+				"not_after":     meta.NotAfter.Format(time.RFC3339),
+				"expires_in":    int64(meta.NotAfter.Sub(now).Seconds()),
+			})
+		}
+
+		state.ScannedUntil = until
+	}
+
+	state.LastScan = now
+	entry, err = logical.StorageEntryJSON(eventExpiryScanPath, state)
+	if err != nil {
+		return err
+	}
+	return sc.Storage.Put(sc.Context, entry)
+}
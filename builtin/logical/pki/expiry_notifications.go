@@ -0,0 +1,245 @@
+package pki
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// With config/expiry-notifications, the mount periodically scans its stored
+// certificates for those coming within the configured window of expiry and
+// notifies of them, grouped by role and common name, so that teams are
+// nudged to renew their certificates rather than finding out from an
+// outage. Unlike the per-certificate pki/expiring events, one notification
+// covers every certificate of a group found by a scan.
+//
+// The scan walks the metadata store's expiry index, a UTC day at a time.
+// Like the expiry events scan, it records how far it got: certificates
+// expiring up to ScannedUntil have been notified of. Each run looks at a
+// bounded number of certificates, stopping wherever the bound was reached,
+// even within a day; the next periodic run then resumes the scan from
+// there, rather than waiting for the scan interval. The groups found so far
+// are kept with the scan's state, and notified of once the scan completes,
+// so that a group spanning several runs is notified of once.
+const (
+	// expiryNotificationScanInterval is how often complete scans run.
+	expiryNotificationScanInterval = 1 * time.Hour
+
+	// expiryNotificationScanBatchSize bounds the number of certificates
+	// looked at by a single scan run.
+	expiryNotificationScanBatchSize = 5000
+
+	expiryNotificationScanPath = "expiry-notifications/scan"
+)
+
+type expiryNotificationScanState struct {
+	LastScan     time.Time `json:"last_scan"`
+	ScannedUntil time.Time `json:"scanned_until"`
+	// InProgress is set while a scan was cut short by the batch size.
+	InProgress bool `json:"in_progress"`
+
+	// Of a scan in progress: the window of expiry it covers, the day and
+	// serial number it stopped after, and the groups it found so far.
+	ScanFrom    time.Time                           `json:"scan_from,omitempty"`
+	ScanUntil   time.Time                           `json:"scan_until,omitempty"`
+	ResumeDay   string                              `json:"resume_day,omitempty"`
+	ResumeAfter string                              `json:"resume_after,omitempty"`
+	Groups      map[string]*expiryNotificationGroup `json:"groups,omitempty"`
+}
+
+// expiryNotificationGroup collects the certificates of one role and common
+// name found by a scan.
+type expiryNotificationGroup struct {
+	Role       string    `json:"role"`
+	CommonName string    `json:"common_name"`
+	Serials    []string  `json:"serials"`
+	Issuers    []string  `json:"issuers,omitempty"`
+	Earliest   time.Time `json:"earliest"`
+	Latest     time.Time `json:"latest"`
+}
+
+func (g *expiryNotificationGroup) add(meta *certMetadata) {
+	g.Serials = append(g.Serials, meta.SerialNumber)
+	if meta.IssuerID != "" && !strutil.StrListContains(g.Issuers, string(meta.IssuerID)) {
+		g.Issuers = append(g.Issuers, string(meta.IssuerID))
+	}
+	if g.Earliest.IsZero() || meta.NotAfter.Before(g.Earliest) {
+		g.Earliest = meta.NotAfter
+	}
+	if meta.NotAfter.After(g.Latest) {
+		g.Latest = meta.NotAfter
+	}
+}
+
+func (g *expiryNotificationGroup) eventData(now time.Time) map[string]interface{} {
+	sort.Strings(g.Serials)
+	return map[string]interface{}{
+		"role":               g.Role,
+		"common_name":        g.CommonName,
+		"count":              len(g.Serials),
+		"serial_numbers":     g.Serials,
+		"issuer_ids":         nonNilStrings(g.Issuers),
+		"earliest_not_after": g.Earliest.Format(time.RFC3339),
+		"latest_not_after":   g.Latest.Format(time.RFC3339),
+		"expires_in":         int64(g.Earliest.Sub(now).Seconds()),
+	}
+}
+
+func (sc *storageContext) getExpiryNotificationScanState() (*expiryNotificationScanState, error) {
+	var state expiryNotificationScanState
+	entry, err := sc.Storage.Get(sc.Context, expiryNotificationScanPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch expiry notification scan state: %w", err)
+	}
+	if entry != nil {
+		if err := entry.DecodeJSON(&state); err != nil {
+			return nil, fmt.Errorf("unable to decode expiry notification scan state: %w", err)
+		}
+	}
+	return &state, nil
+}
+
+// notifyExpiringCerts runs the expiry notification scan, if enabled and
+// due: at most every expiryNotificationScanInterval, unless forced or
+// resuming a scan cut short. A run looks at most at batchSize certificates.
+func (b *backend) notifyExpiringCerts(sc *storageContext, force bool, batchSize int) error {
+	config, err := sc.getExpiryNotificationsConfig()
+	if err != nil {
+		return err
+	}
+	if !config.Enabled {
+		return nil
+	}
+
+	state, err := sc.getExpiryNotificationScanState()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	if !force && !state.InProgress && now.Sub(state.LastScan) < expiryNotificationScanInterval {
+		return nil
+	}
+
+	if !state.InProgress {
+		// Certificates which expired before this scan aren't of interest.
+		state.ScanFrom = state.ScannedUntil
+		if state.ScanFrom.Before(now) {
+			state.ScanFrom = now
+		}
+		state.ScanUntil = now.Add(config.ExpiryWindow)
+		state.ResumeDay = ""
+		state.ResumeAfter = ""
+		state.Groups = map[string]*expiryNotificationGroup{}
+	} else if state.Groups == nil {
+		// Resuming a scan which hadn't found any certificate yet.
+		state.Groups = map[string]*expiryNotificationGroup{}
+	}
+	from, until := state.ScanFrom, state.ScanUntil
+
+	state.InProgress = false
+	if until.After(from) {
+		days, err := sc.Storage.List(sc.Context, certMetadataExpiryPath)
+		if err != nil {
+			return fmt.Errorf("unable to list certificate expiry index: %w", err)
+		}
+		sort.Strings(days)
+
+		scanned := 0
+	scan:
+		for _, day := range days {
+			day = strings.TrimSuffix(day, "/")
+			if day < certMetadataExpiryKey(from) || day > certMetadataExpiryKey(until) || day < state.ResumeDay {
+				continue
+			}
+
+			serials, err := sc.Storage.List(sc.Context, certMetadataExpiryPath+day+"/")
+			if err != nil {
+				return fmt.Errorf("unable to list expiring certificates: %w", err)
+			}
+			sort.Strings(serials)
+
+			for _, serial := range serials {
+				if day == state.ResumeDay && serial <= state.ResumeAfter {
+					continue
+				}
+				if scanned >= batchSize {
+					// Resume after the last certificate looked at.
+					state.InProgress = true
+					break scan
+				}
+				scanned++
+				state.ResumeDay = day
+				state.ResumeAfter = serial
+
+				meta, err := sc.fetchCertMetadata(serial)
+				if err != nil {
+					return err
+				}
+				if meta == nil || !meta.NotAfter.After(from) || meta.NotAfter.After(until) || meta.RenewedBy != "" {
+					continue
+				}
+
+				revoked, err := sc.Storage.Get(sc.Context, revokedPath+normalizeSerial(serial))
+				if err != nil {
+					return fmt.Errorf("unable to fetch revocation status of %v: %w", serial, err)
+				}
+				if revoked != nil {
+					continue
+				}
+
+				key := meta.Role + "\x00" + strings.ToLower(meta.CommonName)
+				group, ok := state.Groups[key]
+				if !ok {
+					group = &expiryNotificationGroup{Role: meta.Role, CommonName: meta.CommonName}
+					state.Groups[key] = group
+				}
+				group.add(meta)
+			}
+		}
+	}
+
+	if !state.InProgress {
+		b.sendExpiryNotifications(sc, config, state.Groups, now)
+		if until.After(state.ScannedUntil) {
+			state.ScannedUntil = until
+		}
+		state.LastScan = now
+		state.ScanFrom = time.Time{}
+		state.ScanUntil = time.Time{}
+		state.ResumeDay = ""
+		state.ResumeAfter = ""
+		state.Groups = nil
+	}
+	entry, err := logical.StorageEntryJSON(expiryNotificationScanPath, state)
+	if err != nil {
+		return err
+	}
+	return sc.Storage.Put(sc.Context, entry)
+}
+
+// sendExpiryNotifications logs, and publishes, a notification per group,
+// in order of role and common name.
+func (b *backend) sendExpiryNotifications(sc *storageContext, config *expiryNotificationsConfigEntry, groups map[string]*expiryNotificationGroup, now time.Time) {
+	var keys []string
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		group := groups[key]
+		b.Logger().Warn("certificates are nearing expiry", "role", group.Role, "common_name", group.CommonName,
+			"count", len(group.Serials), "earliest_not_after", group.Earliest.Format(time.RFC3339))
+
+		data := group.eventData(now)
+		b.publishEvent(sc, eventTypeExpiryNote, data)
+		if config.WebhookURL != "" {
+			b.queueEvent(config.WebhookURL, "", eventTypeExpiryNote, data)
+		}
+	}
+}
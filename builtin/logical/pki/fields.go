@@ -88,6 +88,7 @@ comma-delimited list.`,
 // certificate issuing and signing
 func addNonCACommonFields(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
 	fields = addIssueAndSignCommonFields(fields)
+	fields = addPkcs7FormatField(fields)
 
 	fields["role"] = &framework.FieldSchema{
 		Type: framework.TypeString,
@@ -141,11 +142,65 @@ be larger than the role max TTL.`,
 The value format should be given in UTC format YYYY-MM-ddTHH:MM:SSZ`,
 	}
 
+	fields["not_before"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `Set the not before field of the certificate with specified date value,
+in place of the role's not_before_duration. The value format should be given
+in UTC format YYYY-MM-ddTHH:MM:SSZ. Only allowed when the role sets
+allow_not_before; it may not be in the future, nor backdated further than the
+mount's max_not_before_duration.`,
+	}
+
+	fields["custom_extensions"] = &framework.FieldSchema{
+		Type: framework.TypeCommaStringSlice,
+		Description: `Requested custom extensions, in an array with the
+format <oid>:<base64 DER value> for each entry, or <oid>;critical:<base64 DER
+value> to mark the extension critical. Each OID must be allowed by the role's
+allowed_extension_oids.`,
+		DisplayAttrs: &framework.DisplayAttributes{
+			Name: "Custom Extensions",
+		},
+	}
+
+	fields["user_principal_names"] = &framework.FieldSchema{
+		Type: framework.TypeCommaStringSlice,
+		Description: `Requested User Principal Names, as used for smartcard
+logon. Each is added as an other SAN with OID 1.3.6.1.4.1.311.20.2.3 and
+must be allowed by the role's allowed_other_sans.`,
+		DisplayAttrs: &framework.DisplayAttributes{
+			Name: "User Principal Names (UPNs)",
+		},
+	}
+
 	fields = addIssuerRefField(fields)
 
 	return fields
 }
 
+// addPkcs7FormatField replaces the format field with one which also accepts
+// "pkcs7", for endpoints returning a signed certificate with its CA chain
+// rather than generating a CA.
+func addPkcs7FormatField(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields["format"] = &framework.FieldSchema{
+		Type:    framework.TypeString,
+		Default: "pem",
+		Description: `Format for returned data. Can be "pem", "der",
+"pem_bundle" or "pkcs7". If "pem_bundle", any private
+key and issuing cert will be appended to the
+certificate pem. If "der", the value will be
+base64 encoded. If "pkcs7", the certificate will be
+a PEM encoded PKCS#7 bundle of the certificate and
+its CA chain; other values are returned as with
+"pem". Defaults to "pem".`,
+		AllowedValues: []interface{}{"pem", "der", "pem_bundle", "pkcs7"},
+		DisplayAttrs: &framework.DisplayAttributes{
+			Value: "pem",
+		},
+	}
+
+	return fields
+}
+
 // addCACommonFields adds fields with help text specific to CA
 // certificate issuing and signing
 func addCACommonFields(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
@@ -284,14 +339,16 @@ the private key!`,
 	fields["managed_key_name"] = &framework.FieldSchema{
 		Type: framework.TypeString,
 		Description: `The name of the managed key to use when the exported
-type is kms. When kms type is the key type, this field or managed_key_id
+type is kms; this may also be the name of a cloud KMS key imported
+into the mount. When kms type is the key type, this field or managed_key_id
 is required. Ignored for other types.`,
 	}
 
 	fields["managed_key_id"] = &framework.FieldSchema{
 		Type: framework.TypeString,
 		Description: `The name of the managed key to use when the exported
-type is kms. When kms type is the key type, this field or managed_key_name
+type is kms; this may also be the ID of a cloud KMS key imported into
+the mount. When kms type is the key type, this field or managed_key_name
 is required. Ignored for other types.`,
 	}
 
@@ -359,11 +416,153 @@ func addCAIssueFields(fields map[string]*framework.FieldSchema) map[string]*fram
 		},
 	}
 
+	fields["excluded_dns_domains"] = &framework.FieldSchema{
+		Type:        framework.TypeCommaStringSlice,
+		Description: `Domains for which this certificate is not allowed to sign or issue child certificates (see https://tools.ietf.org/html/rfc5280#section-4.2.1.10).`,
+		DisplayAttrs: &framework.DisplayAttributes{
+			Name: "Excluded DNS Domains",
+		},
+	}
+
+	fields["permitted_ip_ranges"] = &framework.FieldSchema{
+		Type:        framework.TypeCommaStringSlice,
+		Description: `IP ranges, in CIDR notation, for which this certificate is allowed to sign or issue child certificates. If set, all IP SANs on child certs must be within one of the given ranges.`,
+		DisplayAttrs: &framework.DisplayAttributes{
+			Name: "Permitted IP Ranges",
+		},
+	}
+
+	fields["excluded_ip_ranges"] = &framework.FieldSchema{
+		Type:        framework.TypeCommaStringSlice,
+		Description: `IP ranges, in CIDR notation, for which this certificate is not allowed to sign or issue child certificates.`,
+		DisplayAttrs: &framework.DisplayAttributes{
+			Name: "Excluded IP Ranges",
+		},
+	}
+
+	fields["permitted_email_addresses"] = &framework.FieldSchema{
+		Type:        framework.TypeCommaStringSlice,
+		Description: `Email addresses, hosts or domains for which this certificate is allowed to sign or issue child certificates. If set, all email addresses on child certs must match one of them.`,
+		DisplayAttrs: &framework.DisplayAttributes{
+			Name: "Permitted Email Addresses",
+		},
+	}
+
+	fields["excluded_email_addresses"] = &framework.FieldSchema{
+		Type:        framework.TypeCommaStringSlice,
+		Description: `Email addresses, hosts or domains for which this certificate is not allowed to sign or issue child certificates.`,
+		DisplayAttrs: &framework.DisplayAttributes{
+			Name: "Excluded Email Addresses",
+		},
+	}
+
+	fields["permitted_uri_domains"] = &framework.FieldSchema{
+		Type:        framework.TypeCommaStringSlice,
+		Description: `Hosts or domains (with a leading period) for which this certificate is allowed to sign or issue child certificates. If set, the hosts of all URI SANs on child certs must match one of them.`,
+		DisplayAttrs: &framework.DisplayAttributes{
+			Name: "Permitted URI Domains",
+		},
+	}
+
+	fields["excluded_uri_domains"] = &framework.FieldSchema{
+		Type:        framework.TypeCommaStringSlice,
+		Description: `Hosts or domains (with a leading period) for which this certificate is not allowed to sign or issue child certificates.`,
+		DisplayAttrs: &framework.DisplayAttributes{
+			Name: "Excluded URI Domains",
+		},
+	}
+
+	fields["name_constraints_critical"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Default:     true,
+		Description: `Whether to mark the name constraints extension critical, as RFC 5280 requires. Defaults to true.`,
+		DisplayAttrs: &framework.DisplayAttributes{
+			Name: "Name Constraints Critical",
+		},
+	}
+
 	fields = addIssuerNameField(fields)
 
 	return fields
 }
 
+func addRevocationMetadataFields(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields["ticket_id"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `Identifier of the ticket or change request tracking this revocation.`,
+	}
+	fields["requester"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `Identity of the party who requested this revocation.`,
+	}
+	fields["note"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `Free-form note recorded with this revocation.`,
+	}
+	return fields
+}
+
+// addTidyFields adds the fields selecting what to tidy, for both manual
+// tidy operations and the auto-tidy configuration.
+func addTidyFields(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields["tidy_cert_store"] = &framework.FieldSchema{
+		Type: framework.TypeBool,
+		Description: `Set to true to enable tidying up
+the certificate store`,
+	}
+
+	fields["tidy_revocation_list"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: `Deprecated; synonym for 'tidy_revoked_certs`,
+	}
+
+	fields["tidy_revoked_certs"] = &framework.FieldSchema{
+		Type: framework.TypeBool,
+		Description: `Set to true to expire all revoked
+and expired certificates, removing them both from the CRL and from storage. The
+CRL will be rotated if this causes any values to be removed.`,
+	}
+
+	fields["tidy_revoked_cert_issuer_associations"] = &framework.FieldSchema{
+		Type: framework.TypeBool,
+		Description: `Set to true to validate issuer associations
+on revocation entries. This helps increase the performance of CRL building
+and OCSP responses.`,
+	}
+
+	fields["tidy_revocation_issuer_associations"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: `Synonym for 'tidy_revoked_cert_issuer_associations'`,
+	}
+
+	fields["tidy_expired_issuers"] = &framework.FieldSchema{
+		Type: framework.TypeBool,
+		Description: `Set to true to remove issuers whose
+certificates expired more than issuer_safety_buffer ago, along with the CRLs
+of issuers which no longer exist and expired final CRLs of deleted issuers.
+The default issuer is never removed.`,
+	}
+
+	fields["issuer_safety_buffer"] = &framework.FieldSchema{
+		Type: framework.TypeDurationSecond,
+		Description: `The amount of extra time that must have passed
+beyond issuer expiration before it is removed from the backend storage.
+Defaults to 8760 hours (1 year).`,
+		Default: 31536000, // 1 year, but TypeDurationSecond currently requires defaults to be int
+	}
+
+	fields["safety_buffer"] = &framework.FieldSchema{
+		Type: framework.TypeDurationSecond,
+		Description: `The amount of extra time that must have passed
+beyond certificate expiration before it is removed
+from the backend storage and/or revocation list.
+Defaults to 72 hours.`,
+		Default: 259200, // 72h, but TypeDurationSecond currently requires defaults to be int
+	}
+
+	return fields
+}
+
 func addIssuerRefNameFields(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
 	fields = addIssuerNameField(fields)
 	fields = addIssuerRefField(fields)
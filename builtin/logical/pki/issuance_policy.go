@@ -0,0 +1,254 @@
+package pki
+
+import (
+	"crypto/x509"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+)
+
+// Issuance policies are CEL expressions, set on the mount (config/mount)
+// and on roles, evaluated before a leaf certificate is issued or signed.
+// An expression evaluates to either a bool (false denies issuance) or a
+// string (non-empty denies issuance, with the string as the reason).
+//
+// Expressions may reference:
+//
+//   - cert: the certificate about to be issued, with the common_name,
+//     dns_names, email_addresses, ip_addresses, uri_sans, other_sans,
+//     subject (organization, ou, country, locality, province,
+//     street_address, postal_code and serial_number), key_type, key_bits,
+//     not_after and extensions (OIDs of requested custom extensions) keys,
+//   - csr: the submitted CSR, with the common_name, dns_names,
+//     email_addresses, ip_addresses, uri_sans, key_type, key_bits and
+//     extensions (OIDs) keys; empty when issuing without a CSR,
+//   - ttl: the validity period of the certificate, as a duration, and
+//   - requester: the entity_id, display_name and remote_address of the
+//     requester.
+//
+// Expressions are compiled when the mount configuration or role is written,
+// and the compiled programs cached (by expression) for issuance. Each
+// evaluation is bounded by issuancePolicyCostLimit, so that an expensive
+// expression (such as nested comprehensions over large lists) fails rather
+// than holding up issuance.
+const (
+	issuancePolicyCostLimit = 1000000
+	issuancePolicyCacheSize = 1024
+)
+
+var (
+	issuancePolicyEnvOnce sync.Once
+	issuancePolicyEnv     *cel.Env
+	issuancePolicyEnvErr  error
+
+	issuancePolicyCache, _ = lru.New(issuancePolicyCacheSize)
+)
+
+func getIssuancePolicyEnv() (*cel.Env, error) {
+	issuancePolicyEnvOnce.Do(func() {
+		issuancePolicyEnv, issuancePolicyEnvErr = cel.NewEnv(
+			cel.Variable("cert", cel.MapType(cel.StringType, cel.DynType)),
+			cel.Variable("csr", cel.MapType(cel.StringType, cel.DynType)),
+			cel.Variable("ttl", cel.DurationType),
+			cel.Variable("requester", cel.MapType(cel.StringType, cel.StringType)),
+		)
+	})
+
+	return issuancePolicyEnv, issuancePolicyEnvErr
+}
+
+// compileIssuancePolicy compiles and type-checks an issuance policy
+// expression, returning the cached program when it was already compiled.
+func compileIssuancePolicy(expression string) (cel.Program, error) {
+	if program, ok := issuancePolicyCache.Get(expression); ok {
+		return program.(cel.Program), nil
+	}
+
+	env, err := getIssuancePolicyEnv()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create issuance policy environment: %w", err)
+	}
+
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("invalid issuance policy: %w", issues.Err())
+	}
+	switch ast.OutputType() {
+	case cel.BoolType, cel.StringType, cel.DynType:
+	default:
+		return nil, fmt.Errorf("invalid issuance policy: the expression must evaluate to a bool or a string, not %v", ast.OutputType())
+	}
+
+	program, err := env.Program(ast, cel.CostLimit(issuancePolicyCostLimit))
+	if err != nil {
+		return nil, fmt.Errorf("invalid issuance policy: %w", err)
+	}
+
+	issuancePolicyCache.Add(expression, program)
+	return program, nil
+}
+
+// evaluateIssuancePolicy evaluates the expression against the activation,
+// returning whether issuance is allowed and, if not, why.
+func evaluateIssuancePolicy(expression string, activation map[string]interface{}) (bool, string, error) {
+	program, err := compileIssuancePolicy(expression)
+	if err != nil {
+		return false, "", err
+	}
+
+	result, _, err := program.Eval(activation)
+	if err != nil {
+		return false, "", fmt.Errorf("unable to evaluate issuance policy: %w", err)
+	}
+
+	switch value := result.(type) {
+	case types.Bool:
+		return bool(value), "", nil
+	case types.String:
+		return value == "", string(value), nil
+	default:
+		return false, "", fmt.Errorf("issuance policy evaluated to a %v, not a bool or a string", result.Type())
+	}
+}
+
+// checkIssuancePolicies evaluates the mount's and the role's issuance
+// policies, if any, against the certificate about to be issued.
+func checkIssuancePolicies(data *inputBundle, creation *certutil.CreationBundle, keyType string, keyBits int) error {
+	if data.mountIssuancePolicy == "" && data.role.IssuancePolicy == "" {
+		return nil
+	}
+
+	activation := issuancePolicyActivation(data, creation, keyType, keyBits)
+	for _, policy := range []struct {
+		source     string
+		expression string
+	}{
+		{"mount", data.mountIssuancePolicy},
+		{"role", data.role.IssuancePolicy},
+	} {
+		if policy.expression == "" {
+			continue
+		}
+
+		allowed, reason, err := evaluateIssuancePolicy(policy.expression, activation)
+		if err != nil {
+			return errutil.UserError{Err: fmt.Sprintf("the %s's issuance policy could not be evaluated: %v", policy.source, err)}
+		}
+		if !allowed {
+			if reason == "" {
+				reason = "the request does not satisfy it"
+			}
+			return errutil.UserError{Err: fmt.Sprintf("issuance denied by the %s's issuance policy: %s", policy.source, reason)}
+		}
+	}
+
+	return nil
+}
+
+func issuancePolicyActivation(data *inputBundle, creation *certutil.CreationBundle, keyType string, keyBits int) map[string]interface{} {
+	params := creation.Params
+
+	var otherSANs []string
+	for oid, values := range params.OtherSANs {
+		for _, value := range values {
+			otherSANs = append(otherSANs, oid+";UTF8:"+value)
+		}
+	}
+	var extensions []string
+	for _, ext := range params.CustomExtensions {
+		extensions = append(extensions, ext.Id.String())
+	}
+	var ipAddresses []string
+	for _, ip := range params.IPAddresses {
+		ipAddresses = append(ipAddresses, ip.String())
+	}
+	var uriSANs []string
+	for _, uri := range params.URIs {
+		uriSANs = append(uriSANs, uri.String())
+	}
+
+	cert := map[string]interface{}{
+		"common_name":     params.Subject.CommonName,
+		"dns_names":       nonNilStrings(params.DNSNames),
+		"email_addresses": nonNilStrings(params.EmailAddresses),
+		"ip_addresses":    nonNilStrings(ipAddresses),
+		"uri_sans":        nonNilStrings(uriSANs),
+		"other_sans":      nonNilStrings(otherSANs),
+		"subject": map[string]interface{}{
+			"organization":   nonNilStrings(params.Subject.Organization),
+			"ou":             nonNilStrings(params.Subject.OrganizationalUnit),
+			"country":        nonNilStrings(params.Subject.Country),
+			"locality":       nonNilStrings(params.Subject.Locality),
+			"province":       nonNilStrings(params.Subject.Province),
+			"street_address": nonNilStrings(params.Subject.StreetAddress),
+			"postal_code":    nonNilStrings(params.Subject.PostalCode),
+			"serial_number":  params.Subject.SerialNumber,
+		},
+		"key_type":   keyType,
+		"key_bits":   keyBits,
+		"not_after":  params.NotAfter,
+		"extensions": nonNilStrings(extensions),
+	}
+
+	csr := map[string]interface{}{}
+	if creation.CSR != nil {
+		csr = csrPolicyFields(creation.CSR, keyType, keyBits)
+	}
+
+	requester := map[string]string{}
+	if data.req != nil {
+		requester["entity_id"] = data.req.EntityID
+		requester["display_name"] = data.req.DisplayName
+		if data.req.Connection != nil {
+			requester["remote_address"] = data.req.Connection.RemoteAddr
+		}
+	}
+
+	return map[string]interface{}{
+		"cert":      cert,
+		"csr":       csr,
+		"ttl":       time.Until(params.NotAfter).Round(time.Second),
+		"requester": requester,
+	}
+}
+
+func csrPolicyFields(csr *x509.CertificateRequest, keyType string, keyBits int) map[string]interface{} {
+	var ipAddresses []string
+	for _, ip := range csr.IPAddresses {
+		ipAddresses = append(ipAddresses, ip.String())
+	}
+	var uriSANs []string
+	for _, uri := range csr.URIs {
+		uriSANs = append(uriSANs, uri.String())
+	}
+	var extensions []string
+	for _, ext := range csr.Extensions {
+		extensions = append(extensions, ext.Id.String())
+	}
+
+	return map[string]interface{}{
+		"common_name":     csr.Subject.CommonName,
+		"dns_names":       nonNilStrings(csr.DNSNames),
+		"email_addresses": nonNilStrings(csr.EmailAddresses),
+		"ip_addresses":    nonNilStrings(ipAddresses),
+		"uri_sans":        nonNilStrings(uriSANs),
+		"key_type":        keyType,
+		"key_bits":        keyBits,
+		"extensions":      nonNilStrings(extensions),
+	}
+}
+
+// nonNilStrings returns an empty list in place of a nil one, so that
+// policies can use list functions on any field.
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
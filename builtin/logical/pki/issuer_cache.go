@@ -0,0 +1,183 @@
+package pki
+
+import (
+	"sync"
+
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+)
+
+// Every issuance resolves its issuer reference (often more than once: for
+// the role's allowed_issuers, for signing, and for the metadata and events
+// of the new certificate), and fetches, decodes and parses the issuer and
+// its key. To keep these storage reads and parses off the hot path, the
+// results are cached in memory:
+//
+//   - the references issuers can be resolved by: the default issuer, their
+//     identifiers and their names, and
+//   - the parsed certificate bundle (with its private key) of each issuer
+//     used for signing, along with its entry.
+//
+// The cache is per-node and never persisted. Any change to issuers, keys or
+// the issuer configuration flushes it entirely: local writes do so through
+// the storageContext helpers writing them, and changes made by other nodes
+// through invalidate. Each flush moves the cache to a new generation;
+// values loaded from storage concurrently with a flush may predate the
+// change, and are discarded rather than cached.
+//
+// Cached entries and bundles are shared between requests and must not be
+// modified; code updating issuers or keys fetches its own copies from
+// storage.
+
+// issuerReferences is a snapshot of the references issuers are resolvable
+// by.
+type issuerReferences struct {
+	defaultId issuerID
+	ids       map[issuerID]struct{}
+	names     map[string]issuerID
+}
+
+// signingIssuer is an issuer entry along with its parsed bundle.
+type signingIssuer struct {
+	entry  *issuerEntry
+	bundle *certutil.ParsedCertBundle
+}
+
+type issuerCache struct {
+	lock       sync.RWMutex
+	references *issuerReferences
+	signers    map[issuerID]*signingIssuer
+	generation uint64
+}
+
+func newIssuerCache() *issuerCache {
+	return &issuerCache{
+		signers: make(map[issuerID]*signingIssuer),
+	}
+}
+
+// currentGeneration returns a token to pass to the put methods, identifying
+// the state of the cache before values were loaded from storage.
+func (c *issuerCache) currentGeneration() uint64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.generation
+}
+
+func (c *issuerCache) getReferences() *issuerReferences {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.references
+}
+
+func (c *issuerCache) putReferences(references *issuerReferences, generation uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if generation == c.generation {
+		c.references = references
+	}
+}
+
+func (c *issuerCache) getSigner(id issuerID) *signingIssuer {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.signers[id]
+}
+
+func (c *issuerCache) putSigner(id issuerID, signer *signingIssuer, generation uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if generation == c.generation {
+		c.signers[id] = signer
+	}
+}
+
+// flush empties the cache, following a change to issuers, keys or the
+// issuer configuration.
+func (c *issuerCache) flush() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.references = nil
+	c.signers = make(map[issuerID]*signingIssuer)
+	c.generation++
+}
+
+// fetchIssuerReferences returns the references issuers can currently be
+// resolved by.
+func (sc *storageContext) fetchIssuerReferences() (*issuerReferences, error) {
+	cache := sc.Backend.issuerCache
+	if references := cache.getReferences(); references != nil {
+		return references, nil
+	}
+
+	generation := cache.currentGeneration()
+
+	config, err := sc.getIssuersConfig()
+	if err != nil {
+		return nil, err
+	}
+	issuers, err := sc.listIssuers()
+	if err != nil {
+		return nil, err
+	}
+
+	references := &issuerReferences{
+		defaultId: config.DefaultIssuerId,
+		ids:       make(map[issuerID]struct{}, len(issuers)),
+		names:     make(map[string]issuerID, len(issuers)),
+	}
+	for _, id := range issuers {
+		issuer, err := sc.fetchIssuerById(id)
+		if err != nil {
+			return nil, err
+		}
+
+		references.ids[issuer.ID] = struct{}{}
+		if issuer.Name != "" {
+			references.names[issuer.Name] = issuer.ID
+		}
+	}
+
+	cache.putReferences(references, generation)
+	return references, nil
+}
+
+// fetchSigningIssuer returns the entry of the given issuer, along with its
+// parsed bundle, including its private key when it has one. Like
+// fetchCertBundleByIssuerId, it supports the legacyBundleShimID. Both
+// results are shared, and must not be modified.
+func (sc *storageContext) fetchSigningIssuer(id issuerID) (*issuerEntry, *certutil.ParsedCertBundle, error) {
+	cache := sc.Backend.issuerCache
+	if signer := cache.getSigner(id); signer != nil {
+		return signer.entry, signer.bundle, nil
+	}
+
+	generation := cache.currentGeneration()
+
+	entry, bundle, err := sc.fetchCertBundleByIssuerId(id, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parsedBundle, err := parseCABundle(sc.Context, sc.Backend, bundle)
+	if err != nil {
+		return nil, nil, errutil.InternalError{Err: err.Error()}
+	}
+
+	// The legacy bundle isn't written through the helpers flushing the
+	// cache. Cloud KMS signers are kept for the life of the mount, but
+	// other managed keys' signers aren't meant to outlive the request.
+	cacheable := id != legacyBundleShimID
+	if bundle.PrivateKeyType == certutil.ManagedPrivateKey {
+		_, isCloudKMSKey := parseCloudKMSKeyRef([]byte(bundle.PrivateKey))
+		cacheable = cacheable && isCloudKMSKey
+	}
+	if cacheable {
+		cache.putSigner(id, &signingIssuer{entry: entry, bundle: parsedBundle}, generation)
+	}
+
+	return entry, parsedBundle, nil
+}
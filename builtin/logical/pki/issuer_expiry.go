@@ -0,0 +1,98 @@
+package pki
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+)
+
+// emitIssuerExpiryMetrics publishes, for every issuer in the mount, the
+// number of days until its certificate expires. This lets operators alert
+// on upcoming CA rollovers rather than discovering them via an outage.
+func emitIssuerExpiryMetrics(sc *storageContext) error {
+	if sc.Backend.useLegacyBundleCaStorage() {
+		return nil
+	}
+
+	issuers, err := sc.listIssuers()
+	if err != nil {
+		return fmt.Errorf("unable to list issuers for expiry metrics: %w", err)
+	}
+
+	now := time.Now()
+	for _, id := range issuers {
+		issuer, err := sc.fetchIssuerById(id)
+		if err != nil {
+			return fmt.Errorf("unable to fetch issuer %v for expiry metrics: %w", id, err)
+		}
+
+		cert, err := issuer.GetCertificate()
+		if err != nil {
+			return fmt.Errorf("unable to parse issuer %v for expiry metrics: %w", id, err)
+		}
+
+		days := cert.NotAfter.Sub(now).Hours() / 24
+		metrics.SetGaugeWithLabels([]string{"secrets", "pki", "issuer", "days_until_expiry"}, float32(days), []metrics.Label{
+			{Name: "issuer_id", Value: string(issuer.ID)},
+			{Name: "issuer_name", Value: issuer.Name},
+		})
+	}
+
+	return nil
+}
+
+// issuerExpiryWarning returns a warning to attach to an issuance response
+// when the signing issuer is within its expiry_warning_threshold of
+// expiring, or the empty string otherwise.
+func issuerExpiryWarning(sc *storageContext, issuerRef string, issuerCert *x509.Certificate) string {
+	if sc.Backend.useLegacyBundleCaStorage() || issuerCert == nil {
+		return ""
+	}
+
+	id, err := sc.resolveIssuerReference(issuerRef)
+	if err != nil {
+		return ""
+	}
+
+	// The issuer was just used for signing, so this is usually cached.
+	issuer, _, err := sc.fetchSigningIssuer(id)
+	if err != nil || issuer.ExpiryWarningThreshold <= 0 {
+		return ""
+	}
+
+	remaining := time.Until(issuerCert.NotAfter)
+	if remaining >= issuer.ExpiryWarningThreshold {
+		return ""
+	}
+
+	return fmt.Sprintf("The issuer (%v) which signed this certificate expires at %v, within its expiry_warning_threshold of %v; a replacement issuer should be put in place before then.", id, issuerCert.NotAfter.UTC().Format(time.RFC3339), issuer.ExpiryWarningThreshold)
+}
+
+// parseLeafNotAfterBehavior parses the leaf_not_after_behavior of an issuer
+// or the mount.
+func parseLeafNotAfterBehavior(raw string) (certutil.NotAfterBehavior, error) {
+	switch raw {
+	case "err":
+		return certutil.ErrNotAfterBehavior, nil
+	case "truncate":
+		return certutil.TruncateNotAfterBehavior, nil
+	case "permit":
+		return certutil.PermitNotAfterBehavior, nil
+	default:
+		return certutil.ErrNotAfterBehavior, fmt.Errorf("Unknown value for field `leaf_not_after_behavior`. Possible values are `err`, `truncate`, and `permit`.")
+	}
+}
+
+// leafNotAfterWarning returns a warning to attach to an issuance response
+// when the certificate outlives its issuer, as the permit
+// leaf_not_after_behavior allows, or the empty string otherwise.
+func leafNotAfterWarning(notAfter time.Time, issuerCert *x509.Certificate) string {
+	if issuerCert == nil || !notAfter.After(issuerCert.NotAfter) {
+		return ""
+	}
+
+	return fmt.Sprintf("The certificate's notAfter of %v is beyond that of its issuer, %v, as leaf_not_after_behavior permits; it can't be validated once the issuer expires.", notAfter.UTC().Format(time.RFC3339), issuerCert.NotAfter.UTC().Format(time.RFC3339))
+}
@@ -0,0 +1,202 @@
+package pki
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+const (
+	healthSeverityWarning  = "warning"
+	healthSeverityCritical = "critical"
+
+	// Issuers without an expiry_warning_threshold are flagged this long
+	// before they expire.
+	defaultHealthExpiryWarning = 30 * 24 * time.Hour
+)
+
+// healthFinding is a single problem found by a health check. Only critical
+// findings make an issuer or mount unhealthy; warnings are for operators to
+// act on before they become critical.
+type healthFinding struct {
+	Check    string
+	Severity string
+	IssuerID issuerID
+	Message  string
+}
+
+func (f healthFinding) ToResponseData() map[string]interface{} {
+	data := map[string]interface{}{
+		"check":    f.Check,
+		"severity": f.Severity,
+		"message":  f.Message,
+	}
+	if f.IssuerID != "" {
+		data["issuer_id"] = f.IssuerID.String()
+	}
+	return data
+}
+
+func findingsResponseData(findings []healthFinding) []map[string]interface{} {
+	data := make([]map[string]interface{}, 0, len(findings))
+	for _, finding := range findings {
+		data = append(data, finding.ToResponseData())
+	}
+	return data
+}
+
+func findingsHealthy(findings []healthFinding) bool {
+	for _, finding := range findings {
+		if finding.Severity == healthSeverityCritical {
+			return false
+		}
+	}
+	return true
+}
+
+// issuerHealth is the outcome of checking a single issuer.
+type issuerHealth struct {
+	Issuer        *issuerEntry
+	NotAfter      time.Time
+	CRLNextUpdate time.Time
+	Findings      []healthFinding
+}
+
+func (h *issuerHealth) ToResponseData(now time.Time) map[string]interface{} {
+	data := map[string]interface{}{
+		"issuer_id":         h.Issuer.ID.String(),
+		"issuer_name":       h.Issuer.Name,
+		"not_after":         h.NotAfter.UTC().Format(time.RFC3339),
+		"days_until_expiry": int64(h.NotAfter.Sub(now).Hours() / 24),
+		"crl_next_update":   "",
+		"healthy":           findingsHealthy(h.Findings),
+		"findings":          findingsResponseData(h.Findings),
+	}
+	if !h.CRLNextUpdate.IsZero() {
+		data["crl_next_update"] = h.CRLNextUpdate.UTC().Format(time.RFC3339)
+	}
+	return data
+}
+
+// healthCheckState is the mount-wide state the per-issuer checks need,
+// fetched once per health check.
+type healthCheckState struct {
+	crlConfig   *crlConfig
+	localConfig *localCRLConfigEntry
+	now         time.Time
+}
+
+func (sc *storageContext) loadHealthCheckState() (*healthCheckState, error) {
+	crlConfig, err := sc.Backend.crlBuilder.getConfigWithUpdate(sc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch revocation configuration: %w", err)
+	}
+
+	localConfig, err := sc.getLocalCRLConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch cluster-local CRL configuration: %w", err)
+	}
+
+	return &healthCheckState{
+		crlConfig:   crlConfig,
+		localConfig: localConfig,
+		now:         time.Now(),
+	}, nil
+}
+
+// checkIssuerHealth validates that the issuer's chain builds, that it isn't
+// (about to be) expired, that its CRL is fresh, and that its certificate's
+// key usages permit the usages configured on it.
+func checkIssuerHealth(issuer *issuerEntry, state *healthCheckState) (*issuerHealth, error) {
+	cert, err := issuer.GetCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	health := &issuerHealth{
+		Issuer:   issuer,
+		NotAfter: cert.NotAfter,
+	}
+	addFinding := func(check string, severity string, format string, args ...interface{}) {
+		health.Findings = append(health.Findings, healthFinding{
+			Check:    check,
+			Severity: severity,
+			IssuerID: issuer.ID,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	// The chain must verify link by link, and should end at a root.
+	var chain []*x509.Certificate
+	for _, pemCert := range issuer.CAChain {
+		chainCert, err := parseCertificateFromBytes([]byte(pemCert))
+		if err != nil {
+			addFinding("chain", healthSeverityCritical, "unable to parse the issuer's CA chain: %v", err)
+			chain = nil
+			break
+		}
+		chain = append(chain, chainCert)
+	}
+	switch {
+	case len(issuer.CAChain) == 0:
+		addFinding("chain", healthSeverityCritical, "the issuer has no CA chain")
+	case len(chain) == 0:
+		// Parsing failed, which has been reported above.
+	default:
+		valid := true
+		for i := 0; i+1 < len(chain); i++ {
+			if err := chain[i].CheckSignatureFrom(chain[i+1]); err != nil {
+				addFinding("chain", healthSeverityCritical, "%v in the issuer's CA chain isn't signed by the next certificate, %v: %v", chain[i].Subject, chain[i+1].Subject, err)
+				valid = false
+				break
+			}
+		}
+		last := chain[len(chain)-1]
+		if valid && last.CheckSignatureFrom(last) != nil {
+			addFinding("chain", healthSeverityWarning, "the issuer's CA chain ends at %v, which isn't self-signed; its issuer isn't in this mount", last.Subject)
+		}
+	}
+
+	remaining := cert.NotAfter.Sub(state.now)
+	threshold := issuer.ExpiryWarningThreshold
+	if threshold <= 0 {
+		threshold = defaultHealthExpiryWarning
+	}
+	switch {
+	case remaining <= 0:
+		addFinding("expiry", healthSeverityCritical, "the issuer expired at %v", cert.NotAfter.UTC().Format(time.RFC3339))
+	case remaining < threshold:
+		addFinding("expiry", healthSeverityWarning, "the issuer expires at %v, within %v", cert.NotAfter.UTC().Format(time.RFC3339), threshold)
+	}
+
+	// A key usage extension, when present, must allow what the issuer is
+	// configured to do. Only issuers whose key is in this mount act on their
+	// usages.
+	hasKey := issuer.KeyID != ""
+	if hasKey && issuer.Usage.HasUsage(IssuanceUsage) {
+		if !cert.IsCA {
+			addFinding("key_usage", healthSeverityCritical, "the issuer is configured for issuing-certificates, but its certificate isn't a CA")
+		} else if cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+			addFinding("key_usage", healthSeverityCritical, "the issuer is configured for issuing-certificates, but its certificate's key usage lacks CertSign")
+		}
+	}
+	if hasKey && issuer.Usage.HasUsage(CRLSigningUsage) && cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageCRLSign == 0 {
+		addFinding("key_usage", healthSeverityWarning, "the issuer is configured for crl-signing, but its certificate's key usage lacks CRLSign")
+	}
+
+	if hasKey && !state.crlConfig.Disable && issuer.Usage.HasUsage(CRLSigningUsage) {
+		id, ok := state.localConfig.IssuerIDCRLMap[issuer.ID]
+		expiration, haveExpiration := state.localConfig.CRLExpirationMap[id]
+		switch {
+		case !ok || !haveExpiration:
+			addFinding("crl", healthSeverityWarning, "no CRL has been built for the issuer")
+		case !expiration.After(state.now):
+			health.CRLNextUpdate = expiration
+			addFinding("crl", healthSeverityCritical, "the issuer's CRL expired at %v", expiration.UTC().Format(time.RFC3339))
+		default:
+			health.CRLNextUpdate = expiration
+		}
+	}
+
+	return health, nil
+}
@@ -3,12 +3,23 @@ package pki
 import (
 	"context"
 	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"hash"
 
 	"github.com/hashicorp/vault/sdk/helper/certutil"
 	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"golang.org/x/crypto/pbkdf2"
 )
 
 func comparePublicKey(sc *storageContext, key *keyEntry, publicKey crypto.PublicKey) (bool, error) {
@@ -22,11 +33,11 @@ func comparePublicKey(sc *storageContext, key *keyEntry, publicKey crypto.Public
 
 func getPublicKey(ctx context.Context, b *backend, key *keyEntry) (crypto.PublicKey, error) {
 	if key.PrivateKeyType == certutil.ManagedPrivateKey {
-		keyId, err := extractManagedKeyId([]byte(key.PrivateKey))
+		keyId, err := extractAnyManagedKeyId([]byte(key.PrivateKey))
 		if err != nil {
 			return nil, err
 		}
-		return getManagedKeyPublicKey(ctx, b, keyId)
+		return getAnyManagedKeyPublicKey(ctx, b, keyId)
 	}
 
 	signer, _, _, err := getSignerFromKeyEntryBytes(key)
@@ -91,3 +102,149 @@ func importKeyFromBytes(sc *storageContext, keyValue string, keyName string) (*k
 	}
 	return key, existed, nil
 }
+
+// Encrypted PKCS#8 keys (RFC 5958) are only supported with PBES2 and PBKDF2
+// (RFC 8018), which is what OpenSSL and most other tooling produce.
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+	pbkdf2PRFs = map[string]func() hash.Hash{
+		"1.2.840.113549.2.7":  sha1.New,
+		"1.2.840.113549.2.8":  sha256.New224,
+		"1.2.840.113549.2.9":  sha256.New,
+		"1.2.840.113549.2.10": sha512.New384,
+		"1.2.840.113549.2.11": sha512.New,
+	}
+
+	pbes2Ciphers = map[string]struct {
+		keyLen    int
+		newCipher func(key []byte) (cipher.Block, error)
+	}{
+		"2.16.840.1.101.3.4.1.2":  {16, aes.NewCipher},
+		"2.16.840.1.101.3.4.1.22": {24, aes.NewCipher},
+		"2.16.840.1.101.3.4.1.42": {32, aes.NewCipher},
+		"1.2.840.113549.3.7":      {24, des.NewTripleDESCipher},
+	}
+)
+
+// maxPBKDF2Iterations bounds the work a single import can request.
+const maxPBKDF2Iterations = 10_000_000
+
+var errIncorrectPassphrase = errutil.UserError{Err: "unable to decrypt private key: incorrect passphrase"}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPEMKey decrypts an ENCRYPTED PRIVATE KEY PEM block with the
+// passphrase, returning it as an unencrypted PRIVATE KEY PEM block. Other
+// PEM blocks are returned unmodified.
+func decryptPEMKey(keyPem string, passphrase string) (string, error) {
+	pemBlock, _ := pem.Decode([]byte(keyPem))
+	if pemBlock == nil || pemBlock.Type != "ENCRYPTED PRIVATE KEY" {
+		return keyPem, nil
+	}
+	if len(passphrase) == 0 {
+		return "", errutil.UserError{Err: "private key is encrypted but no passphrase was provided"}
+	}
+
+	der, err := decryptPKCS8PrivateKey(pemBlock.Bytes, []byte(passphrase))
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// decryptPKCS8PrivateKey decrypts a DER-encoded EncryptedPrivateKeyInfo,
+// returning the DER-encoded PKCS#8 PrivateKeyInfo within it.
+func decryptPKCS8PrivateKey(der []byte, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) > 0 {
+		return nil, errutil.UserError{Err: "malformed encrypted PKCS#8 private key"}
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, errutil.UserError{Err: fmt.Sprintf("unsupported private key encryption scheme %v; only PBES2 is supported", info.Algorithm.Algorithm)}
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, errutil.UserError{Err: "malformed PBES2 parameters in encrypted private key"}
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, errutil.UserError{Err: fmt.Sprintf("unsupported key derivation function %v; only PBKDF2 is supported", params.KeyDerivationFunc.Algorithm)}
+	}
+
+	var kdfParams pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, errutil.UserError{Err: "malformed PBKDF2 parameters in encrypted private key"}
+	}
+	if kdfParams.IterationCount < 1 || kdfParams.IterationCount > maxPBKDF2Iterations {
+		return nil, errutil.UserError{Err: fmt.Sprintf("unsupported PBKDF2 iteration count %d; must be between 1 and %d", kdfParams.IterationCount, maxPBKDF2Iterations)}
+	}
+
+	prf := sha1.New
+	if len(kdfParams.PRF.Algorithm) > 0 {
+		var ok bool
+		prf, ok = pbkdf2PRFs[kdfParams.PRF.Algorithm.String()]
+		if !ok {
+			return nil, errutil.UserError{Err: fmt.Sprintf("unsupported PBKDF2 pseudo-random function %v", kdfParams.PRF.Algorithm)}
+		}
+	}
+
+	scheme, ok := pbes2Ciphers[params.EncryptionScheme.Algorithm.String()]
+	if !ok {
+		return nil, errutil.UserError{Err: fmt.Sprintf("unsupported private key cipher %v; only AES-CBC and DES-EDE3-CBC are supported", params.EncryptionScheme.Algorithm)}
+	}
+	if kdfParams.KeyLength != 0 && kdfParams.KeyLength != scheme.keyLen {
+		return nil, errutil.UserError{Err: "PBKDF2 key length does not match the private key cipher"}
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, errutil.UserError{Err: "malformed cipher parameters in encrypted private key"}
+	}
+
+	block, err := scheme.newCipher(pbkdf2.Key(passphrase, kdfParams.Salt, kdfParams.IterationCount, scheme.keyLen, prf))
+	if err != nil {
+		return nil, err
+	}
+	blockSize := block.BlockSize()
+	if len(iv) != blockSize || len(info.EncryptedData) == 0 || len(info.EncryptedData)%blockSize != 0 {
+		return nil, errutil.UserError{Err: "malformed encrypted PKCS#8 private key"}
+	}
+
+	plaintext := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, info.EncryptedData)
+
+	// Invalid padding, or an unparsable key, almost always means the
+	// passphrase was wrong.
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > blockSize {
+		return nil, errIncorrectPassphrase
+	}
+	for _, b := range plaintext[len(plaintext)-padding:] {
+		if int(b) != padding {
+			return nil, errIncorrectPassphrase
+		}
+	}
+	plaintext = plaintext[:len(plaintext)-padding]
+
+	if _, err := x509.ParsePKCS8PrivateKey(plaintext); err != nil {
+		return nil, errIncorrectPassphrase
+	}
+	return plaintext, nil
+}
@@ -25,7 +25,7 @@ func getManagedKeyPublicKey(ctx context.Context, b *backend, keyId managedKeyId)
 	return nil, errEntOnly
 }
 
-func parseManagedKeyCABundle(ctx context.Context, b *backend, bundle *certutil.CertBundle) (*certutil.ParsedCertBundle, error) {
+func getManagedKeySigner(ctx context.Context, b *backend, keyId managedKeyId) (crypto.Signer, error) {
 	return nil, errEntOnly
 }
 
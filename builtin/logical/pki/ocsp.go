@@ -28,14 +28,34 @@ const (
 	ocspReqParam            = "req"
 	ocspResponseContentType = "application/ocsp-response"
 	maximumRequestSize      = 2048 // A normal simple request is 87 bytes, so give us some buffer
+
+	// RFC 8954 requires responders to accept nonces of up to 32 bytes, and
+	// allows them to ignore nonces shorter than 16 bytes.
+	minimumOcspNonceMaxLength = 16
 )
 
+// oidOcspNonce identifies the OCSP nonce extension (RFC 8954).
+var oidOcspNonce = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
+
+// ocspRequestExtensions allows parsing the extensions of an OCSP request,
+// which ocsp.ParseRequest discards (RFC 6960 Section 4.1.1).
+type ocspRequestExtensions struct {
+	TBSRequest struct {
+		Version           int           `asn1:"explicit,tag:0,default:0,optional"`
+		RequestorName     asn1.RawValue `asn1:"explicit,tag:1,optional"`
+		RequestList       []asn1.RawValue
+		RequestExtensions []pkix.Extension `asn1:"explicit,tag:2,optional"`
+	}
+}
+
 type ocspRespInfo struct {
 	formattedSerialNumber string
 	serialNumber          *big.Int
 	ocspStatus            int
 	revocationTimeUTC     *time.Time
+	revocationReason      int
 	issuerID              issuerID
+	nonce                 *pkix.Extension
 }
 
 // These response variables should not be mutated, instead treat them as constants
@@ -118,18 +138,32 @@ func (b *backend) ocspHandler(ctx context.Context, request *logical.Request, dat
 		return OcspMalformedResponse, nil
 	}
 
-	ocspStatus, err := getOcspStatus(sc, request, ocspReq)
-	if err != nil {
-		return logAndReturnInternalError(b, err), nil
+	var nonce *pkix.Extension
+	if cfg.OcspNonce {
+		nonce, err = fetchOcspNonce(derReq, cfg.OcspNonceMaxLength)
+		if err != nil {
+			return OcspMalformedResponse, nil
+		}
 	}
 
-	caBundle, err := lookupOcspIssuer(sc, ocspReq, ocspStatus.issuerID)
+	// Responses echoing a nonce are unique to their request.
+	cacheEnabled, expiry := ocspCacheEnabled(cfg)
+	cacheEnabled = cacheEnabled && nonce == nil
+	if cacheEnabled {
+		if cached := b.ocspCache.get(ocspReq, time.Now()); cached != nil {
+			return ocspRawResponse(cached), nil
+		}
+	}
+
+	generation := b.ocspCache.currentGeneration()
+	signedAt := time.Now()
+	byteResp, err := buildOcspResponse(sc, cfg, request, ocspReq, nonce)
 	if err != nil {
 		if errors.Is(err, ErrUnknownIssuer) {
 			// Since we were not able to find a matching issuer for the incoming request
 			// generate an Unknown OCSP response. This might turn into an Unauthorized if
 			// we find out that we don't have a default issuer or it's missing the proper Usage flags
-			return generateUnknownResponse(cfg, sc, ocspReq), nil
+			return generateUnknownResponse(cfg, sc, ocspReq, nonce), nil
 		}
 		if errors.Is(err, ErrMissingOcspUsage) {
 			// If we did find a matching issuer but aren't allowed to sign, the spec says
@@ -141,21 +175,72 @@ func (b *backend) ocspHandler(ctx context.Context, request *logical.Request, dat
 		return logAndReturnInternalError(b, err), nil
 	}
 
-	byteResp, err := genResponse(cfg, caBundle, ocspStatus, ocspReq.HashAlgorithm)
+	if cacheEnabled {
+		// Only cache responses for certificates this mount issued, so that
+		// queries for arbitrary serial numbers can't fill the cache and
+		// have their responses re-signed by the periodic function.
+		cache := b.ocspCache.tracks(ocspReq)
+		if !cache {
+			cache, err = isOcspSerialIssued(sc, request, ocspReq.SerialNumber)
+			if err != nil {
+				b.Logger().Debug("unable to look up certificate for OCSP response caching", "serial", serialFromBigInt(ocspReq.SerialNumber), "error", err)
+			}
+		}
+		if cache {
+			b.ocspCache.put(ocspReq, byteResp, ocspRefreshTime(signedAt, expiry), generation, signedAt)
+		}
+	}
+
+	return ocspRawResponse(byteResp), nil
+}
+
+// isOcspSerialIssued reports whether the certificate with the given serial
+// was issued by this mount, as far as storage tells: either it was stored,
+// or it was revoked.
+func isOcspSerialIssued(sc *storageContext, request *logical.Request, serial *big.Int) (bool, error) {
+	for _, prefix := range []string{"certs/", revokedPath} {
+		entry, err := fetchCertBySerialBigInt(sc.Context, sc.Backend, request, prefix, serial)
+		if err != nil {
+			return false, err
+		}
+		if entry != nil {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// buildOcspResponse determines the status of the requested certificate and
+// signs a response for it with the matching issuer, echoing the request's
+// nonce extension if given. ErrUnknownIssuer and ErrMissingOcspUsage are
+// returned when no issuer may answer for it.
+func buildOcspResponse(sc *storageContext, cfg *crlConfig, request *logical.Request, ocspReq *ocsp.Request, nonce *pkix.Extension) ([]byte, error) {
+	ocspStatus, err := getOcspStatus(sc, request, ocspReq, cfg.OcspUnified)
 	if err != nil {
-		return logAndReturnInternalError(b, err), nil
+		return nil, err
 	}
+	ocspStatus.nonce = nonce
 
+	caBundle, err := lookupOcspIssuer(sc, ocspReq, ocspStatus.issuerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return genResponse(cfg, caBundle, ocspStatus, ocspReq.HashAlgorithm)
+}
+
+func ocspRawResponse(byteResp []byte) *logical.Response {
 	return &logical.Response{
 		Data: map[string]interface{}{
 			logical.HTTPContentType: ocspResponseContentType,
 			logical.HTTPStatusCode:  http.StatusOK,
 			logical.HTTPRawBody:     byteResp,
 		},
-	}, nil
+	}
 }
 
-func generateUnknownResponse(cfg *crlConfig, sc *storageContext, ocspReq *ocsp.Request) *logical.Response {
+func generateUnknownResponse(cfg *crlConfig, sc *storageContext, ocspReq *ocsp.Request, nonce *pkix.Extension) *logical.Response {
 	// Generate an Unknown OCSP response, signing with the default issuer from the mount as we did
 	// not match the request's issuer. If no default issuer can be used, return with Unauthorized as there
 	// isn't much else we can do at this point.
@@ -187,6 +272,7 @@ func generateUnknownResponse(cfg *crlConfig, sc *storageContext, ocspReq *ocsp.R
 	info := &ocspRespInfo{
 		serialNumber: ocspReq.SerialNumber,
 		ocspStatus:   ocsp.Unknown,
+		nonce:        nonce,
 	}
 
 	byteResp, err := genResponse(cfg, caBundle, info, ocspReq.HashAlgorithm)
@@ -194,13 +280,7 @@ func generateUnknownResponse(cfg *crlConfig, sc *storageContext, ocspReq *ocsp.R
 		return logAndReturnInternalError(sc.Backend, err)
 	}
 
-	return &logical.Response{
-		Data: map[string]interface{}{
-			logical.HTTPContentType: ocspResponseContentType,
-			logical.HTTPStatusCode:  http.StatusOK,
-			logical.HTTPRawBody:     byteResp,
-		},
-	}
+	return ocspRawResponse(byteResp)
 }
 
 func fetchDerEncodedRequest(request *logical.Request, data *framework.FieldData) ([]byte, error) {
@@ -236,6 +316,39 @@ func fetchDerEncodedRequest(request *logical.Request, data *framework.FieldData)
 	}
 }
 
+// fetchOcspNonce returns the nonce extension (RFC 8954) of the DER encoded
+// request, if any, to be echoed in the response. Nonces must be between 1
+// and maxLength bytes long.
+func fetchOcspNonce(derReq []byte, maxLength int) (*pkix.Extension, error) {
+	var req ocspRequestExtensions
+	if _, err := asn1.Unmarshal(derReq, &req); err != nil {
+		return nil, err
+	}
+
+	for _, ext := range req.TBSRequest.RequestExtensions {
+		if !ext.Id.Equal(oidOcspNonce) {
+			continue
+		}
+
+		var nonce []byte
+		if rest, err := asn1.Unmarshal(ext.Value, &nonce); err != nil {
+			return nil, fmt.Errorf("unable to parse nonce: %w", err)
+		} else if len(rest) > 0 {
+			return nil, errors.New("trailing data after nonce")
+		}
+		if len(nonce) == 0 || len(nonce) > maxLength {
+			return nil, fmt.Errorf("nonce length %d outside of the allowed range of 1 to %d bytes", len(nonce), maxLength)
+		}
+
+		return &pkix.Extension{
+			Id:    oidOcspNonce,
+			Value: ext.Value,
+		}, nil
+	}
+
+	return nil, nil
+}
+
 func logAndReturnInternalError(b *backend, err error) *logical.Response {
 	// Since OCSP might be a high traffic endpoint, we will log at debug level only
 	// any internal errors we do get. There is no way for us to return to the end-user
@@ -245,7 +358,7 @@ func logAndReturnInternalError(b *backend, err error) *logical.Response {
 	return OcspInternalErrorResponse
 }
 
-func getOcspStatus(sc *storageContext, request *logical.Request, ocspReq *ocsp.Request) (*ocspRespInfo, error) {
+func getOcspStatus(sc *storageContext, request *logical.Request, ocspReq *ocsp.Request, unified bool) (*ocspRespInfo, error) {
 	revEntryRaw, err := fetchCertBySerialBigInt(sc.Context, sc.Backend, request, revokedPath, ocspReq.SerialNumber)
 	if err != nil {
 		return nil, err
@@ -262,14 +375,66 @@ func getOcspStatus(sc *storageContext, request *logical.Request, ocspReq *ocsp.R
 			return nil, err
 		}
 
+		if err := associateOcspRevocationWithIssuer(sc, &revEntry); err != nil {
+			return nil, err
+		}
+
 		info.ocspStatus = ocsp.Revoked
 		info.revocationTimeUTC = &revEntry.RevocationTimeUTC
-		info.issuerID = revEntry.CertificateIssuer // This might be empty if the CRL hasn't been rebuilt
+		info.revocationReason = revEntry.Reason
+		info.issuerID = revEntry.CertificateIssuer
+	} else if unified {
+		// Not revoked on this cluster, but it may have been on another.
+		unifiedEntry, err := fetchUnifiedRevocationEntry(sc, serialFromBigInt(ocspReq.SerialNumber))
+		if err != nil {
+			return nil, err
+		}
+		if unifiedEntry != nil {
+			info.ocspStatus = ocsp.Revoked
+			info.revocationTimeUTC = &unifiedEntry.RevocationTimeUTC
+			info.revocationReason = unifiedEntry.Reason
+			info.issuerID = unifiedEntry.CertificateIssuer
+		}
 	}
 
 	return &info, nil
 }
 
+// associateOcspRevocationWithIssuer ensures a revocation entry references
+// the issuer which signed the revoked certificate, using the same logic as
+// the CRL builder (see getRevokedCertEntries). The entry's issuer may be
+// missing, if no CRL has been built since the revocation, or stale, if that
+// issuer was deleted and another issuer with the same key and subject
+// remains. When the certificate parses but no issuer in this mount signed
+// it, the entry is left without an issuer and lookupOcspIssuer falls back to
+// matching the request's issuer hashes.
+//
+// The association isn't written back: OCSP requests don't hold the
+// revocation lock, and the next CRL build persists it instead.
+func associateOcspRevocationWithIssuer(sc *storageContext, revInfo *revocationInfo) error {
+	if len(revInfo.CertificateIssuer) > 0 {
+		if _, err := sc.fetchIssuerById(revInfo.CertificateIssuer); err == nil {
+			return nil
+		}
+	}
+
+	revokedCert, err := x509.ParseCertificate(revInfo.CertificateBytes)
+	if err != nil {
+		// Without the certificate, we can't associate it with any issuer;
+		// leave the entry as-is.
+		return nil
+	}
+
+	issuerIDCertMap, err := fetchIssuerMapForRevocationChecking(sc)
+	if err != nil {
+		return err
+	}
+
+	revInfo.CertificateIssuer = ""
+	associateRevokedCertWithIsssuer(revInfo, revokedCert, issuerIDCertMap)
+	return nil
+}
+
 func lookupOcspIssuer(sc *storageContext, req *ocsp.Request, optRevokedIssuer issuerID) (*certutil.ParsedCertBundle, error) {
 	reqHash := req.HashAlgorithm
 	if !reqHash.Available() {
@@ -365,23 +530,34 @@ func lookupIssuerIds(sc *storageContext, optRevokedIssuer issuerID) ([]issuerID,
 }
 
 func doesRequestMatchIssuer(parsedBundle *certutil.ParsedCertBundle, req *ocsp.Request) (bool, error) {
+	issuerNameHash, issuerKeyHash, err := ocspIssuerHashes(parsedBundle.Certificate, req.HashAlgorithm)
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(req.IssuerKeyHash, issuerKeyHash) && bytes.Equal(req.IssuerNameHash, issuerNameHash), nil
+}
+
+// ocspIssuerHashes returns the hashes of the issuer's name and public key
+// identifying it in OCSP requests.
+func ocspIssuerHashes(issuer *x509.Certificate, hash crypto.Hash) ([]byte, []byte, error) {
 	var pkInfo struct {
 		Algorithm pkix.AlgorithmIdentifier
 		PublicKey asn1.BitString
 	}
-	if _, err := asn1.Unmarshal(parsedBundle.Certificate.RawSubjectPublicKeyInfo, &pkInfo); err != nil {
-		return false, err
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &pkInfo); err != nil {
+		return nil, nil, err
 	}
 
-	h := req.HashAlgorithm.New()
+	h := hash.New()
 	h.Write(pkInfo.PublicKey.RightAlign())
 	issuerKeyHash := h.Sum(nil)
 
 	h.Reset()
-	h.Write(parsedBundle.Certificate.RawSubject)
+	h.Write(issuer.RawSubject)
 	issuerNameHash := h.Sum(nil)
 
-	return bytes.Equal(req.IssuerKeyHash, issuerKeyHash) && bytes.Equal(req.IssuerNameHash, issuerNameHash), nil
+	return issuerNameHash, issuerKeyHash, nil
 }
 
 func genResponse(cfg *crlConfig, caBundle *certutil.ParsedCertBundle, info *ocspRespInfo, reqHash crypto.Hash) ([]byte, error) {
@@ -402,7 +578,11 @@ func genResponse(cfg *crlConfig, caBundle *certutil.ParsedCertBundle, info *ocsp
 
 	if info.ocspStatus == ocsp.Revoked {
 		template.RevokedAt = *info.revocationTimeUTC
-		template.RevocationReason = ocsp.Unspecified
+		template.RevocationReason = info.revocationReason
+	}
+
+	if info.nonce != nil {
+		template.ExtraExtensions = append(template.ExtraExtensions, *info.nonce)
 	}
 
 	return ocsp.CreateResponse(caBundle.Certificate, caBundle.Certificate, template, caBundle.PrivateKey)
@@ -0,0 +1,341 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// With ocsp_presign, signed OCSP responses are cached in memory, so that
+// the (unauthenticated, potentially very high traffic) OCSP path serves
+// most queries without performing a signature. The cache holds responses
+// for recently issued and recently queried certificates of this mount; no
+// responses are cached for serial numbers it didn't issue. The periodic
+// function re-signs them in batch before they go stale, and drops those
+// which haven't been queried for ocspCacheIdleTimeout.
+//
+// The cache is per-node and never persisted. Revocations invalidate the
+// affected serial, while changes to the CRL configuration or to issuers
+// flush it entirely; responses signed concurrently with an invalidation
+// are discarded rather than cached.
+const (
+	// ocspCacheMaxEntries bounds the size of the cache; past it, responses
+	// are signed per query until entries are evicted.
+	ocspCacheMaxEntries = 100_000
+
+	// ocspCacheIdleTimeout is how long responses are kept (and refreshed)
+	// without being queried.
+	ocspCacheIdleTimeout = 24 * time.Hour
+)
+
+type ocspCacheEntry struct {
+	request       ocsp.Request
+	response      []byte
+	refreshAt     time.Time
+	lastRequested time.Time
+}
+
+type ocspResponseCache struct {
+	lock       sync.Mutex
+	entries    map[string]*ocspCacheEntry
+	bySerial   map[string]map[string]struct{}
+	generation uint64
+}
+
+func newOcspResponseCache() *ocspResponseCache {
+	return &ocspResponseCache{
+		entries:  make(map[string]*ocspCacheEntry),
+		bySerial: make(map[string]map[string]struct{}),
+	}
+}
+
+func ocspCacheSerial(serial *big.Int) string {
+	return normalizeSerial(serialFromBigInt(serial))
+}
+
+// ocspCacheKey identifies the response to a request; responses depend on
+// the requested issuer and the hash algorithm used to identify it.
+func ocspCacheKey(req *ocsp.Request) string {
+	return fmt.Sprintf("%d/%x/%x/%s", req.HashAlgorithm, req.IssuerNameHash, req.IssuerKeyHash, ocspCacheSerial(req.SerialNumber))
+}
+
+// newOcspCacheRequest returns the request a client would make for the
+// certificate with the given serial, signed by issuer.
+func newOcspCacheRequest(issuer *x509.Certificate, serial *big.Int, hash crypto.Hash) (*ocsp.Request, error) {
+	issuerNameHash, issuerKeyHash, err := ocspIssuerHashes(issuer, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ocsp.Request{
+		HashAlgorithm:  hash,
+		IssuerNameHash: issuerNameHash,
+		IssuerKeyHash:  issuerKeyHash,
+		SerialNumber:   serial,
+	}, nil
+}
+
+// currentGeneration returns a token to pass to put, identifying the state
+// of the cache before a response was signed.
+func (c *ocspResponseCache) currentGeneration() uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.generation
+}
+
+// get returns the cached response to the request, if any is still fresh,
+// and marks it as recently requested.
+func (c *ocspResponseCache) get(req *ocsp.Request, now time.Time) []byte {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.entries[ocspCacheKey(req)]
+	if !ok {
+		return nil
+	}
+
+	entry.lastRequested = now
+	if entry.response == nil || !now.Before(entry.refreshAt) {
+		return nil
+	}
+	return entry.response
+}
+
+// tracks reports whether the cache holds the request, whether or not a
+// response to it is presently cached.
+func (c *ocspResponseCache) tracks(req *ocsp.Request) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	_, ok := c.entries[ocspCacheKey(req)]
+	return ok
+}
+
+// put caches the response to the request, to be refreshed at refreshAt,
+// unless the cache was invalidated since generation or is full.
+func (c *ocspResponseCache) put(req *ocsp.Request, response []byte, refreshAt time.Time, generation uint64, now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	key := ocspCacheKey(req)
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = c.addLocked(key, req, now)
+		if entry == nil {
+			return
+		}
+	}
+
+	entry.response = response
+	entry.refreshAt = refreshAt
+}
+
+// track adds a certificate to the cache, to have a response pre-signed for
+// it on the next pass of the periodic function. Clients identify issuers by
+// SHA-1 hashes by default, so that's what is pre-signed for.
+func (c *ocspResponseCache) track(issuer *x509.Certificate, serial *big.Int, now time.Time) error {
+	req, err := newOcspCacheRequest(issuer, serial, crypto.SHA1)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	key := ocspCacheKey(req)
+	if _, ok := c.entries[key]; !ok {
+		c.addLocked(key, req, now)
+	}
+	return nil
+}
+
+func (c *ocspResponseCache) addLocked(key string, req *ocsp.Request, now time.Time) *ocspCacheEntry {
+	if len(c.entries) >= ocspCacheMaxEntries {
+		return nil
+	}
+
+	entry := &ocspCacheEntry{
+		request:       *req,
+		lastRequested: now,
+	}
+	c.entries[key] = entry
+
+	serial := ocspCacheSerial(req.SerialNumber)
+	if c.bySerial[serial] == nil {
+		c.bySerial[serial] = make(map[string]struct{})
+	}
+	c.bySerial[serial][key] = struct{}{}
+	return entry
+}
+
+func (c *ocspResponseCache) removeLocked(key string) {
+	entry, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	delete(c.entries, key)
+
+	serial := ocspCacheSerial(entry.request.SerialNumber)
+	delete(c.bySerial[serial], key)
+	if len(c.bySerial[serial]) == 0 {
+		delete(c.bySerial, serial)
+	}
+}
+
+// invalidateSerial drops any responses for the certificate with the given
+// (normalized) serial number, as its status may have changed.
+func (c *ocspResponseCache) invalidateSerial(serial string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.generation++
+	for key := range c.bySerial[normalizeSerial(serial)] {
+		// Keep tracking the certificate, so its response is re-signed on
+		// the next pass.
+		c.entries[key].response = nil
+	}
+}
+
+// flush drops all cached responses.
+func (c *ocspResponseCache) flush() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.generation++
+	c.entries = make(map[string]*ocspCacheEntry)
+	c.bySerial = make(map[string]map[string]struct{})
+}
+
+// size returns the number of tracked certificates and of cached responses.
+func (c *ocspResponseCache) size() (int, int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	signed := 0
+	for _, entry := range c.entries {
+		if entry.response != nil {
+			signed++
+		}
+	}
+	return len(c.entries), signed
+}
+
+// requestsToRefresh evicts idle entries and returns the requests whose
+// responses need to be (re-)signed.
+func (c *ocspResponseCache) requestsToRefresh(now time.Time) []ocsp.Request {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var requests []ocsp.Request
+	for key, entry := range c.entries {
+		if now.Sub(entry.lastRequested) > ocspCacheIdleTimeout {
+			c.removeLocked(key)
+			continue
+		}
+		if entry.response == nil || !now.Before(entry.refreshAt) {
+			requests = append(requests, entry.request)
+		}
+	}
+	return requests
+}
+
+// drop stops tracking the request, such as when no response can be signed
+// for it.
+func (c *ocspResponseCache) drop(req *ocsp.Request) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.removeLocked(ocspCacheKey(req))
+}
+
+// ocspCacheEnabled reports whether responses may be served from, and
+// stored in, the cache under the given configuration. Responses for
+// certificates revoked on other clusters (with ocsp_unified) can't be
+// invalidated locally, and responses without a validity period mustn't be
+// reused, so neither are cached.
+func ocspCacheEnabled(cfg *crlConfig) (bool, time.Duration) {
+	if !cfg.OcspPresign || cfg.OcspDisable || cfg.OcspUnified {
+		return false, 0
+	}
+
+	expiry, err := time.ParseDuration(cfg.OcspExpiry)
+	if err != nil || expiry <= 0 {
+		return false, 0
+	}
+	return true, expiry
+}
+
+// ocspRefreshTime returns when a response signed at signedAt should be
+// re-signed: halfway through its validity, so that clients caching it per
+// its nextUpdate never see a stale response.
+func ocspRefreshTime(signedAt time.Time, expiry time.Duration) time.Time {
+	return signedAt.Add(expiry / 2)
+}
+
+// trackIssuedCertForOcsp adds a newly issued certificate to the OCSP
+// response cache, if enabled.
+func (b *backend) trackIssuedCertForOcsp(sc *storageContext, issuer *x509.Certificate, serial *big.Int) {
+	cfg, err := b.crlBuilder.getConfigWithUpdate(sc)
+	if err != nil {
+		return
+	}
+	if enabled, _ := ocspCacheEnabled(cfg); !enabled {
+		return
+	}
+
+	if err := b.ocspCache.track(issuer, serial, time.Now()); err != nil {
+		b.Logger().Debug("unable to track issued certificate for OCSP pre-signing", "serial", serialFromBigInt(serial), "error", err)
+	}
+}
+
+// presignOcspResponses signs responses for all tracked certificates whose
+// cached response is missing or due for a refresh.
+func (b *backend) presignOcspResponses(sc *storageContext) error {
+	cfg, err := b.crlBuilder.getConfigWithUpdate(sc)
+	if err != nil {
+		return err
+	}
+
+	enabled, expiry := ocspCacheEnabled(cfg)
+	if !enabled {
+		b.ocspCache.flush()
+		return nil
+	}
+
+	now := time.Now()
+	requests := b.ocspCache.requestsToRefresh(now)
+	if len(requests) == 0 {
+		return nil
+	}
+
+	request := &logical.Request{Storage: sc.Storage}
+	for index := range requests {
+		ocspReq := &requests[index]
+
+		generation := b.ocspCache.currentGeneration()
+		signedAt := time.Now()
+		response, err := buildOcspResponse(sc, cfg, request, ocspReq, nil)
+		if err != nil {
+			// The issuer may have been removed or lost its OCSP signing
+			// usage; leave it to the OCSP path to answer for this one.
+			b.ocspCache.drop(ocspReq)
+			continue
+		}
+
+		b.ocspCache.put(ocspReq, response, ocspRefreshTime(signedAt, expiry), generation, now)
+	}
+
+	b.Logger().Debug("pre-signed OCSP responses", "count", len(requests))
+	return nil
+}
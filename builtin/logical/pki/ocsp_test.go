@@ -9,9 +9,12 @@ import (
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/base64"
 	"fmt"
 	"io"
+	"math/big"
 	"net/http"
 	"strconv"
 	"strings"
@@ -140,10 +143,10 @@ func TestOcsp_MalformedRequests(t *testing.T) {
 	}
 }
 
-// Validate that we properly handle a revocation entry that contains an issuer ID that no longer exists,
-// the best we can do in this use case is to respond back with the default issuer that we don't know
-// the issuer that they are requesting (we can't guarantee that the client is actually requesting a serial
-// from that issuer)
+// Validate that we properly handle a revocation entry that contains an issuer ID that no longer exists
+// and whose certificate can't be associated with any remaining issuer, the best we can do in this use
+// case is to respond back with the default issuer that we don't know the issuer that they are requesting
+// (we can't guarantee that the client is actually requesting a serial from that issuer)
 func TestOcsp_InvalidIssuerIdInRevocationEntry(t *testing.T) {
 	t.Parallel()
 
@@ -165,6 +168,7 @@ func TestOcsp_InvalidIssuerIdInRevocationEntry(t *testing.T) {
 	err = revEntry.DecodeJSON(&revInfo)
 	require.NoError(t, err, "failed decoding storage entry: %v", revEntry)
 	revInfo.CertificateIssuer = "00000000-0000-0000-0000-000000000000"
+	revInfo.CertificateBytes = []byte("not a certificate")
 	revEntry, err = logical.StorageEntryJSON(storagePath, revInfo)
 	require.NoError(t, err, "failed re-encoding revocation info: %v", revInfo)
 	err = s.Put(ctx, revEntry)
@@ -184,6 +188,48 @@ func TestOcsp_InvalidIssuerIdInRevocationEntry(t *testing.T) {
 	require.Equal(t, ocsp.Unknown, ocspResp.Status)
 }
 
+// Validate that a revocation entry with a missing or stale issuer ID is re-associated with the
+// issuer that signed the revoked certificate, as the CRL builder does, and that the response is
+// signed by that issuer.
+func TestOcsp_ReassociatesIssuerIdInRevocationEntry(t *testing.T) {
+	t.Parallel()
+
+	for _, issuerId := range []issuerID{"", "00000000-0000-0000-0000-000000000000"} {
+		b, s, testEnv := setupOcspEnv(t, "ec")
+		ctx := context.Background()
+
+		serial := serialFromCert(testEnv.leafCertIssuer1)
+		resp, err := CBWrite(b, s, "revoke", map[string]interface{}{
+			"serial_number": serial,
+		})
+		requireSuccessNonNilResponse(t, resp, err, "revoke")
+
+		storagePath := revokedPath + normalizeSerial(serial)
+		var revInfo revocationInfo
+		revEntry, err := s.Get(ctx, storagePath)
+		require.NoError(t, err, "failed looking up storage path: %s", storagePath)
+		err = revEntry.DecodeJSON(&revInfo)
+		require.NoError(t, err, "failed decoding storage entry: %v", revEntry)
+		revInfo.CertificateIssuer = issuerId
+		revEntry, err = logical.StorageEntryJSON(storagePath, revInfo)
+		require.NoError(t, err, "failed re-encoding revocation info: %v", revInfo)
+		err = s.Put(ctx, revEntry)
+		require.NoError(t, err, "failed writing out new revocation entry: %v", revEntry)
+
+		resp, err = sendOcspRequest(t, b, s, "get", testEnv.leafCertIssuer1, testEnv.issuer1, crypto.SHA1)
+		require.NoError(t, err)
+		requireFieldsSetInResp(t, resp, "http_content_type", "http_status_code", "http_raw_body")
+		require.Equal(t, 200, resp.Data["http_status_code"], "issuer id %q", issuerId)
+		respDer := resp.Data["http_raw_body"].([]byte)
+
+		ocspResp, err := ocsp.ParseResponse(respDer, testEnv.issuer1)
+		require.NoError(t, err, "parsing ocsp get response for issuer id %q", issuerId)
+		require.Equal(t, ocsp.Revoked, ocspResp.Status, "issuer id %q", issuerId)
+		require.Equal(t, testEnv.leafCertIssuer1.SerialNumber, ocspResp.SerialNumber)
+		requireOcspResponseSignedBy(t, ocspResp, testEnv.issuer1)
+	}
+}
+
 // Validate that we properly handle an unknown issuer use-case but that the default issuer
 // does not have the OCSP usage flag set, we can't do much else other than reply with an
 // Unauthorized response.
@@ -393,6 +439,180 @@ func TestOcsp_ValidRequests(t *testing.T) {
 	}
 }
 
+// Verify that with ocsp_unified, revocations performed by other clusters are
+// reflected in our OCSP responses.
+func TestOcsp_UnifiedRevocation(t *testing.T) {
+	b, s, testEnv := setupOcspEnv(t, "ec")
+
+	// ocsp_unified requires unified revocation records to be kept.
+	_, err := CBWrite(b, s, "config/crl", map[string]interface{}{
+		"ocsp_unified": true,
+	})
+	require.Error(t, err, "expected error enabling ocsp_unified alone")
+
+	resp, err := CBWrite(b, s, "config/crl", map[string]interface{}{
+		"unified_revocation": true,
+		"ocsp_unified":       true,
+	})
+	requireSuccessNilResponse(t, resp, err, "config/crl")
+
+	// A local revocation lands in the unified store under our cluster id.
+	resp, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": serialFromCert(testEnv.leafCertIssuer1),
+	})
+	requireSuccessNonNilResponse(t, resp, err, "revoke")
+
+	sc := b.makeStorageContext(context.Background(), s)
+	clusterID, err := sc.getLocalClusterID()
+	require.NoError(t, err)
+	entry, err := s.Get(context.Background(), unifiedRevocationPath+clusterID+"/"+normalizeSerial(serialFromCert(testEnv.leafCertIssuer1)))
+	require.NoError(t, err)
+	require.NotNil(t, entry, "expected unified revocation entry for local revocation")
+
+	// Simulate a revocation of the second leaf replicated from another
+	// cluster.
+	revokedAt := time.Now().Add(-1 * time.Minute).UTC().Truncate(time.Second)
+	entry, err = logical.StorageEntryJSON(unifiedRevocationPath+"other-cluster/"+normalizeSerial(serialFromCert(testEnv.leafCertIssuer2)), unifiedRevocationEntry{
+		SerialNumber:      serialFromCert(testEnv.leafCertIssuer2),
+		CertExpiration:    testEnv.leafCertIssuer2.NotAfter,
+		RevocationTimeUTC: revokedAt,
+		CertificateIssuer: testEnv.issuerId2,
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.Put(context.Background(), entry))
+
+	resp, err = sendOcspRequest(t, b, s, "get", testEnv.leafCertIssuer2, testEnv.issuer2, crypto.SHA1)
+	requireSuccessNonNilResponse(t, resp, err, "ocsp get request")
+	require.Equal(t, 200, resp.Data["http_status_code"])
+	ocspResp, err := ocsp.ParseResponse(resp.Data["http_raw_body"].([]byte), testEnv.issuer2)
+	require.NoError(t, err)
+	require.Equal(t, ocsp.Revoked, ocspResp.Status)
+	require.True(t, revokedAt.Equal(ocspResp.RevokedAt), "expected revocation time %v, got %v", revokedAt, ocspResp.RevokedAt)
+
+	// Without ocsp_unified, only local revocations are considered.
+	resp, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"ocsp_unified": false,
+	})
+	requireSuccessNilResponse(t, resp, err, "config/crl")
+
+	resp, err = sendOcspRequest(t, b, s, "get", testEnv.leafCertIssuer2, testEnv.issuer2, crypto.SHA1)
+	requireSuccessNonNilResponse(t, resp, err, "ocsp get request")
+	ocspResp, err = ocsp.ParseResponse(resp.Data["http_raw_body"].([]byte), testEnv.issuer2)
+	require.NoError(t, err)
+	require.Equal(t, ocsp.Good, ocspResp.Status)
+}
+
+// Verify that revocations replicated from other clusters into the unified
+// store drop any cached response for the certificate.
+func TestOcsp_UnifiedRevocationInvalidatesCache(t *testing.T) {
+	b, s, testEnv := setupOcspEnv(t, "ec")
+	ctx := context.Background()
+
+	resp, err := CBWrite(b, s, "config/crl", map[string]interface{}{
+		"unified_revocation": true,
+		"ocsp_unified":       true,
+	})
+	requireSuccessNilResponse(t, resp, err, "config/crl")
+
+	// A "good" response for the second leaf, cached before the revocation.
+	cacheReq, err := newOcspCacheRequest(testEnv.issuer2, testEnv.leafCertIssuer2.SerialNumber, crypto.SHA1)
+	require.NoError(t, err)
+	now := time.Now()
+	b.ocspCache.put(cacheReq, []byte("good"), now.Add(time.Hour), b.ocspCache.currentGeneration(), now)
+	require.NotNil(t, b.ocspCache.get(cacheReq, now))
+
+	serial := serialFromCert(testEnv.leafCertIssuer2)
+	key := unifiedRevocationPath + "other-cluster/" + normalizeSerial(serial)
+	entry, err := logical.StorageEntryJSON(key, unifiedRevocationEntry{
+		SerialNumber:      serial,
+		CertExpiration:    testEnv.leafCertIssuer2.NotAfter,
+		RevocationTimeUTC: now.Add(-time.Minute).UTC().Truncate(time.Second),
+		CertificateIssuer: testEnv.issuerId2,
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.Put(ctx, entry))
+	b.invalidate(ctx, key)
+	require.Nil(t, b.ocspCache.get(cacheReq, now))
+
+	resp, err = sendOcspRequest(t, b, s, "get", testEnv.leafCertIssuer2, testEnv.issuer2, crypto.SHA1)
+	requireSuccessNonNilResponse(t, resp, err, "ocsp get request")
+	ocspResp, err := ocsp.ParseResponse(resp.Data["http_raw_body"].([]byte), testEnv.issuer2)
+	require.NoError(t, err)
+	require.Equal(t, ocsp.Revoked, ocspResp.Status)
+}
+
+// readOnlyUnifiedStorage rejects writes to the unified revocation store
+// while readOnly is set, as a performance secondary does.
+type readOnlyUnifiedStorage struct {
+	logical.Storage
+	readOnly bool
+}
+
+func (s *readOnlyUnifiedStorage) Put(ctx context.Context, entry *logical.StorageEntry) error {
+	if s.readOnly && strings.HasPrefix(entry.Key, unifiedRevocationPath) {
+		return logical.ErrReadOnly
+	}
+	return s.Storage.Put(ctx, entry)
+}
+
+func (s *readOnlyUnifiedStorage) Delete(ctx context.Context, key string) error {
+	if s.readOnly && strings.HasPrefix(key, unifiedRevocationPath) {
+		return logical.ErrReadOnly
+	}
+	return s.Storage.Delete(ctx, key)
+}
+
+// Verify that unified revocation entries which can't be written are queued
+// and transferred once the unified store becomes writable.
+func TestOcsp_UnifiedRevocationQueue(t *testing.T) {
+	b, underlying, testEnv := setupOcspEnv(t, "ec")
+	s := &readOnlyUnifiedStorage{Storage: underlying}
+
+	resp, err := CBWrite(b, s, "config/crl", map[string]interface{}{
+		"unified_revocation": true,
+	})
+	requireSuccessNilResponse(t, resp, err, "config/crl")
+
+	s.readOnly = true
+	serial := serialFromCert(testEnv.leafCertIssuer1)
+	resp, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": serial,
+	})
+	requireSuccessNonNilResponse(t, resp, err, "revoke")
+
+	sc := b.makeStorageContext(context.Background(), s)
+	clusterID, err := sc.getLocalClusterID()
+	require.NoError(t, err)
+	unifiedPath := unifiedRevocationPath + clusterID + "/" + normalizeSerial(serial)
+
+	entry, err := s.Get(context.Background(), unifiedPath)
+	require.NoError(t, err)
+	require.Nil(t, entry, "expected no unified revocation entry while read-only")
+	entry, err = s.Get(context.Background(), unifiedRevocationQueuePath+normalizeSerial(serial))
+	require.NoError(t, err)
+	require.NotNil(t, entry, "expected queued unified revocation entry")
+
+	// Nothing is transferred while the store stays read-only.
+	require.NoError(t, sc.transferUnifiedRevocationQueue())
+	entry, err = s.Get(context.Background(), unifiedRevocationQueuePath+normalizeSerial(serial))
+	require.NoError(t, err)
+	require.NotNil(t, entry, "expected unified revocation entry to stay queued")
+
+	s.readOnly = false
+	require.NoError(t, sc.transferUnifiedRevocationQueue())
+	entry, err = s.Get(context.Background(), unifiedPath)
+	require.NoError(t, err)
+	require.NotNil(t, entry, "expected transferred unified revocation entry")
+	var revEntry unifiedRevocationEntry
+	require.NoError(t, entry.DecodeJSON(&revEntry))
+	require.Equal(t, serial, revEntry.SerialNumber)
+	require.Equal(t, testEnv.issuerId1, revEntry.CertificateIssuer)
+
+	entry, err = s.Get(context.Background(), unifiedRevocationQueuePath+normalizeSerial(serial))
+	require.NoError(t, err)
+	require.Nil(t, entry, "expected queue to be empty after transfer")
+}
+
 func runOcspRequestTest(t *testing.T, requestType string, caKeyType string, requestHash crypto.Hash) {
 	b, s, testEnv := setupOcspEnv(t, caKeyType)
 
@@ -617,3 +837,190 @@ func requireOcspResponseSignedBy(t *testing.T, ocspResp *ocsp.Response, key cryp
 		require.True(t, verify, "the certificate was not signed by the expected public ecdsa key.")
 	}
 }
+
+// Verify that with ocsp_presign, responses for issued certificates are
+// pre-signed and served from cache until the certificate is revoked.
+func TestOcsp_PresignedResponses(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	_, err := CBWrite(b, s, "config/crl", map[string]interface{}{
+		"ocsp_presign": true,
+	})
+	require.NoError(t, err)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"key_type":    "ec",
+		"ttl":         "40h",
+		"common_name": "example-ocsp.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err, "root/generate/internal")
+	issuer := parseCert(t, resp.Data["certificate"].(string))
+
+	_, err = CBWrite(b, s, "roles/test", map[string]interface{}{
+		"allow_subdomains": true,
+		"allowed_domains":  "foobar.com",
+		"key_type":         "ec",
+	})
+	require.NoError(t, err)
+
+	resp, err = CBWrite(b, s, "issue/test", map[string]interface{}{
+		"common_name": "test.foobar.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err, "issue/test")
+	leafCert := parseCert(t, resp.Data["certificate"].(string))
+
+	// Issuance tracks the certificate; the periodic function signs it.
+	tracked, signed := b.ocspCache.size()
+	require.Equal(t, 1, tracked)
+	require.Equal(t, 0, signed)
+
+	require.NoError(t, b.periodicFunc(ctx, &logical.Request{Storage: s}))
+	tracked, signed = b.ocspCache.size()
+	require.Equal(t, 1, tracked)
+	require.Equal(t, 1, signed)
+
+	resp, err = sendOcspRequest(t, b, s, "get", leafCert, issuer, crypto.SHA1)
+	requireSuccessNonNilResponse(t, resp, err, "ocsp get request")
+	cached := resp.Data["http_raw_body"].([]byte)
+
+	ocspResp, err := ocsp.ParseResponse(cached, issuer)
+	require.NoError(t, err)
+	require.Equal(t, ocsp.Good, ocspResp.Status)
+
+	resp, err = sendOcspRequest(t, b, s, "post", leafCert, issuer, crypto.SHA1)
+	requireSuccessNonNilResponse(t, resp, err, "ocsp post request")
+	require.Equal(t, cached, resp.Data["http_raw_body"].([]byte))
+
+	// Requests with other hashes are cached on first use.
+	resp, err = sendOcspRequest(t, b, s, "get", leafCert, issuer, crypto.SHA256)
+	requireSuccessNonNilResponse(t, resp, err, "ocsp get request")
+	tracked, signed = b.ocspCache.size()
+	require.Equal(t, 2, tracked)
+	require.Equal(t, 2, signed)
+
+	// Responses for serial numbers the mount never issued aren't cached.
+	unknownCert := *leafCert
+	unknownCert.SerialNumber = new(big.Int).Add(leafCert.SerialNumber, big.NewInt(1))
+	resp, err = sendOcspRequest(t, b, s, "get", &unknownCert, issuer, crypto.SHA1)
+	requireSuccessNonNilResponse(t, resp, err, "ocsp get request")
+	tracked, signed = b.ocspCache.size()
+	require.Equal(t, 2, tracked)
+	require.Equal(t, 2, signed)
+
+	// Revoking invalidates the cached responses.
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": serialFromCert(leafCert),
+	})
+	require.NoError(t, err)
+
+	for _, requestHash := range []crypto.Hash{crypto.SHA1, crypto.SHA256} {
+		resp, err = sendOcspRequest(t, b, s, "get", leafCert, issuer, requestHash)
+		requireSuccessNonNilResponse(t, resp, err, "ocsp get request")
+		ocspResp, err = ocsp.ParseResponse(resp.Data["http_raw_body"].([]byte), issuer)
+		require.NoError(t, err)
+		require.Equal(t, ocsp.Revoked, ocspResp.Status)
+	}
+
+	// Disabling pre-signing drops the cache.
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"ocsp_presign": false,
+	})
+	require.NoError(t, err)
+	tracked, _ = b.ocspCache.size()
+	require.Equal(t, 0, tracked)
+
+	// Pre-signing can't be combined with unified OCSP.
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"ocsp_presign":       true,
+		"unified_revocation": true,
+		"ocsp_unified":       true,
+	})
+	require.Error(t, err)
+}
+
+// Verify that with ocsp_nonce, nonces (RFC 8954) are echoed in responses.
+func TestOcsp_Nonce(t *testing.T) {
+	t.Parallel()
+	b, s, testEnv := setupOcspEnv(t, "ec")
+
+	withNonce := func(nonce []byte) []byte {
+		var req ocspRequestExtensions
+		_, err := asn1.Unmarshal(generateRequest(t, crypto.SHA256, testEnv.leafCertIssuer1, testEnv.issuer1), &req)
+		require.NoError(t, err)
+
+		value, err := asn1.Marshal(nonce)
+		require.NoError(t, err)
+		req.TBSRequest.RequestExtensions = []pkix.Extension{{Id: oidOcspNonce, Value: value}}
+
+		der, err := asn1.Marshal(req)
+		require.NoError(t, err)
+		return der
+	}
+	responseNonce := func(resp *logical.Response) []byte {
+		ocspResp, err := ocsp.ParseResponse(resp.Data["http_raw_body"].([]byte), testEnv.issuer1)
+		require.NoError(t, err)
+		require.Equal(t, ocsp.Good, ocspResp.Status)
+
+		for _, ext := range ocspResp.Extensions {
+			if ext.Id.Equal(oidOcspNonce) {
+				var nonce []byte
+				_, err := asn1.Unmarshal(ext.Value, &nonce)
+				require.NoError(t, err)
+				return nonce
+			}
+		}
+		return nil
+	}
+
+	nonce := []byte("0123456789abcdef0123456789abcdef")
+
+	// Nonces are ignored by default.
+	resp, err := sendOcspGetRequest(b, s, withNonce(nonce))
+	requireSuccessNonNilResponse(t, resp, err, "ocsp get request")
+	require.Nil(t, responseNonce(resp))
+
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"ocsp_nonce": true,
+	})
+	require.NoError(t, err)
+
+	resp, err = sendOcspGetRequest(b, s, withNonce(nonce))
+	requireSuccessNonNilResponse(t, resp, err, "ocsp get request")
+	require.Equal(t, nonce, responseNonce(resp))
+
+	resp, err = sendOcspPostRequest(b, s, withNonce(nonce[:16]))
+	requireSuccessNonNilResponse(t, resp, err, "ocsp post request")
+	require.Equal(t, nonce[:16], responseNonce(resp))
+
+	// Requests without a nonce are answered without one.
+	resp, err = sendOcspRequest(t, b, s, "get", testEnv.leafCertIssuer1, testEnv.issuer1, crypto.SHA256)
+	requireSuccessNonNilResponse(t, resp, err, "ocsp get request")
+	require.Nil(t, responseNonce(resp))
+
+	// Oversized and empty nonces are rejected.
+	for _, badNonce := range [][]byte{append(nonce, 'x'), {}} {
+		resp, err = sendOcspGetRequest(b, s, withNonce(badNonce))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadRequest, resp.Data["http_status_code"])
+		require.Equal(t, ocsp.MalformedRequestErrorResponse, resp.Data["http_raw_body"])
+	}
+
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"ocsp_nonce_max_length": 64,
+	})
+	require.NoError(t, err)
+	resp, err = sendOcspGetRequest(b, s, withNonce(append(nonce, 'x')))
+	requireSuccessNonNilResponse(t, resp, err, "ocsp get request")
+	require.Equal(t, append(nonce, 'x'), responseNonce(resp))
+
+	_, err = CBWrite(b, s, "config/crl", map[string]interface{}{
+		"ocsp_nonce_max_length": 8,
+	})
+	require.Error(t, err)
+
+	resp, err = CBRead(b, s, "config/crl")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, true, resp.Data["ocsp_nonce"])
+	require.Equal(t, 64, resp.Data["ocsp_nonce_max_length"])
+}
@@ -0,0 +1,813 @@
+package pki
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/argon2"
+)
+
+// Unlike migrate/export, which merges one mount into another (assigning new
+// identifiers), backup/export captures the mount's state as-is, encrypted
+// under a password, for restoring into a fresh mount on a cluster which
+// isn't a replication peer of this one. Identifiers, names, defaults and
+// all configuration carry over unchanged.
+//
+// A backup is exported in parts, so that neither side holds all of a
+// mount's certificates at once: the first part carries the keys, issuers,
+// configuration and roles, and every part carries the certificates and
+// revocation entries of up to a limited number of serial numbers, in
+// order. Parts are restored in the same order.
+//
+// Cloud KMS keys are included as references only, without the credentials
+// used to reach them; those must be given again on restore.
+//
+// Derived state (CRLs, the revocation index, usage statistics, OCSP
+// responses) isn't included and is rebuilt on the destination, as is
+// state tied to this cluster: its cluster configuration and any
+// interrupted tidy. Transient state (enrollment tokens, pending signing
+// requests, rate limit usage) isn't carried over either.
+
+// mountBackupVersion is bumped whenever mountBackup or its encryption
+// changes in an incompatible way.
+const mountBackupVersion = 1
+
+// Parameters of the argon2id derivation of the bundle's encryption key from
+// its password, following the recommendations of RFC 9106 section 4 for
+// memory-constrained environments.
+const (
+	mountBackupKDF         = "argon2id"
+	mountBackupKDFTime     = 3
+	mountBackupKDFMemory   = 64 * 1024
+	mountBackupKDFThreads  = 4
+	mountBackupKDFSaltSize = 16
+)
+
+// Configuration entries which aren't carried over: they are specific to
+// this cluster or this mount's storage, or handled separately.
+var mountBackupSkippedConfig = map[string]bool{
+	clusterConfigPath:           true,
+	tidyCheckpointPath:          true,
+	legacyMigrationBundleLogKey: true,
+	legacyCertBundlePath:        true,
+}
+
+// Configuration stored outside of config/.
+const mountBackupURLsConfig = "urls"
+
+// mountBackupDefaultLimit is the default number of serial numbers whose
+// certificates and revocation entries are exported per part.
+const mountBackupDefaultLimit = 1000
+
+// mountBackupRestorePath holds the progress of a restore whose remaining
+// parts are still to be given.
+const mountBackupRestorePath = "backup/restore-progress"
+
+// mountBackupRestoreProgress records which backup a mount is being restored
+// from, and the part expected next.
+type mountBackupRestoreProgress struct {
+	ID   string `json:"id"`
+	Next string `json:"next"`
+}
+
+// mountBackup is the decrypted content of a backup bundle: one part of a
+// backup.
+type mountBackup struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// ID identifies the backup the part belongs to. After is the last
+	// serial number of the previous part, empty for the first part; Next is
+	// the last serial number of this part, empty for the last part.
+	ID    string `json:"id"`
+	After string `json:"after,omitempty"`
+	Next  string `json:"next,omitempty"`
+
+	Keys         []keyEntry                 `json:"keys"`
+	Issuers      []issuerEntry              `json:"issuers"`
+	Config       []*logical.StorageEntry    `json:"config"`
+	Roles        []*logical.StorageEntry    `json:"roles"`
+	Certs        map[string][]byte          `json:"certs"`
+	Revoked      map[string]*revocationInfo `json:"revoked"`
+	CertMetadata []*certMetadata            `json:"cert_metadata"`
+
+	// CloudKMSCredentialsRemoved lists the cloud KMS keys whose credentials
+	// were removed, which restoring requires again.
+	CloudKMSCredentialsRemoved []keyID `json:"cloud_kms_credentials_removed,omitempty"`
+}
+
+// mountBackupEnvelope is the encrypted form of a mountBackup, as returned
+// (base64 encoded) by backup/export.
+type mountBackupEnvelope struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt"`
+	Time       uint32 `json:"time"`
+	Memory     uint32 `json:"memory"`
+	Threads    uint8  `json:"threads"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func pathBackupExport(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "backup/export",
+		Fields: map[string]*framework.FieldSchema{
+			"password": {
+				Type:        framework.TypeString,
+				Description: `Password the bundle is encrypted under; required.`,
+			},
+			"backup_id": {
+				Type: framework.TypeString,
+				Description: `ID of the backup to continue exporting, as returned
+with its previous part; empty to start a new backup.`,
+			},
+			"after": {
+				Type: framework.TypeString,
+				Description: `Serial number to continue the backup after, as
+returned in next_after with its previous part. Required with backup_id.`,
+			},
+			"limit": {
+				Type:    framework.TypeInt,
+				Default: mountBackupDefaultLimit,
+				Description: `The maximum number of serial numbers whose
+certificates and revocation entries are exported in this part.`,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathBackupExport,
+			},
+		},
+
+		HelpSynopsis:    pathBackupExportHelpSyn,
+		HelpDescription: pathBackupExportHelpDesc,
+	}
+}
+
+func pathBackupRestore(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "backup/restore",
+		Fields: map[string]*framework.FieldSchema{
+			"bundle": {
+				Type:        framework.TypeString,
+				Description: `Bundle returned by backup/export on the source mount.`,
+				Required:    true,
+			},
+			"password": {
+				Type:        framework.TypeString,
+				Description: `Password the bundle was encrypted under.`,
+				Required:    true,
+			},
+			"cloud_kms_credentials": {
+				Type: framework.TypeMap,
+				Description: `Credentials of the bundle's cloud KMS keys, which
+backups don't include: a map of each key's ID to a map of its secret_key,
+credentials or client_secret, as given when importing it. Required for each
+key imported with any of these.`,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathBackupRestore,
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathBackupRestoreHelpSyn,
+		HelpDescription: pathBackupRestoreHelpDesc,
+	}
+}
+
+func (b *backend) pathBackupExport(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	password := data.Get("password").(string)
+	if len(password) == 0 {
+		return logical.ErrorResponse("missing password; backups are only exported encrypted"), nil
+	}
+
+	b.issuersLock.RLock()
+	defer b.issuersLock.RUnlock()
+
+	if b.useLegacyBundleCaStorage() {
+		return logical.ErrorResponse("Cannot export mount until migration has completed"), nil
+	}
+
+	backupId := data.Get("backup_id").(string)
+	after := data.Get("after").(string)
+	if (backupId == "") != (after == "") {
+		return logical.ErrorResponse("backup_id and after must be given together, to continue a backup"), nil
+	}
+	limit := data.Get("limit").(int)
+	if limit <= 0 {
+		return logical.ErrorResponse(fmt.Sprintf("limit must be greater than 0 got: %d", limit)), nil
+	}
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+	backup := &mountBackup{
+		Version:   mountBackupVersion,
+		CreatedAt: time.Now().UTC(),
+		ID:        backupId,
+		After:     after,
+		Certs:     make(map[string][]byte),
+		Revoked:   make(map[string]*revocationInfo),
+	}
+	var warnings []string
+	var err error
+	if backup.After == "" {
+		backup.ID, err = uuid.GenerateUUID()
+		if err != nil {
+			return nil, err
+		}
+		warnings, err = sc.collectMountBackupState(backup)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := sc.collectMountBackupSerials(backup, limit); err != nil {
+		return nil, err
+	}
+
+	plaintext, err := json.Marshal(backup)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode mount backup: %w", err)
+	}
+	bundle, err := sealMountBackup(plaintext, password)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"bundle":      bundle,
+			"keys":        len(backup.Keys),
+			"issuers":     len(backup.Issuers),
+			"roles":       len(backup.Roles),
+			"certs":       len(backup.Certs),
+			"revocations": len(backup.Revoked),
+			"created_at":  backup.CreatedAt.Format(time.RFC3339),
+			"backup_id":   backup.ID,
+			"next_after":  backup.Next,
+		},
+	}
+	for _, warning := range warnings {
+		resp.AddWarning(warning)
+	}
+	return resp, nil
+}
+
+// collectMountBackupState gathers the mount's keys, issuers, configuration
+// and roles into the first part of a backup, returning warnings about
+// anything which couldn't be included.
+func (sc *storageContext) collectMountBackupState(backup *mountBackup) ([]string, error) {
+	var warnings []string
+
+	// The private keys of managed keys live outside of Vault and can't be
+	// exported; their issuers are exported without a key.
+	skippedKeys := make(map[keyID]bool)
+	keys, err := sc.listKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range keys {
+		key, err := sc.fetchKeyById(id)
+		if err != nil {
+			return nil, err
+		}
+		// Cloud KMS keys are only references to the provider's key, so
+		// unlike other managed keys they can be backed up, save for the
+		// credentials used to reach the key.
+		if key.isManagedPrivateKey() && !key.isCloudKMSKey() {
+			skippedKeys[id] = true
+			warnings = append(warnings, fmt.Sprintf("Key %v is a managed key and can't be exported; its issuers are exported without a key.", id))
+			continue
+		}
+		if ref, ok := parseCloudKMSKeyRef([]byte(key.PrivateKey)); ok && key.isCloudKMSKey() {
+			if stripped, removed := ref.withoutCredentials(); removed {
+				key.PrivateKey, err = stripped.toPEM()
+				if err != nil {
+					return nil, err
+				}
+				backup.CloudKMSCredentialsRemoved = append(backup.CloudKMSCredentialsRemoved, id)
+				warnings = append(warnings, fmt.Sprintf("Key %v is a cloud KMS key; its credentials aren't exported and must be given again on restore.", id))
+			}
+		}
+		backup.Keys = append(backup.Keys, *key)
+	}
+
+	issuers, err := sc.listIssuers()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range issuers {
+		issuer, err := sc.fetchIssuerById(id)
+		if err != nil {
+			return nil, err
+		}
+		if skippedKeys[issuer.KeyID] {
+			issuer.KeyID = ""
+		}
+		backup.Issuers = append(backup.Issuers, *issuer)
+	}
+
+	// The remaining configuration is carried over verbatim, save for a
+	// default key which wasn't exported.
+	var configKeys []string
+	if err := logical.ScanView(sc.Context, logical.NewStorageView(sc.Storage, "config/"), func(path string) {
+		configKeys = append(configKeys, "config/"+path)
+	}); err != nil {
+		return nil, fmt.Errorf("error listing configuration: %w", err)
+	}
+	configKeys = append(configKeys, mountBackupURLsConfig)
+	for _, key := range configKeys {
+		if mountBackupSkippedConfig[key] || strings.HasPrefix(key, keyPrefix) || strings.HasPrefix(key, issuerPrefix) {
+			continue
+		}
+
+		entry, err := sc.Storage.Get(sc.Context, key)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			continue
+		}
+
+		if key == storageKeyConfig {
+			config, err := sc.getKeysConfig()
+			if err != nil {
+				return nil, err
+			}
+			if skippedKeys[config.DefaultKeyId] {
+				config.DefaultKeyId = ""
+				entry, err = logical.StorageEntryJSON(storageKeyConfig, config)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		backup.Config = append(backup.Config, entry)
+	}
+
+	roles, err := sc.Storage.List(sc.Context, "role/")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range roles {
+		entry, err := sc.Storage.Get(sc.Context, "role/"+name)
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			backup.Roles = append(backup.Roles, entry)
+		}
+	}
+
+	return warnings, nil
+}
+
+// collectMountBackupSerials gathers the stored certificates, their metadata
+// and revocation entries of up to limit serial numbers following
+// backup.After into the part, setting backup.Next when more remain.
+func (sc *storageContext) collectMountBackupSerials(backup *mountBackup, limit int) error {
+	// Revocation entries may outlive their certificates, so both are
+	// walked together.
+	certSerials, err := sc.Storage.List(sc.Context, "certs/")
+	if err != nil {
+		return err
+	}
+	revokedSerials, err := sc.Storage.List(sc.Context, revokedPath)
+	if err != nil {
+		return err
+	}
+	serialSet := make(map[string]bool, len(certSerials)+len(revokedSerials))
+	for _, serial := range append(certSerials, revokedSerials...) {
+		if serial > backup.After {
+			serialSet[serial] = true
+		}
+	}
+	serials := make([]string, 0, len(serialSet))
+	for serial := range serialSet {
+		serials = append(serials, serial)
+	}
+	sort.Strings(serials)
+	if len(serials) > limit {
+		serials = serials[:limit]
+		backup.Next = serials[limit-1]
+	}
+
+	for _, serial := range serials {
+		entry, err := sc.Storage.Get(sc.Context, "certs/"+serial)
+		if err != nil {
+			return err
+		}
+		if entry != nil {
+			backup.Certs[serial] = entry.Value
+
+			meta, err := sc.fetchCertMetadata(serial)
+			if err != nil {
+				return err
+			}
+			if meta != nil {
+				backup.CertMetadata = append(backup.CertMetadata, meta)
+			}
+		}
+
+		entry, err = sc.Storage.Get(sc.Context, revokedPath+serial)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			continue
+		}
+
+		var revInfo revocationInfo
+		if err := entry.DecodeJSON(&revInfo); err != nil {
+			return fmt.Errorf("error decoding revocation entry for serial %s: %w", serial, err)
+		}
+		backup.Revoked[serial] = &revInfo
+	}
+
+	return nil
+}
+
+func (b *backend) pathBackupRestore(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	if b.useLegacyBundleCaStorage() {
+		return logical.ErrorResponse("Cannot restore mount until migration has completed"), nil
+	}
+
+	plaintext, err := openMountBackup(data.Get("bundle").(string), data.Get("password").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	var backup mountBackup
+	if err := json.Unmarshal(plaintext, &backup); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("unable to parse bundle: %v", err)), nil
+	}
+	if backup.Version != mountBackupVersion {
+		return logical.ErrorResponse(fmt.Sprintf("unsupported bundle version %d; expected %d", backup.Version, mountBackupVersion)), nil
+	}
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+
+	progress, err := fetchMountBackupRestoreProgress(sc)
+	if err != nil {
+		return nil, err
+	}
+	if backup.After != "" {
+		// Later parts only carry certificates and revocation entries, and
+		// continue a restore already underway.
+		if progress == nil || progress.ID != backup.ID {
+			return logical.ErrorResponse(fmt.Sprintf("bundle continues backup %v, which this mount isn't being restored from; restore its first part first", backup.ID)), nil
+		}
+		if progress.Next != backup.After {
+			return logical.ErrorResponse(fmt.Sprintf("bundle continues backup %v after serial %v, but the part after serial %v is expected next", backup.ID, backup.After, progress.Next)), nil
+		}
+
+		return b.restoreMountBackupSerials(sc, req, &backup, nil, nil, nil)
+	}
+	if progress != nil {
+		return logical.ErrorResponse(fmt.Sprintf("this mount is being restored from backup %v; restore its part after serial %v next", progress.ID, progress.Next)), nil
+	}
+
+	// Restoring replaces the mount's configuration and keeps identifiers,
+	// which is only safe when there's nothing to conflict with.
+	keys, err := sc.listKeys()
+	if err != nil {
+		return nil, err
+	}
+	issuers, err := sc.listIssuers()
+	if err != nil {
+		return nil, err
+	}
+	roles, err := req.Storage.List(ctx, "role/")
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) > 0 || len(issuers) > 0 || len(roles) > 0 {
+		return logical.ErrorResponse("backups can only be restored into an empty mount, without keys, issuers or roles; use migrate/import to merge mounts"), nil
+	}
+
+	// Fill in the cloud KMS credentials left out of the bundle before
+	// writing anything.
+	credentials := data.Get("cloud_kms_credentials").(map[string]interface{})
+	requiresCredentials := make(map[keyID]bool, len(backup.CloudKMSCredentialsRemoved))
+	for _, id := range backup.CloudKMSCredentialsRemoved {
+		requiresCredentials[id] = true
+	}
+	bundledKeys := make(map[string]bool, len(backup.Keys))
+	for _, key := range backup.Keys {
+		bundledKeys[key.ID.String()] = true
+	}
+	for id := range credentials {
+		if !bundledKeys[id] {
+			return logical.ErrorResponse(fmt.Sprintf("cloud_kms_credentials given for key %v, which isn't in the bundle", id)), nil
+		}
+	}
+	for i := range backup.Keys {
+		key := &backup.Keys[i]
+		keyCredentials, given := credentials[key.ID.String()]
+		if !requiresCredentials[key.ID] && !given {
+			continue
+		}
+
+		ref, ok := parseCloudKMSKeyRef([]byte(key.PrivateKey))
+		if !ok || !key.isCloudKMSKey() {
+			return logical.ErrorResponse(fmt.Sprintf("cloud_kms_credentials given for key %v, which isn't a cloud KMS key", key.ID)), nil
+		}
+		credentialMap, ok := keyCredentials.(map[string]interface{})
+		if !ok || len(credentialMap) == 0 {
+			return logical.ErrorResponse(fmt.Sprintf("cloud KMS key %v requires its credentials in cloud_kms_credentials", key.ID)), nil
+		}
+		if err := ref.setCredentials(credentialMap); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid cloud_kms_credentials for key %v: %v", key.ID, err)), nil
+		}
+
+		key.PrivateKey, err = ref.toPEM()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var restoredKeys []string
+	for _, key := range backup.Keys {
+		if err := sc.writeKey(key); err != nil {
+			return nil, err
+		}
+		restoredKeys = append(restoredKeys, key.ID.String())
+	}
+
+	var restoredIssuers []string
+	for i := range backup.Issuers {
+		if err := sc.writeIssuer(&backup.Issuers[i]); err != nil {
+			return nil, err
+		}
+		restoredIssuers = append(restoredIssuers, backup.Issuers[i].ID.String())
+	}
+
+	for _, entry := range backup.Config {
+		if (!strings.HasPrefix(entry.Key, "config/") && entry.Key != mountBackupURLsConfig) || mountBackupSkippedConfig[entry.Key] ||
+			strings.HasPrefix(entry.Key, keyPrefix) || strings.HasPrefix(entry.Key, issuerPrefix) {
+			return logical.ErrorResponse(fmt.Sprintf("bundle contains unexpected configuration entry %q", entry.Key)), nil
+		}
+		if err := req.Storage.Put(ctx, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	// The issuer configuration is among the entries written directly.
+	b.issuerCache.flush()
+
+	var restoredRoles []string
+	for _, entry := range backup.Roles {
+		name := strings.TrimPrefix(entry.Key, "role/")
+		if name == entry.Key || name == "" || strings.Contains(name, "/") {
+			return logical.ErrorResponse(fmt.Sprintf("bundle contains unexpected role entry %q", entry.Key)), nil
+		}
+		if err := req.Storage.Put(ctx, entry); err != nil {
+			return nil, err
+		}
+		restoredRoles = append(restoredRoles, name)
+	}
+
+	return b.restoreMountBackupSerials(sc, req, &backup, restoredKeys, restoredIssuers, restoredRoles)
+}
+
+// restoreMountBackupSerials writes the certificates, their metadata and
+// revocation entries of a backup part, recording the progress of the
+// restore and rebuilding the CRLs as needed.
+func (b *backend) restoreMountBackupSerials(sc *storageContext, req *logical.Request, backup *mountBackup, restoredKeys []string, restoredIssuers []string, restoredRoles []string) (*logical.Response, error) {
+	for serial, certBytes := range backup.Certs {
+		if err := sc.Storage.Put(sc.Context, &logical.StorageEntry{
+			Key:   "certs/" + serial,
+			Value: certBytes,
+		}); err != nil {
+			return nil, err
+		}
+		b.usageStats.certStored("certs/"+serial, certBytes)
+	}
+
+	for _, meta := range backup.CertMetadata {
+		if err := sc.writeCertMetadata(meta); err != nil {
+			return nil, err
+		}
+	}
+
+	for serial, revInfo := range backup.Revoked {
+		if err := writeRevocationEntry(sc, serial, revInfo); err != nil {
+			return nil, err
+		}
+	}
+
+	if backup.Next != "" {
+		entry, err := logical.StorageEntryJSON(mountBackupRestorePath, &mountBackupRestoreProgress{
+			ID:   backup.ID,
+			Next: backup.Next,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := sc.Storage.Put(sc.Context, entry); err != nil {
+			return nil, err
+		}
+	} else if err := sc.Storage.Delete(sc.Context, mountBackupRestorePath); err != nil {
+		return nil, err
+	}
+
+	if backup.After == "" {
+		// Pick up the restored configuration before rebuilding the CRLs.
+		b.crlBuilder.markConfigDirty()
+		if err := b.crlBuilder.reloadConfigIfRequired(sc); err != nil {
+			return nil, err
+		}
+		b.crlBuilder.invalidateCRLBuildTime()
+		b.ocspCache.flush()
+	}
+
+	rebuild := len(restoredIssuers) > 0
+	if backup.After != "" && len(backup.Revoked) > 0 {
+		issuers, err := sc.listIssuers()
+		if err != nil {
+			return nil, err
+		}
+		rebuild = len(issuers) > 0
+		b.ocspCache.flush()
+	}
+	if rebuild {
+		if err := b.crlBuilder.rebuild(sc.Context, b, req, true); err != nil {
+			return nil, err
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"restored_keys":        restoredKeys,
+			"restored_issuers":     restoredIssuers,
+			"restored_roles":       restoredRoles,
+			"restored_certs":       len(backup.Certs),
+			"restored_revocations": len(backup.Revoked),
+			"created_at":           backup.CreatedAt.Format(time.RFC3339),
+			"backup_id":            backup.ID,
+			"next_after":           backup.Next,
+		},
+	}, nil
+}
+
+// fetchMountBackupRestoreProgress returns the progress of the restore
+// underway on this mount, if any.
+func fetchMountBackupRestoreProgress(sc *storageContext) (*mountBackupRestoreProgress, error) {
+	entry, err := sc.Storage.Get(sc.Context, mountBackupRestorePath)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var progress mountBackupRestoreProgress
+	if err := entry.DecodeJSON(&progress); err != nil {
+		return nil, fmt.Errorf("error decoding backup restore progress: %w", err)
+	}
+	return &progress, nil
+}
+
+// sealMountBackup encrypts the plaintext of a backup under the password,
+// returning the base64 encoded envelope.
+func sealMountBackup(plaintext []byte, password string) (string, error) {
+	envelope := &mountBackupEnvelope{
+		Version: mountBackupVersion,
+		KDF:     mountBackupKDF,
+		Salt:    make([]byte, mountBackupKDFSaltSize),
+		Time:    mountBackupKDFTime,
+		Memory:  mountBackupKDFMemory,
+		Threads: mountBackupKDFThreads,
+	}
+	if _, err := io.ReadFull(rand.Reader, envelope.Salt); err != nil {
+		return "", fmt.Errorf("unable to generate salt: %w", err)
+	}
+
+	aead, err := envelope.aead(password)
+	if err != nil {
+		return "", err
+	}
+	envelope.Nonce = make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, envelope.Nonce); err != nil {
+		return "", fmt.Errorf("unable to generate nonce: %w", err)
+	}
+	envelope.Ciphertext = aead.Seal(nil, envelope.Nonce, plaintext, nil)
+
+	encoded, err := json.Marshal(envelope)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode mount backup: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(encoded), nil
+}
+
+// openMountBackup decrypts a bundle returned by sealMountBackup.
+func openMountBackup(bundle string, password string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(bundle))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode bundle: %w", err)
+	}
+
+	var envelope mountBackupEnvelope
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return nil, fmt.Errorf("unable to parse bundle: %w", err)
+	}
+	if envelope.Version != mountBackupVersion || envelope.KDF != mountBackupKDF {
+		return nil, fmt.Errorf("unsupported bundle version %d (%q); expected %d (%q)", envelope.Version, envelope.KDF, mountBackupVersion, mountBackupKDF)
+	}
+	// Bound the work an untrusted bundle can make us do.
+	if envelope.Time == 0 || envelope.Time > 4*mountBackupKDFTime ||
+		envelope.Memory == 0 || envelope.Memory > 4*mountBackupKDFMemory ||
+		envelope.Threads == 0 || len(envelope.Salt) == 0 {
+		return nil, fmt.Errorf("bundle has invalid key derivation parameters")
+	}
+
+	aead, err := envelope.aead(password)
+	if err != nil {
+		return nil, err
+	}
+	if len(envelope.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("bundle has an invalid nonce")
+	}
+
+	plaintext, err := aead.Open(nil, envelope.Nonce, envelope.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt bundle: wrong password or corrupted bundle")
+	}
+	return plaintext, nil
+}
+
+// aead derives the bundle's AES-256-GCM key from the password.
+func (e *mountBackupEnvelope) aead(password string) (cipher.AEAD, error) {
+	key := argon2.IDKey([]byte(password), e.Salt, e.Time, e.Memory, e.Threads, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+const pathBackupExportHelpSyn = `
+Export this mount's state as an encrypted backup bundle.
+`
+
+const pathBackupExportHelpDesc = `
+This endpoint returns this mount's keys, issuers, configuration, roles,
+stored certificates and revocations as a bundle encrypted under the given
+password, for restoring into a fresh PKI mount (in particular, one on a
+cluster which isn't a replication peer of this one) via its backup/restore
+endpoint.
+
+Backups are exported in parts of at most limit serial numbers each: the
+first part carries the keys, issuers, configuration and roles along with
+the first certificates and revocations. While next_after is returned, call
+this endpoint again with it as after and the returned backup_id to export
+the next part.
+
+Managed keys can't be exported; their issuers are exported without a key,
+with a warning. CRLs and other derived state are rebuilt by the destination
+mount, and this cluster's cluster configuration isn't included.
+
+The bundle is encrypted with AES-256-GCM under a key derived from the
+password with argon2id. It contains all private keys of this mount; choose
+the password accordingly.
+`
+
+const pathBackupRestoreHelpSyn = `
+Restore a backup bundle into this empty mount.
+`
+
+const pathBackupRestoreHelpDesc = `
+This endpoint restores a bundle produced by backup/export into this mount,
+which must not have any keys, issuers or roles. Everything in the bundle is
+restored as-is, keeping identifiers, names and defaults, and replacing this
+mount's configuration; the CRLs are then rebuilt.
+
+The parts of a backup are restored in the order they were exported, the
+first into an empty mount; next_after is returned until the last part has
+been restored.
+
+To merge the state of another mount into one already in use, use the
+migrate/export and migrate/import endpoints instead.
+`
@@ -0,0 +1,808 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+	cbbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// The CMP (RFC 4210) endpoint lets devices which require CMP, such as
+// telecom equipment, enroll for certificates (ir and cr messages) and
+// update their keys (kur messages), over HTTP as per RFC 6712. It is
+// served under cmp and cmp/<label>, with each label mapped to a role by
+// config/cmp.
+//
+// Requests are DER-encoded PKIMessages, POSTed with the
+// application/pkixcmp content type, whose body Vault passes through
+// unparsed. They must be protected, either with a password-based MAC keyed
+// with the shared secret of the role, or with a signature by a certificate
+// issued by this mount; key updates require the latter, with the
+// certificate being updated. Responses are protected the same way as the
+// request, signatures being made with the issuer's key.
+//
+// Only a subset of CMP is supported: a single certificate request per
+// message, with signature-based proof of possession, and certificates are
+// issued immediately, regardless of whether the client confirms them.
+const (
+	cmpContentType = "application/pkixcmp"
+
+	// PKIBody choices.
+	cmpBodyIR       = 0
+	cmpBodyIP       = 1
+	cmpBodyCR       = 2
+	cmpBodyCP       = 3
+	cmpBodyKUR      = 7
+	cmpBodyKUP      = 8
+	cmpBodyPKIConf  = 19
+	cmpBodyError    = 23
+	cmpBodyCertConf = 24
+
+	// PKIStatus values.
+	cmpStatusAccepted  = 0
+	cmpStatusRejection = 2
+
+	// PKIFailureInfo bits.
+	cmpFailBadAlg           = 0
+	cmpFailBadMessageCheck  = 1
+	cmpFailBadRequest       = 2
+	cmpFailBadDataFormat    = 5
+	cmpFailBadPOP           = 9
+	cmpFailBadCertTemplate  = 19
+	cmpFailSignerNotTrusted = 20
+	cmpFailUnsupportedVer   = 22
+	cmpFailNotAuthorized    = 23
+
+	// cmpMaxRequestSize bounds the size of requests.
+	cmpMaxRequestSize = 64 * 1024
+
+	// cmpMaxPBMIterations bounds the work a client can make the server do
+	// verifying a password-based MAC.
+	cmpMaxPBMIterations = 100000
+
+	cmpNonceSize = 16
+)
+
+var (
+	oidCmpPasswordBasedMac = asn1.ObjectIdentifier{1, 2, 840, 113533, 7, 66, 13}
+	oidCmpImplicitConfirm  = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 4, 13}
+	oidExtensionRequest    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 14}
+
+	// cmpHashes are the one-way functions supported in password-based MACs.
+	cmpHashes = map[string]crypto.Hash{
+		"1.3.14.3.2.26":          crypto.SHA1,
+		"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+		"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+		"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+	}
+
+	// cmpHMACs are the MAC algorithms supported in password-based MACs.
+	cmpHMACs = map[string]crypto.Hash{
+		"1.3.6.1.5.5.8.1.2":   crypto.SHA1,
+		"1.2.840.113549.2.7":  crypto.SHA1,
+		"1.2.840.113549.2.9":  crypto.SHA256,
+		"1.2.840.113549.2.10": crypto.SHA384,
+		"1.2.840.113549.2.11": crypto.SHA512,
+	}
+
+	// cmpSignatureAlgorithms are the signature algorithms supported for
+	// protection and proof of possession.
+	cmpSignatureAlgorithms = map[string]x509.SignatureAlgorithm{
+		"1.2.840.113549.1.1.11": x509.SHA256WithRSA,
+		"1.2.840.113549.1.1.12": x509.SHA384WithRSA,
+		"1.2.840.113549.1.1.13": x509.SHA512WithRSA,
+		"1.2.840.10045.4.3.2":   x509.ECDSAWithSHA256,
+		"1.2.840.10045.4.3.3":   x509.ECDSAWithSHA384,
+		"1.2.840.10045.4.3.4":   x509.ECDSAWithSHA512,
+		"1.3.101.112":           x509.PureEd25519,
+	}
+)
+
+type cmpPKIMessage struct {
+	Header     asn1.RawValue
+	Body       asn1.RawValue
+	Protection asn1.BitString  `asn1:"optional,explicit,tag:0"`
+	ExtraCerts []asn1.RawValue `asn1:"optional,explicit,tag:1"`
+}
+
+type cmpPKIHeader struct {
+	PVNO          int
+	Sender        asn1.RawValue
+	Recipient     asn1.RawValue
+	MessageTime   time.Time                `asn1:"optional,explicit,tag:0,generalized"`
+	ProtectionAlg pkix.AlgorithmIdentifier `asn1:"optional,explicit,tag:1"`
+	SenderKID     []byte                   `asn1:"optional,explicit,tag:2"`
+	RecipKID      []byte                   `asn1:"optional,explicit,tag:3"`
+	TransactionID []byte                   `asn1:"optional,explicit,tag:4"`
+	SenderNonce   []byte                   `asn1:"optional,explicit,tag:5"`
+	RecipNonce    []byte                   `asn1:"optional,explicit,tag:6"`
+	FreeText      asn1.RawValue            `asn1:"optional,explicit,tag:7"`
+	GeneralInfo   []cmpInfoTypeAndValue    `asn1:"optional,explicit,tag:8"`
+}
+
+type cmpInfoTypeAndValue struct {
+	InfoType  asn1.ObjectIdentifier
+	InfoValue asn1.RawValue `asn1:"optional"`
+}
+
+type cmpPBMParameter struct {
+	Salt           []byte
+	OWF            pkix.AlgorithmIdentifier
+	IterationCount int
+	MAC            pkix.AlgorithmIdentifier
+}
+
+type cmpCertReqMsg struct {
+	CertReq asn1.RawValue
+	Popo    asn1.RawValue `asn1:"optional"`
+	RegInfo asn1.RawValue `asn1:"optional"`
+}
+
+type cmpCertRequest struct {
+	CertReqID    int
+	CertTemplate asn1.RawValue
+	Controls     asn1.RawValue `asn1:"optional"`
+}
+
+type cmpPOPOSigningKey struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Signature asn1.BitString
+}
+
+type cmpPKIStatusInfo struct {
+	Status       int
+	StatusString []asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.BitString  `asn1:"optional"`
+}
+
+type cmpErrorMsgContent struct {
+	PKIStatusInfo cmpPKIStatusInfo
+}
+
+type cmpCertRepMessage struct {
+	CAPubs   []asn1.RawValue `asn1:"optional,explicit,tag:1"`
+	Response []cmpCertResponse
+}
+
+type cmpCertResponse struct {
+	CertReqID        int
+	Status           cmpPKIStatusInfo
+	CertifiedKeyPair cmpCertifiedKeyPair `asn1:"optional"`
+}
+
+type cmpCertifiedKeyPair struct {
+	// CertOrEncCert, always the certificate [0] choice.
+	CertOrEncCert asn1.RawValue
+}
+
+// cmpCertTemplate holds the parts of a CRMF CertTemplate (RFC 4211 Section
+// 5) requests are issued from.
+type cmpCertTemplate struct {
+	rawSubject    []byte
+	rawPublicKey  []byte
+	publicKey     crypto.PublicKey
+	rawExtensions []byte
+}
+
+func pathCmp(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "cmp(/" + framework.GenericNameRegex("label") + ")?",
+		Fields: map[string]*framework.FieldSchema{
+			"label": {
+				Type:        framework.TypeString,
+				Description: `CMP label, mapped to a role by config/cmp.`,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.metricsWrap("cmp", noRole, func(ctx context.Context, req *logical.Request, data *framework.FieldData, _ *roleEntry) (*logical.Response, error) {
+					return b.pathCmpRequest(ctx, req, data)
+				}),
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathCmpHelpSyn,
+		HelpDescription: pathCmpHelpDesc,
+	}
+}
+
+// cmpRole returns the role requests under the requested label issue
+// against, or an error response should CMP be disabled or the label
+// unknown.
+func (b *backend) cmpRole(sc *storageContext, data *framework.FieldData) (*cmpConfigEntry, string, *roleEntry, *logical.Response, error) {
+	config, err := sc.getCmpConfig()
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+	if !config.Enabled {
+		return nil, "", nil, estErrorResponse(http.StatusNotFound, "CMP is not enabled on this mount"), nil
+	}
+
+	roleName, err := config.roleForLabel(data.Get("label").(string))
+	if err != nil {
+		return nil, "", nil, estErrorResponse(http.StatusNotFound, err.Error()), nil
+	}
+
+	role, err := b.getRole(sc.Context, sc.Storage, roleName)
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+	if role == nil {
+		return nil, "", nil, estErrorResponse(http.StatusNotFound, fmt.Sprintf("role %s mapped to this CMP label no longer exists", roleName)), nil
+	}
+
+	return config, roleName, role, nil, nil
+}
+
+func (b *backend) pathCmpRequest(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, roleName, role, errResp, err := b.cmpRole(sc, data)
+	if err != nil || errResp != nil {
+		return errResp, err
+	}
+
+	body, err := readCmpMessage(req)
+	if err != nil {
+		return estErrorResponse(http.StatusBadRequest, err.Error()), nil
+	}
+
+	var message cmpPKIMessage
+	if rest, err := asn1.Unmarshal(body, &message); err != nil || len(rest) > 0 {
+		return estErrorResponse(http.StatusBadRequest, "unable to parse the PKIMessage"), nil
+	}
+	var header cmpPKIHeader
+	if rest, err := asn1.Unmarshal(message.Header.FullBytes, &header); err != nil || len(rest) > 0 {
+		return estErrorResponse(http.StatusBadRequest, "unable to parse the PKIHeader"), nil
+	}
+
+	issuerRef := role.Issuer
+	if issuerRef == "" {
+		issuerRef = defaultRef
+	}
+
+	caInfo, err := sc.fetchCAInfo(issuerRef, IssuanceUsage)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &cmpReply{
+		caInfo: caInfo,
+		header: &header,
+	}
+
+	if header.PVNO != 2 && header.PVNO != 3 {
+		return reply.failure(cmpFailUnsupportedVer, "unsupported CMP version")
+	}
+	if message.Body.Class != asn1.ClassContextSpecific {
+		return reply.failure(cmpFailBadDataFormat, "malformed PKIBody")
+	}
+
+	// Verify the protection of the message, which authenticates it.
+	protectedPart := cmpProtectedPart(message.Header.FullBytes, message.Body.FullBytes)
+	var signer *x509.Certificate
+	switch {
+	case len(header.ProtectionAlg.Algorithm) == 0:
+		return reply.failure(cmpFailNotAuthorized, "the message must be protected")
+	case header.ProtectionAlg.Algorithm.Equal(oidCmpPasswordBasedMac):
+		secret, ok := config.SharedSecrets[roleName]
+		if !ok {
+			return reply.failure(cmpFailNotAuthorized, "MAC-based protection is not configured for this role")
+		}
+
+		var params cmpPBMParameter
+		if rest, err := asn1.Unmarshal(header.ProtectionAlg.Parameters.FullBytes, &params); err != nil || len(rest) > 0 {
+			return reply.failure(cmpFailBadDataFormat, "malformed PBMParameter")
+		}
+		mac, err := cmpPasswordBasedMac(&params, []byte(secret), protectedPart)
+		if err != nil {
+			return reply.failure(cmpFailBadAlg, err.Error())
+		}
+		if !hmac.Equal(mac, message.Protection.RightAlign()) {
+			return reply.failure(cmpFailBadMessageCheck, "the message protection is invalid")
+		}
+
+		reply.pbm = &params
+		reply.secret = []byte(secret)
+	default:
+		algorithm, ok := cmpSignatureAlgorithms[header.ProtectionAlg.Algorithm.String()]
+		if !ok {
+			return reply.failure(cmpFailBadAlg, "unsupported protection algorithm")
+		}
+		if !config.EnableSignatureProtection {
+			return reply.failure(cmpFailNotAuthorized, "signature-based protection is not enabled")
+		}
+
+		var extraCerts []*x509.Certificate
+		for _, raw := range message.ExtraCerts {
+			cert, err := x509.ParseCertificate(raw.FullBytes)
+			if err != nil {
+				return reply.failure(cmpFailBadDataFormat, "unable to parse the extra certificates")
+			}
+			extraCerts = append(extraCerts, cert)
+		}
+		if len(extraCerts) == 0 {
+			return reply.failure(cmpFailNotAuthorized, "the protecting certificate must be the first extra certificate")
+		}
+		if err := extraCerts[0].CheckSignature(algorithm, protectedPart, message.Protection.RightAlign()); err != nil {
+			return reply.failure(cmpFailBadMessageCheck, "the message protection is invalid")
+		}
+		if err := b.verifyIssuedByMount(sc, req, extraCerts[0], extraCerts[1:]); err != nil {
+			if _, ok := err.(errutil.UserError); !ok {
+				return nil, err
+			}
+			return reply.failure(cmpFailSignerNotTrusted, fmt.Sprintf("the protecting certificate is not trusted: %v", err))
+		}
+
+		signer = extraCerts[0]
+	}
+
+	switch message.Body.Tag {
+	case cmpBodyIR, cmpBodyCR, cmpBodyKUR:
+		return b.cmpCertRequest(sc, req, role, reply, message.Body, signer)
+	case cmpBodyCertConf:
+		// Certificates are issued without awaiting confirmation, so there
+		// is nothing to do but acknowledge it.
+		return reply.build(cmpBodyPKIConf, asn1.NullBytes)
+	default:
+		return reply.failure(cmpFailBadRequest, "unsupported PKIBody type")
+	}
+}
+
+func (b *backend) cmpCertRequest(sc *storageContext, req *logical.Request, role *roleEntry, reply *cmpReply, body asn1.RawValue, signer *x509.Certificate) (*logical.Response, error) {
+	if role.RequireApproval {
+		return reply.failure(cmpFailNotAuthorized, "roles requiring approval can not issue certificates through CMP")
+	}
+	if body.Tag == cmpBodyKUR && signer == nil {
+		return reply.failure(cmpFailNotAuthorized, "key update requests must be protected with the certificate being updated")
+	}
+
+	var requests []cmpCertReqMsg
+	if rest, err := asn1.Unmarshal(body.Bytes, &requests); err != nil || len(rest) > 0 {
+		return reply.failure(cmpFailBadDataFormat, "malformed CertReqMessages")
+	}
+	if len(requests) != 1 {
+		return reply.failure(cmpFailBadRequest, "exactly one certificate request is supported per message")
+	}
+	reqMsg := requests[0]
+
+	var certReq cmpCertRequest
+	if rest, err := asn1.Unmarshal(reqMsg.CertReq.FullBytes, &certReq); err != nil || len(rest) > 0 {
+		return reply.failure(cmpFailBadDataFormat, "malformed CertRequest")
+	}
+	template, err := parseCmpCertTemplate(certReq.CertTemplate)
+	if err != nil {
+		return reply.failure(cmpFailBadCertTemplate, err.Error())
+	}
+
+	// Proof of possession: a signature over the CertRequest, with the key
+	// of the template; see RFC 4211 Section 4.1.
+	if reqMsg.Popo.Class != asn1.ClassContextSpecific || reqMsg.Popo.Tag != 1 {
+		return reply.failure(cmpFailBadPOP, "signature-based proof of possession is required")
+	}
+	var popo cmpPOPOSigningKey
+	if rest, err := asn1.UnmarshalWithParams(reqMsg.Popo.FullBytes, &popo, "tag:1"); err != nil || len(rest) > 0 {
+		return reply.failure(cmpFailBadPOP, "malformed or unsupported proof of possession")
+	}
+	algorithm, ok := cmpSignatureAlgorithms[popo.Algorithm.Algorithm.String()]
+	if !ok {
+		return reply.failure(cmpFailBadAlg, "unsupported proof of possession algorithm")
+	}
+	holder := &x509.Certificate{PublicKey: template.publicKey}
+	if err := holder.CheckSignature(algorithm, reqMsg.CertReq.FullBytes, popo.Signature.RightAlign()); err != nil {
+		return reply.failure(cmpFailBadPOP, "the proof of possession is invalid")
+	}
+
+	csr, err := template.carrierCSR()
+	if err != nil {
+		return reply.failure(cmpFailBadCertTemplate, err.Error())
+	}
+	// Requests protected by a certificate, rather than the role's shared
+	// secret, may only be for the identity it certifies, whether updating
+	// it or not.
+	if signer != nil && !estSameIdentity(signer, csr) {
+		return reply.failure(cmpFailBadCertTemplate, "the subject and subject alternative names of the template must match those of the protecting certificate")
+	}
+
+	signData := &framework.FieldData{
+		Raw: map[string]interface{}{
+			"csr":    string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr.Raw})),
+			"format": "der",
+		},
+		Schema: pathSign(b).Fields,
+	}
+
+	// The proof of possession was verified above, against the template's
+	// key, as the CSR built from it carries no signature.
+	resp, err := b.issueSignCert(sc.Context, req, signData, role, true, false, false, true)
+	if err != nil {
+		if _, ok := err.(errutil.UserError); ok {
+			return reply.failure(cmpFailBadRequest, err.Error())
+		}
+		return nil, err
+	}
+	if resp.IsError() {
+		return reply.failure(cmpFailBadRequest, resp.Error().Error())
+	}
+
+	certBytes, err := base64.StdEncoding.DecodeString(resp.Data["certificate"].(string))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode issued certificate: %w", err)
+	}
+
+	repMessage := cmpCertRepMessage{
+		Response: []cmpCertResponse{
+			{
+				CertReqID: certReq.CertReqID,
+				Status:    cmpPKIStatusInfo{Status: cmpStatusAccepted},
+				CertifiedKeyPair: cmpCertifiedKeyPair{
+					CertOrEncCert: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certBytes},
+				},
+			},
+		},
+	}
+	if body.Tag == cmpBodyIR {
+		repMessage.CAPubs = []asn1.RawValue{{FullBytes: reply.caInfo.Certificate.Raw}}
+	}
+
+	repBytes, err := asn1.Marshal(repMessage)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode CertRepMessage: %w", err)
+	}
+
+	// Each request body is answered by the next choice: ir by ip, cr by cp
+	// and kur by kup.
+	return reply.build(body.Tag+1, repBytes)
+}
+
+// parseCmpCertTemplate parses the subject, public key and extensions of a
+// CertTemplate; its other fields are ignored, as the role determines them.
+func parseCmpCertTemplate(raw asn1.RawValue) (*cmpCertTemplate, error) {
+	template := &cmpCertTemplate{}
+
+	input := cryptobyte.String(raw.Bytes)
+	for !input.Empty() {
+		var field cryptobyte.String
+		var tag cbbasn1.Tag
+		if !input.ReadAnyASN1(&field, &tag) {
+			return nil, fmt.Errorf("malformed CertTemplate")
+		}
+
+		switch tag {
+		case cbbasn1.Tag(5).Constructed().ContextSpecific():
+			// Name is a CHOICE, and so explicitly tagged.
+			template.rawSubject = field
+		case cbbasn1.Tag(6).Constructed().ContextSpecific():
+			template.rawPublicKey = cryptobyteSequence(field)
+		case cbbasn1.Tag(9).Constructed().ContextSpecific():
+			template.rawExtensions = cryptobyteSequence(field)
+		}
+	}
+
+	if template.rawPublicKey == nil {
+		return nil, fmt.Errorf("the CertTemplate must carry a public key")
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(template.rawPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the public key of the CertTemplate: %v", err)
+	}
+	template.publicKey = publicKey
+
+	if template.rawSubject == nil {
+		template.rawSubject = cryptobyteSequence(nil)
+	}
+
+	return template, nil
+}
+
+// carrierCSR builds an (unsigned) CSR carrying the subject, public key and
+// extensions of the template, to sign as any other CSR would be; proof of
+// possession of its key was established by the CertReqMsg itself.
+func (t *cmpCertTemplate) carrierCSR() (*x509.CertificateRequest, error) {
+	var builder cryptobyte.Builder
+	builder.AddASN1(cbbasn1.SEQUENCE, func(csr *cryptobyte.Builder) {
+		csr.AddASN1(cbbasn1.SEQUENCE, func(tbs *cryptobyte.Builder) {
+			tbs.AddASN1Int64(0)
+			tbs.AddBytes(t.rawSubject)
+			tbs.AddBytes(t.rawPublicKey)
+			tbs.AddASN1(cbbasn1.Tag(0).Constructed().ContextSpecific(), func(attributes *cryptobyte.Builder) {
+				if t.rawExtensions == nil {
+					return
+				}
+				attributes.AddASN1(cbbasn1.SEQUENCE, func(attribute *cryptobyte.Builder) {
+					attribute.AddASN1ObjectIdentifier(oidExtensionRequest)
+					attribute.AddASN1(cbbasn1.SET, func(values *cryptobyte.Builder) {
+						values.AddBytes(t.rawExtensions)
+					})
+				})
+			})
+		})
+		csr.AddASN1(cbbasn1.SEQUENCE, func(algorithm *cryptobyte.Builder) {
+			algorithm.AddASN1ObjectIdentifier(asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11})
+			algorithm.AddASN1NULL()
+		})
+		csr.AddASN1BitString(nil)
+	})
+
+	der, err := builder.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the CertTemplate: %v", err)
+	}
+	return csr, nil
+}
+
+// cmpReply builds the protected response to a CMP request.
+type cmpReply struct {
+	caInfo *certutil.CAInfoBundle
+	header *cmpPKIHeader
+
+	// The protection of the response: a password-based MAC keyed with the
+	// same secret as a MAC-protected request, and otherwise a signature by
+	// the issuer.
+	pbm    *cmpPBMParameter
+	secret []byte
+}
+
+func (r *cmpReply) failure(failInfo int, message string) (*logical.Response, error) {
+	content, err := asn1.Marshal(cmpErrorMsgContent{
+		PKIStatusInfo: cmpPKIStatusInfo{
+			Status:       cmpStatusRejection,
+			StatusString: []asn1.RawValue{{Tag: asn1.TagUTF8String, Bytes: []byte(message)}},
+			FailInfo:     cmpFailInfoBits(failInfo),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode CMP error message: %w", err)
+	}
+
+	return r.build(cmpBodyError, content)
+}
+
+func (r *cmpReply) build(bodyTag int, content []byte) (*logical.Response, error) {
+	nonce := make([]byte, cmpNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	header := cmpPKIHeader{
+		PVNO:          2,
+		Sender:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: r.caInfo.Certificate.RawSubject},
+		Recipient:     r.header.Sender,
+		MessageTime:   time.Now().UTC().Truncate(time.Second),
+		RecipKID:      r.header.SenderKID,
+		TransactionID: r.header.TransactionID,
+		SenderNonce:   nonce,
+		RecipNonce:    r.header.SenderNonce,
+	}
+	for _, info := range r.header.GeneralInfo {
+		if info.InfoType.Equal(oidCmpImplicitConfirm) {
+			header.GeneralInfo = append(header.GeneralInfo, cmpInfoTypeAndValue{InfoType: oidCmpImplicitConfirm, InfoValue: asn1.NullRawValue})
+		}
+	}
+
+	var err error
+	switch {
+	case r.pbm != nil:
+		params := *r.pbm
+		params.Salt = make([]byte, cmpNonceSize)
+		if _, err := rand.Read(params.Salt); err != nil {
+			return nil, err
+		}
+		paramBytes, err := asn1.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		header.ProtectionAlg = pkix.AlgorithmIdentifier{Algorithm: oidCmpPasswordBasedMac, Parameters: asn1.RawValue{FullBytes: paramBytes}}
+	default:
+		header.ProtectionAlg, err = cmpSignatureAlgorithmFor(r.caInfo.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	headerBytes, err := asn1.Marshal(header)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode PKIHeader: %w", err)
+	}
+	bodyBytes, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: bodyTag, IsCompound: true, Bytes: content})
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode PKIBody: %w", err)
+	}
+
+	message := cmpPKIMessage{
+		Header: asn1.RawValue{FullBytes: headerBytes},
+		Body:   asn1.RawValue{FullBytes: bodyBytes},
+	}
+
+	protectedPart := cmpProtectedPart(headerBytes, bodyBytes)
+	var protection []byte
+	switch {
+	case r.pbm != nil:
+		var params cmpPBMParameter
+		if _, err := asn1.Unmarshal(header.ProtectionAlg.Parameters.FullBytes, &params); err != nil {
+			return nil, err
+		}
+		protection, err = cmpPasswordBasedMac(&params, r.secret, protectedPart)
+	default:
+		protection, err = cmpSign(r.caInfo.PrivateKey, protectedPart)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to protect CMP response: %w", err)
+	}
+	if protection != nil {
+		message.Protection = asn1.BitString{Bytes: protection, BitLength: len(protection) * 8}
+	}
+
+	message.ExtraCerts = append(message.ExtraCerts, asn1.RawValue{FullBytes: r.caInfo.Certificate.Raw})
+	for _, block := range r.caInfo.CAChain {
+		if !bytes.Equal(block.Bytes, r.caInfo.Certificate.Raw) {
+			message.ExtraCerts = append(message.ExtraCerts, asn1.RawValue{FullBytes: block.Bytes})
+		}
+	}
+
+	messageBytes, err := asn1.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode PKIMessage: %w", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: cmpContentType,
+			logical.HTTPRawBody:     messageBytes,
+			logical.HTTPStatusCode:  http.StatusOK,
+		},
+	}, nil
+}
+
+// cmpProtectedPart encodes the ProtectedPart of a PKIMessage, over which
+// its protection is computed.
+func cmpProtectedPart(header []byte, body []byte) []byte {
+	var builder cryptobyte.Builder
+	builder.AddASN1(cbbasn1.SEQUENCE, func(part *cryptobyte.Builder) {
+		part.AddBytes(header)
+		part.AddBytes(body)
+	})
+	return builder.BytesOrPanic()
+}
+
+// cmpPasswordBasedMac computes the password-based MAC of RFC 4210 Section
+// 5.1.3.1: the key is the one-way function applied iterationCount times to
+// the secret and salt.
+func cmpPasswordBasedMac(params *cmpPBMParameter, secret []byte, data []byte) ([]byte, error) {
+	owf, ok := cmpHashes[params.OWF.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported one-way function %v", params.OWF.Algorithm)
+	}
+	macHash, ok := cmpHMACs[params.MAC.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported MAC algorithm %v", params.MAC.Algorithm)
+	}
+	if params.IterationCount < 1 || params.IterationCount > cmpMaxPBMIterations {
+		return nil, fmt.Errorf("iteration count must be between 1 and %d", cmpMaxPBMIterations)
+	}
+
+	hasher := owf.New()
+	hasher.Write(secret)
+	hasher.Write(params.Salt)
+	key := hasher.Sum(nil)
+	for i := 1; i < params.IterationCount; i++ {
+		hasher.Reset()
+		hasher.Write(key)
+		key = hasher.Sum(key[:0])
+	}
+
+	mac := hmac.New(func() hash.Hash { return macHash.New() }, key)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+// cmpSignatureAlgorithmFor returns the algorithm responses are signed with
+// using the given key.
+func cmpSignatureAlgorithmFor(signer crypto.Signer) (pkix.AlgorithmIdentifier, error) {
+	switch signer.Public().(type) {
+	case *rsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, Parameters: asn1.NullRawValue}, nil
+	case *ecdsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}}, nil
+	case ed25519.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 3, 101, 112}}, nil
+	default:
+		return pkix.AlgorithmIdentifier{}, fmt.Errorf("unsupported issuer key type %T", signer.Public())
+	}
+}
+
+// cmpSign signs the data with the key, per cmpSignatureAlgorithmFor.
+func cmpSign(signer crypto.Signer, data []byte) ([]byte, error) {
+	if _, ok := signer.Public().(ed25519.PublicKey); ok {
+		return signer.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+
+	digest := crypto.SHA256.New()
+	digest.Write(data)
+	return signer.Sign(rand.Reader, digest.Sum(nil), crypto.SHA256)
+}
+
+// cmpFailInfoBits encodes the PKIFailureInfo with the given bit set.
+func cmpFailInfoBits(bit int) asn1.BitString {
+	bits := make([]byte, bit/8+1)
+	bits[bit/8] = 0x80 >> uint(bit%8)
+	return asn1.BitString{Bytes: bits, BitLength: bit + 1}
+}
+
+// cryptobyteSequence wraps the given contents in a SEQUENCE, undoing the
+// implicit tagging of a field.
+func cryptobyteSequence(contents []byte) []byte {
+	var builder cryptobyte.Builder
+	builder.AddASN1(cbbasn1.SEQUENCE, func(sequence *cryptobyte.Builder) {
+		sequence.AddBytes(contents)
+	})
+	return builder.BytesOrPanic()
+}
+
+// readCmpMessage reads the DER-encoded PKIMessage in the body of a CMP
+// request.
+func readCmpMessage(req *logical.Request) ([]byte, error) {
+	if req.HTTPRequest == nil || req.HTTPRequest.Body == nil {
+		return nil, fmt.Errorf("the request must carry a PKIMessage with the %s content type", cmpContentType)
+	}
+
+	rawBody := req.HTTPRequest.Body
+	defer rawBody.Close()
+
+	body, err := io.ReadAll(io.LimitReader(rawBody, cmpMaxRequestSize))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) >= cmpMaxRequestSize {
+		return nil, fmt.Errorf("request is too large")
+	}
+
+	return body, nil
+}
+
+const pathCmpHelpSyn = `
+CMP (RFC 4210) enrollment endpoint.
+`
+
+const pathCmpHelpDesc = `
+This unauthenticated endpoint implements certificate requests (ir and cr)
+and key updates (kur) of CMP (RFC 4210), over HTTP (RFC 6712), under cmp
+and cmp/<label>; see config/cmp for mapping labels to roles.
+
+Requests are DER-encoded PKIMessages with the application/pkixcmp content
+type, carrying a single certificate request with signature-based proof of
+possession. They must be protected, either with a password-based MAC keyed
+with the role's shared secret, or with a signature by a certificate issued
+by this mount; key updates must be signed with the certificate being
+updated.
+`
@@ -0,0 +1,189 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	aiaChasingConfigPath = "config/aia-chasing"
+
+	defaultAIAChasingMaxDepth     = 4
+	defaultAIAChasingFetchTimeout = 10 * time.Second
+)
+
+type aiaChasingConfigEntry struct {
+	Enabled      bool          `json:"enabled"`
+	AllowedHosts []string      `json:"allowed_hosts"`
+	MaxDepth     int           `json:"max_depth"`
+	FetchTimeout time.Duration `json:"fetch_timeout"`
+}
+
+func pathConfigAIAChasing(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/aia-chasing",
+		Fields: map[string]*framework.FieldSchema{
+			"enabled": {
+				Type: framework.TypeBool,
+				Description: `Whether to fetch the missing parents of imported
+issuers whose chains don't reach a root, from the caIssuers URLs of their
+authority information access extension.`,
+			},
+			"allowed_hosts": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `Hosts parents may be fetched from, such as
+pki.example.com; a leading "*." allows any subdomain. Required when
+enabled.`,
+			},
+			"max_depth": {
+				Type: framework.TypeInt,
+				Description: `The most parents to fetch above each imported
+issuer. Defaults to 4.`,
+			},
+			"fetch_timeout": {
+				Type: framework.TypeDurationSecond,
+				Description: `How long to wait for each fetch. Defaults to 10
+seconds.`,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathReadAIAChasingConfig,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathWriteAIAChasingConfig,
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathConfigAIAChasingHelpSyn,
+		HelpDescription: pathConfigAIAChasingHelpDesc,
+	}
+}
+
+func (sc *storageContext) getAIAChasingConfig() (*aiaChasingConfigEntry, error) {
+	entry, err := sc.Storage.Get(sc.Context, aiaChasingConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &aiaChasingConfigEntry{
+		MaxDepth:     defaultAIAChasingMaxDepth,
+		FetchTimeout: defaultAIAChasingFetchTimeout,
+	}
+	if entry == nil {
+		return config, nil
+	}
+
+	if err := entry.DecodeJSON(config); err != nil {
+		return nil, fmt.Errorf("unable to decode AIA chasing configuration: %w", err)
+	}
+
+	return config, nil
+}
+
+func (sc *storageContext) setAIAChasingConfig(config *aiaChasingConfigEntry) error {
+	entry, err := logical.StorageEntryJSON(aiaChasingConfigPath, config)
+	if err != nil {
+		return err
+	}
+
+	return sc.Storage.Put(sc.Context, entry)
+}
+
+func (b *backend) pathReadAIAChasingConfig(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getAIAChasingConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	allowedHosts := config.AllowedHosts
+	if allowedHosts == nil {
+		allowedHosts = []string{}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":       config.Enabled,
+			"allowed_hosts": allowedHosts,
+			"max_depth":     config.MaxDepth,
+			"fetch_timeout": int64(config.FetchTimeout.Seconds()),
+		},
+	}, nil
+}
+
+func (b *backend) pathWriteAIAChasingConfig(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getAIAChasingConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledRaw, ok := data.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+
+	if hostsRaw, ok := data.GetOk("allowed_hosts"); ok {
+		config.AllowedHosts = nil
+		for _, host := range hostsRaw.([]string) {
+			host = strings.ToLower(strings.TrimSpace(host))
+			if host == "" {
+				continue
+			}
+			if strings.ContainsAny(host, "/:@") || strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+				return logical.ErrorResponse(fmt.Sprintf("invalid host given in allowed_hosts: %s; expected a hostname, optionally prefixed by \"*.\"", host)), nil
+			}
+			config.AllowedHosts = append(config.AllowedHosts, host)
+		}
+	}
+
+	if depthRaw, ok := data.GetOk("max_depth"); ok {
+		config.MaxDepth = depthRaw.(int)
+		if config.MaxDepth < 1 {
+			return logical.ErrorResponse("max_depth must be at least 1"), nil
+		}
+	}
+
+	if timeoutRaw, ok := data.GetOk("fetch_timeout"); ok {
+		config.FetchTimeout = time.Duration(timeoutRaw.(int)) * time.Second
+		if config.FetchTimeout <= 0 {
+			return logical.ErrorResponse("fetch_timeout must be positive"), nil
+		}
+	}
+
+	if config.Enabled && len(config.AllowedHosts) == 0 {
+		return logical.ErrorResponse("allowed_hosts is required when AIA chasing is enabled"), nil
+	}
+
+	if err := sc.setAIAChasingConfig(config); err != nil {
+		return nil, err
+	}
+
+	return b.pathReadAIAChasingConfig(ctx, req, data)
+}
+
+const pathConfigAIAChasingHelpSyn = `
+Configure fetching the missing parents of imported issuers.
+`
+
+const pathConfigAIAChasingHelpDesc = `
+When enabled, importing an issuer whose chain doesn't reach a root (such as
+an intermediate imported without its chain) fetches the certificate of its
+parent from the caIssuers URLs of its authority information access
+extension, and imports it as an issuer too, repeating up to max_depth times
+until a root is reached. The fetched issuers then appear in the imported
+issuer's ca_chain.
+
+Only URLs on allowed_hosts are fetched, and only certificates which verify
+the signature of the certificate being chased are imported. Failures to
+fetch are returned as warnings; the import itself still succeeds.
+`
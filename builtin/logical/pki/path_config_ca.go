@@ -2,6 +2,7 @@ package pki
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -52,6 +53,13 @@ func pathConfigIssuers(b *backend) *framework.Path {
 				Type:        framework.TypeString,
 				Description: `Reference (name or identifier) to the default issuer.`,
 			},
+			"default_fallbacks": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `Ordered references (names or identifiers) to
+issuers standing in for the default issuer when it is expired, not allowed
+to issue certificates (or, for CRLs, to sign them), or has no key. Set to an
+empty list to remove them.`,
+			},
 		},
 
 		Operations: map[logical.Operation]framework.OperationHandler{
@@ -109,11 +117,19 @@ func (b *backend) pathCAIssuersRead(ctx context.Context, req *logical.Request, _
 
 	return &logical.Response{
 		Data: map[string]interface{}{
-			defaultRef: config.DefaultIssuerId,
+			defaultRef:          config.DefaultIssuerId,
+			"default_fallbacks": issuerFallbacksResponse(config.DefaultFallbacks),
 		},
 	}, nil
 }
 
+func issuerFallbacksResponse(fallbacks []issuerID) []issuerID {
+	if fallbacks == nil {
+		return []issuerID{}
+	}
+	return fallbacks
+}
+
 func (b *backend) pathCAIssuersWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	// Since we're planning on updating issuers here, grab the lock so we've
 	// got a consistent view.
@@ -124,12 +140,36 @@ func (b *backend) pathCAIssuersWrite(ctx context.Context, req *logical.Request,
 		return logical.ErrorResponse("Cannot update defaults until migration has completed"), nil
 	}
 
+	sc := b.makeStorageContext(ctx, req.Storage)
+
+	// root/replace shares this handler, without fallbacks.
+	var fallbacksRaw interface{}
+	var fallbacksSet bool
+	if _, ok := data.Schema["default_fallbacks"]; ok {
+		fallbacksRaw, fallbacksSet = data.GetOk("default_fallbacks")
+	}
+
 	newDefault := data.Get(defaultRef).(string)
+	if len(newDefault) == 0 && fallbacksSet {
+		// Only updating the fallbacks.
+		config, err := sc.getIssuersConfig()
+		if err != nil {
+			return nil, err
+		}
+		if resp := sc.updateDefaultFallbacks(config, fallbacksRaw.([]string)); resp != nil {
+			return resp, nil
+		}
+		return &logical.Response{
+			Data: map[string]interface{}{
+				defaultRef:          config.DefaultIssuerId,
+				"default_fallbacks": issuerFallbacksResponse(config.DefaultFallbacks),
+			},
+		}, nil
+	}
 	if len(newDefault) == 0 || newDefault == defaultRef {
 		return logical.ErrorResponse("Invalid issuer specification; must be non-empty and can't be 'default'."), nil
 	}
 
-	sc := b.makeStorageContext(ctx, req.Storage)
 	parsedIssuer, err := sc.resolveIssuerReference(newDefault)
 	if err != nil {
 		return logical.ErrorResponse("Error resolving issuer reference: " + err.Error()), nil
@@ -157,9 +197,49 @@ func (b *backend) pathCAIssuersWrite(ctx context.Context, req *logical.Request,
 		return logical.ErrorResponse("Error updating issuer configuration: " + err.Error()), nil
 	}
 
+	config, err := sc.getIssuersConfig()
+	if err != nil {
+		return nil, err
+	}
+	if fallbacksSet {
+		if resp := sc.updateDefaultFallbacks(config, fallbacksRaw.([]string)); resp != nil {
+			return resp, nil
+		}
+	}
+	if _, ok := data.Schema["default_fallbacks"]; ok {
+		response.Data["default_fallbacks"] = issuerFallbacksResponse(config.DefaultFallbacks)
+	}
+
 	return response, nil
 }
 
+// updateDefaultFallbacks resolves and persists the fallback default
+// issuers, returning an error response when any can't be resolved.
+func (sc *storageContext) updateDefaultFallbacks(config *issuerConfigEntry, refs []string) *logical.Response {
+	var fallbacks []issuerID
+	seen := make(map[issuerID]bool)
+	for _, ref := range refs {
+		if ref == defaultRef {
+			return logical.ErrorResponse("Invalid fallback issuer specification; can't be 'default'.")
+		}
+		id, err := sc.resolveIssuerReference(ref)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("Error resolving fallback issuer reference %v: %v", ref, err))
+		}
+		if seen[id] || id == config.DefaultIssuerId {
+			continue
+		}
+		seen[id] = true
+		fallbacks = append(fallbacks, id)
+	}
+
+	config.DefaultFallbacks = fallbacks
+	if err := sc.setIssuersConfig(config); err != nil {
+		return logical.ErrorResponse("Error updating issuer configuration: " + err.Error())
+	}
+	return nil
+}
+
 const pathConfigIssuersHelpSyn = `Read and set the default issuer certificate for signing.`
 
 const pathConfigIssuersHelpDesc = `
@@ -169,6 +249,11 @@ Presently, the "default" parameter controls which issuer is the default,
 accessible by the existing signing paths (/root/sign-intermediate,
 /root/sign-self-issued, /sign-verbatim, /sign/:role, and /issue/:role).
 
+The "default_fallbacks" parameter lists issuers, in order, which stand in
+for the default when it is expired, not allowed to issue certificates, or
+has no key: issuance through "default" uses the first which can, as does
+the placement of revocations not assignable to any issuer on a CRL.
+
 The /root/replace path is aliased to this path, with default taking the
 value of the issuer with the name "next", if it exists.
 `
@@ -0,0 +1,126 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// clusterConfigPath is cluster-local (see LocalStorage in backend.go), as
+// each performance replication cluster is reached at its own address.
+const clusterConfigPath = "config/cluster"
+
+type clusterConfigEntry struct {
+	Path string `json:"path"`
+}
+
+func pathConfigCluster(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/cluster",
+		Fields: map[string]*framework.FieldSchema{
+			"path": {
+				Type: framework.TypeString,
+				Description: `Canonical URI to this mount on this performance
+replication cluster's external address. This is for resolving AIA URLs and
+providing the {{cluster_path}} template parameter but might be used for other
+purposes in the future.
+
+This should only point back to this particular PR replica and should not ever
+point to another PR cluster. It may point to any node in the PR replica,
+including standby nodes, and need not always point to the active node.
+
+For example: https://pr1.vault.example.com:8200/v1/pki`,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathReadClusterConfig,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathWriteClusterConfig,
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby: true,
+			},
+		},
+
+		HelpSynopsis:    pathConfigClusterHelpSyn,
+		HelpDescription: pathConfigClusterHelpDesc,
+	}
+}
+
+func (sc *storageContext) getClusterConfig() (*clusterConfigEntry, error) {
+	entry, err := sc.Storage.Get(sc.Context, clusterConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &clusterConfigEntry{}
+	if entry == nil {
+		return config, nil
+	}
+
+	if err := entry.DecodeJSON(config); err != nil {
+		return nil, fmt.Errorf("unable to decode cluster configuration: %w", err)
+	}
+
+	return config, nil
+}
+
+func (sc *storageContext) setClusterConfig(config *clusterConfigEntry) error {
+	entry, err := logical.StorageEntryJSON(clusterConfigPath, config)
+	if err != nil {
+		return err
+	}
+
+	return sc.Storage.Put(sc.Context, entry)
+}
+
+func (b *backend) pathReadClusterConfig(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"path": config.Path,
+		},
+	}, nil
+}
+
+func (b *backend) pathWriteClusterConfig(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if pathRaw, ok := data.GetOk("path"); ok {
+		config.Path = pathRaw.(string)
+		if config.Path != "" && !govalidator.IsURL(config.Path) {
+			return logical.ErrorResponse(fmt.Sprintf("invalid URL given for path: %s", config.Path)), nil
+		}
+	}
+
+	if err := sc.setClusterConfig(config); err != nil {
+		return nil, err
+	}
+
+	return b.pathReadClusterConfig(ctx, req, data)
+}
+
+const pathConfigClusterHelpSyn = `
+Set cluster-local configuration, including address to this PR cluster.
+`
+
+const pathConfigClusterHelpDesc = `
+This path allows you to set cluster-local configuration, including the
+URI to this performance replication cluster. This allows you to use
+templated AIA URLs with /config/urls, rather than configuring each issuer
+with the URLs of this cluster.
+`
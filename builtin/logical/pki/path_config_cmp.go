@@ -0,0 +1,233 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const cmpConfigPath = "config/cmp"
+
+// cmpConfigEntry is the CMP configuration. Unlike challenge passwords, the
+// shared secrets are stored as is, as verifying MAC-based protection
+// requires them.
+type cmpConfigEntry struct {
+	Enabled                   bool              `json:"enabled"`
+	DefaultRole               string            `json:"default_role"`
+	LabelToRole               map[string]string `json:"label_to_role"`
+	SharedSecrets             map[string]string `json:"shared_secrets"`
+	EnableSignatureProtection bool              `json:"enable_signature_protection"`
+}
+
+var defaultCmpConfig = cmpConfigEntry{
+	Enabled:                   false,
+	LabelToRole:               map[string]string{},
+	SharedSecrets:             map[string]string{},
+	EnableSignatureProtection: true,
+}
+
+// roleForLabel returns the name of the role requests under the given label
+// (or, when empty, without a label) issue against.
+func (c *cmpConfigEntry) roleForLabel(label string) (string, error) {
+	if label == "" {
+		if c.DefaultRole == "" {
+			return "", fmt.Errorf("no default_role is configured for CMP")
+		}
+		return c.DefaultRole, nil
+	}
+
+	role, ok := c.LabelToRole[label]
+	if !ok {
+		return "", fmt.Errorf("unknown CMP label %q", label)
+	}
+	return role, nil
+}
+
+func pathConfigCmp(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/cmp",
+		Fields: map[string]*framework.FieldSchema{
+			"enabled": {
+				Type:        framework.TypeBool,
+				Description: `Whether the CMP (RFC 4210) endpoint is enabled.`,
+			},
+			"default_role": {
+				Type: framework.TypeString,
+				Description: `Role that requests without a label (under cmp)
+issue against.`,
+			},
+			"label_to_role": {
+				Type: framework.TypeKVPairs,
+				Description: `Mapping of CMP labels (cmp/<label>) to the roles
+requests under them issue against.`,
+			},
+			"shared_secrets": {
+				Type: framework.TypeKVPairs,
+				Description: `Mapping of role names to the shared secret that
+MAC-protected requests against that role are protected with. Replaces all
+previously configured shared secrets; they can't be read back.`,
+			},
+			"enable_signature_protection": {
+				Type: framework.TypeBool,
+				Description: `Whether requests may be protected with a signature
+by a certificate issued by this mount. Key update requests always require
+it.`,
+				Default: defaultCmpConfig.EnableSignatureProtection,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathReadCmpConfig,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathWriteCmpConfig,
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathConfigCmpHelpSyn,
+		HelpDescription: pathConfigCmpHelpDesc,
+	}
+}
+
+func (sc *storageContext) getCmpConfig() (*cmpConfigEntry, error) {
+	entry, err := sc.Storage.Get(sc.Context, cmpConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config := defaultCmpConfig
+	config.LabelToRole = map[string]string{}
+	config.SharedSecrets = map[string]string{}
+	if entry == nil {
+		return &config, nil
+	}
+
+	if err := entry.DecodeJSON(&config); err != nil {
+		return nil, fmt.Errorf("unable to decode CMP configuration: %w", err)
+	}
+	if config.LabelToRole == nil {
+		config.LabelToRole = map[string]string{}
+	}
+	if config.SharedSecrets == nil {
+		config.SharedSecrets = map[string]string{}
+	}
+
+	return &config, nil
+}
+
+func (sc *storageContext) setCmpConfig(config *cmpConfigEntry) error {
+	entry, err := logical.StorageEntryJSON(cmpConfigPath, config)
+	if err != nil {
+		return err
+	}
+
+	return sc.Storage.Put(sc.Context, entry)
+}
+
+func (b *backend) pathReadCmpConfig(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getCmpConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	secretRoles := make([]string, 0, len(config.SharedSecrets))
+	for roleName := range config.SharedSecrets {
+		secretRoles = append(secretRoles, roleName)
+	}
+	sort.Strings(secretRoles)
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":                     config.Enabled,
+			"default_role":                config.DefaultRole,
+			"label_to_role":               config.LabelToRole,
+			"shared_secret_roles":         secretRoles,
+			"enable_signature_protection": config.EnableSignatureProtection,
+		},
+	}, nil
+}
+
+func (b *backend) pathWriteCmpConfig(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getCmpConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledRaw, ok := data.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+	if roleRaw, ok := data.GetOk("default_role"); ok {
+		config.DefaultRole = roleRaw.(string)
+	}
+	if labelsRaw, ok := data.GetOk("label_to_role"); ok {
+		config.LabelToRole = labelsRaw.(map[string]string)
+	}
+	if secretsRaw, ok := data.GetOk("shared_secrets"); ok {
+		config.SharedSecrets = secretsRaw.(map[string]string)
+		for roleName, secret := range config.SharedSecrets {
+			if secret == "" {
+				return logical.ErrorResponse(fmt.Sprintf("the shared secret of role %s must not be empty", roleName)), nil
+			}
+		}
+	}
+	if signatureRaw, ok := data.GetOk("enable_signature_protection"); ok {
+		config.EnableSignatureProtection = signatureRaw.(bool)
+	}
+
+	roles := make(map[string]struct{}, len(config.LabelToRole)+len(config.SharedSecrets)+1)
+	if config.DefaultRole != "" {
+		roles[config.DefaultRole] = struct{}{}
+	}
+	for label, role := range config.LabelToRole {
+		if !estLabelRegex.MatchString(label) {
+			return logical.ErrorResponse(fmt.Sprintf("invalid CMP label %q: labels may only contain letters, digits, hyphens and underscores", label)), nil
+		}
+		roles[role] = struct{}{}
+	}
+	for roleName := range config.SharedSecrets {
+		roles[roleName] = struct{}{}
+	}
+	for roleName := range roles {
+		role, err := b.getRole(ctx, req.Storage, roleName)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return logical.ErrorResponse(fmt.Sprintf("unknown role: %s", roleName)), nil
+		}
+	}
+
+	if config.Enabled && !config.EnableSignatureProtection && len(config.SharedSecrets) == 0 {
+		return logical.ErrorResponse("either shared_secrets or enable_signature_protection must be set when CMP is enabled"), nil
+	}
+
+	if err := sc.setCmpConfig(config); err != nil {
+		return nil, err
+	}
+
+	return b.pathReadCmpConfig(ctx, req, data)
+}
+
+const pathConfigCmpHelpSyn = `
+Configure the CMP (RFC 4210) enrollment endpoint.
+`
+
+const pathConfigCmpHelpDesc = `
+This path configures the CMP endpoints, cmp and cmp/<label>, which let
+devices such as telecom equipment enroll for certificates and update their
+keys. Each label maps to the role its requests issue against; requests
+without a label use default_role.
+
+Requests are authenticated by their protection: either a MAC keyed with the
+shared secret configured for the role, or a signature by a certificate
+issued by this mount.
+`
@@ -3,8 +3,11 @@ package pki
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"strings"
 	"time"
 
+	"github.com/hashicorp/go-secure-stdlib/strutil"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/errutil"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -14,28 +17,122 @@ const latestCrlConfigVersion = 1
 
 // CRLConfig holds basic CRL configuration information
 type crlConfig struct {
-	Version                int    `json:"version"`
-	Expiry                 string `json:"expiry"`
-	Disable                bool   `json:"disable"`
-	OcspDisable            bool   `json:"ocsp_disable"`
-	AutoRebuild            bool   `json:"auto_rebuild"`
-	AutoRebuildGracePeriod string `json:"auto_rebuild_grace_period"`
-	OcspExpiry             string `json:"ocsp_expiry"`
-	EnableDelta            bool   `json:"enable_delta"`
-	DeltaRebuildInterval   string `json:"delta_rebuild_interval"`
+	Version                 int      `json:"version"`
+	Expiry                  string   `json:"expiry"`
+	Disable                 bool     `json:"disable"`
+	OcspDisable             bool     `json:"ocsp_disable"`
+	AutoRebuild             bool     `json:"auto_rebuild"`
+	AutoRebuildGracePeriod  string   `json:"auto_rebuild_grace_period"`
+	OcspExpiry              string   `json:"ocsp_expiry"`
+	EnableDelta             bool     `json:"enable_delta"`
+	DeltaRebuildInterval    string   `json:"delta_rebuild_interval"`
+	DeltaExpiry             string   `json:"delta_expiry"`
+	RetiredIssuerCRLExpiry  string   `json:"retired_issuer_crl_expiry"`
+	ReasonPartitions        []string `json:"reason_partitions"`
+	UnifiedRevocation       bool     `json:"unified_revocation"`
+	OcspUnified             bool     `json:"ocsp_unified"`
+	BackgroundRebuild       bool     `json:"background_rebuild"`
+	MaxCRLEntries           int      `json:"max_crl_entries"`
+	MaxCRLEntriesBehavior   string   `json:"max_crl_entries_behavior"`
+	AllowExpiredRevocation  bool     `json:"allow_expired_cert_revocation"`
+	ExpiredRevocationWindow string   `json:"expired_cert_revocation_window"`
+	CompressCRLs            bool     `json:"compress_crls"`
+	IDPURIs                 []string `json:"idp_uris"`
+	IDPOnlyUserCerts        bool     `json:"idp_only_contains_user_certs"`
+	IDPOnlyCACerts          bool     `json:"idp_only_contains_ca_certs"`
+	OcspPresign             bool     `json:"ocsp_presign"`
+	OcspNonce               bool     `json:"ocsp_nonce"`
+	OcspNonceMaxLength      int      `json:"ocsp_nonce_max_length"`
 }
 
+// crlIDPConfig holds the values of the issuingDistributionPoint extension
+// to add to CRLs, either mount-wide (from config/crl) or for a single
+// issuer.
+type crlIDPConfig struct {
+	URIs                  []string `json:"uris,omitempty"`
+	OnlyContainsUserCerts bool     `json:"only_contains_user_certs,omitempty"`
+	OnlyContainsCACerts   bool     `json:"only_contains_ca_certs,omitempty"`
+}
+
+// newCRLIDPConfig returns the given issuingDistributionPoint values, or nil
+// when none are set.
+func newCRLIDPConfig(uris []string, onlyUserCerts bool, onlyCACerts bool) *crlIDPConfig {
+	if len(uris) == 0 && !onlyUserCerts && !onlyCACerts {
+		return nil
+	}
+
+	return &crlIDPConfig{
+		URIs:                  uris,
+		OnlyContainsUserCerts: onlyUserCerts,
+		OnlyContainsCACerts:   onlyCACerts,
+	}
+}
+
+// validateCRLIDPConfig checks issuingDistributionPoint values given via the
+// API.
+func validateCRLIDPConfig(idp *crlIDPConfig) error {
+	if idp == nil {
+		return nil
+	}
+	if badURL := validateURLs(idp.URIs); badURL != "" {
+		return fmt.Errorf("invalid URL found in idp_uris: %s", badURL)
+	}
+	if idp.OnlyContainsUserCerts && idp.OnlyContainsCACerts {
+		return fmt.Errorf("idp_only_contains_user_certs and idp_only_contains_ca_certs are mutually exclusive")
+	}
+	return nil
+}
+
+// getCRLIDPConfig returns the issuingDistributionPoint values for CRLs
+// signed by the given issuer: its own, if set, or else the mount-wide ones.
+func (sc *storageContext) getCRLIDPConfig(crlInfo *crlConfig, issuerId issuerID) (*crlIDPConfig, error) {
+	if issuerId != legacyBundleShimID {
+		issuer, err := sc.fetchIssuerById(issuerId)
+		if err != nil {
+			return nil, err
+		}
+		if issuer.CRLIDP != nil {
+			return issuer.CRLIDP, nil
+		}
+	}
+
+	return newCRLIDPConfig(crlInfo.IDPURIs, crlInfo.IDPOnlyUserCerts, crlInfo.IDPOnlyCACerts), nil
+}
+
+// Values of max_crl_entries_behavior.
+const (
+	crlEntryLimitError    = "error"
+	crlEntryLimitTruncate = "truncate"
+)
+
 // Implicit default values for the config if it does not exist.
 var defaultCrlConfig = crlConfig{
-	Version:                latestCrlConfigVersion,
-	Expiry:                 "72h",
-	Disable:                false,
-	OcspDisable:            false,
-	OcspExpiry:             "12h",
-	AutoRebuild:            false,
-	AutoRebuildGracePeriod: "12h",
-	EnableDelta:            false,
-	DeltaRebuildInterval:   "15m",
+	Version:                 latestCrlConfigVersion,
+	Expiry:                  "72h",
+	Disable:                 false,
+	OcspDisable:             false,
+	OcspExpiry:              "12h",
+	AutoRebuild:             false,
+	AutoRebuildGracePeriod:  "12h",
+	EnableDelta:             false,
+	DeltaRebuildInterval:    "15m",
+	DeltaExpiry:             "",
+	RetiredIssuerCRLExpiry:  "",
+	ReasonPartitions:        nil,
+	UnifiedRevocation:       false,
+	OcspUnified:             false,
+	BackgroundRebuild:       false,
+	MaxCRLEntries:           0,
+	MaxCRLEntriesBehavior:   crlEntryLimitError,
+	AllowExpiredRevocation:  false,
+	ExpiredRevocationWindow: "",
+	CompressCRLs:            false,
+	IDPURIs:                 nil,
+	IDPOnlyUserCerts:        false,
+	IDPOnlyCACerts:          false,
+	OcspPresign:             false,
+	OcspNonce:               false,
+	OcspNonceMaxLength:      32,
 }
 
 func pathConfigCRL(b *backend) *framework.Path {
@@ -80,6 +177,106 @@ the NextUpdate field); defaults to 12 hours`,
 				Description: `The time between delta CRL rebuilds if a new revocation has occurred. Must be shorter than the CRL expiry. Defaults to 15m.`,
 				Default:     "15m",
 			},
+			"delta_expiry": {
+				Type: framework.TypeString,
+				Description: `The amount of time generated delta CRLs should be valid;
+defaults to the CRL expiry. Delta CRLs are rebuilt before they expire, even
+without new revocations, so this must be longer than delta_rebuild_interval.`,
+			},
+			"retired_issuer_crl_expiry": {
+				Type: framework.TypeString,
+				Description: `If set, when an issuer is deleted or loses its CRL signing
+usage, one final CRL is signed for it, valid for this amount of time. Empty
+(the default) disables this.`,
+			},
+			"reason_partitions": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `Revocation reasons (such as key_compromise) to build
+separate, reason-partitioned CRLs for, in addition to the complete CRL.`,
+			},
+			"unified_revocation": {
+				Type: framework.TypeBool,
+				Description: `If set to true, revocations are additionally recorded in
+storage replicated to all clusters, so that other clusters can answer for them.`,
+			},
+			"ocsp_presign": {
+				Type: framework.TypeBool,
+				Description: `If set to true, signed OCSP responses for recently
+issued and queried certificates are cached, and periodically re-signed before
+going stale, rather than signing a response per query. Not supported with
+ocsp_unified.`,
+			},
+			"ocsp_nonce": {
+				Type: framework.TypeBool,
+				Description: `If set to true, the OCSP responder echoes the nonce
+extension (RFC 8954) of requests in its responses.`,
+			},
+			"ocsp_nonce_max_length": {
+				Type: framework.TypeInt,
+				Description: `The longest nonce, in bytes, accepted in OCSP requests
+when ocsp_nonce is enabled; requests with longer nonces are rejected as
+malformed. Must be at least 16; defaults to 32.`,
+				Default: 32,
+			},
+			"ocsp_unified": {
+				Type: framework.TypeBool,
+				Description: `If set to true, the OCSP responder also answers for
+certificates revoked on other clusters. Requires unified_revocation.`,
+			},
+			"background_rebuild": {
+				Type: framework.TypeBool,
+				Description: `If set to true, a dedicated background worker
+rebuilds CRLs as soon as a rebuild is scheduled, and complete CRLs within
+auto_rebuild_grace_period of expiry, rather than on the next request. This
+keeps CRLs fresh on idle mounts even without auto_rebuild.`,
+			},
+			"max_crl_entries": {
+				Type: framework.TypeInt,
+				Description: `The maximum number of entries on any one CRL or
+delta CRL; zero (the default) means no limit. Builds warn once CRLs reach
+90% of this limit.`,
+			},
+			"max_crl_entries_behavior": {
+				Type: framework.TypeString,
+				Description: `What to do when a CRL would exceed max_crl_entries:
+"error" (the default) fails the build, while "truncate" builds the CRL with
+only the most recent revocations.`,
+				Default: crlEntryLimitError,
+			},
+			"allow_expired_cert_revocation": {
+				Type: framework.TypeBool,
+				Description: `If set to true, certificates which have already
+expired may still be revoked and placed on the CRL, rather than the
+revocation being refused with a warning.`,
+			},
+			"expired_cert_revocation_window": {
+				Type: framework.TypeString,
+				Description: `With allow_expired_cert_revocation, how long after
+expiry a certificate may still be revoked; empty (the default) means no
+limit.`,
+			},
+			"compress_crls": {
+				Type: framework.TypeBool,
+				Description: `If set to true, CRLs are stored gzip compressed, and
+served compressed to clients accepting gzip (when the Accept-Encoding and
+Content-Encoding headers are allowed on the mount).`,
+			},
+			"idp_uris": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `URIs to include as the distribution point of the
+issuingDistributionPoint extension on CRLs. See RFC 5280 Section 5.2.5.
+Issuers may override this and the other idp_ values.`,
+			},
+			"idp_only_contains_user_certs": {
+				Type: framework.TypeBool,
+				Description: `If set to true, the issuingDistributionPoint
+extension on CRLs asserts they contain only end-entity certificates.`,
+			},
+			"idp_only_contains_ca_certs": {
+				Type: framework.TypeBool,
+				Description: `If set to true, the issuingDistributionPoint
+extension on CRLs asserts they contain only CA certificates.`,
+			},
 		},
 
 		Operations: map[logical.Operation]framework.OperationHandler{
@@ -107,19 +304,50 @@ func (b *backend) pathCRLRead(ctx context.Context, req *logical.Request, _ *fram
 	}
 
 	return &logical.Response{
-		Data: map[string]interface{}{
-			"expiry":                    config.Expiry,
-			"disable":                   config.Disable,
-			"ocsp_disable":              config.OcspDisable,
-			"ocsp_expiry":               config.OcspExpiry,
-			"auto_rebuild":              config.AutoRebuild,
-			"auto_rebuild_grace_period": config.AutoRebuildGracePeriod,
-			"enable_delta":              config.EnableDelta,
-			"delta_rebuild_interval":    config.DeltaRebuildInterval,
-		},
+		Data: crlConfigResponseData(config),
 	}, nil
 }
 
+func crlConfigResponseData(config *crlConfig) map[string]interface{} {
+	reasonPartitions := config.ReasonPartitions
+	if reasonPartitions == nil {
+		reasonPartitions = []string{}
+	}
+
+	idpURIs := config.IDPURIs
+	if idpURIs == nil {
+		idpURIs = []string{}
+	}
+
+	return map[string]interface{}{
+		"expiry":                         config.Expiry,
+		"disable":                        config.Disable,
+		"ocsp_disable":                   config.OcspDisable,
+		"ocsp_expiry":                    config.OcspExpiry,
+		"auto_rebuild":                   config.AutoRebuild,
+		"auto_rebuild_grace_period":      config.AutoRebuildGracePeriod,
+		"enable_delta":                   config.EnableDelta,
+		"delta_rebuild_interval":         config.DeltaRebuildInterval,
+		"delta_expiry":                   config.DeltaExpiry,
+		"retired_issuer_crl_expiry":      config.RetiredIssuerCRLExpiry,
+		"reason_partitions":              reasonPartitions,
+		"unified_revocation":             config.UnifiedRevocation,
+		"ocsp_unified":                   config.OcspUnified,
+		"background_rebuild":             config.BackgroundRebuild,
+		"max_crl_entries":                config.MaxCRLEntries,
+		"max_crl_entries_behavior":       config.MaxCRLEntriesBehavior,
+		"allow_expired_cert_revocation":  config.AllowExpiredRevocation,
+		"expired_cert_revocation_window": config.ExpiredRevocationWindow,
+		"compress_crls":                  config.CompressCRLs,
+		"idp_uris":                       idpURIs,
+		"idp_only_contains_user_certs":   config.IDPOnlyUserCerts,
+		"idp_only_contains_ca_certs":     config.IDPOnlyCACerts,
+		"ocsp_presign":                   config.OcspPresign,
+		"ocsp_nonce":                     config.OcspNonce,
+		"ocsp_nonce_max_length":          config.OcspNonceMaxLength,
+	}
+}
+
 func (b *backend) pathCRLWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	sc := b.makeStorageContext(ctx, req.Storage)
 	config, err := sc.getRevocationConfig()
@@ -157,6 +385,18 @@ func (b *backend) pathCRLWrite(ctx context.Context, req *logical.Request, d *fra
 		config.OcspExpiry = expiry
 	}
 
+	if ocspNonceRaw, ok := d.GetOk("ocsp_nonce"); ok {
+		config.OcspNonce = ocspNonceRaw.(bool)
+	}
+
+	if ocspNonceMaxLengthRaw, ok := d.GetOk("ocsp_nonce_max_length"); ok {
+		ocspNonceMaxLength := ocspNonceMaxLengthRaw.(int)
+		if ocspNonceMaxLength < minimumOcspNonceMaxLength || ocspNonceMaxLength > maximumRequestSize {
+			return logical.ErrorResponse(fmt.Sprintf("ocsp_nonce_max_length must be between %d and %d got: %d", minimumOcspNonceMaxLength, maximumRequestSize, ocspNonceMaxLength)), nil
+		}
+		config.OcspNonceMaxLength = ocspNonceMaxLength
+	}
+
 	oldAutoRebuild := config.AutoRebuild
 	if autoRebuildRaw, ok := d.GetOk("auto_rebuild"); ok {
 		config.AutoRebuild = autoRebuildRaw.(bool)
@@ -182,11 +422,119 @@ func (b *backend) pathCRLWrite(ctx context.Context, req *logical.Request, d *fra
 		config.DeltaRebuildInterval = deltaRebuildInterval
 	}
 
+	if deltaExpiryRaw, ok := d.GetOk("delta_expiry"); ok {
+		deltaExpiry := deltaExpiryRaw.(string)
+		if deltaExpiry != "" {
+			if _, err := time.ParseDuration(deltaExpiry); err != nil {
+				return logical.ErrorResponse(fmt.Sprintf("given delta_expiry could not be decoded: %s", err)), nil
+			}
+		}
+		config.DeltaExpiry = deltaExpiry
+	}
+
+	if retiredExpiryRaw, ok := d.GetOk("retired_issuer_crl_expiry"); ok {
+		retiredExpiry := retiredExpiryRaw.(string)
+		if retiredExpiry != "" {
+			duration, err := time.ParseDuration(retiredExpiry)
+			if err != nil {
+				return logical.ErrorResponse(fmt.Sprintf("given retired_issuer_crl_expiry could not be decoded: %s", err)), nil
+			}
+			if duration <= 0 {
+				return logical.ErrorResponse(fmt.Sprintf("retired_issuer_crl_expiry must be greater than 0 got: %s", duration)), nil
+			}
+		}
+		config.RetiredIssuerCRLExpiry = retiredExpiry
+	}
+
+	oldReasonPartitions := config.ReasonPartitions
+	if reasonPartitionsRaw, ok := d.GetOk("reason_partitions"); ok {
+		var reasonPartitions []string
+		for _, name := range reasonPartitionsRaw.([]string) {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name != "" && !strutil.StrListContains(reasonPartitions, name) {
+				reasonPartitions = append(reasonPartitions, name)
+			}
+		}
+		if err := validateReasonPartitions(reasonPartitions); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid reason_partitions: %v", err)), nil
+		}
+		config.ReasonPartitions = reasonPartitions
+	}
+
+	if unifiedRevocationRaw, ok := d.GetOk("unified_revocation"); ok {
+		config.UnifiedRevocation = unifiedRevocationRaw.(bool)
+	}
+
+	if ocspUnifiedRaw, ok := d.GetOk("ocsp_unified"); ok {
+		config.OcspUnified = ocspUnifiedRaw.(bool)
+	}
+
+	if ocspPresignRaw, ok := d.GetOk("ocsp_presign"); ok {
+		config.OcspPresign = ocspPresignRaw.(bool)
+	}
+
+	if backgroundRebuildRaw, ok := d.GetOk("background_rebuild"); ok {
+		config.BackgroundRebuild = backgroundRebuildRaw.(bool)
+	}
+
+	if maxCRLEntriesRaw, ok := d.GetOk("max_crl_entries"); ok {
+		maxCRLEntries := maxCRLEntriesRaw.(int)
+		if maxCRLEntries < 0 {
+			return logical.ErrorResponse(fmt.Sprintf("max_crl_entries must be greater than or equal to 0 got: %d", maxCRLEntries)), nil
+		}
+		config.MaxCRLEntries = maxCRLEntries
+	}
+
+	if behaviorRaw, ok := d.GetOk("max_crl_entries_behavior"); ok {
+		behavior := strings.ToLower(strings.TrimSpace(behaviorRaw.(string)))
+		if behavior != crlEntryLimitError && behavior != crlEntryLimitTruncate {
+			return logical.ErrorResponse(fmt.Sprintf("max_crl_entries_behavior must be either %q or %q, got: %q", crlEntryLimitError, crlEntryLimitTruncate, behavior)), nil
+		}
+		config.MaxCRLEntriesBehavior = behavior
+	}
+
+	if allowExpiredRaw, ok := d.GetOk("allow_expired_cert_revocation"); ok {
+		config.AllowExpiredRevocation = allowExpiredRaw.(bool)
+	}
+
+	if expiredWindowRaw, ok := d.GetOk("expired_cert_revocation_window"); ok {
+		expiredWindow := expiredWindowRaw.(string)
+		if expiredWindow != "" {
+			duration, err := time.ParseDuration(expiredWindow)
+			if err != nil {
+				return logical.ErrorResponse(fmt.Sprintf("given expired_cert_revocation_window could not be decoded: %s", err)), nil
+			}
+			if duration <= 0 {
+				return logical.ErrorResponse(fmt.Sprintf("expired_cert_revocation_window must be greater than 0 got: %s", duration)), nil
+			}
+		}
+		config.ExpiredRevocationWindow = expiredWindow
+	}
+
+	if compressRaw, ok := d.GetOk("compress_crls"); ok {
+		config.CompressCRLs = compressRaw.(bool)
+	}
+
+	oldIDP := newCRLIDPConfig(config.IDPURIs, config.IDPOnlyUserCerts, config.IDPOnlyCACerts)
+	if idpURIsRaw, ok := d.GetOk("idp_uris"); ok {
+		config.IDPURIs = idpURIsRaw.([]string)
+	}
+	if onlyUserRaw, ok := d.GetOk("idp_only_contains_user_certs"); ok {
+		config.IDPOnlyUserCerts = onlyUserRaw.(bool)
+	}
+	if onlyCARaw, ok := d.GetOk("idp_only_contains_ca_certs"); ok {
+		config.IDPOnlyCACerts = onlyCARaw.(bool)
+	}
+	newIDP := newCRLIDPConfig(config.IDPURIs, config.IDPOnlyUserCerts, config.IDPOnlyCACerts)
+	if err := validateCRLIDPConfig(newIDP); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
 	expiry, _ := time.ParseDuration(config.Expiry)
-	if config.AutoRebuild {
+	if config.AutoRebuild || config.BackgroundRebuild {
 		gracePeriod, _ := time.ParseDuration(config.AutoRebuildGracePeriod)
 		if gracePeriod >= expiry {
-			return logical.ErrorResponse(fmt.Sprintf("CRL auto-rebuilding grace period (%v) must be strictly shorter than CRL expiry (%v) value when auto-rebuilding of CRLs is enabled", config.AutoRebuildGracePeriod, config.Expiry)), nil
+			return logical.ErrorResponse(fmt.Sprintf("CRL auto-rebuilding grace period (%v) must be strictly shorter than CRL expiry (%v) value when auto- or background rebuilding of CRLs is enabled", config.AutoRebuildGracePeriod, config.Expiry)), nil
 		}
 	}
 
@@ -197,10 +545,26 @@ func (b *backend) pathCRLWrite(ctx context.Context, req *logical.Request, d *fra
 		}
 	}
 
+	if config.EnableDelta && config.DeltaExpiry != "" {
+		deltaRebuildInterval, _ := time.ParseDuration(config.DeltaRebuildInterval)
+		deltaExpiry, _ := time.ParseDuration(config.DeltaExpiry)
+		if deltaExpiry <= deltaRebuildInterval || deltaExpiry > expiry {
+			return logical.ErrorResponse(fmt.Sprintf("delta CRL expiry (%v) must be strictly longer than the delta rebuild window (%v) and no longer than CRL expiry (%v) when delta CRLs are enabled", config.DeltaExpiry, config.DeltaRebuildInterval, config.Expiry)), nil
+		}
+	}
+
 	if config.EnableDelta && !config.AutoRebuild {
 		return logical.ErrorResponse(fmt.Sprintf("Delta CRLs cannot be enabled when auto rebuilding is disabled as the complete CRL is always regenerated!")), nil
 	}
 
+	if config.OcspUnified && !config.UnifiedRevocation {
+		return logical.ErrorResponse("ocsp_unified requires unified_revocation to be enabled"), nil
+	}
+
+	if config.OcspPresign && config.OcspUnified {
+		return logical.ErrorResponse("ocsp_presign is not supported with ocsp_unified"), nil
+	}
+
 	entry, err := logical.StorageEntryJSON("config/crl", config)
 	if err != nil {
 		return nil, err
@@ -212,10 +576,12 @@ func (b *backend) pathCRLWrite(ctx context.Context, req *logical.Request, d *fra
 
 	b.crlBuilder.markConfigDirty()
 	b.crlBuilder.reloadConfigIfRequired(sc)
+	b.ocspCache.flush()
 
-	if oldDisable != config.Disable || (oldAutoRebuild && !config.AutoRebuild) {
+	if oldDisable != config.Disable || (oldAutoRebuild && !config.AutoRebuild) || !strutil.EquivalentSlices(oldReasonPartitions, config.ReasonPartitions) || !reflect.DeepEqual(oldIDP, newIDP) {
 		// It wasn't disabled but now it is (or equivalently, we were set to
-		// auto-rebuild and we aren't now), so rotate the CRL.
+		// auto-rebuild and we aren't now), so rotate the CRL. Likewise
+		// when the CRLs' partitions or scope changed.
 		crlErr := b.crlBuilder.rebuild(ctx, b, req, true)
 		if crlErr != nil {
 			switch crlErr.(type) {
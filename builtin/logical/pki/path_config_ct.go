@@ -0,0 +1,237 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	ctConfigPath = "config/ct"
+
+	ctFailurePolicyDeny  = "deny"
+	ctFailurePolicyAllow = "allow"
+
+	defaultCTSubmissionTimeout = 10 * time.Second
+)
+
+type ctConfigEntry struct {
+	Enabled           bool          `json:"enabled"`
+	LogURLs           []string      `json:"log_urls"`
+	LogPublicKeys     []string      `json:"log_public_keys"`
+	MinSCTs           int           `json:"min_scts"`
+	FailurePolicy     string        `json:"failure_policy"`
+	SubmissionTimeout time.Duration `json:"submission_timeout"`
+}
+
+func pathConfigCT(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/ct",
+		Fields: map[string]*framework.FieldSchema{
+			"enabled": {
+				Type: framework.TypeBool,
+				Description: `Whether to submit leaf certificates to the
+configured Certificate Transparency logs, and embed the SCTs they return.`,
+			},
+			"log_urls": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `Base URLs of the RFC 6962 logs to submit
+precertificates to, such as https://ct.example.com/2024h1. Required when
+enabled.`,
+			},
+			"log_public_keys": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `Public keys of the logs, in the order of
+log_urls: the base64 of each log's DER SubjectPublicKeyInfo, as published in
+log lists. SCTs are verified against them. Required when enabled.`,
+			},
+			"min_scts": {
+				Type: framework.TypeInt,
+				Description: `The number of logs which must return an SCT for
+submission to succeed. Defaults to 1.`,
+			},
+			"failure_policy": {
+				Type: framework.TypeString,
+				Description: `What to do when fewer than min_scts logs return
+an SCT: "deny" (the default) fails the request; "allow" issues the
+certificate with whichever SCTs were returned, and a warning.`,
+				AllowedValues: []interface{}{ctFailurePolicyDeny, ctFailurePolicyAllow},
+			},
+			"submission_timeout": {
+				Type: framework.TypeDurationSecond,
+				Description: `How long to wait for each log to return an SCT.
+Defaults to 10 seconds.`,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathReadCTConfig,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathWriteCTConfig,
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathConfigCTHelpSyn,
+		HelpDescription: pathConfigCTHelpDesc,
+	}
+}
+
+func (sc *storageContext) getCTConfig() (*ctConfigEntry, error) {
+	entry, err := sc.Storage.Get(sc.Context, ctConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &ctConfigEntry{
+		MinSCTs:           1,
+		FailurePolicy:     ctFailurePolicyDeny,
+		SubmissionTimeout: defaultCTSubmissionTimeout,
+	}
+	if entry == nil {
+		return config, nil
+	}
+
+	if err := entry.DecodeJSON(config); err != nil {
+		return nil, fmt.Errorf("unable to decode Certificate Transparency configuration: %w", err)
+	}
+
+	return config, nil
+}
+
+func (sc *storageContext) setCTConfig(config *ctConfigEntry) error {
+	entry, err := logical.StorageEntryJSON(ctConfigPath, config)
+	if err != nil {
+		return err
+	}
+
+	return sc.Storage.Put(sc.Context, entry)
+}
+
+func (b *backend) pathReadCTConfig(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getCTConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	logURLs := config.LogURLs
+	if logURLs == nil {
+		logURLs = []string{}
+	}
+	logPublicKeys := config.LogPublicKeys
+	if logPublicKeys == nil {
+		logPublicKeys = []string{}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":            config.Enabled,
+			"log_urls":           logURLs,
+			"log_public_keys":    logPublicKeys,
+			"min_scts":           config.MinSCTs,
+			"failure_policy":     config.FailurePolicy,
+			"submission_timeout": int64(config.SubmissionTimeout.Seconds()),
+		},
+	}, nil
+}
+
+func (b *backend) pathWriteCTConfig(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getCTConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledRaw, ok := data.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+
+	if logURLsRaw, ok := data.GetOk("log_urls"); ok {
+		config.LogURLs = nil
+		for _, logURL := range logURLsRaw.([]string) {
+			logURL = strings.TrimSuffix(strings.TrimSpace(logURL), "/")
+			if !govalidator.IsURL(logURL) {
+				return logical.ErrorResponse(fmt.Sprintf("invalid URL given in log_urls: %s", logURL)), nil
+			}
+			config.LogURLs = append(config.LogURLs, logURL)
+		}
+	}
+
+	if keysRaw, ok := data.GetOk("log_public_keys"); ok {
+		config.LogPublicKeys = nil
+		for _, key := range keysRaw.([]string) {
+			key = strings.TrimSpace(key)
+			if _, err := parseCTLogPublicKey(key); err != nil {
+				return logical.ErrorResponse(fmt.Sprintf("invalid key given in log_public_keys: %v", err)), nil
+			}
+			config.LogPublicKeys = append(config.LogPublicKeys, key)
+		}
+	}
+
+	if minRaw, ok := data.GetOk("min_scts"); ok {
+		config.MinSCTs = minRaw.(int)
+		if config.MinSCTs < 1 {
+			return logical.ErrorResponse("min_scts must be at least 1"), nil
+		}
+	}
+
+	if policyRaw, ok := data.GetOk("failure_policy"); ok {
+		config.FailurePolicy = policyRaw.(string)
+		if config.FailurePolicy != ctFailurePolicyDeny && config.FailurePolicy != ctFailurePolicyAllow {
+			return logical.ErrorResponse(fmt.Sprintf("failure_policy must be %q or %q", ctFailurePolicyDeny, ctFailurePolicyAllow)), nil
+		}
+	}
+
+	if timeoutRaw, ok := data.GetOk("submission_timeout"); ok {
+		config.SubmissionTimeout = time.Duration(timeoutRaw.(int)) * time.Second
+		if config.SubmissionTimeout <= 0 {
+			return logical.ErrorResponse("submission_timeout must be positive"), nil
+		}
+	}
+
+	if config.Enabled {
+		if len(config.LogURLs) == 0 {
+			return logical.ErrorResponse("log_urls is required when Certificate Transparency is enabled"), nil
+		}
+		if len(config.LogPublicKeys) != len(config.LogURLs) {
+			return logical.ErrorResponse(fmt.Sprintf("log_public_keys must give the public key of each of the %d logs, in the order of log_urls", len(config.LogURLs))), nil
+		}
+		if config.MinSCTs > len(config.LogURLs) {
+			return logical.ErrorResponse(fmt.Sprintf("min_scts (%d) can not exceed the number of logs (%d)", config.MinSCTs, len(config.LogURLs))), nil
+		}
+	}
+
+	if err := sc.setCTConfig(config); err != nil {
+		return nil, err
+	}
+
+	return b.pathReadCTConfig(ctx, req, data)
+}
+
+const pathConfigCTHelpSyn = `
+Configure Certificate Transparency submission of issued certificates.
+`
+
+const pathConfigCTHelpDesc = `
+When enabled, every leaf certificate this mount issues or signs is first
+signed as an RFC 6962 precertificate, which is submitted to the configured
+logs; the signed certificate timestamps (SCTs) they return are embedded in
+the final certificate. Certificates of CAs (such as signed intermediates)
+aren't submitted. Each SCT is verified against the public key of its log,
+given in log_public_keys; SCTs which don't verify count as failed
+submissions.
+
+Requests fail when fewer than min_scts logs return an SCT, unless
+failure_policy is "allow", in which case the certificate is issued with
+whichever SCTs were returned and a warning.
+`
@@ -0,0 +1,216 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const estConfigPath = "config/est"
+
+type estConfigEntry struct {
+	Enabled         bool              `json:"enabled"`
+	DefaultRole     string            `json:"default_role"`
+	LabelToRole     map[string]string `json:"label_to_role"`
+	EnableBasicAuth bool              `json:"enable_basic_auth"`
+	EnableCertAuth  bool              `json:"enable_cert_auth"`
+}
+
+var defaultEstConfig = estConfigEntry{
+	Enabled:         false,
+	LabelToRole:     map[string]string{},
+	EnableBasicAuth: true,
+	EnableCertAuth:  false,
+}
+
+// roleForLabel returns the name of the role enrollments under the given
+// label (or, when empty, without a label) issue against.
+func (c *estConfigEntry) roleForLabel(label string) (string, error) {
+	if label == "" {
+		if c.DefaultRole == "" {
+			return "", fmt.Errorf("no default_role is configured for EST")
+		}
+		return c.DefaultRole, nil
+	}
+
+	role, ok := c.LabelToRole[label]
+	if !ok {
+		return "", fmt.Errorf("unknown EST label %q", label)
+	}
+	return role, nil
+}
+
+func pathConfigEst(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/est",
+		Fields: map[string]*framework.FieldSchema{
+			"enabled": {
+				Type:        framework.TypeBool,
+				Description: `Whether the EST (RFC 7030) endpoints are enabled.`,
+			},
+			"default_role": {
+				Type: framework.TypeString,
+				Description: `Role that enrollments without a label (under
+est/) issue against.`,
+			},
+			"label_to_role": {
+				Type: framework.TypeKVPairs,
+				Description: `Mapping of EST labels (est/<label>/) to the roles
+enrollments under them issue against.`,
+			},
+			"enable_basic_auth": {
+				Type: framework.TypeBool,
+				Description: `Whether clients may authenticate enrollments with
+HTTP Basic authentication, presenting an enrollment password (see
+enrollment/token) as the password.`,
+				Default: defaultEstConfig.EnableBasicAuth,
+			},
+			"enable_cert_auth": {
+				Type: framework.TypeBool,
+				Description: `Whether clients may authenticate initial enrollments
+with a TLS client certificate issued by this mount under the label's role,
+for client authentication and the same subject and subject alternative names
+as the CSR. Defaults to false. Re-enrollment always requires one.`,
+				Default: defaultEstConfig.EnableCertAuth,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathReadEstConfig,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathWriteEstConfig,
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathConfigEstHelpSyn,
+		HelpDescription: pathConfigEstHelpDesc,
+	}
+}
+
+func (sc *storageContext) getEstConfig() (*estConfigEntry, error) {
+	entry, err := sc.Storage.Get(sc.Context, estConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config := defaultEstConfig
+	config.LabelToRole = map[string]string{}
+	if entry == nil {
+		return &config, nil
+	}
+
+	if err := entry.DecodeJSON(&config); err != nil {
+		return nil, fmt.Errorf("unable to decode EST configuration: %w", err)
+	}
+	if config.LabelToRole == nil {
+		config.LabelToRole = map[string]string{}
+	}
+
+	return &config, nil
+}
+
+func (sc *storageContext) setEstConfig(config *estConfigEntry) error {
+	entry, err := logical.StorageEntryJSON(estConfigPath, config)
+	if err != nil {
+		return err
+	}
+
+	return sc.Storage.Put(sc.Context, entry)
+}
+
+func (b *backend) pathReadEstConfig(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getEstConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":           config.Enabled,
+			"default_role":      config.DefaultRole,
+			"label_to_role":     config.LabelToRole,
+			"enable_basic_auth": config.EnableBasicAuth,
+			"enable_cert_auth":  config.EnableCertAuth,
+		},
+	}, nil
+}
+
+func (b *backend) pathWriteEstConfig(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getEstConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledRaw, ok := data.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+	if roleRaw, ok := data.GetOk("default_role"); ok {
+		config.DefaultRole = roleRaw.(string)
+	}
+	if labelsRaw, ok := data.GetOk("label_to_role"); ok {
+		config.LabelToRole = labelsRaw.(map[string]string)
+	}
+	if basicRaw, ok := data.GetOk("enable_basic_auth"); ok {
+		config.EnableBasicAuth = basicRaw.(bool)
+	}
+	if certRaw, ok := data.GetOk("enable_cert_auth"); ok {
+		config.EnableCertAuth = certRaw.(bool)
+	}
+
+	roles := make(map[string]struct{}, len(config.LabelToRole)+1)
+	if config.DefaultRole != "" {
+		roles[config.DefaultRole] = struct{}{}
+	}
+	for label, role := range config.LabelToRole {
+		if !estLabelRegex.MatchString(label) {
+			return logical.ErrorResponse(fmt.Sprintf("invalid EST label %q: labels may only contain letters, digits, hyphens and underscores", label)), nil
+		}
+		if estOperations[label] {
+			return logical.ErrorResponse(fmt.Sprintf("invalid EST label %q: it is the name of an EST operation", label)), nil
+		}
+		roles[role] = struct{}{}
+	}
+	for roleName := range roles {
+		role, err := b.getRole(ctx, req.Storage, roleName)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return logical.ErrorResponse(fmt.Sprintf("unknown role: %s", roleName)), nil
+		}
+	}
+
+	if config.Enabled && !config.EnableBasicAuth && !config.EnableCertAuth {
+		return logical.ErrorResponse("at least one of enable_basic_auth or enable_cert_auth must be set when EST is enabled"), nil
+	}
+
+	if err := sc.setEstConfig(config); err != nil {
+		return nil, err
+	}
+
+	return b.pathReadEstConfig(ctx, req, data)
+}
+
+const pathConfigEstHelpSyn = `
+Configure the EST (RFC 7030) enrollment endpoints.
+`
+
+const pathConfigEstHelpDesc = `
+This path configures the EST endpoints under est/ and est/<label>/, which
+let devices such as network equipment fetch the CA certificates and enroll
+for certificates. Each label maps to the role its enrollments issue
+against; enrollments without a label use default_role.
+
+Clients authenticate either with HTTP Basic authentication, presenting an
+enrollment password minted with enrollment/token (bound to the same role),
+or with a TLS client certificate issued by this mount.
+`
@@ -0,0 +1,209 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	eventsConfigPath = "config/events"
+
+	// defaultEventExpiryWindow is the default expiry_window, in seconds.
+	defaultEventExpiryWindow = 7 * 24 * 60 * 60
+)
+
+type eventsConfigEntry struct {
+	Enabled      bool          `json:"enabled"`
+	WebhookURL   string        `json:"webhook_url"`
+	EventTypes   []string      `json:"event_types"`
+	ExpiryWindow time.Duration `json:"expiry_window"`
+	HMACKey      string        `json:"hmac_key,omitempty"`
+}
+
+// publishes reports whether events of the given type are to be published.
+// An empty list of event types publishes all of them.
+func (c *eventsConfigEntry) publishes(eventType string) bool {
+	if !c.Enabled || c.WebhookURL == "" {
+		return false
+	}
+	return len(c.EventTypes) == 0 || strutil.StrListContains(c.EventTypes, eventType)
+}
+
+func pathConfigEvents(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/events",
+		Fields: map[string]*framework.FieldSchema{
+			"enabled": {
+				Type:        framework.TypeBool,
+				Description: `Whether to publish events to the webhook.`,
+			},
+			"webhook_url": {
+				Type: framework.TypeString,
+				Description: `URL to POST events to, as JSON. Required when
+events are enabled.`,
+			},
+			"event_types": {
+				Type: framework.TypeCommaStringSlice,
+				Description: fmt.Sprintf(`Types of events to publish; one or more of %v.
+Defaults to all of them.`, strings.Join(allEventTypes, ", ")),
+			},
+			"expiry_window": {
+				Type: framework.TypeDurationSecond,
+				Description: `How long before a stored certificate expires
+its pki/expiring event is published. Defaults to 7 days; zero disables
+these events.`,
+				Default: defaultEventExpiryWindow,
+			},
+			"hmac_key": {
+				Type: framework.TypeString,
+				Description: `Secret with which to sign each event, as an
+HMAC-SHA256 of the request body in the X-Vault-PKI-Signature header. It is
+never returned; an empty string stops signing events.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Sensitive: true,
+				},
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathReadEventsConfig,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathWriteEventsConfig,
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathConfigEventsHelpSyn,
+		HelpDescription: pathConfigEventsHelpDesc,
+	}
+}
+
+func (sc *storageContext) getEventsConfig() (*eventsConfigEntry, error) {
+	entry, err := sc.Storage.Get(sc.Context, eventsConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &eventsConfigEntry{
+		ExpiryWindow: time.Duration(defaultEventExpiryWindow) * time.Second,
+	}
+	if entry == nil {
+		return config, nil
+	}
+
+	if err := entry.DecodeJSON(config); err != nil {
+		return nil, fmt.Errorf("unable to decode events configuration: %w", err)
+	}
+
+	return config, nil
+}
+
+func (sc *storageContext) setEventsConfig(config *eventsConfigEntry) error {
+	entry, err := logical.StorageEntryJSON(eventsConfigPath, config)
+	if err != nil {
+		return err
+	}
+
+	return sc.Storage.Put(sc.Context, entry)
+}
+
+func (b *backend) pathReadEventsConfig(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getEventsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	eventTypes := config.EventTypes
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":       config.Enabled,
+			"webhook_url":   config.WebhookURL,
+			"event_types":   eventTypes,
+			"expiry_window": int64(config.ExpiryWindow.Seconds()),
+			"hmac_key_set":  config.HMACKey != "",
+		},
+	}, nil
+}
+
+func (b *backend) pathWriteEventsConfig(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getEventsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledRaw, ok := data.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+
+	if webhookRaw, ok := data.GetOk("webhook_url"); ok {
+		config.WebhookURL = webhookRaw.(string)
+		if config.WebhookURL != "" && !govalidator.IsURL(config.WebhookURL) {
+			return logical.ErrorResponse(fmt.Sprintf("invalid URL given for webhook_url: %s", config.WebhookURL)), nil
+		}
+	}
+
+	if typesRaw, ok := data.GetOk("event_types"); ok {
+		config.EventTypes = typesRaw.([]string)
+		for _, eventType := range config.EventTypes {
+			if !strutil.StrListContains(allEventTypes, eventType) {
+				return logical.ErrorResponse(fmt.Sprintf("unknown event type %q; must be one of %v", eventType, strings.Join(allEventTypes, ", "))), nil
+			}
+		}
+	}
+
+	if windowRaw, ok := data.GetOk("expiry_window"); ok {
+		config.ExpiryWindow = time.Duration(windowRaw.(int)) * time.Second
+		if config.ExpiryWindow < 0 {
+			return logical.ErrorResponse("expiry_window may not be negative"), nil
+		}
+	}
+
+	if hmacKeyRaw, ok := data.GetOk("hmac_key"); ok {
+		config.HMACKey = hmacKeyRaw.(string)
+	}
+
+	if config.Enabled && config.WebhookURL == "" {
+		return logical.ErrorResponse("webhook_url is required when events are enabled"), nil
+	}
+
+	if err := sc.setEventsConfig(config); err != nil {
+		return nil, err
+	}
+
+	return b.pathReadEventsConfig(ctx, req, data)
+}
+
+const pathConfigEventsHelpSyn = `
+Configure publishing of revocation and CRL events.
+`
+
+const pathConfigEventsHelpDesc = `
+This path configures a webhook which this mount POSTs structured events
+to, as JSON, whenever a certificate is issued (pki/issue), signed
+(pki/sign) or revoked (pki/revoke), comes within expiry_window of expiring
+(pki/expiring), or a CRL is rebuilt (pki/crl-rebuild). This lets downstream
+systems, such as load balancers or a SIEM, react to certificate lifecycle
+changes without polling the CRLs or scraping the audit log.
+
+Events are delivered asynchronously and on a best effort basis: failed
+deliveries are retried a few times before the event is dropped. With
+hmac_key set, each event is signed so that the webhook can verify it came
+from this mount.
+`
@@ -0,0 +1,175 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	expiryNotificationsConfigPath = "config/expiry-notifications"
+
+	// defaultExpiryNotificationWindow is the default expiry_window, in
+	// seconds.
+	defaultExpiryNotificationWindow = 30 * 24 * 60 * 60
+)
+
+type expiryNotificationsConfigEntry struct {
+	Enabled      bool          `json:"enabled"`
+	ExpiryWindow time.Duration `json:"expiry_window"`
+	WebhookURL   string        `json:"webhook_url"`
+}
+
+func pathConfigExpiryNotifications(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/expiry-notifications",
+		Fields: map[string]*framework.FieldSchema{
+			"enabled": {
+				Type:        framework.TypeBool,
+				Description: `Whether to scan for certificates nearing expiry.`,
+			},
+			"expiry_window": {
+				Type: framework.TypeDurationSecond,
+				Description: `How long before stored certificates expire
+they're notified of. Defaults to 30 days.`,
+				Default: defaultExpiryNotificationWindow,
+			},
+			"webhook_url": {
+				Type: framework.TypeString,
+				Description: `Optional URL to POST notifications to, as JSON,
+in addition to the config/events webhook.`,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathReadExpiryNotificationsConfig,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathWriteExpiryNotificationsConfig,
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathConfigExpiryNotificationsHelpSyn,
+		HelpDescription: pathConfigExpiryNotificationsHelpDesc,
+	}
+}
+
+func (sc *storageContext) getExpiryNotificationsConfig() (*expiryNotificationsConfigEntry, error) {
+	entry, err := sc.Storage.Get(sc.Context, expiryNotificationsConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &expiryNotificationsConfigEntry{
+		ExpiryWindow: time.Duration(defaultExpiryNotificationWindow) * time.Second,
+	}
+	if entry == nil {
+		return config, nil
+	}
+
+	if err := entry.DecodeJSON(config); err != nil {
+		return nil, fmt.Errorf("unable to decode expiry notifications configuration: %w", err)
+	}
+
+	return config, nil
+}
+
+func (sc *storageContext) setExpiryNotificationsConfig(config *expiryNotificationsConfigEntry) error {
+	entry, err := logical.StorageEntryJSON(expiryNotificationsConfigPath, config)
+	if err != nil {
+		return err
+	}
+
+	return sc.Storage.Put(sc.Context, entry)
+}
+
+func (b *backend) pathReadExpiryNotificationsConfig(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getExpiryNotificationsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := sc.getExpiryNotificationScanState()
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]interface{}{
+		"enabled":       config.Enabled,
+		"expiry_window": int64(config.ExpiryWindow.Seconds()),
+		"webhook_url":   config.WebhookURL,
+		"last_scan":     "",
+		"scanned_until": "",
+	}
+	if !state.LastScan.IsZero() {
+		data["last_scan"] = state.LastScan.Format(time.RFC3339)
+	}
+	if !state.ScannedUntil.IsZero() {
+		data["scanned_until"] = state.ScannedUntil.Format(time.RFC3339)
+	}
+
+	return &logical.Response{Data: data}, nil
+}
+
+func (b *backend) pathWriteExpiryNotificationsConfig(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getExpiryNotificationsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledRaw, ok := data.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+
+	if windowRaw, ok := data.GetOk("expiry_window"); ok {
+		config.ExpiryWindow = time.Duration(windowRaw.(int)) * time.Second
+		if config.ExpiryWindow <= 0 {
+			return logical.ErrorResponse("expiry_window must be positive"), nil
+		}
+	}
+
+	if webhookRaw, ok := data.GetOk("webhook_url"); ok {
+		config.WebhookURL = webhookRaw.(string)
+		if config.WebhookURL != "" && !govalidator.IsURL(config.WebhookURL) {
+			return logical.ErrorResponse(fmt.Sprintf("invalid URL given for webhook_url: %s", config.WebhookURL)), nil
+		}
+	}
+
+	if err := sc.setExpiryNotificationsConfig(config); err != nil {
+		return nil, err
+	}
+
+	return b.pathReadExpiryNotificationsConfig(ctx, req, data)
+}
+
+const pathConfigExpiryNotificationsHelpSyn = `
+Configure notifications of certificates nearing expiry.
+`
+
+const pathConfigExpiryNotificationsHelpDesc = `
+This path configures a periodic scan of the mount's stored certificates,
+notifying of those coming within expiry_window of expiring so that their
+owners get a nudge to renew them ahead of time.
+
+Certificates are grouped by role and common name: each group gets a single
+notification listing its certificates, which is logged as a warning,
+published as a pki/expiry-notification event to the config/events webhook
+(when events of that type are enabled), and POSTed to webhook_url, if set.
+Revoked certificates and certificates which were already renewed through
+the renew endpoint aren't notified of, nor are those issued by roles with
+no_store set.
+
+The scan walks the certificate metadata store's expiry index
+incrementally: each certificate is notified of once, when it comes within
+the window, and large backlogs are processed a batch at a time.
+`
@@ -0,0 +1,217 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const storageMountConfig = "config/mount"
+
+type mountConfigEntry struct {
+	CAOnly               bool          `json:"ca_only"`
+	IssuancePolicy       string        `json:"issuance_policy"`
+	SerialNumberBits     int           `json:"serial_number_bits,omitempty"`
+	SerialNumberPrefix   string        `json:"serial_number_prefix,omitempty"`
+	MaxNotBeforeDuration time.Duration `json:"max_not_before_duration,omitempty"`
+	LeafNotAfterBehavior string        `json:"leaf_not_after_behavior,omitempty"`
+}
+
+func pathConfigMount(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/mount",
+		Fields: map[string]*framework.FieldSchema{
+			"ca_only": {
+				Type: framework.TypeBool,
+				Description: `Whether this mount only anchors other CAs. When
+set, leaf issuance and signing (issue, sign, and sign-verbatim, including
+their issuer-scoped variants) is refused; signing intermediates and
+self-issued certificates, CRLs, and OCSP remain available.`,
+				Default: false,
+			},
+			"issuance_policy": {
+				Type: framework.TypeString,
+				Description: `A CEL expression every leaf certificate issued or
+signed by this mount must satisfy, in addition to its role's
+issuance_policy. See the role's issuance_policy for the expression's
+inputs and result.`,
+			},
+			"serial_number_bits": {
+				Type: framework.TypeInt,
+				Description: `The number of random bits in the serial numbers
+of certificates issued by this mount, at least 64. Zero (the default) uses
+159, or with a serial_number_prefix, as many whole bytes as fit in the 20
+octets serial numbers are limited to. Issuers may override this.`,
+			},
+			"serial_number_prefix": {
+				Type: framework.TypeString,
+				Description: `Hex-encoded bytes (optionally colon-separated)
+to start the serial numbers of certificates issued by this mount with,
+ahead of the random bits; when set, serial_number_bits must be a multiple
+of 8. Issuers may override this.`,
+			},
+			"max_not_before_duration": {
+				Type: framework.TypeDurationSecond,
+				Description: `The furthest leaf certificates issued or signed
+by this mount may be backdated, whether by a role's not_before_duration or
+a request's not_before. Roles may not be written with a longer
+not_before_duration, and those written before this was set are held to it
+at issuance. Zero (the default) leaves backdating uncapped.`,
+			},
+			"leaf_not_after_behavior": {
+				Type: framework.TypeString,
+				Description: `What happens when a leaf certificate's requested
+NotAfter is beyond that of its issuer: "err" to refuse it; "truncate" to
+truncate it to that of the issuer; or "permit" to allow it, with a warning.
+When set, overrides each issuer's own leaf_not_after_behavior; when empty
+(the default), the issuers' apply.`,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathReadMountConfig,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathWriteMountConfig,
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathConfigMountHelpSyn,
+		HelpDescription: pathConfigMountHelpDesc,
+	}
+}
+
+func (sc *storageContext) getMountConfig() (*mountConfigEntry, error) {
+	entry, err := sc.Storage.Get(sc.Context, storageMountConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &mountConfigEntry{}
+	if entry == nil {
+		return config, nil
+	}
+
+	if err := entry.DecodeJSON(config); err != nil {
+		return nil, fmt.Errorf("unable to decode mount configuration: %w", err)
+	}
+
+	return config, nil
+}
+
+func (sc *storageContext) setMountConfig(config *mountConfigEntry) error {
+	entry, err := logical.StorageEntryJSON(storageMountConfig, config)
+	if err != nil {
+		return err
+	}
+
+	return sc.Storage.Put(sc.Context, entry)
+}
+
+func (b *backend) pathReadMountConfig(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getMountConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"ca_only":                 config.CAOnly,
+			"issuance_policy":         config.IssuancePolicy,
+			"serial_number_bits":      config.SerialNumberBits,
+			"serial_number_prefix":    config.SerialNumberPrefix,
+			"max_not_before_duration": int64(config.MaxNotBeforeDuration.Seconds()),
+			"leaf_not_after_behavior": config.LeafNotAfterBehavior,
+		},
+	}, nil
+}
+
+func (b *backend) pathWriteMountConfig(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getMountConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if caOnlyRaw, ok := data.GetOk("ca_only"); ok {
+		config.CAOnly = caOnlyRaw.(bool)
+	}
+	if policyRaw, ok := data.GetOk("issuance_policy"); ok {
+		config.IssuancePolicy = policyRaw.(string)
+		if config.IssuancePolicy != "" {
+			if _, err := compileIssuancePolicy(config.IssuancePolicy); err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+		}
+	}
+
+	if bitsRaw, ok := data.GetOk("serial_number_bits"); ok {
+		config.SerialNumberBits = bitsRaw.(int)
+	}
+	if prefixRaw, ok := data.GetOk("serial_number_prefix"); ok {
+		config.SerialNumberPrefix = prefixRaw.(string)
+	}
+	config.SerialNumberPrefix, err = validateSerialNumberConfig(config.SerialNumberPrefix, config.SerialNumberBits)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if durationRaw, ok := data.GetOk("max_not_before_duration"); ok {
+		config.MaxNotBeforeDuration = time.Duration(durationRaw.(int)) * time.Second
+		if config.MaxNotBeforeDuration < 0 {
+			return logical.ErrorResponse("max_not_before_duration may not be negative"), nil
+		}
+	}
+
+	if behaviorRaw, ok := data.GetOk("leaf_not_after_behavior"); ok {
+		config.LeafNotAfterBehavior = behaviorRaw.(string)
+		if config.LeafNotAfterBehavior != "" {
+			if _, err := parseLeafNotAfterBehavior(config.LeafNotAfterBehavior); err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+		}
+	}
+
+	if err := sc.setMountConfig(config); err != nil {
+		return nil, err
+	}
+
+	return b.pathReadMountConfig(ctx, req, data)
+}
+
+const pathConfigMountHelpSyn = `
+Read and set mount-wide behavior of this PKI mount.
+`
+
+const pathConfigMountHelpDesc = `
+This path controls mount-wide behavior.
+
+Setting "ca_only" restricts the mount to anchoring subordinate CAs, as is
+typical of an offline root: certificates may only be signed via the
+/root/sign-intermediate and /root/sign-self-issued paths (and their issuer
+equivalents), while CRLs and OCSP continue to be served. Requests to issue or
+sign leaf certificates are refused.
+
+Setting "issuance_policy" checks every leaf certificate against a CEL
+expression before it is issued or signed, in addition to the role's own
+issuance_policy.
+
+Setting "serial_number_bits" and "serial_number_prefix" controls how serial
+numbers are generated: the number of random bits (at least 64, as the
+CA/Browser Forum Baseline Requirements demand) and fixed bytes to prefix
+them with. Issuers may override either.
+
+Setting "max_not_before_duration" caps how far leaf certificates may be
+backdated, through roles' not_before_duration or requests' not_before.
+
+Setting "leaf_not_after_behavior" decides, in place of each issuer's own
+setting, what happens when a leaf certificate would outlive its issuer.
+`
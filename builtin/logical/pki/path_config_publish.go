@@ -0,0 +1,313 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const publishConfigPath = "config/publish"
+
+type publishConfigEntry struct {
+	Enabled bool   `json:"enabled"`
+	Type    string `json:"type"`
+	URL     string `json:"url"`
+	Bucket  string `json:"bucket"`
+	Prefix  string `json:"prefix"`
+
+	Endpoint    string `json:"endpoint"`
+	Region      string `json:"region"`
+	AccessKey   string `json:"access_key"`
+	SecretKey   string `json:"secret_key"`
+	Credentials string `json:"credentials"`
+	AccountName string `json:"account_name"`
+	AccountKey  string `json:"account_key"`
+}
+
+// objectName returns the name an object is published under.
+func (c *publishConfigEntry) objectName(name string) string {
+	return c.Prefix + name
+}
+
+// validate checks that the settings the target type requires are present.
+func (c *publishConfigEntry) validate() error {
+	if c.Type == "" {
+		if c.Enabled {
+			return fmt.Errorf("type is required when publishing is enabled")
+		}
+		return nil
+	}
+
+	switch c.Type {
+	case publishTargetHTTP:
+		if c.URL == "" && c.Enabled {
+			return fmt.Errorf("url is required for the %v target", c.Type)
+		}
+		if c.URL != "" && !govalidator.IsURL(c.URL) {
+			return fmt.Errorf("invalid URL given for url: %s", c.URL)
+		}
+	case publishTargetS3, publishTargetGCS, publishTargetAzure:
+		if c.Bucket == "" && c.Enabled {
+			return fmt.Errorf("bucket is required for the %v target", c.Type)
+		}
+		if c.Type == publishTargetS3 && c.Region == "" && c.Enabled {
+			return fmt.Errorf("region is required for the %v target", c.Type)
+		}
+		if c.Type == publishTargetAzure && (c.AccountName == "" || c.AccountKey == "") && c.Enabled {
+			return fmt.Errorf("account_name and account_key are required for the %v target", c.Type)
+		}
+		if c.Endpoint != "" && !govalidator.IsURL(c.Endpoint) {
+			return fmt.Errorf("invalid URL given for endpoint: %s", c.Endpoint)
+		}
+	default:
+		return fmt.Errorf("unknown type %q; must be one of %v", c.Type, strings.Join(allPublishTargets, ", "))
+	}
+
+	return nil
+}
+
+func pathConfigPublish(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/publish",
+		Fields: map[string]*framework.FieldSchema{
+			"enabled": {
+				Type: framework.TypeBool,
+				Description: `Whether to publish CRLs and issuer certificates
+whenever CRLs are rebuilt.`,
+			},
+			"type": {
+				Type: framework.TypeString,
+				Description: fmt.Sprintf(`Type of target to publish to; one of %v.`,
+					strings.Join(allPublishTargets, ", ")),
+			},
+			"url": {
+				Type: framework.TypeString,
+				Description: `For the http target, the URL objects are PUT
+under, by name.`,
+			},
+			"bucket": {
+				Type: framework.TypeString,
+				Description: `For the s3 and gcs targets, the bucket objects
+are written to; for the azure target, the container.`,
+			},
+			"prefix": {
+				Type: framework.TypeString,
+				Description: `Prefix of the names of published objects, such
+as "pki/".`,
+			},
+			"endpoint": {
+				Type: framework.TypeString,
+				Description: `For the s3, gcs and azure targets, a custom
+service endpoint, such as that of an S3-compatible store. Defaults to the
+provider's own.`,
+			},
+			"region": {
+				Type:        framework.TypeString,
+				Description: `For the s3 target, the bucket's region.`,
+			},
+			"access_key": {
+				Type: framework.TypeString,
+				Description: `For the s3 target, the access key to
+authenticate with. Defaults to the AWS credential chain of the Vault
+server.`,
+			},
+			"secret_key": {
+				Type:        framework.TypeString,
+				Description: `For the s3 target, the secret key to authenticate with.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Sensitive: true,
+				},
+			},
+			"credentials": {
+				Type: framework.TypeString,
+				Description: `For the gcs target, the JSON service account
+credentials to authenticate with. Defaults to the application default
+credentials of the Vault server.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Sensitive: true,
+				},
+			},
+			"account_name": {
+				Type:        framework.TypeString,
+				Description: `For the azure target, the storage account name.`,
+			},
+			"account_key": {
+				Type:        framework.TypeString,
+				Description: `For the azure target, the storage account key.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Sensitive: true,
+				},
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathReadPublishConfig,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathWritePublishConfig,
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathConfigPublishHelpSyn,
+		HelpDescription: pathConfigPublishHelpDesc,
+	}
+}
+
+func pathPublishStatus(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "publish/status",
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathReadPublishStatus,
+			},
+		},
+
+		HelpSynopsis:    pathPublishStatusHelpSyn,
+		HelpDescription: pathPublishStatusHelpDesc,
+	}
+}
+
+func (sc *storageContext) getPublishConfig() (*publishConfigEntry, error) {
+	entry, err := sc.Storage.Get(sc.Context, publishConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &publishConfigEntry{}
+	if entry == nil {
+		return config, nil
+	}
+
+	if err := entry.DecodeJSON(config); err != nil {
+		return nil, fmt.Errorf("unable to decode publish configuration: %w", err)
+	}
+
+	return config, nil
+}
+
+func (sc *storageContext) setPublishConfig(config *publishConfigEntry) error {
+	entry, err := logical.StorageEntryJSON(publishConfigPath, config)
+	if err != nil {
+		return err
+	}
+
+	return sc.Storage.Put(sc.Context, entry)
+}
+
+func (b *backend) pathReadPublishConfig(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getPublishConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// The secret_key, credentials and account_key are never returned.
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":      config.Enabled,
+			"type":         config.Type,
+			"url":          config.URL,
+			"bucket":       config.Bucket,
+			"prefix":       config.Prefix,
+			"endpoint":     config.Endpoint,
+			"region":       config.Region,
+			"access_key":   config.AccessKey,
+			"account_name": config.AccountName,
+		},
+	}, nil
+}
+
+func (b *backend) pathWritePublishConfig(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getPublishConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledRaw, ok := data.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+
+	for name, value := range map[string]*string{
+		"type":         &config.Type,
+		"url":          &config.URL,
+		"bucket":       &config.Bucket,
+		"prefix":       &config.Prefix,
+		"endpoint":     &config.Endpoint,
+		"region":       &config.Region,
+		"access_key":   &config.AccessKey,
+		"secret_key":   &config.SecretKey,
+		"credentials":  &config.Credentials,
+		"account_name": &config.AccountName,
+		"account_key":  &config.AccountKey,
+	} {
+		if raw, ok := data.GetOk(name); ok {
+			*value = raw.(string)
+		}
+	}
+
+	if err := config.validate(); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if err := sc.setPublishConfig(config); err != nil {
+		return nil, err
+	}
+
+	// Publish what's there presently, rather than waiting for the next
+	// rebuild of the CRLs.
+	if config.Enabled && !b.useLegacyBundleCaStorage() {
+		issuers, err := sc.listIssuers()
+		if err != nil {
+			return nil, err
+		}
+		b.publishIssuerArtifacts(sc, issuers, false)
+	}
+
+	return b.pathReadPublishConfig(ctx, req, data)
+}
+
+func (b *backend) pathReadPublishStatus(_ context.Context, _ *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	return &logical.Response{
+		Data: b.crlPublisher.statusResponseData(),
+	}, nil
+}
+
+const pathConfigPublishHelpSyn = `
+Configure publishing of CRLs and issuer certificates to external storage.
+`
+
+const pathConfigPublishHelpDesc = `
+This path configures a target which this mount uploads its CRLs and issuer
+certificates to whenever its CRLs are rebuilt: an S3, GCS or Azure bucket,
+or an HTTP server accepting PUTs. CDP and AIA URLs (see config/urls) may
+then point at a CDN in front of the target, rather than at Vault.
+
+For each issuer, <issuer_id>.crt (its DER certificate), <issuer_id>.crl (its
+complete CRL) and, with delta CRLs enabled, <issuer_id>-delta.crl are
+published, each prefixed by the configured prefix.
+
+Objects are uploaded asynchronously: failed uploads are retried a few times,
+and the outcome of each object's last upload is reported by publish/status.
+Enabling publishing uploads the present CRLs and certificates right away.
+`
+
+const pathPublishStatusHelpSyn = `
+Report the outcome of the last upload of each published object.
+`
+
+const pathPublishStatusHelpDesc = `
+This path reports, for each object this node has published to the target
+configured at config/publish, when it was last uploaded, when that last
+succeeded, and the error of the last upload, if it failed. Status is kept in
+memory by the node uploading, and so reset when Vault restarts.
+`
@@ -0,0 +1,245 @@
+package pki
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const scepConfigPath = "config/scep"
+
+// scepConfigEntry is the SCEP configuration. Only hashes of the static
+// challenges are stored, keyed by role name.
+type scepConfigEntry struct {
+	Enabled                bool              `json:"enabled"`
+	DefaultRole            string            `json:"default_role"`
+	LabelToRole            map[string]string `json:"label_to_role"`
+	StaticChallengeHashes  map[string][]byte `json:"static_challenge_hashes"`
+	AllowDynamicChallenges bool              `json:"allow_dynamic_challenges"`
+}
+
+var defaultScepConfig = scepConfigEntry{
+	Enabled:                false,
+	LabelToRole:            map[string]string{},
+	StaticChallengeHashes:  map[string][]byte{},
+	AllowDynamicChallenges: true,
+}
+
+// roleForLabel returns the name of the role enrollments under the given
+// label (or, when empty, without a label) issue against.
+func (c *scepConfigEntry) roleForLabel(label string) (string, error) {
+	if label == "" {
+		if c.DefaultRole == "" {
+			return "", fmt.Errorf("no default_role is configured for SCEP")
+		}
+		return c.DefaultRole, nil
+	}
+
+	role, ok := c.LabelToRole[label]
+	if !ok {
+		return "", fmt.Errorf("unknown SCEP label %q", label)
+	}
+	return role, nil
+}
+
+// matchesStaticChallenge reports whether the challenge is the static
+// challenge of the given role.
+func (c *scepConfigEntry) matchesStaticChallenge(roleName string, challenge string) bool {
+	hash, ok := c.StaticChallengeHashes[roleName]
+	if !ok || challenge == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare(hash, hashEnrollmentSecret(challenge)) == 1
+}
+
+func pathConfigScep(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/scep",
+		Fields: map[string]*framework.FieldSchema{
+			"enabled": {
+				Type:        framework.TypeBool,
+				Description: `Whether the SCEP endpoints are enabled.`,
+			},
+			"default_role": {
+				Type: framework.TypeString,
+				Description: `Role that enrollments without a label (under
+scep/pkiclient.exe) issue against.`,
+			},
+			"label_to_role": {
+				Type: framework.TypeKVPairs,
+				Description: `Mapping of SCEP labels (scep/<label>/pkiclient.exe)
+to the roles enrollments under them issue against.`,
+			},
+			"static_challenges": {
+				Type: framework.TypeKVPairs,
+				Description: `Mapping of role names to the static challenge
+password devices enrolling against that role may present. Replaces all
+previously configured static challenges; they can't be read back.`,
+			},
+			"allow_dynamic_challenges": {
+				Type: framework.TypeBool,
+				Description: `Whether devices may present a single-use challenge
+password minted with scep/challenge (or enrollment/token), bound to the
+role they enroll against.`,
+				Default: defaultScepConfig.AllowDynamicChallenges,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathReadScepConfig,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathWriteScepConfig,
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathConfigScepHelpSyn,
+		HelpDescription: pathConfigScepHelpDesc,
+	}
+}
+
+func (sc *storageContext) getScepConfig() (*scepConfigEntry, error) {
+	entry, err := sc.Storage.Get(sc.Context, scepConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config := defaultScepConfig
+	config.LabelToRole = map[string]string{}
+	config.StaticChallengeHashes = map[string][]byte{}
+	if entry == nil {
+		return &config, nil
+	}
+
+	if err := entry.DecodeJSON(&config); err != nil {
+		return nil, fmt.Errorf("unable to decode SCEP configuration: %w", err)
+	}
+	if config.LabelToRole == nil {
+		config.LabelToRole = map[string]string{}
+	}
+	if config.StaticChallengeHashes == nil {
+		config.StaticChallengeHashes = map[string][]byte{}
+	}
+
+	return &config, nil
+}
+
+func (sc *storageContext) setScepConfig(config *scepConfigEntry) error {
+	entry, err := logical.StorageEntryJSON(scepConfigPath, config)
+	if err != nil {
+		return err
+	}
+
+	return sc.Storage.Put(sc.Context, entry)
+}
+
+func (b *backend) pathReadScepConfig(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getScepConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	challengeRoles := make([]string, 0, len(config.StaticChallengeHashes))
+	for roleName := range config.StaticChallengeHashes {
+		challengeRoles = append(challengeRoles, roleName)
+	}
+	sort.Strings(challengeRoles)
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":                  config.Enabled,
+			"default_role":             config.DefaultRole,
+			"label_to_role":            config.LabelToRole,
+			"static_challenge_roles":   challengeRoles,
+			"allow_dynamic_challenges": config.AllowDynamicChallenges,
+		},
+	}, nil
+}
+
+func (b *backend) pathWriteScepConfig(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getScepConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledRaw, ok := data.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+	if roleRaw, ok := data.GetOk("default_role"); ok {
+		config.DefaultRole = roleRaw.(string)
+	}
+	if labelsRaw, ok := data.GetOk("label_to_role"); ok {
+		config.LabelToRole = labelsRaw.(map[string]string)
+	}
+	if challengesRaw, ok := data.GetOk("static_challenges"); ok {
+		config.StaticChallengeHashes = map[string][]byte{}
+		for roleName, challenge := range challengesRaw.(map[string]string) {
+			if challenge == "" {
+				return logical.ErrorResponse(fmt.Sprintf("the static challenge of role %s must not be empty", roleName)), nil
+			}
+			config.StaticChallengeHashes[roleName] = hashEnrollmentSecret(challenge)
+		}
+	}
+	if dynamicRaw, ok := data.GetOk("allow_dynamic_challenges"); ok {
+		config.AllowDynamicChallenges = dynamicRaw.(bool)
+	}
+
+	roles := make(map[string]struct{}, len(config.LabelToRole)+len(config.StaticChallengeHashes)+1)
+	if config.DefaultRole != "" {
+		roles[config.DefaultRole] = struct{}{}
+	}
+	for label, role := range config.LabelToRole {
+		if !estLabelRegex.MatchString(label) {
+			return logical.ErrorResponse(fmt.Sprintf("invalid SCEP label %q: labels may only contain letters, digits, hyphens and underscores", label)), nil
+		}
+		roles[role] = struct{}{}
+	}
+	for roleName := range config.StaticChallengeHashes {
+		roles[roleName] = struct{}{}
+	}
+	for roleName := range roles {
+		role, err := b.getRole(ctx, req.Storage, roleName)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return logical.ErrorResponse(fmt.Sprintf("unknown role: %s", roleName)), nil
+		}
+	}
+
+	if config.Enabled && !config.AllowDynamicChallenges && len(config.StaticChallengeHashes) == 0 {
+		return logical.ErrorResponse("either static_challenges or allow_dynamic_challenges must be set when SCEP is enabled"), nil
+	}
+
+	if err := sc.setScepConfig(config); err != nil {
+		return nil, err
+	}
+
+	return b.pathReadScepConfig(ctx, req, data)
+}
+
+const pathConfigScepHelpSyn = `
+Configure the SCEP enrollment endpoints.
+`
+
+const pathConfigScepHelpDesc = `
+This path configures the SCEP endpoints under scep/ and scep/<label>/,
+which let devices such as MDM-managed endpoints and network equipment
+fetch the CA certificates and enroll for certificates. Each label maps to
+the role its enrollments issue against; enrollments without a label use
+default_role.
+
+Devices authenticate enrollments with the challenge password of their
+CSR: either the static challenge configured for the role, or a single-use
+challenge password minted with scep/challenge.
+`
@@ -3,6 +3,7 @@ package pki
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/hashicorp/vault/sdk/framework"
@@ -26,11 +27,30 @@ for the issuing certificate attribute. See also RFC 5280 Section 4.2.2.1.`,
 for the CRL distribution points attribute. See also RFC 5280 Section 4.2.1.13.`,
 			},
 
+			"partition_crl_distribution_points": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma-separated list of URLs to be used
+for the CRL distribution points attribute of certificates issued by roles
+with a crl_partition, in place of crl_distribution_points. The special value
+'{{crl_partition}}' is replaced by the role's partition; '{{issuer_id}}' and
+'{{cluster_path}}' are available when templating is enabled.`,
+			},
+
 			"ocsp_servers": {
 				Type: framework.TypeCommaStringSlice,
 				Description: `Comma-separated list of URLs to be used
 for the OCSP servers attribute. See also RFC 5280 Section 4.2.2.1.`,
 			},
+
+			"enable_templating": {
+				Type: framework.TypeBool,
+				Description: `Whether or not to enable templating of the
+above AIA fields. When templating is enabled the special values '{{issuer_id}}'
+and '{{cluster_path}}' are available, but the addresses are not checked for
+URI validity until issuance time. '{{cluster_path}}' requires /config/cluster's
+path to be set on all PR secondary clusters.`,
+				Default: false,
+			},
 		},
 
 		Operations: map[logical.Operation]framework.OperationHandler{
@@ -57,16 +77,94 @@ func validateURLs(urls []string) string {
 	return ""
 }
 
-func getGlobalAIAURLs(ctx context.Context, storage logical.Storage) (*certutil.URLEntries, error) {
+const (
+	aiaTemplateIssuerID    = "{{issuer_id}}"
+	aiaTemplateClusterPath = "{{cluster_path}}"
+
+	aiaTemplateCRLPartition = "{{crl_partition}}"
+)
+
+// aiaConfigEntry is the global AIA URL configuration; when templating is
+// enabled, the URLs are resolved per issuer at issuance time.
+type aiaConfigEntry struct {
+	IssuingCertificates            []string `json:"issuing_certificates"`
+	CRLDistributionPoints          []string `json:"crl_distribution_points"`
+	OCSPServers                    []string `json:"ocsp_servers"`
+	PartitionCRLDistributionPoints []string `json:"partition_crl_distribution_points"`
+	EnableTemplating               bool     `json:"enable_templating"`
+}
+
+// toURLEntries resolves the configured URLs for the given issuer.
+func (a *aiaConfigEntry) toURLEntries(sc *storageContext, issuer issuerID) (*certutil.URLEntries, error) {
+	entries := &certutil.URLEntries{
+		IssuingCertificates:   append([]string{}, a.IssuingCertificates...),
+		CRLDistributionPoints: append([]string{}, a.CRLDistributionPoints...),
+		OCSPServers:           append([]string{}, a.OCSPServers...),
+	}
+
+	if !a.EnableTemplating {
+		return entries, nil
+	}
+
+	var clusterPath string
+	for _, source := range [][]string{entries.IssuingCertificates, entries.CRLDistributionPoints, entries.OCSPServers} {
+		for index, uri := range source {
+			if strings.Contains(uri, aiaTemplateClusterPath) && clusterPath == "" {
+				config, err := sc.getClusterConfig()
+				if err != nil {
+					return nil, fmt.Errorf("unable to fetch cluster configuration: %w", err)
+				}
+				if config.Path == "" {
+					return nil, fmt.Errorf("AIA URL template %q uses %v but the cluster path is not set in /config/cluster", uri, aiaTemplateClusterPath)
+				}
+				clusterPath = strings.TrimSuffix(config.Path, "/")
+			}
+
+			uri = strings.ReplaceAll(uri, aiaTemplateClusterPath, clusterPath)
+			uri = strings.ReplaceAll(uri, aiaTemplateIssuerID, issuer.String())
+			if strings.Contains(uri, "{{") || !govalidator.IsURL(uri) {
+				return nil, fmt.Errorf("invalid URL resolved from AIA URL template: %s", uri)
+			}
+			source[index] = uri
+		}
+	}
+
+	return entries, nil
+}
+
+// partitionCRLDistributionPoints resolves the CRL distribution points of
+// certificates issued into the given CRL partition by the given issuer.
+func (a *aiaConfigEntry) partitionCRLDistributionPoints(sc *storageContext, issuer issuerID, partition string) ([]string, error) {
+	var uris []string
+	for _, uri := range a.PartitionCRLDistributionPoints {
+		uris = append(uris, strings.ReplaceAll(uri, aiaTemplateCRLPartition, partition))
+	}
+
+	resolved, err := (&aiaConfigEntry{CRLDistributionPoints: uris, EnableTemplating: a.EnableTemplating}).toURLEntries(sc, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, uri := range resolved.CRLDistributionPoints {
+		if strings.Contains(uri, "{{") || !govalidator.IsURL(uri) {
+			return nil, fmt.Errorf("invalid URL resolved from partition CRL distribution point: %s", uri)
+		}
+	}
+
+	return resolved.CRLDistributionPoints, nil
+}
+
+func getGlobalAIAURLs(ctx context.Context, storage logical.Storage) (*aiaConfigEntry, error) {
 	entry, err := storage.Get(ctx, "urls")
 	if err != nil {
 		return nil, err
 	}
 
-	entries := &certutil.URLEntries{
-		IssuingCertificates:   []string{},
-		CRLDistributionPoints: []string{},
-		OCSPServers:           []string{},
+	entries := &aiaConfigEntry{
+		IssuingCertificates:            []string{},
+		CRLDistributionPoints:          []string{},
+		OCSPServers:                    []string{},
+		PartitionCRLDistributionPoints: []string{},
 	}
 
 	if entry == nil {
@@ -80,7 +178,7 @@ func getGlobalAIAURLs(ctx context.Context, storage logical.Storage) (*certutil.U
 	return entries, nil
 }
 
-func writeURLs(ctx context.Context, storage logical.Storage, entries *certutil.URLEntries) error {
+func writeURLs(ctx context.Context, storage logical.Storage, entries *aiaConfigEntry) error {
 	entry, err := logical.StorageEntryJSON("urls", entries)
 	if err != nil {
 		return err
@@ -105,9 +203,11 @@ func (b *backend) pathReadURL(ctx context.Context, req *logical.Request, _ *fram
 
 	resp := &logical.Response{
 		Data: map[string]interface{}{
-			"issuing_certificates":    entries.IssuingCertificates,
-			"crl_distribution_points": entries.CRLDistributionPoints,
-			"ocsp_servers":            entries.OCSPServers,
+			"issuing_certificates":              entries.IssuingCertificates,
+			"crl_distribution_points":           entries.CRLDistributionPoints,
+			"ocsp_servers":                      entries.OCSPServers,
+			"enable_templating":                 entries.EnableTemplating,
+			"partition_crl_distribution_points": entries.PartitionCRLDistributionPoints,
 		},
 	}
 
@@ -120,26 +220,51 @@ func (b *backend) pathWriteURL(ctx context.Context, req *logical.Request, data *
 		return nil, err
 	}
 
+	if enableTemplating, ok := data.GetOk("enable_templating"); ok {
+		entries.EnableTemplating = enableTemplating.(bool)
+	}
 	if urlsInt, ok := data.GetOk("issuing_certificates"); ok {
 		entries.IssuingCertificates = urlsInt.([]string)
-		if badURL := validateURLs(entries.IssuingCertificates); badURL != "" {
-			return logical.ErrorResponse(fmt.Sprintf(
-				"invalid URL found in Authority Information Access (AIA) parameter issuing_certificates: %s", badURL)), nil
-		}
 	}
 	if urlsInt, ok := data.GetOk("crl_distribution_points"); ok {
 		entries.CRLDistributionPoints = urlsInt.([]string)
-		if badURL := validateURLs(entries.CRLDistributionPoints); badURL != "" {
-			return logical.ErrorResponse(fmt.Sprintf(
-				"invalid URL found in Authority Information Access (AIA) parameter crl_distribution_points: %s", badURL)), nil
-		}
 	}
 	if urlsInt, ok := data.GetOk("ocsp_servers"); ok {
 		entries.OCSPServers = urlsInt.([]string)
-		if badURL := validateURLs(entries.OCSPServers); badURL != "" {
-			return logical.ErrorResponse(fmt.Sprintf(
-				"invalid URL found in Authority Information Access (AIA) parameter ocsp_servers: %s", badURL)), nil
+	}
+	if urlsInt, ok := data.GetOk("partition_crl_distribution_points"); ok {
+		entries.PartitionCRLDistributionPoints = urlsInt.([]string)
+	}
+
+	if entries.EnableTemplating {
+		// Templates can only be checked once resolved; do so against a
+		// placeholder issuer, which also ensures the cluster path is set
+		// when it is used.
+		sc := b.makeStorageContext(ctx, req.Storage)
+		if _, err := entries.toURLEntries(sc, issuerID("00000000-0000-0000-0000-000000000000")); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("unable to validate templated AIA URLs: %v", err)), nil
 		}
+	} else {
+		pairs := []struct {
+			name string
+			urls []string
+		}{
+			{"issuing_certificates", entries.IssuingCertificates},
+			{"crl_distribution_points", entries.CRLDistributionPoints},
+			{"ocsp_servers", entries.OCSPServers},
+		}
+		for _, pair := range pairs {
+			if badURL := validateURLs(pair.urls); badURL != "" {
+				return logical.ErrorResponse(fmt.Sprintf(
+					"invalid URL found in Authority Information Access (AIA) parameter %v: %s", pair.name, badURL)), nil
+			}
+		}
+	}
+
+	// Partition CRL distribution points are always templated, by partition.
+	sc := b.makeStorageContext(ctx, req.Storage)
+	if _, err := entries.partitionCRLDistributionPoints(sc, issuerID("00000000-0000-0000-0000-000000000000"), "example"); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("unable to validate partition_crl_distribution_points: %v", err)), nil
 	}
 
 	return nil, writeURLs(ctx, req.Storage, entries)
@@ -157,4 +282,13 @@ certificates. To delete URLs, simply re-set the appropriate value with an
 empty string.
 
 Multiple URLs can be specified for each type; use commas to separate them.
+
+With enable_templating, the URLs may contain '{{issuer_id}}', replaced by the
+ID of the issuer signing a certificate, and '{{cluster_path}}', replaced by the
+path set in /config/cluster of the cluster issuing it. Templated URLs are not
+included in self-signed roots, whose issuer ID isn't known at generation time.
+
+Certificates issued by roles with a crl_partition take their CRL distribution
+points from partition_crl_distribution_points instead, when set; there,
+'{{crl_partition}}' is replaced by the role's partition.
 `
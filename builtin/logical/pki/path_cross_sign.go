@@ -0,0 +1,332 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathIssuerCrossSignCSR(b *backend) *framework.Path {
+	fields := addIssuerRefField(map[string]*framework.FieldSchema{})
+	fields["add_basic_constraints"] = &framework.FieldSchema{
+		Type: framework.TypeBool,
+		Description: `Whether to add a Basic Constraints
+extension with CA: true. Only needed as a
+workaround in some compatibility scenarios
+with Active Directory Certificate Services.`,
+	}
+
+	return &framework.Path{
+		Pattern: "issuer/" + framework.GenericNameRegex(issuerRefParam) + "/cross-sign/csr",
+		Fields:  fields,
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathIssuerCrossSignCSR,
+				// Read more about why these flags are set in backend.go
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathIssuerCrossSignCSRHelpSyn,
+		HelpDescription: pathIssuerCrossSignCSRHelpDesc,
+	}
+}
+
+func pathIssuerCrossSignImport(b *backend) *framework.Path {
+	fields := addIssuerRefField(map[string]*framework.FieldSchema{})
+	fields = addIssuerNameField(fields)
+	fields["certificate"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `PEM-format cross-signed certificate, optionally
+followed by the certificates of the cross-signing CA's chain.`,
+	}
+
+	return &framework.Path{
+		Pattern: "issuer/" + framework.GenericNameRegex(issuerRefParam) + "/cross-sign/import",
+		Fields:  fields,
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathIssuerCrossSignImport,
+				// Read more about why these flags are set in backend.go
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathIssuerCrossSignImportHelpSyn,
+		HelpDescription: pathIssuerCrossSignImportHelpDesc,
+	}
+}
+
+func (b *backend) pathIssuerCrossSignCSR(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.issuersLock.RLock()
+	defer b.issuersLock.RUnlock()
+
+	if b.useLegacyBundleCaStorage() {
+		return logical.ErrorResponse("cannot cross-sign issuers until migration has completed"), nil
+	}
+
+	issuerName := getIssuerRef(data)
+	if len(issuerName) == 0 {
+		return logical.ErrorResponse("missing issuer reference"), nil
+	}
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+	ref, err := sc.resolveIssuerReference(issuerName)
+	if err != nil {
+		return nil, err
+	}
+	if ref == "" {
+		return logical.ErrorResponse("unable to resolve issuer id for reference: " + issuerName), nil
+	}
+
+	issuer, err := sc.fetchIssuerById(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	caInfo, err := sc.fetchCAInfoByIssuerId(ref, ReadOnlyUsage)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
+	}
+
+	// The CSR reuses the issuer's exact subject (rather than a re-encoded
+	// copy of it) and its key, so the certificate signed from it chains
+	// interchangeably with the existing issuer.
+	issuerCert := caInfo.Certificate
+	csrTemplate := &x509.CertificateRequest{
+		RawSubject:     issuerCert.RawSubject,
+		DNSNames:       issuerCert.DNSNames,
+		EmailAddresses: issuerCert.EmailAddresses,
+		IPAddresses:    issuerCert.IPAddresses,
+		URIs:           issuerCert.URIs,
+	}
+
+	if data.Get("add_basic_constraints").(bool) {
+		type basicConstraints struct {
+			IsCA       bool `asn1:"optional"`
+			MaxPathLen int  `asn1:"optional,default:-1"`
+		}
+		val, err := asn1.Marshal(basicConstraints{IsCA: true, MaxPathLen: -1})
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling basic constraints: %w", err)
+		}
+		csrTemplate.ExtraExtensions = append(csrTemplate.ExtraExtensions, pkix.Extension{
+			Id:       asn1.ObjectIdentifier{2, 5, 29, 19},
+			Value:    val,
+			Critical: true,
+		})
+	}
+
+	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, csrTemplate, caInfo.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create cross-sign CSR: %w", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"csr":       strings.TrimSpace(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrBytes}))),
+			"issuer_id": issuer.ID,
+			"key_id":    issuer.KeyID,
+		},
+	}, nil
+}
+
+func (b *backend) pathIssuerCrossSignImport(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Since we're planning on updating issuers here, grab the lock so we've
+	// got a consistent view.
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	if b.useLegacyBundleCaStorage() {
+		return logical.ErrorResponse("cannot cross-sign issuers until migration has completed"), nil
+	}
+
+	issuerName := getIssuerRef(data)
+	if len(issuerName) == 0 {
+		return logical.ErrorResponse("missing issuer reference"), nil
+	}
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+	ref, err := sc.resolveIssuerReference(issuerName)
+	if err != nil {
+		return nil, err
+	}
+	if ref == "" {
+		return logical.ErrorResponse("unable to resolve issuer id for reference: " + issuerName), nil
+	}
+
+	original, err := sc.fetchIssuerById(ref)
+	if err != nil {
+		return nil, err
+	}
+	originalCert, err := original.GetCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	newName, err := getIssuerName(sc, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	var certs []string
+	pemBytes := []byte(data.Get("certificate").(string))
+	for len(bytes.TrimSpace(pemBytes)) > 0 {
+		var pemBlock *pem.Block
+		pemBlock, pemBytes = pem.Decode(pemBytes)
+		if pemBlock == nil {
+			return logical.ErrorResponse("provided PEM block contained no data"), nil
+		}
+		if pemBlock.Type != "CERTIFICATE" && pemBlock.Type != "X509 CERTIFICATE" {
+			return logical.ErrorResponse(fmt.Sprintf("unexpected PEM block of type %q; only certificates may be provided", pemBlock.Type)), nil
+		}
+		certs = append(certs, string(pem.EncodeToMemory(pemBlock)))
+	}
+	if len(certs) == 0 {
+		return logical.ErrorResponse("missing cross-signed certificate"), nil
+	}
+
+	// The first certificate must be the cross-signed variant of the
+	// existing issuer: same subject and same key, but a different
+	// certificate. This is what lets chain building and CRL building
+	// treat the two as equivalent.
+	crossSigned, err := parseCertificateFromBytes([]byte(certs[0]))
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("unable to parse cross-signed certificate: %v", err)), nil
+	}
+	if !crossSigned.BasicConstraintsValid || !crossSigned.IsCA {
+		return logical.ErrorResponse("cross-signed certificate is not a CA certificate"), nil
+	}
+	if !bytes.Equal(crossSigned.RawSubject, originalCert.RawSubject) {
+		return logical.ErrorResponse(fmt.Sprintf("cross-signed certificate's subject (%v) does not match issuer %v's subject (%v)", crossSigned.Subject, original.ID, originalCert.Subject)), nil
+	}
+	equal, err := certutil.ComparePublicKeys(originalCert.PublicKey, crossSigned.PublicKey)
+	if err != nil || !equal {
+		return logical.ErrorResponse(fmt.Sprintf("cross-signed certificate's public key does not match issuer %v's key", original.ID)), nil
+	}
+	if areCertificatesEqual(originalCert, crossSigned) {
+		return logical.ErrorResponse(fmt.Sprintf("provided certificate is issuer %v itself, not a cross-signed certificate", original.ID)), nil
+	}
+
+	// When the cross-signing CA's chain is given, the cross-signed
+	// certificate must have been signed by one of its certificates, lest
+	// unrelated certificates be imported alongside it.
+	if len(certs) > 1 {
+		signed := false
+		for certIndex, certPem := range certs[1:] {
+			chainCert, err := parseCertificateFromBytes([]byte(certPem))
+			if err != nil {
+				return logical.ErrorResponse(fmt.Sprintf("unable to parse chain certificate %v: %v", certIndex, err)), nil
+			}
+			if crossSigned.CheckSignatureFrom(chainCert) == nil {
+				signed = true
+				break
+			}
+		}
+		if !signed {
+			return logical.ErrorResponse("cross-signed certificate was not signed by any of the provided chain certificates"), nil
+		}
+	}
+
+	sibling, existing, err := sc.importIssuer(certs[0], newName)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("error importing cross-signed certificate: %v", err)), nil
+	}
+
+	var createdIssuers []string
+	if !existing {
+		createdIssuers = append(createdIssuers, sibling.ID.String())
+	}
+	if err := sc.linkCrossSignedIssuer(original, sibling, !existing); err != nil {
+		return nil, err
+	}
+
+	// Any remaining certificates are the cross-signing CA's chain; import
+	// them too so the sibling's chain can be built.
+	for certIndex, certPem := range certs[1:] {
+		cert, existing, err := sc.importIssuer(certPem, "")
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("error importing chain certificate %v: %v", certIndex, err)), nil
+		}
+		if !existing {
+			createdIssuers = append(createdIssuers, cert.ID.String())
+		}
+	}
+
+	if len(createdIssuers) > 0 {
+		if err := b.crlBuilder.rebuild(ctx, b, req, true); err != nil {
+			return nil, err
+		}
+	}
+
+	sibling, err = sc.fetchIssuerById(sibling.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := respondReadIssuer(sibling)
+	if err != nil {
+		return nil, err
+	}
+	resp.Data["imported_issuers"] = createdIssuers
+	if existing {
+		resp.AddWarning("The cross-signed certificate was already imported as an issuer; it is now linked to issuer " + original.ID.String() + ".")
+	}
+
+	return resp, nil
+}
+
+// linkCrossSignedIssuer records sibling, just imported, as a cross-signed
+// variant of original.
+func (sc *storageContext) linkCrossSignedIssuer(original *issuerEntry, sibling *issuerEntry, created bool) error {
+	if sibling.CrossSignedFrom == original.ID && !created {
+		return nil
+	}
+
+	// The sibling shares the original's key, so carry over the settings
+	// which depend on it.
+	sibling.CrossSignedFrom = original.ID
+	if created {
+		sibling.LeafNotAfterBehavior = original.LeafNotAfterBehavior
+		sibling.RevocationSigAlg = original.RevocationSigAlg
+	}
+	return sc.writeIssuer(sibling)
+}
+
+const (
+	pathIssuerCrossSignCSRHelpSyn  = `Generate a CSR for cross-signing an existing issuer.`
+	pathIssuerCrossSignCSRHelpDesc = `
+This endpoint generates a CSR with the subject and key of the specified
+issuer. Once signed by another CA, the resulting certificate can be
+imported through the issuer/:issuer_ref/cross-sign/import endpoint.
+`
+
+	pathIssuerCrossSignImportHelpSyn  = `Import a cross-signed certificate for an existing issuer.`
+	pathIssuerCrossSignImportHelpDesc = `
+This endpoint imports a cross-signed certificate, with the same subject
+and key as the specified issuer, as a new issuer linked to it. Both
+issuers appear in each other's chains and share their CRLs. Certificates
+of the cross-signing CA's chain may follow the cross-signed certificate, one
+of which must have signed it.
+`
+)
@@ -0,0 +1,552 @@
+package pki
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/ryanuber/go-glob"
+)
+
+const enrollmentTokenPrefix = "enrollment/token/"
+
+// enrollmentTokenEntry is a challenge password minted for a device to
+// enroll with, without it holding a Vault token. Only a hash of the
+// password's secret half is stored.
+type enrollmentTokenEntry struct {
+	ID            string    `json:"id"`
+	SecretHash    []byte    `json:"secret_hash"`
+	Role          string    `json:"role"`
+	AllowedNames  []string  `json:"allowed_names"`
+	CreationTime  time.Time `json:"creation_time"`
+	Expiration    time.Time `json:"expiration"`
+	UsesRemaining int       `json:"uses_remaining"`
+}
+
+func pathEnrollmentTokenCreate(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "enrollment/token",
+		Fields: map[string]*framework.FieldSchema{
+			"role": {
+				Type:        framework.TypeString,
+				Description: `Name of the role enrollments with this password issue against.`,
+				Required:    true,
+			},
+			"allowed_names": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `Names (supporting globs) the enrolling device may
+request, as the common name or a subject alternative name, in addition to
+the role's restrictions. Values of other SANs, such as User Principal Names,
+must match too. When empty, only the role's restrictions apply.`,
+			},
+			"ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: `How long the password remains usable.`,
+				Default:     "24h",
+			},
+			"num_uses": {
+				Type: framework.TypeInt,
+				Description: `How many enrollments the password may be used
+for; defaults to a single use.`,
+				Default: 1,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathEnrollmentTokenCreate,
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathEnrollmentTokenHelpSyn,
+		HelpDescription: pathEnrollmentTokenHelpDesc,
+	}
+}
+
+func pathListEnrollmentTokens(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "enrollment/tokens/?$",
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.pathEnrollmentTokenList,
+			},
+		},
+
+		HelpSynopsis:    pathEnrollmentTokenHelpSyn,
+		HelpDescription: pathEnrollmentTokenHelpDesc,
+	}
+}
+
+func pathEnrollmentToken(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "enrollment/token/" + framework.GenericNameRegex("token_id"),
+		Fields: map[string]*framework.FieldSchema{
+			"token_id": {
+				Type:        framework.TypeString,
+				Description: `Identifier of the enrollment password.`,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathEnrollmentTokenRead,
+			},
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback: b.pathEnrollmentTokenDelete,
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathEnrollmentTokenHelpSyn,
+		HelpDescription: pathEnrollmentTokenHelpDesc,
+	}
+}
+
+func pathEnrollmentIssue(b *backend) *framework.Path {
+	ret := &framework.Path{
+		Pattern: "enrollment/issue",
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.metricsWrap("enrollment-issue", noRole, b.pathEnrollmentIssue),
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathEnrollmentIssueHelpSyn,
+		HelpDescription: pathEnrollmentIssueHelpDesc,
+	}
+
+	ret.Fields = addNonCACommonFields(map[string]*framework.FieldSchema{})
+	ret.Fields["challenge_password"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `Enrollment password minted via enrollment/token.`,
+		Required:    true,
+	}
+	return ret
+}
+
+func pathEnrollmentSign(b *backend) *framework.Path {
+	ret := pathEnrollmentIssue(b)
+	ret.Pattern = "enrollment/sign"
+	ret.Operations = map[logical.Operation]framework.OperationHandler{
+		logical.UpdateOperation: &framework.PathOperation{
+			Callback: b.metricsWrap("enrollment-sign", noRole, b.pathEnrollmentSign),
+			// Read more about why these flags are set in backend.go.
+			ForwardPerformanceStandby:   true,
+			ForwardPerformanceSecondary: true,
+		},
+	}
+	ret.Fields["csr"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Default:     "",
+		Description: `PEM-format CSR to be signed.`,
+	}
+	return ret
+}
+
+func (sc *storageContext) fetchEnrollmentToken(id string) (*enrollmentTokenEntry, error) {
+	entry, err := sc.Storage.Get(sc.Context, enrollmentTokenPrefix+id)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var token enrollmentTokenEntry
+	if err := entry.DecodeJSON(&token); err != nil {
+		return nil, fmt.Errorf("unable to decode enrollment password %v: %w", id, err)
+	}
+	return &token, nil
+}
+
+func (sc *storageContext) writeEnrollmentToken(token *enrollmentTokenEntry) error {
+	entry, err := logical.StorageEntryJSON(enrollmentTokenPrefix+token.ID, token)
+	if err != nil {
+		return err
+	}
+	return sc.Storage.Put(sc.Context, entry)
+}
+
+func hashEnrollmentSecret(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// redeemEnrollmentToken validates a challenge password and the names
+// requested with it, returning the token entry. Rejections are returned as
+// user errors. Callers must hold the enrollment lock, and reserve a use of
+// the token with reserveEnrollmentToken before issuing.
+func (sc *storageContext) redeemEnrollmentToken(password string, names []string) (*enrollmentTokenEntry, error) {
+	// Don't distinguish between the reasons a password is rejected; that
+	// would only help somebody guessing them.
+	invalid := errutil.UserError{Err: "invalid or expired challenge password"}
+
+	id, secret, found := strings.Cut(password, ".")
+	if !found || id == "" || secret == "" {
+		return nil, invalid
+	}
+
+	token, err := sc.fetchEnrollmentToken(id)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, invalid
+	}
+
+	if subtle.ConstantTimeCompare(token.SecretHash, hashEnrollmentSecret(secret)) != 1 {
+		return nil, invalid
+	}
+
+	if time.Now().After(token.Expiration) || token.UsesRemaining <= 0 {
+		if err := sc.Storage.Delete(sc.Context, enrollmentTokenPrefix+id); err != nil {
+			return nil, err
+		}
+		return nil, invalid
+	}
+
+	if len(token.AllowedNames) > 0 {
+		for _, name := range names {
+			if !enrollmentNameAllowed(token.AllowedNames, name) {
+				return nil, errutil.UserError{Err: fmt.Sprintf("name %q is not allowed by this challenge password", name)}
+			}
+		}
+	}
+
+	return token, nil
+}
+
+// reserveEnrollmentToken takes a use of a redeemed token ahead of
+// issuance, so that the enrollment lock needn't be held while signing.
+// It keeps tokens without uses left, so that releaseEnrollmentToken can give the use back should issuance fail;
+// redeemEnrollmentToken removes them once presented again. Callers must
+// hold the enrollment lock.
+func (sc *storageContext) reserveEnrollmentToken(token *enrollmentTokenEntry) error {
+	token.UsesRemaining -= 1
+	return sc.writeEnrollmentToken(token)
+}
+
+// releaseEnrollmentToken gives back a use taken by reserveEnrollmentToken,
+// unless the token was deleted in the meantime. Callers must hold the
+// enrollment lock.
+func (sc *storageContext) releaseEnrollmentToken(id string) error {
+	token, err := sc.fetchEnrollmentToken(id)
+	if err != nil || token == nil {
+		return err
+	}
+
+	token.UsesRemaining += 1
+	return sc.writeEnrollmentToken(token)
+}
+
+// reserveEnrollmentTokenUse redeems the challenge password for the given
+// names and, unless roleName is empty, under that role, and reserves a use
+// of it, holding the enrollment lock only while doing so. Rejections are
+// returned as user errors. Should issuance then fail, the use must be given
+// back with releaseEnrollmentTokenUse.
+func (b *backend) reserveEnrollmentTokenUse(sc *storageContext, password string, names []string, roleName string) (*enrollmentTokenEntry, error) {
+	b.enrollmentLock.Lock()
+	defer b.enrollmentLock.Unlock()
+
+	token, err := sc.redeemEnrollmentToken(password, names)
+	if err != nil {
+		return nil, err
+	}
+	if roleName != "" && token.Role != roleName {
+		return nil, errutil.UserError{Err: "the challenge password is not bound to this role"}
+	}
+
+	if err := sc.reserveEnrollmentToken(token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// releaseEnrollmentTokenUse gives back a use taken by
+// reserveEnrollmentTokenUse after failed issuance.
+func (b *backend) releaseEnrollmentTokenUse(sc *storageContext, token *enrollmentTokenEntry) {
+	b.enrollmentLock.Lock()
+	defer b.enrollmentLock.Unlock()
+
+	if err := sc.releaseEnrollmentToken(token.ID); err != nil {
+		b.Logger().Warn("unable to give back the use of an enrollment password after failed issuance", "token_id", token.ID, "error", err)
+	}
+}
+
+func enrollmentNameAllowed(allowed []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range allowed {
+		if glob.Glob(strings.ToLower(pattern), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// enrollmentRequestedNames gathers every name an enrollment request asks
+// for, from both the request parameters and (when signing) the CSR, so
+// that the challenge password's constraints hold whichever the role
+// ends up using.
+func enrollmentRequestedNames(data *framework.FieldData, useCSR bool) ([]string, error) {
+	var names []string
+	if cn := data.Get("common_name").(string); cn != "" {
+		names = append(names, cn)
+	}
+	if altNames := data.Get("alt_names").(string); altNames != "" {
+		names = append(names, strutil.RemoveDuplicates(strutil.ParseStringSlice(altNames, ","), false)...)
+	}
+	names = append(names, data.Get("ip_sans").([]string)...)
+	names = append(names, data.Get("uri_sans").([]string)...)
+	names = append(names, data.Get("user_principal_names").([]string)...)
+
+	if others := data.Get("other_sans").([]string); len(others) > 0 {
+		requested, err := parseOtherSANs(others)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse requested other SAN: %w", err)
+		}
+		for _, values := range requested {
+			names = append(names, values...)
+		}
+	}
+
+	if !useCSR {
+		return names, nil
+	}
+
+	pemBlock, _ := pem.Decode([]byte(data.Get("csr").(string)))
+	if pemBlock == nil {
+		return nil, fmt.Errorf("csr contains no data")
+	}
+	csr, err := x509.ParseCertificateRequest(pemBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("certificate request could not be parsed: %v", err)
+	}
+
+	csrNames, err := csrRequestedNames(csr)
+	if err != nil {
+		return nil, err
+	}
+	return append(names, csrNames...), nil
+}
+
+// csrRequestedNames returns the names requested in a CSR: its common name
+// and subject alternative names, including the values of other names such
+// as User Principal Names.
+func csrRequestedNames(csr *x509.CertificateRequest) ([]string, error) {
+	var names []string
+	if csr.Subject.CommonName != "" {
+		names = append(names, csr.Subject.CommonName)
+	}
+	names = append(names, csr.DNSNames...)
+	names = append(names, csr.EmailAddresses...)
+	for _, ip := range csr.IPAddresses {
+		names = append(names, ip.String())
+	}
+	for _, uri := range csr.URIs {
+		names = append(names, uri.String())
+	}
+
+	others, err := getOtherSANsFromX509Extensions(csr.Extensions)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse requested other SAN: %w", err)
+	}
+	for _, other := range others {
+		names = append(names, other.value)
+	}
+	return names, nil
+}
+
+func (b *backend) pathEnrollmentTokenCreate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role").(string)
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+	role, err := b.getRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("unknown role: %s", roleName)), nil
+	}
+
+	ttl := time.Duration(data.Get("ttl").(int)) * time.Second
+	if ttl <= 0 {
+		return logical.ErrorResponse("ttl must be positive"), nil
+	}
+	numUses := data.Get("num_uses").(int)
+	if numUses <= 0 {
+		return logical.ErrorResponse("num_uses must be positive"), nil
+	}
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+	token, password, err := sc.createEnrollmentToken(roleName, data.Get("allowed_names").([]string), ttl, numUses)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := enrollmentTokenResponse(token)
+	resp.Data["challenge_password"] = password
+	return resp, nil
+}
+
+// createEnrollmentToken mints and stores a new enrollment password for the
+// given role, returning its entry and the password itself.
+func (sc *storageContext) createEnrollmentToken(roleName string, allowedNames []string, ttl time.Duration, numUses int) (*enrollmentTokenEntry, string, error) {
+	rawSecret := make([]byte, 32)
+	if _, err := rand.Read(rawSecret); err != nil {
+		return nil, "", fmt.Errorf("unable to generate challenge password: %w", err)
+	}
+	secret := base64.RawURLEncoding.EncodeToString(rawSecret)
+
+	now := time.Now()
+	token := &enrollmentTokenEntry{
+		ID:            genUuid(),
+		SecretHash:    hashEnrollmentSecret(secret),
+		Role:          roleName,
+		AllowedNames:  allowedNames,
+		CreationTime:  now,
+		Expiration:    now.Add(ttl),
+		UsesRemaining: numUses,
+	}
+
+	if err := sc.writeEnrollmentToken(token); err != nil {
+		return nil, "", err
+	}
+
+	return token, token.ID + "." + secret, nil
+}
+
+func enrollmentTokenResponse(token *enrollmentTokenEntry) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"token_id":       token.ID,
+			"role":           token.Role,
+			"allowed_names":  token.AllowedNames,
+			"creation_time":  token.CreationTime.Format(time.RFC3339),
+			"expiration":     token.Expiration.Format(time.RFC3339),
+			"uses_remaining": token.UsesRemaining,
+		},
+	}
+}
+
+func (b *backend) pathEnrollmentTokenList(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(ctx, enrollmentTokenPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathEnrollmentTokenRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	token, err := sc.fetchEnrollmentToken(data.Get("token_id").(string))
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, nil
+	}
+
+	return enrollmentTokenResponse(token), nil
+}
+
+func (b *backend) pathEnrollmentTokenDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.enrollmentLock.Lock()
+	defer b.enrollmentLock.Unlock()
+
+	return nil, req.Storage.Delete(ctx, enrollmentTokenPrefix+data.Get("token_id").(string))
+}
+
+func (b *backend) pathEnrollmentIssue(ctx context.Context, req *logical.Request, data *framework.FieldData, _ *roleEntry) (*logical.Response, error) {
+	return b.pathEnrollmentIssueSign(ctx, req, data, false)
+}
+
+func (b *backend) pathEnrollmentSign(ctx context.Context, req *logical.Request, data *framework.FieldData, _ *roleEntry) (*logical.Response, error) {
+	return b.pathEnrollmentIssueSign(ctx, req, data, true)
+}
+
+func (b *backend) pathEnrollmentIssueSign(ctx context.Context, req *logical.Request, data *framework.FieldData, useCSR bool) (*logical.Response, error) {
+	names, err := enrollmentRequestedNames(data, useCSR)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	// The use is reserved ahead of issuance, so that concurrent requests
+	// can't redeem it twice without serializing issuance.
+	sc := b.makeStorageContext(ctx, req.Storage)
+	token, err := b.reserveEnrollmentTokenUse(sc, data.Get("challenge_password").(string), names, "")
+	if err != nil {
+		if _, ok := err.(errutil.UserError); ok {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		return nil, err
+	}
+
+	role, err := b.getRole(ctx, req.Storage, token.Role)
+	if err == nil && role == nil {
+		b.releaseEnrollmentTokenUse(sc, token)
+		return logical.ErrorResponse(fmt.Sprintf("role %s bound to this challenge password no longer exists", token.Role)), nil
+	}
+
+	var resp *logical.Response
+	if err == nil {
+		if useCSR {
+			resp, err = b.pathSign(ctx, req, data, role)
+		} else {
+			resp, err = b.pathIssue(ctx, req, data, role)
+		}
+	}
+	if err != nil || resp.IsError() {
+		b.releaseEnrollmentTokenUse(sc, token)
+		return resp, err
+	}
+
+	return resp, nil
+}
+
+const pathEnrollmentTokenHelpSyn = `
+Mint and manage one-time enrollment passwords.
+`
+
+const pathEnrollmentTokenHelpDesc = `
+Enrollment passwords let devices enroll for a certificate without holding a
+Vault token. Each is bound to a role and, optionally, a set of names (globs)
+which may be requested, and may be used num_uses times (once by default)
+before ttl elapses.
+
+The password itself is only returned when minted; listing and reading
+returns its metadata.
+`
+
+const pathEnrollmentIssueHelpSyn = `
+Enroll for a certificate using an enrollment password.
+`
+
+const pathEnrollmentIssueHelpDesc = `
+These unauthenticated endpoints issue (enrollment/issue) or sign
+(enrollment/sign) a certificate against the role bound to the presented
+challenge_password, which is consumed on success. Requested names must match
+both the role and any names the password is restricted to.
+`
@@ -0,0 +1,512 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"golang.org/x/crypto/cryptobyte"
+	cbbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// The EST (RFC 7030) endpoints let devices which only speak EST, such as
+// network equipment, fetch the CA certificates and enroll for
+// certificates. RFC 7030 places them under /.well-known/est/[<label>/];
+// here, they are served under est/[<label>/] on the mount, with each label
+// mapped to a role by config/est, and a reverse proxy may map one to the
+// other.
+//
+// Enrollment requests carry a base64-encoded PKCS#10 CSR with the
+// application/pkcs10 content type, whose body Vault passes through
+// unparsed. Responses are base64-encoded, certs-only PKCS#7 structures.
+// Clients authenticate either with HTTP Basic authentication, using an
+// enrollment password as the password, or, when enabled, with a TLS client
+// certificate issued by this mount for the same identity as the CSR; the
+// Authorization header must be allowed through on the mount
+// (passthrough_request_headers) for the former.
+const (
+	estContentTypeCACerts = "application/pkcs7-mime"
+	estContentTypeCerts   = "application/pkcs7-mime; smime-type=certs-only"
+
+	headerContentTransferEncoding = "Content-Transfer-Encoding"
+	headerWWWAuthenticate         = "WWW-Authenticate"
+
+	// estMaxRequestSize bounds the size of enrollment requests.
+	estMaxRequestSize = 64 * 1024
+)
+
+var (
+	oidPkcs7Data       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPkcs7SignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+	estLabelRegex = regexp.MustCompile(`^[\w-]+$`)
+
+	// estOperations are the operations served under each label, and so
+	// can't be used as labels themselves.
+	estOperations = map[string]bool{
+		"cacerts":        true,
+		"simpleenroll":   true,
+		"simplereenroll": true,
+	}
+)
+
+func pathEstCACerts(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "est/(" + framework.GenericNameRegex("label") + "/)?cacerts",
+		Fields:  estFields(),
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathEstCACerts,
+			},
+		},
+
+		HelpSynopsis:    pathEstHelpSyn,
+		HelpDescription: pathEstHelpDesc,
+	}
+}
+
+func pathEstSimpleEnroll(b *backend) *framework.Path {
+	return buildPathEstEnroll(b, "simpleenroll", false)
+}
+
+func pathEstSimpleReenroll(b *backend) *framework.Path {
+	return buildPathEstEnroll(b, "simplereenroll", true)
+}
+
+func buildPathEstEnroll(b *backend, operation string, reenroll bool) *framework.Path {
+	return &framework.Path{
+		Pattern: "est/(" + framework.GenericNameRegex("label") + "/)?" + operation,
+		Fields:  estFields(),
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.metricsWrap("est-"+operation, noRole, func(ctx context.Context, req *logical.Request, data *framework.FieldData, _ *roleEntry) (*logical.Response, error) {
+					return b.pathEstEnroll(ctx, req, data, reenroll)
+				}),
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathEstHelpSyn,
+		HelpDescription: pathEstHelpDesc,
+	}
+}
+
+func estFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"label": {
+			Type:        framework.TypeString,
+			Description: `EST label, mapped to a role by config/est.`,
+		},
+	}
+}
+
+// estRole returns the role enrollments under the requested label issue
+// against, or an error response should EST be disabled or the label
+// unknown.
+func (b *backend) estRole(sc *storageContext, data *framework.FieldData) (*estConfigEntry, string, *roleEntry, *logical.Response, error) {
+	config, err := sc.getEstConfig()
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+	if !config.Enabled {
+		return nil, "", nil, estErrorResponse(http.StatusNotFound, "EST is not enabled on this mount"), nil
+	}
+
+	roleName, err := config.roleForLabel(data.Get("label").(string))
+	if err != nil {
+		return nil, "", nil, estErrorResponse(http.StatusNotFound, err.Error()), nil
+	}
+
+	role, err := b.getRole(sc.Context, sc.Storage, roleName)
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+	if role == nil {
+		return nil, "", nil, estErrorResponse(http.StatusNotFound, fmt.Sprintf("role %s mapped to this EST label no longer exists", roleName)), nil
+	}
+
+	return config, roleName, role, nil, nil
+}
+
+func (b *backend) pathEstCACerts(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	_, _, role, errResp, err := b.estRole(sc, data)
+	if err != nil || errResp != nil {
+		return errResp, err
+	}
+
+	issuerRef := role.Issuer
+	if issuerRef == "" {
+		issuerRef = defaultRef
+	}
+
+	caInfo, err := sc.fetchCAInfo(issuerRef, ReadOnlyUsage)
+	if err != nil {
+		return nil, err
+	}
+
+	certs := [][]byte{caInfo.Certificate.Raw}
+	for _, block := range caInfo.CAChain {
+		if !bytes.Equal(block.Bytes, caInfo.Certificate.Raw) {
+			certs = append(certs, block.Bytes)
+		}
+	}
+
+	return estCertsResponse(estContentTypeCACerts, certs)
+}
+
+func (b *backend) pathEstEnroll(ctx context.Context, req *logical.Request, data *framework.FieldData, reenroll bool) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, roleName, role, errResp, err := b.estRole(sc, data)
+	if err != nil || errResp != nil {
+		return errResp, err
+	}
+
+	csr, err := readEstCSR(req)
+	if err != nil {
+		return estErrorResponse(http.StatusBadRequest, err.Error()), nil
+	}
+
+	// Re-enrollment renews the client's certificate, which must thus
+	// authenticate the request; see RFC 7030 Section 4.2.2.
+	var clientCert *x509.Certificate
+	if config.EnableCertAuth || reenroll {
+		clientCert, err = b.verifyEstClientCert(sc, req, roleName)
+		if err != nil {
+			if _, ok := err.(errutil.UserError); !ok {
+				return nil, err
+			}
+			return estUnauthorizedResponse(config, fmt.Sprintf("client certificate rejected: %v", err)), nil
+		}
+	}
+
+	var token *enrollmentTokenEntry
+	switch {
+	case clientCert != nil:
+		// Clients authenticated by their certificate may only enroll for
+		// the identity it certifies, rather than any name the role allows.
+		if !estSameIdentity(clientCert, csr) {
+			return estErrorResponse(http.StatusBadRequest, "the subject and subject alternative names of the CSR must match those of the client certificate"), nil
+		}
+	case reenroll:
+		return estUnauthorizedResponse(config, "re-enrollment requires a TLS client certificate issued by this mount"), nil
+	default:
+		password, ok := estBasicAuthPassword(req)
+		if !config.EnableBasicAuth || !ok {
+			return estUnauthorizedResponse(config, "enrollment requires authentication"), nil
+		}
+
+		var errResp *logical.Response
+		token, errResp, err = b.reserveEstEnrollmentToken(sc, config, roleName, password, csr)
+		if err != nil || errResp != nil {
+			return errResp, err
+		}
+	}
+
+	signData := &framework.FieldData{
+		Raw: map[string]interface{}{
+			"csr":    string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr.Raw})),
+			"format": "der",
+		},
+		Schema: pathSign(b).Fields,
+	}
+
+	resp, err := b.pathSign(ctx, req, signData, role)
+	if err == nil && resp.IsError() {
+		err = errutil.UserError{Err: resp.Error().Error()}
+	}
+	if err != nil {
+		if token != nil {
+			b.enrollmentLock.Lock()
+			releaseErr := sc.releaseEnrollmentToken(token.ID)
+			b.enrollmentLock.Unlock()
+			if releaseErr != nil {
+				b.Logger().Warn("unable to give back the use of an enrollment password after failed issuance", "token_id", token.ID, "error", releaseErr)
+			}
+		}
+		if _, ok := err.(errutil.UserError); ok {
+			return estErrorResponse(http.StatusBadRequest, err.Error()), nil
+		}
+		return nil, err
+	}
+
+	certBytes, err := base64.StdEncoding.DecodeString(resp.Data["certificate"].(string))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode issued certificate: %w", err)
+	}
+
+	return estCertsResponse(estContentTypeCerts, [][]byte{certBytes})
+}
+
+// reserveEstEnrollmentToken redeems a use of the enrollment password for
+// the CSR's names under the EST label's role. The use is taken ahead of
+// issuance, so that concurrent requests can't redeem it twice without
+// holding the enrollment lock while signing.
+func (b *backend) reserveEstEnrollmentToken(sc *storageContext, config *estConfigEntry, roleName string, password string, csr *x509.CertificateRequest) (*enrollmentTokenEntry, *logical.Response, error) {
+	b.enrollmentLock.Lock()
+	defer b.enrollmentLock.Unlock()
+
+	names, err := csrRequestedNames(csr)
+	if err != nil {
+		return nil, estErrorResponse(http.StatusBadRequest, err.Error()), nil
+	}
+
+	token, err := sc.redeemEnrollmentToken(password, names)
+	if err != nil {
+		if _, ok := err.(errutil.UserError); ok {
+			return nil, estUnauthorizedResponse(config, err.Error()), nil
+		}
+		return nil, nil, err
+	}
+	if token.Role != roleName {
+		return nil, estUnauthorizedResponse(config, "the enrollment password is not bound to the role of this EST label"), nil
+	}
+
+	if err := sc.reserveEnrollmentToken(token); err != nil {
+		return nil, nil, err
+	}
+	return token, nil, nil
+}
+
+// readEstCSR reads the base64-encoded PKCS#10 CSR in the body of an EST
+// enrollment request.
+func readEstCSR(req *logical.Request) (*x509.CertificateRequest, error) {
+	if req.HTTPRequest == nil || req.HTTPRequest.Body == nil {
+		return nil, fmt.Errorf("the request must carry a base64-encoded PKCS#10 CSR with the application/pkcs10 content type")
+	}
+
+	rawBody := req.HTTPRequest.Body
+	defer rawBody.Close()
+
+	body, err := io.ReadAll(io.LimitReader(rawBody, estMaxRequestSize))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) >= estMaxRequestSize {
+		return nil, fmt.Errorf("request is too large")
+	}
+
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(body)), ""))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode the base64-encoded CSR: %v", err)
+	}
+
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the CSR: %v", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("the CSR signature is invalid: %v", err)
+	}
+
+	return csr, nil
+}
+
+// verifyEstClientCert returns the TLS client certificate of the request,
+// after verifying it was issued by this mount under the given role for
+// client authentication and isn't revoked, or nil if the client didn't
+// present one. Rejections are returned as user errors.
+func (b *backend) verifyEstClientCert(sc *storageContext, req *logical.Request, roleName string) (*x509.Certificate, error) {
+	if req.Connection == nil || req.Connection.ConnState == nil || len(req.Connection.ConnState.PeerCertificates) == 0 {
+		return nil, nil
+	}
+	peers := req.Connection.ConnState.PeerCertificates
+	if err := b.verifyIssuedByMount(sc, req, peers[0], peers[1:]); err != nil {
+		return nil, err
+	}
+
+	clientAuth := false
+	for _, usage := range peers[0].ExtKeyUsage {
+		if usage == x509.ExtKeyUsageClientAuth {
+			clientAuth = true
+		}
+	}
+	if !clientAuth {
+		return nil, errutil.UserError{Err: "certificate is not valid for client authentication"}
+	}
+
+	// Otherwise, any certificate of the mount could enroll for a role it
+	// wasn't issued under.
+	meta, err := sc.fetchCertMetadata(serialFromCert(peers[0]))
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil || meta.Role != roleName {
+		return nil, errutil.UserError{Err: "certificate was not issued under the role of this EST label"}
+	}
+
+	return peers[0], nil
+}
+
+// verifyIssuedByMount verifies the certificate chains, through the given
+// intermediates, to an issuer of this mount and isn't revoked. Rejections
+// are returned as user errors.
+func (b *backend) verifyIssuedByMount(sc *storageContext, req *logical.Request, leaf *x509.Certificate, chain []*x509.Certificate) error {
+	issuers, err := fetchIssuerMapForRevocationChecking(sc)
+	if err != nil {
+		return err
+	}
+
+	roots := x509.NewCertPool()
+	for _, issuer := range issuers {
+		roots.AddCert(issuer)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain {
+		intermediates.AddCert(cert)
+	}
+
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return errutil.UserError{Err: err.Error()}
+	}
+
+	revoked, err := fetchCertBySerial(sc.Context, b, req, revokedPath, serialFromCert(leaf))
+	if err != nil {
+		return err
+	}
+	if revoked != nil {
+		return errutil.UserError{Err: "certificate is revoked"}
+	}
+
+	return nil
+}
+
+// estSameIdentity reports whether the CSR requests the same subject and
+// subject alternative names as the certificate.
+func estSameIdentity(cert *x509.Certificate, csr *x509.CertificateRequest) bool {
+	ipStrings := func(ips []net.IP) []string {
+		var ret []string
+		for _, ip := range ips {
+			ret = append(ret, ip.String())
+		}
+		return ret
+	}
+	uriStrings := func(uris []*url.URL) []string {
+		var ret []string
+		for _, uri := range uris {
+			ret = append(ret, uri.String())
+		}
+		return ret
+	}
+
+	return cert.Subject.String() == csr.Subject.String() &&
+		strutil.EquivalentSlices(cert.DNSNames, csr.DNSNames) &&
+		strutil.EquivalentSlices(cert.EmailAddresses, csr.EmailAddresses) &&
+		strutil.EquivalentSlices(ipStrings(cert.IPAddresses), ipStrings(csr.IPAddresses)) &&
+		strutil.EquivalentSlices(uriStrings(cert.URIs), uriStrings(csr.URIs))
+}
+
+// estBasicAuthPassword returns the password of the request's HTTP Basic
+// credentials, if any; the username is ignored.
+func estBasicAuthPassword(req *logical.Request) (string, bool) {
+	_, password, ok := (&http.Request{Header: req.Headers}).BasicAuth()
+	if !ok || password == "" {
+		return "", false
+	}
+	return password, true
+}
+
+// encodePkcs7CertsOnly builds a degenerate, certs-only PKCS#7 SignedData
+// structure (RFC 5652 Section 5) carrying the given DER certificates.
+func encodePkcs7CertsOnly(certs [][]byte) ([]byte, error) {
+	var builder cryptobyte.Builder
+	builder.AddASN1(cbbasn1.SEQUENCE, func(contentInfo *cryptobyte.Builder) {
+		contentInfo.AddASN1ObjectIdentifier(oidPkcs7SignedData)
+		contentInfo.AddASN1(cbbasn1.Tag(0).Constructed().ContextSpecific(), func(content *cryptobyte.Builder) {
+			content.AddASN1(cbbasn1.SEQUENCE, func(signedData *cryptobyte.Builder) {
+				signedData.AddASN1Int64(1)
+				// No digestAlgorithms, as there are no signers.
+				signedData.AddASN1(cbbasn1.SET, func(*cryptobyte.Builder) {})
+				signedData.AddASN1(cbbasn1.SEQUENCE, func(encapContentInfo *cryptobyte.Builder) {
+					encapContentInfo.AddASN1ObjectIdentifier(oidPkcs7Data)
+				})
+				signedData.AddASN1(cbbasn1.Tag(0).Constructed().ContextSpecific(), func(certificates *cryptobyte.Builder) {
+					for _, cert := range certs {
+						certificates.AddBytes(cert)
+					}
+				})
+				// No signerInfos.
+				signedData.AddASN1(cbbasn1.SET, func(*cryptobyte.Builder) {})
+			})
+		})
+	})
+
+	return builder.Bytes()
+}
+
+func estCertsResponse(contentType string, certs [][]byte) (*logical.Response, error) {
+	pkcs7, err := encodePkcs7CertsOnly(certs)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode PKCS#7 response: %w", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: contentType,
+			logical.HTTPRawBody:     []byte(base64.StdEncoding.EncodeToString(pkcs7)),
+			logical.HTTPStatusCode:  http.StatusOK,
+		},
+		Headers: map[string][]string{
+			headerContentTransferEncoding: {"base64"},
+		},
+	}, nil
+}
+
+func estErrorResponse(status int, message string) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "text/plain",
+			logical.HTTPRawBody:     []byte(message),
+			logical.HTTPStatusCode:  status,
+		},
+	}
+}
+
+func estUnauthorizedResponse(config *estConfigEntry, message string) *logical.Response {
+	resp := estErrorResponse(http.StatusUnauthorized, message)
+	if config.EnableBasicAuth {
+		resp.Headers = map[string][]string{
+			headerWWWAuthenticate: {`Basic realm="est"`},
+		}
+	}
+	return resp
+}
+
+const pathEstHelpSyn = `
+EST (RFC 7030) enrollment endpoints.
+`
+
+const pathEstHelpDesc = `
+These unauthenticated endpoints implement the cacerts, simpleenroll and
+simplereenroll operations of EST (RFC 7030), under est/ and est/<label>/;
+see config/est for mapping labels to roles.
+
+Enrollment requests carry a base64-encoded PKCS#10 CSR, with the
+application/pkcs10 content type. Clients authenticate enrollments either
+with HTTP Basic authentication, using an enrollment password bound to the
+label's role as the password, or with a TLS client certificate issued by
+this mount; re-enrollments require the client certificate being renewed.
+`
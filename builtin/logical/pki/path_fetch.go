@@ -32,6 +32,18 @@ func pathFetchCAChain(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: `(cert/)?ca_chain`,
 
+		Fields: map[string]*framework.FieldSchema{
+			"format": {
+				Type:    framework.TypeString,
+				Default: "pem",
+				Description: `Format of the chain: "pem", concatenated PEM
+certificates, or "pkcs7", a PKCS#7 bundle of the certificates; DER
+encoded from ca_chain and PEM encoded from cert/ca_chain. Defaults
+to "pem".`,
+				AllowedValues: []interface{}{"pem", "pkcs7"},
+			},
+		},
+
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.ReadOperation: &framework.PathOperation{
 				Callback: b.pathFetchRead,
@@ -155,7 +167,10 @@ func (b *backend) pathFetchRead(ctx context.Context, req *logical.Request, data
 	var funcErr error
 	var certificate []byte
 	var fullChain []byte
+	var pkcs7Chain bool
 	var revocationTime int64
+	var revocationMetadata *revocationMetadata
+	var responseHeaders map[string][]string
 	response = &logical.Response{
 		Data: map[string]interface{}{},
 	}
@@ -185,8 +200,21 @@ func (b *backend) pathFetchRead(ctx context.Context, req *logical.Request, data
 		}
 	case req.Path == "ca_chain" || req.Path == "cert/ca_chain":
 		serial = "ca_chain"
-		if req.Path == "ca_chain" {
-			contentType = "application/pkix-cert"
+		switch data.Get("format").(string) {
+		case "pem":
+			if req.Path == "ca_chain" {
+				contentType = "application/pkix-cert"
+			}
+		case "pkcs7":
+			pkcs7Chain = true
+			if req.Path == "ca_chain" {
+				contentType = "application/x-pkcs7-certificates"
+			} else {
+				pemType = "PKCS7"
+			}
+		default:
+			response = logical.ErrorResponse(`the "format" parameter must be "pem" or "pkcs7"`)
+			goto reply
 		}
 	case req.Path == "crl" || req.Path == "crl/pem" || req.Path == "crl/delta" || req.Path == "crl/delta/pem" || req.Path == "cert/crl" || req.Path == "cert/crl/raw" || req.Path == "cert/crl/raw/pem":
 		ret, err := sendNotModifiedResponseIfNecessary(&IfModifiedSinceHelper{req: req}, sc, response)
@@ -237,7 +265,25 @@ func (b *backend) pathFetchRead(ctx context.Context, req *logical.Request, data
 			}
 		}
 
-		if serial == "ca_chain" {
+		if serial == "ca_chain" && pkcs7Chain {
+			var certs [][]byte
+			for _, ca := range caInfo.GetFullChain() {
+				certs = append(certs, ca.Bytes)
+			}
+			p7, err := encodePkcs7CertsOnly(certs)
+			if err != nil {
+				retErr = err
+				goto reply
+			}
+			if len(pemType) != 0 {
+				p7 = []byte(strings.TrimSpace(string(pem.EncodeToMemory(&pem.Block{
+					Type:  pemType,
+					Bytes: p7,
+				}))))
+			}
+			fullChain = p7
+			certificate = p7
+		} else if serial == "ca_chain" {
 			rawChain := caInfo.GetFullChain()
 			var chainStr string
 			for _, ca := range rawChain {
@@ -284,11 +330,31 @@ func (b *backend) pathFetchRead(ctx context.Context, req *logical.Request, data
 	}
 
 	certificate = certEntry.Value
+	if serial == legacyCRLPath || serial == deltaCRLPath {
+		certificate, responseHeaders, funcErr = crlResponseBody(req, certEntry.Value, len(pemType) == 0)
+		if funcErr != nil {
+			retErr = funcErr
+			goto reply
+		}
+
+		// Only raw responses can be revalidated.
+		if len(contentType) != 0 && len(certificate) > 0 {
+			validators, err := getServedCRLValidators(certEntry.Value, certificate, len(pemType) != 0, responseHeaders)
+			if err != nil {
+				retErr = err
+				goto reply
+			}
+			if validators.notModified(req) {
+				return crlNotModifiedResponse(validators), nil
+			}
+			responseHeaders = mergeHeaders(responseHeaders, validators.headers())
+		}
+	}
 
 	if len(pemType) != 0 {
 		block := pem.Block{
 			Type:  pemType,
-			Bytes: certEntry.Value,
+			Bytes: certificate,
 		}
 		// This is convoluted on purpose to ensure that we don't have trailing
 		// newlines via various paths
@@ -313,6 +379,7 @@ func (b *backend) pathFetchRead(ctx context.Context, req *logical.Request, data
 			return logical.ErrorResponse(fmt.Sprintf("Error decoding revocation entry for serial %s: %s", serial, err)), nil
 		}
 		revocationTime = revInfo.RevocationTime
+		revocationMetadata = revInfo.Metadata
 	}
 
 reply:
@@ -323,6 +390,7 @@ reply:
 				logical.HTTPContentType: contentType,
 				logical.HTTPRawBody:     certificate,
 			},
+			Headers: responseHeaders,
 		}
 		if retErr != nil {
 			if b.Logger().IsWarn() {
@@ -345,6 +413,9 @@ reply:
 	default:
 		response.Data["certificate"] = string(certificate)
 		response.Data["revocation_time"] = revocationTime
+		if revocationMetadata != nil {
+			response.Data["revocation_metadata"] = revocationMetadata.responseData()
+		}
 
 		if len(fullChain) > 0 {
 			response.Data["ca_chain"] = string(fullChain)
@@ -363,7 +434,7 @@ This allows certificates to be fetched. Use /cert/:serial for JSON responses.
 
 Using "ca" or "crl" as the value fetches the appropriate information in DER encoding. Add "/pem" to either to get PEM encoding.
 
-Using "ca_chain" as the value fetches the certificate authority trust chain in PEM encoding.
+Using "ca_chain" as the value fetches the certificate authority trust chain in PEM encoding, or as a PKCS#7 bundle with format=pkcs7.
 
 Otherwise, specify a serial number to fetch the specified certificate. Add "/raw" to get just the certificate in DER form, "/raw/pem" to get the PEM encoded certificate.
 `
@@ -0,0 +1,294 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathSearchCerts(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "certs/search/?$",
+
+		Fields: map[string]*framework.FieldSchema{
+			"common_name": {
+				Type: framework.TypeString,
+				Description: `Only list certificates with this common name,
+compared case-insensitively.`,
+				Query: true,
+			},
+			"san": {
+				Type: framework.TypeString,
+				Description: `Only list certificates with this subject
+alternative name (DNS name, IP address, email address or URI), compared
+case-insensitively.`,
+				Query: true,
+			},
+			"serial_prefix": {
+				Type: framework.TypeString,
+				Description: `Only list certificates whose serial number
+starts with this prefix, colon- or hyphen-separated.`,
+				Query: true,
+			},
+			"expires_after": {
+				Type: framework.TypeString,
+				Description: `Only list certificates expiring at or after this
+RFC 3339 time.`,
+				Query: true,
+			},
+			"expires_before": {
+				Type: framework.TypeString,
+				Description: `Only list certificates expiring before this RFC
+3339 time.`,
+				Query: true,
+			},
+			"role": {
+				Type:        framework.TypeString,
+				Description: `Only list certificates issued through this role.`,
+				Query:       true,
+			},
+			"limit": {
+				Type: framework.TypeInt,
+				Description: `The maximum number of certificates to list;
+zero (the default) lists all of them.`,
+				Query: true,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.pathSearchCertsHandler,
+			},
+		},
+
+		HelpSynopsis:    pathSearchCertsHelpSyn,
+		HelpDescription: pathSearchCertsHelpDesc,
+	}
+}
+
+func (b *backend) pathSearchCertsHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+
+	limit := data.Get("limit").(int)
+	if limit < 0 {
+		return logical.ErrorResponse(fmt.Sprintf("limit must be greater than or equal to 0 got: %d", limit)), nil
+	}
+
+	commonName := strings.TrimSpace(data.Get("common_name").(string))
+	san := strings.TrimSpace(data.Get("san").(string))
+	serialPrefix := certMetadataSerialKey(strings.TrimSpace(data.Get("serial_prefix").(string)))
+	roleName := data.Get("role").(string)
+
+	var expiresAfter, expiresBefore time.Time
+	if value := data.Get("expires_after").(string); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("given expires_after could not be decoded: %s", err)), nil
+		}
+		expiresAfter = parsed
+	}
+	if value := data.Get("expires_before").(string); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("given expires_before could not be decoded: %s", err)), nil
+		}
+		expiresBefore = parsed
+	}
+
+	// Narrow down the candidates through the most selective index given;
+	// every criterion is then checked against each candidate's metadata.
+	var candidates []string
+	var err error
+	switch {
+	case commonName != "":
+		candidates, err = sc.Storage.List(ctx, certMetadataNamePath+certMetadataNameKey(commonName)+"/")
+	case san != "":
+		candidates, err = sc.Storage.List(ctx, certMetadataNamePath+certMetadataNameKey(san)+"/")
+	case serialPrefix != "":
+		candidates, err = sc.Storage.List(ctx, certMetadataEntryPath)
+	case !expiresAfter.IsZero() || !expiresBefore.IsZero():
+		candidates, err = listCertMetadataExpiring(sc, expiresAfter, expiresBefore)
+	default:
+		return logical.ErrorResponse("at least one of common_name, san, serial_prefix, expires_after or expires_before must be given"), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error searching certificate metadata: %w", err)
+	}
+
+	var matches []*certMetadata
+	for _, serial := range candidates {
+		if serialPrefix != "" && !strings.HasPrefix(serial, serialPrefix) {
+			continue
+		}
+
+		meta, err := sc.fetchCertMetadata(serial)
+		if err != nil {
+			return nil, err
+		}
+		if meta == nil {
+			// Removed since listing.
+			continue
+		}
+
+		if commonName != "" && !strings.EqualFold(meta.CommonName, commonName) {
+			continue
+		}
+		if san != "" && !meta.hasSAN(san) {
+			continue
+		}
+		if roleName != "" && meta.Role != roleName {
+			continue
+		}
+		if !expiresAfter.IsZero() && meta.NotAfter.Before(expiresAfter) {
+			continue
+		}
+		if !expiresBefore.IsZero() && !meta.NotAfter.Before(expiresBefore) {
+			continue
+		}
+		matches = append(matches, meta)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if !matches[i].NotAfter.Equal(matches[j].NotAfter) {
+			return matches[i].NotAfter.Before(matches[j].NotAfter)
+		}
+		return matches[i].SerialNumber < matches[j].SerialNumber
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	responseKeys := make([]string, 0, len(matches))
+	responseInfo := make(map[string]interface{}, len(matches))
+	for _, meta := range matches {
+		responseKeys = append(responseKeys, meta.SerialNumber)
+		responseInfo[meta.SerialNumber] = meta.toResponseData()
+	}
+
+	resp := logical.ListResponseWithInfo(responseKeys, responseInfo)
+	if ready, err := sc.isCertMetadataReady(); err != nil {
+		return nil, err
+	} else if !ready {
+		resp.AddWarning("Certificates stored before this version of Vault are still being indexed; results may be incomplete.")
+	}
+	return resp, nil
+}
+
+func pathCertsByCN(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "certs/by-cn/" + framework.MatchAllRegex("value"),
+
+		Fields: map[string]*framework.FieldSchema{
+			"value": {
+				Type:        framework.TypeString,
+				Description: `Common name to look up, compared case-insensitively.`,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathCertsByNameRead,
+			},
+		},
+
+		HelpSynopsis:    pathCertsByCNHelpSyn,
+		HelpDescription: pathCertsByNameHelpDesc,
+	}
+}
+
+func pathCertsBySAN(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "certs/by-san/" + framework.MatchAllRegex("value"),
+
+		Fields: map[string]*framework.FieldSchema{
+			"value": {
+				Type: framework.TypeString,
+				Description: `Subject alternative name (DNS name, IP address,
+email address or URI) to look up, compared case-insensitively.`,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathCertsByNameRead,
+			},
+		},
+
+		HelpSynopsis:    pathCertsBySANHelpSyn,
+		HelpDescription: pathCertsByNameHelpDesc,
+	}
+}
+
+func (b *backend) pathCertsByNameRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	value := strings.TrimSpace(data.Get("value").(string))
+	if value == "" {
+		return logical.ErrorResponse("a common name or subject alternative name to look up must be given"), nil
+	}
+
+	criterion := "common_name"
+	if strings.HasPrefix(req.Path, "certs/by-san/") {
+		criterion = "san"
+	}
+
+	return b.pathSearchCertsHandler(ctx, req, &framework.FieldData{
+		Raw:    map[string]interface{}{criterion: value},
+		Schema: pathSearchCerts(b).Fields,
+	})
+}
+
+// listCertMetadataExpiring lists the serial numbers of certificates whose
+// expiry day falls within the given (possibly open-ended) window.
+func listCertMetadataExpiring(sc *storageContext, after, before time.Time) ([]string, error) {
+	days, err := sc.Storage.List(sc.Context, certMetadataExpiryPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var serials []string
+	for _, day := range days {
+		day = strings.TrimSuffix(day, "/")
+		if !after.IsZero() && day < certMetadataExpiryKey(after) {
+			continue
+		}
+		if !before.IsZero() && day > certMetadataExpiryKey(before) {
+			continue
+		}
+
+		entries, err := sc.Storage.List(sc.Context, certMetadataExpiryPath+day+"/")
+		if err != nil {
+			return nil, err
+		}
+		serials = append(serials, entries...)
+	}
+	return serials, nil
+}
+
+const (
+	pathSearchCertsHelpSyn  = `Search stored certificates.`
+	pathSearchCertsHelpDesc = `
+This endpoint lists the serial numbers of stored certificates matching a
+common name, subject alternative name, serial number prefix or expiry
+window, along with the metadata recorded when they were issued: role,
+requester, issuer, names and validity. At least one of those criteria
+must be given; results may be further filtered by role, and are ordered
+by expiry.
+`
+
+	pathCertsByCNHelpSyn    = `Look up stored certificates by common name.`
+	pathCertsBySANHelpSyn   = `Look up stored certificates by subject alternative name.`
+	pathCertsByNameHelpDesc = `
+These endpoints are shorthands for certs/search with only the common_name
+(certs/by-cn/) or san (certs/by-san/) criterion: they list the serial
+numbers of the stored certificates with the given name, ordered by expiry,
+along with the metadata recorded when they were issued. Names are compared
+case-insensitively; certificates issued by roles with no_store set aren't
+found.
+
+Use certs/search to combine criteria.
+`
+)
@@ -5,6 +5,7 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"reflect"
 	"strings"
 	"time"
 
@@ -94,10 +95,11 @@ issuer's computed CAChain field, when non-empty.`,
 		Description: `Behavior of leaf's NotAfter fields: "err" to error
 if the computed NotAfter date exceeds that of this issuer; "truncate" to
 silently truncate to that of this issuer; or "permit" to allow this
-issuance to succeed (with NotAfter exceeding that of an issuer). Note that
-not all values will results in certificates that can be validated through
-the entire validity period. It is suggested to use "truncate" for
-intermediate CAs and "permit" only for root CAs.`,
+issuance to succeed (with NotAfter exceeding that of an issuer), with a
+warning. Note that not all values will results in certificates that can be
+validated through the entire validity period. It is suggested to use
+"truncate" for intermediate CAs and "permit" only for root CAs. The mount's
+leaf_not_after_behavior, when set, overrides this.`,
 		Default: "err",
 	}
 	fields["usage"] = &framework.FieldSchema{
@@ -108,6 +110,27 @@ this issuer; valid values are "read-only", "issuing-certificates", and
 and always set.`,
 		Default: []string{"read-only", "issuing-certificates", "crl-signing"},
 	}
+	fields["expiry_warning_threshold"] = &framework.FieldSchema{
+		Type: framework.TypeDurationSecond,
+		Description: `When issuing or signing with this issuer within this
+amount of time of its expiry, a warning is added to the response. Zero (the
+default) disables the warning.`,
+		Default: 0,
+	}
+	fields["serial_number_bits"] = &framework.FieldSchema{
+		Type: framework.TypeInt,
+		Description: `The number of random bits in the serial numbers of
+certificates this issuer issues, at least 64. Zero (the default) uses the
+mount's serial_number_bits.`,
+		Default: 0,
+	}
+	fields["serial_number_prefix"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `Hex-encoded bytes (optionally colon-separated) to
+start the serial numbers of certificates this issuer issues with, ahead of
+the random bits. Empty (the default) uses the mount's serial_number_prefix.`,
+		Default: "",
+	}
 	fields["revocation_signature_algorithm"] = &framework.FieldSchema{
 		Type: framework.TypeString,
 		Description: `Which x509.SignatureAlgorithm name to use for
@@ -134,6 +157,23 @@ for the CRL distribution points attribute. See also RFC 5280 Section 4.2.1.13.`,
 		Description: `Comma-separated list of URLs to be used
 for the OCSP servers attribute. See also RFC 5280 Section 4.2.2.1.`,
 	}
+	fields["idp_uris"] = &framework.FieldSchema{
+		Type: framework.TypeCommaStringSlice,
+		Description: `URIs to include as the distribution point of the
+issuingDistributionPoint extension on this issuer's CRLs. When any idp_
+value is set on the issuer, these replace those of config/crl.`,
+	}
+	fields["idp_only_contains_user_certs"] = &framework.FieldSchema{
+		Type: framework.TypeBool,
+		Description: `If set to true, the issuingDistributionPoint
+extension on this issuer's CRLs asserts they contain only end-entity
+certificates.`,
+	}
+	fields["idp_only_contains_ca_certs"] = &framework.FieldSchema{
+		Type: framework.TypeBool,
+		Description: `If set to true, the issuingDistributionPoint
+extension on this issuer's CRLs asserts they contain only CA certificates.`,
+	}
 
 	return &framework.Path{
 		// Returns a JSON entry.
@@ -222,10 +262,18 @@ func respondReadIssuer(issuer *issuerEntry) (*logical.Response, error) {
 		"leaf_not_after_behavior":        issuer.LeafNotAfterBehavior.String(),
 		"usage":                          issuer.Usage.Names(),
 		"revocation_signature_algorithm": revSigAlgStr,
+		"expiry_warning_threshold":       int64(issuer.ExpiryWarningThreshold.Seconds()),
+		"serial_number_bits":             issuer.SerialNumberBits,
+		"serial_number_prefix":           issuer.SerialNumberPrefix,
 		"revoked":                        issuer.Revoked,
 		"issuing_certificates":           []string{},
 		"crl_distribution_points":        []string{},
 		"ocsp_servers":                   []string{},
+		"idp_uris":                       []string{},
+		"idp_only_contains_user_certs":   false,
+		"idp_only_contains_ca_certs":     false,
+		"cross_signed_from":              issuer.CrossSignedFrom,
+		"pending_key_id":                 issuer.PendingKeyID,
 	}
 
 	if issuer.Revoked {
@@ -239,6 +287,14 @@ func respondReadIssuer(issuer *issuerEntry) (*logical.Response, error) {
 		data["ocsp_servers"] = issuer.AIAURIs.OCSPServers
 	}
 
+	if issuer.CRLIDP != nil {
+		if len(issuer.CRLIDP.URIs) > 0 {
+			data["idp_uris"] = issuer.CRLIDP.URIs
+		}
+		data["idp_only_contains_user_certs"] = issuer.CRLIDP.OnlyContainsUserCerts
+		data["idp_only_contains_ca_certs"] = issuer.CRLIDP.OnlyContainsCACerts
+	}
+
 	return &logical.Response{
 		Data: data,
 	}, nil
@@ -290,17 +346,9 @@ func (b *backend) pathUpdateIssuer(ctx context.Context, req *logical.Request, da
 	}
 
 	newPath := data.Get("manual_chain").([]string)
-	rawLeafBehavior := data.Get("leaf_not_after_behavior").(string)
-	var newLeafBehavior certutil.NotAfterBehavior
-	switch rawLeafBehavior {
-	case "err":
-		newLeafBehavior = certutil.ErrNotAfterBehavior
-	case "truncate":
-		newLeafBehavior = certutil.TruncateNotAfterBehavior
-	case "permit":
-		newLeafBehavior = certutil.PermitNotAfterBehavior
-	default:
-		return logical.ErrorResponse("Unknown value for field `leaf_not_after_behavior`. Possible values are `err`, `truncate`, and `permit`."), nil
+	newLeafBehavior, err := parseLeafNotAfterBehavior(data.Get("leaf_not_after_behavior").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
 	}
 
 	rawUsage := data.Get("usage").([]string)
@@ -312,7 +360,9 @@ func (b *backend) pathUpdateIssuer(ctx context.Context, req *logical.Request, da
 	// Revocation signature algorithm changes
 	revSigAlgStr := data.Get("revocation_signature_algorithm").(string)
 	revSigAlg, present := certutil.SignatureAlgorithmNames[strings.ToLower(revSigAlgStr)]
-	if !present && revSigAlgStr != "" {
+	if info, known := certutil.GetSignatureAlgorithm(strings.ToLower(revSigAlgStr)); !present && known && !info.Available {
+		return logical.ErrorResponse(fmt.Sprintf("Signature algorithm %v is not supported by this build of Vault; see the key-types endpoint for available algorithms", revSigAlgStr)), nil
+	} else if !present && revSigAlgStr != "" {
 		var knownAlgos []string
 		for algoName := range certutil.SignatureAlgorithmNames {
 			knownAlgos = append(knownAlgos, algoName)
@@ -340,6 +390,22 @@ func (b *backend) pathUpdateIssuer(ctx context.Context, req *logical.Request, da
 		return logical.ErrorResponse(fmt.Sprintf("invalid URL found in Authority Information Access (AIA) parameter ocsp_servers: %s", badURL)), nil
 	}
 
+	newWarningThreshold := time.Duration(data.Get("expiry_warning_threshold").(int)) * time.Second
+	if newWarningThreshold < 0 {
+		return logical.ErrorResponse("expiry_warning_threshold must not be negative"), nil
+	}
+
+	newIDP := newCRLIDPConfig(data.Get("idp_uris").([]string), data.Get("idp_only_contains_user_certs").(bool), data.Get("idp_only_contains_ca_certs").(bool))
+	if err := validateCRLIDPConfig(newIDP); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	newSerialBits := data.Get("serial_number_bits").(int)
+	newSerialPrefix, err := validateSerialNumberConfig(data.Get("serial_number_prefix").(string), newSerialBits)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
 	modified := false
 
 	var oldName string
@@ -371,6 +437,10 @@ func (b *backend) pathUpdateIssuer(ctx context.Context, req *logical.Request, da
 			return logical.ErrorResponse(fmt.Sprintf("This issuer's underlying certificate lacks the CRLSign KeyUsage value; unable to set CRLSigningUsage on this issuer as a result.")), nil
 		}
 
+		if err := retireIssuerCRLOnUsageChange(sc, issuer, newUsage); err != nil {
+			return nil, err
+		}
+
 		issuer.Usage = newUsage
 		modified = true
 	}
@@ -380,6 +450,22 @@ func (b *backend) pathUpdateIssuer(ctx context.Context, req *logical.Request, da
 		modified = true
 	}
 
+	if newWarningThreshold != issuer.ExpiryWarningThreshold {
+		issuer.ExpiryWarningThreshold = newWarningThreshold
+		modified = true
+	}
+
+	if newSerialBits != issuer.SerialNumberBits || newSerialPrefix != issuer.SerialNumberPrefix {
+		issuer.SerialNumberBits = newSerialBits
+		issuer.SerialNumberPrefix = newSerialPrefix
+		modified = true
+	}
+
+	if !reflect.DeepEqual(newIDP, issuer.CRLIDP) {
+		issuer.CRLIDP = newIDP
+		modified = true
+	}
+
 	if issuer.AIAURIs == nil && (len(issuerCertificates) > 0 || len(crlDistributionPoints) > 0 || len(ocspServers) > 0) {
 		issuer.AIAURIs = &certutil.URLEntries{}
 	}
@@ -541,17 +627,9 @@ func (b *backend) pathPatchIssuer(ctx context.Context, req *logical.Request, dat
 	// Leaf Not After Changes
 	rawLeafBehaviorData, ok := data.GetOk("leaf_not_after_behaivor")
 	if ok {
-		rawLeafBehavior := rawLeafBehaviorData.(string)
-		var newLeafBehavior certutil.NotAfterBehavior
-		switch rawLeafBehavior {
-		case "err":
-			newLeafBehavior = certutil.ErrNotAfterBehavior
-		case "truncate":
-			newLeafBehavior = certutil.TruncateNotAfterBehavior
-		case "permit":
-			newLeafBehavior = certutil.PermitNotAfterBehavior
-		default:
-			return logical.ErrorResponse("Unknown value for field `leaf_not_after_behavior`. Possible values are `err`, `truncate`, and `permit`."), nil
+		newLeafBehavior, err := parseLeafNotAfterBehavior(rawLeafBehaviorData.(string))
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
 		}
 		if newLeafBehavior != issuer.LeafNotAfterBehavior {
 			issuer.LeafNotAfterBehavior = newLeafBehavior
@@ -581,17 +659,58 @@ func (b *backend) pathPatchIssuer(ctx context.Context, req *logical.Request, dat
 				return logical.ErrorResponse(fmt.Sprintf("This issuer's underlying certificate lacks the CRLSign KeyUsage value; unable to set CRLSigningUsage on this issuer as a result.")), nil
 			}
 
+			if err := retireIssuerCRLOnUsageChange(sc, issuer, newUsage); err != nil {
+				return nil, err
+			}
+
 			issuer.Usage = newUsage
 			modified = true
 		}
 	}
 
+	// Expiry warning threshold changes
+	rawWarningThreshold, ok := data.GetOk("expiry_warning_threshold")
+	if ok {
+		newWarningThreshold := time.Duration(rawWarningThreshold.(int)) * time.Second
+		if newWarningThreshold < 0 {
+			return logical.ErrorResponse("expiry_warning_threshold must not be negative"), nil
+		}
+		if newWarningThreshold != issuer.ExpiryWarningThreshold {
+			issuer.ExpiryWarningThreshold = newWarningThreshold
+			modified = true
+		}
+	}
+
+	// Serial number format changes
+	rawSerialBits, bitsOk := data.GetOk("serial_number_bits")
+	rawSerialPrefix, prefixOk := data.GetOk("serial_number_prefix")
+	if bitsOk || prefixOk {
+		newSerialBits, newSerialPrefix := issuer.SerialNumberBits, issuer.SerialNumberPrefix
+		if bitsOk {
+			newSerialBits = rawSerialBits.(int)
+		}
+		if prefixOk {
+			newSerialPrefix = rawSerialPrefix.(string)
+		}
+		newSerialPrefix, err := validateSerialNumberConfig(newSerialPrefix, newSerialBits)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if newSerialBits != issuer.SerialNumberBits || newSerialPrefix != issuer.SerialNumberPrefix {
+			issuer.SerialNumberBits = newSerialBits
+			issuer.SerialNumberPrefix = newSerialPrefix
+			modified = true
+		}
+	}
+
 	// Revocation signature algorithm changes
 	rawRevSigAlg, ok := data.GetOk("revocation_signature_algorithm")
 	if ok {
 		revSigAlgStr := rawRevSigAlg.(string)
 		revSigAlg, present := certutil.SignatureAlgorithmNames[strings.ToLower(revSigAlgStr)]
-		if !present && revSigAlgStr != "" {
+		if info, known := certutil.GetSignatureAlgorithm(strings.ToLower(revSigAlgStr)); !present && known && !info.Available {
+			return logical.ErrorResponse(fmt.Sprintf("Signature algorithm %v is not supported by this build of Vault; see the key-types endpoint for available algorithms", revSigAlgStr)), nil
+		} else if !present && revSigAlgStr != "" {
 			var knownAlgos []string
 			for algoName := range certutil.SignatureAlgorithmNames {
 				knownAlgos = append(knownAlgos, algoName)
@@ -612,6 +731,35 @@ func (b *backend) pathPatchIssuer(ctx context.Context, req *logical.Request, dat
 		}
 	}
 
+	// CRL issuingDistributionPoint changes
+	_, haveIDPURIs := data.GetOk("idp_uris")
+	_, haveIDPUserCerts := data.GetOk("idp_only_contains_user_certs")
+	_, haveIDPCACerts := data.GetOk("idp_only_contains_ca_certs")
+	if haveIDPURIs || haveIDPUserCerts || haveIDPCACerts {
+		newIDP := &crlIDPConfig{}
+		if issuer.CRLIDP != nil {
+			*newIDP = *issuer.CRLIDP
+		}
+		if rawURIs, ok := data.GetOk("idp_uris"); ok {
+			newIDP.URIs = rawURIs.([]string)
+		}
+		if rawUserCerts, ok := data.GetOk("idp_only_contains_user_certs"); ok {
+			newIDP.OnlyContainsUserCerts = rawUserCerts.(bool)
+		}
+		if rawCACerts, ok := data.GetOk("idp_only_contains_ca_certs"); ok {
+			newIDP.OnlyContainsCACerts = rawCACerts.(bool)
+		}
+		newIDP = newCRLIDPConfig(newIDP.URIs, newIDP.OnlyContainsUserCerts, newIDP.OnlyContainsCACerts)
+		if err := validateCRLIDPConfig(newIDP); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+
+		if !reflect.DeepEqual(newIDP, issuer.CRLIDP) {
+			issuer.CRLIDP = newIDP
+			modified = true
+		}
+	}
+
 	// AIA access changes.
 	if issuer.AIAURIs == nil {
 		issuer.AIAURIs = &certutil.URLEntries{}
@@ -833,7 +981,7 @@ func (b *backend) pathDeleteIssuer(ctx context.Context, req *logical.Request, da
 	}
 	addWarningOnDereferencing(sc, string(issuer.ID), response)
 
-	wasDefault, err := sc.deleteIssuer(ref)
+	wasDefault, err := b.deleteIssuerHoldingLock(sc, issuer, response)
 	if err != nil {
 		return nil, err
 	}
@@ -842,6 +990,28 @@ func (b *backend) pathDeleteIssuer(ctx context.Context, req *logical.Request, da
 		addWarningOnDereferencing(sc, defaultRef, response)
 	}
 
+	return response, nil
+}
+
+// deleteIssuerHoldingLock removes an issuer, along with its references from
+// the issuers configuration, first signing a final CRL on its behalf when
+// configured, and then rebuilding the remaining issuers' chains. Warnings
+// are added to response; the returned bool is whether the issuer was the
+// default. Callers must hold the issuers lock.
+func (b *backend) deleteIssuerHoldingLock(sc *storageContext, issuer *issuerEntry, response *logical.Response) (bool, error) {
+	// Before the issuer goes away, optionally sign one last long-lived CRL
+	// on its behalf; it is served from issuer/:issuer_id/crl afterwards.
+	if built, err := buildRetiredIssuerCRL(sc, issuer, retiredCRLPath+string(issuer.ID)); err != nil {
+		return false, fmt.Errorf("error building final CRL for issuer: %w", err)
+	} else if built {
+		response.AddWarning(fmt.Sprintf("Built a final CRL for issuer %v; it remains available from issuer/%v/crl.", issuer.ID, issuer.ID))
+	}
+
+	wasDefault, err := sc.deleteIssuer(issuer.ID)
+	if err != nil {
+		return wasDefault, err
+	}
+
 	// Since we've deleted an issuer, the chains might've changed. Call the
 	// rebuild code. We shouldn't technically err (as the issuer was deleted
 	// successfully), but log a warning (and to the response) if this fails.
@@ -851,7 +1021,28 @@ func (b *backend) pathDeleteIssuer(ctx context.Context, req *logical.Request, da
 		response.AddWarning(msg)
 	}
 
-	return response, nil
+	return wasDefault, nil
+}
+
+// retireIssuerCRLOnUsageChange builds a final, long-lived CRL in place of
+// the issuer's current one when it is losing its CRL signing usage, as the
+// CRL would otherwise be frozen until it expires.
+func retireIssuerCRLOnUsageChange(sc *storageContext, issuer *issuerEntry, newUsage issuerUsage) error {
+	if !issuer.Usage.HasUsage(CRLSigningUsage) || newUsage.HasUsage(CRLSigningUsage) {
+		return nil
+	}
+
+	crlPath, err := sc.resolveIssuerCRLPath(string(issuer.ID))
+	if err != nil {
+		// No CRL was ever built for this issuer.
+		return nil
+	}
+
+	if _, err := buildRetiredIssuerCRL(sc, issuer, crlPath); err != nil {
+		return fmt.Errorf("error building final CRL for issuer: %w", err)
+	}
+
+	return nil
 }
 
 func addWarningOnDereferencing(sc *storageContext, name string, resp *logical.Response) {
@@ -892,6 +1083,28 @@ func pathGetIssuerCRL(b *backend) *framework.Path {
 	return buildPathGetIssuerCRL(b, pattern)
 }
 
+func pathGetIssuerReasonCRL(b *backend) *framework.Path {
+	pattern := "issuer/" + framework.GenericNameRegex(issuerRefParam) + "/crl/reason/" + framework.GenericNameRegex("reason") + "(/pem|/der)?"
+	path := buildPathGetIssuerCRL(b, pattern)
+	path.Fields["reason"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `Revocation reason of the reason-partitioned CRL to fetch, such as key_compromise.`,
+		Required:    true,
+	}
+	return path
+}
+
+func pathGetIssuerPartitionCRL(b *backend) *framework.Path {
+	pattern := "issuer/" + framework.GenericNameRegex(issuerRefParam) + "/crl/partition/" + framework.GenericNameRegex("partition") + "(/pem|/der|/delta(/pem|/der)?)?"
+	path := buildPathGetIssuerCRL(b, pattern)
+	path.Fields["partition"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `Name of the CRL partition whose CRL to fetch, as set by roles' crl_partition.`,
+		Required:    true,
+	}
+	return path
+}
+
 func buildPathGetIssuerCRL(b *backend, pattern string) *framework.Path {
 	fields := map[string]*framework.FieldSchema{}
 	fields = addIssuerRefNameFields(fields)
@@ -928,6 +1141,7 @@ func (b *backend) pathGetIssuerCRL(ctx context.Context, req *logical.Request, da
 
 	var certificate []byte
 	var contentType string
+	var responseHeaders map[string][]string
 
 	sc := b.makeStorageContext(ctx, req.Storage)
 	response := &logical.Response{}
@@ -938,22 +1152,70 @@ func (b *backend) pathGetIssuerCRL(ctx context.Context, req *logical.Request, da
 	if ret {
 		return response, nil
 	}
-	crlPath, err := sc.resolveIssuerCRLPath(issuerName)
-	if err != nil {
-		return nil, err
+	var reasonName string
+	if rawReason, ok := data.GetOk("reason"); ok {
+		reasonName = strings.ToLower(rawReason.(string))
+		if _, err := parseRevocationReason(reasonName); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
 	}
 
-	if strings.Contains(req.Path, "delta") {
-		crlPath += deltaCRLPathSuffix
+	var partitionName string
+	if rawPartition, ok := data.GetOk("partition"); ok {
+		partitionName = rawPartition.(string)
+		if err := validateCRLPartitionName(partitionName); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
 	}
 
-	crlEntry, err := req.Storage.Get(ctx, crlPath)
+	// Only match the delta suffix itself, as issuer and partition names may
+	// contain "delta" too.
+	isDelta := strings.HasSuffix(strings.TrimSuffix(strings.TrimSuffix(req.Path, "/pem"), "/der"), "/delta")
+
+	crlPath, err := sc.resolveIssuerCRLPath(issuerName)
 	if err != nil {
-		return nil, err
-	}
+		// Deleted issuers may have left a final CRL behind; these can only
+		// be referenced by ID, as the issuer's name is gone.
+		retiredCRL, retiredErr := sc.fetchRetiredIssuerCRL(issuerID(issuerName))
+		if retiredErr != nil || len(retiredCRL) == 0 || isDelta || reasonName != "" || partitionName != "" {
+			return nil, err
+		}
+
+		certificate = retiredCRL
+	} else {
+		if reasonName != "" {
+			crlPath += reasonCRLPathSuffix + reasonName
+		} else if partitionName != "" && isDelta {
+			crlPath += partitionDeltaCRLPathSuffix + partitionName
+		} else if partitionName != "" {
+			crlPath += partitionCRLPathSuffix + partitionName
+		} else if isDelta {
+			crlPath += deltaCRLPathSuffix
+		}
+
+		crlEntry, err := req.Storage.Get(ctx, crlPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if crlEntry != nil && len(crlEntry.Value) > 0 {
+			certificate, responseHeaders, err = crlResponseBody(req, crlEntry.Value, strings.HasSuffix(req.Path, "/der"))
+			if err != nil {
+				return nil, err
+			}
 
-	if crlEntry != nil && len(crlEntry.Value) > 0 {
-		certificate = []byte(crlEntry.Value)
+			// Only raw responses can be revalidated.
+			if strings.HasSuffix(req.Path, "/der") || strings.HasSuffix(req.Path, "/pem") {
+				validators, err := getServedCRLValidators(crlEntry.Value, certificate, strings.HasSuffix(req.Path, "/pem"), responseHeaders)
+				if err != nil {
+					return nil, err
+				}
+				if validators.notModified(req) {
+					return crlNotModifiedResponse(validators), nil
+				}
+				responseHeaders = mergeHeaders(responseHeaders, validators.headers())
+			}
+		}
 	}
 
 	if strings.HasSuffix(req.Path, "/der") {
@@ -987,6 +1249,7 @@ func (b *backend) pathGetIssuerCRL(ctx context.Context, req *logical.Request, da
 				logical.HTTPRawBody:     certificate,
 				logical.HTTPStatusCode:  statusCode,
 			},
+			Headers: responseHeaders,
 		}, nil
 	}
 
@@ -1014,5 +1277,13 @@ or its assigned name value.
  - /issuer/:ref/crl is JSON encoded and contains a PEM CRL,
  - /issuer/:ref/crl/pem contains the PEM-encoded CRL,
  - /issuer/:ref/crl/DER contains the raw DER-encoded (binary) CRL.
+
+When reason_partitions are configured, /issuer/:ref/crl/reason/:reason (and
+its /pem and /der variants) contain the CRL of just the certificates revoked
+for that reason.
+
+Certificates issued by roles with a crl_partition are instead listed on
+/issuer/:ref/crl/partition/:partition (and its /pem and /der variants), with
+their delta CRL at /issuer/:ref/crl/partition/:partition/delta.
 `
 )
@@ -87,6 +87,12 @@ func buildPathKey(b *backend, pattern string) *framework.Path {
 				Type:        framework.TypeString,
 				Description: `Human-readable name for this key.`,
 			},
+			"exportable": {
+				Type: framework.TypeBool,
+				Description: `Whether this key may be exported, along with its
+issuers, through the privileged pkcs12/export/:issuer_ref endpoint.
+Defaults to false; once set, it can't be unset.`,
+			},
 		},
 
 		Operations: map[logical.Operation]framework.OperationHandler{
@@ -121,7 +127,7 @@ will be consulted for the present default key, an identifier of a key,
 or its assigned name value.
 
 Writing to /key/:ref allows updating of the name field associated with
-the certificate.
+the certificate, and marking the key as exportable.
 `
 )
 
@@ -153,9 +159,29 @@ func (b *backend) pathGetKeyHandler(ctx context.Context, req *logical.Request, d
 		keyIdParam:   key.ID,
 		keyNameParam: key.Name,
 		keyTypeParam: string(key.PrivateKeyType),
+		"exportable": key.Exportable,
 	}
 
-	if key.isManagedPrivateKey() {
+	if ref, ok := parseCloudKMSKeyRef([]byte(key.PrivateKey)); ok && key.isManagedPrivateKey() {
+		signer, err := b.cloudKMSSigners.get(ctx, ref)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("unable to reach cloud KMS key of key id %s (%s): %v", key.ID, key.Name, err)), nil
+		}
+
+		keyType, _, err := getKeyTypeAndBitsFromPublicKeyForRole(signer.Public())
+		if err != nil {
+			return nil, err
+		}
+		limit, latency := signer.limiter.stats()
+
+		// Credentials are write-only; only describe the key itself.
+		respData[keyTypeParam] = string(keyType)
+		respData["provider"] = ref.Provider
+		respData["kms_key"] = ref.Key
+		respData["signing_algorithms"] = signer.signatureAlgorithmNames()
+		respData["sign_concurrency_limit"] = limit
+		respData["sign_latency_ms"] = latency.Milliseconds()
+	} else if key.isManagedPrivateKey() {
 		managedKeyUUID, err := key.getManagedKeyUUID()
 		if err != nil {
 			return nil, errutil.InternalError{Err: fmt.Sprintf("failed extracting managed key uuid from key id %s (%s): %v", key.ID, key.Name, err)}
@@ -205,13 +231,33 @@ func (b *backend) pathUpdateKeyHandler(ctx context.Context, req *logical.Request
 		return nil, err
 	}
 
-	newName := data.Get(keyNameParam).(string)
+	// Requests only marking the key as exportable leave its name as is.
+	rawExportable, exportableSet := data.GetOk("exportable")
+	_, nameSet := data.GetOk(keyNameParam)
+	updateName := nameSet || !exportableSet
+
+	newName := key.Name
+	if updateName {
+		newName = data.Get(keyNameParam).(string)
+	}
 	if len(newName) > 0 && !nameMatcher.MatchString(newName) {
 		return logical.ErrorResponse("new key name outside of valid character limits"), nil
 	}
 
-	if newName != key.Name {
+	exportable := key.Exportable
+	if exportableSet {
+		if key.Exportable && !rawExportable.(bool) {
+			return logical.ErrorResponse("key is already exportable and can't be made non-exportable"), nil
+		}
+		if rawExportable.(bool) && key.isManagedPrivateKey() {
+			return logical.ErrorResponse("managed keys can not be made exportable"), nil
+		}
+		exportable = rawExportable.(bool)
+	}
+
+	if newName != key.Name || exportable != key.Exportable {
 		key.Name = newName
+		key.Exportable = exportable
 
 		err := sc.writeKey(*key)
 		if err != nil {
@@ -224,10 +270,11 @@ func (b *backend) pathUpdateKeyHandler(ctx context.Context, req *logical.Request
 			keyIdParam:   key.ID,
 			keyNameParam: key.Name,
 			keyTypeParam: key.PrivateKeyType,
+			"exportable": key.Exportable,
 		},
 	}
 
-	if len(newName) == 0 {
+	if updateName && len(newName) == 0 {
 		resp.AddWarning("Name successfully deleted, you will now need to reference this key by it's Id: " + string(key.ID))
 	}
 
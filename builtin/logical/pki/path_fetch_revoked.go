@@ -0,0 +1,158 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathListRevokedCerts(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "certs/revoked/?$",
+
+		Fields: map[string]*framework.FieldSchema{
+			"after": {
+				Type: framework.TypeString,
+				Description: `Only list serial numbers sorting after this one;
+for paging, pass the last serial number of the previous page.`,
+				Query: true,
+			},
+			"limit": {
+				Type: framework.TypeInt,
+				Description: `The maximum number of revoked certificates to
+list; zero (the default) lists all of them.`,
+				Query: true,
+			},
+			issuerRefParam: {
+				Type: framework.TypeString,
+				Description: `Only list certificates revoked under this issuer,
+by reference (name, ID, or "default").`,
+				Query: true,
+			},
+			"revoked_after": {
+				Type: framework.TypeString,
+				Description: `Only list certificates revoked at or after this
+RFC 3339 time.`,
+				Query: true,
+			},
+			"revoked_before": {
+				Type: framework.TypeString,
+				Description: `Only list certificates revoked before this RFC
+3339 time.`,
+				Query: true,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.pathListRevokedCertsHandler,
+			},
+		},
+
+		HelpSynopsis:    pathListRevokedCertsHelpSyn,
+		HelpDescription: pathListRevokedCertsHelpDesc,
+	}
+}
+
+func (b *backend) pathListRevokedCertsHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+
+	limit := data.Get("limit").(int)
+	if limit < 0 {
+		return logical.ErrorResponse(fmt.Sprintf("limit must be greater than or equal to 0 got: %d", limit)), nil
+	}
+
+	after := normalizeSerial(data.Get("after").(string))
+
+	var revokedAfter, revokedBefore time.Time
+	if value := data.Get("revoked_after").(string); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("given revoked_after could not be decoded: %s", err)), nil
+		}
+		revokedAfter = parsed
+	}
+	if value := data.Get("revoked_before").(string); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("given revoked_before could not be decoded: %s", err)), nil
+		}
+		revokedBefore = parsed
+	}
+
+	var issuerFilter issuerID
+	if issuerRef := data.Get(issuerRefParam).(string); issuerRef != "" {
+		if b.useLegacyBundleCaStorage() {
+			return logical.ErrorResponse("Can not filter by issuer until migration has completed"), nil
+		}
+
+		id, err := sc.resolveIssuerReference(issuerRef)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("unable to resolve issuer %v: %v", issuerRef, err)), nil
+		}
+		issuerFilter = id
+	}
+
+	summaries, err := listRevocationSummaries(sc)
+	if err != nil {
+		return nil, err
+	}
+
+	serials := make([]string, 0, len(summaries))
+	for serial, summary := range summaries {
+		if after != "" && serial <= after {
+			continue
+		}
+		if issuerFilter != "" && summary.CertificateIssuer != issuerFilter {
+			continue
+		}
+		if !revokedAfter.IsZero() && summary.RevocationTimeUTC.Before(revokedAfter) {
+			continue
+		}
+		if !revokedBefore.IsZero() && !summary.RevocationTimeUTC.Before(revokedBefore) {
+			continue
+		}
+		serials = append(serials, serial)
+	}
+
+	sort.Strings(serials)
+	if limit > 0 && len(serials) > limit {
+		serials = serials[:limit]
+	}
+
+	responseKeys := make([]string, 0, len(serials))
+	responseInfo := make(map[string]interface{}, len(serials))
+	for _, serial := range serials {
+		summary := summaries[serial]
+		key := denormalizeSerial(serial)
+
+		info := map[string]interface{}{
+			"revocation_time":         summary.RevocationTimeUTC.Unix(),
+			"revocation_time_rfc3339": summary.RevocationTimeUTC.Format(time.RFC3339Nano),
+			"reason":                  revocationReasonName(summary.Reason),
+			"issuer_id":               summary.CertificateIssuer,
+		}
+		if summary.Metadata != nil {
+			info["revocation_metadata"] = summary.Metadata.responseData()
+		}
+
+		responseKeys = append(responseKeys, key)
+		responseInfo[key] = info
+	}
+
+	return logical.ListResponseWithInfo(responseKeys, responseInfo), nil
+}
+
+const (
+	pathListRevokedCertsHelpSyn  = `List revoked certificates.`
+	pathListRevokedCertsHelpDesc = `
+This endpoint lists the serial numbers of revoked certificates, in order,
+along with their revocation time, reason, issuer, and any metadata given
+when revoking them. Results may be filtered by issuer and by revocation
+time, and paged through with the "after" and "limit" parameters.
+`
+)
@@ -0,0 +1,170 @@
+package pki
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathIssuerHealth(b *backend) *framework.Path {
+	fields := map[string]*framework.FieldSchema{}
+	fields = addIssuerRefField(fields)
+
+	return &framework.Path{
+		Pattern: "issuer/" + framework.GenericNameRegex(issuerRefParam) + "/health",
+		Fields:  fields,
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathReadIssuerHealth,
+			},
+		},
+
+		HelpSynopsis:    pathIssuerHealthHelpSyn,
+		HelpDescription: pathIssuerHealthHelpDesc,
+	}
+}
+
+func pathHealthCheck(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "health-check",
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathReadHealthCheck,
+			},
+		},
+
+		HelpSynopsis:    pathHealthCheckHelpSyn,
+		HelpDescription: pathHealthCheckHelpDesc,
+	}
+}
+
+func (b *backend) pathReadIssuerHealth(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if b.useLegacyBundleCaStorage() {
+		return logical.ErrorResponse("Can not check issuer health until migration has completed"), nil
+	}
+
+	issuerName := getIssuerRef(data)
+	if len(issuerName) == 0 {
+		return logical.ErrorResponse("missing issuer reference"), nil
+	}
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+	id, err := sc.resolveIssuerReference(issuerName)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return logical.ErrorResponse("unable to resolve issuer id for reference: " + issuerName), nil
+	}
+
+	issuer, err := sc.fetchIssuerById(id)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := sc.loadHealthCheckState()
+	if err != nil {
+		return nil, err
+	}
+
+	health, err := checkIssuerHealth(issuer, state)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: health.ToResponseData(state.now),
+	}, nil
+}
+
+func (b *backend) pathReadHealthCheck(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	if b.useLegacyBundleCaStorage() {
+		return logical.ErrorResponse("Can not check issuer health until migration has completed"), nil
+	}
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+	state, err := sc.loadHealthCheckState()
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := sc.listIssuers()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var findings []healthFinding
+	issuers := make(map[string]interface{}, len(ids))
+	for _, id := range ids {
+		issuer, err := sc.fetchIssuerById(id)
+		if err != nil {
+			return nil, err
+		}
+
+		health, err := checkIssuerHealth(issuer, state)
+		if err != nil {
+			return nil, err
+		}
+
+		findings = append(findings, health.Findings...)
+		issuers[id.String()] = health.ToResponseData(state.now)
+	}
+
+	// Requests not naming an issuer use the default, so a mount without
+	// one can only serve requests which do.
+	if len(ids) > 0 {
+		config, err := sc.getIssuersConfig()
+		if err != nil {
+			return nil, err
+		}
+		if config.DefaultIssuerId == "" {
+			findings = append(findings, healthFinding{
+				Check:    "default_issuer",
+				Severity: healthSeverityWarning,
+				Message:  "the mount has issuers, but no default issuer",
+			})
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"healthy":    findingsHealthy(findings),
+			"findings":   findingsResponseData(findings),
+			"issuers":    issuers,
+			"checked_at": state.now.UTC().Format(time.RFC3339),
+		},
+	}, nil
+}
+
+const pathIssuerHealthHelpSyn = `
+Check the health of an issuer.
+`
+
+const pathIssuerHealthHelpDesc = `
+Validates that the issuer's CA chain builds, reports the days until the
+issuer expires, checks that its CRL hasn't expired, and flags key usages on
+its certificate which don't permit the usages configured on the issuer.
+
+Each problem is returned as a finding with a check, a severity and a
+message. The issuer is healthy unless a finding is critical; warnings
+(such as an issuer within its expiry_warning_threshold, or 30 days, of
+expiry) are for acting on before they become critical.
+`
+
+const pathHealthCheckHelpSyn = `
+Check the health of every issuer in the mount.
+`
+
+const pathHealthCheckHelpDesc = `
+Runs the checks of /issuer/:issuer_ref/health against every issuer in the
+mount, along with mount-wide checks such as there being a default issuer.
+All findings are returned together, each naming the issuer it concerns, as
+well as the report of each issuer. The mount is healthy unless a finding is
+critical.
+`
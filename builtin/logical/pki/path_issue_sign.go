@@ -187,14 +187,25 @@ func (b *backend) pathIssue(ctx context.Context, req *logical.Request, data *fra
 	if role.KeyType == "any" {
 		return logical.ErrorResponse("role key type \"any\" not allowed for issuing certificates, only signing"), nil
 	}
+	if role.RequireApproval {
+		return logical.ErrorResponse("this role requires approval of each request, so only signs CSRs; submit one through the sign/:role endpoint instead"), nil
+	}
 
-	return b.pathIssueSignCert(ctx, req, data, role, false, false)
+	return b.pathIssueSignCert(ctx, req, data, role, false, false, false)
 }
 
 // pathSign issues a certificate from a submitted CSR, subject to role
 // restrictions
 func (b *backend) pathSign(ctx context.Context, req *logical.Request, data *framework.FieldData, role *roleEntry) (*logical.Response, error) {
-	return b.pathIssueSignCert(ctx, req, data, role, true, false)
+	if role.RequireApproval {
+		// Refuse requests which could never be approved.
+		sc := b.makeStorageContext(ctx, req.Storage)
+		if resp, err := sc.checkRoleAllowedIssuer(role, requestIssuerRef(req, data, role)); resp != nil || err != nil {
+			return resp, err
+		}
+		return b.queueSignRequest(ctx, req, data, role)
+	}
+	return b.pathIssueSignCert(ctx, req, data, role, true, false, false)
 }
 
 // pathSignVerbatim issues a certificate from a submitted CSR, *not* subject to
@@ -212,6 +223,7 @@ func (b *backend) pathSignVerbatim(ctx context.Context, req *logical.Request, da
 		AllowedOtherSANs:          []string{"*"},
 		AllowedSerialNumbers:      []string{"*"},
 		AllowedURISANs:            []string{"*"},
+		AllowedExtensionOIDs:      []string{"*"},
 		CNValidations:             []string{"disabled"},
 		GenerateLease:             new(bool),
 		KeyUsage:                  data.Get("key_usage").([]string),
@@ -237,57 +249,148 @@ func (b *backend) pathSignVerbatim(ctx context.Context, req *logical.Request, da
 		if role.NotBeforeDuration > 0 {
 			entry.NotBeforeDuration = role.NotBeforeDuration
 		}
+		entry.AllowNotBefore = role.AllowNotBefore
 		entry.NoStore = role.NoStore
 		entry.Issuer = role.Issuer
+		entry.AllowedIssuers = role.AllowedIssuers
+		entry.CRLPartition = role.CRLPartition
+		entry.Name = role.Name
+		entry.IssuanceRateLimit = role.IssuanceRateLimit
+		entry.IssuanceRatePeriod = role.IssuanceRatePeriod
+		entry.MaxActiveCertificates = role.MaxActiveCertificates
 	}
 
 	if len(entry.Issuer) == 0 {
 		entry.Issuer = defaultRef
 	}
 
-	return b.pathIssueSignCert(ctx, req, data, entry, true, true)
+	return b.pathIssueSignCert(ctx, req, data, entry, true, true, false)
 }
 
-func (b *backend) pathIssueSignCert(ctx context.Context, req *logical.Request, data *framework.FieldData, role *roleEntry, useCSR, useCSRValues bool) (*logical.Response, error) {
-	// If storing the certificate and on a performance standby, forward this request on to the primary
-	// Allow performance secondaries to generate and store certificates locally to them.
-	if !role.NoStore && b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby) {
-		return nil, logical.ErrReadOnly
-	}
-
+// requestIssuerRef returns the reference to the issuer a request to one of
+// the issuance paths is to be served by, or an empty string when the path
+// requires one and none was given.
+func requestIssuerRef(req *logical.Request, data *framework.FieldData, role *roleEntry) string {
 	// We prefer the issuer from the role in two cases:
 	//
 	// 1. On the legacy sign-verbatim paths, as we always provision an issuer
 	//    in both the role and role-less cases, and
-	// 2. On the legacy sign/:role or issue/:role paths, as the issuer was
-	//    set on the role directly (either via upgrade or not). Note that
+	// 2. On the legacy sign/:role or issue/:role paths and the renew,
+	//    enrollment, EST, SCEP and CMP paths, as the issuer was set on the role directly (either via
+	//    upgrade or not). Note that
 	//    the updated issuer/:ref/{sign,issue}/:role path is not affected,
 	//    and we instead pull the issuer out of the path instead (which
 	//    allows users with access to those paths to manually choose their
 	//    issuer in desired scenarios).
-	var issuerName string
-	if strings.HasPrefix(req.Path, "sign-verbatim/") || strings.HasPrefix(req.Path, "sign/") || strings.HasPrefix(req.Path, "issue/") {
-		issuerName = role.Issuer
-		if len(issuerName) == 0 {
-			issuerName = defaultRef
+	if strings.HasPrefix(req.Path, "sign-verbatim/") || strings.HasPrefix(req.Path, "sign/") || strings.HasPrefix(req.Path, "issue/") || strings.HasPrefix(req.Path, "renew/") || strings.HasPrefix(req.Path, "enrollment/") || strings.HasPrefix(req.Path, "est/") || strings.HasPrefix(req.Path, "scep/") || req.Path == "cmp" || strings.HasPrefix(req.Path, "cmp/") {
+		if len(role.Issuer) == 0 {
+			return defaultRef
 		}
-	} else {
-		// Otherwise, we must have a newer API which requires an issuer
-		// reference. Fetch it in this case
-		issuerName = getIssuerRef(data)
-		if len(issuerName) == 0 {
-			return logical.ErrorResponse("missing issuer reference"), nil
+		return role.Issuer
+	}
+
+	// Otherwise, we must have a newer API which requires an issuer
+	// reference.
+	return getIssuerRef(data)
+}
+
+// checkRoleAllowedIssuer refuses requests to issue from issuers outside
+// the role's allowed_issuers, when it has any. Like issuer_ref, the
+// references are resolved at use, so follow renames and default changes.
+func (sc *storageContext) checkRoleAllowedIssuer(role *roleEntry, issuerRef string) (*logical.Response, error) {
+	if len(role.AllowedIssuers) == 0 {
+		return nil, nil
+	}
+
+	// "default" stands for whichever default issuer is in use, fallbacks
+	// included.
+	resolve := func(ref string) (issuerID, error) {
+		if ref == defaultRef {
+			id, _, err := sc.resolveUsableDefaultIssuer(IssuanceUsage)
+			return id, err
+		}
+		return sc.resolveIssuerReference(ref)
+	}
+
+	id, err := resolve(issuerRef)
+	if err != nil {
+		if id == IssuerRefNotFound {
+			return logical.ErrorResponse(fmt.Sprintf("unable to find issuer %v", issuerRef)), nil
+		}
+		return nil, err
+	}
+
+	for _, allowedRef := range role.AllowedIssuers {
+		allowedId, err := resolve(allowedRef)
+		if err != nil {
+			if allowedId == IssuerRefNotFound {
+				continue
+			}
+			return nil, err
+		}
+		if allowedId == id {
+			return nil, nil
 		}
 	}
 
+	return logical.ErrorResponse(fmt.Sprintf("role %v may only issue from its allowed_issuers (%v), which don't include issuer %v", role.Name, strings.Join(role.AllowedIssuers, ", "), issuerRef)), nil
+}
+
+// pathIssueSignCert issues or signs a certificate through the given role.
+// With dryRun, the request is only validated: the certificate it would
+// produce is described, but nothing is signed or stored.
+func (b *backend) pathIssueSignCert(ctx context.Context, req *logical.Request, data *framework.FieldData, role *roleEntry, useCSR, useCSRValues, dryRun bool) (*logical.Response, error) {
+	return b.issueSignCert(ctx, req, data, role, useCSR, useCSRValues, dryRun, false)
+}
+
+// issueSignCert is pathIssueSignCert, for callers which may have verified
+// proof of possession of the CSR's key themselves (csrPossessionVerified),
+// rather than through the CSR's signature.
+func (b *backend) issueSignCert(ctx context.Context, req *logical.Request, data *framework.FieldData, role *roleEntry, useCSR, useCSRValues, dryRun, csrPossessionVerified bool) (*logical.Response, error) {
+	// If storing the certificate or tracking the role's issuance limits and
+	// on a performance standby, forward this request on to the primary.
+	// Allow performance secondaries to generate and store certificates locally to them.
+	if !dryRun && (!role.NoStore || roleHasIssuanceLimits(role)) && b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby) {
+		return nil, logical.ErrReadOnly
+	}
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+	mountConfig, err := sc.getMountConfig()
+	if err != nil {
+		return nil, err
+	}
+	if mountConfig.CAOnly {
+		return logical.ErrorResponse("this mount is configured as CA-only (ca_only on config/mount); leaf certificates cannot be issued or signed here"), nil
+	}
+
+	issuerName := requestIssuerRef(req, data, role)
+	if len(issuerName) == 0 {
+		return logical.ErrorResponse("missing issuer reference"), nil
+	}
+
+	// Settle which issuer "default" stands for now, in case it falls back,
+	// so that everything below agrees on the issuer used.
+	var fallbackWarning string
+	if issuerName == defaultRef && !b.useLegacyBundleCaStorage() {
+		defaultId, fellBack, err := sc.resolveUsableDefaultIssuer(IssuanceUsage)
+		if err == nil {
+			if fellBack {
+				fallbackWarning = fmt.Sprintf("The default issuer can't currently issue certificates; issued by fallback default issuer %v instead.", defaultId)
+			}
+			issuerName = defaultId.String()
+		}
+	}
+	if resp, err := sc.checkRoleAllowedIssuer(role, issuerName); resp != nil || err != nil {
+		return resp, err
+	}
+
 	format := getFormat(data)
 	if format == "" {
 		return logical.ErrorResponse(
-			`the "format" path parameter must be "pem", "der", or "pem_bundle"`), nil
+			`the "format" path parameter must be "pem", "der", "pem_bundle" or "pkcs7"`), nil
 	}
 
 	var caErr error
-	sc := b.makeStorageContext(ctx, req.Storage)
 	signingBundle, caErr := sc.fetchCAInfo(issuerName, IssuanceUsage)
 	if caErr != nil {
 		switch caErr.(type) {
@@ -300,19 +403,77 @@ func (b *backend) pathIssueSignCert(ctx context.Context, req *logical.Request, d
 		}
 	}
 
+	if mountConfig.LeafNotAfterBehavior != "" {
+		signingBundle.LeafNotAfterBehavior, err = parseLeafNotAfterBehavior(mountConfig.LeafNotAfterBehavior)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if role.CRLPartition != "" {
+		if err := sc.applyCRLPartitionURLs(signingBundle, issuerName, role.CRLPartition); err != nil {
+			if _, ok := err.(errutil.UserError); ok {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+			return nil, err
+		}
+	}
+
+	if role.OCSPMustStaple {
+		if err := validateOCSPMustStaple(sc, signingBundle); err != nil {
+			if _, ok := err.(errutil.UserError); ok {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+			return nil, err
+		}
+	}
+
+	// Refuse requests once the role is at its limits before doing the work
+	// of signing; the issuance is reserved now and settled once signed,
+	// below.
+	var reservation *roleIssuanceReservation
+	if roleHasIssuanceLimits(role) {
+		var resp *logical.Response
+		reservation, resp, err = b.reserveRoleIssuance(sc, role, dryRun)
+		if resp != nil || err != nil {
+			return resp, err
+		}
+	}
+
+	if dryRun {
+		input := &inputBundle{
+			req:                  req,
+			apiData:              data,
+			role:                 role,
+			mountIssuancePolicy:  mountConfig.IssuancePolicy,
+			maxNotBeforeDuration: mountConfig.MaxNotBeforeDuration,
+		}
+		return validateIssueSignCert(sc, input, signingBundle, issuerName, useCSR, useCSRValues, fallbackWarning)
+	}
+
+	ctSubmission, err := newCTSubmission(sc, signingBundle)
+	if err != nil {
+		b.releaseRoleIssuance(sc, role, reservation)
+		return nil, err
+	}
+
 	input := &inputBundle{
-		req:     req,
-		apiData: data,
-		role:    role,
+		req:                   req,
+		apiData:               data,
+		role:                  role,
+		mountIssuancePolicy:   mountConfig.IssuancePolicy,
+		maxNotBeforeDuration:  mountConfig.MaxNotBeforeDuration,
+		ctSubmission:          ctSubmission,
+		csrPossessionVerified: csrPossessionVerified,
 	}
 	var parsedBundle *certutil.ParsedCertBundle
-	var err error
 	if useCSR {
 		parsedBundle, err = signCert(b, input, signingBundle, false, useCSRValues)
 	} else {
 		parsedBundle, err = generateCert(sc, input, signingBundle, false, rand.Reader)
 	}
 	if err != nil {
+		b.releaseRoleIssuance(sc, role, reservation)
 		switch err.(type) {
 		case errutil.UserError:
 			return logical.ErrorResponse(err.Error()), nil
@@ -323,6 +484,12 @@ func (b *backend) pathIssueSignCert(ctx context.Context, req *logical.Request, d
 		}
 	}
 
+	// The certificate is issued regardless; should this fail, the
+	// reservation keeps it counted until it lapses.
+	if err := b.completeRoleIssuance(sc, role, reservation, parsedBundle.Certificate); err != nil {
+		b.Logger().Warn("unable to record issuance against role limits", "role", role.Name, "error", err)
+	}
+
 	signingCB, err := signingBundle.ToCertBundle()
 	if err != nil {
 		return nil, fmt.Errorf("error converting raw signing bundle to cert bundle: %w", err)
@@ -361,6 +528,24 @@ func (b *backend) pathIssueSignCert(ctx context.Context, req *logical.Request, d
 			respData["private_key_type"] = cb.PrivateKeyType
 		}
 
+	case "pkcs7":
+		certs := [][]byte{parsedBundle.CertificateBytes}
+		for _, caCert := range parsedBundle.CAChain {
+			certs = append(certs, caCert.Bytes)
+		}
+		respData["certificate"], err = encodePkcs7CertsPEM(certs)
+		if err != nil {
+			return nil, err
+		}
+		respData["issuing_ca"] = signingCB.Certificate
+		if cb.CAChain != nil && len(cb.CAChain) > 0 {
+			respData["ca_chain"] = cb.CAChain
+		}
+		if !useCSR {
+			respData["private_key"] = cb.PrivateKey
+			respData["private_key_type"] = cb.PrivateKeyType
+		}
+
 	case "der":
 		respData["certificate"] = base64.StdEncoding.EncodeToString(parsedBundle.CertificateBytes)
 		respData["issuing_ca"] = base64.StdEncoding.EncodeToString(signingBundle.CertificateBytes)
@@ -407,7 +592,17 @@ func (b *backend) pathIssueSignCert(ctx context.Context, req *logical.Request, d
 		}
 	}
 
+	// Resolving the issuer again only fails if it was removed since
+	// signing; the metadata and event are still worth keeping without it.
+	signingIssuer, _ := sc.resolveIssuerReference(issuerName)
+
 	if !role.NoStore {
+		meta := newCertMetadata(parsedBundle.Certificate, signingIssuer, role.Name, req)
+		meta.CRLPartition = role.CRLPartition
+		if err := sc.writeCertMetadata(meta); err != nil {
+			return nil, err
+		}
+
 		err = req.Storage.Put(ctx, &logical.StorageEntry{
 			Key:   "certs/" + normalizeSerial(cb.SerialNumber),
 			Value: parsedBundle.CertificateBytes,
@@ -415,6 +610,31 @@ func (b *backend) pathIssueSignCert(ctx context.Context, req *logical.Request, d
 		if err != nil {
 			return nil, fmt.Errorf("unable to store certificate locally: %w", err)
 		}
+		b.usageStats.certStored("certs/"+normalizeSerial(cb.SerialNumber), parsedBundle.CertificateBytes)
+	}
+	b.usageStats.issued(role.Name)
+
+	eventType := eventTypeIssue
+	if useCSR {
+		eventType = eventTypeSign
+	}
+	b.publishEvent(sc, eventType, issuanceEvent(parsedBundle.Certificate, signingIssuer, role.Name))
+
+	b.trackIssuedCertForOcsp(sc, signingBundle.Certificate, parsedBundle.Certificate.SerialNumber)
+
+	if fallbackWarning != "" {
+		resp.AddWarning(fallbackWarning)
+	}
+	if warning := issuerExpiryWarning(sc, issuerName, signingBundle.Certificate); warning != "" {
+		resp.AddWarning(warning)
+	}
+	if warning := leafNotAfterWarning(parsedBundle.Certificate.NotAfter, signingBundle.Certificate); warning != "" {
+		resp.AddWarning(warning)
+	}
+	if ctSubmission != nil {
+		for _, warning := range ctSubmission.warnings {
+			resp.AddWarning(warning)
+		}
 	}
 
 	if useCSR {
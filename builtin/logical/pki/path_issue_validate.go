@@ -0,0 +1,283 @@
+package pki
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathIssueValidate(b *backend) *framework.Path {
+	pattern := "issue/" + framework.GenericNameRegex("role") + "/validate"
+	return buildPathIssueValidate(b, pattern)
+}
+
+func pathIssuerIssueValidate(b *backend) *framework.Path {
+	pattern := "issuer/" + framework.GenericNameRegex(issuerRefParam) + "/issue/" + framework.GenericNameRegex("role") + "/validate"
+	return buildPathIssueValidate(b, pattern)
+}
+
+func buildPathIssueValidate(b *backend, pattern string) *framework.Path {
+	ret := buildPathIssue(b, pattern)
+	ret.Operations = map[logical.Operation]framework.OperationHandler{
+		logical.UpdateOperation: &framework.PathOperation{
+			Callback: b.metricsWrap("issue-validate", roleRequired, b.pathIssueValidate),
+		},
+	}
+	ret.HelpSynopsis = pathIssueValidateHelpSyn
+	ret.HelpDescription = pathIssueValidateHelpDesc
+	return ret
+}
+
+func pathSignValidate(b *backend) *framework.Path {
+	pattern := "sign/" + framework.GenericNameRegex("role") + "/validate"
+	return buildPathSignValidate(b, pattern)
+}
+
+func pathIssuerSignValidate(b *backend) *framework.Path {
+	pattern := "issuer/" + framework.GenericNameRegex(issuerRefParam) + "/sign/" + framework.GenericNameRegex("role") + "/validate"
+	return buildPathSignValidate(b, pattern)
+}
+
+func buildPathSignValidate(b *backend, pattern string) *framework.Path {
+	ret := buildPathSign(b, pattern)
+	ret.Operations = map[logical.Operation]framework.OperationHandler{
+		logical.UpdateOperation: &framework.PathOperation{
+			Callback: b.metricsWrap("sign-validate", roleRequired, b.pathSignValidate),
+		},
+	}
+	ret.HelpSynopsis = pathSignValidateHelpSyn
+	ret.HelpDescription = pathSignValidateHelpDesc
+	return ret
+}
+
+// pathIssueValidate checks a request to issue/:role without issuing
+// anything.
+func (b *backend) pathIssueValidate(ctx context.Context, req *logical.Request, data *framework.FieldData, role *roleEntry) (*logical.Response, error) {
+	if role.KeyType == "any" {
+		return logical.ErrorResponse("role key type \"any\" not allowed for issuing certificates, only signing"), nil
+	}
+	if role.RequireApproval {
+		return logical.ErrorResponse("this role requires approval of each request, so only signs CSRs; submit one through the sign/:role endpoint instead"), nil
+	}
+
+	return b.pathIssueSignCert(ctx, req, data, role, false, false, true)
+}
+
+// pathSignValidate checks a request to sign/:role without signing (or, for
+// roles requiring approval, queueing) anything.
+func (b *backend) pathSignValidate(ctx context.Context, req *logical.Request, data *framework.FieldData, role *roleEntry) (*logical.Response, error) {
+	resp, err := b.pathIssueSignCert(ctx, req, data, role, true, false, true)
+	if err != nil || resp.IsError() {
+		return resp, err
+	}
+
+	if role.RequireApproval {
+		resp.AddWarning("This role requires approval of each request; a signing request would be queued until approved.")
+	}
+	return resp, nil
+}
+
+// validateIssueSignCert runs the role and policy checks of a request to
+// issue or sign a certificate with signingBundle, and describes the
+// certificate it would produce.
+func validateIssueSignCert(sc *storageContext, input *inputBundle, signingBundle *certutil.CAInfoBundle, issuerName string, useCSR, useCSRValues bool, fallbackWarning string) (*logical.Response, error) {
+	var creation *certutil.CreationBundle
+	var err error
+	if useCSR {
+		creation, err = prepareSignCert(sc.Backend, input, signingBundle, false, useCSRValues)
+	} else {
+		creation, err = prepareGenerateCert(sc, input, signingBundle, false)
+	}
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		case errutil.InternalError:
+			return nil, err
+		default:
+			return nil, fmt.Errorf("error validating certificate request: %w", err)
+		}
+	}
+
+	resp := &logical.Response{
+		Data: certTemplateResponseData(creation),
+	}
+
+	if !sc.Backend.useLegacyBundleCaStorage() {
+		if issuerId, err := sc.resolveIssuerReference(issuerName); err == nil {
+			resp.Data["issuer_id"] = issuerId
+		}
+	}
+
+	if fallbackWarning != "" {
+		resp.AddWarning(fallbackWarning)
+	}
+	if warning := leafNotAfterWarning(creation.Params.NotAfter, signingBundle.Certificate); warning != "" {
+		resp.AddWarning(warning)
+	}
+	if useCSR && creation.CSR != nil {
+		resp.Data["key_type"], resp.Data["key_bits"] = csrKeyTypeAndBits(creation.CSR)
+	}
+	return resp, nil
+}
+
+// certTemplateResponseData describes the certificate the given parameters
+// would produce. Values taken from the CSR when signing with its values
+// (as sign-verbatim does) aren't reflected.
+func certTemplateResponseData(creation *certutil.CreationBundle) map[string]interface{} {
+	params := creation.Params
+
+	var ipAddresses []string
+	for _, ip := range params.IPAddresses {
+		ipAddresses = append(ipAddresses, ip.String())
+	}
+	var uris []string
+	for _, uri := range params.URIs {
+		uris = append(uris, uri.String())
+	}
+
+	template := &x509.Certificate{}
+	certutil.AddKeyUsages(creation, template)
+	certutil.AddPolicyIdentifiers(creation, template)
+
+	var policyIdentifiers []string
+	for _, oid := range template.PolicyIdentifiers {
+		policyIdentifiers = append(policyIdentifiers, oid.String())
+	}
+
+	notBefore := time.Now().Add(-1 * params.NotBeforeDuration)
+	if !params.NotBefore.IsZero() {
+		notBefore = params.NotBefore
+	}
+
+	urls := &certutil.URLEntries{}
+	if params.URLs != nil {
+		urls = params.URLs
+	}
+
+	return map[string]interface{}{
+		"subject":                            params.Subject.String(),
+		"common_name":                        params.Subject.CommonName,
+		"dns_names":                          params.DNSNames,
+		"ip_addresses":                       ipAddresses,
+		"email_addresses":                    params.EmailAddresses,
+		"uri_sans":                           uris,
+		"other_sans":                         params.OtherSANs,
+		"key_type":                           params.KeyType,
+		"key_bits":                           params.KeyBits,
+		"signature_bits":                     params.SignatureBits,
+		"use_pss":                            params.UsePSS,
+		"not_before":                         notBefore.UTC().Format(time.RFC3339),
+		"not_after":                          params.NotAfter.UTC().Format(time.RFC3339),
+		"key_usage":                          keyUsageNames(template.KeyUsage),
+		"ext_key_usage":                      extKeyUsageNames(template.ExtKeyUsage),
+		"ext_key_usage_oids":                 params.ExtKeyUsageOIDs,
+		"policy_identifiers":                 policyIdentifiers,
+		"policy_identifiers_critical":        params.PolicyIdentifiersCritical,
+		"issuing_certificates":               urls.IssuingCertificates,
+		"crl_distribution_points":            urls.CRLDistributionPoints,
+		"ocsp_servers":                       urls.OCSPServers,
+		"basic_constraints_valid_for_non_ca": params.BasicConstraintsValidForNonCA,
+	}
+}
+
+// csrKeyTypeAndBits returns the type and size of a CSR's public key.
+func csrKeyTypeAndBits(csr *x509.CertificateRequest) (string, int) {
+	switch csr.PublicKeyAlgorithm {
+	case x509.RSA, x509.ECDSA:
+		keyType := "rsa"
+		if csr.PublicKeyAlgorithm == x509.ECDSA {
+			keyType = "ec"
+		}
+		return keyType, certutil.GetPublicKeySize(csr.PublicKey)
+	case x509.Ed25519:
+		return "ed25519", 0
+	default:
+		return csr.PublicKeyAlgorithm.String(), 0
+	}
+}
+
+// keyUsageNames returns the names of the key usages, as accepted by roles'
+// key_usage.
+func keyUsageNames(usage x509.KeyUsage) []string {
+	names := []string{}
+	for _, known := range []struct {
+		usage x509.KeyUsage
+		name  string
+	}{
+		{x509.KeyUsageDigitalSignature, "DigitalSignature"},
+		{x509.KeyUsageContentCommitment, "ContentCommitment"},
+		{x509.KeyUsageKeyEncipherment, "KeyEncipherment"},
+		{x509.KeyUsageDataEncipherment, "DataEncipherment"},
+		{x509.KeyUsageKeyAgreement, "KeyAgreement"},
+		{x509.KeyUsageCertSign, "CertSign"},
+		{x509.KeyUsageCRLSign, "CRLSign"},
+		{x509.KeyUsageEncipherOnly, "EncipherOnly"},
+		{x509.KeyUsageDecipherOnly, "DecipherOnly"},
+	} {
+		if usage&known.usage != 0 {
+			names = append(names, known.name)
+		}
+	}
+	return names
+}
+
+// extKeyUsageNames returns the names of the extended key usages, as
+// accepted by roles' ext_key_usage.
+func extKeyUsageNames(usages []x509.ExtKeyUsage) []string {
+	known := map[x509.ExtKeyUsage]string{
+		x509.ExtKeyUsageAny:                        "Any",
+		x509.ExtKeyUsageServerAuth:                 "ServerAuth",
+		x509.ExtKeyUsageClientAuth:                 "ClientAuth",
+		x509.ExtKeyUsageCodeSigning:                "CodeSigning",
+		x509.ExtKeyUsageEmailProtection:            "EmailProtection",
+		x509.ExtKeyUsageIPSECEndSystem:             "IpsecEndSystem",
+		x509.ExtKeyUsageIPSECTunnel:                "IpsecTunnel",
+		x509.ExtKeyUsageIPSECUser:                  "IpsecUser",
+		x509.ExtKeyUsageTimeStamping:               "TimeStamping",
+		x509.ExtKeyUsageOCSPSigning:                "OcspSigning",
+		x509.ExtKeyUsageMicrosoftServerGatedCrypto: "MicrosoftServerGatedCrypto",
+		x509.ExtKeyUsageNetscapeServerGatedCrypto:  "NetscapeServerGatedCrypto",
+	}
+
+	names := []string{}
+	for _, usage := range usages {
+		if name, ok := known[usage]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, fmt.Sprintf("unknown (%d)", usage))
+		}
+	}
+	return names
+}
+
+const pathIssueValidateHelpSyn = `
+Validate a request to issue a certificate, without issuing it.
+`
+
+const pathIssueValidateHelpDesc = `
+This path takes the same parameters as issue/:role, and runs the same role
+and policy checks, but rather than generating a key and certificate, returns
+a description of the certificate the request would be issued, such as its
+subject, SANs, validity period, key usages and AIA URLs. Nothing is signed
+or stored, and the role's issuance limits aren't consumed.
+`
+
+const pathSignValidateHelpSyn = `
+Validate a request to sign a CSR, without signing it.
+`
+
+const pathSignValidateHelpDesc = `
+This path takes the same parameters as sign/:role, and runs the same role
+and policy checks, but rather than signing the CSR, returns a description of
+the certificate the request would be issued, such as its subject, SANs,
+validity period, key usages and AIA URLs. Nothing is signed or stored (nor,
+for roles requiring approval, queued), and the role's issuance limits aren't
+consumed.
+`
@@ -0,0 +1,71 @@
+package pki
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathKeyTypes(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "key-types",
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathKeyTypesRead,
+			},
+		},
+
+		HelpSynopsis:    pathKeyTypesHelpSyn,
+		HelpDescription: pathKeyTypesHelpDesc,
+	}
+}
+
+func (b *backend) pathKeyTypesRead(_ context.Context, _ *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	keyTypes := map[string]interface{}{}
+	signatureAlgorithms := map[string]interface{}{}
+	for _, keyType := range certutil.ListKeyTypes() {
+		keyBits := keyType.KeyBits
+		if keyBits == nil {
+			keyBits = []int{}
+		}
+
+		keyTypes[keyType.Name] = map[string]interface{}{
+			"available":            keyType.Available,
+			"key_bits":             keyBits,
+			"default_key_bits":     keyType.DefaultKeyBits,
+			"signature_algorithms": keyType.SignatureAlgorithms,
+		}
+
+		for _, name := range keyType.SignatureAlgorithms {
+			algorithm, ok := certutil.GetSignatureAlgorithm(name)
+			if !ok {
+				continue
+			}
+			signatureAlgorithms[name] = map[string]interface{}{
+				"available": algorithm.Available,
+				"key_type":  algorithm.KeyType,
+			}
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"key_types":            keyTypes,
+			"signature_algorithms": signatureAlgorithms,
+		},
+	}, nil
+}
+
+const (
+	pathKeyTypesHelpSyn  = `List the key types and signature algorithms supported by this mount.`
+	pathKeyTypesHelpDesc = `
+This endpoint lists the key types which can be used for issuers, keys and
+roles, and the signature algorithms issuers sign certificates and CRLs
+with. Key types and algorithms which are known but which this build of
+Vault can not yet use, such as Ed448 and composite ML-DSA signatures, are
+listed as unavailable.
+`
+)
@@ -99,6 +99,21 @@ func pathImportIssuer(b *backend) *framework.Path {
 				Description: `PEM-format, concatenated unencrypted
 secret-key (optional) and certificates.`,
 			},
+			"pkcs12_bundle": {
+				Type: framework.TypeString,
+				Description: `Base64-encoded PKCS#12 bundle of the
+certificates and, optionally, the secret-key to import. Can not be used
+with pem_bundle.`,
+			},
+			"pkcs12_password": {
+				Type:        framework.TypeString,
+				Description: `Password protecting the PKCS#12 bundle.`,
+			},
+			"passphrase": {
+				Type: framework.TypeString,
+				Description: `Passphrase to decrypt encrypted PKCS#8 secret-keys
+in the pem_bundle with; it is not stored.`,
+			},
 		},
 
 		Operations: map[logical.Operation]framework.OperationHandler{
@@ -138,6 +153,18 @@ func (b *backend) pathImportIssuers(ctx context.Context, req *logical.Request, d
 		certificate = rawCertificate.(string)
 	}
 
+	if rawPKCS12, ok := data.GetOk("pkcs12_bundle"); ok && len(rawPKCS12.(string)) > 0 {
+		if len(pemBundle) > 0 || len(certificate) > 0 {
+			return logical.ErrorResponse("'pkcs12_bundle' can not be provided with 'pem_bundle' or 'certificate'"), nil
+		}
+
+		var err error
+		pemBundle, err = pkcs12ToPEMBundle(rawPKCS12.(string), data.Get("pkcs12_password").(string))
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("unable to decode 'pkcs12_bundle': %v", err)), nil
+		}
+	}
+
 	if len(pemBundle) == 0 && len(certificate) == 0 {
 		return logical.ErrorResponse("'pem_bundle' and 'certificate' parameters were empty"), nil
 	}
@@ -213,7 +240,17 @@ func (b *backend) pathImportIssuers(ctx context.Context, req *logical.Request, d
 
 	sc := b.makeStorageContext(ctx, req.Storage)
 
+	passphrase := ""
+	if rawPassphrase, ok := data.GetOk("passphrase"); ok {
+		passphrase = rawPassphrase.(string)
+	}
+
 	for keyIndex, keyPem := range keys {
+		keyPem, err := decryptPEMKey(keyPem, passphrase)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("Error decrypting key %v: %v", keyIndex, err)), nil
+		}
+
 		// Handle import of private key.
 		key, existing, err := importKeyFromBytes(sc, keyPem, "")
 		if err != nil {
@@ -237,13 +274,28 @@ func (b *backend) pathImportIssuers(ctx context.Context, req *logical.Request, d
 		}
 	}
 
+	// Issuers imported without their full chain may be able to fetch the
+	// rest of it.
+	fetchedIssuers, chaseWarnings, err := sc.chaseAIAParents(createdIssuers)
+	if err != nil {
+		return nil, err
+	}
+	for _, issuerId := range fetchedIssuers {
+		issuerKeyMap[issuerId] = ""
+	}
+	createdIssuers = append(createdIssuers, fetchedIssuers...)
+
 	response := &logical.Response{
 		Data: map[string]interface{}{
 			"mapping":          issuerKeyMap,
 			"imported_keys":    createdKeys,
 			"imported_issuers": createdIssuers,
+			"fetched_issuers":  fetchedIssuers,
 		},
 	}
+	for _, warning := range chaseWarnings {
+		response.AddWarning(warning)
+	}
 
 	if len(createdIssuers) > 0 {
 		err := b.crlBuilder.rebuild(ctx, b, req, true)
@@ -319,6 +371,9 @@ certificates.
 Depending on the value of :type, the pem_bundle request parameter can
 either take PEM-formatted certificates, and, if :type="bundle", unencrypted
 secret-keys.
+
+Alternatively, the same contents can be provided as a password-protected
+PKCS#12 bundle through the pkcs12_bundle and pkcs12_password parameters.
 `
 )
 
@@ -440,13 +495,7 @@ func (b *backend) pathRevokeIssuer(ctx context.Context, req *logical.Request, da
 				RevocationTimeUTC: issuer.RevocationTimeUTC,
 			}
 
-			revEntry, err := logical.StorageEntryJSON(revokedPath+normalizeSerial(issuer.SerialNumber), revInfo)
-			if err != nil {
-				return nil, fmt.Errorf("error creating revocation entry for issuer: %v", err)
-			}
-
-			err = req.Storage.Put(ctx, revEntry)
-			if err != nil {
+			if err := writeRevocationEntry(sc, normalizeSerial(issuer.SerialNumber), &revInfo); err != nil {
 				return nil, fmt.Errorf("error saving revoked issuer to new location: %v", err)
 			}
 		}
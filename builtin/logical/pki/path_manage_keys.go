@@ -156,7 +156,12 @@ func pathImportKey(b *backend) *framework.Path {
 			},
 			"pem_bundle": {
 				Type:        framework.TypeString,
-				Description: `PEM-format, unencrypted secret key`,
+				Description: `PEM-format secret key, either unencrypted or as an encrypted PKCS#8 key`,
+			},
+			"passphrase": {
+				Type: framework.TypeString,
+				Description: `Passphrase to decrypt an encrypted PKCS#8 secret
+key with; it is not stored.`,
 			},
 		},
 
@@ -176,7 +181,8 @@ func pathImportKey(b *backend) *framework.Path {
 const (
 	pathImportKeyHelpSyn  = `Import the specified key.`
 	pathImportKeyHelpDesc = `This endpoint allows importing a specified issuer key from a pem bundle.
-If key_name is set, that will be set on the key, assuming the key did not exist previously.`
+If key_name is set, that will be set on the key, assuming the key did not exist previously.
+Encrypted PKCS#8 keys are decrypted with the passphrase parameter, which is not stored.`
 )
 
 func (b *backend) pathImportKeyHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
@@ -231,7 +237,12 @@ func (b *backend) pathImportKeyHandler(ctx context.Context, req *logical.Request
 		return logical.ErrorResponse("only a single key can be present within the pem_bundle for importing"), nil
 	}
 
-	key, existed, err := importKeyFromBytes(sc, keys[0], keyName)
+	keyPem, err := decryptPEMKey(keys[0], data.Get("passphrase").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	key, existed, err := importKeyFromBytes(sc, keyPem, keyName)
 	if err != nil {
 		return logical.ErrorResponse(err.Error()), nil
 	}
@@ -250,3 +261,163 @@ func (b *backend) pathImportKeyHandler(ctx context.Context, req *logical.Request
 
 	return &resp, nil
 }
+
+func pathImportCloudKMSKey(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/import/cloud-kms",
+
+		Fields: map[string]*framework.FieldSchema{
+			keyNameParam: {
+				Type:        framework.TypeString,
+				Description: "Optional name to be used for this key",
+			},
+			"provider": {
+				Type:          framework.TypeString,
+				Description:   `Cloud KMS holding the key: "aws", "gcp" or "azure".`,
+				AllowedValues: allCloudKMSProviders,
+				Required:      true,
+			},
+			"kms_key": {
+				Type: framework.TypeString,
+				Description: `The key within the cloud KMS: an AWS KMS key ID or
+ARN; the resource name of a GCP CryptoKeyVersion; or the versioned key
+identifier of an Azure Key Vault key.`,
+				Required: true,
+			},
+			"region": {
+				Type:        framework.TypeString,
+				Description: `AWS region of the key; required with the aws provider.`,
+			},
+			"endpoint": {
+				Type: framework.TypeString,
+				Description: `Custom API endpoint of the aws or gcp provider, for
+example a VPC endpoint.`,
+			},
+			"access_key": {
+				Type: framework.TypeString,
+				Description: `AWS access key ID. If unset, credentials are sourced
+from the environment.`,
+			},
+			"secret_key": {
+				Type:        framework.TypeString,
+				Description: `AWS secret access key.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Sensitive: true,
+				},
+			},
+			"credentials": {
+				Type: framework.TypeString,
+				Description: `GCP service account credentials, as JSON. If unset,
+application default credentials are used.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Sensitive: true,
+				},
+			},
+			"tenant_id": {
+				Type:        framework.TypeString,
+				Description: `Azure tenant ID of client_id.`,
+			},
+			"client_id": {
+				Type: framework.TypeString,
+				Description: `Azure client ID. If unset, credentials are sourced
+from the environment.`,
+			},
+			"client_secret": {
+				Type:        framework.TypeString,
+				Description: `Azure client secret.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Sensitive: true,
+				},
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.pathImportCloudKMSKeyHandler,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathImportCloudKMSKeyHelpSyn,
+		HelpDescription: pathImportCloudKMSKeyHelpDesc,
+	}
+}
+
+const (
+	pathImportCloudKMSKeyHelpSyn  = `Import a reference to a key held by a cloud KMS.`
+	pathImportCloudKMSKeyHelpDesc = `This endpoint adds a key held by AWS KMS, GCP Cloud KMS or Azure Key Vault
+to the mount. Only a reference to the key, and the credentials used to reach it,
+are stored; every signature made with the key is computed by the cloud KMS.
+
+The key's public key and supported signature algorithms are fetched on import,
+so the key must be reachable. It can then be used like any other key, for
+example to generate a root or intermediate with the existing type.`
+)
+
+func (b *backend) pathImportCloudKMSKeyHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Since we're planning on updating issuers here, grab the lock so we've
+	// got a consistent view.
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	if b.useLegacyBundleCaStorage() {
+		return logical.ErrorResponse("Cannot import keys until migration has completed"), nil
+	}
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+	keyName, err := getKeyName(sc, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	ref := &cloudKMSKeyRef{
+		Provider:     data.Get("provider").(string),
+		Key:          data.Get("kms_key").(string),
+		Region:       data.Get("region").(string),
+		Endpoint:     data.Get("endpoint").(string),
+		AccessKey:    data.Get("access_key").(string),
+		SecretKey:    data.Get("secret_key").(string),
+		Credentials:  data.Get("credentials").(string),
+		TenantID:     data.Get("tenant_id").(string),
+		ClientID:     data.Get("client_id").(string),
+		ClientSecret: data.Get("client_secret").(string),
+	}
+	if err := ref.validate(); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	signer, err := b.cloudKMSSigners.get(ctx, ref)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	keyType, _, err := getKeyTypeAndBitsFromPublicKeyForRole(signer.Public())
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	refPem, err := ref.toPEM()
+	if err != nil {
+		return nil, err
+	}
+
+	key, existed, err := sc.importKey(refPem, keyName, certutil.ManagedPrivateKey)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	resp := logical.Response{
+		Data: map[string]interface{}{
+			keyIdParam:           key.ID,
+			keyNameParam:         key.Name,
+			keyTypeParam:         string(keyType),
+			"signing_algorithms": signer.signatureAlgorithmNames(),
+		},
+	}
+
+	if existed {
+		resp.AddWarning("Key already imported, use key/ endpoint to update name.")
+	}
+
+	return &resp, nil
+}
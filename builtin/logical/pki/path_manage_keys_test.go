@@ -1,18 +1,36 @@
 package pki
 
 import (
+	"bytes"
 	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/helper/certutil"
 
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/pbkdf2"
 )
 
 func TestPKI_PathManageKeys_GenerateInternalKeys(t *testing.T) {
@@ -425,3 +443,430 @@ func TestPKI_PathManageKeys_ImportKeyRejectsMultipleKeys(t *testing.T) {
 		t.Logf("%s:%s", id.ID, id.Name)
 	}
 }
+
+func TestPKI_PathManageKeys_ImportEncryptedKey(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	bundle, err := certutil.CreateKeyBundle("ec", 256, rand.Reader)
+	require.NoError(t, err, "failed generating an ec key bundle")
+	keyDER, err := x509.MarshalPKCS8PrivateKey(bundle.PrivateKey)
+	require.NoError(t, err, "failed marshaling ec key")
+
+	aesPem := encryptPKCS8ForTest(t, keyDER, "hunter2", asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}, 32, aes.NewCipher, true)
+	desPem := encryptPKCS8ForTest(t, keyDER, "hunter2", asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}, 24, des.NewTripleDESCipher, false)
+
+	importKey := func(pemBundle string, passphrase string) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "keys/import",
+			Storage:   s,
+			Data: map[string]interface{}{
+				"pem_bundle": pemBundle,
+				"passphrase": passphrase,
+			},
+			MountPoint: "pki/",
+		})
+	}
+
+	resp, err := importKey(aesPem, "")
+	require.NoError(t, err)
+	require.True(t, resp.IsError(), "expected an error importing an encrypted key without a passphrase")
+	require.Contains(t, resp.Error().Error(), "no passphrase")
+
+	resp, err = importKey(aesPem, "wrong")
+	require.NoError(t, err)
+	require.True(t, resp.IsError(), "expected an error importing an encrypted key with the wrong passphrase")
+	require.Contains(t, resp.Error().Error(), "incorrect passphrase")
+
+	resp, err = importKey(aesPem, "hunter2")
+	require.NoError(t, err)
+	require.False(t, resp.IsError(), "received an error response: %v", resp.Error())
+	require.Equal(t, certutil.ECPrivateKey, resp.Data["key_type"])
+	keyId := resp.Data["key_id"].(keyID)
+
+	// The same key encrypted differently is deduplicated, and only the
+	// decrypted key is stored.
+	resp, err = importKey(desPem, "hunter2")
+	require.NoError(t, err)
+	require.False(t, resp.IsError(), "received an error response: %v", resp.Error())
+	require.Equal(t, keyId, resp.Data["key_id"])
+
+	sc := b.makeStorageContext(context.Background(), s)
+	key, err := sc.fetchKeyById(keyId)
+	require.NoError(t, err)
+	require.NotContains(t, key.PrivateKey, "ENCRYPTED")
+	require.NotContains(t, key.PrivateKey, "hunter2")
+
+	// Encrypted keys can also be imported with their issuer.
+	resp, err = CBWrite(b, s, "root/generate/exported", map[string]interface{}{
+		"common_name": "root example.com",
+		"key_type":    "rsa",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	block, _ := pem.Decode([]byte(resp.Data["private_key"].(string)))
+	rootKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	require.NoError(t, err)
+	rootKeyDER, err := x509.MarshalPKCS8PrivateKey(rootKey)
+	require.NoError(t, err)
+	rootBundle := encryptPKCS8ForTest(t, rootKeyDER, "hunter2", asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}, 16, aes.NewCipher, true) + resp.Data["certificate"].(string)
+
+	b2, s2 := createBackendWithStorage(t)
+	_, err = CBWrite(b2, s2, "issuers/import/bundle", map[string]interface{}{
+		"pem_bundle": rootBundle,
+	})
+	require.ErrorContains(t, err, "no passphrase")
+
+	resp, err = CBWrite(b2, s2, "issuers/import/bundle", map[string]interface{}{
+		"pem_bundle": rootBundle,
+		"passphrase": "hunter2",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Len(t, resp.Data["imported_keys"], 1)
+	require.Len(t, resp.Data["imported_issuers"], 1)
+	issuerId := resp.Data["imported_issuers"].([]string)[0]
+	require.Equal(t, resp.Data["imported_keys"].([]string)[0], resp.Data["mapping"].(map[string]string)[issuerId])
+}
+
+// encryptPKCS8ForTest encrypts a PKCS#8 key with PBES2, as OpenSSL's
+// "pkcs8 -topk8 -v2" does.
+func encryptPKCS8ForTest(t *testing.T, keyDER []byte, passphrase string, cipherOID asn1.ObjectIdentifier, keyLen int, newCipher func([]byte) (cipher.Block, error), sha256PRF bool) string {
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	require.NoError(t, err)
+
+	prf := sha1.New
+	kdfParams := pbkdf2Params{Salt: salt, IterationCount: 2048}
+	if sha256PRF {
+		prf = sha256.New
+		kdfParams.PRF = pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}, Parameters: asn1.NullRawValue}
+	}
+	block, err := newCipher(pbkdf2.Key([]byte(passphrase), salt, 2048, keyLen, prf))
+	require.NoError(t, err)
+
+	iv := make([]byte, block.BlockSize())
+	_, err = rand.Read(iv)
+	require.NoError(t, err)
+	padding := block.BlockSize() - len(keyDER)%block.BlockSize()
+	plaintext := append(append([]byte{}, keyDER...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, plaintext)
+
+	kdfBytes, err := asn1.Marshal(kdfParams)
+	require.NoError(t, err)
+	ivBytes, err := asn1.Marshal(iv)
+	require.NoError(t, err)
+	paramBytes, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfBytes}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: cipherOID, Parameters: asn1.RawValue{FullBytes: ivBytes}},
+	})
+	require.NoError(t, err)
+	der, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: paramBytes}},
+		EncryptedData: ciphertext,
+	})
+	require.NoError(t, err)
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: der}))
+}
+
+// newFakeAWSKMS serves the GetPublicKey and Sign calls of the AWS KMS API
+// for a single ECDSA P-256 key, counting the signatures it makes.
+func newFakeAWSKMS(t *testing.T, signatures *int32) (*httptest.Server, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	publicKey, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var input map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var output map[string]interface{}
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.GetPublicKey":
+			output = map[string]interface{}{
+				"KeyId":             input["KeyId"],
+				"KeyUsage":          "SIGN_VERIFY",
+				"PublicKey":         publicKey,
+				"SigningAlgorithms": []string{"ECDSA_SHA_256"},
+			}
+		case "TrentService.Sign":
+			message, _ := input["Message"].(string)
+			digest, err := base64.StdEncoding.DecodeString(message)
+			if err != nil || input["MessageType"] != "DIGEST" || input["SigningAlgorithm"] != "ECDSA_SHA_256" {
+				http.Error(w, "bad sign request", http.StatusBadRequest)
+				return
+			}
+			signature, err := ecdsa.SignASN1(rand.Reader, key, digest)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			atomic.AddInt32(signatures, 1)
+			output = map[string]interface{}{
+				"KeyId":            input["KeyId"],
+				"Signature":        signature,
+				"SigningAlgorithm": "ECDSA_SHA_256",
+			}
+		default:
+			http.Error(w, "unknown operation", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		json.NewEncoder(w).Encode(output)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, key
+}
+
+func TestPKI_PathManageKeys_ImportCloudKMSKey(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	var signatures int32
+	server, kmsKey := newFakeAWSKMS(t, &signatures)
+	kmsKeyParams := map[string]interface{}{
+		"key_name":   "cloud",
+		"provider":   "aws",
+		"kms_key":    "alias/pki-root",
+		"region":     "us-east-1",
+		"endpoint":   server.URL,
+		"access_key": "AKIAEXAMPLE",
+		"secret_key": "secret",
+	}
+
+	// Invalid references are rejected before reaching the provider.
+	_, err := CBWrite(b, s, "keys/import/cloud-kms", map[string]interface{}{
+		"provider": "aws",
+		"kms_key":  "alias/pki-root",
+	})
+	require.Error(t, err, "expected a missing region to be rejected")
+
+	resp, err := CBWrite(b, s, "keys/import/cloud-kms", kmsKeyParams)
+	requireSuccessNonNilResponse(t, resp, err, "failed importing cloud KMS key")
+	keyId := resp.Data["key_id"].(keyID)
+	require.Equal(t, "ec", resp.Data["key_type"])
+	require.Equal(t, []string{"ECDSA-SHA256"}, resp.Data["signing_algorithms"])
+
+	// Importing the same key again finds the existing entry.
+	delete(kmsKeyParams, "key_name")
+	resp, err = CBWrite(b, s, "keys/import/cloud-kms", kmsKeyParams)
+	requireSuccessNonNilResponse(t, resp, err, "failed importing cloud KMS key again")
+	require.Equal(t, keyId, resp.Data["key_id"])
+	require.NotEmpty(t, resp.Warnings)
+
+	// Reading the key describes it without its credentials.
+	resp, err = CBRead(b, s, "key/cloud")
+	requireSuccessNonNilResponse(t, resp, err, "failed reading cloud KMS key")
+	require.Equal(t, "ec", resp.Data["key_type"])
+	require.Equal(t, "aws", resp.Data["provider"])
+	require.Equal(t, "alias/pki-root", resp.Data["kms_key"])
+	require.NotContains(t, resp.Data, "secret_key")
+	require.NotContains(t, fmt.Sprintf("%v", resp.Data), "secret")
+
+	// A root generated with the key is signed by the KMS.
+	resp, err = CBWrite(b, s, "root/generate/existing", map[string]interface{}{
+		"key_ref":     "cloud",
+		"common_name": "Cloud KMS Root",
+		"ttl":         "720h",
+	})
+	requireSuccessNonNilResponse(t, resp, err, "failed generating root with cloud KMS key")
+	root := parseCert(t, resp.Data["certificate"].(string))
+	require.NoError(t, root.CheckSignatureFrom(root))
+	equal, err := certutil.ComparePublicKeysAndType(root.PublicKey, kmsKey.Public())
+	require.NoError(t, err)
+	require.True(t, equal, "root's public key doesn't match the cloud KMS key")
+	require.Equal(t, keyId, resp.Data["key_id"])
+
+	// So are leaves and CRLs.
+	_, err = CBWrite(b, s, "roles/example", map[string]interface{}{
+		"allow_any_name": true,
+		"key_type":       "ec",
+		"ttl":            "1h",
+	})
+	require.NoError(t, err)
+
+	resp, err = CBWrite(b, s, "issue/example", map[string]interface{}{
+		"common_name": "leaf.example.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err, "failed issuing leaf with cloud KMS key")
+	leaf := parseCert(t, resp.Data["certificate"].(string))
+	require.NoError(t, leaf.CheckSignatureFrom(root))
+
+	_, err = CBWrite(b, s, "revoke", map[string]interface{}{
+		"serial_number": resp.Data["serial_number"],
+	})
+	require.NoError(t, err)
+
+	crl := getParsedCrlFromBackend(t, b, s, "crl")
+	require.NoError(t, root.CheckCRLSignature(crl))
+	require.Len(t, crl.TBSCertList.RevokedCertificates, 1)
+	require.GreaterOrEqual(t, atomic.LoadInt32(&signatures), int32(3))
+
+	// The key's material never leaves the KMS.
+	_, err = CBWrite(b, s, "issuer/default/export/pkcs12", map[string]interface{}{})
+	require.Error(t, err, "expected cloud KMS key not to be exportable")
+}
+
+// fakeCloudKMSClient signs after a configurable delay, recording the
+// largest number of concurrent signing requests. When describing is set,
+// describe signals on it and waits for release to be closed.
+type fakeCloudKMSClient struct {
+	delay       time.Duration
+	inFlight    int32
+	maxInFlight int32
+	isClosed    int32
+
+	publicKey  crypto.PublicKey
+	describing chan struct{}
+	release    chan struct{}
+}
+
+func (c *fakeCloudKMSClient) describe(_ context.Context) (crypto.PublicKey, []x509.SignatureAlgorithm, error) {
+	if c.describing != nil {
+		c.describing <- struct{}{}
+		<-c.release
+	}
+	return c.publicKey, []x509.SignatureAlgorithm{x509.ECDSAWithSHA256}, nil
+}
+
+func (c *fakeCloudKMSClient) sign(_ context.Context, digest []byte, _ x509.SignatureAlgorithm) ([]byte, error) {
+	current := atomic.AddInt32(&c.inFlight, 1)
+	defer atomic.AddInt32(&c.inFlight, -1)
+	for {
+		previous := atomic.LoadInt32(&c.maxInFlight)
+		if current <= previous || atomic.CompareAndSwapInt32(&c.maxInFlight, previous, current) {
+			break
+		}
+	}
+
+	time.Sleep(c.delay)
+	return digest, nil
+}
+
+func (c *fakeCloudKMSClient) close() {
+	atomic.StoreInt32(&c.isClosed, 1)
+}
+
+func (c *fakeCloudKMSClient) closed() bool {
+	return atomic.LoadInt32(&c.isClosed) == 1
+}
+
+func TestPKI_CloudKMSLimiter(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeCloudKMSClient{delay: 10 * time.Millisecond}
+	limiter := newCloudKMSLimiter(client)
+	defer limiter.stop()
+
+	// Steady load grows the limit beyond a single request.
+	done := make(chan error)
+	for i := 0; i < 64; i++ {
+		go func(i int) {
+			digest := []byte{byte(i)}
+			signature, err := limiter.sign(digest, x509.ECDSAWithSHA256)
+			if err == nil && !bytes.Equal(signature, digest) {
+				err = fmt.Errorf("got signature %v for digest %v", signature, digest)
+			}
+			done <- err
+		}(i)
+	}
+	for i := 0; i < 64; i++ {
+		require.NoError(t, <-done)
+	}
+
+	limit, latency := limiter.stats()
+	require.Greater(t, limit, 1)
+	require.Greater(t, atomic.LoadInt32(&client.maxInFlight), int32(1))
+	require.LessOrEqual(t, atomic.LoadInt32(&client.maxInFlight), int32(cloudKMSMaxInFlight))
+
+	// A request markedly slower than usual halves the limit.
+	limiter.lock.Lock()
+	limiter.observe(false, 4*latency)
+	limiter.lock.Unlock()
+	newLimit, _ := limiter.stats()
+	expected := limit / 2
+	if expected < 1 {
+		expected = 1
+	}
+	require.Equal(t, expected, newLimit)
+
+	// Stopped limiters refuse new requests, and close their client.
+	limiter.stop()
+	_, err := limiter.sign([]byte{1}, x509.ECDSAWithSHA256)
+	require.Error(t, err)
+	require.True(t, client.closed())
+}
+
+// Verify that describing a key doesn't hold up other keys' signers, and that
+// signers are stopped when their keys go away.
+func TestPKI_CloudKMSSigners(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	slowRef := &cloudKMSKeyRef{Provider: "aws", Key: "slow", Region: "us-east-1"}
+	fastRef := &cloudKMSKeyRef{Provider: "aws", Key: "fast", Region: "us-east-1"}
+
+	describing := make(chan struct{})
+	release := make(chan struct{})
+	clients := make(map[string]*fakeCloudKMSClient)
+	var clientsLock sync.Mutex
+
+	signers := newCloudKMSSigners()
+	signers.newClient = func(ref *cloudKMSKeyRef) (cloudKMSClient, error) {
+		client := &fakeCloudKMSClient{publicKey: key.Public()}
+		if ref.Key == "slow" {
+			client.describing = describing
+			client.release = release
+		}
+		clientsLock.Lock()
+		clients[ref.Key] = client
+		clientsLock.Unlock()
+		return client, nil
+	}
+	defer signers.stop()
+
+	slowDone := make(chan error)
+	go func() {
+		_, err := signers.get(context.Background(), slowRef)
+		slowDone <- err
+	}()
+	<-describing
+
+	// The fast key is described while the slow one is still outstanding.
+	fast, err := signers.get(context.Background(), fastRef)
+	require.NoError(t, err)
+	again, err := signers.get(context.Background(), fastRef)
+	require.NoError(t, err)
+	require.Same(t, fast, again)
+
+	close(release)
+	require.NoError(t, <-slowDone)
+
+	// Evicting a key stops its signer; the next use describes it again.
+	signers.evict(fastRef)
+	clientsLock.Lock()
+	require.True(t, clients["fast"].closed())
+	clientsLock.Unlock()
+	_, err = fast.Sign(rand.Reader, make([]byte, 32), crypto.SHA256)
+	require.Error(t, err)
+
+	refreshed, err := signers.get(context.Background(), fastRef)
+	require.NoError(t, err)
+	require.NotSame(t, fast, refreshed)
+
+	// Only signers of retained references remain.
+	signers.retain(map[string]bool{slowRef.fingerprint(): true})
+	clientsLock.Lock()
+	require.True(t, clients["fast"].closed())
+	require.False(t, clients["slow"].closed())
+	clientsLock.Unlock()
+}
@@ -0,0 +1,414 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// mountMergeBundleVersion is bumped whenever mountMergeBundle changes in an
+// incompatible way.
+const mountMergeBundleVersion = 1
+
+// mountMergeBundle carries the state of one PKI mount into another. Since a
+// mount can't read another mount's storage (particularly across namespaces),
+// the source mount exports this and the operator hands it to the
+// destination mount to merge in.
+type mountMergeBundle struct {
+	Version int                        `json:"version"`
+	Keys    []keyEntry                 `json:"keys"`
+	Issuers []issuerEntry              `json:"issuers"`
+	Roles   map[string]*roleEntry      `json:"roles"`
+	Certs   map[string][]byte          `json:"certs"`
+	Revoked map[string]*revocationInfo `json:"revoked"`
+}
+
+func pathMigrateExport(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "migrate/export",
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathMigrateExport,
+			},
+		},
+
+		HelpSynopsis:    pathMigrateExportHelpSyn,
+		HelpDescription: pathMigrateExportHelpDesc,
+	}
+}
+
+func pathMigrateImport(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "migrate/import",
+		Fields: map[string]*framework.FieldSchema{
+			"bundle": {
+				Type:        framework.TypeString,
+				Description: `Bundle returned by migrate/export on the source mount.`,
+				Required:    true,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathMigrateImport,
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathMigrateImportHelpSyn,
+		HelpDescription: pathMigrateImportHelpDesc,
+	}
+}
+
+func (b *backend) pathMigrateExport(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	b.issuersLock.RLock()
+	defer b.issuersLock.RUnlock()
+
+	if b.useLegacyBundleCaStorage() {
+		return logical.ErrorResponse("Cannot export mount until migration has completed"), nil
+	}
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+	bundle := &mountMergeBundle{
+		Version: mountMergeBundleVersion,
+		Roles:   make(map[string]*roleEntry),
+		Certs:   make(map[string][]byte),
+		Revoked: make(map[string]*revocationInfo),
+	}
+
+	keys, err := sc.listKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range keys {
+		key, err := sc.fetchKeyById(id)
+		if err != nil {
+			return nil, err
+		}
+		bundle.Keys = append(bundle.Keys, *key)
+	}
+
+	issuers, err := sc.listIssuers()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range issuers {
+		issuer, err := sc.fetchIssuerById(id)
+		if err != nil {
+			return nil, err
+		}
+		bundle.Issuers = append(bundle.Issuers, *issuer)
+	}
+
+	roles, err := req.Storage.List(ctx, "role/")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range roles {
+		role, err := b.getRole(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if role != nil {
+			bundle.Roles[name] = role
+		}
+	}
+
+	serials, err := req.Storage.List(ctx, "certs/")
+	if err != nil {
+		return nil, err
+	}
+	for _, serial := range serials {
+		entry, err := req.Storage.Get(ctx, "certs/"+serial)
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			bundle.Certs[serial] = entry.Value
+		}
+	}
+
+	revoked, err := req.Storage.List(ctx, revokedPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, serial := range revoked {
+		entry, err := req.Storage.Get(ctx, revokedPath+serial)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			continue
+		}
+
+		var revInfo revocationInfo
+		if err := entry.DecodeJSON(&revInfo); err != nil {
+			return nil, fmt.Errorf("error decoding revocation entry for serial %s: %w", serial, err)
+		}
+		bundle.Revoked[serial] = &revInfo
+	}
+
+	encoded, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode mount bundle: %w", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"bundle": base64.StdEncoding.EncodeToString(encoded),
+		},
+	}, nil
+}
+
+func (b *backend) pathMigrateImport(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Since we're planning on updating issuers here, grab the lock so we've
+	// got a consistent view.
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	if b.useLegacyBundleCaStorage() {
+		return logical.ErrorResponse("Cannot import mount until migration has completed"), nil
+	}
+
+	rawBundle, err := base64.StdEncoding.DecodeString(data.Get("bundle").(string))
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("unable to decode bundle: %v", err)), nil
+	}
+
+	var bundle mountMergeBundle
+	if err := json.Unmarshal(rawBundle, &bundle); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("unable to parse bundle: %v", err)), nil
+	}
+	if bundle.Version != mountMergeBundleVersion {
+		return logical.ErrorResponse(fmt.Sprintf("unsupported bundle version %d; expected %d", bundle.Version, mountMergeBundleVersion)), nil
+	}
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+
+	var conflicts []string
+	var importedKeys []string
+	var importedIssuers []string
+	var importedRoles []string
+	importedCerts := 0
+	importedRevocations := 0
+
+	for _, srcKey := range bundle.Keys {
+		var key *keyEntry
+		var existing bool
+		if srcKey.isManagedPrivateKey() {
+			key, existing, err = sc.importKey(srcKey.PrivateKey, "", certutil.ManagedPrivateKey)
+		} else {
+			key, existing, err = importKeyFromBytes(sc, srcKey.PrivateKey, "")
+		}
+		if err != nil {
+			conflicts = append(conflicts, fmt.Sprintf("key %v: unable to import: %v", srcKey.ID, err))
+			continue
+		}
+		if existing {
+			continue
+		}
+
+		importedKeys = append(importedKeys, key.ID.String())
+		if srcKey.Name == "" {
+			continue
+		}
+		if _, err := sc.resolveKeyReference(srcKey.Name); err == nil {
+			conflicts = append(conflicts, fmt.Sprintf("key %v: name %q is already in use; imported as %v without a name", srcKey.ID, srcKey.Name, key.ID))
+			continue
+		}
+		key.Name = srcKey.Name
+		if err := sc.writeKey(*key); err != nil {
+			return nil, err
+		}
+	}
+
+	issuerIdMap := make(map[issuerID]issuerID, len(bundle.Issuers))
+	for _, srcIssuer := range bundle.Issuers {
+		issuer, existing, err := sc.importIssuer(srcIssuer.Certificate, "")
+		if err != nil {
+			conflicts = append(conflicts, fmt.Sprintf("issuer %v: unable to import: %v", srcIssuer.ID, err))
+			continue
+		}
+		issuerIdMap[srcIssuer.ID] = issuer.ID
+		if existing {
+			continue
+		}
+
+		importedIssuers = append(importedIssuers, issuer.ID.String())
+
+		// Carry over the issuer's settings. Usage is restricted to what
+		// importIssuer allowed, so we never grant CRL signing to a
+		// certificate lacking the bit.
+		issuer.LeafNotAfterBehavior = srcIssuer.LeafNotAfterBehavior
+		issuer.Usage = srcIssuer.Usage & issuer.Usage
+		issuer.RevocationSigAlg = srcIssuer.RevocationSigAlg
+		issuer.ExpiryWarningThreshold = srcIssuer.ExpiryWarningThreshold
+		issuer.SerialNumberBits = srcIssuer.SerialNumberBits
+		issuer.SerialNumberPrefix = srcIssuer.SerialNumberPrefix
+		issuer.AIAURIs = srcIssuer.AIAURIs
+		issuer.Revoked = srcIssuer.Revoked
+		issuer.RevocationTime = srcIssuer.RevocationTime
+		issuer.RevocationTimeUTC = srcIssuer.RevocationTimeUTC
+		if srcIssuer.Name != "" {
+			if _, err := sc.resolveIssuerReference(srcIssuer.Name); err == nil {
+				conflicts = append(conflicts, fmt.Sprintf("issuer %v: name %q is already in use; imported as %v without a name", srcIssuer.ID, srcIssuer.Name, issuer.ID))
+			} else {
+				issuer.Name = srcIssuer.Name
+			}
+		}
+		if err := sc.writeIssuer(issuer); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, role := range bundle.Roles {
+		role.Name = name
+
+		// Roles may reference their issuers by ID, which changes on import.
+		if newId, ok := issuerIdMap[issuerID(role.Issuer)]; ok {
+			role.Issuer = newId.String()
+		}
+		for index, ref := range role.AllowedIssuers {
+			if newId, ok := issuerIdMap[issuerID(ref)]; ok {
+				role.AllowedIssuers[index] = newId.String()
+			}
+		}
+
+		existing, err := b.getRole(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			if !reflect.DeepEqual(existing, role) {
+				conflicts = append(conflicts, fmt.Sprintf("role %q: a different role with this name already exists; skipped", name))
+			}
+			continue
+		}
+
+		entry, err := logical.StorageEntryJSON("role/"+name, role)
+		if err != nil {
+			return nil, err
+		}
+		if err := req.Storage.Put(ctx, entry); err != nil {
+			return nil, err
+		}
+		importedRoles = append(importedRoles, name)
+	}
+
+	for serial, certBytes := range bundle.Certs {
+		cert, err := x509.ParseCertificate(certBytes)
+		if err != nil {
+			conflicts = append(conflicts, fmt.Sprintf("certificate %v: unable to parse: %v; skipped", serial, err))
+			continue
+		}
+		if normalizeSerial(serialFromCert(cert)) != serial {
+			conflicts = append(conflicts, fmt.Sprintf("certificate %v: the certificate has serial number %v instead; skipped", serial, serialFromCert(cert)))
+			continue
+		}
+
+		existing, err := req.Storage.Get(ctx, "certs/"+serial)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			if !bytes.Equal(existing.Value, certBytes) {
+				conflicts = append(conflicts, fmt.Sprintf("certificate %v: a different certificate with this serial number already exists; skipped", serial))
+			}
+			continue
+		}
+
+		// Index the certificate like an issued one, so that it can be
+		// found by name; its role and requester are unknown.
+		if err := sc.writeCertMetadata(newCertMetadata(cert, "", "", nil)); err != nil {
+			return nil, err
+		}
+
+		if err := req.Storage.Put(ctx, &logical.StorageEntry{
+			Key:   "certs/" + serial,
+			Value: certBytes,
+		}); err != nil {
+			return nil, err
+		}
+		b.usageStats.certStored("certs/"+serial, certBytes)
+		importedCerts += 1
+	}
+
+	for serial, revInfo := range bundle.Revoked {
+		existing, err := req.Storage.Get(ctx, revokedPath+serial)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			continue
+		}
+
+		// Issuers which didn't make it across are left for the CRL builder
+		// to re-associate.
+		revInfo.CertificateIssuer = issuerIdMap[revInfo.CertificateIssuer]
+
+		if err := writeRevocationEntry(sc, serial, revInfo); err != nil {
+			return nil, err
+		}
+		importedRevocations += 1
+	}
+
+	response := &logical.Response{
+		Data: map[string]interface{}{
+			"imported_keys":        importedKeys,
+			"imported_issuers":     importedIssuers,
+			"imported_roles":       importedRoles,
+			"imported_certs":       importedCerts,
+			"imported_revocations": importedRevocations,
+			"conflicts":            conflicts,
+		},
+	}
+
+	if len(importedIssuers) > 0 || importedRevocations > 0 {
+		if err := b.crlBuilder.rebuild(ctx, b, req, true); err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
+}
+
+const pathMigrateExportHelpSyn = `
+Export this mount's issuers, keys, roles, certificates, and revocations.
+`
+
+const pathMigrateExportHelpDesc = `
+This endpoint returns a bundle of this mount's state, for merging into
+another PKI mount (in this or another namespace) via its migrate/import
+endpoint.
+
+The bundle contains all private keys of this mount; it should be handled
+with the same care as the mount itself.
+`
+
+const pathMigrateImportHelpSyn = `
+Merge another mount's exported state into this mount.
+`
+
+const pathMigrateImportHelpDesc = `
+This endpoint merges a bundle produced by migrate/export on another PKI
+mount into this one.
+
+Keys and issuers already present in this mount are matched and left as-is;
+new ones are imported and keep their names when not already in use. Roles,
+stored certificates, and revocations are copied when not present. Anything
+which couldn't be merged as-is, such as a role or certificate differing from
+an existing one of the same name or serial number, is skipped and described
+in the returned conflicts list. Role references to imported issuers are
+updated to the new issuer identifiers.
+`
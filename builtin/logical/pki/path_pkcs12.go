@@ -0,0 +1,211 @@
+package pki
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// pkcs12Encoders maps the supported values of the encryption parameter to
+// their PKCS#12 encoders.
+var pkcs12Encoders = map[string]*pkcs12.Encoder{
+	// PBES2 with PBKDF2-HMAC-SHA-256 and AES-256-CBC, with an HMAC-SHA-256
+	// MAC; readable by OpenSSL 1.1.1+, Java 12+ and Windows Server 2019+.
+	"aes256": pkcs12.Modern2023,
+	// PBE with SHA-1 and 3DES for both keys and certificates; readable by
+	// nearly everything, including older Windows and HSM vendor tooling.
+	"des3": pkcs12.LegacyDES,
+	// PBE with SHA-1 and 3DES for keys but 40-bit RC2 for certificates,
+	// matching what older versions of Windows and OpenSSL produce.
+	"rc2": pkcs12.LegacyRC2,
+}
+
+func pathIssuerExportPKCS12(b *backend) *framework.Path {
+	fields := addIssuerRefField(map[string]*framework.FieldSchema{})
+	fields["password"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `Password protecting the PKCS#12 bundle; required.`,
+	}
+	fields["encryption"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `Algorithms used to protect the PKCS#12 bundle:
+"aes256" (PBES2 with AES-256-CBC and an HMAC-SHA-256 MAC), "des3" (3DES
+with an HMAC-SHA-1 MAC) or "rc2" (3DES for the key and 40-bit RC2 for the
+certificates). Only use the latter two for software which can't read the
+former. Defaults to "aes256".`,
+		Default: "aes256",
+	}
+	fields["include_chain"] = &framework.FieldSchema{
+		Type: framework.TypeBool,
+		Description: `Whether to include the issuer's CA chain in the
+PKCS#12 bundle, alongside the issuer's certificate and key. Defaults to
+true.`,
+		Default: true,
+	}
+
+	return &framework.Path{
+		Pattern: "pkcs12/export/" + framework.GenericNameRegex(issuerRefParam),
+		Fields:  fields,
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathIssuerExportPKCS12,
+			},
+		},
+
+		HelpSynopsis:    pathIssuerExportPKCS12HelpSyn,
+		HelpDescription: pathIssuerExportPKCS12HelpDesc,
+	}
+}
+
+func (b *backend) pathIssuerExportPKCS12(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.issuersLock.RLock()
+	defer b.issuersLock.RUnlock()
+
+	if b.useLegacyBundleCaStorage() {
+		return logical.ErrorResponse("cannot export issuers until migration has completed"), nil
+	}
+
+	issuerName := getIssuerRef(data)
+	if len(issuerName) == 0 {
+		return logical.ErrorResponse("missing issuer reference"), nil
+	}
+
+	password := data.Get("password").(string)
+	if len(password) == 0 {
+		return logical.ErrorResponse("missing password; PKCS#12 bundles are only exported with a password"), nil
+	}
+
+	encryption := strings.ToLower(data.Get("encryption").(string))
+	encoder, ok := pkcs12Encoders[encryption]
+	if !ok {
+		return logical.ErrorResponse(fmt.Sprintf("unknown encryption %q; must be one of aes256, des3 or rc2", encryption)), nil
+	}
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+	ref, err := sc.resolveIssuerReference(issuerName)
+	if err != nil {
+		if ref == IssuerRefNotFound {
+			return logical.ErrorResponse("unable to resolve issuer id for reference: " + issuerName), nil
+		}
+		return nil, err
+	}
+
+	issuer, err := sc.fetchIssuerById(ref)
+	if err != nil {
+		return nil, err
+	}
+	if len(issuer.KeyID) == 0 {
+		return logical.ErrorResponse(fmt.Sprintf("issuer %v has no key in this mount to export", issuer.ID)), nil
+	}
+
+	key, err := sc.fetchKeyById(issuer.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if key.isManagedPrivateKey() {
+		return logical.ErrorResponse(fmt.Sprintf("issuer %v's key is a managed key and can not be exported", issuer.ID)), nil
+	}
+	if !key.Exportable {
+		return logical.ErrorResponse(fmt.Sprintf("issuer %v's key %v is not exportable; mark it exportable through key/%v first", issuer.ID, key.ID, key.ID)), nil
+	}
+
+	signer, _, _, err := getSignerFromBytes([]byte(key.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := issuer.GetCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	var caCerts []*x509.Certificate
+	if data.Get("include_chain").(bool) {
+		for _, chainPem := range issuer.CAChain {
+			chainCert, err := parseCertificateFromBytes([]byte(chainPem))
+			if err != nil {
+				return nil, err
+			}
+			if areCertificatesEqual(cert, chainCert) {
+				continue
+			}
+			caCerts = append(caCerts, chainCert)
+		}
+	}
+
+	pfxData, err := encoder.Encode(signer, cert, caCerts, password)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode PKCS#12 bundle: %w", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"pkcs12":    base64.StdEncoding.EncodeToString(pfxData),
+			"issuer_id": issuer.ID,
+			"key_id":    issuer.KeyID,
+		},
+	}, nil
+}
+
+// pkcs12ToPEMBundle decodes a base64-encoded PKCS#12 bundle into a PEM
+// bundle suitable for importing: the secret-key, if present, then the
+// certificates.
+func pkcs12ToPEMBundle(encoded string, password string) (string, error) {
+	pfxData, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", fmt.Errorf("bundle is not valid base64: %w", err)
+	}
+
+	var blocks []*pem.Block
+	var certs []*x509.Certificate
+
+	key, cert, caCerts, err := pkcs12.DecodeChain(pfxData, password)
+	switch {
+	case err == nil:
+		keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return "", fmt.Errorf("unable to marshal secret-key: %w", err)
+		}
+		blocks = append(blocks, &pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes})
+		certs = append([]*x509.Certificate{cert}, caCerts...)
+	case errors.Is(err, pkcs12.ErrIncorrectPassword):
+		return "", err
+	default:
+		// Bundles without a secret-key are decoded as trust stores.
+		var storeErr error
+		certs, storeErr = pkcs12.DecodeTrustStore(pfxData, password)
+		if storeErr != nil {
+			return "", err
+		}
+	}
+
+	for _, cert := range certs {
+		blocks = append(blocks, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+
+	var bundle strings.Builder
+	for _, block := range blocks {
+		bundle.Write(pem.EncodeToMemory(block))
+	}
+	return bundle.String(), nil
+}
+
+const (
+	pathIssuerExportPKCS12HelpSyn  = `Export an issuer and its key as a PKCS#12 bundle.`
+	pathIssuerExportPKCS12HelpDesc = `
+This endpoint exports the specified issuer's certificate, key and,
+optionally, CA chain as a password-protected PKCS#12 bundle. This is a
+privileged endpoint, and only issuers whose keys have been marked
+exportable through key/:key_ref can be exported. Issuers whose keys are
+managed keys can not be exported.
+`
+)
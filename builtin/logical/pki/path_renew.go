@@ -0,0 +1,326 @@
+package pki
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathRenew(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "renew/" + framework.GenericNameRegex("role") + `/(?P<serial>[0-9A-Fa-f-:]+)`,
+
+		Fields: map[string]*framework.FieldSchema{
+			"role": {
+				Type: framework.TypeString,
+				Description: `The role to renew the certificate under; it must
+be the role the certificate was issued through, when known.`,
+			},
+			"serial": {
+				Type: framework.TypeString,
+				Description: `Serial number of the certificate to renew,
+colon- or hyphen-separated.`,
+			},
+			"csr": {
+				Type: framework.TypeString,
+				Description: `PEM-format CSR whose key the renewed certificate
+is issued for. Only the key is taken from the CSR. A CSR for the original
+key proves possession of it; a CSR for a new key is only accepted when the
+original certificate is presented for TLS client authentication. If not
+given, a new key is generated and returned, which also requires TLS client
+authentication with the original certificate.`,
+			},
+			"ttl": {
+				Type: framework.TypeDurationSecond,
+				Description: `The requested Time To Live for the renewed
+certificate. Defaults to the validity period of the original certificate,
+subject to the role's max_ttl.`,
+			},
+			"format": {
+				Type:    framework.TypeString,
+				Default: "pem",
+				Description: `Format for returned data. Can be "pem", "der",
+"pem_bundle" or "pkcs7". If "pem_bundle", any private
+key and issuing cert will be appended to the
+certificate pem. If "der", the value will be
+base64 encoded. If "pkcs7", the certificate will be
+a PEM encoded PKCS#7 bundle of the certificate and
+its CA chain. Defaults to "pem".`,
+				AllowedValues: []interface{}{"pem", "der", "pem_bundle", "pkcs7"},
+			},
+			"private_key_format": {
+				Type:    framework.TypeString,
+				Default: "der",
+				Description: `Format for the returned private key.
+Generally the default will be controlled by the "format"
+parameter as either base64-encoded DER or PEM-encoded DER.
+However, this can be set to "pkcs8" to have the returned
+private key contain base64-encoded pkcs8 or PEM-encoded
+pkcs8 instead. Defaults to "der".`,
+				AllowedValues: []interface{}{"", "der", "pem", "pkcs8"},
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.metricsWrap("renew", roleRequired, b.pathRenewCert),
+			},
+		},
+
+		HelpSynopsis:    pathRenewHelpSyn,
+		HelpDescription: pathRenewHelpDesc,
+	}
+}
+
+// pathRenewCert issues a new certificate with the subject, subject
+// alternative names and custom extensions of a stored one, subject to the
+// restrictions of the role it was issued through.
+func (b *backend) pathRenewCert(ctx context.Context, req *logical.Request, data *framework.FieldData, role *roleEntry) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	serial := data.Get("serial").(string)
+
+	certEntry, err := fetchCertBySerial(ctx, b, req, "certs/", serial)
+	if err != nil {
+		return nil, err
+	}
+	if certEntry == nil {
+		return logical.ErrorResponse(fmt.Sprintf("certificate with serial %s not found", serial)), nil
+	}
+	revokedEntry, err := fetchCertBySerial(ctx, b, req, "revoked/", serial)
+	if err != nil {
+		return nil, err
+	}
+	if revokedEntry != nil {
+		return logical.ErrorResponse(fmt.Sprintf("certificate with serial %s is revoked and can not be renewed", serial)), nil
+	}
+
+	original, err := x509.ParseCertificate(certEntry.Value)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse stored certificate with serial %s: %w", serial, err)
+	}
+
+	// The role is part of the path, so that policies on it apply as they
+	// do to issue/:role and sign/:role; it must be the original's role.
+	meta, err := sc.fetchCertMetadata(serialFromCert(original))
+	if err != nil {
+		return nil, err
+	}
+	if meta != nil && meta.Role != "" && meta.Role != role.Name {
+		return logical.ErrorResponse(fmt.Sprintf("certificate %s was issued through role %s and can only be renewed through it", serial, meta.Role)), nil
+	}
+
+	if role.RequireApproval {
+		return logical.ErrorResponse("this role requires approval of each request; submit a CSR for the renewed certificate through the sign/:role endpoint instead"), nil
+	}
+
+	csr := data.Get("csr").(string)
+	if csr == "" && role.KeyType == "any" {
+		return logical.ErrorResponse("role key type \"any\" not allowed for issuing certificates; provide a csr to renew with"), nil
+	}
+
+	if resp, err := verifyRenewalPossession(req, original, csr); resp != nil || err != nil {
+		return resp, err
+	}
+
+	renewData, err := b.renewalFieldData(original, role, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	var resp *logical.Response
+	if csr != "" {
+		// The names all come from the original certificate, the key from
+		// the CSR.
+		keyOnlyRole := *role
+		keyOnlyRole.UseCSRCommonName = false
+		keyOnlyRole.UseCSRSANs = false
+		renewData.Raw["csr"] = csr
+		resp, err = b.pathIssueSignCert(ctx, req, renewData, &keyOnlyRole, true, false, false)
+	} else {
+		resp, err = b.pathIssueSignCert(ctx, req, renewData, role, false, false, false)
+	}
+	if err != nil || resp.IsError() {
+		return resp, err
+	}
+
+	newSerial := resp.Data["serial_number"].(string)
+	resp.Data["renewed_from"] = serialFromCert(original)
+
+	if !role.NoStore {
+		if err := linkRenewedCertMetadata(sc, serialFromCert(original), newSerial); err != nil {
+			resp.AddWarning(fmt.Sprintf("the certificate was renewed, but its metadata could not be linked to that of the original: %v", err))
+		}
+	}
+
+	return resp, nil
+}
+
+// verifyRenewalPossession requires the caller to prove possession of the
+// original certificate's key, as serial numbers are public: either by
+// submitting a CSR for that key (whose signature proves possession), or by
+// presenting the certificate itself for TLS client authentication.
+func verifyRenewalPossession(req *logical.Request, original *x509.Certificate, csrPem string) (*logical.Response, error) {
+	if req.Connection != nil && req.Connection.ConnState != nil && len(req.Connection.ConnState.PeerCertificates) > 0 &&
+		req.Connection.ConnState.PeerCertificates[0].Equal(original) {
+		return nil, nil
+	}
+
+	if csrPem != "" {
+		block, _ := pem.Decode([]byte(csrPem))
+		if block == nil {
+			return logical.ErrorResponse("csr contains no data"), nil
+		}
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("certificate request could not be parsed: %v", err)), nil
+		}
+		if err := csr.CheckSignature(); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("the CSR signature is invalid: %v", err)), nil
+		}
+
+		publicKey, ok := csr.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+		if ok && publicKey.Equal(original.PublicKey) {
+			return nil, nil
+		}
+	}
+
+	return logical.ErrorResponse("renewing a certificate requires proof of possession of its key: submit a CSR signed by the original key, or present the original certificate for TLS client authentication"), nil
+}
+
+// renewalFieldData builds the request for re-issuing the original
+// certificate through the sign/:role schema.
+func (b *backend) renewalFieldData(original *x509.Certificate, role *roleEntry, data *framework.FieldData) (*framework.FieldData, error) {
+	raw := map[string]interface{}{
+		"common_name":        original.Subject.CommonName,
+		"format":             data.Get("format").(string),
+		"private_key_format": data.Get("private_key_format").(string),
+	}
+
+	altNames := append(append([]string{}, original.DNSNames...), original.EmailAddresses...)
+	if len(altNames) > 0 {
+		raw["alt_names"] = strings.Join(altNames, ",")
+	}
+	var ipSANs []string
+	for _, ip := range original.IPAddresses {
+		ipSANs = append(ipSANs, ip.String())
+	}
+	if len(ipSANs) > 0 {
+		raw["ip_sans"] = ipSANs
+	}
+	var uriSANs []string
+	for _, uri := range original.URIs {
+		uriSANs = append(uriSANs, uri.String())
+	}
+	if len(uriSANs) > 0 {
+		raw["uri_sans"] = uriSANs
+	}
+
+	otherSANs, err := getOtherSANsFromX509Extensions(original.Extensions)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read other SANs of the original certificate: %w", err)
+	}
+	if len(otherSANs) > 0 {
+		var values []string
+		for _, other := range otherSANs {
+			values = append(values, other.String())
+		}
+		raw["other_sans"] = values
+	}
+
+	if original.Subject.SerialNumber != "" {
+		raw["serial_number"] = original.Subject.SerialNumber
+	}
+
+	// Don't add the common name to the SANs unless the original did.
+	if original.Subject.CommonName != "" {
+		cnInSANs := false
+		for _, name := range altNames {
+			if strings.EqualFold(name, original.Subject.CommonName) {
+				cnInSANs = true
+				break
+			}
+		}
+		raw["exclude_cn_from_sans"] = !cnInSANs
+	}
+
+	var customExtensions []string
+	for _, ext := range original.Extensions {
+		if _, reserved := reservedExtensionOIDs[ext.Id.String()]; reserved {
+			continue
+		}
+		value := ext.Id.String()
+		if ext.Critical {
+			value += ";critical"
+		}
+		customExtensions = append(customExtensions, value+":"+base64.StdEncoding.EncodeToString(ext.Value))
+	}
+	if len(customExtensions) > 0 {
+		raw["custom_extensions"] = customExtensions
+	}
+
+	if ttl, ok := data.GetOk("ttl"); ok {
+		raw["ttl"] = ttl.(int)
+	} else if lifetime := original.NotAfter.Sub(original.NotBefore) - role.NotBeforeDuration; lifetime > 0 {
+		raw["ttl"] = int(lifetime.Seconds())
+	}
+
+	return &framework.FieldData{
+		Raw:    raw,
+		Schema: pathSign(b).Fields,
+	}, nil
+}
+
+// linkRenewedCertMetadata records the renewal in the metadata of both the
+// original and the renewed certificate.
+func linkRenewedCertMetadata(sc *storageContext, originalSerial, renewedSerial string) error {
+	renewed, err := sc.fetchCertMetadata(renewedSerial)
+	if err != nil {
+		return err
+	}
+	if renewed != nil {
+		renewed.RenewedFrom = originalSerial
+		if err := sc.writeCertMetadata(renewed); err != nil {
+			return err
+		}
+	}
+
+	original, err := sc.fetchCertMetadata(originalSerial)
+	if err != nil {
+		return err
+	}
+	if original != nil {
+		original.RenewedBy = renewedSerial
+		if err := sc.writeCertMetadata(original); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const pathRenewHelpSyn = `
+Renew a stored certificate, keeping its subject, names and extensions.
+`
+
+const pathRenewHelpDesc = `
+This path re-issues the certificate with the given serial number with the
+same common name, subject alternative names, subject serial number and
+custom extensions, through the given role, which must be the role the
+certificate was issued through (when known) and must still allow all of
+them. The remaining attributes come from the role as it is now.
+
+The caller must prove possession of the original certificate's key, either
+by submitting a CSR signed by it, or by presenting the original certificate
+for TLS client authentication. In the latter case, a CSR for a new key may
+be given, or a new key is generated. Only the key is taken from the CSR.
+The original and the renewed certificates' metadata are linked through
+their renewed_by and renewed_from fields. Revoked certificates can not be
+renewed.
+`
@@ -7,9 +7,11 @@ import (
 	"crypto/rsa"
 	"crypto/subtle"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/certutil"
@@ -21,7 +23,7 @@ import (
 func pathRevoke(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: `revoke`,
-		Fields: map[string]*framework.FieldSchema{
+		Fields: addRevocationMetadataFields(map[string]*framework.FieldSchema{
 			"serial_number": {
 				Type: framework.TypeString,
 				Description: `Certificate serial number, in colon- or
@@ -32,7 +34,13 @@ hyphen-separated octal`,
 				Description: `Certificate to revoke in PEM format; must be
 signed by an issuer in this mount.`,
 			},
-		},
+			"reason": {
+				Type: framework.TypeString,
+				Description: `The RFC 5280 revocation reason, such as
+key_compromise or superseded; defaults to unspecified.`,
+				Default: "unspecified",
+			},
+		}),
 
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.UpdateOperation: &framework.PathOperation{
@@ -52,7 +60,7 @@ signed by an issuer in this mount.`,
 func pathRevokeWithKey(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: `revoke-with-key`,
-		Fields: map[string]*framework.FieldSchema{
+		Fields: addRevocationMetadataFields(map[string]*framework.FieldSchema{
 			"serial_number": {
 				Type: framework.TypeString,
 				Description: `Certificate serial number, in colon- or
@@ -68,6 +76,111 @@ signed by an issuer in this mount.`,
 				Description: `Key to use to verify revocation permission; must
 be in PEM format.`,
 			},
+			"reason": {
+				Type: framework.TypeString,
+				Description: `The RFC 5280 revocation reason, such as
+key_compromise or superseded; defaults to unspecified.`,
+				Default: "unspecified",
+			},
+		}),
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.metricsWrap("revoke", noRole, b.pathRevokeWrite),
+				// This should never be forwarded. See backend.go for more information.
+				// If this needs to write, the entire request will be forwarded to the
+				// active node of the current performance cluster, but we don't want to
+				// forward invalid revoke requests there.
+			},
+		},
+
+		HelpSynopsis:    pathRevokeHelpSyn,
+		HelpDescription: pathRevokeHelpDesc,
+	}
+}
+
+func pathUnrevoke(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `unrevoke`,
+		Fields: map[string]*framework.FieldSchema{
+			"serial_number": {
+				Type: framework.TypeString,
+				Description: `Serial number of the certificate to release from
+hold, in colon- or hyphen-separated octal`,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathUnrevokeWrite,
+				// Revocations are local to each cluster, so only forward
+				// within the performance cluster, as this always writes.
+				ForwardPerformanceStandby: true,
+			},
+		},
+
+		HelpSynopsis:    pathUnrevokeHelpSyn,
+		HelpDescription: pathUnrevokeHelpDesc,
+	}
+}
+
+func pathImportCRL(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `crl/import`,
+		Fields: addIssuerRefField(addRevocationMetadataFields(map[string]*framework.FieldSchema{
+			"crl": {
+				Type: framework.TypeString,
+				Description: `CRL whose revocations to import, in PEM format or
+as base64-encoded DER.`,
+			},
+			"crl_issuer": {
+				Type: framework.TypeString,
+				Description: `PEM-encoded certificate of the CA which signed the
+CRL, against which its signature is verified: the certificate of the issuer
+given by issuer_ref (the default), or a CA certificate signed by it.`,
+			},
+		})),
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathImportCRLWrite,
+				// Revocations are local to each cluster, so only forward
+				// within the performance cluster, as this always writes.
+				ForwardPerformanceStandby: true,
+			},
+		},
+
+		HelpSynopsis:    pathImportCRLHelpSyn,
+		HelpDescription: pathImportCRLHelpDesc,
+	}
+}
+
+func pathRevokeWithSignature(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `revoke-with-signature`,
+		Fields: map[string]*framework.FieldSchema{
+			"certificate": {
+				Type: framework.TypeString,
+				Description: `Certificate to revoke in PEM format; must be
+signed by an issuer in this mount.`,
+			},
+			"reason": {
+				Type: framework.TypeString,
+				Description: `The RFC 5280 revocation reason, such as
+key_compromise or superseded; defaults to unspecified.`,
+				Default: "unspecified",
+			},
+			"timestamp": {
+				Type: framework.TypeString,
+				Description: `The RFC 3339 time the revocation request was
+signed; must be within five minutes of the current time.`,
+			},
+			"signature": {
+				Type: framework.TypeString,
+				Description: `Base64 signature, made with the certificate's
+private key, over the certificate's serial number, reason, and timestamp,
+each followed by a newline.`,
+			},
 		},
 
 		Operations: map[logical.Operation]framework.OperationHandler{
@@ -104,6 +217,24 @@ func pathRotateCRL(b *backend) *framework.Path {
 	}
 }
 
+func pathCRLBuilderState(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `crl/builder-state`,
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				// Not forwarded: the builder's state is per-node, and it is
+				// the state of the node serving this request that's of
+				// interest.
+				Callback: b.pathCRLBuilderStateRead,
+			},
+		},
+
+		HelpSynopsis:    pathCRLBuilderStateHelpSyn,
+		HelpDescription: pathCRLBuilderStateHelpDesc,
+	}
+}
+
 func (b *backend) pathRevokeWriteHandleCertificate(ctx context.Context, req *logical.Request, certPem string) (string, bool, []byte, error) {
 	// This function handles just the verification of the certificate against
 	// the global issuer set, checking whether or not it is importable.
@@ -289,6 +420,57 @@ func (b *backend) pathRevokeWriteHandleKey(ctx context.Context, req *logical.Req
 	return nil
 }
 
+// revocationSignatureMaxSkew bounds how far a signed revocation request's
+// timestamp may be from the current time, limiting the window in which it
+// can be replayed.
+const revocationSignatureMaxSkew = 5 * time.Minute
+
+// revocationSignatureMessage builds the message a certificate holder signs to
+// request revocation via /revoke-with-signature.
+func revocationSignatureMessage(serial string, reason string, timestamp string) []byte {
+	return []byte(serial + "\n" + reason + "\n" + timestamp + "\n")
+}
+
+func (b *backend) pathRevokeWriteHandleSignature(cert []byte, data *framework.FieldData) error {
+	certReference, err := x509.ParseCertificate(cert)
+	if err != nil {
+		return errutil.UserError{Err: fmt.Sprintf("certificate could not be parsed: %v", err)}
+	}
+
+	rawTimestamp := data.Get("timestamp").(string)
+	timestamp, err := time.Parse(time.RFC3339, rawTimestamp)
+	if err != nil {
+		return errutil.UserError{Err: fmt.Sprintf("timestamp must be in RFC 3339 format: %v", err)}
+	}
+	if skew := time.Since(timestamp); skew > revocationSignatureMaxSkew || skew < -revocationSignatureMaxSkew {
+		return errutil.UserError{Err: fmt.Sprintf("timestamp must be within %v of the current time", revocationSignatureMaxSkew)}
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(data.Get("signature").(string))
+	if err != nil || len(signature) == 0 {
+		return errutil.UserError{Err: "signature must be provided, base64 encoded"}
+	}
+
+	var algo x509.SignatureAlgorithm
+	switch certReference.PublicKey.(type) {
+	case *rsa.PublicKey:
+		algo = x509.SHA256WithRSA
+	case *ecdsa.PublicKey:
+		algo = x509.ECDSAWithSHA256
+	case ed25519.PublicKey:
+		algo = x509.PureEd25519
+	default:
+		return errutil.UserError{Err: "certificate has an unknown public key algorithm; unable to validate provided signature; ask an admin to revoke this certificate instead"}
+	}
+
+	message := revocationSignatureMessage(serialFromCert(certReference), data.Get("reason").(string), rawTimestamp)
+	if err := certReference.CheckSignature(algo, message, signature); err != nil {
+		return errutil.UserError{Err: "provided signature was not made by the certificate's private key"}
+	}
+
+	return nil
+}
+
 func (b *backend) pathRevokeWrite(ctx context.Context, req *logical.Request, data *framework.FieldData, _ *roleEntry) (*logical.Response, error) {
 	rawSerial, haveSerial := data.GetOk("serial_number")
 	rawCertificate, haveCert := data.GetOk("certificate")
@@ -297,6 +479,13 @@ func (b *backend) pathRevokeWrite(ctx context.Context, req *logical.Request, dat
 		return logical.ErrorResponse("The serial number or certificate to revoke must be provided."), nil
 	} else if haveSerial && haveCert {
 		return logical.ErrorResponse("Must provide either the certificate or the serial to revoke; not both."), nil
+	} else if req.Path == "revoke-with-signature" && !haveCert {
+		return logical.ErrorResponse(fmt.Sprintf("Must provide the certificate to revoke via the /%v path.", req.Path)), nil
+	}
+
+	reason, err := parseRevocationReason(data.Get("reason").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
 	}
 
 	var keyPem string
@@ -356,7 +545,11 @@ func (b *backend) pathRevokeWrite(ctx context.Context, req *logical.Request, dat
 		// Before we write the certificate, we've gotta verify the request in
 		// the event of a PoP-based revocation scheme; we don't want to litter
 		// storage with issued-but-not-revoked certificates.
-		if err := b.pathRevokeWriteHandleKey(ctx, req, certBytes, keyPem); err != nil {
+		if req.Path == "revoke-with-signature" {
+			if err := b.pathRevokeWriteHandleSignature(certBytes, data); err != nil {
+				return nil, err
+			}
+		} else if err := b.pathRevokeWriteHandleKey(ctx, req, certBytes, keyPem); err != nil {
 			return nil, err
 		}
 
@@ -371,6 +564,7 @@ func (b *backend) pathRevokeWrite(ctx context.Context, req *logical.Request, dat
 			if err != nil {
 				return nil, err
 			}
+			b.usageStats.certStored("certs/"+serial, certBytes)
 		}
 
 		// Finally, we have a valid serial number to use for BYOC revocation!
@@ -390,7 +584,126 @@ func (b *backend) pathRevokeWrite(ctx context.Context, req *logical.Request, dat
 	b.revokeStorageLock.Lock()
 	defer b.revokeStorageLock.Unlock()
 
-	return revokeCert(ctx, b, req, serial, false)
+	return revokeCert(ctx, b, req, serial, reason, revocationMetadataFromRequest(data), false)
+}
+
+// revocationMetadataFromRequest returns the revocation metadata given with
+// the request, if any.
+func revocationMetadataFromRequest(data *framework.FieldData) *revocationMetadata {
+	var metadata revocationMetadata
+	if value, ok := data.GetOk("ticket_id"); ok {
+		metadata.TicketID = value.(string)
+	}
+	if value, ok := data.GetOk("requester"); ok {
+		metadata.Requester = value.(string)
+	}
+	if value, ok := data.GetOk("note"); ok {
+		metadata.Note = value.(string)
+	}
+
+	if metadata == (revocationMetadata{}) {
+		return nil
+	}
+	return &metadata
+}
+
+func (b *backend) pathUnrevokeWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	serial := data.Get("serial_number").(string)
+	if len(serial) == 0 {
+		return logical.ErrorResponse("The serial number must be provided"), nil
+	}
+
+	// We store and identify by lowercase colon-separated hex, but other
+	// utilities use dashes and/or uppercase, so normalize
+	serial = strings.ReplaceAll(strings.ToLower(serial), "-", ":")
+
+	b.revokeStorageLock.Lock()
+	defer b.revokeStorageLock.Unlock()
+
+	return unrevokeCert(ctx, b, req, serial)
+}
+
+func (b *backend) pathImportCRLWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if b.useLegacyBundleCaStorage() {
+		return logical.ErrorResponse("unable to import CRLs until CA issuer migration has completed"), nil
+	}
+
+	crlData := strings.TrimSpace(data.Get("crl").(string))
+	if len(crlData) == 0 {
+		return logical.ErrorResponse("the crl parameter must be provided"), nil
+	}
+
+	crlBytes := []byte(crlData)
+	if !strings.HasPrefix(crlData, "-----BEGIN") {
+		decoded, err := base64.StdEncoding.DecodeString(crlData)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("unable to decode crl as PEM or base64-encoded DER: %v", err)), nil
+		}
+		crlBytes = decoded
+	}
+
+	// ParseCRL transparently handles PEM-encoded CRLs.
+	crl, err := x509.ParseCRL(crlBytes)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("unable to parse crl: %v", err)), nil
+	}
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+	issuerId, err := sc.resolveIssuerReference(getIssuerRef(data))
+	if err != nil {
+		if issuerId == IssuerRefNotFound {
+			return logical.ErrorResponse("unable to resolve issuer id for reference: " + getIssuerRef(data)), nil
+		}
+		return nil, err
+	}
+
+	// Only revocations listed by the issuer itself, or by a CA it signed,
+	// may be imported.
+	issuer, err := sc.fetchIssuerById(issuerId)
+	if err != nil {
+		return nil, err
+	}
+	issuerCert, err := issuer.GetCertificate()
+	if err != nil {
+		return nil, err
+	}
+	crlIssuer := issuerCert
+	if crlIssuerPem := strings.TrimSpace(data.Get("crl_issuer").(string)); crlIssuerPem != "" {
+		crlIssuer, err = parseCertificateFromBytes([]byte(crlIssuerPem))
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("unable to parse crl_issuer: %v", err)), nil
+		}
+		if !areCertificatesEqual(crlIssuer, issuerCert) {
+			if err := crlIssuer.CheckSignatureFrom(issuerCert); err != nil {
+				return logical.ErrorResponse(fmt.Sprintf("crl_issuer must be the certificate of issuer %v or be signed by it: %v", issuerId, err)), nil
+			}
+		}
+	}
+	if err := crlIssuer.CheckCRLSignature(crl); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("unable to verify the crl's signature against the certificate of %q; provide the certificate of the CA which signed it as crl_issuer: %v", crlIssuer.Subject.String(), err)), nil
+	}
+
+	b.revokeStorageLock.Lock()
+	defer b.revokeStorageLock.Unlock()
+
+	resp, err := importCRLRevocations(sc, req, crl, issuerId, revocationMetadataFromRequest(data))
+	if err != nil || resp.IsError() {
+		return resp, err
+	}
+
+	// As with unrevocation, rebuild the complete CRLs right away: no delta
+	// WAL entries are written for imported revocations.
+	crlErr := b.crlBuilder.rebuild(ctx, b, req, false)
+	if crlErr != nil {
+		switch crlErr.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(fmt.Sprintf("Error during CRL building: %s", crlErr)), nil
+		default:
+			return nil, fmt.Errorf("error encountered during CRL building: %w", crlErr)
+		}
+	}
+
+	return resp, nil
 }
 
 func (b *backend) pathRotateCRLRead(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
@@ -414,11 +727,25 @@ func (b *backend) pathRotateCRLRead(ctx context.Context, req *logical.Request, _
 	}, nil
 }
 
+func (b *backend) pathCRLBuilderStateRead(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	state, err := b.crlBuilder.describeState(sc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: state,
+	}, nil
+}
+
 const pathRevokeHelpSyn = `
 Revoke a certificate by serial number or with explicit certificate.
 
 When calling /revoke-with-key, the private key corresponding to the
-certificate must be provided to authenticate the request.
+certificate must be provided to authenticate the request. The
+unauthenticated /revoke-with-signature path instead takes the certificate
+and a fresh signature made with its private key.
 `
 
 const pathRevokeHelpDesc = `
@@ -426,6 +753,37 @@ This allows certificates to be revoke. A root token or corresponding
 private key is required.
 `
 
+const pathUnrevokeHelpSyn = `
+Release a certificate revoked with the certificate_hold reason.
+`
+
+const pathUnrevokeHelpDesc = `
+This removes a certificate placed on hold (revoked with the certificate_hold
+reason) from the revocation list, restoring its validity, and rebuilds the
+CRLs. Certificates revoked for any other reason cannot be unrevoked. A
+certificate on hold may instead be revoked permanently by revoking it again
+with another reason.
+`
+
+const pathImportCRLHelpSyn = `
+Import the revocations listed on an external CRL.
+`
+
+const pathImportCRLHelpDesc = `
+This imports the revocations listed on a CRL of a CA being migrated into
+this mount, so that they keep appearing on this mount's CRLs. Only the
+serial number, revocation time and reason of each revocation is known, so
+the revoked certificates aren't stored, and the revocations are placed on
+the CRL of the given issuer (the default issuer, by default). The CRL's
+signature is verified against that issuer's certificate or, when given,
+crl_issuer, which must be signed by that issuer. Serial numbers
+which are already revoked, or which match certificates issued by this
+mount, are skipped.
+
+Since the expiry of the revoked certificates is unknown, tidy never removes
+imported revocations.
+`
+
 const pathRotateCRLHelpSyn = `
 Force a rebuild of the CRL.
 `
@@ -433,3 +791,16 @@ Force a rebuild of the CRL.
 const pathRotateCRLHelpDesc = `
 Force a rebuild of the CRL. This can be used to remove expired certificates from it if no certificates have been revoked. A root token is required.
 `
+
+const pathCRLBuilderStateHelpSyn = `
+Read the internal state of this node's CRL builder.
+`
+
+const pathCRLBuilderStateHelpDesc = `
+This read-only endpoint reports the CRL builder's state on the node serving
+the request: whether its configuration is dirty, whether a rebuild is
+pending or in progress, the loaded configuration next to the stored one,
+and, per CRL, its issuers, numbers, expirations, and last build times. This
+is useful when diagnosing why a CRL hasn't been updated, particularly on
+performance secondaries.
+`
@@ -282,6 +282,50 @@ Section 4.2.1.12.`,
 				},
 			},
 
+			"no_ext_key_usage": {
+				Type: framework.TypeBool,
+				Description: `If set, certificates issued by this role carry no
+Extended Key Usage extension at all, regardless of server_flag, client_flag,
+code_signing_flag and email_protection_flag. Can't be combined with
+ext_key_usage or ext_key_usage_oids.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name: "No Extended Key Usage",
+				},
+			},
+
+			"allowed_extension_oids": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `A comma-separated string or list of the OIDs of
+custom extensions requests may supply (via custom_extensions); "*" allows
+any. Extensions Vault sets itself, such as the subject alternative names,
+key usages or basic constraints, can never be supplied.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name: "Allowed Custom Extension OIDs",
+				},
+			},
+
+			"issuance_policy": {
+				Type: framework.TypeString,
+				Description: `A CEL expression evaluated against each certificate
+about to be issued or signed against this role (as cert), its CSR (as csr),
+its validity period (as ttl) and the requester (as requester). It must
+evaluate to a bool, false denying issuance, or a string, a non-empty string
+denying issuance with it as the reason.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name: "Issuance Policy",
+				},
+			},
+
+			"denied_extension_oids": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `A comma-separated string or list of the OIDs of
+custom extensions requests may not supply, even when allowed by
+allowed_extension_oids.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name: "Denied Custom Extension OIDs",
+				},
+			},
+
 			"use_csr_common_name": {
 				Type:    framework.TypeBool,
 				Default: true,
@@ -323,6 +367,31 @@ this value in certificates issued by this role.`,
 this value in certificates issued by this role.`,
 			},
 
+			"common_name_template": {
+				Type: framework.TypeString,
+				Description: `If set, the Common Name of certificates issued by
+this role is constructed from this template instead of taken from the
+request or CSR. The template may use identity templating, such as
+{{identity.entity.name}}, and the request's string parameters, such as
+{{request.common_name}}. The result is still subject to the role's
+restrictions on common names.`,
+			},
+
+			"ou_template": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `If set, OU (OrganizationalUnit) is constructed
+from these templates in certificates issued by this role, in place of
+the ou values. See common_name_template for the templating allowed.`,
+			},
+
+			"organization_template": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `If set, O (Organization) is constructed from
+these templates in certificates issued by this role, in place of the
+organization values. See common_name_template for the templating
+allowed.`,
+			},
+
 			"country": {
 				Type: framework.TypeCommaStringSlice,
 				Description: `If set, Country will be set to
@@ -414,6 +483,15 @@ information, which must include an oid, and may include a notice and/or cps url,
 [{"oid"="1.3.6.1.4.1.7.8","notice"="I am a user Notice"}, {"oid"="1.3.6.1.4.1.44947.1.2.4 ","cps"="https://example.com"}].`,
 			},
 
+			"policy_identifiers_critical": {
+				Type: framework.TypeBool,
+				Description: `If set, the certificate policies extension built from
+policy_identifiers is marked critical. Defaults to false.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name: "Policy Identifiers Critical",
+				},
+			},
+
 			"basic_constraints_valid_for_non_ca": {
 				Type:        framework.TypeBool,
 				Description: `Mark Basic Constraints valid when issuing non-CA certificates.`,
@@ -421,14 +499,32 @@ information, which must include an oid, and may include a notice and/or cps url,
 					Name: "Basic Constraints Valid for Non-CA",
 				},
 			},
+			"ocsp_must_staple": {
+				Type: framework.TypeBool,
+				Description: `If set, certificates issued by this role carry the
+TLS Feature extension requesting status_request (OCSP Must-Staple). Issuance
+fails unless the issuer has OCSP servers configured and OCSP is enabled.`,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name: "OCSP Must-Staple",
+				},
+			},
 			"not_before_duration": {
-				Type:        framework.TypeDurationSecond,
-				Default:     30,
-				Description: `The duration before now which the certificate needs to be backdated by.`,
+				Type:    framework.TypeDurationSecond,
+				Default: 30,
+				Description: `The duration before now which the certificate needs to be backdated by.
+Limited by the mount's max_not_before_duration, when set.`,
 				DisplayAttrs: &framework.DisplayAttributes{
 					Value: 30,
 				},
 			},
+			"allow_not_before": {
+				Type: framework.TypeBool,
+				Description: `If set, requests may set the not before field of
+the certificate explicitly, through not_before, for devices with badly
+skewed clocks. It may not be in the future, nor backdated further than the
+mount's max_not_before_duration.`,
+				Default: false,
+			},
 			"not_after": {
 				Type: framework.TypeString,
 				Description: `Set the not after field of the certificate with specified date value.
@@ -440,6 +536,52 @@ The value format should be given in UTC format YYYY-MM-ddTHH:MM:SSZ.`,
 serviced by this role.`,
 				Default: defaultRef,
 			},
+			"allowed_issuers": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `References to the only issuers this role may
+issue from, through issuer_ref or the issuer/:issuer_ref/ paths. When empty
+(the default), any issuer of the mount may be used.`,
+			},
+			"crl_partition": {
+				Type: framework.TypeString,
+				Description: `Name of the CRL partition certificates issued
+by this role are placed into. Their revocations are listed on the
+partition's own CRL, at issuer/:issuer_ref/crl/partition/:partition, rather
+than on the issuer's CRL. When empty (the default), certificates aren't
+partitioned.`,
+			},
+			"require_approval": {
+				Type: framework.TypeBool,
+				Description: `If set, requests to sign CSRs against this role
+are held until approved through the sign-request/:request_id/approve
+endpoint, and requests to issue certificates (which would require holding
+the generated private key meanwhile) are refused.`,
+			},
+			"approval_ttl": {
+				Type: framework.TypeDurationSecond,
+				Description: `How long sign requests held for approval remain
+approvable, and approved or denied requests remain readable by their
+requester. Defaults to 24 hours.`,
+				Default: "24h",
+			},
+			"issuance_rate_limit": {
+				Type: framework.TypeInt,
+				Description: `The maximum number of certificates this role
+issues per issuance_rate_period; further requests are refused with a 429
+status until the rate drops. Zero (the default) doesn't limit the rate.`,
+			},
+			"issuance_rate_period": {
+				Type: framework.TypeDurationSecond,
+				Description: `The period over which issuance_rate_limit
+applies. Defaults to one hour.`,
+				Default: "1h",
+			},
+			"max_active_certificates": {
+				Type: framework.TypeInt,
+				Description: `The maximum number of unexpired certificates
+this role may have issued; further requests are refused with a 429 status
+until some expire. Zero (the default) doesn't limit them.`,
+			},
 		},
 
 		Operations: map[logical.Operation]framework.OperationHandler{
@@ -613,6 +755,7 @@ func (b *backend) getRole(ctx context.Context, s logical.Storage, n string) (*ro
 		}
 	}
 
+	result.Name = n
 	return &result, nil
 }
 
@@ -621,6 +764,9 @@ func (b *backend) pathRoleDelete(ctx context.Context, req *logical.Request, data
 	if err != nil {
 		return nil, err
 	}
+	if err := req.Storage.Delete(ctx, roleUsagePrefix+data.Get("name").(string)); err != nil {
+		return nil, err
+	}
 
 	return nil, nil
 }
@@ -686,8 +832,15 @@ func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data
 		KeyUsage:                      data.Get("key_usage").([]string),
 		ExtKeyUsage:                   data.Get("ext_key_usage").([]string),
 		ExtKeyUsageOIDs:               data.Get("ext_key_usage_oids").([]string),
+		NoExtKeyUsage:                 data.Get("no_ext_key_usage").(bool),
+		AllowedExtensionOIDs:          data.Get("allowed_extension_oids").([]string),
+		DeniedExtensionOIDs:           data.Get("denied_extension_oids").([]string),
+		IssuancePolicy:                data.Get("issuance_policy").(string),
 		OU:                            data.Get("ou").([]string),
 		Organization:                  data.Get("organization").([]string),
+		CommonNameTemplate:            data.Get("common_name_template").(string),
+		OUTemplate:                    data.Get("ou_template").([]string),
+		OrganizationTemplate:          data.Get("organization_template").([]string),
 		Country:                       data.Get("country").([]string),
 		Locality:                      data.Get("locality").([]string),
 		Province:                      data.Get("province").([]string),
@@ -699,10 +852,20 @@ func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data
 		CNValidations:                 data.Get("cn_validations").([]string),
 		AllowedSerialNumbers:          data.Get("allowed_serial_numbers").([]string),
 		PolicyIdentifiers:             getPolicyIdentifier(data, nil),
+		PolicyIdentifiersCritical:     data.Get("policy_identifiers_critical").(bool),
 		BasicConstraintsValidForNonCA: data.Get("basic_constraints_valid_for_non_ca").(bool),
+		OCSPMustStaple:                data.Get("ocsp_must_staple").(bool),
 		NotBeforeDuration:             time.Duration(data.Get("not_before_duration").(int)) * time.Second,
+		AllowNotBefore:                data.Get("allow_not_before").(bool),
 		NotAfter:                      data.Get("not_after").(string),
 		Issuer:                        data.Get("issuer_ref").(string),
+		AllowedIssuers:                data.Get("allowed_issuers").([]string),
+		CRLPartition:                  data.Get("crl_partition").(string),
+		RequireApproval:               data.Get("require_approval").(bool),
+		ApprovalTTL:                   time.Duration(data.Get("approval_ttl").(int)) * time.Second,
+		IssuanceRateLimit:             data.Get("issuance_rate_limit").(int),
+		IssuanceRatePeriod:            time.Duration(data.Get("issuance_rate_period").(int)) * time.Second,
+		MaxActiveCertificates:         data.Get("max_active_certificates").(int),
 	}
 
 	allowedOtherSANs := data.Get("allowed_other_sans").([]string)
@@ -776,6 +939,28 @@ func validateRole(b *backend, entry *roleEntry, ctx context.Context, s logical.S
 		), nil
 	}
 
+	if entry.ApprovalTTL < 0 {
+		return logical.ErrorResponse(`"approval_ttl" must not be negative`), nil
+	}
+	if entry.IssuanceRateLimit < 0 || entry.IssuanceRatePeriod < 0 || entry.MaxActiveCertificates < 0 {
+		return logical.ErrorResponse(`"issuance_rate_limit", "issuance_rate_period" and "max_active_certificates" must not be negative`), nil
+	}
+
+	if entry.NotBeforeDuration < 0 {
+		return logical.ErrorResponse(`"not_before_duration" must not be negative`), nil
+	}
+	mountConfig, err := b.makeStorageContext(ctx, s).getMountConfig()
+	if err != nil {
+		return nil, err
+	}
+	if mountConfig.MaxNotBeforeDuration > 0 && entry.NotBeforeDuration > mountConfig.MaxNotBeforeDuration {
+		return logical.ErrorResponse(fmt.Sprintf(`"not_before_duration" may not exceed the mount's max_not_before_duration of %v`, mountConfig.MaxNotBeforeDuration)), nil
+	}
+
+	if entry.NoExtKeyUsage && (len(entry.ExtKeyUsage) > 0 || len(entry.ExtKeyUsageOIDs) > 0) {
+		return logical.ErrorResponse(`"no_ext_key_usage" can't be combined with "ext_key_usage" or "ext_key_usage_oids"`), nil
+	}
+
 	if entry.KeyBits, entry.SignatureBits, err = certutil.ValidateDefaultOrValueKeyTypeSignatureLength(entry.KeyType, entry.KeyBits, entry.SignatureBits); err != nil {
 		return logical.ErrorResponse(err.Error()), nil
 	}
@@ -789,6 +974,45 @@ func validateRole(b *backend, entry *roleEntry, ctx context.Context, s logical.S
 		}
 	}
 
+	for _, oidstr := range entry.AllowedExtensionOIDs {
+		if oidstr == "*" {
+			continue
+		}
+		if _, err := certutil.StringToOid(oidstr); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("%q could not be parsed as a valid oid for an allowed extension", oidstr)), nil
+		}
+		if name, reserved := reservedExtensionOIDs[oidstr]; reserved {
+			return logical.ErrorResponse(fmt.Sprintf("the %s extension (%s) is set by Vault and can't be allowed as a custom extension", name, oidstr)), nil
+		}
+	}
+	for _, oidstr := range entry.DeniedExtensionOIDs {
+		if _, err := certutil.StringToOid(oidstr); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("%q could not be parsed as a valid oid for a denied extension", oidstr)), nil
+		}
+	}
+
+	if entry.CommonNameTemplate != "" {
+		if err := validateSubjectTemplate("common_name_template", entry.CommonNameTemplate); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+	for _, tpl := range entry.OUTemplate {
+		if err := validateSubjectTemplate("ou_template", tpl); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+	for _, tpl := range entry.OrganizationTemplate {
+		if err := validateSubjectTemplate("organization_template", tpl); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	if entry.IssuancePolicy != "" {
+		if _, err := compileIssuancePolicy(entry.IssuancePolicy); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
 	if len(entry.PolicyIdentifiers) > 0 {
 		_, err := certutil.CreatePolicyInformationExtensionFromStorageStrings(entry.PolicyIdentifiers)
 		if err != nil {
@@ -820,6 +1044,41 @@ func validateRole(b *backend, entry *roleEntry, ctx context.Context, s logical.S
 			}
 		}
 
+		// The issuer the role defaults to must be one it may use.
+		if len(entry.AllowedIssuers) > 0 && err == nil {
+			allowedResp, err := sc.checkRoleAllowedIssuer(entry, entry.Issuer)
+			if err != nil {
+				return nil, err
+			}
+			if allowedResp != nil {
+				return logical.ErrorResponse(fmt.Sprintf("issuer_ref %v isn't among allowed_issuers", entry.Issuer)), nil
+			}
+		}
+		for _, ref := range entry.AllowedIssuers {
+			if _, err := sc.resolveIssuerReference(ref); err != nil {
+				if resp == nil {
+					resp = &logical.Response{}
+				}
+				resp.AddWarning(fmt.Sprintf("allowed_issuers includes %s, but no issuing certificate currently has that name", ref))
+			}
+		}
+	}
+
+	if entry.CRLPartition != "" {
+		if err := validateCRLPartitionName(entry.CRLPartition); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+
+		urls, err := getGlobalAIAURLs(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		if len(urls.PartitionCRLDistributionPoints) == 0 {
+			if resp == nil {
+				resp = &logical.Response{}
+			}
+			resp.AddWarning("crl_partition is set, but no partition_crl_distribution_points are configured in /config/urls; certificates issued by this role won't point to their partition's CRL")
+		}
 	}
 
 	// Ensures CNValidations are alright
@@ -886,8 +1145,15 @@ func (b *backend) pathRolePatch(ctx context.Context, req *logical.Request, data
 		KeyUsage:                      getWithExplicitDefault(data, "key_usage", oldEntry.KeyUsage).([]string),
 		ExtKeyUsage:                   getWithExplicitDefault(data, "ext_key_usage", oldEntry.ExtKeyUsage).([]string),
 		ExtKeyUsageOIDs:               getWithExplicitDefault(data, "ext_key_usage_oids", oldEntry.ExtKeyUsageOIDs).([]string),
+		NoExtKeyUsage:                 getWithExplicitDefault(data, "no_ext_key_usage", oldEntry.NoExtKeyUsage).(bool),
+		AllowedExtensionOIDs:          getWithExplicitDefault(data, "allowed_extension_oids", oldEntry.AllowedExtensionOIDs).([]string),
+		DeniedExtensionOIDs:           getWithExplicitDefault(data, "denied_extension_oids", oldEntry.DeniedExtensionOIDs).([]string),
+		IssuancePolicy:                getWithExplicitDefault(data, "issuance_policy", oldEntry.IssuancePolicy).(string),
 		OU:                            getWithExplicitDefault(data, "ou", oldEntry.OU).([]string),
 		Organization:                  getWithExplicitDefault(data, "organization", oldEntry.Organization).([]string),
+		CommonNameTemplate:            getWithExplicitDefault(data, "common_name_template", oldEntry.CommonNameTemplate).(string),
+		OUTemplate:                    getWithExplicitDefault(data, "ou_template", oldEntry.OUTemplate).([]string),
+		OrganizationTemplate:          getWithExplicitDefault(data, "organization_template", oldEntry.OrganizationTemplate).([]string),
 		Country:                       getWithExplicitDefault(data, "country", oldEntry.Country).([]string),
 		Locality:                      getWithExplicitDefault(data, "locality", oldEntry.Locality).([]string),
 		Province:                      getWithExplicitDefault(data, "province", oldEntry.Province).([]string),
@@ -899,10 +1165,20 @@ func (b *backend) pathRolePatch(ctx context.Context, req *logical.Request, data
 		CNValidations:                 getWithExplicitDefault(data, "cn_validations", oldEntry.CNValidations).([]string),
 		AllowedSerialNumbers:          getWithExplicitDefault(data, "allowed_serial_numbers", oldEntry.AllowedSerialNumbers).([]string),
 		PolicyIdentifiers:             getPolicyIdentifier(data, &oldEntry.PolicyIdentifiers),
+		PolicyIdentifiersCritical:     getWithExplicitDefault(data, "policy_identifiers_critical", oldEntry.PolicyIdentifiersCritical).(bool),
 		BasicConstraintsValidForNonCA: getWithExplicitDefault(data, "basic_constraints_valid_for_non_ca", oldEntry.BasicConstraintsValidForNonCA).(bool),
+		OCSPMustStaple:                getWithExplicitDefault(data, "ocsp_must_staple", oldEntry.OCSPMustStaple).(bool),
 		NotBeforeDuration:             getTimeWithExplicitDefault(data, "not_before_duration", oldEntry.NotBeforeDuration),
+		AllowNotBefore:                getWithExplicitDefault(data, "allow_not_before", oldEntry.AllowNotBefore).(bool),
 		NotAfter:                      getWithExplicitDefault(data, "not_after", oldEntry.NotAfter).(string),
 		Issuer:                        getWithExplicitDefault(data, "issuer_ref", oldEntry.Issuer).(string),
+		AllowedIssuers:                getWithExplicitDefault(data, "allowed_issuers", oldEntry.AllowedIssuers).([]string),
+		CRLPartition:                  getWithExplicitDefault(data, "crl_partition", oldEntry.CRLPartition).(string),
+		RequireApproval:               getWithExplicitDefault(data, "require_approval", oldEntry.RequireApproval).(bool),
+		ApprovalTTL:                   getTimeWithExplicitDefault(data, "approval_ttl", oldEntry.ApprovalTTL),
+		IssuanceRateLimit:             getWithExplicitDefault(data, "issuance_rate_limit", oldEntry.IssuanceRateLimit).(int),
+		IssuanceRatePeriod:            getTimeWithExplicitDefault(data, "issuance_rate_period", oldEntry.IssuanceRatePeriod),
+		MaxActiveCertificates:         getWithExplicitDefault(data, "max_active_certificates", oldEntry.MaxActiveCertificates).(int),
 	}
 
 	allowedOtherSANsData, wasSet := data.GetOk("allowed_other_sans")
@@ -1001,6 +1277,9 @@ func parseKeyUsages(input []string) int {
 
 func parseExtKeyUsages(role *roleEntry) certutil.CertExtKeyUsage {
 	var parsedKeyUsages certutil.CertExtKeyUsage
+	if role.NoExtKeyUsage {
+		return parsedKeyUsages
+	}
 
 	if role.ServerFlag {
 		parsedKeyUsages |= certutil.ServerAuthExtKeyUsage
@@ -1044,6 +1323,10 @@ func parseExtKeyUsages(role *roleEntry) certutil.CertExtKeyUsage {
 			parsedKeyUsages |= certutil.MicrosoftServerGatedCryptoExtKeyUsage
 		case "netscapeservergatedcrypto":
 			parsedKeyUsages |= certutil.NetscapeServerGatedCryptoExtKeyUsage
+		case "microsoftcommercialcodesigning":
+			parsedKeyUsages |= certutil.MicrosoftCommercialCodeSigningExtKeyUsage
+		case "microsoftkernelcodesigning":
+			parsedKeyUsages |= certutil.MicrosoftKernelCodeSigningExtKeyUsage
 		}
 	}
 
@@ -1089,6 +1372,9 @@ type roleEntry struct {
 	OU                            []string      `json:"ou_list"`
 	OrganizationOld               string        `json:"organization,omitempty"`
 	Organization                  []string      `json:"organization_list"`
+	CommonNameTemplate            string        `json:"common_name_template"`
+	OUTemplate                    []string      `json:"ou_template"`
+	OrganizationTemplate          []string      `json:"organization_template"`
 	Country                       []string      `json:"country"`
 	Locality                      []string      `json:"locality"`
 	Province                      []string      `json:"province"`
@@ -1103,11 +1389,28 @@ type roleEntry struct {
 	AllowedURISANs                []string      `json:"allowed_uri_sans"`
 	AllowedURISANsTemplate        bool          `json:"allowed_uri_sans_template"`
 	PolicyIdentifiers             []string      `json:"policy_identifiers"`
+	PolicyIdentifiersCritical     bool          `json:"policy_identifiers_critical"`
 	ExtKeyUsageOIDs               []string      `json:"ext_key_usage_oids"`
+	NoExtKeyUsage                 bool          `json:"no_ext_key_usage"`
+	AllowedExtensionOIDs          []string      `json:"allowed_extension_oids"`
+	DeniedExtensionOIDs           []string      `json:"denied_extension_oids"`
+	IssuancePolicy                string        `json:"issuance_policy"`
 	BasicConstraintsValidForNonCA bool          `json:"basic_constraints_valid_for_non_ca"`
+	OCSPMustStaple                bool          `json:"ocsp_must_staple"`
 	NotBeforeDuration             time.Duration `json:"not_before_duration"`
+	AllowNotBefore                bool          `json:"allow_not_before"`
 	NotAfter                      string        `json:"not_after"`
 	Issuer                        string        `json:"issuer"`
+	AllowedIssuers                []string      `json:"allowed_issuers"`
+	CRLPartition                  string        `json:"crl_partition"`
+	RequireApproval               bool          `json:"require_approval"`
+	ApprovalTTL                   time.Duration `json:"approval_ttl"`
+	IssuanceRateLimit             int           `json:"issuance_rate_limit"`
+	IssuanceRatePeriod            time.Duration `json:"issuance_rate_period"`
+	MaxActiveCertificates         int           `json:"max_active_certificates"`
+
+	// Name is the name the role is stored under; it isn't persisted.
+	Name string `json:"-"`
 }
 
 func (r *roleEntry) ToResponseData() map[string]interface{} {
@@ -1139,8 +1442,15 @@ func (r *roleEntry) ToResponseData() map[string]interface{} {
 		"key_usage":                          r.KeyUsage,
 		"ext_key_usage":                      r.ExtKeyUsage,
 		"ext_key_usage_oids":                 r.ExtKeyUsageOIDs,
+		"no_ext_key_usage":                   r.NoExtKeyUsage,
+		"allowed_extension_oids":             r.AllowedExtensionOIDs,
+		"denied_extension_oids":              r.DeniedExtensionOIDs,
+		"issuance_policy":                    r.IssuancePolicy,
 		"ou":                                 r.OU,
 		"organization":                       r.Organization,
+		"common_name_template":               r.CommonNameTemplate,
+		"ou_template":                        r.OUTemplate,
+		"organization_template":              r.OrganizationTemplate,
 		"country":                            r.Country,
 		"locality":                           r.Locality,
 		"province":                           r.Province,
@@ -1153,10 +1463,20 @@ func (r *roleEntry) ToResponseData() map[string]interface{} {
 		"require_cn":                         r.RequireCN,
 		"cn_validations":                     r.CNValidations,
 		"policy_identifiers":                 r.PolicyIdentifiers,
+		"policy_identifiers_critical":        r.PolicyIdentifiersCritical,
 		"basic_constraints_valid_for_non_ca": r.BasicConstraintsValidForNonCA,
+		"ocsp_must_staple":                   r.OCSPMustStaple,
 		"not_before_duration":                int64(r.NotBeforeDuration.Seconds()),
+		"allow_not_before":                   r.AllowNotBefore,
 		"not_after":                          r.NotAfter,
 		"issuer_ref":                         r.Issuer,
+		"allowed_issuers":                    r.AllowedIssuers,
+		"crl_partition":                      r.CRLPartition,
+		"require_approval":                   r.RequireApproval,
+		"approval_ttl":                       int64(r.ApprovalTTL.Seconds()),
+		"issuance_rate_limit":                r.IssuanceRateLimit,
+		"issuance_rate_period":               int64(r.IssuanceRatePeriod.Seconds()),
+		"max_active_certificates":            r.MaxActiveCertificates,
 	}
 	if r.MaxPathLength != nil {
 		responseData["max_path_length"] = r.MaxPathLength
@@ -3,6 +3,7 @@ package pki
 import (
 	"context"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/base64"
 	"encoding/pem"
@@ -862,6 +863,21 @@ func TestPki_RolePatch(t *testing.T) {
 			Before:  []string{"1.2.3.4"},
 			Patched: []string{"4.3.2.1"},
 		},
+		{
+			Field:   "allowed_extension_oids",
+			Before:  []string{"1.3.6.1.4.1.311.20.2"},
+			Patched: []string{"*"},
+		},
+		{
+			Field:   "denied_extension_oids",
+			Before:  []string{"1.2.3.4"},
+			Patched: []string{"1.3.6.1.4.1.311.20.2"},
+		},
+		{
+			Field:   "issuance_policy",
+			Before:  "true",
+			Patched: "cert.dns_names.size() <= 2",
+		},
 		{
 			Field:   "use_csr_common_name",
 			Before:  true,
@@ -1154,3 +1170,78 @@ func getPolicyInformationExtensionOffCertificate(resp logical.Response) ([]byte,
 	}
 	return *new([]byte), errors.New("No Policy Information Extension Found")
 }
+
+func TestPKI_PolicyInformationCritical(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+
+	resp, err := CBWrite(b, s, "root/generate/internal", map[string]interface{}{
+		"common_name": "myvault.com",
+		"ttl":         "720h",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+
+	policiesExtension := func(cert *x509.Certificate) pkix.Extension {
+		for _, ext := range cert.Extensions {
+			if ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 32}) {
+				return ext
+			}
+		}
+		t.Fatalf("no certificate policies extension on %v", cert.Subject)
+		return pkix.Extension{}
+	}
+
+	resp, err = CBWrite(b, s, "roles/testrole", map[string]interface{}{
+		"allow_any_name":              true,
+		"policy_identifiers":          "1.3.6.1.4.1.1.1",
+		"policy_identifiers_critical": true,
+	})
+	require.NoError(t, err)
+	require.False(t, resp != nil && resp.IsError(), "failed creating role: %v", resp)
+
+	resp, err = CBRead(b, s, "roles/testrole")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, true, resp.Data["policy_identifiers_critical"])
+
+	resp, err = CBWrite(b, s, "issue/testrole", map[string]interface{}{
+		"common_name": "localhost",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	cert := parseCert(t, resp.Data["certificate"].(string))
+	require.True(t, policiesExtension(cert).Critical)
+	require.Equal(t, "1.3.6.1.4.1.1.1", cert.PolicyIdentifiers[0].String())
+
+	// Updating only the OIDs keeps the stored criticality.
+	resp, err = CBPatch(b, s, "roles/testrole", map[string]interface{}{
+		"policy_identifiers": "1.3.6.1.4.1.1.2",
+	})
+	require.NoError(t, err)
+	require.False(t, resp != nil && resp.IsError(), "failed patching role: %v", resp)
+	resp, err = CBRead(b, s, "roles/testrole")
+	requireSuccessNonNilResponse(t, resp, err)
+	require.Equal(t, true, resp.Data["policy_identifiers_critical"])
+
+	resp, err = CBWrite(b, s, "intermediate/generate/internal", map[string]interface{}{
+		"common_name": "int.myvault.com",
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	csr := resp.Data["csr"].(string)
+
+	resp, err = CBWrite(b, s, "root/sign-intermediate", map[string]interface{}{
+		"csr":                         csr,
+		"common_name":                 "int.myvault.com",
+		"policy_identifiers":          `[{"oid":"1.3.6.1.4.1.7.8","cps":"https://example.com"}]`,
+		"policy_identifiers_critical": true,
+	})
+	requireSuccessNonNilResponse(t, resp, err)
+	cert = parseCert(t, resp.Data["certificate"].(string))
+	require.True(t, policiesExtension(cert).Critical)
+	require.Equal(t, "1.3.6.1.4.1.7.8", cert.PolicyIdentifiers[0].String())
+
+	resp, err = CBWrite(b, s, "root/sign-intermediate", map[string]interface{}{
+		"csr":                csr,
+		"common_name":        "int.myvault.com",
+		"policy_identifiers": `[{"cps":"https://example.com"}]`,
+	})
+	require.Error(t, err, "expected invalid policy_identifiers to be rejected: %v", resp)
+}
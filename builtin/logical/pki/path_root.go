@@ -128,7 +128,7 @@ func (b *backend) pathCAGenerateRoot(ctx context.Context, req *logical.Request,
 	}
 	// Handle the aliased path specifying the new issuer name as "next", but
 	// only do it if its not in use.
-	if strings.HasPrefix(req.Path, "root/rotate/") && len(issuerName) == 0 {
+	if (strings.HasPrefix(req.Path, "root/rotate/") || strings.HasPrefix(req.Path, "root/rotation/generate/")) && len(issuerName) == 0 {
 		// err is nil when the issuer name is in use.
 		_, err = sc.resolveIssuerReference("next")
 		if err != nil {
@@ -257,6 +257,9 @@ func (b *backend) pathCAGenerateRoot(ctx context.Context, req *logical.Request,
 
 	// Also store it as just the certificate identified by serial number, so it
 	// can be revoked
+	if err := sc.writeCertMetadata(newCertMetadata(parsedBundle.Certificate, myIssuer.ID, "", req)); err != nil {
+		return nil, err
+	}
 	err = req.Storage.Put(ctx, &logical.StorageEntry{
 		Key:   "certs/" + normalizeSerial(cb.SerialNumber),
 		Value: parsedBundle.CertificateBytes,
@@ -264,6 +267,7 @@ func (b *backend) pathCAGenerateRoot(ctx context.Context, req *logical.Request,
 	if err != nil {
 		return nil, fmt.Errorf("unable to store certificate locally: %w", err)
 	}
+	b.usageStats.certStored("certs/"+normalizeSerial(cb.SerialNumber), parsedBundle.CertificateBytes)
 
 	// Build a fresh CRL
 	err = b.crlBuilder.rebuild(ctx, b, req, true)
@@ -316,9 +320,17 @@ func (b *backend) pathIssuerSignIntermediate(ctx context.Context, req *logical.R
 		NotAfter:                  data.Get("not_after").(string),
 		NotBeforeDuration:         time.Duration(data.Get("not_before_duration").(int)) * time.Second,
 		CNValidations:             []string{"disabled"},
+		PolicyIdentifiers:         getPolicyIdentifier(data, nil),
+		PolicyIdentifiersCritical: data.Get("policy_identifiers_critical").(bool),
 	}
 	*role.AllowWildcardCertificates = true
 
+	if len(role.PolicyIdentifiers) > 0 {
+		if _, err := certutil.CreatePolicyInformationExtensionFromStorageStrings(role.PolicyIdentifiers); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid policy_identifiers: %v", err)), nil
+		}
+	}
+
 	if cn := data.Get("common_name").(string); len(cn) == 0 {
 		role.UseCSRCommonName = true
 	}
@@ -391,6 +403,10 @@ func (b *backend) pathIssuerSignIntermediate(ctx context.Context, req *logical.R
 		resp.AddWarning("The expiration time for the signed certificate is after the CA's expiration time. If the new certificate is not treated as a root, validation paths with the certificate past the issuing CA's expiration time will fail.")
 	}
 
+	if warning := issuerExpiryWarning(sc, issuerName, signingBundle.Certificate); warning != "" {
+		resp.AddWarning(warning)
+	}
+
 	if len(parsedBundle.Certificate.RawSubject) <= 2 {
 		// Strictly a subject is a SEQUENCE of SETs of SEQUENCES.
 		//
@@ -424,6 +440,18 @@ func (b *backend) pathIssuerSignIntermediate(ctx context.Context, req *logical.R
 		resp.Data["issuing_ca"] = signingCB.Certificate
 		resp.Data["ca_chain"] = caChain
 
+	case "pkcs7":
+		certs := [][]byte{parsedBundle.CertificateBytes}
+		for _, caCert := range parsedBundle.CAChain {
+			certs = append(certs, caCert.Bytes)
+		}
+		resp.Data["certificate"], err = encodePkcs7CertsPEM(certs)
+		if err != nil {
+			return nil, err
+		}
+		resp.Data["issuing_ca"] = signingCB.Certificate
+		resp.Data["ca_chain"] = caChain
+
 	case "der":
 		resp.Data["certificate"] = base64.StdEncoding.EncodeToString(parsedBundle.CertificateBytes)
 		resp.Data["issuing_ca"] = base64.StdEncoding.EncodeToString(signingBundle.CertificateBytes)
@@ -439,6 +467,10 @@ func (b *backend) pathIssuerSignIntermediate(ctx context.Context, req *logical.R
 		return nil, fmt.Errorf("unsupported format argument: %s", format)
 	}
 
+	signingIssuer, _ := sc.resolveIssuerReference(issuerName)
+	if err := sc.writeCertMetadata(newCertMetadata(parsedBundle.Certificate, signingIssuer, "", req)); err != nil {
+		return nil, err
+	}
 	err = req.Storage.Put(ctx, &logical.StorageEntry{
 		Key:   "certs/" + normalizeSerial(cb.SerialNumber),
 		Value: parsedBundle.CertificateBytes,
@@ -446,6 +478,7 @@ func (b *backend) pathIssuerSignIntermediate(ctx context.Context, req *logical.R
 	if err != nil {
 		return nil, fmt.Errorf("unable to store certificate locally: %w", err)
 	}
+	b.usageStats.certStored("certs/"+normalizeSerial(cb.SerialNumber), parsedBundle.CertificateBytes)
 
 	if parsedBundle.Certificate.MaxPathLen == 0 {
 		resp.AddWarning("Max path length of the signed certificate is zero. This certificate cannot be used to issue intermediate CA certificates.")
@@ -0,0 +1,509 @@
+package pki
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	rootRotationPath = "config/root-rotation"
+
+	// A rotation moves through these states in order; a completed rotation
+	// may be followed by a new one.
+	rootRotationStateNone        = "none"
+	rootRotationStateGenerated   = "generated"
+	rootRotationStateCrossSigned = "cross-signed"
+	rootRotationStateCompleted   = "completed"
+)
+
+// Extensions of an issuer's certificate which describe its signer rather
+// than itself; these are replaced when cross-signing it.
+var signerDependentExtensionOIDs = []asn1.ObjectIdentifier{
+	{2, 5, 29, 35},              // authority key identifier
+	{2, 5, 29, 31},              // CRL distribution points
+	{1, 3, 6, 1, 5, 5, 7, 1, 1}, // authority information access
+}
+
+type rootRotationEntry struct {
+	State string `json:"state"`
+
+	// The default issuer when the rotation started, and its replacement.
+	CurrentIssuer issuerID `json:"current_issuer"`
+	NextIssuer    issuerID `json:"next_issuer"`
+
+	// The current root cross-signed by the replacement, and the
+	// replacement cross-signed by the current root.
+	CurrentCrossSigned issuerID `json:"current_cross_signed,omitempty"`
+	NextCrossSigned    issuerID `json:"next_cross_signed,omitempty"`
+
+	StartedAt   time.Time `json:"started_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+func pathRootRotation(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "root/rotation",
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathReadRootRotation,
+			},
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback: b.pathAbortRootRotation,
+				// Read more about why these flags are set in backend.go
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathRootRotationHelpSyn,
+		HelpDescription: pathRootRotationHelpDesc,
+	}
+}
+
+func pathRootRotationGenerate(b *backend) *framework.Path {
+	ret := buildPathGenerateRoot(b, "root/rotation/generate/"+framework.GenericNameRegex("exported"))
+	ret.Operations[logical.UpdateOperation].(*framework.PathOperation).Callback = b.pathRootRotationGenerate
+	ret.HelpSynopsis = pathRootRotationGenerateHelpSyn
+	ret.HelpDescription = pathRootRotationGenerateHelpDesc
+	return ret
+}
+
+func pathRootRotationCrossSign(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "root/rotation/cross-sign",
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathRootRotationCrossSign,
+				// Read more about why these flags are set in backend.go
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathRootRotationCrossSignHelpSyn,
+		HelpDescription: pathRootRotationCrossSignHelpDesc,
+	}
+}
+
+func pathRootRotationComplete(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "root/rotation/complete",
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathRootRotationComplete,
+				// Read more about why these flags are set in backend.go
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathRootRotationCompleteHelpSyn,
+		HelpDescription: pathRootRotationCompleteHelpDesc,
+	}
+}
+
+func (sc *storageContext) getRootRotation() (*rootRotationEntry, error) {
+	entry, err := sc.Storage.Get(sc.Context, rootRotationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	rotation := &rootRotationEntry{State: rootRotationStateNone}
+	if entry == nil {
+		return rotation, nil
+	}
+
+	if err := entry.DecodeJSON(rotation); err != nil {
+		return nil, fmt.Errorf("unable to decode root rotation state: %w", err)
+	}
+
+	return rotation, nil
+}
+
+func (sc *storageContext) setRootRotation(rotation *rootRotationEntry) error {
+	rotation.UpdatedAt = time.Now()
+	entry, err := logical.StorageEntryJSON(rootRotationPath, rotation)
+	if err != nil {
+		return err
+	}
+
+	return sc.Storage.Put(sc.Context, entry)
+}
+
+func (r *rootRotationEntry) ToResponseData() map[string]interface{} {
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+
+	return map[string]interface{}{
+		"state":                r.State,
+		"current_issuer":       r.CurrentIssuer.String(),
+		"next_issuer":          r.NextIssuer.String(),
+		"current_cross_signed": r.CurrentCrossSigned.String(),
+		"next_cross_signed":    r.NextCrossSigned.String(),
+		"started_at":           formatTime(r.StartedAt),
+		"updated_at":           formatTime(r.UpdatedAt),
+		"completed_at":         formatTime(r.CompletedAt),
+	}
+}
+
+func (b *backend) pathReadRootRotation(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	rotation, err := sc.getRootRotation()
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: rotation.ToResponseData(),
+	}, nil
+}
+
+func (b *backend) pathAbortRootRotation(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	b.rootRotationLock.Lock()
+	defer b.rootRotationLock.Unlock()
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+	rotation, err := sc.getRootRotation()
+	if err != nil {
+		return nil, err
+	}
+
+	switch rotation.State {
+	case rootRotationStateNone, rootRotationStateCompleted:
+		return logical.ErrorResponse("no root rotation is in progress"), nil
+	}
+
+	if err := req.Storage.Delete(ctx, rootRotationPath); err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{}
+	resp.AddWarning(fmt.Sprintf("The root rotation was aborted; the replacement issuer (%v) and any cross-signed issuers remain in the mount and can be deleted if unwanted.", rotation.NextIssuer))
+	return resp, nil
+}
+
+func (b *backend) pathRootRotationGenerate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.rootRotationLock.Lock()
+	defer b.rootRotationLock.Unlock()
+
+	if b.useLegacyBundleCaStorage() {
+		return logical.ErrorResponse("Can not rotate the root until migration has completed"), nil
+	}
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+	rotation, err := sc.getRootRotation()
+	if err != nil {
+		return nil, err
+	}
+	switch rotation.State {
+	case rootRotationStateNone, rootRotationStateCompleted:
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("a root rotation is already in progress (state %q); complete or abort it first", rotation.State)), nil
+	}
+
+	// Only a root with its key in this mount can be rotated in place: the
+	// replacement is cross-signed with it.
+	current, err := sc.resolveIssuerReference(defaultRef)
+	if err != nil {
+		return logical.ErrorResponse("the mount has no default issuer to rotate"), nil
+	}
+	currentIssuer, err := sc.fetchIssuerById(current)
+	if err != nil {
+		return nil, err
+	}
+	currentCert, err := currentIssuer.GetCertificate()
+	if err != nil {
+		return nil, err
+	}
+	if currentCert.CheckSignatureFrom(currentCert) != nil {
+		return logical.ErrorResponse(fmt.Sprintf("the default issuer (%v) is not a root", current)), nil
+	}
+	if currentIssuer.KeyID == "" {
+		return logical.ErrorResponse(fmt.Sprintf("the default issuer (%v) has no key in this mount", current)), nil
+	}
+
+	resp, err := b.pathCAGenerateRoot(ctx, req, data)
+	if err != nil || resp == nil || resp.IsError() {
+		return resp, err
+	}
+
+	*rotation = rootRotationEntry{
+		State:         rootRotationStateGenerated,
+		CurrentIssuer: current,
+		NextIssuer:    resp.Data["issuer_id"].(issuerID),
+		StartedAt:     time.Now(),
+	}
+	if err := sc.setRootRotation(rotation); err != nil {
+		return nil, err
+	}
+
+	resp.Data["rotation"] = rotation.ToResponseData()
+	return resp, nil
+}
+
+func (b *backend) pathRootRotationCrossSign(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	b.rootRotationLock.Lock()
+	defer b.rootRotationLock.Unlock()
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	if b.useLegacyBundleCaStorage() {
+		return logical.ErrorResponse("Can not rotate the root until migration has completed"), nil
+	}
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+	rotation, err := sc.getRootRotation()
+	if err != nil {
+		return nil, err
+	}
+	if rotation.State != rootRotationStateGenerated {
+		return logical.ErrorResponse(fmt.Sprintf("the root rotation must be in state %q to cross-sign, but is in state %q", rootRotationStateGenerated, rotation.State)), nil
+	}
+
+	nextCrossSigned, err := b.crossSignRoot(sc, req, rotation.NextIssuer, rotation.CurrentIssuer)
+	if err != nil {
+		return crossSignRootError(err)
+	}
+	currentCrossSigned, err := b.crossSignRoot(sc, req, rotation.CurrentIssuer, rotation.NextIssuer)
+	if err != nil {
+		return crossSignRootError(err)
+	}
+
+	if err := b.crlBuilder.rebuild(ctx, b, req, true); err != nil {
+		return nil, err
+	}
+
+	rotation.State = rootRotationStateCrossSigned
+	rotation.NextCrossSigned = nextCrossSigned
+	rotation.CurrentCrossSigned = currentCrossSigned
+	if err := sc.setRootRotation(rotation); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: rotation.ToResponseData(),
+	}, nil
+}
+
+func crossSignRootError(err error) (*logical.Response, error) {
+	switch err.(type) {
+	case errutil.UserError:
+		return logical.ErrorResponse(err.Error()), nil
+	default:
+		return nil, err
+	}
+}
+
+// crossSignRoot signs a copy of the subject issuer's certificate, with its
+// exact subject, key and extensions, using the signer issuer, and imports
+// it as a cross-signed sibling of the subject issuer.
+func (b *backend) crossSignRoot(sc *storageContext, req *logical.Request, subjectId issuerID, signerId issuerID) (issuerID, error) {
+	subject, err := sc.fetchIssuerById(subjectId)
+	if err != nil {
+		return "", err
+	}
+	subjectCert, err := subject.GetCertificate()
+	if err != nil {
+		return "", err
+	}
+
+	signer, err := sc.fetchCAInfoByIssuerId(signerId, IssuanceUsage)
+	if err != nil {
+		return "", err
+	}
+
+	serialNumber, err := certutil.GenerateSerialNumberWithFormat(rand.Reader, signer.SerialNumberPrefix, signer.SerialNumberBits)
+	if err != nil {
+		return "", err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		RawSubject:            subjectCert.RawSubject,
+		NotBefore:             time.Now().Add(-30 * time.Second),
+		NotAfter:              subjectCert.NotAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          subjectCert.SubjectKeyId,
+		IssuingCertificateURL: signer.URLs.IssuingCertificates,
+		CRLDistributionPoints: signer.URLs.CRLDistributionPoints,
+		OCSPServer:            signer.URLs.OCSPServers,
+	}
+	if signer.Certificate.NotAfter.Before(template.NotAfter) {
+		template.NotAfter = signer.Certificate.NotAfter
+	}
+	for _, ext := range subjectCert.Extensions {
+		dependent := false
+		for _, oid := range signerDependentExtensionOIDs {
+			if ext.Id.Equal(oid) {
+				dependent = true
+				break
+			}
+		}
+		if !dependent {
+			template.ExtraExtensions = append(template.ExtraExtensions, ext)
+		}
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, signer.Certificate, subjectCert.PublicKey, signer.PrivateKey)
+	if err != nil {
+		return "", fmt.Errorf("unable to cross-sign issuer %v with issuer %v: %w", subjectId, signerId, err)
+	}
+	cert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		return "", err
+	}
+
+	certPem := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes}))
+	sibling, existing, err := sc.importIssuer(certPem, "")
+	if err != nil {
+		return "", err
+	}
+	if err := sc.linkCrossSignedIssuer(subject, sibling, !existing); err != nil {
+		return "", err
+	}
+
+	// Like any other certificate this mount signs, keep it so it can be
+	// revoked.
+	if err := sc.writeCertMetadata(newCertMetadata(cert, signerId, "", req)); err != nil {
+		return "", err
+	}
+	err = sc.Storage.Put(sc.Context, &logical.StorageEntry{
+		Key:   "certs/" + normalizeSerial(serialFromCert(cert)),
+		Value: certBytes,
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to store certificate locally: %w", err)
+	}
+	b.usageStats.certStored("certs/"+normalizeSerial(serialFromCert(cert)), certBytes)
+
+	return sibling.ID, nil
+}
+
+func (b *backend) pathRootRotationComplete(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	b.rootRotationLock.Lock()
+	defer b.rootRotationLock.Unlock()
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	if b.useLegacyBundleCaStorage() {
+		return logical.ErrorResponse("Can not rotate the root until migration has completed"), nil
+	}
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+	rotation, err := sc.getRootRotation()
+	if err != nil {
+		return nil, err
+	}
+	if rotation.State != rootRotationStateCrossSigned {
+		return logical.ErrorResponse(fmt.Sprintf("the root rotation must be in state %q to complete, but is in state %q", rootRotationStateCrossSigned, rotation.State)), nil
+	}
+
+	next, err := sc.fetchIssuerById(rotation.NextIssuer)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("unable to fetch the replacement issuer (%v): %v", rotation.NextIssuer, err)), nil
+	}
+
+	if err := sc.updateDefaultIssuerId(next.ID); err != nil {
+		return nil, err
+	}
+
+	rotation.State = rootRotationStateCompleted
+	rotation.CompletedAt = time.Now()
+	if err := sc.setRootRotation(rotation); err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{
+		Data: rotation.ToResponseData(),
+	}
+
+	// Roles referencing the previous root explicitly keep using it.
+	references := []string{rotation.CurrentIssuer.String()}
+	if current, err := sc.fetchIssuerById(rotation.CurrentIssuer); err == nil && current.Name != "" {
+		references = append(references, current.Name)
+	}
+	for _, reference := range references {
+		timeout, inUseBy, err := sc.checkForRolesReferencing(reference)
+		if err != nil || timeout {
+			resp.AddWarning("Unable to check whether any roles still reference the previous root; roles referencing it explicitly will keep issuing from it.")
+			break
+		}
+		if inUseBy > 0 {
+			resp.AddWarning(fmt.Sprintf("%d role(s) reference the previous root as %q and will keep issuing from it until updated.", inUseBy, reference))
+		}
+	}
+
+	return resp, nil
+}
+
+const pathRootRotationHelpSyn = `
+Read or abort the staged rotation of the mount's root.
+`
+
+const pathRootRotationHelpDesc = `
+Rotating the root of a mount is staged across three endpoints, whose
+progress is tracked here:
+
+ 1. root/rotation/generate/:type generates the replacement root alongside
+    the current (default) one, which keeps issuing.
+ 2. root/rotation/cross-sign cross-signs each root with the other, so
+    clients trusting either can validate chains through both.
+ 3. root/rotation/complete makes the replacement the mount's default
+    issuer.
+
+Deleting this path aborts a rotation in progress, leaving any issuers it
+created in place.
+`
+
+const pathRootRotationGenerateHelpSyn = `
+Generate the replacement root, starting a staged root rotation.
+`
+
+const pathRootRotationGenerateHelpDesc = `
+Generates a new root as root/generate/:type does, named "next" unless
+issuer_name is given, alongside the mount's default issuer, which must be
+a root with its key in the mount. The default issuer is unchanged until
+root/rotation/complete.
+`
+
+const pathRootRotationCrossSignHelpSyn = `
+Cross-sign the current and replacement roots with each other.
+`
+
+const pathRootRotationCrossSignHelpDesc = `
+Signs a copy of the replacement root's certificate with the current root,
+and a copy of the current root's certificate with the replacement, and
+imports both as issuers linked to the roots they copy. Clients trusting
+only one of the roots can then validate certificates issued from either.
+`
+
+const pathRootRotationCompleteHelpSyn = `
+Complete the staged root rotation, making the replacement the default issuer.
+`
+
+const pathRootRotationCompleteHelpDesc = `
+Atomically makes the replacement root the mount's default issuer, once it
+has been cross-signed. Roles referencing the previous root explicitly
+(rather than as "default") keep using it; a warning is returned if any do.
+`
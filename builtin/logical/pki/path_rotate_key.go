@@ -0,0 +1,510 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// rotatedRevocationsPath holds cluster-local markers recording that
+// revocations have been moved to the issuer holding a rotated key; see
+// moveRotatedRevocations.
+const rotatedRevocationsPath = "revoked-rotated/"
+
+func pathIssuerRotateKeyGenerate(b *backend) *framework.Path {
+	fields := addIssuerRefField(map[string]*framework.FieldSchema{})
+	fields[keyNameParam] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "Optional name to be used for the new key",
+	}
+	fields[keyTypeParam] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `The type of the new key; "rsa", "ec" or "ed25519".
+Defaults to the type of the issuer's current key.`,
+	}
+	fields[keyBitsParam] = &framework.FieldSchema{
+		Type:    framework.TypeInt,
+		Default: 0,
+		Description: `The number of bits of the new key. Defaults to the
+size of the issuer's current key when key_type is unset, and to the
+universal default for key_type otherwise.`,
+	}
+
+	return &framework.Path{
+		Pattern: "issuer/" + framework.GenericNameRegex(issuerRefParam) + "/rotate-key/generate/(internal|exported)",
+		Fields:  fields,
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathIssuerRotateKeyGenerate,
+				// Read more about why these flags are set in backend.go
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathIssuerRotateKeyGenerateHelpSyn,
+		HelpDescription: pathIssuerRotateKeyGenerateHelpDesc,
+	}
+}
+
+func pathIssuerRotateKeyImport(b *backend) *framework.Path {
+	fields := addIssuerRefField(map[string]*framework.FieldSchema{})
+	fields["certificate"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `PEM-format certificate for the issuer, signed over
+the key generated by the rotate-key/generate endpoint.`,
+	}
+
+	return &framework.Path{
+		Pattern: "issuer/" + framework.GenericNameRegex(issuerRefParam) + "/rotate-key/import",
+		Fields:  fields,
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathIssuerRotateKeyImport,
+				// Read more about why these flags are set in backend.go
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathIssuerRotateKeyImportHelpSyn,
+		HelpDescription: pathIssuerRotateKeyImportHelpDesc,
+	}
+}
+
+func (b *backend) pathIssuerRotateKeyGenerate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Since we're planning on updating issuers here, grab the lock so we've
+	// got a consistent view.
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	if b.useLegacyBundleCaStorage() {
+		return logical.ErrorResponse("cannot rotate issuer keys until migration has completed"), nil
+	}
+
+	issuerName := getIssuerRef(data)
+	if len(issuerName) == 0 {
+		return logical.ErrorResponse("missing issuer reference"), nil
+	}
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+	ref, err := sc.resolveIssuerReference(issuerName)
+	if err != nil {
+		return nil, err
+	}
+	if ref == "" {
+		return logical.ErrorResponse("unable to resolve issuer id for reference: " + issuerName), nil
+	}
+
+	issuer, err := sc.fetchIssuerById(ref)
+	if err != nil {
+		return nil, err
+	}
+	issuerCert, err := issuer.GetCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	keyName, err := getKeyName(sc, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	keyType := data.Get(keyTypeParam).(string)
+	keyBits := data.Get(keyBitsParam).(int)
+	if keyType == "" {
+		keyType, keyBits = certKeyTypeAndBits(issuerCert)
+	}
+	keyBits, _, err = certutil.ValidateDefaultOrValueKeyTypeSignatureLength(keyType, keyBits, 0)
+	if err != nil {
+		return logical.ErrorResponse("Validation for key_type, key_bits failed: %s", err.Error()), nil
+	}
+
+	keyBundle, err := certutil.CreateKeyBundle(keyType, keyBits, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	privateKeyPemString, err := keyBundle.ToPrivateKeyPemString()
+	if err != nil {
+		return nil, err
+	}
+
+	// As with cross-signing, the CSR reuses the issuer's exact subject so
+	// the re-signed certificate can take the issuer's place.
+	csrTemplate := &x509.CertificateRequest{
+		RawSubject:     issuerCert.RawSubject,
+		DNSNames:       issuerCert.DNSNames,
+		EmailAddresses: issuerCert.EmailAddresses,
+		IPAddresses:    issuerCert.IPAddresses,
+		URIs:           issuerCert.URIs,
+	}
+	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, csrTemplate, keyBundle.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create key rotation CSR: %w", err)
+	}
+
+	key, _, err := sc.importKey(privateKeyPemString, keyName, keyBundle.PrivateKeyType)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := issuer.PendingKeyID
+	issuer.PendingKeyID = key.ID
+	if err := sc.writeIssuer(issuer); err != nil {
+		return nil, err
+	}
+
+	// A rotation started earlier is superseded; drop its key unless
+	// something else has come to use it.
+	if previous != "" && previous != key.ID {
+		if inUse, _, err := sc.isKeyInUse(previous.String()); err == nil && !inUse {
+			if _, err := sc.deleteKey(previous); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"csr":       strings.TrimSpace(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrBytes}))),
+			"issuer_id": issuer.ID,
+			"key_id":    key.ID,
+		},
+	}
+	if strings.HasSuffix(req.Path, "/exported") {
+		resp.Data["private_key"] = privateKeyPemString
+		resp.Data["private_key_type"] = keyBundle.PrivateKeyType
+	}
+
+	return resp, nil
+}
+
+func (b *backend) pathIssuerRotateKeyImport(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Since we're planning on updating issuers here, grab the lock so we've
+	// got a consistent view.
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	if b.useLegacyBundleCaStorage() {
+		return logical.ErrorResponse("cannot rotate issuer keys until migration has completed"), nil
+	}
+
+	issuerName := getIssuerRef(data)
+	if len(issuerName) == 0 {
+		return logical.ErrorResponse("missing issuer reference"), nil
+	}
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+	ref, err := sc.resolveIssuerReference(issuerName)
+	if err != nil {
+		return nil, err
+	}
+	if ref == "" {
+		return logical.ErrorResponse("unable to resolve issuer id for reference: " + issuerName), nil
+	}
+
+	issuer, err := sc.fetchIssuerById(ref)
+	if err != nil {
+		return nil, err
+	}
+	if issuer.PendingKeyID == "" {
+		return logical.ErrorResponse(fmt.Sprintf("issuer %v has no pending key; generate one through issuer/%v/rotate-key/generate first", issuer.ID, issuer.ID)), nil
+	}
+	issuerCert, err := issuer.GetCertificate()
+	if err != nil {
+		return nil, err
+	}
+	pendingKey, err := sc.fetchKeyById(issuer.PendingKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	certPem := strings.TrimSpace(data.Get("certificate").(string)) + "\n"
+	if strings.Count(certPem, "-BEGIN ") != 1 {
+		return logical.ErrorResponse("exactly one PEM-format certificate must be provided"), nil
+	}
+	rotated, err := parseCertificateFromBytes([]byte(certPem))
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("unable to parse certificate: %v", err)), nil
+	}
+
+	// The new certificate must be able to take the issuer's place: a CA
+	// certificate with the issuer's subject, over the pending key.
+	if !rotated.BasicConstraintsValid || !rotated.IsCA {
+		return logical.ErrorResponse("certificate is not a CA certificate"), nil
+	}
+	if !bytes.Equal(rotated.RawSubject, issuerCert.RawSubject) {
+		return logical.ErrorResponse(fmt.Sprintf("certificate's subject (%v) does not match issuer %v's subject (%v)", rotated.Subject, issuer.ID, issuerCert.Subject)), nil
+	}
+	equal, err := comparePublicKey(sc, pendingKey, rotated.PublicKey)
+	if err != nil || !equal {
+		return logical.ErrorResponse(fmt.Sprintf("certificate's public key does not match issuer %v's pending key %v", issuer.ID, pendingKey.ID)), nil
+	}
+
+	// Keep the previous certificate and key as a separate issuer, so
+	// certificates issued under them can still be revoked and checked over
+	// OCSP, but not as an issuing one. Should an earlier attempt have
+	// failed after creating it, it's reused.
+	var previous *issuerEntry
+	if issuer.KeyID != "" {
+		previous, err = sc.fetchRotationPreviousIssuer(issuer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if previous == nil && issuer.KeyID != "" {
+		previous = &issuerEntry{}
+		*previous = *issuer
+		previous.ID = genIssuerId()
+		previous.Name = ""
+		previous.PendingKeyID = ""
+		previous.RotatedFrom = issuer.ID
+		previous.LastModified = time.Time{}
+		if previous.Usage.HasUsage(IssuanceUsage) {
+			previous.Usage.ToggleUsage(IssuanceUsage)
+		}
+		if err := sc.writeIssuer(previous); err != nil {
+			return nil, err
+		}
+	}
+
+	// Block revocations until the issuer has been updated, so that none
+	// are recorded against it between moving its existing ones over to
+	// the previous issuer and its key changing.
+	err = func() error {
+		b.revokeStorageLock.Lock()
+		defer b.revokeStorageLock.Unlock()
+
+		if previous != nil {
+			if err := sc.moveRotatedRevocations(previous); err != nil {
+				return err
+			}
+			if err := sc.detachRotatedIssuer(issuer.ID, previous.ID); err != nil {
+				return err
+			}
+		}
+
+		// The issuer keeps its identifier, name and settings; only its
+		// certificate and key change, in a single write. It's written
+		// last, so that until it is, retrying picks up where a failed
+		// attempt left off.
+		issuer.Certificate = certPem
+		issuer.SerialNumber = serialFromCert(rotated)
+		issuer.KeyID = pendingKey.ID
+		issuer.PendingKeyID = ""
+		issuer.LastModified = time.Now().UTC()
+		if (rotated.KeyUsage&x509.KeyUsageCRLSign) == 0 && issuer.Usage.HasUsage(CRLSigningUsage) {
+			issuer.Usage.ToggleUsage(CRLSigningUsage)
+		}
+		return sc.rebuildIssuersChains(issuer)
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.crlBuilder.rebuild(ctx, b, req, true); err != nil {
+		return nil, err
+	}
+
+	issuer, err = sc.fetchIssuerById(issuer.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := respondReadIssuer(issuer)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		resp.Data["previous_issuer_id"] = previous.ID
+	}
+	return resp, nil
+}
+
+// fetchRotationPreviousIssuer returns the issuer holding the given issuer's
+// current key and certificate, created by an earlier, failed attempt at
+// rotating its key, if any.
+func (sc *storageContext) fetchRotationPreviousIssuer(issuer *issuerEntry) (*issuerEntry, error) {
+	issuers, err := sc.listIssuers()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range issuers {
+		if id == issuer.ID {
+			continue
+		}
+		candidate, err := sc.fetchIssuerById(id)
+		if err != nil {
+			return nil, err
+		}
+		if candidate.RotatedFrom == issuer.ID && candidate.KeyID == issuer.KeyID && candidate.Certificate == issuer.Certificate {
+			return candidate, nil
+		}
+	}
+	return nil, nil
+}
+
+// moveRotatedRevocations re-associates the revocations recorded against
+// the issuer whose key was rotated, of certificates signed by its previous
+// key, with the previous issuer holding that key: they belong on the CRL
+// signed by that key, and OCSP responses for them must be signed with it
+// too. As revocations are cluster-local, each cluster moves its own: the
+// one rotating the key right away, and others on their next complete CRL
+// build. A cluster-local marker records that it's done; repeating it is
+// harmless otherwise.
+func (sc *storageContext) moveRotatedRevocations(previous *issuerEntry) error {
+	marker := rotatedRevocationsPath + previous.ID.String()
+	done, err := sc.Storage.Get(sc.Context, marker)
+	if err != nil || done != nil {
+		return err
+	}
+
+	previousCert, err := previous.GetCertificate()
+	if err != nil {
+		return err
+	}
+
+	summaries, err := listRevocationSummaries(sc)
+	if err != nil {
+		return err
+	}
+
+	moved := 0
+	for serial, summary := range summaries {
+		if summary.CertificateIssuer != previous.RotatedFrom {
+			continue
+		}
+
+		entry, err := sc.Storage.Get(sc.Context, revokedPath+serial)
+		if err != nil {
+			return fmt.Errorf("error fetching revocation entry: %w", err)
+		}
+		if entry == nil {
+			continue
+		}
+		var revInfo revocationInfo
+		if err := entry.DecodeJSON(&revInfo); err != nil {
+			return fmt.Errorf("error decoding revocation entry for serial %v: %w", serial, err)
+		}
+
+		// Revocations without a certificate, such as imported ones, can't
+		// be told apart and stay where they are.
+		cert, err := x509.ParseCertificate(revInfo.CertificateBytes)
+		if err != nil || cert.CheckSignatureFrom(previousCert) != nil {
+			continue
+		}
+
+		revInfo.CertificateIssuer = previous.ID
+		if err := writeRevocationEntry(sc, serial, &revInfo); err != nil {
+			return err
+		}
+		moved++
+
+		if err := sc.moveUnifiedRevocationEntry(serial, &revInfo, cert.NotAfter); err != nil {
+			return err
+		}
+	}
+
+	err = sc.Storage.Put(sc.Context, &logical.StorageEntry{
+		Key:   marker,
+		Value: []byte(time.Now().UTC().Format(time.RFC3339)),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to record the move of revocations to issuer %v: %w", previous.ID, err)
+	}
+
+	if moved > 0 {
+		sc.Backend.Logger().Info("Moved revocations to the issuer holding a rotated key.", "issuer_id", previous.RotatedFrom, "previous_issuer_id", previous.ID, "revocations", moved)
+	}
+	return nil
+}
+
+// detachRotatedIssuer moves what depended on the rotated issuer's previous
+// key over to previousId, which now holds it: cross-signed siblings are
+// relinked, and issuers which shared the rotated issuer's CRL are given
+// their own, as they no longer share a key with it.
+func (sc *storageContext) detachRotatedIssuer(rotatedId issuerID, previousId issuerID) error {
+	issuers, err := sc.listIssuers()
+	if err != nil {
+		return err
+	}
+	for _, id := range issuers {
+		if id == rotatedId {
+			continue
+		}
+		sibling, err := sc.fetchIssuerById(id)
+		if err != nil {
+			return err
+		}
+		if sibling.CrossSignedFrom != rotatedId {
+			continue
+		}
+		sibling.CrossSignedFrom = previousId
+		if err := sc.writeIssuer(sibling); err != nil {
+			return err
+		}
+	}
+
+	crlConfig, err := sc.getLocalCRLConfig()
+	if err != nil {
+		return err
+	}
+	crlIdentifier, ok := crlConfig.IssuerIDCRLMap[rotatedId]
+	if !ok {
+		return nil
+	}
+	for id, otherCRL := range crlConfig.IssuerIDCRLMap {
+		if id != rotatedId && otherCRL == crlIdentifier {
+			delete(crlConfig.IssuerIDCRLMap, id)
+		}
+	}
+	return sc.setLocalCRLConfig(crlConfig)
+}
+
+// certKeyTypeAndBits returns the type and size of a certificate's public
+// key.
+func certKeyTypeAndBits(cert *x509.Certificate) (string, int) {
+	switch cert.PublicKeyAlgorithm {
+	case x509.RSA:
+		return "rsa", certutil.GetPublicKeySize(cert.PublicKey)
+	case x509.ECDSA:
+		return "ec", certutil.GetPublicKeySize(cert.PublicKey)
+	case x509.Ed25519:
+		return "ed25519", 0
+	default:
+		return cert.PublicKeyAlgorithm.String(), 0
+	}
+}
+
+const (
+	pathIssuerRotateKeyGenerateHelpSyn  = `Generate a new key for an existing issuer, and a CSR to re-sign it.`
+	pathIssuerRotateKeyGenerateHelpDesc = `
+This endpoint generates a new key for the specified issuer and a CSR with
+the issuer's subject over it. The issuer keeps using its current key until
+the certificate signed from the CSR is imported through the
+issuer/:issuer_ref/rotate-key/import endpoint. Generating again replaces
+the pending key.
+`
+
+	pathIssuerRotateKeyImportHelpSyn  = `Swap an issuer's key for its pending key, using the re-signed certificate.`
+	pathIssuerRotateKeyImportHelpDesc = `
+This endpoint replaces the specified issuer's certificate and key with the
+provided certificate and the key generated for it. The issuer keeps its
+identifier, name, settings and CRL, so roles and other references to it
+don't need to change. The previous certificate and key are kept as a new,
+non-issuing issuer, whose identifier is returned as previous_issuer_id.
+Revocations of certificates issued under the previous key move to that
+issuer, and so to its CRL.
+`
+)
@@ -0,0 +1,700 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mozilla.org/pkcs7"
+	"golang.org/x/crypto/cryptobyte"
+	cbbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// The SCEP (RFC 8894) endpoints let devices which only speak SCEP, such as
+// MDM-managed endpoints and legacy network equipment, fetch the CA
+// certificates and enroll for certificates. They are served under
+// scep/[<label>/]pkiclient.exe, with the operation given by the operation
+// query parameter, and each label mapped to a role by config/scep.
+//
+// PKIOperation messages are PKCS#7 SignedData structures, signed by the
+// device, enveloping a PKCS#10 CSR encrypted to the issuer of the role;
+// the issuer must thus have an RSA key. They are sent either base64-encoded
+// in the message query parameter of a GET request, or as the body of a POST
+// request with the application/x-pki-message content type, whose body
+// Vault passes through unparsed. Devices authenticate enrollments with the
+// challenge password of their CSR, and renewals with the certificate being
+// renewed.
+const (
+	scepContentTypeCACert   = "application/x-x509-ca-cert"
+	scepContentTypeCAChain  = "application/x-x509-ca-ra-cert"
+	scepContentTypeMessage  = "application/x-pki-message"
+	scepContentTypeCapsText = "text/plain"
+
+	scepOperationGetCACaps    = "GetCACaps"
+	scepOperationGetCACert    = "GetCACert"
+	scepOperationPKIOperation = "PKIOperation"
+
+	// Values of the messageType attribute.
+	scepMessageTypeCertRep    = "3"
+	scepMessageTypeRenewalReq = "17"
+	scepMessageTypePKCSReq    = "19"
+
+	// Values of the pkiStatus attribute.
+	scepStatusSuccess = "0"
+	scepStatusFailure = "2"
+
+	// Values of the failInfo attribute.
+	scepFailBadAlg          = "0"
+	scepFailBadMessageCheck = "1"
+	scepFailBadRequest      = "2"
+
+	// scepMaxRequestSize bounds the size of PKIOperation messages.
+	scepMaxRequestSize = 64 * 1024
+
+	scepNonceSize = 16
+)
+
+// scepCapabilities are the capabilities advertised by GetCACaps.
+var scepCapabilities = []string{"POSTPKIOperation", "Renewal", "SHA-256", "AES", "SCEPStandard"}
+
+var (
+	oidScepMessageType    = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 2}
+	oidScepPkiStatus      = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 3}
+	oidScepFailInfo       = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 4}
+	oidScepSenderNonce    = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 5}
+	oidScepRecipientNonce = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 6}
+	oidScepTransactionID  = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 7}
+
+	oidChallengePassword = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}
+)
+
+func pathScep(b *backend) *framework.Path {
+	handler := b.metricsWrap("scep", noRole, func(ctx context.Context, req *logical.Request, data *framework.FieldData, _ *roleEntry) (*logical.Response, error) {
+		return b.pathScepOperation(ctx, req, data)
+	})
+
+	return &framework.Path{
+		Pattern: "scep/(" + framework.GenericNameRegex("label") + "/)?pkiclient\\.exe",
+		Fields: map[string]*framework.FieldSchema{
+			"label": {
+				Type:        framework.TypeString,
+				Description: `SCEP label, mapped to a role by config/scep.`,
+			},
+			"operation": {
+				Type:        framework.TypeString,
+				Description: `SCEP operation: GetCACaps, GetCACert or PKIOperation.`,
+			},
+			"message": {
+				Type:        framework.TypeString,
+				Description: `Base64-encoded PKIOperation message, on GET requests.`,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: handler,
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: handler,
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathScepHelpSyn,
+		HelpDescription: pathScepHelpDesc,
+	}
+}
+
+func pathScepChallenge(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "scep/(" + framework.GenericNameRegex("label") + "/)?challenge",
+		Fields: map[string]*framework.FieldSchema{
+			"label": {
+				Type:        framework.TypeString,
+				Description: `SCEP label, mapped to a role by config/scep.`,
+			},
+			"allowed_names": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `Names (supporting globs) the enrolling device may
+request, as the common name or a subject alternative name, in addition to
+the role's restrictions. When empty, only the role's restrictions apply.`,
+			},
+			"ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: `How long the challenge password remains usable.`,
+				Default:     "1h",
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathScepChallenge,
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathScepChallengeHelpSyn,
+		HelpDescription: pathScepChallengeHelpDesc,
+	}
+}
+
+// scepRole returns the role enrollments under the requested label issue
+// against, or an error response should SCEP be disabled or the label
+// unknown.
+func (b *backend) scepRole(sc *storageContext, data *framework.FieldData) (*scepConfigEntry, string, *roleEntry, *logical.Response, error) {
+	config, err := sc.getScepConfig()
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+	if !config.Enabled {
+		return nil, "", nil, estErrorResponse(http.StatusNotFound, "SCEP is not enabled on this mount"), nil
+	}
+
+	roleName, err := config.roleForLabel(data.Get("label").(string))
+	if err != nil {
+		return nil, "", nil, estErrorResponse(http.StatusNotFound, err.Error()), nil
+	}
+
+	role, err := b.getRole(sc.Context, sc.Storage, roleName)
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+	if role == nil {
+		return nil, "", nil, estErrorResponse(http.StatusNotFound, fmt.Sprintf("role %s mapped to this SCEP label no longer exists", roleName)), nil
+	}
+
+	return config, roleName, role, nil, nil
+}
+
+func (b *backend) pathScepChallenge(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getScepConfig()
+	if err != nil {
+		return nil, err
+	}
+	if !config.Enabled {
+		return logical.ErrorResponse("SCEP is not enabled on this mount"), nil
+	}
+	if !config.AllowDynamicChallenges {
+		return logical.ErrorResponse("dynamic challenges are not allowed by the SCEP configuration"), nil
+	}
+
+	roleName, err := config.roleForLabel(data.Get("label").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	role, err := b.getRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("role %s mapped to this SCEP label no longer exists", roleName)), nil
+	}
+
+	ttl := time.Duration(data.Get("ttl").(int)) * time.Second
+	if ttl <= 0 {
+		return logical.ErrorResponse("ttl must be positive"), nil
+	}
+
+	token, password, err := sc.createEnrollmentToken(roleName, data.Get("allowed_names").([]string), ttl, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := enrollmentTokenResponse(token)
+	resp.Data["challenge"] = password
+	return resp, nil
+}
+
+func (b *backend) pathScepOperation(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	operation := data.Get("operation").(string)
+	if operation == "" && req.HTTPRequest != nil && req.HTTPRequest.URL != nil {
+		// The query string of POST requests isn't parsed into the request
+		// data, as their bodies are passed through.
+		operation = req.HTTPRequest.URL.Query().Get("operation")
+	}
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, roleName, role, errResp, err := b.scepRole(sc, data)
+	if err != nil || errResp != nil {
+		return errResp, err
+	}
+
+	switch operation {
+	case scepOperationGetCACaps:
+		return &logical.Response{
+			Data: map[string]interface{}{
+				logical.HTTPContentType: scepContentTypeCapsText,
+				logical.HTTPRawBody:     []byte(strings.Join(scepCapabilities, "\n")),
+				logical.HTTPStatusCode:  http.StatusOK,
+			},
+		}, nil
+	case scepOperationGetCACert:
+		return b.pathScepGetCACert(sc, role)
+	case scepOperationPKIOperation:
+		message, err := readScepMessage(req, data)
+		if err != nil {
+			return estErrorResponse(http.StatusBadRequest, err.Error()), nil
+		}
+		return b.pathScepPKIOperation(sc, req, config, roleName, role, message)
+	default:
+		return estErrorResponse(http.StatusBadRequest, fmt.Sprintf("unsupported SCEP operation %q", operation)), nil
+	}
+}
+
+func (b *backend) pathScepGetCACert(sc *storageContext, role *roleEntry) (*logical.Response, error) {
+	caInfo, err := sc.fetchCAInfo(scepIssuerRef(role), ReadOnlyUsage)
+	if err != nil {
+		return nil, err
+	}
+
+	certs := [][]byte{caInfo.Certificate.Raw}
+	for _, block := range caInfo.CAChain {
+		if !bytes.Equal(block.Bytes, caInfo.Certificate.Raw) {
+			certs = append(certs, block.Bytes)
+		}
+	}
+
+	// A lone CA certificate is returned as is; a chain, as a certs-only
+	// PKCS#7 structure with the issuer first.
+	if len(certs) == 1 {
+		return scepRawResponse(scepContentTypeCACert, certs[0]), nil
+	}
+
+	chain, err := encodePkcs7CertsOnly(certs)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode PKCS#7 response: %w", err)
+	}
+	return scepRawResponse(scepContentTypeCAChain, chain), nil
+}
+
+func (b *backend) pathScepPKIOperation(sc *storageContext, req *logical.Request, config *scepConfigEntry, roleName string, role *roleEntry, message []byte) (*logical.Response, error) {
+	p7, err := pkcs7.Parse(message)
+	if err != nil {
+		return estErrorResponse(http.StatusBadRequest, fmt.Sprintf("unable to parse the PKCS#7 message: %v", err)), nil
+	}
+	if err := p7.Verify(); err != nil {
+		return estErrorResponse(http.StatusBadRequest, fmt.Sprintf("the message signature is invalid: %v", err)), nil
+	}
+	signer := p7.GetOnlySigner()
+	if signer == nil {
+		return estErrorResponse(http.StatusBadRequest, "the message must have exactly one signer"), nil
+	}
+
+	var messageType, transactionID string
+	var senderNonce []byte
+	if err := p7.UnmarshalSignedAttribute(oidScepMessageType, &messageType); err != nil {
+		return estErrorResponse(http.StatusBadRequest, fmt.Sprintf("missing or invalid messageType: %v", err)), nil
+	}
+	if err := p7.UnmarshalSignedAttribute(oidScepTransactionID, &transactionID); err != nil {
+		return estErrorResponse(http.StatusBadRequest, fmt.Sprintf("missing or invalid transactionID: %v", err)), nil
+	}
+	if err := p7.UnmarshalSignedAttribute(oidScepSenderNonce, &senderNonce); err != nil {
+		return estErrorResponse(http.StatusBadRequest, fmt.Sprintf("missing or invalid senderNonce: %v", err)), nil
+	}
+
+	caInfo, err := sc.fetchCAInfo(scepIssuerRef(role), IssuanceUsage)
+	if err != nil {
+		return nil, err
+	}
+	caKey, ok := caInfo.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return estErrorResponse(http.StatusInternalServerError, "SCEP requires the issuer of the role to have an RSA key"), nil
+	}
+
+	reply := &scepReply{
+		caCert:        caInfo.Certificate,
+		caKey:         caKey,
+		transactionID: transactionID,
+		senderNonce:   senderNonce,
+	}
+
+	if messageType != scepMessageTypePKCSReq && messageType != scepMessageTypeRenewalReq {
+		return reply.failure(scepFailBadRequest)
+	}
+	if _, ok := signer.PublicKey.(*rsa.PublicKey); !ok {
+		// The issued certificate is encrypted to the signer, which thus
+		// needs an RSA key.
+		return reply.failure(scepFailBadAlg)
+	}
+
+	envelope, err := pkcs7.Parse(p7.Content)
+	if err != nil {
+		return reply.failure(scepFailBadMessageCheck)
+	}
+	csrBytes, err := envelope.Decrypt(caInfo.Certificate, caKey)
+	if err != nil {
+		return reply.failure(scepFailBadMessageCheck)
+	}
+	csr, err := x509.ParseCertificateRequest(csrBytes)
+	if err != nil {
+		return reply.failure(scepFailBadRequest)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return reply.failure(scepFailBadMessageCheck)
+	}
+
+	var token *enrollmentTokenEntry
+	if messageType == scepMessageTypeRenewalReq {
+		// Renewals are signed with the certificate being renewed, which
+		// must have been issued by this mount and match the CSR.
+		var chain []*x509.Certificate
+		for _, cert := range p7.Certificates {
+			if !cert.Equal(signer) {
+				chain = append(chain, cert)
+			}
+		}
+		if err := b.verifyIssuedByMount(sc, req, signer, chain); err != nil {
+			if _, ok := err.(errutil.UserError); !ok {
+				return nil, err
+			}
+			b.Logger().Debug("rejecting SCEP renewal", "error", err)
+			return reply.failure(scepFailBadRequest)
+		}
+		if !estSameIdentity(signer, csr) {
+			return reply.failure(scepFailBadRequest)
+		}
+	} else {
+		// Initial enrollments are signed with a self-signed certificate
+		// over the key of the CSR, and authenticated by its challenge.
+		signerKey, err := x509.MarshalPKIXPublicKey(signer.PublicKey)
+		if err != nil {
+			return reply.failure(scepFailBadRequest)
+		}
+		if !bytes.Equal(signerKey, csr.RawSubjectPublicKeyInfo) {
+			return reply.failure(scepFailBadRequest)
+		}
+
+		challenge, err := csrChallengePassword(csr)
+		if err != nil {
+			return reply.failure(scepFailBadRequest)
+		}
+
+		if !config.matchesStaticChallenge(roleName, challenge) {
+			if !config.AllowDynamicChallenges || challenge == "" {
+				return reply.failure(scepFailBadRequest)
+			}
+			// The use is reserved ahead of issuance, so that concurrent
+			// requests can't redeem it twice without serializing signing.
+			names, err := csrRequestedNames(csr)
+			if err != nil {
+				return reply.failure(scepFailBadRequest)
+			}
+			token, err = b.reserveEnrollmentTokenUse(sc, challenge, names, roleName)
+			if err != nil {
+				if _, ok := err.(errutil.UserError); !ok {
+					return nil, err
+				}
+				b.Logger().Debug("rejecting SCEP enrollment", "error", err)
+				return reply.failure(scepFailBadRequest)
+			}
+		}
+	}
+
+	signData := &framework.FieldData{
+		Raw: map[string]interface{}{
+			"csr":    string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr.Raw})),
+			"format": "der",
+		},
+		Schema: pathSign(b).Fields,
+	}
+
+	resp, err := b.pathSign(sc.Context, req, signData, role)
+	if err == nil && resp.IsError() {
+		err = errutil.UserError{Err: resp.Error().Error()}
+	}
+	if err != nil {
+		if token != nil {
+			b.releaseEnrollmentTokenUse(sc, token)
+		}
+		if _, ok := err.(errutil.UserError); ok {
+			b.Logger().Debug("rejecting SCEP enrollment", "error", err)
+			return reply.failure(scepFailBadRequest)
+		}
+		return nil, err
+	}
+
+	certBytes, err := base64.StdEncoding.DecodeString(resp.Data["certificate"].(string))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode issued certificate: %w", err)
+	}
+
+	return reply.success(certBytes, signer)
+}
+
+// scepReply builds the CertRep message answering a PKIOperation request.
+type scepReply struct {
+	caCert        *x509.Certificate
+	caKey         *rsa.PrivateKey
+	transactionID string
+	senderNonce   []byte
+}
+
+// success answers with the issued certificate, encrypted to the signer of
+// the request.
+func (r *scepReply) success(certBytes []byte, recipient *x509.Certificate) (*logical.Response, error) {
+	degenerate, err := encodePkcs7CertsOnly([][]byte{certBytes})
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode PKCS#7 response: %w", err)
+	}
+
+	envelope, err := encryptScepEnvelope(degenerate, recipient)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encrypt the issued certificate: %w", err)
+	}
+
+	return r.build(scepStatusSuccess, "", envelope)
+}
+
+// encryptScepEnvelope wraps content in a PKCS#7 EnvelopedData structure,
+// encrypted with AES-128-CBC, as advertised by GetCACaps, under a key
+// transported to the recipient with RSA. The pkcs7 library only takes its
+// content encryption algorithm from a package-wide setting, defaulting to
+// single DES, so the envelope is assembled here instead.
+func encryptScepEnvelope(content []byte, recipient *x509.Certificate) ([]byte, error) {
+	recipientKey, ok := recipient.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("recipient has a %T key; only RSA keys are supported", recipient.PublicKey)
+	}
+
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	padLen := aes.BlockSize - len(content)%aes.BlockSize
+	ciphertext := append(append([]byte{}, content...), bytes.Repeat([]byte{byte(padLen)}, padLen)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, ciphertext)
+
+	encryptedKey, err := rsa.EncryptPKCS1v15(rand.Reader, recipientKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var builder cryptobyte.Builder
+	builder.AddASN1(cbbasn1.SEQUENCE, func(contentInfo *cryptobyte.Builder) {
+		contentInfo.AddASN1ObjectIdentifier(pkcs7.OIDEnvelopedData)
+		contentInfo.AddASN1(cbbasn1.Tag(0).Constructed().ContextSpecific(), func(content *cryptobyte.Builder) {
+			content.AddASN1(cbbasn1.SEQUENCE, func(envelopedData *cryptobyte.Builder) {
+				envelopedData.AddASN1Int64(0)
+				envelopedData.AddASN1(cbbasn1.SET, func(recipientInfos *cryptobyte.Builder) {
+					recipientInfos.AddASN1(cbbasn1.SEQUENCE, func(recipientInfo *cryptobyte.Builder) {
+						recipientInfo.AddASN1Int64(0)
+						recipientInfo.AddASN1(cbbasn1.SEQUENCE, func(issuerAndSerial *cryptobyte.Builder) {
+							issuerAndSerial.AddBytes(recipient.RawIssuer)
+							issuerAndSerial.AddASN1BigInt(recipient.SerialNumber)
+						})
+						recipientInfo.AddASN1(cbbasn1.SEQUENCE, func(keyEncryptionAlgorithm *cryptobyte.Builder) {
+							keyEncryptionAlgorithm.AddASN1ObjectIdentifier(pkcs7.OIDEncryptionAlgorithmRSA)
+							keyEncryptionAlgorithm.AddASN1NULL()
+						})
+						recipientInfo.AddASN1OctetString(encryptedKey)
+					})
+				})
+				envelopedData.AddASN1(cbbasn1.SEQUENCE, func(encryptedContentInfo *cryptobyte.Builder) {
+					encryptedContentInfo.AddASN1ObjectIdentifier(pkcs7.OIDData)
+					encryptedContentInfo.AddASN1(cbbasn1.SEQUENCE, func(contentEncryptionAlgorithm *cryptobyte.Builder) {
+						contentEncryptionAlgorithm.AddASN1ObjectIdentifier(pkcs7.OIDEncryptionAlgorithmAES128CBC)
+						contentEncryptionAlgorithm.AddASN1OctetString(iv)
+					})
+					// The constructed form of the implicitly tagged OCTET
+					// STRING, which the pkcs7 library expects.
+					encryptedContentInfo.AddASN1(cbbasn1.Tag(0).Constructed().ContextSpecific(), func(encryptedContent *cryptobyte.Builder) {
+						encryptedContent.AddASN1OctetString(ciphertext)
+					})
+				})
+			})
+		})
+	})
+
+	return builder.Bytes()
+}
+
+func (r *scepReply) failure(failInfo string) (*logical.Response, error) {
+	return r.build(scepStatusFailure, failInfo, nil)
+}
+
+func (r *scepReply) build(status string, failInfo string, content []byte) (*logical.Response, error) {
+	nonce := make([]byte, scepNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	attributes := []pkcs7.Attribute{
+		{Type: oidScepMessageType, Value: scepMessageTypeCertRep},
+		{Type: oidScepPkiStatus, Value: status},
+		{Type: oidScepTransactionID, Value: r.transactionID},
+		{Type: oidScepSenderNonce, Value: nonce},
+		{Type: oidScepRecipientNonce, Value: r.senderNonce},
+	}
+	if failInfo != "" {
+		attributes = append(attributes, pkcs7.Attribute{Type: oidScepFailInfo, Value: failInfo})
+	}
+
+	signedData, err := pkcs7.NewSignedData(content)
+	if err != nil {
+		return nil, err
+	}
+	signedData.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	if err := signedData.AddSigner(r.caCert, r.caKey, pkcs7.SignerInfoConfig{ExtraSignedAttributes: attributes}); err != nil {
+		return nil, fmt.Errorf("unable to sign SCEP response: %w", err)
+	}
+
+	message, err := signedData.Finish()
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode SCEP response: %w", err)
+	}
+
+	return scepRawResponse(scepContentTypeMessage, message), nil
+}
+
+// readScepMessage reads the PKIOperation message of the request: from the
+// body of POST requests, or the message query parameter of GET requests.
+func readScepMessage(req *logical.Request, data *framework.FieldData) ([]byte, error) {
+	if req.Operation == logical.ReadOperation {
+		message := data.Get("message").(string)
+		if message == "" {
+			return nil, fmt.Errorf("missing message")
+		}
+		decoded, err := base64.StdEncoding.DecodeString(message)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode the base64-encoded message: %v", err)
+		}
+		return decoded, nil
+	}
+
+	if req.HTTPRequest == nil || req.HTTPRequest.Body == nil {
+		return nil, fmt.Errorf("the request must carry a PKCS#7 message with the %s content type", scepContentTypeMessage)
+	}
+
+	rawBody := req.HTTPRequest.Body
+	defer rawBody.Close()
+
+	body, err := io.ReadAll(io.LimitReader(rawBody, scepMaxRequestSize))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) >= scepMaxRequestSize {
+		return nil, fmt.Errorf("request is too large")
+	}
+
+	return body, nil
+}
+
+// csrChallengePassword returns the challengePassword attribute (RFC 2985
+// Section 5.4.1) of the CSR, or an empty string if it has none; the
+// standard library doesn't parse it.
+func csrChallengePassword(csr *x509.CertificateRequest) (string, error) {
+	input := cryptobyte.String(csr.RawTBSCertificateRequest)
+	var tbs, attributes cryptobyte.String
+	if !input.ReadASN1(&tbs, cbbasn1.SEQUENCE) ||
+		!tbs.SkipASN1(cbbasn1.INTEGER) ||
+		!tbs.SkipASN1(cbbasn1.SEQUENCE) ||
+		!tbs.SkipASN1(cbbasn1.SEQUENCE) ||
+		!tbs.ReadASN1(&attributes, cbbasn1.Tag(0).Constructed().ContextSpecific()) {
+		return "", fmt.Errorf("malformed CSR attributes")
+	}
+
+	for !attributes.Empty() {
+		var attribute, values cryptobyte.String
+		var oid asn1.ObjectIdentifier
+		if !attributes.ReadASN1(&attribute, cbbasn1.SEQUENCE) ||
+			!attribute.ReadASN1ObjectIdentifier(&oid) ||
+			!attribute.ReadASN1(&values, cbbasn1.SET) {
+			return "", fmt.Errorf("malformed CSR attribute")
+		}
+		if !oid.Equal(oidChallengePassword) {
+			continue
+		}
+
+		var value cryptobyte.String
+		var tag cbbasn1.Tag
+		if !values.ReadAnyASN1(&value, &tag) {
+			return "", fmt.Errorf("malformed challengePassword attribute")
+		}
+		switch tag {
+		case cbbasn1.PrintableString, cbbasn1.UTF8String, cbbasn1.IA5String, cbbasn1.T61String:
+			return string(value), nil
+		default:
+			return "", fmt.Errorf("unsupported challengePassword encoding")
+		}
+	}
+
+	return "", nil
+}
+
+// scepIssuerRef returns the reference of the issuer SCEP enrollments
+// against the role are issued by.
+func scepIssuerRef(role *roleEntry) string {
+	if role.Issuer == "" {
+		return defaultRef
+	}
+	return role.Issuer
+}
+
+func scepRawResponse(contentType string, body []byte) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: contentType,
+			logical.HTTPRawBody:     body,
+			logical.HTTPStatusCode:  http.StatusOK,
+		},
+	}
+}
+
+const pathScepHelpSyn = `
+SCEP (RFC 8894) enrollment endpoint.
+`
+
+const pathScepHelpDesc = `
+This unauthenticated endpoint implements the GetCACaps, GetCACert and
+PKIOperation operations of SCEP (RFC 8894), under scep/pkiclient.exe and
+scep/<label>/pkiclient.exe; see config/scep for mapping labels to roles.
+
+Enrollments (PKCSReq) are authenticated by the challenge password of the
+CSR: either the static challenge of the label's role, or a challenge
+password minted with scep/challenge. Renewals (RenewalReq) are signed with
+the certificate being renewed. The issuer of the role must have an RSA key.
+`
+
+const pathScepChallengeHelpSyn = `
+Mint a single-use SCEP challenge password.
+`
+
+const pathScepChallengeHelpDesc = `
+This path mints a single-use challenge password for a device to enroll
+with over SCEP, under the given label (or without one), such as from an
+MDM system preparing an enrollment profile. The challenge is bound to the
+role of the label, and may further restrict the names the device requests.
+`
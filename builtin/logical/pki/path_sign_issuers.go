@@ -32,6 +32,7 @@ func buildPathIssuerSignIntermediateRaw(b *backend, pattern string) *framework.P
 
 	path.Fields = addCACommonFields(path.Fields)
 	path.Fields = addCAIssueFields(path.Fields)
+	path.Fields = addPkcs7FormatField(path.Fields)
 
 	path.Fields["csr"] = &framework.FieldSchema{
 		Type:        framework.TypeString,
@@ -92,6 +93,20 @@ in the above RFC section.`,
 RSA key-type issuer. Defaults to false.`,
 	}
 
+	fields["policy_identifiers"] = &framework.FieldSchema{
+		Type: framework.TypeCommaStringSlice,
+		Description: `A comma-separated string or list of policy OIDs, or a JSON list of qualified policy
+information, which must include an oid, and may include a notice and/or cps url, using the form
+[{"oid"="1.3.6.1.4.1.7.8","notice"="I am a user Notice"}, {"oid"="1.3.6.1.4.1.44947.1.2.4 ","cps"="https://example.com"}].`,
+	}
+
+	fields["policy_identifiers_critical"] = &framework.FieldSchema{
+		Type:    framework.TypeBool,
+		Default: false,
+		Description: `If set, the certificate policies extension built from
+policy_identifiers is marked critical. Defaults to false.`,
+	}
+
 	return path
 }
 
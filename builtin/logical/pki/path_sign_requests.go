@@ -0,0 +1,489 @@
+package pki
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	signRequestPrefix = "sign-request/"
+
+	signRequestStatusPending  = "pending"
+	signRequestStatusApproved = "approved"
+	signRequestStatusDenied   = "denied"
+
+	defaultApprovalTTL = 24 * time.Hour
+)
+
+// signRequestEntry is a request to sign a CSR against a role requiring
+// approval, held until somebody with access to the approve (or deny)
+// endpoint decides on it. The request's parameters are kept as given, and
+// replayed against the role as it stands at approval.
+type signRequestEntry struct {
+	ID                   string                 `json:"id"`
+	Role                 string                 `json:"role"`
+	Path                 string                 `json:"path"`
+	Data                 map[string]interface{} `json:"data"`
+	CommonName           string                 `json:"common_name"`
+	Names                []string               `json:"names"`
+	RequesterEntityID    string                 `json:"requester_entity_id"`
+	RequesterDisplayName string                 `json:"requester_display_name"`
+	RequesterAddress     string                 `json:"requester_address,omitempty"`
+	Status               string                 `json:"status"`
+	CreationTime         time.Time              `json:"creation_time"`
+	Expiration           time.Time              `json:"expiration"`
+	DeciderEntityID      string                 `json:"decider_entity_id,omitempty"`
+	DeciderDisplayName   string                 `json:"decider_display_name,omitempty"`
+	DecisionTime         time.Time              `json:"decision_time,omitempty"`
+	DenialReason         string                 `json:"denial_reason,omitempty"`
+	Response             map[string]interface{} `json:"response,omitempty"`
+}
+
+func pathListSignRequests(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "sign-requests/?$",
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.pathSignRequestList,
+			},
+		},
+
+		HelpSynopsis:    pathSignRequestHelpSyn,
+		HelpDescription: pathSignRequestHelpDesc,
+	}
+}
+
+func pathSignRequest(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "sign-request/" + framework.GenericNameRegex("request_id"),
+		Fields: map[string]*framework.FieldSchema{
+			"request_id": {
+				Type:        framework.TypeString,
+				Description: `Identifier of the sign request.`,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathSignRequestRead,
+			},
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback: b.pathSignRequestDelete,
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby: true,
+			},
+		},
+
+		HelpSynopsis:    pathSignRequestHelpSyn,
+		HelpDescription: pathSignRequestHelpDesc,
+	}
+}
+
+func pathSignRequestApprove(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "sign-request/" + framework.GenericNameRegex("request_id") + "/approve",
+		Fields: map[string]*framework.FieldSchema{
+			"request_id": {
+				Type:        framework.TypeString,
+				Description: `Identifier of the sign request.`,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathSignRequestApprove,
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby: true,
+			},
+		},
+
+		HelpSynopsis:    pathSignRequestApproveHelpSyn,
+		HelpDescription: pathSignRequestApproveHelpDesc,
+	}
+}
+
+func pathSignRequestDeny(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "sign-request/" + framework.GenericNameRegex("request_id") + "/deny",
+		Fields: map[string]*framework.FieldSchema{
+			"request_id": {
+				Type:        framework.TypeString,
+				Description: `Identifier of the sign request.`,
+			},
+			"reason": {
+				Type:        framework.TypeString,
+				Description: `Reason for denying the request, shown to the requester.`,
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathSignRequestDeny,
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby: true,
+			},
+		},
+
+		HelpSynopsis:    pathSignRequestApproveHelpSyn,
+		HelpDescription: pathSignRequestApproveHelpDesc,
+	}
+}
+
+func (sc *storageContext) fetchSignRequest(id string) (*signRequestEntry, error) {
+	entry, err := sc.Storage.Get(sc.Context, signRequestPrefix+id)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var request signRequestEntry
+	if err := entry.DecodeJSON(&request); err != nil {
+		return nil, fmt.Errorf("unable to decode sign request %v: %w", id, err)
+	}
+	return &request, nil
+}
+
+func (sc *storageContext) writeSignRequest(request *signRequestEntry) error {
+	entry, err := logical.StorageEntryJSON(signRequestPrefix+request.ID, request)
+	if err != nil {
+		return err
+	}
+	return sc.Storage.Put(sc.Context, entry)
+}
+
+func roleApprovalTTL(role *roleEntry) time.Duration {
+	if role.ApprovalTTL > 0 {
+		return role.ApprovalTTL
+	}
+	return defaultApprovalTTL
+}
+
+// queueSignRequest holds a request to sign a CSR against a role requiring
+// approval. Only the sign/:role and issuer/:issuer_ref/sign/:role endpoints
+// queue requests; the enrollment protocols need an immediate answer, so
+// are refused instead.
+func (b *backend) queueSignRequest(ctx context.Context, req *logical.Request, data *framework.FieldData, role *roleEntry) (*logical.Response, error) {
+	if !strings.HasPrefix(req.Path, "sign/") && !(strings.HasPrefix(req.Path, "issuer/") && strings.Contains(req.Path, "/sign/")) {
+		return logical.ErrorResponse("this role requires approval of each request; submit the CSR through the sign/:role endpoint instead"), nil
+	}
+
+	// The queue is stored, so must be written by the active node.
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby) {
+		return nil, logical.ErrReadOnly
+	}
+
+	pemBlock, _ := pem.Decode([]byte(data.Get("csr").(string)))
+	if pemBlock == nil {
+		return logical.ErrorResponse("csr contains no data"), nil
+	}
+	csr, err := x509.ParseCertificateRequest(pemBlock.Bytes)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("certificate request could not be parsed: %v", err)), nil
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return logical.ErrorResponse("request signature invalid"), nil
+	}
+	names, err := csrRequestedNames(csr)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	// Keep only the parameters the sign endpoint understands; the role
+	// (and issuer, on the issuer-specific endpoint) are among them.
+	params := make(map[string]interface{}, len(data.Raw))
+	for key, value := range data.Raw {
+		if _, ok := data.Schema[key]; ok {
+			params[key] = value
+		}
+	}
+
+	now := time.Now()
+	request := &signRequestEntry{
+		ID:                   genUuid(),
+		Role:                 data.Get("role").(string),
+		Path:                 req.Path,
+		Data:                 params,
+		CommonName:           csr.Subject.CommonName,
+		Names:                names,
+		RequesterEntityID:    req.EntityID,
+		RequesterDisplayName: req.DisplayName,
+		Status:               signRequestStatusPending,
+		CreationTime:         now,
+		Expiration:           now.Add(roleApprovalTTL(role)),
+	}
+	if req.Connection != nil {
+		request.RequesterAddress = req.Connection.RemoteAddr
+	}
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+	if err := sc.writeSignRequest(request); err != nil {
+		return nil, err
+	}
+
+	resp := signRequestResponse(request)
+	resp.AddWarning(fmt.Sprintf("Role %s requires approval; the certificate can be read from sign-request/%s once approved.", request.Role, request.ID))
+	return resp, nil
+}
+
+func signRequestResponse(request *signRequestEntry) *logical.Response {
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"request_id":             request.ID,
+			"role":                   request.Role,
+			"path":                   request.Path,
+			"common_name":            request.CommonName,
+			"names":                  nonNilStrings(request.Names),
+			"requester_entity_id":    request.RequesterEntityID,
+			"requester_display_name": request.RequesterDisplayName,
+			"status":                 request.Status,
+			"creation_time":          request.CreationTime.Format(time.RFC3339),
+			"expiration":             request.Expiration.Format(time.RFC3339),
+		},
+	}
+	if csr, ok := request.Data["csr"].(string); ok {
+		resp.Data["csr"] = csr
+	}
+	if !request.DecisionTime.IsZero() {
+		resp.Data["decider_entity_id"] = request.DeciderEntityID
+		resp.Data["decider_display_name"] = request.DeciderDisplayName
+		resp.Data["decision_time"] = request.DecisionTime.Format(time.RFC3339)
+	}
+	if request.DenialReason != "" {
+		resp.Data["denial_reason"] = request.DenialReason
+	}
+	// Once approved, include the signed certificate, without shadowing
+	// the request's own fields.
+	for key, value := range request.Response {
+		if _, present := resp.Data[key]; !present {
+			resp.Data[key] = value
+		}
+	}
+	return resp
+}
+
+func (b *backend) pathSignRequestList(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	ids, err := req.Storage.List(ctx, signRequestPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(ids))
+	keyInfo := make(map[string]interface{}, len(ids))
+	for _, id := range ids {
+		request, err := sc.fetchSignRequest(id)
+		if err != nil {
+			return nil, err
+		}
+		if request == nil {
+			continue
+		}
+
+		keys = append(keys, id)
+		keyInfo[id] = map[string]interface{}{
+			"role":                   request.Role,
+			"common_name":            request.CommonName,
+			"requester_display_name": request.RequesterDisplayName,
+			"status":                 request.Status,
+			"expiration":             request.Expiration.Format(time.RFC3339),
+		}
+	}
+
+	return logical.ListResponseWithInfo(keys, keyInfo), nil
+}
+
+func (b *backend) pathSignRequestRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	request, err := sc.fetchSignRequest(data.Get("request_id").(string))
+	if err != nil {
+		return nil, err
+	}
+	if request == nil || time.Now().After(request.Expiration) {
+		return nil, nil
+	}
+
+	return signRequestResponse(request), nil
+}
+
+func (b *backend) pathSignRequestDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.signRequestLock.Lock()
+	defer b.signRequestLock.Unlock()
+
+	return nil, req.Storage.Delete(ctx, signRequestPrefix+data.Get("request_id").(string))
+}
+
+// decidableSignRequest fetches a pending sign request for approval or
+// denial by the caller.
+func decidableSignRequest(sc *storageContext, req *logical.Request, id string) (*signRequestEntry, *logical.Response, error) {
+	request, err := sc.fetchSignRequest(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if request == nil {
+		return nil, logical.ErrorResponse(fmt.Sprintf("unknown sign request: %s", id)), nil
+	}
+	if time.Now().After(request.Expiration) {
+		if err := sc.Storage.Delete(sc.Context, signRequestPrefix+id); err != nil {
+			return nil, nil, err
+		}
+		return nil, logical.ErrorResponse(fmt.Sprintf("sign request %s has expired", id)), nil
+	}
+	if request.Status != signRequestStatusPending {
+		return nil, logical.ErrorResponse(fmt.Sprintf("sign request %s was already %s", id, request.Status)), nil
+	}
+	if request.RequesterEntityID != "" && request.RequesterEntityID == req.EntityID {
+		return nil, logical.ErrorResponse("sign requests can not be decided on by their requester"), nil
+	}
+	return request, nil, nil
+}
+
+func (b *backend) pathSignRequestApprove(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Hold the lock across signing so concurrent approvals can't sign the
+	// same request twice.
+	b.signRequestLock.Lock()
+	defer b.signRequestLock.Unlock()
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+	request, errResp, err := decidableSignRequest(sc, req, data.Get("request_id").(string))
+	if err != nil || errResp != nil {
+		return errResp, err
+	}
+
+	role, err := b.getRole(ctx, req.Storage, request.Role)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("role %s of this sign request no longer exists", request.Role)), nil
+	}
+
+	// Sign as though the original request were being serviced now, so
+	// that templated role restrictions apply to the requester rather than
+	// the approver.
+	signReq := &logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        request.Path,
+		Storage:     req.Storage,
+		MountPoint:  req.MountPoint,
+		EntityID:    request.RequesterEntityID,
+		DisplayName: request.RequesterDisplayName,
+	}
+	if request.RequesterAddress != "" {
+		signReq.Connection = &logical.Connection{RemoteAddr: request.RequesterAddress}
+	}
+	signData := &framework.FieldData{
+		Raw:    request.Data,
+		Schema: pathSign(b).Fields,
+	}
+
+	resp, err := b.pathIssueSignCert(ctx, signReq, signData, role, true, false, false)
+	if err != nil || resp.IsError() {
+		return resp, err
+	}
+
+	request.Status = signRequestStatusApproved
+	request.DeciderEntityID = req.EntityID
+	request.DeciderDisplayName = req.DisplayName
+	request.DecisionTime = time.Now()
+	request.Expiration = request.DecisionTime.Add(roleApprovalTTL(role))
+	request.Response = resp.Data
+	if err := sc.writeSignRequest(request); err != nil {
+		return nil, fmt.Errorf("certificate was signed but the sign request could not be updated: %w", err)
+	}
+
+	resp.Data["request_id"] = request.ID
+	return resp, nil
+}
+
+func (b *backend) pathSignRequestDeny(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.signRequestLock.Lock()
+	defer b.signRequestLock.Unlock()
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+	request, errResp, err := decidableSignRequest(sc, req, data.Get("request_id").(string))
+	if err != nil || errResp != nil {
+		return errResp, err
+	}
+
+	ttl := defaultApprovalTTL
+	role, err := b.getRole(ctx, req.Storage, request.Role)
+	if err != nil {
+		return nil, err
+	}
+	if role != nil {
+		ttl = roleApprovalTTL(role)
+	}
+
+	request.Status = signRequestStatusDenied
+	request.DeciderEntityID = req.EntityID
+	request.DeciderDisplayName = req.DisplayName
+	request.DecisionTime = time.Now()
+	request.Expiration = request.DecisionTime.Add(ttl)
+	request.DenialReason = data.Get("reason").(string)
+	if err := sc.writeSignRequest(request); err != nil {
+		return nil, err
+	}
+
+	return signRequestResponse(request), nil
+}
+
+// tidyExpiredSignRequests removes sign requests no longer approvable or,
+// once decided, no longer readable.
+func (b *backend) tidyExpiredSignRequests(sc *storageContext) error {
+	b.signRequestLock.Lock()
+	defer b.signRequestLock.Unlock()
+
+	ids, err := sc.Storage.List(sc.Context, signRequestPrefix)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, id := range ids {
+		request, err := sc.fetchSignRequest(id)
+		if err != nil {
+			return err
+		}
+		if request == nil || now.Before(request.Expiration) {
+			continue
+		}
+		if err := sc.Storage.Delete(sc.Context, signRequestPrefix+id); err != nil {
+			return fmt.Errorf("unable to remove expired sign request %v: %w", id, err)
+		}
+	}
+
+	return nil
+}
+
+const pathSignRequestHelpSyn = `
+List, read and delete sign requests held for approval.
+`
+
+const pathSignRequestHelpDesc = `
+Requests to sign CSRs against roles with require_approval set are held
+here until approved or denied, or until the role's approval_ttl elapses.
+Once approved, reading the request returns the signed certificate; approved
+and denied requests remain readable for another approval_ttl.
+`
+
+const pathSignRequestApproveHelpSyn = `
+Approve or deny a sign request held for approval.
+`
+
+const pathSignRequestApproveHelpDesc = `
+Approving a sign request signs its CSR against the role as it stands now,
+as though the original request were being serviced, and returns the
+certificate; denying it records the decision and an optional reason.
+Requests can not be decided on by the entity which made them.
+`
@@ -0,0 +1,53 @@
+package pki
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathStats(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "stats",
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathReadStats,
+			},
+		},
+
+		HelpSynopsis:    pathStatsHelpSyn,
+		HelpDescription: pathStatsHelpDesc,
+	}
+}
+
+func (b *backend) pathReadStats(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	stats, err := sc.currentUsageStats()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{
+		Data: stats.ToResponseData(),
+	}
+	if stats.TrackingSince.IsZero() {
+		resp.AddWarning("Usage statistics haven't been built from the certificate store yet; until they are, only changes since this node started are counted.")
+	}
+	return resp, nil
+}
+
+const pathStatsHelpSyn = `
+Report certificate and storage usage statistics of the mount.
+`
+
+const pathStatsHelpDesc = `
+Returns the number of certificates in the certificate store and of revoked
+certificates, with an estimate of the storage they use, along with the
+number of certificates issued, overall and per role, since tracking_since.
+
+The statistics are maintained as certificates are stored, revoked and
+tidied, rather than by listing storage, so reading them is cheap. They are
+kept per cluster, like the certificate store itself.
+`
@@ -3,8 +3,10 @@ package pki
 import (
 	"context"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"sync/atomic"
 	"time"
 
@@ -17,60 +19,142 @@ import (
 )
 
 type tidyConfig struct {
+	// Enabled and Interval only apply to the auto-tidy configuration.
+	Enabled      bool          `json:"enabled"`
+	Interval     time.Duration `json:"interval_duration"`
 	CertStore    bool          `json:"tidy_cert_store"`
 	RevokedCerts bool          `json:"tidy_revoked_certs"`
 	IssuerAssocs bool          `json:"tidy_revoked_cert_issuer_associations"`
 	SafetyBuffer time.Duration `json:"safety_buffer"`
+
+	ExpiredIssuers     bool          `json:"tidy_expired_issuers"`
+	IssuerSafetyBuffer time.Duration `json:"issuer_safety_buffer"`
+}
+
+const autoTidyConfigPath = "config/auto-tidy"
+
+var defaultTidyConfig = tidyConfig{
+	Enabled:      false,
+	Interval:     12 * time.Hour,
+	CertStore:    false,
+	RevokedCerts: false,
+	IssuerAssocs: false,
+	SafetyBuffer: 72 * time.Hour,
+
+	ExpiredIssuers:     false,
+	IssuerSafetyBuffer: 365 * 24 * time.Hour,
+}
+
+// Running tidy operations periodically record their progress in a
+// checkpoint, so that those interrupted by a restart or seal resume where
+// they left off, from the periodic function on the active node. The
+// checkpoint is removed once the operation finishes, fails, or is
+// cancelled.
+const (
+	tidyCheckpointPath = "config/tidy-checkpoint"
+
+	// tidyCheckpointInterval is the number of entries examined between
+	// checkpoints.
+	tidyCheckpointInterval = 1000
+
+	tidyPhaseCertStore      = "cert_store"
+	tidyPhaseRevokedCerts   = "revoked_certs"
+	tidyPhaseExpiredIssuers = "expired_issuers"
+)
+
+// Values of tidyCancelCAS.
+const (
+	tidyCancelNone uint32 = iota
+	// tidyCancelRequested stops the running operation for good.
+	tidyCancelRequested
+	// tidyCancelInterrupt stops the running operation, to be resumed
+	// later, when the backend is shutting down.
+	tidyCancelInterrupt
+)
+
+var (
+	errTidyCancelled   = errors.New("tidy operation cancelled")
+	errTidyInterrupted = errors.New("tidy operation interrupted; it will resume from its last checkpoint")
+)
+
+type tidyCheckpoint struct {
+	Config      tidyConfig `json:"config"`
+	TimeStarted time.Time  `json:"time_started"`
+
+	// Phase is the storage area being tidied, and LastSerial the last
+	// entry of it fully processed, entries being processed in order.
+	Phase      string `json:"phase"`
+	LastSerial string `json:"last_serial"`
+	RebuildCRL bool   `json:"rebuild_crl"`
+
+	CertStoreExaminedCount   uint `json:"cert_store_examined_count"`
+	CertStoreDeletedCount    uint `json:"cert_store_deleted_count"`
+	RevokedCertExaminedCount uint `json:"revoked_cert_examined_count"`
+	RevokedCertDeletedCount  uint `json:"revoked_cert_deleted_count"`
+	MissingIssuerCertCount   uint `json:"missing_issuer_cert_count"`
+	IssuerDeletedCount       uint `json:"issuer_deleted_count"`
 }
 
 func pathTidy(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: "tidy$",
-		Fields: map[string]*framework.FieldSchema{
-			"tidy_cert_store": {
-				Type: framework.TypeBool,
-				Description: `Set to true to enable tidying up
-the certificate store`,
-			},
+		Fields:  addTidyFields(map[string]*framework.FieldSchema{}),
 
-			"tidy_revocation_list": {
-				Type:        framework.TypeBool,
-				Description: `Deprecated; synonym for 'tidy_revoked_certs`,
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                  b.pathTidyWrite,
+				ForwardPerformanceStandby: true,
 			},
+		},
 
-			"tidy_revoked_certs": {
-				Type: framework.TypeBool,
-				Description: `Set to true to expire all revoked
-and expired certificates, removing them both from the CRL and from storage. The
-CRL will be rotated if this causes any values to be removed.`,
-			},
+		HelpSynopsis:    pathTidyHelpSyn,
+		HelpDescription: pathTidyHelpDesc,
+	}
+}
 
-			"tidy_revoked_cert_issuer_associations": {
-				Type: framework.TypeBool,
-				Description: `Set to true to validate issuer associations
-on revocation entries. This helps increase the performance of CRL building
-and OCSP responses.`,
+func pathConfigAutoTidy(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/auto-tidy",
+		Fields: addTidyFields(map[string]*framework.FieldSchema{
+			"enabled": {
+				Type:        framework.TypeBool,
+				Description: `Set to true to enable automatic tidy operations.`,
 			},
-
-			"safety_buffer": {
+			"interval_duration": {
 				Type: framework.TypeDurationSecond,
-				Description: `The amount of extra time that must have passed
-beyond certificate expiration before it is removed
-from the backend storage and/or revocation list.
-Defaults to 72 hours.`,
-				Default: 259200, // 72h, but TypeDurationSecond currently requires defaults to be int
+				Description: `Interval at which to run an auto-tidy operation. This is the time
+between tidy invocations (after one finishes to the start of the next). Running
+a manual tidy will reset this duration.`,
+				Default: int(defaultTidyConfig.Interval / time.Second), // TypeDurationSecond currently requires the default to be an int.
+			},
+		}),
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathConfigAutoTidyRead,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathConfigAutoTidyWrite,
+				// Read more about why these flags are set in backend.go.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
 			},
 		},
+		HelpSynopsis:    pathConfigAutoTidySyn,
+		HelpDescription: pathConfigAutoTidyDesc,
+	}
+}
 
+func pathTidyCancel(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "tidy-cancel$",
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.UpdateOperation: &framework.PathOperation{
-				Callback:                  b.pathTidyWrite,
+				Callback:                  b.pathTidyCancelWrite,
 				ForwardPerformanceStandby: true,
 			},
 		},
-
-		HelpSynopsis:    pathTidyHelpSyn,
-		HelpDescription: pathTidyHelpDesc,
+		HelpSynopsis:    pathTidyCancelHelpSyn,
+		HelpDescription: pathTidyCancelHelpDesc,
 	}
 }
 
@@ -92,19 +176,28 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 	safetyBuffer := d.Get("safety_buffer").(int)
 	tidyCertStore := d.Get("tidy_cert_store").(bool)
 	tidyRevokedCerts := d.Get("tidy_revoked_certs").(bool) || d.Get("tidy_revocation_list").(bool)
-	tidyRevokedAssocs := d.Get("tidy_revoked_cert_issuer_associations").(bool)
+	tidyRevokedAssocs := d.Get("tidy_revoked_cert_issuer_associations").(bool) || d.Get("tidy_revocation_issuer_associations").(bool)
+	tidyExpiredIssuers := d.Get("tidy_expired_issuers").(bool)
+	issuerSafetyBuffer := d.Get("issuer_safety_buffer").(int)
 
 	if safetyBuffer < 1 {
 		return logical.ErrorResponse("safety_buffer must be greater than zero"), nil
 	}
 
+	if issuerSafetyBuffer < 1 {
+		return logical.ErrorResponse("issuer_safety_buffer must be greater than zero"), nil
+	}
+
 	bufferDuration := time.Duration(safetyBuffer) * time.Second
+	issuerBufferDuration := time.Duration(issuerSafetyBuffer) * time.Second
 
 	config := &tidyConfig{
-		CertStore:    tidyCertStore,
-		RevokedCerts: tidyRevokedCerts,
-		IssuerAssocs: tidyRevokedAssocs,
-		SafetyBuffer: bufferDuration,
+		CertStore:          tidyCertStore,
+		RevokedCerts:       tidyRevokedCerts,
+		IssuerAssocs:       tidyRevokedAssocs,
+		SafetyBuffer:       bufferDuration,
+		ExpiredIssuers:     tidyExpiredIssuers,
+		IssuerSafetyBuffer: issuerBufferDuration,
 	}
 
 	if !atomic.CompareAndSwapUint32(b.tidyCASGuard, 0, 1) {
@@ -119,11 +212,11 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 		Storage: req.Storage,
 	}
 
-	b.startTidyOperation(req, config)
+	b.startTidyOperation(req, newTidyCheckpoint(config))
 
 	resp := &logical.Response{}
-	if !tidyCertStore && !tidyRevokedCerts && !tidyRevokedAssocs {
-		resp.AddWarning("No targets to tidy; specify tidy_cert_store=true or tidy_revoked_certs=true or tidy_revoked_cert_issuer_associations=true to start a tidy operation.")
+	if !tidyCertStore && !tidyRevokedCerts && !tidyRevokedAssocs && !tidyExpiredIssuers {
+		resp.AddWarning("No targets to tidy; specify tidy_cert_store=true or tidy_revoked_certs=true or tidy_revoked_cert_issuer_associations=true or tidy_expired_issuers=true to start a tidy operation.")
 	} else {
 		resp.AddWarning("Tidy operation successfully started. Any information from the operation will be printed to Vault's server logs.")
 	}
@@ -131,11 +224,171 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 	return logical.RespondWithStatusCode(resp, req, http.StatusAccepted)
 }
 
-func (b *backend) startTidyOperation(req *logical.Request, config *tidyConfig) {
+func (b *backend) pathConfigAutoTidyRead(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getAutoTidyConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: getAutoTidyConfigData(config),
+	}, nil
+}
+
+func (b *backend) pathConfigAutoTidyWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	sc := b.makeStorageContext(ctx, req.Storage)
+	config, err := sc.getAutoTidyConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledRaw, ok := d.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+
+	if intervalRaw, ok := d.GetOk("interval_duration"); ok {
+		config.Interval = time.Duration(intervalRaw.(int)) * time.Second
+		if config.Interval < 0 {
+			return logical.ErrorResponse(fmt.Sprintf("given interval_duration must be greater than or equal to zero seconds; got: %v", intervalRaw)), nil
+		}
+	}
+
+	if certStoreRaw, ok := d.GetOk("tidy_cert_store"); ok {
+		config.CertStore = certStoreRaw.(bool)
+	}
+
+	if revokedCertsRaw, ok := d.GetOk("tidy_revoked_certs"); ok {
+		config.RevokedCerts = revokedCertsRaw.(bool)
+	}
+
+	if revokedCertsRaw, ok := d.GetOk("tidy_revocation_list"); ok && revokedCertsRaw.(bool) {
+		config.RevokedCerts = true
+	}
+
+	if issuerAssocRaw, ok := d.GetOk("tidy_revoked_cert_issuer_associations"); ok {
+		config.IssuerAssocs = issuerAssocRaw.(bool)
+	} else if issuerAssocRaw, ok := d.GetOk("tidy_revocation_issuer_associations"); ok {
+		config.IssuerAssocs = issuerAssocRaw.(bool)
+	}
+
+	if safetyBufferRaw, ok := d.GetOk("safety_buffer"); ok {
+		config.SafetyBuffer = time.Duration(safetyBufferRaw.(int)) * time.Second
+		if config.SafetyBuffer < 1*time.Second {
+			return logical.ErrorResponse(fmt.Sprintf("given safety_buffer must be greater than zero seconds; got: %v", safetyBufferRaw)), nil
+		}
+	}
+
+	if expiredIssuersRaw, ok := d.GetOk("tidy_expired_issuers"); ok {
+		config.ExpiredIssuers = expiredIssuersRaw.(bool)
+	}
+
+	if issuerSafetyBufferRaw, ok := d.GetOk("issuer_safety_buffer"); ok {
+		config.IssuerSafetyBuffer = time.Duration(issuerSafetyBufferRaw.(int)) * time.Second
+		if config.IssuerSafetyBuffer < 1*time.Second {
+			return logical.ErrorResponse(fmt.Sprintf("given issuer_safety_buffer must be greater than zero seconds; got: %v", issuerSafetyBufferRaw)), nil
+		}
+	}
+
+	if config.Enabled && !(config.CertStore || config.RevokedCerts || config.IssuerAssocs || config.ExpiredIssuers) {
+		return logical.ErrorResponse("Auto-tidy enabled but no tidy operations were requested. Enable at least one tidy operation to be run (tidy_cert_store / tidy_revoked_certs / tidy_revoked_cert_issuer_associations / tidy_expired_issuers)."), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(autoTidyConfigPath, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: getAutoTidyConfigData(config),
+	}, nil
+}
+
+func getAutoTidyConfigData(config *tidyConfig) map[string]interface{} {
+	return map[string]interface{}{
+		"enabled":                               config.Enabled,
+		"interval_duration":                     int(config.Interval / time.Second),
+		"tidy_cert_store":                       config.CertStore,
+		"tidy_revoked_certs":                    config.RevokedCerts,
+		"tidy_revoked_cert_issuer_associations": config.IssuerAssocs,
+		"safety_buffer":                         int(config.SafetyBuffer / time.Second),
+		"tidy_expired_issuers":                  config.ExpiredIssuers,
+		"issuer_safety_buffer":                  int(config.IssuerSafetyBuffer / time.Second),
+	}
+}
+
+func (sc *storageContext) getAutoTidyConfig() (*tidyConfig, error) {
+	entry, err := sc.Storage.Get(sc.Context, autoTidyConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := defaultTidyConfig
+	if entry == nil {
+		return &result, nil
+	}
+
+	if err = entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// runAutoTidyIfRequired starts a tidy operation per the auto-tidy
+// configuration, once its interval has passed since the last tidy
+// operation started, unless one is running already.
+func (b *backend) runAutoTidyIfRequired(sc *storageContext) error {
+	config, err := sc.getAutoTidyConfig()
+	if err != nil {
+		return err
+	}
+
+	if !config.Enabled || time.Since(b.getLastTidy()) < config.Interval {
+		return nil
+	}
+
+	if !atomic.CompareAndSwapUint32(b.tidyCASGuard, 0, 1) {
+		return nil
+	}
+
+	b.Logger().Debug("starting auto-tidy operation")
+	b.startTidyOperation(&logical.Request{Storage: sc.Storage}, newTidyCheckpoint(config))
+	return nil
+}
+
+func (b *backend) getLastTidy() time.Time {
+	b.tidyStatusLock.RLock()
+	defer b.tidyStatusLock.RUnlock()
+
+	return b.lastTidy
+}
+
+func newTidyCheckpoint(config *tidyConfig) *tidyCheckpoint {
+	return &tidyCheckpoint{
+		Config:      *config,
+		TimeStarted: time.Now(),
+		Phase:       tidyPhaseCertStore,
+	}
+}
+
+// startTidyOperation runs the tidy operation described by checkpoint, from
+// the progress it records, in the background. The caller must hold
+// tidyCASGuard.
+func (b *backend) startTidyOperation(req *logical.Request, checkpoint *tidyCheckpoint) {
+	atomic.StoreUint32(b.tidyCancelCAS, tidyCancelNone)
+	b.tidyStatusStart(checkpoint)
+
+	b.tidyStatusLock.Lock()
+	b.lastTidy = time.Now()
+	b.tidyStatusLock.Unlock()
+
 	go func() {
 		defer atomic.StoreUint32(b.tidyCASGuard, 0)
 
-		b.tidyStatusStart(config)
+		config := &checkpoint.Config
 
 		// Don't cancel when the original client request goes away.
 		ctx := context.Background()
@@ -143,41 +396,179 @@ func (b *backend) startTidyOperation(req *logical.Request, config *tidyConfig) {
 		logger := b.Logger().Named("tidy")
 
 		doTidy := func() error {
-			if config.CertStore {
-				if err := b.doTidyCertStore(ctx, req, logger, config); err != nil {
+			if err := b.writeTidyCheckpoint(ctx, req.Storage, checkpoint); err != nil {
+				return err
+			}
+
+			if config.CertStore && checkpoint.Phase == tidyPhaseCertStore {
+				if err := b.doTidyCertStore(ctx, req, logger, checkpoint); err != nil {
 					return err
 				}
 			}
 
-			if config.RevokedCerts || config.IssuerAssocs {
-				if err := b.doTidyRevocationStore(ctx, req, logger, config); err != nil {
-					return nil
+			if (config.RevokedCerts || config.IssuerAssocs) && checkpoint.Phase != tidyPhaseExpiredIssuers {
+				if checkpoint.Phase != tidyPhaseRevokedCerts {
+					checkpoint.Phase = tidyPhaseRevokedCerts
+					checkpoint.LastSerial = ""
+					if err := b.writeTidyCheckpoint(ctx, req.Storage, checkpoint); err != nil {
+						return err
+					}
+				}
+
+				if err := b.doTidyRevocationStore(ctx, req, logger, checkpoint); err != nil {
+					return err
+				}
+			}
+
+			if config.ExpiredIssuers {
+				if checkpoint.Phase != tidyPhaseExpiredIssuers {
+					checkpoint.Phase = tidyPhaseExpiredIssuers
+					checkpoint.LastSerial = ""
+					if err := b.writeTidyCheckpoint(ctx, req.Storage, checkpoint); err != nil {
+						return err
+					}
+				}
+
+				if err := b.doTidyExpiredIssuers(ctx, req, logger, config); err != nil {
+					return err
 				}
 			}
 
 			return nil
 		}
 
-		if err := doTidy(); err != nil {
+		err := doTidy()
+		switch {
+		case errors.Is(err, errTidyInterrupted):
+			logger.Info("tidy operation interrupted; it will resume from its last checkpoint")
+			b.tidyStatusStop(err)
+			return
+		case errors.Is(err, errTidyCancelled):
+			logger.Info("tidy operation cancelled")
+			b.tidyStatusCancelled()
+		case err != nil:
 			logger.Error("error running tidy", "error", err)
 			b.tidyStatusStop(err)
-		} else {
+		default:
 			b.tidyStatusStop(nil)
 		}
+
+		if err := req.Storage.Delete(ctx, tidyCheckpointPath); err != nil {
+			logger.Warn("unable to remove tidy checkpoint; the operation will be resumed", "error", err)
+		}
 	}()
 }
 
-func (b *backend) doTidyCertStore(ctx context.Context, req *logical.Request, logger hclog.Logger, config *tidyConfig) error {
+// resumeTidyIfRequired resumes the tidy operation recorded in the tidy
+// checkpoint, if any, unless one is already running.
+func (b *backend) resumeTidyIfRequired(ctx context.Context, storage logical.Storage) error {
+	entry, err := storage.Get(ctx, tidyCheckpointPath)
+	if err != nil || entry == nil {
+		return err
+	}
+
+	var checkpoint tidyCheckpoint
+	if err := entry.DecodeJSON(&checkpoint); err != nil {
+		return fmt.Errorf("unable to decode tidy checkpoint: %w", err)
+	}
+
+	if !atomic.CompareAndSwapUint32(b.tidyCASGuard, 0, 1) {
+		// Either the operation recorded in the checkpoint is the running
+		// one, or the checkpoint will be replaced by the running one.
+		return nil
+	}
+
+	b.Logger().Info("resuming interrupted tidy operation", "phase", checkpoint.Phase, "last_serial", checkpoint.LastSerial)
+	b.startTidyOperation(&logical.Request{Storage: storage}, &checkpoint)
+	return nil
+}
+
+// writeTidyCheckpoint records the running tidy operation's progress.
+func (b *backend) writeTidyCheckpoint(ctx context.Context, storage logical.Storage, checkpoint *tidyCheckpoint) error {
+	b.tidyStatusLock.RLock()
+	checkpoint.CertStoreExaminedCount = b.tidyStatus.certStoreExaminedCount
+	checkpoint.CertStoreDeletedCount = b.tidyStatus.certStoreDeletedCount
+	checkpoint.RevokedCertExaminedCount = b.tidyStatus.revokedCertExaminedCount
+	checkpoint.RevokedCertDeletedCount = b.tidyStatus.revokedCertDeletedCount
+	checkpoint.MissingIssuerCertCount = b.tidyStatus.missingIssuerCertCount
+	checkpoint.IssuerDeletedCount = b.tidyStatus.issuerDeletedCount
+	b.tidyStatusLock.RUnlock()
+
+	entry, err := logical.StorageEntryJSON(tidyCheckpointPath, checkpoint)
+	if err != nil {
+		return fmt.Errorf("error creating tidy checkpoint: %w", err)
+	}
+	if err := storage.Put(ctx, entry); err != nil {
+		return fmt.Errorf("error saving tidy checkpoint: %w", err)
+	}
+	return nil
+}
+
+// checkTidyCancelled returns the error to stop the running tidy operation
+// with, if it was cancelled or interrupted.
+func (b *backend) checkTidyCancelled() error {
+	switch atomic.LoadUint32(b.tidyCancelCAS) {
+	case tidyCancelRequested:
+		return errTidyCancelled
+	case tidyCancelInterrupt:
+		return errTidyInterrupted
+	}
+	return nil
+}
+
+// tidyEntryDone records that serial, the index-th entry of the current
+// phase, has been processed, checkpointing every tidyCheckpointInterval
+// entries.
+func (b *backend) tidyEntryDone(ctx context.Context, storage logical.Storage, checkpoint *tidyCheckpoint, index int, serial string) error {
+	checkpoint.LastSerial = serial
+	if (index+1)%tidyCheckpointInterval != 0 {
+		return nil
+	}
+	return b.writeTidyCheckpoint(ctx, storage, checkpoint)
+}
+
+// remainingTidySerials sorts the listed serials and returns those not yet
+// processed per checkpoint.
+func remainingTidySerials(serials []string, checkpoint *tidyCheckpoint) []string {
+	sort.Strings(serials)
+	if checkpoint.LastSerial == "" {
+		return serials
+	}
+
+	index := sort.Search(len(serials), func(i int) bool {
+		return serials[i] > checkpoint.LastSerial
+	})
+	return serials[index:]
+}
+
+func (b *backend) doTidyCertStore(ctx context.Context, req *logical.Request, logger hclog.Logger, checkpoint *tidyCheckpoint) error {
+	config := &checkpoint.Config
+	sc := b.makeStorageContext(ctx, req.Storage)
+
 	serials, err := req.Storage.List(ctx, "certs/")
 	if err != nil {
 		return fmt.Errorf("error fetching list of certs: %w", err)
 	}
 
 	serialCount := len(serials)
+	serials = remainingTidySerials(serials, checkpoint)
+	skipped := serialCount - len(serials)
+
 	metrics.SetGauge([]string{"secrets", "pki", "tidy", "cert_store_total_entries"}, float32(serialCount))
-	for i, serial := range serials {
+	for index, serial := range serials {
+		if err := b.checkTidyCancelled(); err != nil {
+			return err
+		}
+		if index > 0 {
+			if err := b.tidyEntryDone(ctx, req.Storage, checkpoint, index-1, serials[index-1]); err != nil {
+				return err
+			}
+		}
+
+		i := skipped + index
 		b.tidyStatusMessage(fmt.Sprintf("Tidying certificate store: checking entry %d of %d", i, serialCount))
 		metrics.SetGauge([]string{"secrets", "pki", "tidy", "cert_store_current_entry"}, float32(i))
+		b.tidyStatusIncCertStoreExaminedCount()
 
 		certEntry, err := req.Storage.Get(ctx, "certs/"+serial)
 		if err != nil {
@@ -189,6 +580,9 @@ func (b *backend) doTidyCertStore(ctx context.Context, req *logical.Request, log
 			if err := req.Storage.Delete(ctx, "certs/"+serial); err != nil {
 				return fmt.Errorf("error deleting nil entry with serial %s: %w", serial, err)
 			}
+			if err := sc.deleteCertMetadata(serial); err != nil {
+				return fmt.Errorf("error deleting metadata of serial %q: %w", serial, err)
+			}
 			b.tidyStatusIncCertStoreCount()
 			continue
 		}
@@ -198,6 +592,10 @@ func (b *backend) doTidyCertStore(ctx context.Context, req *logical.Request, log
 			if err := req.Storage.Delete(ctx, "certs/"+serial); err != nil {
 				return fmt.Errorf("error deleting entry with nil value with serial %s: %w", serial, err)
 			}
+			b.usageStats.certRemoved(certEntry.Key, certEntry.Value)
+			if err := sc.deleteCertMetadata(serial); err != nil {
+				return fmt.Errorf("error deleting metadata of serial %q: %w", serial, err)
+			}
 			b.tidyStatusIncCertStoreCount()
 			continue
 		}
@@ -211,6 +609,10 @@ func (b *backend) doTidyCertStore(ctx context.Context, req *logical.Request, log
 			if err := req.Storage.Delete(ctx, "certs/"+serial); err != nil {
 				return fmt.Errorf("error deleting serial %q from storage: %w", serial, err)
 			}
+			b.usageStats.certRemoved(certEntry.Key, certEntry.Value)
+			if err := sc.deleteCertMetadata(serial); err != nil {
+				return fmt.Errorf("error deleting metadata of serial %q: %w", serial, err)
+			}
 			b.tidyStatusIncCertStoreCount()
 		}
 	}
@@ -220,7 +622,9 @@ func (b *backend) doTidyCertStore(ctx context.Context, req *logical.Request, log
 	return nil
 }
 
-func (b *backend) doTidyRevocationStore(ctx context.Context, req *logical.Request, logger hclog.Logger, config *tidyConfig) error {
+func (b *backend) doTidyRevocationStore(ctx context.Context, req *logical.Request, logger hclog.Logger, checkpoint *tidyCheckpoint) error {
+	config := &checkpoint.Config
+
 	b.revokeStorageLock.Lock()
 	defer b.revokeStorageLock.Unlock()
 
@@ -231,22 +635,33 @@ func (b *backend) doTidyRevocationStore(ctx context.Context, req *logical.Reques
 		return err
 	}
 
-	rebuildCRL := false
-
 	revokedSerials, err := req.Storage.List(ctx, "revoked/")
 	if err != nil {
 		return fmt.Errorf("error fetching list of revoked certs: %w", err)
 	}
 
 	revokedSerialsCount := len(revokedSerials)
+	revokedSerials = remainingTidySerials(revokedSerials, checkpoint)
+	skipped := revokedSerialsCount - len(revokedSerials)
+
 	metrics.SetGauge([]string{"secrets", "pki", "tidy", "revoked_cert_total_entries"}, float32(revokedSerialsCount))
 
 	fixedIssuers := 0
 
-	var revInfo revocationInfo
-	for i, serial := range revokedSerials {
-		b.tidyStatusMessage(fmt.Sprintf("Tidying revoked certificates: checking certificate %d of %d", i, len(revokedSerials)))
+	for index, serial := range revokedSerials {
+		if err := b.checkTidyCancelled(); err != nil {
+			return err
+		}
+		if index > 0 {
+			if err := b.tidyEntryDone(ctx, req.Storage, checkpoint, index-1, revokedSerials[index-1]); err != nil {
+				return err
+			}
+		}
+
+		i := skipped + index
+		b.tidyStatusMessage(fmt.Sprintf("Tidying revoked certificates: checking certificate %d of %d", i, revokedSerialsCount))
 		metrics.SetGauge([]string{"secrets", "pki", "tidy", "revoked_cert_current_entry"}, float32(i))
+		b.tidyStatusIncRevokedCertExaminedCount()
 
 		revokedEntry, err := req.Storage.Get(ctx, "revoked/"+serial)
 		if err != nil {
@@ -255,7 +670,7 @@ func (b *backend) doTidyRevocationStore(ctx context.Context, req *logical.Reques
 
 		if revokedEntry == nil {
 			logger.Warn("revoked entry is nil; tidying up since it is no longer useful for any server operations", "serial", serial)
-			if err := req.Storage.Delete(ctx, "revoked/"+serial); err != nil {
+			if err := deleteRevocationEntry(sc, serial); err != nil {
 				return fmt.Errorf("error deleting nil revoked entry with serial %s: %w", serial, err)
 			}
 			b.tidyStatusIncRevokedCertCount()
@@ -264,18 +679,25 @@ func (b *backend) doTidyRevocationStore(ctx context.Context, req *logical.Reques
 
 		if revokedEntry.Value == nil || len(revokedEntry.Value) == 0 {
 			logger.Warn("revoked entry has nil value; tidying up since it is no longer useful for any server operations", "serial", serial)
-			if err := req.Storage.Delete(ctx, "revoked/"+serial); err != nil {
+			if err := deleteRevocationEntry(sc, serial); err != nil {
 				return fmt.Errorf("error deleting revoked entry with nil value with serial %s: %w", serial, err)
 			}
 			b.tidyStatusIncRevokedCertCount()
 			continue
 		}
 
+		var revInfo revocationInfo
 		err = revokedEntry.DecodeJSON(&revInfo)
 		if err != nil {
 			return fmt.Errorf("error decoding revocation entry for serial %q: %w", serial, err)
 		}
 
+		if len(revInfo.CertificateBytes) == 0 {
+			// Imported from an external CRL: without the certificate,
+			// neither its issuer nor its expiry is known.
+			continue
+		}
+
 		revokedCert, err := x509.ParseCertificate(revInfo.CertificateBytes)
 		if err != nil {
 			return fmt.Errorf("unable to parse stored revoked certificate with serial %q: %w", serial, err)
@@ -302,13 +724,26 @@ func (b *backend) doTidyRevocationStore(ctx context.Context, req *logical.Reques
 			// information on revoked/ to build the CRL and the
 			// information on certs/ for lookup.
 			if time.Now().After(revokedCert.NotAfter.Add(config.SafetyBuffer)) {
-				if err := req.Storage.Delete(ctx, "revoked/"+serial); err != nil {
+				if err := deleteRevocationEntry(sc, serial); err != nil {
 					return fmt.Errorf("error deleting serial %q from revoked list: %w", serial, err)
 				}
+				certEntry, err := req.Storage.Get(ctx, "certs/"+serial)
+				if err != nil {
+					return fmt.Errorf("error fetching certificate %q: %w", serial, err)
+				}
 				if err := req.Storage.Delete(ctx, "certs/"+serial); err != nil {
 					return fmt.Errorf("error deleting serial %q from store when tidying revoked: %w", serial, err)
 				}
-				rebuildCRL = true
+				if certEntry != nil {
+					b.usageStats.certRemoved(certEntry.Key, certEntry.Value)
+				}
+				if err := sc.deleteCertMetadata(serial); err != nil {
+					return fmt.Errorf("error deleting metadata of serial %q: %w", serial, err)
+				}
+				if err := deleteUnifiedRevocationEntry(sc, serial); err != nil {
+					return fmt.Errorf("error deleting serial %q from unified revocation store: %w", serial, err)
+				}
+				checkpoint.RebuildCRL = true
 				storeCert = false
 				b.tidyStatusIncRevokedCertCount()
 			}
@@ -317,13 +752,7 @@ func (b *backend) doTidyRevocationStore(ctx context.Context, req *logical.Reques
 		// If the entry wasn't removed but was otherwise modified,
 		// go ahead and write it back out.
 		if storeCert {
-			revokedEntry, err = logical.StorageEntryJSON("revoked/"+serial, revInfo)
-			if err != nil {
-				return fmt.Errorf("error building entry to persist changes to serial %v from revoked list: %v", serial, err)
-			}
-
-			err = req.Storage.Put(ctx, revokedEntry)
-			if err != nil {
+			if err := writeRevocationEntry(sc, serial, &revInfo); err != nil {
 				return fmt.Errorf("error persisting changes to serial %v from revoked list: %v", serial, err)
 			}
 		}
@@ -333,7 +762,7 @@ func (b *backend) doTidyRevocationStore(ctx context.Context, req *logical.Reques
 	metrics.SetGauge([]string{"secrets", "pki", "tidy", "revoked_cert_entries_incorrect_issuers"}, float32(b.tidyStatus.missingIssuerCertCount))
 	metrics.SetGauge([]string{"secrets", "pki", "tidy", "revoked_cert_entries_fixed_issuers"}, float32(fixedIssuers))
 
-	if rebuildCRL {
+	if checkpoint.RebuildCRL {
 		// Expired certificates isn't generally an important
 		// reason to trigger a CRL rebuild for. Check if
 		// automatic CRL rebuilds have been enabled and defer
@@ -353,6 +782,120 @@ func (b *backend) doTidyRevocationStore(ctx context.Context, req *logical.Reques
 	return nil
 }
 
+// doTidyExpiredIssuers removes issuers whose certificates expired more
+// than issuer_safety_buffer ago, as the issuer delete endpoint would, along
+// with any CRLs no longer referenced by an issuer and the final CRLs of
+// deleted issuers which expired more than issuer_safety_buffer ago. The
+// default issuer is kept, as removing it would break operations not
+// specifying an issuer. Issuers are only removed on the primary cluster, as
+// performance secondaries can't modify them; the CRLs, being local, are
+// tidied on every cluster.
+func (b *backend) doTidyExpiredIssuers(ctx context.Context, req *logical.Request, logger hclog.Logger, config *tidyConfig) error {
+	// Hold the issuers lock for the duration, as with issuer deletion.
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	if b.useLegacyBundleCaStorage() {
+		logger.Debug("skipping expired issuer tidy as migration has not completed")
+		return nil
+	}
+
+	sc := b.makeStorageContext(ctx, req.Storage)
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceSecondary) && !b.System().LocalMount() {
+		logger.Debug("skipping removal of expired issuers on performance secondary")
+	} else if err := b.removeExpiredIssuers(sc, logger, config); err != nil {
+		return err
+	}
+
+	removed, err := tidyRetiredIssuerCRLs(sc, config.IssuerSafetyBuffer)
+	if err != nil {
+		return err
+	}
+	if removed > 0 {
+		logger.Info("removed expired final CRLs of deleted issuers", "count", removed)
+	}
+
+	return tidyOrphanedCRLs(sc)
+}
+
+func (b *backend) removeExpiredIssuers(sc *storageContext, logger hclog.Logger, config *tidyConfig) error {
+	issuers, err := sc.listIssuers()
+	if err != nil {
+		return fmt.Errorf("error fetching list of issuers: %w", err)
+	}
+
+	issuersConfig, err := sc.getIssuersConfig()
+	if err != nil {
+		return err
+	}
+
+	for index, id := range issuers {
+		if err := b.checkTidyCancelled(); err != nil {
+			return err
+		}
+
+		b.tidyStatusMessage(fmt.Sprintf("Tidying expired issuers: checking issuer %d of %d", index, len(issuers)))
+
+		issuer, err := sc.fetchIssuerById(id)
+		if err != nil {
+			return fmt.Errorf("unable to fetch issuer %v: %w", id, err)
+		}
+
+		cert, err := issuer.GetCertificate()
+		if err != nil {
+			return fmt.Errorf("unable to parse certificate of issuer %v: %w", id, err)
+		}
+
+		if !time.Now().After(cert.NotAfter.Add(config.IssuerSafetyBuffer)) {
+			continue
+		}
+
+		if issuersConfig.DefaultIssuerId == id {
+			logger.Warn("not removing expired issuer as it is the default issuer; set another default issuer to have it tidied", "issuer_id", id)
+			continue
+		}
+
+		logger.Info("removing expired issuer", "issuer_id", id, "name", issuer.Name, "not_after", cert.NotAfter)
+		response := &logical.Response{}
+		if _, err := b.deleteIssuerHoldingLock(sc, issuer, response); err != nil {
+			return fmt.Errorf("error deleting expired issuer %v: %w", id, err)
+		}
+		for _, warning := range response.Warnings {
+			logger.Warn("while removing expired issuer", "issuer_id", id, "warning", warning)
+		}
+		b.tidyStatusIncIssuerDeletedCount()
+	}
+
+	return nil
+}
+
+// tidyOrphanedCRLs removes the CRLs of issuers which no longer exist, as a
+// CRL rebuild would.
+func tidyOrphanedCRLs(sc *storageContext) error {
+	cb := sc.Backend.crlBuilder
+	cb._builder.Lock()
+	defer cb._builder.Unlock()
+
+	issuers, err := sc.listIssuers()
+	if err != nil {
+		return fmt.Errorf("error fetching list of issuers: %w", err)
+	}
+
+	crlConfig, err := sc.getLocalCRLConfig()
+	if err != nil {
+		return fmt.Errorf("unable to fetch cluster-local CRL configuration: %w", err)
+	}
+
+	if err := cleanupDanglingCRLs(sc, crlConfig, issuers); err != nil {
+		return err
+	}
+
+	if err := sc.setLocalCRLConfig(crlConfig); err != nil {
+		return fmt.Errorf("unable to persist updated cluster-local CRL config: %w", err)
+	}
+	return nil
+}
+
 func (b *backend) pathTidyStatusRead(_ context.Context, _ *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
 	// If this node is a performance secondary return an ErrReadOnly so that the request gets forwarded,
 	// but only if the PKI backend is not a local mount.
@@ -360,27 +903,37 @@ func (b *backend) pathTidyStatusRead(_ context.Context, _ *logical.Request, _ *f
 		return nil, logical.ErrReadOnly
 	}
 
+	return b.tidyStatusResponse(), nil
+}
+
+func (b *backend) tidyStatusResponse() *logical.Response {
 	b.tidyStatusLock.RLock()
 	defer b.tidyStatusLock.RUnlock()
 
 	resp := &logical.Response{
 		Data: map[string]interface{}{
-			"safety_buffer":              nil,
-			"tidy_cert_store":            nil,
-			"tidy_revoked_certs":         nil,
-			"state":                      "Inactive",
-			"error":                      nil,
-			"time_started":               nil,
-			"time_finished":              nil,
-			"message":                    nil,
-			"cert_store_deleted_count":   nil,
-			"revoked_cert_deleted_count": nil,
-			"missing_issuer_cert_count":  nil,
+			"safety_buffer":               nil,
+			"tidy_cert_store":             nil,
+			"tidy_revoked_certs":          nil,
+			"state":                       "Inactive",
+			"error":                       nil,
+			"time_started":                nil,
+			"time_finished":               nil,
+			"message":                     nil,
+			"resumed":                     nil,
+			"cert_store_examined_count":   nil,
+			"cert_store_deleted_count":    nil,
+			"revoked_cert_examined_count": nil,
+			"revoked_cert_deleted_count":  nil,
+			"missing_issuer_cert_count":   nil,
+			"tidy_expired_issuers":        nil,
+			"issuer_safety_buffer":        nil,
+			"issuer_deleted_count":        nil,
 		},
 	}
 
 	if b.tidyStatus.state == tidyStatusInactive {
-		return resp, nil
+		return resp
 	}
 
 	resp.Data["safety_buffer"] = b.tidyStatus.safetyBuffer
@@ -389,13 +942,24 @@ func (b *backend) pathTidyStatusRead(_ context.Context, _ *logical.Request, _ *f
 	resp.Data["tidy_revoked_cert_issuer_associations"] = b.tidyStatus.tidyRevokedAssocs
 	resp.Data["time_started"] = b.tidyStatus.timeStarted
 	resp.Data["message"] = b.tidyStatus.message
+	resp.Data["resumed"] = b.tidyStatus.resumed
+	resp.Data["cert_store_examined_count"] = b.tidyStatus.certStoreExaminedCount
 	resp.Data["cert_store_deleted_count"] = b.tidyStatus.certStoreDeletedCount
+	resp.Data["revoked_cert_examined_count"] = b.tidyStatus.revokedCertExaminedCount
 	resp.Data["revoked_cert_deleted_count"] = b.tidyStatus.revokedCertDeletedCount
 	resp.Data["missing_issuer_cert_count"] = b.tidyStatus.missingIssuerCertCount
+	resp.Data["tidy_expired_issuers"] = b.tidyStatus.tidyExpiredIssuers
+	resp.Data["issuer_safety_buffer"] = b.tidyStatus.issuerSafetyBuffer
+	resp.Data["issuer_deleted_count"] = b.tidyStatus.issuerDeletedCount
 
 	switch b.tidyStatus.state {
 	case tidyStatusStarted:
 		resp.Data["state"] = "Running"
+	case tidyStatusCancelling:
+		resp.Data["state"] = "Cancelling"
+	case tidyStatusCancelled:
+		resp.Data["state"] = "Cancelled"
+		resp.Data["time_finished"] = b.tidyStatus.timeFinished
 	case tidyStatusFinished:
 		resp.Data["state"] = "Finished"
 		resp.Data["time_finished"] = b.tidyStatus.timeFinished
@@ -408,20 +972,50 @@ func (b *backend) pathTidyStatusRead(_ context.Context, _ *logical.Request, _ *f
 		// the error occurred.
 	}
 
-	return resp, nil
+	return resp
+}
+
+func (b *backend) pathTidyCancelWrite(_ context.Context, _ *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	if atomic.LoadUint32(b.tidyCASGuard) == 0 {
+		resp := &logical.Response{}
+		resp.AddWarning("No tidy operation is in progress.")
+		return resp, nil
+	}
+
+	atomic.CompareAndSwapUint32(b.tidyCancelCAS, tidyCancelNone, tidyCancelRequested)
+
+	b.tidyStatusLock.Lock()
+	if b.tidyStatus.state == tidyStatusStarted {
+		b.tidyStatus.state = tidyStatusCancelling
+	}
+	b.tidyStatusLock.Unlock()
+
+	return b.tidyStatusResponse(), nil
 }
 
-func (b *backend) tidyStatusStart(config *tidyConfig) {
+func (b *backend) tidyStatusStart(checkpoint *tidyCheckpoint) {
 	b.tidyStatusLock.Lock()
 	defer b.tidyStatusLock.Unlock()
 
+	config := &checkpoint.Config
 	b.tidyStatus = &tidyStatus{
-		safetyBuffer:      int(config.SafetyBuffer / time.Second),
-		tidyCertStore:     config.CertStore,
-		tidyRevokedCerts:  config.RevokedCerts,
-		tidyRevokedAssocs: config.IssuerAssocs,
-		state:             tidyStatusStarted,
-		timeStarted:       time.Now(),
+		safetyBuffer:       int(config.SafetyBuffer / time.Second),
+		tidyCertStore:      config.CertStore,
+		tidyRevokedCerts:   config.RevokedCerts,
+		tidyRevokedAssocs:  config.IssuerAssocs,
+		tidyExpiredIssuers: config.ExpiredIssuers,
+		issuerSafetyBuffer: int(config.IssuerSafetyBuffer / time.Second),
+		state:              tidyStatusStarted,
+		timeStarted:        checkpoint.TimeStarted,
+
+		// When resuming, carry over the progress made before.
+		resumed:                  checkpoint.Phase != tidyPhaseCertStore || checkpoint.LastSerial != "",
+		certStoreExaminedCount:   checkpoint.CertStoreExaminedCount,
+		certStoreDeletedCount:    checkpoint.CertStoreDeletedCount,
+		revokedCertExaminedCount: checkpoint.RevokedCertExaminedCount,
+		revokedCertDeletedCount:  checkpoint.RevokedCertDeletedCount,
+		missingIssuerCertCount:   checkpoint.MissingIssuerCertCount,
+		issuerDeletedCount:       checkpoint.IssuerDeletedCount,
 	}
 
 	metrics.SetGauge([]string{"secrets", "pki", "tidy", "start_time_epoch"}, float32(b.tidyStatus.timeStarted.Unix()))
@@ -451,6 +1045,20 @@ func (b *backend) tidyStatusStop(err error) {
 	}
 }
 
+func (b *backend) tidyStatusCancelled() {
+	b.tidyStatusLock.Lock()
+	defer b.tidyStatusLock.Unlock()
+
+	b.tidyStatus.timeFinished = time.Now()
+	b.tidyStatus.state = tidyStatusCancelled
+
+	metrics.MeasureSince([]string{"secrets", "pki", "tidy", "duration"}, b.tidyStatus.timeStarted)
+	metrics.SetGauge([]string{"secrets", "pki", "tidy", "start_time_epoch"}, 0)
+	metrics.IncrCounter([]string{"secrets", "pki", "tidy", "cert_store_deleted_count"}, float32(b.tidyStatus.certStoreDeletedCount))
+	metrics.IncrCounter([]string{"secrets", "pki", "tidy", "revoked_cert_deleted_count"}, float32(b.tidyStatus.revokedCertDeletedCount))
+	metrics.IncrCounter([]string{"secrets", "pki", "tidy", "cancelled"}, 1)
+}
+
 func (b *backend) tidyStatusMessage(msg string) {
 	b.tidyStatusLock.Lock()
 	defer b.tidyStatusLock.Unlock()
@@ -458,6 +1066,20 @@ func (b *backend) tidyStatusMessage(msg string) {
 	b.tidyStatus.message = msg
 }
 
+func (b *backend) tidyStatusIncCertStoreExaminedCount() {
+	b.tidyStatusLock.Lock()
+	defer b.tidyStatusLock.Unlock()
+
+	b.tidyStatus.certStoreExaminedCount++
+}
+
+func (b *backend) tidyStatusIncRevokedCertExaminedCount() {
+	b.tidyStatusLock.Lock()
+	defer b.tidyStatusLock.Unlock()
+
+	b.tidyStatus.revokedCertExaminedCount++
+}
+
 func (b *backend) tidyStatusIncCertStoreCount() {
 	b.tidyStatusLock.Lock()
 	defer b.tidyStatusLock.Unlock()
@@ -472,6 +1094,13 @@ func (b *backend) tidyStatusIncRevokedCertCount() {
 	b.tidyStatus.revokedCertDeletedCount++
 }
 
+func (b *backend) tidyStatusIncIssuerDeletedCount() {
+	b.tidyStatusLock.Lock()
+	defer b.tidyStatusLock.Unlock()
+
+	b.tidyStatus.issuerDeletedCount++
+}
+
 func (b *backend) tidyStatusIncMissingIssuerCertCount() {
 	b.tidyStatusLock.Lock()
 	defer b.tidyStatusLock.Unlock()
@@ -504,6 +1133,35 @@ certificate/revocation information of each certificate being held in
 certificate storage or in revocation information will then be checked. If the
 current time, minus the value of 'safety_buffer', is greater than the
 expiration, it will be removed.
+
+With 'tidy_expired_issuers', issuers whose certificates expired more than
+'issuer_safety_buffer' ago are removed as well, except for the default issuer,
+along with the CRLs of any issuers which no longer exist.
+`
+
+const pathConfigAutoTidySyn = `
+Modifies the current configuration for automatic tidy execution.
+`
+
+const pathConfigAutoTidyDesc = `
+This endpoint accepts parameters to a tidy operation (see /tidy) that
+will be used for automatic tidy execution. This takes two extra parameters,
+enabled (to enable or disable auto-tidy) and interval_duration (which
+controls the frequency of auto-tidy execution).
+
+Once enabled, a tidy operation will be kicked off automatically, as if it
+were executed with the posted configuration.
+`
+
+const pathTidyCancelHelpSyn = `
+Cancels a running tidy operation.
+`
+
+const pathTidyCancelHelpDesc = `
+This endpoint stops the running tidy operation after the entry it is currently
+processing; entries already tidied remain so. The operation's state, per
+'tidy-status', becomes "Cancelling" until it stops, then "Cancelled". A
+cancelled operation is not resumed.
 `
 
 const pathTidyStatusHelpSyn = `
@@ -519,13 +1177,21 @@ The result includes the following fields:
 * 'tidy_cert_store': the value of this parameter when initiating the tidy operation
 * 'tidy_revoked_certs': the value of this parameter when initiating the tidy operation
 * 'tidy_revoked_cert_issuer_associations': the value of this parameter when initiating the tidy operation
-* 'state': one of "Inactive", "Running", "Finished", "Error"
+* 'state': one of "Inactive", "Running", "Finished", "Error", "Cancelling", "Cancelled"
 * 'error': the error message, if the operation ran into an error
 * 'time_started': the time the operation started
 * 'time_finished': the time the operation finished
-* 'message': One of "Tidying certificate store: checking entry N of TOTAL" or
-  "Tidying revoked certificates: checking certificate N of TOTAL"
+* 'tidy_expired_issuers': the value of this parameter when initiating the tidy operation
+* 'issuer_safety_buffer': the value of this parameter when initiating the tidy operation
+* 'message': One of "Tidying certificate store: checking entry N of TOTAL",
+  "Tidying revoked certificates: checking certificate N of TOTAL" or
+  "Tidying expired issuers: checking issuer N of TOTAL"
+* 'resumed': whether the operation was resumed from a checkpoint, after being
+  interrupted by a restart or seal
+* 'cert_store_examined_count': The number of certificate storage entries examined
 * 'cert_store_deleted_count': The number of certificate storage entries deleted
+* 'revoked_cert_examined_count': The number of revoked certificate entries examined
 * 'revoked_cert_deleted_count': The number of revoked certificate entries deleted
 * 'missing_issuer_cert_count': The number of revoked certificates which were missing a valid issuer reference
+* 'issuer_deleted_count': The number of expired issuers deleted
 `
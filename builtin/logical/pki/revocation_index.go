@@ -0,0 +1,502 @@
+package pki
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// Building a complete CRL from revoked/ requires listing every revoked
+// serial and loading and parsing each certificate, which doesn't scale to
+// millions of revocations. The revocation index summarizes each entry under
+// revoked/ with only what its CRL entry needs, sharded by a hash of the
+// serial number, so that a CRL can be built from a few thousand reads
+// instead. Hashing keeps shards evenly sized even when serials share a
+// prefix, as with serial_number_prefix.
+//
+// The index is built once from revoked/ by buildRevocationIndex; until then,
+// CRLs are built from revoked/ directly. Afterwards, it is kept current by
+// writing and removing revocation entries through writeRevocationEntry and
+// deleteRevocationEntry, which must be used for all changes to revoked/.
+// Changes made while the index is being built are journaled, and applied
+// once the scan of revoked/ completes.
+const (
+	revocationIndexPath      = "revoked-index/"
+	revocationIndexShardPath = revocationIndexPath + "shards/"
+	revocationIndexReadyPath = revocationIndexPath + "ready-v2"
+
+	// Marks an index sharded by the serial's leading digits, which is
+	// rebuilt under the current sharding.
+	legacyRevocationIndexReadyPath = revocationIndexPath + "ready"
+
+	// With three hex digits of the hash, there are up to 4096 shards; even
+	// with millions of revocations, each stays well under storage entry
+	// size limits.
+	revocationIndexShardDigits = 3
+)
+
+// revocationIndexEntry summarizes a revocation entry.
+type revocationIndexEntry struct {
+	RevocationTimeUTC time.Time           `json:"revocation_time_utc"`
+	CertificateIssuer issuerID            `json:"issuer_id,omitempty"`
+	Reason            int                 `json:"reason,omitempty"`
+	Metadata          *revocationMetadata `json:"metadata,omitempty"`
+	CRLPartition      string              `json:"crl_partition,omitempty"`
+}
+
+// revocationIndexShard holds the summaries of revocation entries whose
+// serials share a prefix, keyed by the serial's path under revoked/.
+type revocationIndexShard struct {
+	Entries map[string]revocationIndexEntry `json:"entries"`
+}
+
+func newRevocationIndexEntry(revInfo *revocationInfo) revocationIndexEntry {
+	revocationTime := revInfo.RevocationTimeUTC
+	if revocationTime.IsZero() {
+		revocationTime = time.Unix(revInfo.RevocationTime, 0).UTC()
+	}
+
+	return revocationIndexEntry{
+		RevocationTimeUTC: revocationTime,
+		CertificateIssuer: revInfo.CertificateIssuer,
+		Reason:            revInfo.Reason,
+		Metadata:          revInfo.Metadata,
+		CRLPartition:      revInfo.CRLPartition,
+	}
+}
+
+// revocationIndexShardName returns the shard holding the given serial, in
+// either its colon- or hyphen-separated form.
+func revocationIndexShardName(serial string) string {
+	digits := strings.NewReplacer(":", "", "-", "").Replace(strings.ToLower(serial))
+	sum := sha256.Sum256([]byte(digits))
+	return hex.EncodeToString(sum[:])[:revocationIndexShardDigits]
+}
+
+// serialFromRevocationIndexKey parses the serial number from its path under
+// revoked/.
+func serialFromRevocationIndexKey(serial string) (*big.Int, error) {
+	digits := strings.NewReplacer(":", "", "-", "").Replace(serial)
+	value, ok := new(big.Int).SetString(digits, 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid serial number %q in revocation index", serial)
+	}
+	return value, nil
+}
+
+func (sc *storageContext) isRevocationIndexReady() (bool, error) {
+	if sc.Backend.revocationIndexReady.Load() {
+		return true, nil
+	}
+
+	entry, err := sc.Storage.Get(sc.Context, revocationIndexReadyPath)
+	if err != nil {
+		return false, err
+	}
+	if entry == nil {
+		return false, nil
+	}
+
+	// Once built, the index is never removed, so this can be cached.
+	sc.Backend.revocationIndexReady.Store(true)
+	return true, nil
+}
+
+func (sc *storageContext) fetchRevocationIndexShard(name string) (*revocationIndexShard, error) {
+	entry, err := sc.Storage.Get(sc.Context, revocationIndexShardPath+name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch revocation index shard %v: %w", name, err)
+	}
+
+	shard := &revocationIndexShard{Entries: map[string]revocationIndexEntry{}}
+	if entry == nil {
+		return shard, nil
+	}
+
+	if err := entry.DecodeJSON(shard); err != nil {
+		return nil, fmt.Errorf("unable to decode revocation index shard %v: %w", name, err)
+	}
+	if shard.Entries == nil {
+		shard.Entries = map[string]revocationIndexEntry{}
+	}
+
+	return shard, nil
+}
+
+func (sc *storageContext) writeRevocationIndexShard(name string, shard *revocationIndexShard) error {
+	if len(shard.Entries) == 0 {
+		return sc.Storage.Delete(sc.Context, revocationIndexShardPath+name)
+	}
+
+	entry, err := logical.StorageEntryJSON(revocationIndexShardPath+name, shard)
+	if err != nil {
+		return err
+	}
+
+	return sc.Storage.Put(sc.Context, entry)
+}
+
+// updateRevocationIndex records (or, with a nil revInfo, removes) the
+// revocation entry for serial in the index, if it has been built, or in the
+// journal of the build in progress.
+func (sc *storageContext) updateRevocationIndex(serial string, revInfo *revocationInfo) error {
+	sc.Backend.revocationIndexLock.Lock()
+	defer sc.Backend.revocationIndexLock.Unlock()
+
+	ready, err := sc.isRevocationIndexReady()
+	if err != nil {
+		return err
+	}
+	if !ready {
+		if journal := sc.Backend.revocationIndexJournal; journal != nil {
+			var journaled *revocationInfo
+			if revInfo != nil {
+				copied := *revInfo
+				journaled = &copied
+			}
+			journal[serial] = journaled
+		}
+		return nil
+	}
+
+	name := revocationIndexShardName(serial)
+	shard, err := sc.fetchRevocationIndexShard(name)
+	if err != nil {
+		return err
+	}
+
+	if revInfo == nil {
+		if _, present := shard.Entries[serial]; !present {
+			return nil
+		}
+		delete(shard.Entries, serial)
+	} else {
+		shard.Entries[serial] = newRevocationIndexEntry(revInfo)
+	}
+
+	if err := sc.writeRevocationIndexShard(name, shard); err != nil {
+		return fmt.Errorf("unable to update revocation index shard %v: %w", name, err)
+	}
+
+	return nil
+}
+
+// writeRevocationEntry stores the revocation entry for serial, given as its
+// path under revoked/, and records it in the revocation index.
+//
+// Once the index is built, it is updated first: a retried revocation finds
+// the certificate already revoked and doesn't write it again, so a failure
+// between the two writes must not leave the entry missing from the index.
+// Before then, revoked/ is written first, so that the entry is either seen
+// by a concurrent build's scan or journaled for it.
+func writeRevocationEntry(sc *storageContext, serial string, revInfo *revocationInfo) error {
+	entry, err := logical.StorageEntryJSON(revokedPath+serial, revInfo)
+	if err != nil {
+		return fmt.Errorf("error creating revocation entry: %w", err)
+	}
+
+	prior, err := sc.Storage.Get(sc.Context, revokedPath+serial)
+	if err != nil {
+		return fmt.Errorf("error fetching revocation entry: %w", err)
+	}
+
+	indexFirst, err := sc.isRevocationIndexReady()
+	if err != nil {
+		return err
+	}
+	if indexFirst {
+		if err := sc.updateRevocationIndex(serial, revInfo); err != nil {
+			return err
+		}
+	}
+
+	if err := sc.Storage.Put(sc.Context, entry); err != nil {
+		return fmt.Errorf("error saving revocation entry: %w", err)
+	}
+	sc.Backend.usageStats.revocationChanged(prior, entry)
+
+	// Only once stored, so that no response signed in the meantime is
+	// cached with the prior status.
+	sc.Backend.ocspCache.invalidateSerial(serial)
+
+	if indexFirst {
+		return nil
+	}
+	return sc.updateRevocationIndex(serial, revInfo)
+}
+
+// ensureRevocationIndexed records the existing revocation entry for serial
+// in the revocation index if it is missing there, as when an earlier
+// revocation failed between writing the two.
+func (sc *storageContext) ensureRevocationIndexed(serial string, revInfo *revocationInfo) error {
+	ready, err := sc.isRevocationIndexReady()
+	if err != nil || !ready {
+		return err
+	}
+
+	sc.Backend.revocationIndexLock.Lock()
+	shard, err := sc.fetchRevocationIndexShard(revocationIndexShardName(serial))
+	sc.Backend.revocationIndexLock.Unlock()
+	if err != nil {
+		return err
+	}
+	if _, present := shard.Entries[serial]; present {
+		return nil
+	}
+
+	sc.Backend.Logger().Warn("repairing revocation index entry missing for revoked certificate", "serial", serial)
+	return sc.updateRevocationIndex(serial, revInfo)
+}
+
+// deleteRevocationEntry removes the revocation entry for serial, given as
+// its path under revoked/, and its record in the revocation index.
+func deleteRevocationEntry(sc *storageContext, serial string) error {
+	prior, err := sc.Storage.Get(sc.Context, revokedPath+serial)
+	if err != nil {
+		return fmt.Errorf("error fetching revocation entry: %w", err)
+	}
+
+	if err := sc.Storage.Delete(sc.Context, revokedPath+serial); err != nil {
+		return fmt.Errorf("error removing revocation entry: %w", err)
+	}
+	if prior != nil {
+		sc.Backend.usageStats.revocationChanged(prior, nil)
+	}
+	sc.Backend.ocspCache.invalidateSerial(serial)
+
+	return sc.updateRevocationIndex(serial, nil)
+}
+
+// buildRevocationIndexIfRequired builds the revocation index from revoked/
+// if it hasn't been built yet.
+func (b *backend) buildRevocationIndexIfRequired(ctx context.Context, storage logical.Storage) error {
+	sc := b.makeStorageContext(ctx, storage)
+	if ready, err := sc.isRevocationIndexReady(); err != nil || ready {
+		return err
+	}
+
+	return buildRevocationIndex(sc)
+}
+
+// buildRevocationIndex scans revoked/ without blocking revocations, which
+// are instead journaled by updateRevocationIndex and applied to the scanned
+// summaries before the shards are written.
+func buildRevocationIndex(sc *storageContext) error {
+	sc.Backend.revocationIndexLock.Lock()
+	if sc.Backend.revocationIndexJournal != nil {
+		// Another build is already in progress.
+		sc.Backend.revocationIndexLock.Unlock()
+		return nil
+	}
+	sc.Backend.revocationIndexJournal = make(map[string]*revocationInfo)
+	sc.Backend.revocationIndexLock.Unlock()
+
+	defer func() {
+		sc.Backend.revocationIndexLock.Lock()
+		sc.Backend.revocationIndexJournal = nil
+		sc.Backend.revocationIndexLock.Unlock()
+	}()
+
+	start := time.Now()
+	sc.Backend.Logger().Info("Building PKI revocation index.")
+
+	summaries, err := summarizeRevokedEntries(sc)
+	if err != nil {
+		return err
+	}
+
+	sc.Backend.revocationIndexLock.Lock()
+	defer sc.Backend.revocationIndexLock.Unlock()
+
+	for serial, revInfo := range sc.Backend.revocationIndexJournal {
+		if revInfo == nil {
+			delete(summaries, serial)
+			continue
+		}
+		summaries[serial] = newRevocationIndexEntry(revInfo)
+	}
+
+	shards := make(map[string]*revocationIndexShard)
+	for serial, summary := range summaries {
+		name := revocationIndexShardName(serial)
+		shard, present := shards[name]
+		if !present {
+			shard = &revocationIndexShard{Entries: map[string]revocationIndexEntry{}}
+			shards[name] = shard
+		}
+		shard.Entries[serial] = summary
+	}
+
+	// Remove any shards left over from an earlier, interrupted build, or
+	// from an index sharded by leading digits.
+	existing, err := sc.Storage.List(sc.Context, revocationIndexShardPath)
+	if err != nil {
+		return fmt.Errorf("error fetching list of revocation index shards: %w", err)
+	}
+	for _, name := range existing {
+		if _, present := shards[name]; !present {
+			if err := sc.Storage.Delete(sc.Context, revocationIndexShardPath+name); err != nil {
+				return fmt.Errorf("unable to remove stale revocation index shard %v: %w", name, err)
+			}
+		}
+	}
+
+	for name, shard := range shards {
+		if err := sc.writeRevocationIndexShard(name, shard); err != nil {
+			return fmt.Errorf("unable to write revocation index shard %v: %w", name, err)
+		}
+	}
+
+	err = sc.Storage.Put(sc.Context, &logical.StorageEntry{
+		Key:   revocationIndexReadyPath,
+		Value: []byte(time.Now().UTC().Format(time.RFC3339)),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to mark revocation index as built: %w", err)
+	}
+	if err := sc.Storage.Delete(sc.Context, legacyRevocationIndexReadyPath); err != nil {
+		return fmt.Errorf("unable to remove legacy revocation index marker: %w", err)
+	}
+	sc.Backend.revocationIndexReady.Store(true)
+
+	sc.Backend.Logger().Info("Built PKI revocation index.", "entries", len(summaries), "shards", len(shards), "duration", time.Since(start))
+	return nil
+}
+
+// summarizeRevokedEntries reads every entry under revoked/, returning their
+// summaries keyed by path.
+func summarizeRevokedEntries(sc *storageContext) (map[string]revocationIndexEntry, error) {
+	revokedSerials, err := sc.Storage.List(sc.Context, revokedPath)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching list of revoked certs: %w", err)
+	}
+
+	summaries := make(map[string]revocationIndexEntry, len(revokedSerials))
+	for _, serial := range revokedSerials {
+		entry, err := sc.Storage.Get(sc.Context, revokedPath+serial)
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch revoked cert with serial %q: %w", serial, err)
+		}
+		if entry == nil || len(entry.Value) == 0 {
+			continue
+		}
+
+		var revInfo revocationInfo
+		if err := entry.DecodeJSON(&revInfo); err != nil {
+			return nil, fmt.Errorf("error decoding revocation entry for serial %q: %w", serial, err)
+		}
+
+		summaries[serial] = newRevocationIndexEntry(&revInfo)
+	}
+
+	return summaries, nil
+}
+
+// listRevocationSummaries returns the summaries of all revocation entries,
+// keyed by path under revoked/: from the revocation index when it has been
+// built, or else from revoked/ itself.
+func listRevocationSummaries(sc *storageContext) (map[string]revocationIndexEntry, error) {
+	ready, err := sc.isRevocationIndexReady()
+	if err != nil {
+		return nil, err
+	}
+	if !ready {
+		return summarizeRevokedEntries(sc)
+	}
+
+	shardNames, err := sc.Storage.List(sc.Context, revocationIndexShardPath)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching list of revocation index shards: %w", err)
+	}
+
+	summaries := make(map[string]revocationIndexEntry)
+	for _, name := range shardNames {
+		shard, err := sc.fetchRevocationIndexShard(name)
+		if err != nil {
+			return nil, err
+		}
+
+		for serial, summary := range shard.Entries {
+			summaries[serial] = summary
+		}
+	}
+
+	return summaries, nil
+}
+
+// getIndexedRevokedCertEntries is the equivalent of getRevokedCertEntries,
+// for complete CRLs, reading the revocation index rather than revoked/.
+// Only entries which may be for an issuer's own certificate, or which
+// aren't associated with a present issuer, are loaded from revoked/.
+func getIndexedRevokedCertEntries(sc *storageContext, issuerIDCertMap map[issuerID]*x509.Certificate, issuerSerialCertMap map[string][]*x509.Certificate) ([]pkix.RevokedCertificate, map[issuerID][]pkix.RevokedCertificate, map[string]map[issuerID][]pkix.RevokedCertificate, error) {
+	var unassignedCerts []pkix.RevokedCertificate
+	revokedCertsMap := make(map[issuerID][]pkix.RevokedCertificate)
+	partitionedCertsMap := make(map[string]map[issuerID][]pkix.RevokedCertificate)
+
+	shardNames, err := sc.Storage.List(sc.Context, revocationIndexShardPath)
+	if err != nil {
+		return nil, nil, nil, errutil.InternalError{Err: fmt.Sprintf("error fetching list of revocation index shards: %s", err)}
+	}
+
+	for _, name := range shardNames {
+		shard, err := sc.fetchRevocationIndexShard(name)
+		if err != nil {
+			return nil, nil, nil, errutil.InternalError{Err: err.Error()}
+		}
+
+		for serial, entry := range shard.Entries {
+			_, mayBeIssuer := issuerSerialCertMap[strings.ReplaceAll(serial, "-", ":")]
+			_, issuerExists := issuerIDCertMap[entry.CertificateIssuer]
+			if mayBeIssuer || !issuerExists {
+				newRevCert, issuerId, partition, err := loadRevokedCertEntry(sc, serial, issuerIDCertMap, issuerSerialCertMap)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+
+				if newRevCert == nil {
+					continue
+				}
+
+				if issuerId == "" {
+					unassignedCerts = append(unassignedCerts, *newRevCert)
+				} else if partition != "" {
+					addPartitionedCertEntry(partitionedCertsMap, partition, issuerId, *newRevCert)
+				} else {
+					revokedCertsMap[issuerId] = append(revokedCertsMap[issuerId], *newRevCert)
+				}
+				continue
+			}
+
+			serialNumber, err := serialFromRevocationIndexKey(serial)
+			if err != nil {
+				return nil, nil, nil, errutil.InternalError{Err: err.Error()}
+			}
+
+			newRevCert := pkix.RevokedCertificate{
+				SerialNumber:   serialNumber,
+				RevocationTime: entry.RevocationTimeUTC,
+			}
+			if err := addReasonCodeExtension(&newRevCert, entry.Reason); err != nil {
+				return nil, nil, nil, errutil.InternalError{Err: fmt.Sprintf("error building CRL entry for serial %s: %s", serial, err)}
+			}
+
+			if entry.CRLPartition != "" {
+				addPartitionedCertEntry(partitionedCertsMap, entry.CRLPartition, entry.CertificateIssuer, newRevCert)
+				continue
+			}
+
+			revokedCertsMap[entry.CertificateIssuer] = append(revokedCertsMap[entry.CertificateIssuer], newRevCert)
+		}
+	}
+
+	return unassignedCerts, revokedCertsMap, partitionedCertsMap, nil
+}
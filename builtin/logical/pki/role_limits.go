@@ -0,0 +1,204 @@
+package pki
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// Roles may limit how many certificates they issue per issuance_rate_period
+// and how many unexpired certificates they have issued overall, so that one
+// misbehaving client can't flood the certificate store and CRLs. Usage is
+// tracked per role under role-usage/, independently of whether certificates
+// are stored.
+const (
+	roleUsagePrefix = "role-usage/"
+
+	defaultIssuanceRatePeriod = time.Hour
+)
+
+// roleUsageEntry tracks a role's issuances. The rate is estimated from the
+// counts of the current and previous fixed windows, weighting the previous
+// by how much of it still overlaps the sliding window ending now. Unexpired
+// certificates are counted by the hour in which they expire, and count as
+// active until the end of that hour.
+type roleUsageEntry struct {
+	WindowStart   time.Time       `json:"window_start"`
+	WindowCount   int             `json:"window_count"`
+	PreviousCount int             `json:"previous_count"`
+	ActiveByHour  map[int64]int64 `json:"active_by_hour"`
+}
+
+func roleHasIssuanceLimits(role *roleEntry) bool {
+	return role != nil && role.Name != "" && (role.IssuanceRateLimit > 0 || role.MaxActiveCertificates > 0)
+}
+
+func roleIssuanceRatePeriod(role *roleEntry) time.Duration {
+	if role.IssuanceRatePeriod > 0 {
+		return role.IssuanceRatePeriod
+	}
+	return defaultIssuanceRatePeriod
+}
+
+func (sc *storageContext) fetchRoleUsage(name string) (*roleUsageEntry, error) {
+	entry, err := sc.Storage.Get(sc.Context, roleUsagePrefix+name)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &roleUsageEntry{}
+	if entry != nil {
+		if err := entry.DecodeJSON(usage); err != nil {
+			return nil, fmt.Errorf("unable to decode usage of role %v: %w", name, err)
+		}
+	}
+	if usage.ActiveByHour == nil {
+		usage.ActiveByHour = map[int64]int64{}
+	}
+	return usage, nil
+}
+
+func (sc *storageContext) writeRoleUsage(name string, usage *roleUsageEntry) error {
+	entry, err := logical.StorageEntryJSON(roleUsagePrefix+name, usage)
+	if err != nil {
+		return err
+	}
+	return sc.Storage.Put(sc.Context, entry)
+}
+
+// advance moves the rate windows forward to the one containing now, and
+// forgets certificates which have since expired.
+func (u *roleUsageEntry) advance(now time.Time, period time.Duration) {
+	windowStart := now.Truncate(period)
+	switch {
+	case windowStart.Equal(u.WindowStart):
+	case windowStart.Equal(u.WindowStart.Add(period)):
+		u.PreviousCount = u.WindowCount
+		u.WindowCount = 0
+	default:
+		u.PreviousCount = 0
+		u.WindowCount = 0
+	}
+	u.WindowStart = windowStart
+
+	currentHour := now.Truncate(time.Hour).Unix()
+	for hour := range u.ActiveByHour {
+		if hour < currentHour {
+			delete(u.ActiveByHour, hour)
+		}
+	}
+}
+
+func (u *roleUsageEntry) rate(now time.Time, period time.Duration) float64 {
+	overlap := 1 - float64(now.Sub(u.WindowStart))/float64(period)
+	return float64(u.PreviousCount)*overlap + float64(u.WindowCount)
+}
+
+func (u *roleUsageEntry) active() int64 {
+	var count int64
+	for _, hourCount := range u.ActiveByHour {
+		count += hourCount
+	}
+	return count
+}
+
+// roleIssuanceReservation is an issuance counted against a role's limits
+// ahead of signing: in the rate window it was made in and, until the
+// certificate is signed, as a certificate active until the end of the hour
+// it was made in. Should the node fail before completing it, it lapses
+// then.
+type roleIssuanceReservation struct {
+	role        string
+	windowStart time.Time
+	hour        int64
+}
+
+// reserveRoleIssuance rejects an issuance exceeding the role's limits and,
+// unless dryRun, records it, before any work is done to sign (and log) the
+// certificate. Concurrent requests hence can't together exceed the limits,
+// and a certificate is never refused once signed. The returned reservation
+// must be completed with completeRoleIssuance.
+func (b *backend) reserveRoleIssuance(sc *storageContext, role *roleEntry, dryRun bool) (*roleIssuanceReservation, *logical.Response, error) {
+	lock := locksutil.LockForKey(b.roleUsageLocks, role.Name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	usage, err := sc.fetchRoleUsage(role.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	period := roleIssuanceRatePeriod(role)
+	usage.advance(now, period)
+
+	if role.IssuanceRateLimit > 0 && usage.rate(now, period)+1 > float64(role.IssuanceRateLimit) {
+		return nil, logical.ErrorResponse(fmt.Sprintf("role %s has reached its limit of %d certificates issued per %s; retry later", role.Name, role.IssuanceRateLimit, period)), logical.ErrRateLimitQuotaExceeded
+	}
+	if role.MaxActiveCertificates > 0 && usage.active()+1 > int64(role.MaxActiveCertificates) {
+		return nil, logical.ErrorResponse(fmt.Sprintf("role %s has reached its limit of %d unexpired certificates; retry once some expire", role.Name, role.MaxActiveCertificates)), logical.ErrRateLimitQuotaExceeded
+	}
+
+	if dryRun {
+		return nil, nil, nil
+	}
+
+	reservation := &roleIssuanceReservation{
+		role:        role.Name,
+		windowStart: usage.WindowStart,
+		hour:        now.Truncate(time.Hour).Unix(),
+	}
+	usage.WindowCount++
+	usage.ActiveByHour[reservation.hour]++
+	if err := sc.writeRoleUsage(role.Name, usage); err != nil {
+		return nil, nil, err
+	}
+	return reservation, nil, nil
+}
+
+// completeRoleIssuance settles a reservation once signing is done. Given
+// the signed certificate, it is counted as active until that certificate
+// expires; given none, as signing failed, the issuance is forgotten. A nil
+// reservation (for roles without limits) is ignored.
+func (b *backend) completeRoleIssuance(sc *storageContext, role *roleEntry, reservation *roleIssuanceReservation, cert *x509.Certificate) error {
+	if reservation == nil {
+		return nil
+	}
+
+	lock := locksutil.LockForKey(b.roleUsageLocks, reservation.role)
+	lock.Lock()
+	defer lock.Unlock()
+
+	usage, err := sc.fetchRoleUsage(reservation.role)
+	if err != nil {
+		return err
+	}
+	usage.advance(time.Now(), roleIssuanceRatePeriod(role))
+
+	// The reservation may already have lapsed, should signing have spanned
+	// the end of the hour.
+	if usage.ActiveByHour[reservation.hour] > 0 {
+		usage.ActiveByHour[reservation.hour]--
+		if usage.ActiveByHour[reservation.hour] == 0 {
+			delete(usage.ActiveByHour, reservation.hour)
+		}
+	}
+
+	if cert != nil {
+		usage.ActiveByHour[cert.NotAfter.Truncate(time.Hour).Unix()]++
+	} else if usage.WindowStart.Equal(reservation.windowStart) && usage.WindowCount > 0 {
+		usage.WindowCount--
+	}
+	return sc.writeRoleUsage(reservation.role, usage)
+}
+
+// releaseRoleIssuance forgets a reservation whose certificate couldn't be
+// signed; should that fail, the reservation lapses at the end of the hour.
+func (b *backend) releaseRoleIssuance(sc *storageContext, role *roleEntry, reservation *roleIssuanceReservation) {
+	if err := b.completeRoleIssuance(sc, role, reservation, nil); err != nil {
+		b.Logger().Warn("unable to release issuance reserved against role limits", "role", role.Name, "error", err)
+	}
+}
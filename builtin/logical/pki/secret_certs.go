@@ -6,6 +6,7 @@ import (
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/ocsp"
 )
 
 // SecretCertsType is the name used to identify this type
@@ -48,5 +49,5 @@ func (b *backend) secretCredsRevoke(ctx context.Context, req *logical.Request, _
 	b.revokeStorageLock.Lock()
 	defer b.revokeStorageLock.Unlock()
 
-	return revokeCert(ctx, b, req, serialInt.(string), true)
+	return revokeCert(ctx, b, req, serialInt.(string), ocsp.Unspecified, nil, true)
 }
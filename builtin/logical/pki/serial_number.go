@@ -0,0 +1,67 @@
+package pki
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+)
+
+// Serial numbers default to 159 random bits. The mount (config/mount) and
+// each issuer may instead choose how many random bits they carry, down to
+// certutil.MinSerialNumberBits, and a fixed prefix to put in front of them,
+// such as a byte identifying the issuer. An issuer's settings take
+// precedence over the mount's.
+
+// parseSerialNumberPrefix parses a hex-encoded serial number prefix,
+// optionally colon- or hyphen-separated.
+func parseSerialNumberPrefix(value string) ([]byte, error) {
+	value = strings.NewReplacer(":", "", "-", "").Replace(strings.TrimSpace(value))
+	prefix, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("serial_number_prefix must be hex-encoded: %w", err)
+	}
+	return prefix, nil
+}
+
+// validateSerialNumberConfig checks the serial_number_bits and
+// serial_number_prefix values given for a mount or issuer, returning the
+// prefix in its canonical colon-separated form.
+func validateSerialNumberConfig(prefixValue string, bits int) (string, error) {
+	if bits < 0 {
+		return "", fmt.Errorf("serial_number_bits must not be negative")
+	}
+	prefix, err := parseSerialNumberPrefix(prefixValue)
+	if err != nil {
+		return "", err
+	}
+	if err := certutil.ValidateSerialNumberFormat(prefix, bits); err != nil {
+		return "", err
+	}
+	return certutil.GetHexFormatted(prefix, ":"), nil
+}
+
+// serialNumberFormat returns the prefix and number of random bits of serial
+// numbers issued by the given issuer.
+func (sc *storageContext) serialNumberFormat(issuer *issuerEntry) ([]byte, int, error) {
+	prefixValue, bits := issuer.SerialNumberPrefix, issuer.SerialNumberBits
+	if prefixValue == "" || bits == 0 {
+		config, err := sc.getMountConfig()
+		if err != nil {
+			return nil, 0, err
+		}
+		if prefixValue == "" {
+			prefixValue = config.SerialNumberPrefix
+		}
+		if bits == 0 {
+			bits = config.SerialNumberBits
+		}
+	}
+
+	prefix, err := parseSerialNumberPrefix(prefixValue)
+	if err != nil {
+		return nil, 0, err
+	}
+	return prefix, bits, nil
+}
@@ -0,0 +1,269 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// Counting the certificates in the store otherwise requires listing (and,
+// for their size, reading) every entry under certs/ and revoked/. Instead,
+// usage statistics are kept under stats/usage and updated incrementally:
+// every change to certs/ and revoked/, and every issuance, is recorded as a
+// delta in memory, and the deltas are periodically flushed to storage by
+// periodicFunc. Reads report the stored statistics plus any pending deltas.
+//
+// Mounts predating the statistics have them built once from storage by
+// buildUsageStatsIfRequired; issuances before then are unknown. Sizes are
+// estimates, counting the key and value of each storage entry, and
+// concurrent changes while building may be counted twice.
+const (
+	usageStatsPrefix = "stats/"
+	usageStatsPath   = usageStatsPrefix + "usage"
+)
+
+// usageStatsEntry holds the counters of the mount, or pending changes to
+// them.
+type usageStatsEntry struct {
+	StoredCerts      int64            `json:"stored_certs"`
+	StoredCertBytes  int64            `json:"stored_cert_bytes"`
+	RevokedCerts     int64            `json:"revoked_certs"`
+	RevokedCertBytes int64            `json:"revoked_cert_bytes"`
+	Issued           int64            `json:"issued"`
+	IssuedByRole     map[string]int64 `json:"issued_by_role"`
+	TrackingSince    time.Time        `json:"tracking_since"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+}
+
+func (e *usageStatsEntry) add(delta *usageStatsEntry) {
+	e.StoredCerts += delta.StoredCerts
+	e.StoredCertBytes += delta.StoredCertBytes
+	e.RevokedCerts += delta.RevokedCerts
+	e.RevokedCertBytes += delta.RevokedCertBytes
+	e.Issued += delta.Issued
+	for role, count := range delta.IssuedByRole {
+		if e.IssuedByRole == nil {
+			e.IssuedByRole = map[string]int64{}
+		}
+		e.IssuedByRole[role] += count
+	}
+}
+
+func (e *usageStatsEntry) ToResponseData() map[string]interface{} {
+	issuedByRole := e.IssuedByRole
+	if issuedByRole == nil {
+		issuedByRole = map[string]int64{}
+	}
+
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+
+	return map[string]interface{}{
+		"stored_certs":            e.StoredCerts,
+		"stored_cert_bytes":       e.StoredCertBytes,
+		"revoked_certs":           e.RevokedCerts,
+		"revoked_cert_bytes":      e.RevokedCertBytes,
+		"estimated_storage_bytes": e.StoredCertBytes + e.RevokedCertBytes,
+		"issued":                  e.Issued,
+		"issued_by_role":          issuedByRole,
+		"tracking_since":          formatTime(e.TrackingSince),
+		"updated_at":              formatTime(e.UpdatedAt),
+	}
+}
+
+// usageStatsTracker accumulates the changes to the statistics made on this
+// node since they were last flushed.
+type usageStatsTracker struct {
+	lock    sync.Mutex
+	pending usageStatsEntry
+
+	// Serializes flushes (and building) of the stored statistics.
+	flushLock sync.Mutex
+}
+
+func newUsageStatsTracker() *usageStatsTracker {
+	return &usageStatsTracker{}
+}
+
+func (t *usageStatsTracker) record(delta usageStatsEntry) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.pending.add(&delta)
+}
+
+// certStored records a new entry under certs/.
+func (t *usageStatsTracker) certStored(key string, value []byte) {
+	t.record(usageStatsEntry{StoredCerts: 1, StoredCertBytes: int64(len(key) + len(value))})
+}
+
+// certRemoved records the removal of an entry under certs/.
+func (t *usageStatsTracker) certRemoved(key string, value []byte) {
+	t.record(usageStatsEntry{StoredCerts: -1, StoredCertBytes: -int64(len(key) + len(value))})
+}
+
+// revocationChanged records a change to an entry under revoked/, from
+// (when it existed) the prior entry to (when it still exists) the new one.
+func (t *usageStatsTracker) revocationChanged(prior *logical.StorageEntry, updated *logical.StorageEntry) {
+	var delta usageStatsEntry
+	if prior != nil {
+		delta.RevokedCerts--
+		delta.RevokedCertBytes -= int64(len(prior.Key) + len(prior.Value))
+	}
+	if updated != nil {
+		delta.RevokedCerts++
+		delta.RevokedCertBytes += int64(len(updated.Key) + len(updated.Value))
+	}
+	t.record(delta)
+}
+
+// issued records an issuance through the given role, whether or not the
+// certificate was stored.
+func (t *usageStatsTracker) issued(role string) {
+	delta := usageStatsEntry{Issued: 1}
+	if role != "" {
+		delta.IssuedByRole = map[string]int64{role: 1}
+	}
+	t.record(delta)
+}
+
+// take returns and clears the pending changes.
+func (t *usageStatsTracker) take() usageStatsEntry {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	pending := t.pending
+	t.pending = usageStatsEntry{}
+	return pending
+}
+
+// peek returns a copy of the pending changes.
+func (t *usageStatsTracker) peek() usageStatsEntry {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var pending usageStatsEntry
+	pending.add(&t.pending)
+	return pending
+}
+
+func (sc *storageContext) fetchUsageStats() (*usageStatsEntry, error) {
+	entry, err := sc.Storage.Get(sc.Context, usageStatsPath)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	stats := &usageStatsEntry{}
+	if err := entry.DecodeJSON(stats); err != nil {
+		return nil, fmt.Errorf("unable to decode usage statistics: %w", err)
+	}
+	return stats, nil
+}
+
+func (sc *storageContext) writeUsageStats(stats *usageStatsEntry) error {
+	stats.UpdatedAt = time.Now()
+	entry, err := logical.StorageEntryJSON(usageStatsPath, stats)
+	if err != nil {
+		return err
+	}
+	return sc.Storage.Put(sc.Context, entry)
+}
+
+// currentUsageStats returns the stored statistics with this node's pending
+// changes applied, without writing them.
+func (sc *storageContext) currentUsageStats() (*usageStatsEntry, error) {
+	stats, err := sc.fetchUsageStats()
+	if err != nil {
+		return nil, err
+	}
+	if stats == nil {
+		stats = &usageStatsEntry{}
+	}
+
+	pending := sc.Backend.usageStats.peek()
+	stats.add(&pending)
+	return stats, nil
+}
+
+// flushUsageStats applies this node's pending changes to the stored
+// statistics, once they have been built.
+func (sc *storageContext) flushUsageStats() error {
+	tracker := sc.Backend.usageStats
+	tracker.flushLock.Lock()
+	defer tracker.flushLock.Unlock()
+
+	stats, err := sc.fetchUsageStats()
+	if err != nil || stats == nil {
+		return err
+	}
+
+	pending := tracker.take()
+	stats.add(&pending)
+	if err := sc.writeUsageStats(stats); err != nil {
+		// Keep the changes for the next flush.
+		tracker.record(pending)
+		return fmt.Errorf("unable to write usage statistics: %w", err)
+	}
+	return nil
+}
+
+// buildUsageStatsIfRequired builds the usage statistics from certs/ and
+// revoked/ if they haven't been built yet.
+func (b *backend) buildUsageStatsIfRequired(ctx context.Context, storage logical.Storage) error {
+	sc := b.makeStorageContext(ctx, storage)
+	b.usageStats.flushLock.Lock()
+	defer b.usageStats.flushLock.Unlock()
+
+	existing, err := sc.fetchUsageStats()
+	if err != nil || existing != nil {
+		return err
+	}
+
+	start := time.Now()
+	b.Logger().Info("Building PKI usage statistics.")
+
+	// Changes made until now are counted from storage below; only the
+	// issuances are lost, as they can't be.
+	b.usageStats.take()
+
+	stats := &usageStatsEntry{TrackingSince: time.Now()}
+	for _, prefix := range []string{"certs/", revokedPath} {
+		keys, err := storage.List(ctx, prefix)
+		if err != nil {
+			return fmt.Errorf("error fetching list of %v: %w", prefix, err)
+		}
+
+		for _, key := range keys {
+			entry, err := storage.Get(ctx, prefix+key)
+			if err != nil {
+				return fmt.Errorf("unable to fetch %v: %w", prefix+key, err)
+			}
+			if entry == nil {
+				continue
+			}
+
+			size := int64(len(entry.Key) + len(entry.Value))
+			if prefix == revokedPath {
+				stats.RevokedCerts++
+				stats.RevokedCertBytes += size
+			} else {
+				stats.StoredCerts++
+				stats.StoredCertBytes += size
+			}
+		}
+	}
+
+	if err := sc.writeUsageStats(stats); err != nil {
+		return fmt.Errorf("unable to write usage statistics: %w", err)
+	}
+
+	b.Logger().Info("Built PKI usage statistics.", "stored_certs", stats.StoredCerts, "revoked_certs", stats.RevokedCerts, "duration", time.Since(start))
+	return nil
+}
@@ -68,6 +68,7 @@ type keyEntry struct {
 	Name           string                  `json:"name"`
 	PrivateKeyType certutil.PrivateKeyType `json:"private_key_type"`
 	PrivateKey     string                  `json:"private_key"`
+	Exportable     bool                    `json:"exportable"`
 }
 
 func (e keyEntry) getManagedKeyUUID() (UUIDKey, error) {
@@ -77,6 +78,24 @@ func (e keyEntry) getManagedKeyUUID() (UUIDKey, error) {
 	return extractManagedKeyId([]byte(e.PrivateKey))
 }
 
+// getManagedKeyRef returns the reference held by a managed key: either a
+// managed key's UUID, or a cloud KMS key reference.
+func (e keyEntry) getManagedKeyRef() (managedKeyId, error) {
+	if !e.isManagedPrivateKey() {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("getManagedKeyRef called on non-managed key %s (%s)", e.ID, e.Name)}
+	}
+	return extractAnyManagedKeyId([]byte(e.PrivateKey))
+}
+
+// isCloudKMSKey returns whether the key is a reference to a cloud KMS key.
+func (e keyEntry) isCloudKMSKey() bool {
+	if !e.isManagedPrivateKey() {
+		return false
+	}
+	_, ok := parseCloudKMSKeyRef([]byte(e.PrivateKey))
+	return ok
+}
+
 func (e keyEntry) isManagedPrivateKey() bool {
 	return e.PrivateKeyType == certutil.ManagedPrivateKey
 }
@@ -146,22 +165,29 @@ func NewIssuerUsageFromNames(names []string) (issuerUsage, error) {
 }
 
 type issuerEntry struct {
-	ID                   issuerID                  `json:"id"`
-	Name                 string                    `json:"name"`
-	KeyID                keyID                     `json:"key_id"`
-	Certificate          string                    `json:"certificate"`
-	CAChain              []string                  `json:"ca_chain"`
-	ManualChain          []issuerID                `json:"manual_chain"`
-	SerialNumber         string                    `json:"serial_number"`
-	LeafNotAfterBehavior certutil.NotAfterBehavior `json:"not_after_behavior"`
-	Usage                issuerUsage               `json:"usage"`
-	RevocationSigAlg     x509.SignatureAlgorithm   `json:"revocation_signature_algorithm"`
-	Revoked              bool                      `json:"revoked"`
-	RevocationTime       int64                     `json:"revocation_time"`
-	RevocationTimeUTC    time.Time                 `json:"revocation_time_utc"`
-	AIAURIs              *certutil.URLEntries      `json:"aia_uris,omitempty"`
-	LastModified         time.Time                 `json:"last_modified"`
-	Version              uint                      `json:"version"`
+	ID                     issuerID                  `json:"id"`
+	Name                   string                    `json:"name"`
+	KeyID                  keyID                     `json:"key_id"`
+	Certificate            string                    `json:"certificate"`
+	CAChain                []string                  `json:"ca_chain"`
+	ManualChain            []issuerID                `json:"manual_chain"`
+	SerialNumber           string                    `json:"serial_number"`
+	LeafNotAfterBehavior   certutil.NotAfterBehavior `json:"not_after_behavior"`
+	Usage                  issuerUsage               `json:"usage"`
+	RevocationSigAlg       x509.SignatureAlgorithm   `json:"revocation_signature_algorithm"`
+	ExpiryWarningThreshold time.Duration             `json:"expiry_warning_threshold"`
+	SerialNumberBits       int                       `json:"serial_number_bits,omitempty"`
+	SerialNumberPrefix     string                    `json:"serial_number_prefix,omitempty"`
+	Revoked                bool                      `json:"revoked"`
+	RevocationTime         int64                     `json:"revocation_time"`
+	RevocationTimeUTC      time.Time                 `json:"revocation_time_utc"`
+	AIAURIs                *certutil.URLEntries      `json:"aia_uris,omitempty"`
+	CRLIDP                 *crlIDPConfig             `json:"crl_idp,omitempty"`
+	CrossSignedFrom        issuerID                  `json:"cross_signed_from,omitempty"`
+	PendingKeyID           keyID                     `json:"pending_key_id,omitempty"`
+	RotatedFrom            issuerID                  `json:"rotated_from,omitempty"`
+	LastModified           time.Time                 `json:"last_modified"`
+	Version                uint                      `json:"version"`
 }
 
 type localCRLConfigEntry struct {
@@ -169,6 +195,9 @@ type localCRLConfigEntry struct {
 	CRLNumberMap          map[crlID]int64     `json:"crl_number_map"`
 	LastCompleteNumberMap map[crlID]int64     `json:"last_complete_number_map"`
 	CRLExpirationMap      map[crlID]time.Time `json:"crl_expiration_map"`
+	DeltaExpirationMap    map[crlID]time.Time `json:"delta_expiration_map"`
+	CRLBuildTimeMap       map[crlID]time.Time `json:"crl_build_time_map"`
+	DeltaBuildTimeMap     map[crlID]time.Time `json:"delta_build_time_map"`
 	LastModified          time.Time           `json:"last_modified"`
 }
 
@@ -178,6 +207,9 @@ type keyConfigEntry struct {
 
 type issuerConfigEntry struct {
 	DefaultIssuerId issuerID `json:"default"`
+	// Issuers standing in for the default, in order, when it can't be used;
+	// see resolveUsableDefaultIssuer.
+	DefaultFallbacks []issuerID `json:"default_fallbacks,omitempty"`
 }
 
 type storageContext struct {
@@ -237,7 +269,12 @@ func (sc *storageContext) writeKey(key keyEntry) error {
 		return err
 	}
 
-	return sc.Storage.Put(sc.Context, json)
+	if err := sc.Storage.Put(sc.Context, json); err != nil {
+		return err
+	}
+
+	sc.Backend.issuerCache.flush()
+	return nil
 }
 
 func (sc *storageContext) deleteKey(id keyID) (bool, error) {
@@ -246,6 +283,19 @@ func (sc *storageContext) deleteKey(id keyID) (bool, error) {
 		return false, err
 	}
 
+	// Note any cloud KMS key reference, to stop its signer afterwards.
+	var ref *cloudKMSKeyRef
+	entry, err := sc.Storage.Get(sc.Context, keyPrefix+id.String())
+	if err != nil {
+		return false, err
+	}
+	if entry != nil {
+		var key keyEntry
+		if err := entry.DecodeJSON(&key); err == nil {
+			ref, _ = parseCloudKMSKeyRef([]byte(key.PrivateKey))
+		}
+	}
+
 	wasDefault := false
 	if config.DefaultKeyId == id {
 		wasDefault = true
@@ -255,7 +305,15 @@ func (sc *storageContext) deleteKey(id keyID) (bool, error) {
 		}
 	}
 
-	return wasDefault, sc.Storage.Delete(sc.Context, keyPrefix+id.String())
+	if err := sc.Storage.Delete(sc.Context, keyPrefix+id.String()); err != nil {
+		return wasDefault, err
+	}
+
+	if ref != nil {
+		sc.Backend.cloudKMSSigners.evict(ref)
+	}
+	sc.Backend.issuerCache.flush()
+	return wasDefault, nil
 }
 
 func (sc *storageContext) importKey(keyValue string, keyName string, keyType certutil.PrivateKeyType) (*keyEntry, bool, error) {
@@ -281,11 +339,11 @@ func (sc *storageContext) importKey(keyValue string, keyName string, keyType cer
 	// Get our public key from the current inbound key, to compare against all the other keys.
 	var pkForImportingKey crypto.PublicKey
 	if keyType == certutil.ManagedPrivateKey {
-		managedKeyUUID, err := extractManagedKeyId([]byte(keyValue))
+		managedKeyUUID, err := extractAnyManagedKeyId([]byte(keyValue))
 		if err != nil {
 			return nil, false, errutil.InternalError{Err: fmt.Sprintf("failed extracting managed key uuid from key: %v", err)}
 		}
-		pkForImportingKey, err = getManagedKeyPublicKey(sc.Context, sc.Backend, managedKeyUUID)
+		pkForImportingKey, err = getAnyManagedKeyPublicKey(sc.Context, sc.Backend, managedKeyUUID)
 		if err != nil {
 			return nil, false, err
 		}
@@ -496,12 +554,17 @@ func (i issuerEntry) GetAIAURLs(sc *storageContext) (urls *certutil.URLEntries,
 	urls = i.AIAURIs
 
 	// If none are set (either due to a nil entry or because no URLs have
-	// been provided), fall back to the global AIA URL config.
+	// been provided), fall back to the global AIA URL config, resolving any
+	// templates for this issuer.
 	if urls == nil || (len(urls.IssuingCertificates) == 0 && len(urls.CRLDistributionPoints) == 0 && len(urls.OCSPServers) == 0) {
-		urls, err = getGlobalAIAURLs(sc.Context, sc.Storage)
+		config, err := getGlobalAIAURLs(sc.Context, sc.Storage)
+		if err != nil {
+			return nil, err
+		}
+		return config.toURLEntries(sc, i.ID)
 	}
 
-	return urls, err
+	return urls, nil
 }
 
 func (sc *storageContext) listIssuers() ([]issuerID, error) {
@@ -636,7 +699,13 @@ func (sc *storageContext) writeIssuer(issuer *issuerEntry) error {
 		return err
 	}
 
-	return sc.Storage.Put(sc.Context, json)
+	if err := sc.Storage.Put(sc.Context, json); err != nil {
+		return err
+	}
+
+	sc.Backend.ocspCache.flush()
+	sc.Backend.issuerCache.flush()
+	return nil
 }
 
 func (sc *storageContext) deleteIssuer(id issuerID) (bool, error) {
@@ -646,15 +715,32 @@ func (sc *storageContext) deleteIssuer(id issuerID) (bool, error) {
 	}
 
 	wasDefault := false
+	updateConfig := false
 	if config.DefaultIssuerId == id {
 		wasDefault = true
+		updateConfig = true
 		config.DefaultIssuerId = issuerID("")
+	}
+	for index, fallback := range config.DefaultFallbacks {
+		if fallback == id {
+			config.DefaultFallbacks = append(config.DefaultFallbacks[:index:index], config.DefaultFallbacks[index+1:]...)
+			updateConfig = true
+			break
+		}
+	}
+	if updateConfig {
 		if err := sc.setIssuersConfig(config); err != nil {
 			return wasDefault, err
 		}
 	}
 
-	return wasDefault, sc.Storage.Delete(sc.Context, issuerPrefix+id.String())
+	if err := sc.Storage.Delete(sc.Context, issuerPrefix+id.String()); err != nil {
+		return wasDefault, err
+	}
+
+	sc.Backend.ocspCache.flush()
+	sc.Backend.issuerCache.flush()
+	return wasDefault, nil
 }
 
 func (sc *storageContext) importIssuer(certValue string, issuerName string) (*issuerEntry, bool, error) {
@@ -862,6 +948,18 @@ func (sc *storageContext) getLocalCRLConfig() (*localCRLConfigEntry, error) {
 		mapping.CRLExpirationMap = make(map[crlID]time.Time)
 	}
 
+	if len(mapping.DeltaExpirationMap) == 0 {
+		mapping.DeltaExpirationMap = make(map[crlID]time.Time)
+	}
+
+	if len(mapping.CRLBuildTimeMap) == 0 {
+		mapping.CRLBuildTimeMap = make(map[crlID]time.Time)
+	}
+
+	if len(mapping.DeltaBuildTimeMap) == 0 {
+		mapping.DeltaBuildTimeMap = make(map[crlID]time.Time)
+	}
+
 	return mapping, nil
 }
 
@@ -896,7 +994,12 @@ func (sc *storageContext) setIssuersConfig(config *issuerConfigEntry) error {
 		return err
 	}
 
-	return sc.Storage.Put(sc.Context, json)
+	if err := sc.Storage.Put(sc.Context, json); err != nil {
+		return err
+	}
+
+	sc.Backend.issuerCache.flush()
+	return nil
 }
 
 func (sc *storageContext) getIssuersConfig() (*issuerConfigEntry, error) {
@@ -915,50 +1018,31 @@ func (sc *storageContext) getIssuersConfig() (*issuerConfigEntry, error) {
 	return issuerConfig, nil
 }
 
-// Lookup within storage the value of reference, assuming the string is a reference to an issuer entry,
+// Lookup the value of reference, assuming the string is a reference to an issuer entry,
 // returning the converted issuerID or an error if not found. This method will not properly resolve the
 // special legacyBundleShimID value as we do not want to confuse our special value and a user-provided name of the
-// same value.
+// same value. References are resolved through the issuer cache; see issuer_cache.go.
 func (sc *storageContext) resolveIssuerReference(reference string) (issuerID, error) {
+	references, err := sc.fetchIssuerReferences()
+	if err != nil {
+		return issuerID("issuer-read"), err
+	}
+
 	if reference == defaultRef {
 		// Handle fetching the default issuer.
-		config, err := sc.getIssuersConfig()
-		if err != nil {
-			return issuerID("config-error"), err
-		}
-		if len(config.DefaultIssuerId) == 0 {
+		if len(references.defaultId) == 0 {
 			return IssuerRefNotFound, fmt.Errorf("no default issuer currently configured")
 		}
 
-		return config.DefaultIssuerId, nil
+		return references.defaultId, nil
 	}
 
-	// Lookup by a direct get first to see if our reference is an ID, this is quick and cached.
-	if len(reference) == uuidLength {
-		entry, err := sc.Storage.Get(sc.Context, issuerPrefix+reference)
-		if err != nil {
-			return issuerID("issuer-read"), err
-		}
-		if entry != nil {
-			return issuerID(reference), nil
-		}
+	// Lookup by identifier first, then by name.
+	if _, ok := references.ids[issuerID(reference)]; ok {
+		return issuerID(reference), nil
 	}
-
-	// ... than to pull all issuers from storage.
-	issuers, err := sc.listIssuers()
-	if err != nil {
-		return issuerID("list-error"), err
-	}
-
-	for _, issuerId := range issuers {
-		issuer, err := sc.fetchIssuerById(issuerId)
-		if err != nil {
-			return issuerID("issuer-read"), err
-		}
-
-		if issuer.Name == reference {
-			return issuer.ID, nil
-		}
+	if id, ok := references.names[reference]; ok {
+		return id, nil
 	}
 
 	// Otherwise, we must not have found the issuer.
@@ -1089,7 +1173,7 @@ func (sc *storageContext) isKeyInUse(keyId string) (inUse bool, issuerId string,
 		if issuerEntry == nil {
 			return true, issuerId.String(), errutil.InternalError{Err: fmt.Sprintf("Issuer listed: %s does not exist", issuerId.String())}
 		}
-		if issuerEntry.KeyID.String() == keyId {
+		if issuerEntry.KeyID.String() == keyId || issuerEntry.PendingKeyID.String() == keyId {
 			return true, issuerId.String(), nil
 		}
 	}
@@ -1158,5 +1242,15 @@ func (sc *storageContext) getRevocationConfig() (*crlConfig, error) {
 		result.Version = 1
 	}
 
+	if result.MaxCRLEntriesBehavior == "" {
+		// Configurations predating max_crl_entries_behavior.
+		result.MaxCRLEntriesBehavior = defaultCrlConfig.MaxCRLEntriesBehavior
+	}
+
+	if result.OcspNonceMaxLength == 0 {
+		// Configurations predating ocsp_nonce_max_length.
+		result.OcspNonceMaxLength = defaultCrlConfig.OcspNonceMaxLength
+	}
+
 	return &result, nil
 }
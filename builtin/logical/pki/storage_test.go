@@ -199,6 +199,70 @@ func Test_IssuerUpgrade(t *testing.T) {
 	require.False(t, newIssuer.Usage.HasUsage(OCSPSigningUsage))
 }
 
+func Test_IssuerCache(t *testing.T) {
+	t.Parallel()
+	b, s := createBackendWithStorage(t)
+	sc := b.makeStorageContext(ctx, s)
+	issuer, key := genIssuerAndKey(t, b, s)
+	issuer.Name = "first"
+
+	require.NoError(t, sc.writeKey(key))
+	require.NoError(t, sc.writeIssuer(&issuer))
+	require.NoError(t, sc.setIssuersConfig(&issuerConfigEntry{DefaultIssuerId: issuer.ID}))
+
+	// Writes through the storageContext are picked up straight away.
+	id, err := sc.resolveIssuerReference("first")
+	require.NoError(t, err)
+	require.Equal(t, issuer.ID, id)
+	id, err = sc.resolveIssuerReference(defaultRef)
+	require.NoError(t, err)
+	require.Equal(t, issuer.ID, id)
+
+	entry, bundle, err := sc.fetchSigningIssuer(issuer.ID)
+	require.NoError(t, err)
+	require.Equal(t, "first", entry.Name)
+	require.NotNil(t, bundle.PrivateKey)
+	cachedEntry, cachedBundle, err := sc.fetchSigningIssuer(issuer.ID)
+	require.NoError(t, err)
+	require.Same(t, entry, cachedEntry)
+	require.Same(t, bundle, cachedBundle)
+
+	// Changes made by other nodes are picked up on invalidation.
+	issuer.Name = "second"
+	raw, err := logical.StorageEntryJSON(issuerPrefix+issuer.ID.String(), issuer)
+	require.NoError(t, err)
+	require.NoError(t, s.Put(ctx, raw))
+
+	id, err = sc.resolveIssuerReference("first")
+	require.NoError(t, err)
+	require.Equal(t, issuer.ID, id)
+
+	b.invalidate(ctx, issuerPrefix+issuer.ID.String())
+	_, err = sc.resolveIssuerReference("first")
+	require.Error(t, err)
+	id, err = sc.resolveIssuerReference("second")
+	require.NoError(t, err)
+	require.Equal(t, issuer.ID, id)
+	entry, _, err = sc.fetchSigningIssuer(issuer.ID)
+	require.NoError(t, err)
+	require.Equal(t, "second", entry.Name)
+
+	// Values loaded before a flush aren't cached.
+	generation := b.issuerCache.currentGeneration()
+	b.issuerCache.flush()
+	b.issuerCache.putSigner(issuer.ID, &signingIssuer{entry: entry, bundle: bundle}, generation)
+	require.Nil(t, b.issuerCache.getSigner(issuer.ID))
+
+	_, err = sc.deleteIssuer(issuer.ID)
+	require.NoError(t, err)
+	_, err = sc.resolveIssuerReference("second")
+	require.Error(t, err)
+	_, err = sc.resolveIssuerReference(defaultRef)
+	require.Error(t, err)
+	_, _, err = sc.fetchSigningIssuer(issuer.ID)
+	require.Error(t, err)
+}
+
 func genIssuerAndKey(t *testing.T, b *backend, s logical.Storage) (issuerEntry, keyEntry) {
 	certBundle := genCertBundle(t, b, s)
 
@@ -0,0 +1,92 @@
+package pki
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+)
+
+// Roles may construct the subject's common name, organizational units and
+// organizations from templates rather than taking them from requests. Along
+// with the identity templating of ACL policies ({{identity.entity.name}},
+// {{identity.entity.metadata.<key>}} and so on), templates may refer to the
+// request's string parameters as {{request.<parameter>}}. The values of
+// request parameters are substituted verbatim, never templated further.
+var requestTemplateRegex = regexp.MustCompile(`\{\{\s*request\.([a-z_]+)\s*\}\}`)
+
+// requestTemplateParameters are the request parameters subject templates
+// may refer to: the string parameters of the issue and sign paths.
+var requestTemplateParameters = func() map[string]bool {
+	params := map[string]bool{}
+	for name, schema := range addNonCACommonFields(map[string]*framework.FieldSchema{}) {
+		if schema.Type == framework.TypeString {
+			params[name] = true
+		}
+	}
+	return params
+}()
+
+// validateSubjectTemplate checks a subject template when the role is
+// written.
+func validateSubjectTemplate(field, tpl string) error {
+	for _, match := range requestTemplateRegex.FindAllStringSubmatch(tpl, -1) {
+		if !requestTemplateParameters[match[1]] {
+			return fmt.Errorf("%s refers to unknown request parameter %q", field, match[1])
+		}
+	}
+	for _, segment := range requestTemplateRegex.Split(tpl, -1) {
+		if _, err := framework.ValidateIdentityTemplate(segment); err != nil {
+			return fmt.Errorf("%s is not a valid template: %w", field, err)
+		}
+	}
+	return nil
+}
+
+// renderSubjectTemplate renders a role's subject template for the request.
+func renderSubjectTemplate(b *backend, data *inputBundle, tpl string) (string, error) {
+	segments := requestTemplateRegex.Split(tpl, -1)
+	matches := requestTemplateRegex.FindAllStringSubmatch(tpl, -1)
+
+	var rendered strings.Builder
+	for i, segment := range segments {
+		isTemplate, _ := framework.ValidateIdentityTemplate(segment)
+		if isTemplate {
+			if data.req.EntityID == "" {
+				return "", errutil.UserError{Err: "this role constructs the certificate's subject from the requester's identity, but the request has no entity"}
+			}
+			populated, err := framework.PopulateIdentityTemplate(segment, data.req.EntityID, b.System())
+			if err != nil {
+				return "", errutil.UserError{Err: fmt.Sprintf("unable to construct the certificate's subject from the requester's identity: %v", err)}
+			}
+			segment = populated
+		}
+		rendered.WriteString(segment)
+
+		if i < len(matches) {
+			if value, ok := data.apiData.GetOk(matches[i][1]); ok {
+				rendered.WriteString(value.(string))
+			}
+		}
+	}
+
+	return rendered.String(), nil
+}
+
+// renderSubjectTemplates renders each of a role's templates for a
+// multi-valued subject attribute, dropping those rendering empty.
+func renderSubjectTemplates(b *backend, data *inputBundle, tpls []string) ([]string, error) {
+	var values []string
+	for _, tpl := range tpls {
+		value, err := renderSubjectTemplate(b, data, tpl)
+		if err != nil {
+			return nil, err
+		}
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values, nil
+}
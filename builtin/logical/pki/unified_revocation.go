@@ -0,0 +1,260 @@
+package pki
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// unifiedRevocationPath holds revocation entries from every cluster,
+	// keyed by the identifier of the cluster that performed the revocation.
+	// Unlike revokedPath, it is not in LocalStorage and so is replicated to
+	// all clusters.
+	unifiedRevocationPath = "unified-revocation/"
+
+	// localClusterIDPath holds a random identifier for this cluster, used to
+	// partition unifiedRevocationPath. It is cluster-local.
+	localClusterIDPath = "local-cluster-id"
+
+	// unifiedRevocationQueuePath holds changes to this cluster's unified
+	// revocation entries which couldn't be written to the replicated store,
+	// such as those made on a performance secondary. It is cluster-local;
+	// queued changes are transferred once the store becomes writable.
+	unifiedRevocationQueuePath = "unified-revocation-queue/"
+)
+
+type unifiedRevocationEntry struct {
+	SerialNumber      string    `json:"serial_number"`
+	CertExpiration    time.Time `json:"certificate_expiration_utc"`
+	RevocationTimeUTC time.Time `json:"revocation_time_utc"`
+	CertificateIssuer issuerID  `json:"issuer_id"`
+	Reason            int       `json:"reason,omitempty"`
+}
+
+// queuedUnifiedRevocation is a pending change to the unified revocation
+// store: either an entry to write or, when Removed is set, one to delete.
+type queuedUnifiedRevocation struct {
+	Entry   *unifiedRevocationEntry `json:"entry,omitempty"`
+	Removed bool                    `json:"removed,omitempty"`
+}
+
+type localClusterIDEntry struct {
+	ID string `json:"id"`
+}
+
+// getLocalClusterID returns this cluster's identifier, creating it on first
+// use.
+func (sc *storageContext) getLocalClusterID() (string, error) {
+	entry, err := sc.Storage.Get(sc.Context, localClusterIDPath)
+	if err != nil {
+		return "", err
+	}
+	if entry != nil {
+		var info localClusterIDEntry
+		if err := entry.DecodeJSON(&info); err != nil {
+			return "", fmt.Errorf("unable to decode local cluster id: %w", err)
+		}
+		return info.ID, nil
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", err
+	}
+	entry, err = logical.StorageEntryJSON(localClusterIDPath, localClusterIDEntry{ID: id})
+	if err != nil {
+		return "", err
+	}
+	if err := sc.Storage.Put(sc.Context, entry); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// writeUnifiedRevocationEntry records a revocation performed by this cluster
+// in the replicated unified revocation store, so that OCSP responders on
+// other clusters can answer for it. Where the store can't be written, the
+// entry is queued for transferUnifiedRevocationQueue instead.
+func writeUnifiedRevocationEntry(sc *storageContext, serial string, revInfo *revocationInfo, certExpiration time.Time) error {
+	clusterID, err := sc.getLocalClusterID()
+	if err != nil {
+		return fmt.Errorf("unable to fetch local cluster id: %w", err)
+	}
+
+	revEntry := &unifiedRevocationEntry{
+		SerialNumber:      denormalizeSerial(serial),
+		CertExpiration:    certExpiration.UTC(),
+		RevocationTimeUTC: revInfo.RevocationTimeUTC,
+		CertificateIssuer: revInfo.CertificateIssuer,
+		Reason:            revInfo.Reason,
+	}
+	entry, err := logical.StorageEntryJSON(unifiedRevocationPath+clusterID+"/"+normalizeSerial(serial), revEntry)
+	if err != nil {
+		return err
+	}
+
+	err = sc.Storage.Put(sc.Context, entry)
+	if errors.Is(err, logical.ErrReadOnly) {
+		return sc.queueUnifiedRevocation(serial, queuedUnifiedRevocation{Entry: revEntry})
+	}
+	if err != nil {
+		return err
+	}
+
+	// Any older queued change is superseded by this write.
+	return sc.Storage.Delete(sc.Context, unifiedRevocationQueuePath+normalizeSerial(serial))
+}
+
+// deleteUnifiedRevocationEntry removes this cluster's unified revocation
+// entry for the serial, if any. Where the store can't be written, the
+// removal is queued like writes are.
+func deleteUnifiedRevocationEntry(sc *storageContext, serial string) error {
+	clusterID, err := sc.getLocalClusterID()
+	if err != nil {
+		return fmt.Errorf("unable to fetch local cluster id: %w", err)
+	}
+
+	err = sc.Storage.Delete(sc.Context, unifiedRevocationPath+clusterID+"/"+normalizeSerial(serial))
+	if errors.Is(err, logical.ErrReadOnly) {
+		return sc.queueUnifiedRevocation(serial, queuedUnifiedRevocation{Removed: true})
+	}
+	if err != nil {
+		return err
+	}
+
+	return sc.Storage.Delete(sc.Context, unifiedRevocationQueuePath+normalizeSerial(serial))
+}
+
+// queueUnifiedRevocation persists a change to this cluster's unified
+// revocation entry for the serial, replacing any earlier queued change.
+func (sc *storageContext) queueUnifiedRevocation(serial string, change queuedUnifiedRevocation) error {
+	entry, err := logical.StorageEntryJSON(unifiedRevocationQueuePath+normalizeSerial(serial), change)
+	if err != nil {
+		return err
+	}
+	if err := sc.Storage.Put(sc.Context, entry); err != nil {
+		return fmt.Errorf("unable to queue unified revocation entry: %w", err)
+	}
+	return nil
+}
+
+// transferUnifiedRevocationQueue applies queued changes to the unified
+// revocation store, removing each from the queue once applied. It stops
+// without error while the store remains read-only, leaving the rest queued.
+func (sc *storageContext) transferUnifiedRevocationQueue() error {
+	serials, err := sc.Storage.List(sc.Context, unifiedRevocationQueuePath)
+	if err != nil {
+		return fmt.Errorf("unable to list queued unified revocation entries: %w", err)
+	}
+	if len(serials) == 0 {
+		return nil
+	}
+
+	clusterID, err := sc.getLocalClusterID()
+	if err != nil {
+		return fmt.Errorf("unable to fetch local cluster id: %w", err)
+	}
+
+	for _, serial := range serials {
+		queued, err := sc.Storage.Get(sc.Context, unifiedRevocationQueuePath+serial)
+		if err != nil {
+			return fmt.Errorf("unable to fetch queued unified revocation entry: %w", err)
+		}
+		if queued == nil {
+			continue
+		}
+
+		var change queuedUnifiedRevocation
+		if err := queued.DecodeJSON(&change); err != nil {
+			return fmt.Errorf("unable to decode queued unified revocation entry: %w", err)
+		}
+
+		path := unifiedRevocationPath + clusterID + "/" + serial
+		if change.Removed || change.Entry == nil {
+			err = sc.Storage.Delete(sc.Context, path)
+		} else {
+			var entry *logical.StorageEntry
+			entry, err = logical.StorageEntryJSON(path, change.Entry)
+			if err == nil {
+				err = sc.Storage.Put(sc.Context, entry)
+			}
+		}
+		if errors.Is(err, logical.ErrReadOnly) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unable to transfer queued unified revocation entry: %w", err)
+		}
+
+		if err := sc.Storage.Delete(sc.Context, unifiedRevocationQueuePath+serial); err != nil {
+			return fmt.Errorf("unable to remove transferred unified revocation entry: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// moveUnifiedRevocationEntry updates this cluster's unified revocation
+// entry for the serial, if any, after its revocation entry was associated
+// with another issuer. A queued entry is updated likewise.
+func (sc *storageContext) moveUnifiedRevocationEntry(serial string, revInfo *revocationInfo, certExpiration time.Time) error {
+	clusterID, err := sc.getLocalClusterID()
+	if err != nil {
+		return fmt.Errorf("unable to fetch local cluster id: %w", err)
+	}
+
+	entry, err := sc.Storage.Get(sc.Context, unifiedRevocationPath+clusterID+"/"+normalizeSerial(serial))
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		entry, err = sc.Storage.Get(sc.Context, unifiedRevocationQueuePath+normalizeSerial(serial))
+		if err != nil || entry == nil {
+			return err
+		}
+		var change queuedUnifiedRevocation
+		if err := entry.DecodeJSON(&change); err != nil {
+			return fmt.Errorf("unable to decode queued unified revocation entry: %w", err)
+		}
+		if change.Removed {
+			return nil
+		}
+	}
+	return writeUnifiedRevocationEntry(sc, serial, revInfo, certExpiration)
+}
+
+// fetchUnifiedRevocationEntry looks for a revocation of the serial by any
+// cluster, returning nil if there is none.
+func fetchUnifiedRevocationEntry(sc *storageContext, serial string) (*unifiedRevocationEntry, error) {
+	clusters, err := sc.Storage.List(sc.Context, unifiedRevocationPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list unified revocation clusters: %w", err)
+	}
+
+	for _, cluster := range clusters {
+		if !strings.HasSuffix(cluster, "/") {
+			continue
+		}
+
+		entry, err := sc.Storage.Get(sc.Context, unifiedRevocationPath+cluster+normalizeSerial(serial))
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch unified revocation entry: %w", err)
+		}
+		if entry == nil {
+			continue
+		}
+
+		var revEntry unifiedRevocationEntry
+		if err := entry.DecodeJSON(&revEntry); err != nil {
+			return nil, fmt.Errorf("unable to decode unified revocation entry: %w", err)
+		}
+		return &revEntry, nil
+	}
+
+	return nil, nil
+}
@@ -263,6 +263,12 @@ func sendNotModifiedResponseIfNecessary(helper *IfModifiedSinceHelper, sc *stora
 		return false, nil
 	}
 
+	// If-None-Match takes precedence over If-Modified-Since (RFC 7232);
+	// it is evaluated against the CRL itself, once fetched.
+	if hasHeader(headerIfNoneMatch, helper.req) {
+		return false, nil
+	}
+
 	before, err := sc.isIfModifiedSinceBeforeLastModified(helper, responseHeaders)
 	if err != nil {
 		return false, err
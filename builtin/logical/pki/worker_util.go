@@ -0,0 +1,50 @@
+package pki
+
+import (
+	"context"
+	"sync"
+)
+
+// stoppableWorker manages a background goroutine which may be started and
+// stopped repeatedly, such as over the backend's lifetime. Stopping never
+// blocks: it cancels the goroutine's context, which the goroutine selects
+// on between tasks and passes to whatever it's doing, so that it returns
+// promptly even in the middle of a long task.
+type stoppableWorker struct {
+	lock   sync.Mutex
+	cancel context.CancelFunc
+}
+
+// start launches run in a goroutine, unless it's already running; run must
+// return once its context is done.
+func (w *stoppableWorker) start(run func(ctx context.Context)) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	go run(ctx)
+}
+
+// stop cancels the goroutine's context, if it's running.
+func (w *stoppableWorker) stop() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.cancel != nil {
+		w.cancel()
+		w.cancel = nil
+	}
+}
+
+// running returns whether the goroutine has been started and not stopped.
+func (w *stoppableWorker) running() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.cancel != nil
+}
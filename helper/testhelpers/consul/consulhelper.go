@@ -23,6 +23,24 @@ func (c *Config) APIConfig() *consulapi.Config {
 	return apiConfig
 }
 
+// PrepareTestContainerWithACLBootstrap creates a Consul docker container with
+// ACLs enabled and bootstrapped, returning the agent address along with a
+// management token. This is suitable both for the Consul secrets engine, which
+// needs a management token to mint new tokens, and for the Consul storage and
+// service registration tests. When CONSUL_HTTP_ADDR is set, CONSUL_HTTP_TOKEN
+// must also be set to a management token for that agent.
+func PrepareTestContainerWithACLBootstrap(t *testing.T, version string) (func(), *Config) {
+	t.Helper()
+
+	cleanup, config := PrepareTestContainer(t, version, false, true)
+	if config.Token == "" {
+		cleanup()
+		t.Fatalf("Consul ACL bootstrap did not yield a management token")
+	}
+
+	return cleanup, config
+}
+
 // PrepareTestContainer creates a Consul docker container.  If version is empty,
 // the Consul version used will be given by the environment variable
 // CONSUL_DOCKER_VERSION, or if that's empty, whatever we've hardcoded as the
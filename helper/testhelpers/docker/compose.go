@@ -0,0 +1,157 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// ComposeService describes one of the containers started by StartCompose.
+type ComposeService struct {
+	// Name identifies the service within the composition. Unless
+	// RunOptions.ContainerName is set, it is also the hostname by which the
+	// other services can reach this one on the shared network.
+	Name       string
+	RunOptions RunOptions
+	// Connect determines when the service is ready, as for StartService. If
+	// nil, the image's HEALTHCHECK is used.
+	Connect ServiceAdapter
+	// DependsOn names services that must be ready before this one starts.
+	DependsOn []string
+}
+
+// Compose is a set of services started together on a shared network.
+type Compose struct {
+	NetworkID string
+
+	services    map[string]*Service
+	runners     map[string]*Runner
+	order       []string
+	cleanupOnce sync.Once
+}
+
+// StartCompose creates a network, then starts the given services on it one
+// at a time, each only after the services it depends on are ready. All
+// containers and the network are removed by Cleanup, which is also
+// registered with t.Cleanup. Any failure is fatal to the test.
+func StartCompose(t testing.TB, services ...ComposeService) *Compose {
+	t.Helper()
+
+	order, err := composeOrder(services)
+	if err != nil {
+		t.Fatalf("Invalid composition: %s", err)
+	}
+
+	byName := make(map[string]ComposeService, len(services))
+	for _, svc := range services {
+		byName[svc.Name] = svc
+	}
+
+	c := &Compose{
+		NetworkID: CreateNetwork(t, "vault-compose"),
+		services:  make(map[string]*Service, len(services)),
+		runners:   make(map[string]*Runner, len(services)),
+	}
+	t.Cleanup(c.Cleanup)
+
+	for _, name := range order {
+		svc := byName[name]
+
+		opts := svc.RunOptions
+		if opts.ContainerName == "" {
+			opts.ContainerName = svc.Name
+		}
+		opts.Networks = append(append([]string(nil), opts.Networks...), c.NetworkID)
+
+		runner, err := NewServiceRunner(opts)
+		if err != nil {
+			t.Fatalf("Could not create runner for service %q: %s", name, err)
+		}
+		started, err := runner.StartService(context.Background(), svc.Connect)
+		if err != nil {
+			t.Fatalf("Could not start service %q: %s", name, err)
+		}
+
+		c.services[name] = started
+		c.runners[name] = runner
+		c.order = append(c.order, name)
+	}
+
+	return c
+}
+
+// Service returns the named service, or nil if there is no such service.
+func (c *Compose) Service(name string) *Service {
+	return c.services[name]
+}
+
+// Runner returns the runner that started the named service, for use with
+// e.g. Exec or CopyTo, or nil if there is no such service.
+func (c *Compose) Runner(name string) *Runner {
+	return c.runners[name]
+}
+
+// Cleanup removes the services' containers in the reverse of the order in
+// which they were started. It is safe to call more than once.
+func (c *Compose) Cleanup() {
+	c.cleanupOnce.Do(func() {
+		for i := len(c.order) - 1; i >= 0; i-- {
+			c.services[c.order[i]].Cleanup()
+		}
+	})
+}
+
+// composeOrder returns the service names sorted so that every service comes
+// after its dependencies.
+func composeOrder(services []ComposeService) ([]string, error) {
+	deps := make(map[string][]string, len(services))
+	var names []string
+	for _, svc := range services {
+		if svc.Name == "" {
+			return nil, fmt.Errorf("service name is required")
+		}
+		if _, ok := deps[svc.Name]; ok {
+			return nil, fmt.Errorf("duplicate service %q", svc.Name)
+		}
+		deps[svc.Name] = svc.DependsOn
+		names = append(names, svc.Name)
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(services))
+	var order []string
+
+	var visit func(name, from string) error
+	visit = func(name, from string) error {
+		dependsOn, ok := deps[name]
+		if !ok {
+			return fmt.Errorf("service %q depends on unknown service %q", from, name)
+		}
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle involving service %q", name)
+		}
+		state[name] = visiting
+		for _, dep := range dependsOn {
+			if err := visit(dep, name); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name, ""); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
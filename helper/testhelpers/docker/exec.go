@@ -0,0 +1,70 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// ExecResult is the outcome of a command run with Exec.
+type ExecResult struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+// Exec runs cmd inside the running container and waits for it to finish. A
+// non-zero exit code is not an error; the returned error only reflects
+// failure to run the command at all. env entries are of the form KEY=value.
+func (d *Runner) Exec(ctx context.Context, containerID string, cmd []string, env []string) (*ExecResult, error) {
+	if len(cmd) == 0 {
+		return nil, fmt.Errorf("no command given")
+	}
+
+	created, err := d.DockerAPI.ContainerExecCreate(ctx, containerID, types.ExecConfig{
+		Cmd:          cmd,
+		Env:          env,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating exec of %q: %w", cmd[0], err)
+	}
+
+	attached, err := d.DockerAPI.ContainerExecAttach(ctx, created.ID, types.ExecStartCheck{})
+	if err != nil {
+		return nil, fmt.Errorf("error attaching to exec of %q: %w", cmd[0], err)
+	}
+	defer attached.Close()
+
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, attached.Reader); err != nil {
+		return nil, fmt.Errorf("error reading output of %q: %w", cmd[0], err)
+	}
+
+	// The exit code may lag slightly behind the output stream closing.
+	var inspect types.ContainerExecInspect
+	for i := 0; ; i++ {
+		inspect, err = d.DockerAPI.ContainerExecInspect(ctx, created.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error inspecting exec of %q: %w", cmd[0], err)
+		}
+		if !inspect.Running {
+			break
+		}
+		if i == 20 {
+			return nil, fmt.Errorf("exec of %q still running after its output closed", cmd[0])
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return &ExecResult{
+		Stdout:   stdout.Bytes(),
+		Stderr:   stderr.Bytes(),
+		ExitCode: inspect.ExitCode,
+	}, nil
+}
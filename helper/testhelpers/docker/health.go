@@ -0,0 +1,44 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cenkalti/backoff/v3"
+	"github.com/docker/docker/api/types"
+)
+
+// healthCheckAdapter is used by StartService when no ServiceAdapter is given.
+// It considers the service ready once the image's own HEALTHCHECK reports the
+// container healthy, and fails immediately if the image has no health check
+// or the container is reported unhealthy.
+func (d *Runner) healthCheckAdapter(containerID string) ServiceAdapter {
+	return func(ctx context.Context, host string, port int) (ServiceConfig, error) {
+		inspect, err := d.DockerAPI.ContainerInspect(ctx, containerID)
+		if err != nil {
+			return nil, err
+		}
+
+		if inspect.State == nil || inspect.State.Health == nil || inspect.State.Health.Status == types.NoHealthcheck {
+			return nil, backoff.Permanent(fmt.Errorf("image %s does not define a HEALTHCHECK; a ServiceAdapter is required", inspect.Config.Image))
+		}
+
+		health := inspect.State.Health
+		switch health.Status {
+		case types.Healthy:
+			return NewServiceHostPort(host, port), nil
+		case types.Unhealthy:
+			return nil, backoff.Permanent(fmt.Errorf("container reported unhealthy after %d failed checks: %s", health.FailingStreak, lastHealthOutput(health)))
+		default:
+			return nil, fmt.Errorf("container health is %q", health.Status)
+		}
+	}
+}
+
+func lastHealthOutput(health *types.Health) string {
+	if len(health.Log) == 0 {
+		return "no health check output"
+	}
+	return strings.TrimSpace(health.Log[len(health.Log)-1].Output)
+}
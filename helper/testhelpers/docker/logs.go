@@ -0,0 +1,109 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// Number of trailing lines of container output included in the error
+// returned from StartService when the service never became ready.
+const startFailureLogLines = 50
+
+// streamLogs copies the container's stdout and stderr to the writers given
+// in RunOptions until the container exits or is removed.
+func (d *Runner) streamLogs(containerID string) {
+	stdout, stderr := d.RunOptions.LogStdout, d.RunOptions.LogStderr
+	rc, err := d.DockerAPI.ContainerLogs(context.Background(), containerID, types.ContainerLogsOptions{
+		ShowStdout: stdout != nil,
+		ShowStderr: stderr != nil,
+		Follow:     true,
+	})
+	if err != nil {
+		return
+	}
+	defer rc.Close()
+
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+	_, _ = stdcopy.StdCopy(stdout, stderr, rc)
+}
+
+// tailLogs returns the last n lines of combined container output.
+func (d *Runner) tailLogs(ctx context.Context, containerID string, n int) (string, error) {
+	rc, err := d.DockerAPI.ContainerLogs(ctx, containerID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Tail:       strconv.Itoa(n),
+	})
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	var buf bytes.Buffer
+	if _, err := stdcopy.StdCopy(&buf, &buf, rc); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// TestLogWriter returns a writer suitable for RunOptions.LogStdout or
+// LogStderr which logs each line of container output via t.Log, prefixed
+// with name. Output written after the test has completed is dropped.
+func TestLogWriter(t testing.TB, name string) io.Writer {
+	pr, pw := io.Pipe()
+
+	var done bool
+	var lock sync.Mutex
+	t.Cleanup(func() {
+		lock.Lock()
+		defer lock.Unlock()
+		done = true
+		pw.Close()
+	})
+
+	go func() {
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			lock.Lock()
+			if !done {
+				t.Logf("[%s] %s", name, scanner.Text())
+			}
+			lock.Unlock()
+		}
+	}()
+
+	return pw
+}
+
+// FailureLogConsumer returns a function suitable for RunOptions.LogConsumer
+// which logs the last n lines of container output via t.Log, but only when
+// the test has already failed by the time the container is cleaned up.
+func FailureLogConsumer(t testing.TB, n int) func(string) {
+	return func(logs string) {
+		if !t.Failed() {
+			return
+		}
+
+		lines := strings.Split(strings.TrimSpace(logs), "\n")
+		if n > 0 && len(lines) > n {
+			lines = lines[len(lines)-n:]
+		}
+		t.Logf("last %d lines of container output:\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+}
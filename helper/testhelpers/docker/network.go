@@ -0,0 +1,79 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// CreateNetwork creates a bridge network whose name starts with the given
+// prefix, and registers its removal with t.Cleanup. Since cleanups run in
+// reverse order, containers started after the network is created are removed
+// before it. The network's ID is returned; pass it as RunOptions.NetworkID or
+// in RunOptions.Networks.
+func CreateNetwork(t testing.TB, prefix string) string {
+	t.Helper()
+
+	dapi, err := newDockerClient()
+	if err != nil {
+		t.Fatalf("Could not create docker client: %s", err)
+	}
+
+	name, err := resourceName(prefix)
+	if err != nil {
+		t.Fatalf("Could not generate network name: %s", err)
+	}
+
+	resp, err := dapi.NetworkCreate(context.Background(), name, types.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         "bridge",
+		Labels:         resourceLabels(nil),
+	})
+	if err != nil {
+		t.Fatalf("Could not create docker network %q: %s", name, err)
+	}
+	registerNetwork(resp.ID)
+
+	t.Cleanup(func() {
+		if err := RemoveNetwork(context.Background(), resp.ID); err != nil {
+			t.Logf("Could not remove docker network %q: %s", name, err)
+		}
+	})
+
+	return resp.ID
+}
+
+// RemoveNetwork disconnects any containers still attached to the network and
+// removes it. Removing a network that no longer exists is not an error.
+func RemoveNetwork(ctx context.Context, networkID string) error {
+	dapi, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+
+	nw, err := dapi.NetworkInspect(ctx, networkID, types.NetworkInspectOptions{})
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			unregisterNetwork(networkID)
+			return nil
+		}
+		return err
+	}
+
+	for containerID := range nw.Containers {
+		err := dapi.NetworkDisconnect(ctx, networkID, containerID, true)
+		if err != nil && !client.IsErrNotFound(err) {
+			return fmt.Errorf("error disconnecting container %s: %w", containerID, err)
+		}
+	}
+
+	err = dapi.NetworkRemove(ctx, networkID)
+	if err != nil && !client.IsErrNotFound(err) {
+		return err
+	}
+	unregisterNetwork(networkID)
+	return nil
+}
@@ -0,0 +1,88 @@
+package docker
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+// platformEnv overrides RunOptions.Platform for every container, e.g. to
+// force amd64 images under emulation on arm64 hosts.
+const platformEnv = "VAULT_TEST_DOCKER_PLATFORM"
+
+// fallbackPlatform is tried when an image has no variant for the engine's
+// native architecture. Engines on other architectures can usually run it
+// under emulation, if slowly.
+const fallbackPlatform = "linux/amd64"
+
+// engineArch returns the docker engine's architecture using Go's naming, or
+// the empty string if it can't be determined.
+func (d *Runner) engineArch(ctx context.Context) string {
+	info, err := d.DockerAPI.Info(ctx)
+	if err != nil {
+		return ""
+	}
+	switch info.Architecture {
+	case "x86_64":
+		return "amd64"
+	case "aarch64":
+		return "arm64"
+	case "armv7l":
+		return "arm"
+	}
+	return info.Architecture
+}
+
+// resolveImage returns the image tag and platform to use, taking into
+// account ArchImageTags, Platform and the platform override environment
+// variable. The returned platform is empty if the engine default should be
+// used.
+func (d *Runner) resolveImage(ctx context.Context) (string, string) {
+	platform := d.RunOptions.Platform
+	if env := os.Getenv(platformEnv); env != "" {
+		platform = env
+	}
+
+	arch := ""
+	if platform != "" {
+		pieces := strings.Split(platform, "/")
+		if len(pieces) > 1 {
+			arch = pieces[1]
+		}
+	} else if len(d.RunOptions.ArchImageTags) > 0 {
+		arch = d.engineArch(ctx)
+	}
+
+	if tag, ok := d.RunOptions.ArchImageTags[arch]; ok {
+		return tag, platform
+	}
+	return d.RunOptions.ImageTag, platform
+}
+
+// pullImage pulls the image for the given platform, or the engine's default
+// platform if empty. If the image has no variant for the default platform,
+// fallbackPlatform is pulled instead. Pulling is best-effort: the image may
+// already be present locally, so the caller finds out about any real problem
+// when creating the container.
+func (d *Runner) pullImage(ctx context.Context, image, platform string, opts types.ImageCreateOptions) {
+	opts.Platform = platform
+	err := d.pull(ctx, image, opts)
+	if err != nil && platform == "" && strings.Contains(err.Error(), "no matching manifest") {
+		opts.Platform = fallbackPlatform
+		_ = d.pull(ctx, image, opts)
+	}
+}
+
+func (d *Runner) pull(ctx context.Context, image string, opts types.ImageCreateOptions) error {
+	resp, err := d.DockerAPI.ImageCreate(ctx, image, opts)
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+	// Failures part way through the pull are only reported in the stream.
+	return jsonmessage.DisplayJSONMessagesStream(resp, ioutil.Discard, 0, false, nil)
+}
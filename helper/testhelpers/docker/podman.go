@@ -0,0 +1,66 @@
+package docker
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// containerHostEnv is Podman's equivalent of DOCKER_HOST. We only consult
+// it when DOCKER_HOST is unset, so an explicit Docker configuration wins.
+const containerHostEnv = "CONTAINER_HOST"
+
+// newDockerClient builds an API client honoring the standard DOCKER_*
+// environment variables, falling back to CONTAINER_HOST so that a Podman
+// socket can be used without further configuration.
+func newDockerClient() (*client.Client, error) {
+	opts := []client.Opt{client.FromEnv, client.WithVersion("1.39")}
+	if os.Getenv("DOCKER_HOST") == "" {
+		if host := os.Getenv(containerHostEnv); host != "" {
+			opts = append(opts, client.WithHost(host))
+		}
+	}
+
+	return client.NewClientWithOpts(opts...)
+}
+
+// IsPodman reports whether the engine behind dapi is Podman (including
+// rootless Podman) rather than Docker. Errors talking to the engine are
+// treated as "not Podman".
+func IsPodman(ctx context.Context, dapi *client.Client) bool {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	version, err := dapi.ServerVersion(ctx)
+	if err != nil {
+		return false
+	}
+
+	for _, component := range version.Components {
+		if strings.Contains(strings.ToLower(component.Name), "podman") {
+			return true
+		}
+	}
+
+	return strings.Contains(strings.ToLower(version.Platform.Name), "podman")
+}
+
+// qualifyImageRepo expands short image names (e.g. "postgres" or
+// "hashicorp/vault") to fully qualified Docker Hub references. Docker does
+// this implicitly, but Podman may be configured to refuse ambiguous short
+// names.
+func qualifyImageRepo(repo string) string {
+	first := strings.SplitN(repo, "/", 2)[0]
+	if strings.ContainsAny(first, ".:") || first == "localhost" {
+		// Already names a registry.
+		return repo
+	}
+
+	if !strings.Contains(repo, "/") {
+		return "docker.io/library/" + repo
+	}
+	return "docker.io/" + repo
+}
@@ -0,0 +1,170 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// registryMirrorEnv overrides RunOptions.RegistryMirror for every
+	// container.
+	registryMirrorEnv = "VAULT_TEST_DOCKER_REGISTRY_MIRROR"
+
+	dockerHubRegistry = "docker.io"
+	// dockerHubAuthKey is the key under which the docker CLI stores Docker
+	// Hub credentials.
+	dockerHubAuthKey = "https://index.docker.io/v1/"
+)
+
+// imageRegistry returns the registry host an image repo is pulled from.
+func imageRegistry(repo string) string {
+	first := strings.SplitN(repo, "/", 2)[0]
+	if strings.Contains(repo, "/") && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return first
+	}
+	return dockerHubRegistry
+}
+
+// mirrorImageRepo rewrites Docker Hub image repos to be pulled through the
+// configured mirror, if any. Images from other registries are unchanged.
+func (d *Runner) mirrorImageRepo(repo string) string {
+	mirror := d.RunOptions.RegistryMirror
+	if env := os.Getenv(registryMirrorEnv); env != "" {
+		mirror = env
+	}
+	if mirror == "" || imageRegistry(repo) != dockerHubRegistry {
+		return repo
+	}
+
+	repo = strings.TrimPrefix(repo, dockerHubRegistry+"/")
+	if !strings.Contains(repo, "/") {
+		repo = "library/" + repo
+	}
+	return strings.TrimSuffix(mirror, "/") + "/" + repo
+}
+
+// registryAuth returns the encoded credentials to pull from the registry
+// hosting repo: those given in RunOptions if any, otherwise those in the
+// local docker configuration. An empty string means pull anonymously.
+func (d *Runner) registryAuth(repo string) (string, error) {
+	registry := imageRegistry(repo)
+
+	username, password := d.RunOptions.AuthUsername, d.RunOptions.AuthPassword
+	if username == "" || password == "" {
+		var err error
+		username, password, err = dockerConfigCredentials(registry)
+		if err != nil {
+			return "", err
+		}
+		if username == "" {
+			return "", nil
+		}
+	}
+
+	var buf bytes.Buffer
+	auth := map[string]string{
+		"username":      username,
+		"password":      password,
+		"serveraddress": registry,
+	}
+	if err := json.NewEncoder(&buf).Encode(auth); err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// dockerConfig is the subset of the docker CLI's config.json we understand.
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth string `json:"auth"`
+	} `json:"auths"`
+	CredsStore  string            `json:"credsStore"`
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+// dockerConfigCredentials looks up credentials for registry the way the
+// docker CLI does: first a registry-specific credential helper, then the
+// default credential store, then credentials stored inline in config.json.
+// Missing configuration is not an error; empty credentials are returned.
+func dockerConfigCredentials(registry string) (string, string, error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", nil
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", "", nil
+		}
+		return "", "", err
+	}
+	var cfg dockerConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return "", "", fmt.Errorf("error parsing docker config: %w", err)
+	}
+
+	key := registry
+	if registry == dockerHubRegistry {
+		key = dockerHubAuthKey
+	}
+
+	helper := cfg.CredHelpers[registry]
+	if helper == "" {
+		helper = cfg.CredsStore
+	}
+	if helper != "" {
+		username, password, err := credentialHelperGet(helper, key)
+		if err != nil || username != "" {
+			return username, password, err
+		}
+	}
+
+	entry, ok := cfg.Auths[key]
+	if !ok || entry.Auth == "" {
+		return "", "", nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+	if err != nil {
+		return "", "", fmt.Errorf("error decoding docker config credentials for %s: %w", registry, err)
+	}
+	pieces := strings.SplitN(string(decoded), ":", 2)
+	if len(pieces) != 2 {
+		return "", "", fmt.Errorf("malformed docker config credentials for %s", registry)
+	}
+	return pieces[0], pieces[1], nil
+}
+
+// credentialHelperGet runs docker-credential-<helper> to fetch the
+// credentials for serverURL. A helper that has no credentials for the server
+// yields empty credentials.
+func credentialHelperGet(helper, serverURL string) (string, string, error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	out, err := cmd.Output()
+	if err != nil {
+		// Helpers exit non-zero when they have no credentials for the
+		// server; treat that, and missing helpers, as anonymous.
+		return "", "", nil
+	}
+
+	var creds struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return "", "", fmt.Errorf("error parsing output of docker-credential-%s: %w", helper, err)
+	}
+	return creds.Username, creds.Secret, nil
+}
@@ -0,0 +1,204 @@
+package docker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+const (
+	// Every container and network created by this package carries these
+	// labels, so that resources leaked by crashed test runs can be found.
+	labelTest      = "com.hashicorp.vault.test"
+	labelOwnerPID  = "com.hashicorp.vault.test.owner-pid"
+	labelOwnerHost = "com.hashicorp.vault.test.owner-host"
+	labelCreated   = "com.hashicorp.vault.test.created"
+
+	// maxHostnameLen is the longest hostname docker accepts; container names
+	// double as hostnames.
+	maxHostnameLen = 63
+)
+
+// runID distinguishes the resources of this process from those of other test
+// binaries running concurrently.
+var runID = func() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.Itoa(os.Getpid())
+	}
+	return hex.EncodeToString(b)
+}()
+
+// resourceName returns a name for a new container or network that won't
+// collide with any other created by this or any concurrent test run.
+func resourceName(prefix string) (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	suffix := "-" + runID + "-" + hex.EncodeToString(b)
+	if len(prefix)+len(suffix) > maxHostnameLen {
+		prefix = prefix[:maxHostnameLen-len(suffix)]
+	}
+	return prefix + suffix, nil
+}
+
+// resourceLabels returns the labels to apply to a new resource, merged with
+// any given by the caller.
+func resourceLabels(extra map[string]string) map[string]string {
+	labels := map[string]string{
+		labelTest:     "true",
+		labelOwnerPID: strconv.Itoa(os.Getpid()),
+		labelCreated:  strconv.FormatInt(time.Now().Unix(), 10),
+	}
+	if host, err := os.Hostname(); err == nil {
+		labels[labelOwnerHost] = host
+	}
+	for k, v := range extra {
+		labels[k] = v
+	}
+	return labels
+}
+
+// registry tracks the resources this process has created and not yet
+// removed, for CleanupAll.
+var registry = struct {
+	sync.Mutex
+	containers map[string]struct{}
+	networks   map[string]struct{}
+}{
+	containers: make(map[string]struct{}),
+	networks:   make(map[string]struct{}),
+}
+
+func registerContainer(id string) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.containers[id] = struct{}{}
+}
+
+func unregisterContainer(id string) {
+	registry.Lock()
+	defer registry.Unlock()
+	delete(registry.containers, id)
+}
+
+func registerNetwork(id string) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.networks[id] = struct{}{}
+}
+
+func unregisterNetwork(id string) {
+	registry.Lock()
+	defer registry.Unlock()
+	delete(registry.networks, id)
+}
+
+// CleanupAll removes every container and network created by this process
+// that hasn't been cleaned up yet. It's meant to be deferred in TestMain, as
+// a backstop for tests that fail to call their cleanup funcs. Containers
+// shared via RunOptions.Reusable are not affected.
+func CleanupAll(ctx context.Context) error {
+	registry.Lock()
+	containers := make([]string, 0, len(registry.containers))
+	for id := range registry.containers {
+		containers = append(containers, id)
+	}
+	networks := make([]string, 0, len(registry.networks))
+	for id := range registry.networks {
+		networks = append(networks, id)
+	}
+	registry.Unlock()
+
+	dapi, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, id := range containers {
+		err := dapi.ContainerRemove(ctx, id, types.ContainerRemoveOptions{Force: true})
+		if err != nil && !client.IsErrNotFound(err) {
+			errs = append(errs, fmt.Errorf("error removing container %s: %w", id, err))
+			continue
+		}
+		unregisterContainer(id)
+	}
+	for _, id := range networks {
+		if err := RemoveNetwork(ctx, id); err != nil {
+			errs = append(errs, fmt.Errorf("error removing network %s: %w", id, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d resources could not be removed, first error: %w", len(errs), errs[0])
+	}
+	return nil
+}
+
+// SweepLeaked removes containers and networks left behind by test runs on
+// this host that are no longer running, e.g. because the test binary
+// crashed or was killed. Only resources older than minAge are considered, as
+// an extra safeguard. Containers shared via RunOptions.Reusable are left for
+// their own idle cleanup.
+func SweepLeaked(ctx context.Context, minAge time.Duration) error {
+	dapi, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+
+	host, _ := os.Hostname()
+	leaked := func(labels map[string]string) bool {
+		if labels[labelOwnerHost] != host {
+			// We can't tell whether processes on other hosts are alive.
+			return false
+		}
+		created, err := strconv.ParseInt(labels[labelCreated], 10, 64)
+		if err != nil || time.Since(time.Unix(created, 0)) < minAge {
+			return false
+		}
+		pid, err := strconv.Atoi(labels[labelOwnerPID])
+		return err == nil && !processAlive(pid)
+	}
+
+	labelFilter := filters.NewArgs(filters.Arg("label", labelOwnerPID))
+
+	containers, err := dapi.ContainerList(ctx, types.ContainerListOptions{All: true, Filters: labelFilter})
+	if err != nil {
+		return err
+	}
+	for _, c := range containers {
+		if _, shared := c.Labels[reuseLabel]; shared || !leaked(c.Labels) {
+			continue
+		}
+		err := dapi.ContainerRemove(ctx, c.ID, types.ContainerRemoveOptions{Force: true})
+		if err != nil && !client.IsErrNotFound(err) {
+			return fmt.Errorf("error removing container %s: %w", c.ID, err)
+		}
+	}
+
+	networks, err := dapi.NetworkList(ctx, types.NetworkListOptions{Filters: labelFilter})
+	if err != nil {
+		return err
+	}
+	for _, nw := range networks {
+		if !leaked(nw.Labels) {
+			continue
+		}
+		if err := RemoveNetwork(ctx, nw.ID); err != nil {
+			return fmt.Errorf("error removing network %s: %w", nw.ID, err)
+		}
+	}
+
+	return nil
+}
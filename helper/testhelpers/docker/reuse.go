@@ -0,0 +1,279 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/hashicorp/go-uuid"
+)
+
+const (
+	// reuseEnv must be set for RunOptions.Reusable to take effect, so that
+	// sharing containers between test binaries is never the default.
+	reuseEnv = "VAULT_TEST_DOCKER_REUSE"
+
+	// reuseLabel identifies shared containers; its value is the reuse key
+	// derived from the container's configuration.
+	reuseLabel = "com.hashicorp.vault.test.reuse-key"
+
+	defaultReuseIdleTimeout = 10 * time.Minute
+
+	reuseLockTimeout = 2 * time.Minute
+)
+
+// reuseEnabled reports whether this runner should look for, and leave
+// behind, a shared container.
+func (d *Runner) reuseEnabled() bool {
+	return d.RunOptions.Reusable && os.Getenv(reuseEnv) != ""
+}
+
+// reuseKey derives a stable identifier from everything that affects how the
+// container behaves, so that only identically configured containers are
+// shared.
+func (d *Runner) reuseKey() string {
+	env := append([]string(nil), d.RunOptions.Env...)
+	sort.Strings(env)
+	ports := append([]string(nil), d.RunOptions.Ports...)
+	sort.Strings(ports)
+
+	h := sha256.New()
+	for _, part := range [][]string{
+		{d.RunOptions.ImageRepo, d.RunOptions.ImageTag, d.RunOptions.NetworkID, d.RunOptions.Platform},
+		{
+			strconv.FormatInt(d.RunOptions.MemoryLimit, 10),
+			strconv.FormatInt(d.RunOptions.CPUShares, 10),
+			strconv.FormatInt(d.RunOptions.PidsLimit, 10),
+		},
+		env,
+		d.RunOptions.Cmd,
+		ports,
+		d.RunOptions.Networks,
+	} {
+		fmt.Fprintf(h, "%q\n", part)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func reuseDir(key string) string {
+	return filepath.Join(os.TempDir(), "vault-docker-reuse", key)
+}
+
+// startOrReuse returns a running container matching this runner's
+// configuration, starting one if none exists. The returned release func drops
+// this process's reference; the container itself is left running so later
+// test binaries can pick it up, and is removed by sweepIdle once it has had
+// no references for the idle timeout.
+func (d *Runner) startOrReuse(ctx context.Context) (*types.ContainerJSON, []string, func(), error) {
+	d.sweepIdle(ctx)
+
+	key := d.reuseKey()
+	dir := reuseDir(key)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, nil, nil, err
+	}
+
+	unlock, err := lockReuseDir(dir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer unlock()
+
+	container, addrs, err := d.findShared(ctx, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if container == nil {
+		opts := d.RunOptions
+		opts.Labels = make(map[string]string, len(d.RunOptions.Labels)+1)
+		for k, v := range d.RunOptions.Labels {
+			opts.Labels[k] = v
+		}
+		opts.Labels[reuseLabel] = key
+		// A shared container must outlive the runner that created it.
+		opts.DoNotAutoRemove = true
+
+		starter := *d
+		starter.RunOptions = opts
+		container, addrs, err = starter.Start(ctx)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	lease, err := acquireLease(dir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return container, addrs, func() { releaseLease(dir, lease) }, nil
+}
+
+// findShared returns the running container carrying the given reuse key, or
+// nil if there isn't one.
+func (d *Runner) findShared(ctx context.Context, key string) (*types.ContainerJSON, []string, error) {
+	containers, err := d.DockerAPI.ContainerList(ctx, types.ContainerListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("label", reuseLabel+"="+key),
+			filters.Arg("status", "running"),
+		),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(containers) == 0 {
+		return nil, nil, nil
+	}
+
+	inspect, err := d.DockerAPI.ContainerInspect(ctx, containers[0].ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	addrs, err := d.containerAddrs(&inspect, inspect.Config.Hostname)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &inspect, addrs, nil
+}
+
+// sweepIdle removes shared containers that no live process holds a
+// reference to and that have been idle for longer than the idle timeout.
+// Failures are ignored: sweeping is an optimization, not a requirement.
+func (d *Runner) sweepIdle(ctx context.Context) {
+	idle := d.RunOptions.ReuseIdleTimeout
+	if idle == 0 {
+		idle = defaultReuseIdleTimeout
+	}
+
+	containers, err := d.DockerAPI.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", reuseLabel)),
+	})
+	if err != nil {
+		return
+	}
+
+	for _, c := range containers {
+		key := c.Labels[reuseLabel]
+		if key == "" {
+			continue
+		}
+		dir := reuseDir(key)
+		if pruneLeases(dir) > 0 {
+			continue
+		}
+		if info, err := os.Stat(dir); err == nil && time.Since(info.ModTime()) < idle {
+			continue
+		}
+		err := d.DockerAPI.ContainerRemove(ctx, c.ID, types.ContainerRemoveOptions{Force: true})
+		if err == nil {
+			_ = os.RemoveAll(dir)
+		}
+	}
+}
+
+// lockReuseDir serializes lookups and starts for a given reuse key across
+// processes, so that two test binaries don't both start a container.
+func lockReuseDir(dir string) (func(), error) {
+	lockPath := filepath.Join(dir, "lock")
+	deadline := time.Now().Add(reuseLockTimeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			f.Close()
+			return func() { _ = os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, statErr := os.Stat(lockPath); statErr == nil && time.Since(info.ModTime()) > reuseLockTimeout {
+			// Left behind by a process that died while holding it.
+			_ = os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for container reuse lock %s", lockPath)
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// acquireLease records a reference to the shared container on behalf of this
+// process. Leases are files named after the owning pid.
+func acquireLease(dir string) (string, error) {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", err
+	}
+	lease := filepath.Join(dir, fmt.Sprintf("lease-%d-%s", os.Getpid(), id))
+	if err := ioutil.WriteFile(lease, nil, 0o600); err != nil {
+		return "", err
+	}
+	return lease, nil
+}
+
+// releaseLease drops a reference and bumps the directory's mtime, which
+// sweepIdle uses as the start of the idle period.
+func releaseLease(dir, lease string) {
+	_ = os.Remove(lease)
+	now := time.Now()
+	_ = os.Chtimes(dir, now, now)
+}
+
+// pruneLeases removes leases held by processes that no longer exist, and
+// returns the number of leases remaining.
+func pruneLeases(dir string) int {
+	dirInfo, err := os.Stat(dir)
+	if err != nil {
+		return 0
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+
+	var live, removed int
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), "lease-") {
+			continue
+		}
+		pieces := strings.SplitN(strings.TrimPrefix(e.Name(), "lease-"), "-", 2)
+		pid, err := strconv.Atoi(pieces[0])
+		if err == nil && processAlive(pid) {
+			live++
+			continue
+		}
+		if os.Remove(filepath.Join(dir, e.Name())) == nil {
+			removed++
+		}
+	}
+	if removed > 0 {
+		// Removing stale leases shouldn't reset the idle clock.
+		_ = os.Chtimes(dir, dirInfo.ModTime(), dirInfo.ModTime())
+	}
+	return live
+}
+
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// FindProcess fails on Windows if the process doesn't exist.
+		return true
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
@@ -0,0 +1,84 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// snapshotRepoPrefix names images created by Snapshot. The localhost
+// registry ensures neither engine ever tries to pull them.
+const snapshotRepoPrefix = "localhost/vault-test-snapshot/"
+
+// snapshotImage returns the repo and tag of the snapshot image for key. The
+// tag includes a hash of the runner's configuration, so that snapshots taken
+// from a different image version or environment are never used.
+func (d *Runner) snapshotImage(key string) (string, string) {
+	return snapshotRepoPrefix + d.RunOptions.ContainerName, key + "-" + d.reuseKey()
+}
+
+// Snapshot commits the current filesystem of the container to an image,
+// from which StartServiceFromSnapshot can later start new containers. Note
+// that the contents of volumes, including those declared by the image (e.g.
+// the data directory of the official Postgres image), are not included.
+func (d *Runner) Snapshot(ctx context.Context, containerID, key string) (string, error) {
+	repo, tag := d.snapshotImage(key)
+	ref := repo + ":" + tag
+
+	_, err := d.DockerAPI.ContainerCommit(ctx, containerID, types.ContainerCommitOptions{
+		Reference: ref,
+		Comment:   "vault test snapshot",
+		Pause:     true,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error committing container snapshot %s: %w", ref, err)
+	}
+	return ref, nil
+}
+
+// RemoveSnapshot removes the snapshot image for key, if there is one.
+func (d *Runner) RemoveSnapshot(ctx context.Context, key string) error {
+	repo, tag := d.snapshotImage(key)
+	_, err := d.DockerAPI.ImageRemove(ctx, repo+":"+tag, types.ImageRemoveOptions{Force: true})
+	if err != nil && !client.IsErrNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// StartServiceFromSnapshot starts the service from the snapshot image for
+// key if one exists. Otherwise it starts the service as usual, runs
+// initialize against it, and then snapshots it, so that later runs can skip
+// the expensive initialization.
+func (d *Runner) StartServiceFromSnapshot(ctx context.Context, key string, initialize func(context.Context, *Service) error, connect ServiceAdapter) (*Service, error) {
+	repo, tag := d.snapshotImage(key)
+	if _, _, err := d.DockerAPI.ImageInspectWithRaw(ctx, repo+":"+tag); err == nil {
+		restored := *d
+		restored.RunOptions.ImageRepo = repo
+		restored.RunOptions.ImageTag = tag
+		return restored.StartService(ctx, connect)
+	} else if !client.IsErrNotFound(err) {
+		return nil, err
+	}
+
+	svc, err := d.StartService(ctx, connect)
+	if err != nil {
+		return nil, err
+	}
+	if err := initialize(ctx, svc); err != nil {
+		svc.Cleanup()
+		return nil, fmt.Errorf("error initializing container before snapshot: %w", err)
+	}
+	if _, err := d.Snapshot(ctx, svc.Container.ID, key); err != nil {
+		svc.Cleanup()
+		return nil, err
+	}
+	return svc, nil
+}
+
+func isSnapshotImage(repo string) bool {
+	return strings.HasPrefix(repo, snapshotRepoPrefix)
+}
@@ -1,14 +1,15 @@
 package docker
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/url"
 	"os"
+	"path"
 	"strconv"
 	"strings"
 	"time"
@@ -20,12 +21,15 @@ import (
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/archive"
 	"github.com/docker/go-connections/nat"
-	"github.com/hashicorp/go-uuid"
 )
 
 type Runner struct {
 	DockerAPI  *client.Client
 	RunOptions RunOptions
+
+	// Podman is set when the engine is Podman rather than Docker; a few
+	// behaviors differ between the two.
+	Podman bool
 }
 
 type RunOptions struct {
@@ -38,13 +42,71 @@ type RunOptions struct {
 	CopyFromTo      map[string]string
 	Ports           []string
 	DoNotAutoRemove bool
-	AuthUsername    string
-	AuthPassword    string
-	LogConsumer     func(string)
+	// AuthUsername and AuthPassword are used to pull the image. If unset,
+	// credentials for the image's registry are looked up in the local docker
+	// configuration (including credential helpers), as the docker CLI would.
+	AuthUsername string
+	AuthPassword string
+	// RegistryMirror, if set, is a registry and path prefix through which
+	// Docker Hub images are pulled instead, e.g. "mirror.example.com/hub";
+	// "postgres" is then pulled as "mirror.example.com/hub/library/postgres".
+	// The VAULT_TEST_DOCKER_REGISTRY_MIRROR environment variable overrides
+	// it.
+	RegistryMirror string
+
+	// LogConsumer, if set, is passed the container's complete output when
+	// the container is cleaned up.
+	LogConsumer func(string)
+	// LogStdout and LogStderr, if set, receive the container's output as it
+	// is produced. See TestLogWriter.
+	LogStdout io.Writer
+	LogStderr io.Writer
+
+	// Labels are applied to the container.
+	Labels map[string]string
+
+	// Reusable allows the container to be shared with other test binaries
+	// started with an identical configuration, when VAULT_TEST_DOCKER_REUSE
+	// is set in the environment. Cleanup then only releases this process's
+	// reference; the container is removed once it has been unreferenced for
+	// ReuseIdleTimeout (default 10 minutes), the next time a reusable
+	// container is requested. Only use this for services whose tests don't
+	// depend on starting from a pristine state.
+	Reusable         bool
+	ReuseIdleTimeout time.Duration
+
+	// MemoryLimit is the container's memory limit in bytes, swap included.
+	// CPUShares is its CPU weight relative to other containers (the engine
+	// default is 1024). PidsLimit caps the number of processes. Zero values
+	// leave the engine defaults in place.
+	MemoryLimit int64
+	CPUShares   int64
+	PidsLimit   int64
+
+	// Networks are additional networks to attach the container to, e.g. ones
+	// made with CreateNetwork. Unlike NetworkID, they don't change the
+	// addresses handed to the ServiceAdapter, which remain the host-mapped
+	// ports. Other containers on these networks can reach this one using
+	// ContainerName as a hostname.
+	Networks []string
+
+	// Platform selects the image variant to run, e.g. "linux/amd64". By
+	// default the engine's native platform is used, falling back to
+	// linux/amd64 (under emulation) for images that lack a native variant.
+	// The VAULT_TEST_DOCKER_PLATFORM environment variable overrides it.
+	Platform string
+	// ArchImageTags maps architectures (using Go's names, e.g. "arm64") to
+	// image tags to use instead of ImageTag, for images that publish
+	// per-architecture tags rather than multi-platform manifests.
+	ArchImageTags map[string]string
+
+	// ReadyTimeout bounds how long StartService waits for the service to
+	// become ready. Defaults to 2 minutes.
+	ReadyTimeout time.Duration
 }
 
 func NewServiceRunner(opts RunOptions) (*Runner, error) {
-	dapi, err := client.NewClientWithOpts(client.FromEnv, client.WithVersion("1.39"))
+	dapi, err := newDockerClient()
 	if err != nil {
 		return nil, err
 	}
@@ -63,6 +125,7 @@ func NewServiceRunner(opts RunOptions) (*Runner, error) {
 	return &Runner{
 		DockerAPI:  dapi,
 		RunOptions: opts,
+		Podman:     IsPodman(context.Background(), dapi),
 	}, nil
 }
 
@@ -129,12 +192,27 @@ func (s ServiceURL) URL() *url.URL {
 // connection string (typically a URL) and nil, or empty string and an error.
 type ServiceAdapter func(ctx context.Context, host string, port int) (ServiceConfig, error)
 
+// StartService starts the container and waits until connect succeeds. If
+// connect is nil, the image's HEALTHCHECK is used to determine readiness
+// instead, and the returned config is the address of the first port.
 func (d *Runner) StartService(ctx context.Context, connect ServiceAdapter) (*Service, error) {
-	container, hostIPs, err := d.Start(context.Background())
+	var container *types.ContainerJSON
+	var hostIPs []string
+	var release func()
+	var err error
+	if d.reuseEnabled() {
+		container, hostIPs, release, err = d.startOrReuse(context.Background())
+	} else {
+		container, hostIPs, err = d.Start(context.Background())
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	if d.RunOptions.LogStdout != nil || d.RunOptions.LogStderr != nil {
+		go d.streamLogs(container.ID)
+	}
+
 	cleanup := func() {
 		if d.RunOptions.LogConsumer != nil {
 			rc, err := d.DockerAPI.ContainerLogs(ctx, container.ID, types.ContainerLogsOptions{
@@ -153,9 +231,17 @@ func (d *Runner) StartService(ctx context.Context, connect ServiceAdapter) (*Ser
 			}
 		}
 
+		if release != nil {
+			release()
+			return
+		}
+
 		for i := 0; i < 10; i++ {
 			err := d.DockerAPI.ContainerRemove(ctx, container.ID, types.ContainerRemoveOptions{Force: true})
-			if err == nil {
+			if err == nil || client.IsErrNotFound(err) {
+				// Podman removes auto-remove containers as soon as they
+				// stop, so the container may already be gone.
+				unregisterContainer(container.ID)
 				return
 			}
 			time.Sleep(1 * time.Second)
@@ -165,6 +251,13 @@ func (d *Runner) StartService(ctx context.Context, connect ServiceAdapter) (*Ser
 	bo := backoff.NewExponentialBackOff()
 	bo.MaxInterval = time.Second * 5
 	bo.MaxElapsedTime = 2 * time.Minute
+	if d.RunOptions.ReadyTimeout > 0 {
+		bo.MaxElapsedTime = d.RunOptions.ReadyTimeout
+	}
+
+	if connect == nil {
+		connect = d.healthCheckAdapter(container.ID)
+	}
 
 	pieces := strings.Split(hostIPs[0], ":")
 	portInt, err := strconv.Atoi(pieces[1])
@@ -186,35 +279,75 @@ func (d *Runner) StartService(ctx context.Context, connect ServiceAdapter) (*Ser
 	}, bo)
 
 	if err != nil {
-		if !d.RunOptions.DoNotAutoRemove {
+		// Without the container's output, a service that never came up is
+		// nearly impossible to diagnose from CI logs.
+		if tail, logErr := d.tailLogs(ctx, container.ID, startFailureLogLines); logErr == nil && tail != "" {
+			err = fmt.Errorf("%w; last %d lines of container output:\n%s", err, startFailureLogLines, tail)
+		}
+		if inspect, inspectErr := d.DockerAPI.ContainerInspect(ctx, container.ID); inspectErr == nil && inspect.State != nil && inspect.State.OOMKilled {
+			err = fmt.Errorf("%w; container was killed for exceeding its memory limit", err)
+		}
+		if release != nil {
+			// Don't leave a broken container behind for others to reuse.
+			release()
+			_ = d.DockerAPI.ContainerRemove(ctx, container.ID, types.ContainerRemoveOptions{Force: true})
+		} else if !d.RunOptions.DoNotAutoRemove {
 			cleanup()
 		}
 		return nil, err
 	}
 
+	portAddrs := make(map[string]string, len(hostIPs))
+	for i, addr := range hostIPs {
+		portAddrs[d.RunOptions.Ports[i]] = addr
+	}
+
 	return &Service{
-		Config:  config,
-		Cleanup: cleanup,
+		Config:    config,
+		Cleanup:   cleanup,
+		Container: container,
+		portAddrs: portAddrs,
 	}, nil
 }
 
 type Service struct {
-	Config  ServiceConfig
-	Cleanup func()
+	Config    ServiceConfig
+	Cleanup   func()
+	Container *types.ContainerJSON
+
+	portAddrs map[string]string
+}
+
+// MappedAddress returns the host:port address at which the given container
+// port (e.g., "8200/tcp") can be reached. Only the first port is handed to
+// the ServiceAdapter; this allows helpers exposing several ports to find the
+// rest.
+func (s *Service) MappedAddress(port string) (string, error) {
+	addr, ok := s.portAddrs[port]
+	if !ok {
+		return "", fmt.Errorf("no address found for port %s", port)
+	}
+	return addr, nil
 }
 
 func (d *Runner) Start(ctx context.Context) (*types.ContainerJSON, []string, error) {
-	suffix, err := uuid.GenerateUUID()
+	name, err := resourceName(d.RunOptions.ContainerName)
 	if err != nil {
 		return nil, nil, err
 	}
-	name := d.RunOptions.ContainerName + "-" + suffix
+
+	imageRepo := d.mirrorImageRepo(d.RunOptions.ImageRepo)
+	if d.Podman {
+		imageRepo = qualifyImageRepo(imageRepo)
+	}
+	imageTag, platform := d.resolveImage(ctx)
 
 	cfg := &container.Config{
 		Hostname: name,
-		Image:    fmt.Sprintf("%s:%s", d.RunOptions.ImageRepo, d.RunOptions.ImageTag),
+		Image:    fmt.Sprintf("%s:%s", imageRepo, imageTag),
 		Env:      d.RunOptions.Env,
 		Cmd:      d.RunOptions.Cmd,
+		Labels:   resourceLabels(d.RunOptions.Labels),
 	}
 	if len(d.RunOptions.Ports) > 0 {
 		cfg.ExposedPorts = make(map[nat.Port]struct{})
@@ -227,6 +360,19 @@ func (d *Runner) Start(ctx context.Context) (*types.ContainerJSON, []string, err
 		AutoRemove:      !d.RunOptions.DoNotAutoRemove,
 		PublishAllPorts: true,
 	}
+	if d.RunOptions.MemoryLimit > 0 {
+		hostConfig.Memory = d.RunOptions.MemoryLimit
+		// Disallow swap so that exceeding the limit reliably OOMs instead of
+		// slowing down depending on the host.
+		hostConfig.MemorySwap = d.RunOptions.MemoryLimit
+	}
+	if d.RunOptions.CPUShares > 0 {
+		hostConfig.CPUShares = d.RunOptions.CPUShares
+	}
+	if d.RunOptions.PidsLimit > 0 {
+		pids := d.RunOptions.PidsLimit
+		hostConfig.PidsLimit = &pids
+	}
 
 	netConfig := &network.NetworkingConfig{}
 	if d.RunOptions.NetworkID != "" {
@@ -236,27 +382,31 @@ func (d *Runner) Start(ctx context.Context) (*types.ContainerJSON, []string, err
 	}
 
 	// best-effort pull
-	var opts types.ImageCreateOptions
-	if d.RunOptions.AuthUsername != "" && d.RunOptions.AuthPassword != "" {
-		var buf bytes.Buffer
-		auth := map[string]string{
-			"username": d.RunOptions.AuthUsername,
-			"password": d.RunOptions.AuthPassword,
-		}
-		if err := json.NewEncoder(&buf).Encode(auth); err != nil {
+	if !isSnapshotImage(imageRepo) {
+		auth, err := d.registryAuth(imageRepo)
+		if err != nil {
 			return nil, nil, err
 		}
-		opts.RegistryAuth = base64.URLEncoding.EncodeToString(buf.Bytes())
-	}
-	resp, _ := d.DockerAPI.ImageCreate(ctx, cfg.Image, opts)
-	if resp != nil {
-		_, _ = ioutil.ReadAll(resp)
+		d.pullImage(ctx, cfg.Image, platform, types.ImageCreateOptions{RegistryAuth: auth})
 	}
 
 	c, err := d.DockerAPI.ContainerCreate(ctx, cfg, hostConfig, netConfig, nil, cfg.Hostname)
 	if err != nil {
 		return nil, nil, fmt.Errorf("container create failed: %v", err)
 	}
+	if _, shared := d.RunOptions.Labels[reuseLabel]; !shared {
+		registerContainer(c.ID)
+	}
+
+	for _, networkID := range d.RunOptions.Networks {
+		err := d.DockerAPI.NetworkConnect(ctx, networkID, c.ID, &network.EndpointSettings{
+			Aliases: []string{d.RunOptions.ContainerName},
+		})
+		if err != nil {
+			_ = d.DockerAPI.ContainerRemove(ctx, c.ID, types.ContainerRemoveOptions{})
+			return nil, nil, fmt.Errorf("error connecting container to network %s: %v", networkID, err)
+		}
+	}
 
 	for from, to := range d.RunOptions.CopyFromTo {
 		if err := copyToContainer(ctx, d.DockerAPI, c.ID, from, to); err != nil {
@@ -277,25 +427,35 @@ func (d *Runner) Start(ctx context.Context) (*types.ContainerJSON, []string, err
 		return nil, nil, err
 	}
 
+	addrs, err := d.containerAddrs(&inspect, cfg.Hostname)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &inspect, addrs, nil
+}
+
+// containerAddrs returns the address at which each of RunOptions.Ports can be
+// reached, in the same order.
+func (d *Runner) containerAddrs(inspect *types.ContainerJSON, hostname string) ([]string, error) {
 	var addrs []string
 	for _, port := range d.RunOptions.Ports {
 		pieces := strings.Split(port, "/")
 		if len(pieces) < 2 {
-			return nil, nil, fmt.Errorf("expected port of the form 1234/tcp, got: %s", port)
+			return nil, fmt.Errorf("expected port of the form 1234/tcp, got: %s", port)
 		}
 		if d.RunOptions.NetworkID != "" {
-			addrs = append(addrs, fmt.Sprintf("%s:%s", cfg.Hostname, pieces[0]))
+			addrs = append(addrs, fmt.Sprintf("%s:%s", hostname, pieces[0]))
 		} else {
 			mapped, ok := inspect.NetworkSettings.Ports[nat.Port(port)]
 			if !ok || len(mapped) == 0 {
-				return nil, nil, fmt.Errorf("no port mapping found for %s", port)
+				return nil, fmt.Errorf("no port mapping found for %s", port)
 			}
 
 			addrs = append(addrs, fmt.Sprintf("127.0.0.1:%s", mapped[0].HostPort))
 		}
 	}
-
-	return &inspect, addrs, nil
+	return addrs, nil
 }
 
 func copyToContainer(ctx context.Context, dapi *client.Client, containerID, from, to string) error {
@@ -324,3 +484,36 @@ func copyToContainer(ctx context.Context, dapi *client.Client, containerID, from
 
 	return nil
 }
+
+// CopyTo writes content to destPath inside the container, creating or
+// replacing the file. The container may be running. Unlike bind mounts, this
+// works with remote docker daemons. The parent directory must already exist.
+func (d *Runner) CopyTo(ctx context.Context, containerID, destPath string, content []byte) error {
+	if !path.IsAbs(destPath) {
+		return fmt.Errorf("destination path must be absolute, got: %s", destPath)
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	hdr := &tar.Header{
+		Name:    path.Base(destPath),
+		Mode:    0o644,
+		Size:    int64(len(content)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(content); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	err := d.DockerAPI.CopyToContainer(ctx, containerID, path.Dir(destPath), &buf, types.CopyToContainerOptions{})
+	if err != nil {
+		return fmt.Errorf("error copying to %q: %v", destPath, err)
+	}
+	return nil
+}
@@ -8,9 +8,9 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/defaults"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/helper/testhelpers/docker"
 )
 
@@ -19,17 +19,39 @@ type Config struct {
 	AccessKeyID     string
 	SecretAccessKey string
 	Region          string
+	Bucket          string
 }
 
-const (
-	accessKeyID = "min-access-key"
-	secretKey   = "min-secret-key"
-)
+const defaultRegion = "us-east-1"
 
+// PrepareTestContainer creates a MinIO docker container with freshly
+// generated credentials and an empty, pre-created bucket. The returned Config
+// contains everything needed to point an S3 client at the container.
 func PrepareTestContainer(t *testing.T, version string) (func(), *Config) {
+	bucket, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatalf("Could not generate MinIO bucket name: %s", err)
+	}
+
+	return PrepareTestContainerWithBucket(t, version, "vault-"+bucket)
+}
+
+// PrepareTestContainerWithBucket is like PrepareTestContainer, but allows
+// the caller to choose the name of the pre-created bucket.
+func PrepareTestContainerWithBucket(t *testing.T, version string, bucket string) (func(), *Config) {
 	if version == "" {
 		version = "latest"
 	}
+
+	accessKeyID, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatalf("Could not generate MinIO access key: %s", err)
+	}
+	secretKey, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatalf("Could not generate MinIO secret key: %s", err)
+	}
+
 	runner, err := docker.NewServiceRunner(docker.RunOptions{
 		ContainerName: "minio",
 		ImageRepo:     "minio/minio",
@@ -37,6 +59,8 @@ func PrepareTestContainer(t *testing.T, version string) (func(), *Config) {
 		Env: []string{
 			"MINIO_ACCESS_KEY=" + accessKeyID,
 			"MINIO_SECRET_KEY=" + secretKey,
+			"MINIO_ROOT_USER=" + accessKeyID,
+			"MINIO_ROOT_PASSWORD=" + secretKey,
 		},
 		Cmd:   []string{"server", "/data"},
 		Ports: []string{"9000/tcp"},
@@ -45,7 +69,7 @@ func PrepareTestContainer(t *testing.T, version string) (func(), *Config) {
 		t.Fatalf("Could not start docker Minio: %s", err)
 	}
 
-	svc, err := runner.StartService(context.Background(), connectMinio)
+	svc, err := runner.StartService(context.Background(), connectMinio(accessKeyID, secretKey, bucket))
 	if err != nil {
 		t.Fatalf("Could not start docker Minio: %s", err)
 	}
@@ -54,53 +78,61 @@ func PrepareTestContainer(t *testing.T, version string) (func(), *Config) {
 		Endpoint:        svc.Config.URL().Host,
 		AccessKeyID:     accessKeyID,
 		SecretAccessKey: secretKey,
-		Region:          "us-east-1",
+		Region:          defaultRegion,
+		Bucket:          bucket,
 	}
 }
 
-func connectMinio(ctx context.Context, host string, port int) (docker.ServiceConfig, error) {
-	u := url.URL{
-		Scheme: "s3",
-		Host:   fmt.Sprintf("%s:%d", host, port),
-	}
+func connectMinio(accessKeyID, secretKey, bucket string) docker.ServiceAdapter {
+	return func(ctx context.Context, host string, port int) (docker.ServiceConfig, error) {
+		u := url.URL{
+			Scheme: "s3",
+			Host:   fmt.Sprintf("%s:%d", host, port),
+		}
 
-	c := &Config{
-		Endpoint:        u.Host,
-		AccessKeyID:     accessKeyID,
-		SecretAccessKey: secretKey,
-		Region:          "us-east-1",
-	}
-	s3conn, err := c.Conn()
-	if err != nil {
-		return nil, err
-	}
+		c := &Config{
+			Endpoint:        u.Host,
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: secretKey,
+			Region:          defaultRegion,
+		}
+		s3conn, err := c.Conn()
+		if err != nil {
+			return nil, err
+		}
 
-	_, err = s3conn.ListBuckets(&s3.ListBucketsInput{})
-	if err != nil {
-		return nil, err
-	}
+		_, err = s3conn.ListBuckets(&s3.ListBucketsInput{})
+		if err != nil {
+			return nil, err
+		}
+
+		if bucket != "" {
+			_, err = s3conn.CreateBucketWithContext(ctx, &s3.CreateBucketInput{
+				Bucket: aws.String(bucket),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error creating bucket %q: %w", bucket, err)
+			}
+		}
 
-	return docker.NewServiceURL(u), nil
+		return docker.NewServiceURL(u), nil
+	}
 }
 
+// Conn returns an S3 client for the MinIO container described by this
+// Config.
 func (c *Config) Conn() (*s3.S3, error) {
+	region := c.Region
+	if region == "" {
+		region = defaultRegion
+	}
+
 	cfg := &aws.Config{
 		DisableSSL:       aws.Bool(true),
-		Region:           aws.String("us-east-1"),
+		Region:           aws.String(region),
 		Endpoint:         aws.String(c.Endpoint),
 		S3ForcePathStyle: aws.Bool(true),
-		Credentials: credentials.NewChainCredentials(
-			[]credentials.Provider{
-				&credentials.StaticProvider{
-					Value: credentials.Value{
-						AccessKeyID:     accessKeyID,
-						SecretAccessKey: secretKey,
-					},
-				},
-				&credentials.EnvProvider{},
-				&credentials.SharedCredentialsProvider{},
-				defaults.RemoteCredProvider(*(defaults.Config()), defaults.Handlers()),
-			}),
+		Credentials:      credentials.NewStaticCredentials(c.AccessKeyID, c.SecretAccessKey, ""),
 	}
 
 	sess, err := session.NewSession(cfg)
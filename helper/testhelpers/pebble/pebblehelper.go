@@ -0,0 +1,191 @@
+package pebble
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/testhelpers/docker"
+)
+
+const (
+	acmePort       = "14000/tcp"
+	managementPort = "15000/tcp"
+	configPath     = "/test/config/vault-pebble.json"
+)
+
+type Config struct {
+	docker.ServiceURL
+
+	// DirectoryURL is the ACME directory URL clients should be pointed at.
+	DirectoryURL string
+	// RootCA is the PEM-encoded root certificate Pebble issues from. It is
+	// regenerated on every Pebble start.
+	RootCA string
+	// ManagementURL is the base URL of Pebble's management interface.
+	ManagementURL string
+}
+
+type Options struct {
+	// HTTPPort and TLSPort are the ports Pebble's validation authority will
+	// connect to for http-01 and tls-alpn-01 challenges respectively.
+	// Defaults are 5002 and 5001, matching Pebble's upstream config.
+	HTTPPort int
+	TLSPort  int
+
+	// AlwaysValid skips challenge validation entirely, which is useful when
+	// the system under test can't be reached from the Pebble container.
+	AlwaysValid bool
+
+	// NetworkID places the container on the given docker network so that
+	// challenges can be validated against other containers.
+	NetworkID string
+}
+
+// HTTPClient returns a client that trusts Pebble's self-signed
+// ACME/management TLS certificate. This is not the same certificate as
+// RootCA.
+func (c *Config) HTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		},
+	}
+}
+
+// PrepareTestContainer launches the Pebble ACME test server. If version is
+// empty, "latest" is used.
+func PrepareTestContainer(t *testing.T, version string, opts Options) (func(), *Config) {
+	t.Helper()
+
+	if version == "" {
+		version = "latest"
+	}
+	if opts.HTTPPort == 0 {
+		opts.HTTPPort = 5002
+	}
+	if opts.TLSPort == 0 {
+		opts.TLSPort = 5001
+	}
+
+	pebbleConfig := map[string]interface{}{
+		"pebble": map[string]interface{}{
+			"listenAddress":                  "0.0.0.0:14000",
+			"managementListenAddress":        "0.0.0.0:15000",
+			"certificate":                    "test/certs/localhost/cert.pem",
+			"privateKey":                     "test/certs/localhost/key.pem",
+			"httpPort":                       opts.HTTPPort,
+			"tlsPort":                        opts.TLSPort,
+			"ocspResponderURL":               "",
+			"externalAccountBindingRequired": false,
+		},
+	}
+	configBytes, err := json.Marshal(pebbleConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configDir, err := ioutil.TempDir("", "pebble-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(configDir)
+
+	localConfig := filepath.Join(configDir, "vault-pebble.json")
+	if err := ioutil.WriteFile(localConfig, configBytes, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	env := []string{"PEBBLE_VA_NOSLEEP=1"}
+	if opts.AlwaysValid {
+		env = append(env, "PEBBLE_VA_ALWAYS_VALID=1")
+	}
+
+	runner, err := docker.NewServiceRunner(docker.RunOptions{
+		ContainerName: "pebble",
+		ImageRepo:     "letsencrypt/pebble",
+		ImageTag:      version,
+		Env:           env,
+		Cmd:           []string{"pebble", "-config", configPath},
+		CopyFromTo:    map[string]string{localConfig: configPath},
+		NetworkID:     opts.NetworkID,
+		Ports:         []string{acmePort, managementPort},
+	})
+	if err != nil {
+		t.Fatalf("Could not start docker Pebble: %s", err)
+	}
+
+	svc, err := runner.StartService(context.Background(), func(ctx context.Context, host string, port int) (docker.ServiceConfig, error) {
+		c := &Config{
+			ServiceURL:   *docker.NewServiceURL(url.URL{Scheme: "https", Host: fmt.Sprintf("%s:%d", host, port)}),
+			DirectoryURL: fmt.Sprintf("https://%s:%d/dir", host, port),
+		}
+
+		resp, err := c.HTTPClient().Get(c.DirectoryURL)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status fetching ACME directory: %v", resp.Status)
+		}
+
+		return c, nil
+	})
+	if err != nil {
+		t.Fatalf("Could not start docker Pebble: %s", err)
+	}
+
+	config := svc.Config.(*Config)
+
+	// StartService only hands us the first port's mapping; look up the
+	// management port so we can fetch the root.
+	mgmtHost, err := svc.MappedAddress(managementPort)
+	if err != nil {
+		svc.Cleanup()
+		t.Fatalf("Could not find Pebble management port: %s", err)
+	}
+	config.ManagementURL = "https://" + mgmtHost
+
+	rootCA, err := fetchRoot(config)
+	if err != nil {
+		svc.Cleanup()
+		t.Fatalf("Could not fetch Pebble root CA: %s", err)
+	}
+	config.RootCA = rootCA
+
+	return svc.Cleanup, config
+}
+
+func fetchRoot(c *Config) (string, error) {
+	resp, err := c.HTTPClient().Get(c.ManagementURL + "/roots/0")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %v: %s", resp.Status, body)
+	}
+
+	if block, _ := pem.Decode(body); block == nil || block.Type != "CERTIFICATE" {
+		return "", fmt.Errorf("response did not contain a PEM certificate")
+	}
+
+	return string(body), nil
+}
@@ -0,0 +1,283 @@
+// Package pki builds PKI hierarchies (roots, intermediates, cross-signed
+// intermediates and leaves) on a PKI mount of a test cluster, so that tests
+// of revocation and chain building don't need to hand-roll them.
+package pki
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Hierarchy creates issuers and leaves on a single PKI mount.
+type Hierarchy struct {
+	t      testing.TB
+	client *api.Client
+	Mount  string
+
+	roles map[string]string
+}
+
+// Issuer is an issuer created by a Hierarchy.
+type Issuer struct {
+	ID    string
+	Name  string
+	KeyID string
+	Cert  *x509.Certificate
+	PEM   string
+	// Parent is the issuer that signed this one, or nil for roots.
+	Parent *Issuer
+}
+
+// Leaf is a leaf certificate issued by a Hierarchy.
+type Leaf struct {
+	Serial     string
+	Cert       *x509.Certificate
+	PEM        string
+	PrivateKey string
+	Issuer     *Issuer
+}
+
+// RootOptions customize the roots created by Hierarchy.Root.
+type RootOptions struct {
+	// TTL of the root certificate. Defaults to 10 years.
+	TTL time.Duration
+	// KeyType of the root's key. Defaults to "ec".
+	KeyType string
+}
+
+// New returns a Hierarchy for the given mount, enabling a PKI secrets engine
+// there if nothing is mounted at that path yet.
+func New(t testing.TB, client *api.Client, mount string) *Hierarchy {
+	t.Helper()
+
+	mount = strings.Trim(mount, "/")
+	mounts, err := client.Sys().ListMounts()
+	if err != nil {
+		t.Fatalf("unable to list mounts: %v", err)
+	}
+	if _, ok := mounts[mount+"/"]; !ok {
+		err := client.Sys().Mount(mount, &api.MountInput{
+			Type: "pki",
+			Config: api.MountConfigInput{
+				MaxLeaseTTL: "87600h",
+			},
+		})
+		if err != nil {
+			t.Fatalf("unable to mount pki at %v: %v", mount, err)
+		}
+	}
+
+	return &Hierarchy{
+		t:      t,
+		client: client,
+		Mount:  mount,
+		roles:  make(map[string]string),
+	}
+}
+
+// Root generates a self-signed root issuer with the given name, which is
+// also used as its common name.
+func (h *Hierarchy) Root(name string, opts *RootOptions) *Issuer {
+	h.t.Helper()
+
+	if opts == nil {
+		opts = &RootOptions{}
+	}
+	ttl := opts.TTL
+	if ttl == 0 {
+		ttl = 10 * 365 * 24 * time.Hour
+	}
+	keyType := opts.KeyType
+	if keyType == "" {
+		keyType = "ec"
+	}
+
+	resp := h.write("root/generate/internal", map[string]interface{}{
+		"common_name": name,
+		"issuer_name": name,
+		"key_name":    name,
+		"key_type":    keyType,
+		"ttl":         ttl.String(),
+	})
+
+	return h.newIssuer(resp.Data["issuer_id"], resp.Data["key_id"], name, resp.Data["certificate"], nil)
+}
+
+// Intermediate generates a new key and an intermediate issuer using it,
+// signed by parent.
+func (h *Hierarchy) Intermediate(parent *Issuer, name string) *Issuer {
+	h.t.Helper()
+
+	resp := h.write("intermediate/generate/internal", map[string]interface{}{
+		"common_name": name,
+		"key_name":    name,
+	})
+	return h.signAndImport(parent, name, resp.Data["csr"], resp.Data["key_id"])
+}
+
+// CrossSign creates a new issuer sharing intermediate's key and subject, but
+// signed by otherParent instead of intermediate's parent.
+func (h *Hierarchy) CrossSign(intermediate, otherParent *Issuer, name string) *Issuer {
+	h.t.Helper()
+
+	resp := h.write("intermediate/generate/existing", map[string]interface{}{
+		"common_name": intermediate.Cert.Subject.CommonName,
+		"key_ref":     intermediate.KeyID,
+	})
+	return h.signAndImport(otherParent, name, resp.Data["csr"], intermediate.KeyID)
+}
+
+func (h *Hierarchy) signAndImport(parent *Issuer, name string, csr, keyID interface{}) *Issuer {
+	h.t.Helper()
+
+	signed := h.write("issuer/"+parent.ID+"/sign-intermediate", map[string]interface{}{
+		"csr":            csr,
+		"use_csr_values": true,
+		"ttl":            time.Until(parent.Cert.NotAfter).Truncate(time.Second).String(),
+	})
+
+	imported := h.write("intermediate/set-signed", map[string]interface{}{
+		"certificate": signed.Data["certificate"],
+	})
+	ids, ok := imported.Data["imported_issuers"].([]interface{})
+	if !ok || len(ids) != 1 {
+		h.t.Fatalf("expected exactly one imported issuer for %v, got: %v", name, imported.Data["imported_issuers"])
+	}
+
+	_, err := h.client.Logical().JSONMergePatch(context.Background(), h.path("issuer/"+ids[0].(string)), map[string]interface{}{
+		"issuer_name": name,
+	})
+	if err != nil {
+		h.t.Fatalf("unable to name issuer %v: %v", name, err)
+	}
+
+	return h.newIssuer(ids[0], keyID, name, signed.Data["certificate"], parent)
+}
+
+// Leaf issues a certificate for the given common name from issuer.
+func (h *Hierarchy) Leaf(issuer *Issuer, commonName string, ttl time.Duration) *Leaf {
+	h.t.Helper()
+
+	resp := h.write("issue/"+h.role(issuer), map[string]interface{}{
+		"common_name": commonName,
+		"ttl":         ttl.String(),
+	})
+
+	certPEM := resp.Data["certificate"].(string)
+	return &Leaf{
+		Serial:     resp.Data["serial_number"].(string),
+		Cert:       h.parseCert(certPEM),
+		PEM:        certPEM,
+		PrivateKey: resp.Data["private_key"].(string),
+		Issuer:     issuer,
+	}
+}
+
+// ExpiredLeaf issues a short-lived certificate from issuer and waits for it
+// to expire.
+func (h *Hierarchy) ExpiredLeaf(issuer *Issuer, commonName string) *Leaf {
+	h.t.Helper()
+
+	leaf := h.Leaf(issuer, commonName, 2*time.Second)
+	WaitForExpiry(leaf.Cert)
+	return leaf
+}
+
+// Revoke revokes the leaf, returning the revocation time reported by the
+// mount.
+func (h *Hierarchy) Revoke(leaf *Leaf) time.Time {
+	h.t.Helper()
+
+	resp := h.write("revoke", map[string]interface{}{
+		"serial_number": leaf.Serial,
+	})
+
+	revTime, err := resp.Data["revocation_time"].(json.Number).Int64()
+	if err != nil {
+		h.t.Fatalf("unable to parse revocation time of %v: %v", leaf.Serial, err)
+	}
+	return time.Unix(revTime, 0)
+}
+
+// WaitForExpiry sleeps until the certificate is no longer valid.
+func WaitForExpiry(cert *x509.Certificate) {
+	if d := time.Until(cert.NotAfter); d >= 0 {
+		// NotAfter is inclusive, at one second granularity.
+		time.Sleep(d + time.Second)
+	}
+}
+
+// role returns the name of a role issuing from the given issuer, creating it
+// on first use.
+func (h *Hierarchy) role(issuer *Issuer) string {
+	h.t.Helper()
+
+	if role, ok := h.roles[issuer.ID]; ok {
+		return role
+	}
+
+	role := "leaf-" + issuer.ID
+	_, err := h.client.Logical().Write(h.path("roles/"+role), map[string]interface{}{
+		"issuer_ref":        issuer.ID,
+		"allow_any_name":    true,
+		"enforce_hostnames": false,
+		"key_type":          "ec",
+		"max_ttl":           "8760h",
+	})
+	if err != nil {
+		h.t.Fatalf("unable to create role for issuer %v: %v", issuer.Name, err)
+	}
+	h.roles[issuer.ID] = role
+	return role
+}
+
+func (h *Hierarchy) newIssuer(id, keyID interface{}, name string, certPEM interface{}, parent *Issuer) *Issuer {
+	h.t.Helper()
+
+	return &Issuer{
+		ID:     id.(string),
+		Name:   name,
+		KeyID:  keyID.(string),
+		Cert:   h.parseCert(certPEM.(string)),
+		PEM:    certPEM.(string),
+		Parent: parent,
+	}
+}
+
+func (h *Hierarchy) parseCert(certPEM string) *x509.Certificate {
+	h.t.Helper()
+
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		h.t.Fatalf("unable to decode certificate PEM: %v", certPEM)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		h.t.Fatalf("unable to parse certificate: %v", err)
+	}
+	return cert
+}
+
+func (h *Hierarchy) path(p string) string {
+	return h.Mount + "/" + p
+}
+
+func (h *Hierarchy) write(p string, data map[string]interface{}) *api.Secret {
+	h.t.Helper()
+
+	resp, err := h.client.Logical().Write(h.path(p), data)
+	if err != nil {
+		h.t.Fatalf("error writing %v: %v", h.path(p), err)
+	}
+	if resp == nil || resp.Data == nil {
+		h.t.Fatalf("empty response writing %v", h.path(p))
+	}
+	return resp
+}
@@ -0,0 +1,64 @@
+package postgresql
+
+import (
+	"os"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/testhelpers/docker"
+)
+
+const (
+	pgbouncerImageRepo = "edoburu/pgbouncer"
+	pgbouncerImageTag  = "latest"
+	pgbouncerPort      = "6432"
+)
+
+// PrepareTestContainerWithPgBouncer starts a Postgres container with a
+// PgBouncer container in front of it, and returns a URL pointing at
+// PgBouncer. PgBouncer runs in transaction pooling mode, so consecutive
+// statements outside a transaction may be served by different server
+// connections, and session state such as prepared statements doesn't carry
+// over. Credentials are looked up in Postgres, so roles created by the test
+// can connect through PgBouncer too.
+func PrepareTestContainerWithPgBouncer(t *testing.T, version string) (func(), string) {
+	if os.Getenv("PG_URL") != "" {
+		t.Skip("PG_URL is set; PgBouncer tests require a Postgres container")
+	}
+
+	const password = "secret"
+
+	pgOpts := postgresRunOptions(t, version, password, "database")
+	pgOpts.ContainerName = "postgres"
+
+	compose := docker.StartCompose(t,
+		docker.ComposeService{
+			Name:       "postgres",
+			RunOptions: pgOpts,
+			Connect:    connectPostgres(password),
+		},
+		docker.ComposeService{
+			Name: "pgbouncer",
+			RunOptions: docker.RunOptions{
+				ContainerName: "pgbouncer",
+				ImageRepo:     pgbouncerImageRepo,
+				ImageTag:      pgbouncerImageTag,
+				Env: []string{
+					"DB_HOST=postgres",
+					"DB_USER=postgres",
+					"DB_PASSWORD=" + password,
+					"LISTEN_PORT=" + pgbouncerPort,
+					"POOL_MODE=transaction",
+					"AUTH_TYPE=md5",
+					"AUTH_USER=postgres",
+					"AUTH_QUERY=SELECT usename, passwd FROM pg_shadow WHERE usename=$1",
+				},
+				Ports:       []string{pgbouncerPort + "/tcp"},
+				LogConsumer: docker.FailureLogConsumer(t, 100),
+			},
+			Connect:   connectPostgres(password),
+			DependsOn: []string{"postgres"},
+		},
+	)
+
+	return compose.Cleanup, compose.Service("pgbouncer").Config.URL().String()
+}
@@ -7,8 +7,10 @@ import (
 	"net/url"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/helper/testhelpers/docker"
+	_ "github.com/jackc/pgx/v4/stdlib"
 )
 
 func PrepareTestContainer(t *testing.T, version string) (func(), string) {
@@ -19,34 +21,72 @@ func PrepareTestContainerWithPassword(t *testing.T, version, password string) (f
 	return prepareTestContainer(t, version, password, "database")
 }
 
+// PrepareTestContainerWithDB is like PrepareTestContainer, but also returns
+// an open, pinged connection pool to the database. The pool is closed by the
+// returned cleanup func, before the container is removed.
+func PrepareTestContainerWithDB(t *testing.T, version string) (func(), string, *sql.DB) {
+	cleanup, connURL := PrepareTestContainer(t, version)
+
+	db, err := sql.Open("pgx", connURL)
+	if err != nil {
+		cleanup()
+		t.Fatalf("Could not open connection to Postgres: %s", err)
+	}
+	// Keep the pool small so tests that leak connections fail quickly
+	// rather than exhausting the server.
+	db.SetMaxOpenConns(5)
+	db.SetMaxIdleConns(2)
+	db.SetConnMaxLifetime(time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		cleanup()
+		t.Fatalf("Could not ping Postgres: %s", err)
+	}
+
+	return func() {
+		db.Close()
+		cleanup()
+	}, connURL, db
+}
+
 func prepareTestContainer(t *testing.T, version, password, db string) (func(), string) {
 	if os.Getenv("PG_URL") != "" {
 		return func() {}, os.Getenv("PG_URL")
 	}
 
+	opts := postgresRunOptions(t, version, password, db)
+	opts.Reusable = true
+	runner, err := docker.NewServiceRunner(opts)
+	if err != nil {
+		t.Fatalf("Could not start docker Postgres: %s", err)
+	}
+
+	svc, err := runner.StartService(context.Background(), connectPostgres(password))
+	if err != nil {
+		t.Fatalf("Could not start docker Postgres: %s", err)
+	}
+
+	return svc.Cleanup, svc.Config.URL().String()
+}
+
+func postgresRunOptions(t *testing.T, version, password, db string) docker.RunOptions {
 	if version == "" {
 		version = "11"
 	}
 
-	runner, err := docker.NewServiceRunner(docker.RunOptions{
+	return docker.RunOptions{
 		ImageRepo: "postgres",
 		ImageTag:  version,
 		Env: []string{
 			"POSTGRES_PASSWORD=" + password,
 			"POSTGRES_DB=" + db,
 		},
-		Ports: []string{"5432/tcp"},
-	})
-	if err != nil {
-		t.Fatalf("Could not start docker Postgres: %s", err)
+		Ports:       []string{"5432/tcp"},
+		LogConsumer: docker.FailureLogConsumer(t, 100),
 	}
-
-	svc, err := runner.StartService(context.Background(), connectPostgres(password))
-	if err != nil {
-		t.Fatalf("Could not start docker Postgres: %s", err)
-	}
-
-	return svc.Cleanup, svc.Config.URL().String()
 }
 
 func connectPostgres(password string) docker.ServiceAdapter {
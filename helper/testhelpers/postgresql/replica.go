@@ -0,0 +1,151 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/testhelpers/docker"
+)
+
+const pgData = "/var/lib/postgresql/data"
+
+// allowReplicationScript is run by the primary's entrypoint when the database
+// is first initialized. The image's default pg_hba.conf doesn't cover
+// replication connections.
+const allowReplicationScript = `#!/bin/sh
+echo "host replication all all md5" >> "$PGDATA/pg_hba.conf"
+`
+
+// replicaScript clones the primary with pg_basebackup and starts Postgres as
+// a hot standby streaming from it.
+const replicaScript = `until pg_basebackup -h postgres-primary -U postgres -D "$PGDATA" -R -X stream; do
+  rm -rf "$PGDATA"/*
+  sleep 1
+done
+chown -R postgres:postgres "$PGDATA"
+chmod 0700 "$PGDATA"
+exec gosu postgres postgres -c hot_standby=on`
+
+// ReplicaSet is a Postgres primary with a physical streaming replica.
+type ReplicaSet struct {
+	PrimaryURL string
+	ReplicaURL string
+
+	compose *docker.Compose
+}
+
+// PrepareTestContainerWithReplica starts a Postgres primary and a streaming
+// replica of it. The replica is read-only until PromoteReplica is called.
+func PrepareTestContainerWithReplica(t *testing.T, version string) (func(), *ReplicaSet) {
+	if os.Getenv("PG_URL") != "" {
+		t.Skip("PG_URL is set; replication tests require Postgres containers")
+	}
+
+	const password = "secret"
+
+	initScript := filepath.Join(t.TempDir(), "allow-replication.sh")
+	if err := os.WriteFile(initScript, []byte(allowReplicationScript), 0o755); err != nil {
+		t.Fatalf("Could not write Postgres init script: %s", err)
+	}
+
+	primaryOpts := postgresRunOptions(t, version, password, "database")
+	primaryOpts.ContainerName = "postgres-primary"
+	primaryOpts.Cmd = []string{"postgres", "-c", "wal_level=replica", "-c", "max_wal_senders=10"}
+	primaryOpts.CopyFromTo = map[string]string{
+		initScript: "/docker-entrypoint-initdb.d/allow-replication.sh",
+	}
+
+	replicaOpts := postgresRunOptions(t, version, password, "database")
+	replicaOpts.ContainerName = "postgres-replica"
+	replicaOpts.Env = append(replicaOpts.Env, "PGPASSWORD="+password, "PGDATA="+pgData)
+	replicaOpts.Cmd = []string{"bash", "-c", replicaScript}
+
+	compose := docker.StartCompose(t,
+		docker.ComposeService{
+			Name:       "primary",
+			RunOptions: primaryOpts,
+			Connect:    connectPostgres(password),
+		},
+		docker.ComposeService{
+			Name:       "replica",
+			RunOptions: replicaOpts,
+			Connect:    connectReplica(password),
+			DependsOn:  []string{"primary"},
+		},
+	)
+
+	return compose.Cleanup, &ReplicaSet{
+		PrimaryURL: compose.Service("primary").Config.URL().String(),
+		ReplicaURL: compose.Service("replica").Config.URL().String(),
+		compose:    compose,
+	}
+}
+
+// PromoteReplica turns the replica into a primary, and waits until it
+// accepts writes. The original primary is left running, so callers
+// simulating a failover will usually want to stop using it.
+func (r *ReplicaSet) PromoteReplica(ctx context.Context) error {
+	runner := r.compose.Runner("replica")
+	svc := r.compose.Service("replica")
+
+	res, err := runner.Exec(ctx, svc.Container.ID, []string{"gosu", "postgres", "pg_ctl", "promote", "-D", pgData}, nil)
+	if err != nil {
+		return err
+	}
+	if res.ExitCode != 0 {
+		return fmt.Errorf("pg_ctl promote exited with %d: %s", res.ExitCode, res.Stderr)
+	}
+
+	db, err := sql.Open("pgx", r.ReplicaURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	for {
+		var inRecovery bool
+		err := db.QueryRowContext(ctx, "SELECT pg_is_in_recovery()").Scan(&inRecovery)
+		if err == nil && !inRecovery {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("replica still in recovery after promotion: %w", ctx.Err())
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
+
+// connectReplica only considers the replica ready once it is streaming from
+// the primary as a hot standby.
+func connectReplica(password string) docker.ServiceAdapter {
+	connect := connectPostgres(password)
+	return func(ctx context.Context, host string, port int) (docker.ServiceConfig, error) {
+		cfg, err := connect(ctx, host, port)
+		if err != nil {
+			return nil, err
+		}
+
+		db, err := sql.Open("pgx", cfg.URL().String())
+		if err != nil {
+			return nil, err
+		}
+		defer db.Close()
+
+		var inRecovery bool
+		if err := db.QueryRowContext(ctx, "SELECT pg_is_in_recovery()").Scan(&inRecovery); err != nil {
+			return nil, err
+		}
+		if !inRecovery {
+			return nil, fmt.Errorf("replica is not in recovery")
+		}
+		return cfg, nil
+	}
+}
@@ -0,0 +1,443 @@
+// Package revocation provides a harness which exercises the CRL and OCSP
+// endpoints of a PKI mount the way a strict RFC 5280/RFC 6960 relying party
+// would, failing the test with a detailed message on any deviation.
+package revocation
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/crypto/ocsp"
+)
+
+var (
+	oidCRLNumber         = asn1.ObjectIdentifier{2, 5, 29, 20}
+	oidDeltaCRLIndicator = asn1.ObjectIdentifier{2, 5, 29, 27}
+	oidOCSPNonce         = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
+	oidSHA1              = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+)
+
+// Validator fetches and validates revocation information from a single PKI
+// mount.
+type Validator struct {
+	t      testing.TB
+	client *api.Client
+	mount  string
+
+	// MaxClockSkew is the tolerance applied when checking ThisUpdate and
+	// NextUpdate against the local clock. Defaults to one minute.
+	MaxClockSkew time.Duration
+
+	// RequireNonce fails OCSP checks when the responder does not echo the
+	// nonce sent in the request.
+	RequireNonce bool
+}
+
+func New(t testing.TB, client *api.Client, mount string) *Validator {
+	return &Validator{
+		t:            t,
+		client:       client,
+		mount:        strings.Trim(mount, "/"),
+		MaxClockSkew: time.Minute,
+	}
+}
+
+// Issuer fetches the certificate of the given issuer reference.
+func (v *Validator) Issuer(issuerRef string) *x509.Certificate {
+	v.t.Helper()
+
+	body := v.get(fmt.Sprintf("/v1/%s/issuer/%s/der", v.mount, issuerRef))
+	cert, err := x509.ParseCertificate(body)
+	if err != nil {
+		v.t.Fatalf("issuer %v: unable to parse certificate: %v", issuerRef, err)
+	}
+
+	return cert
+}
+
+// CRL fetches the complete CRL for the given issuer and validates its
+// signature, freshness and required extensions.
+func (v *Validator) CRL(issuerRef string) *pkix.CertificateList {
+	v.t.Helper()
+	return v.fetchCRL(issuerRef, false)
+}
+
+// DeltaCRL fetches the delta CRL for the given issuer, validating it like
+// CRL and additionally requiring the delta CRL indicator extension.
+func (v *Validator) DeltaCRL(issuerRef string) *pkix.CertificateList {
+	v.t.Helper()
+	return v.fetchCRL(issuerRef, true)
+}
+
+func (v *Validator) fetchCRL(issuerRef string, delta bool) *pkix.CertificateList {
+	v.t.Helper()
+
+	path := fmt.Sprintf("/v1/%s/issuer/%s/crl/der", v.mount, issuerRef)
+	kind := "CRL"
+	if delta {
+		path = fmt.Sprintf("/v1/%s/issuer/%s/crl/delta/der", v.mount, issuerRef)
+		kind = "delta CRL"
+	}
+
+	crl, err := x509.ParseDERCRL(v.get(path))
+	if err != nil {
+		v.t.Fatalf("issuer %v: unable to parse %v: %v", issuerRef, kind, err)
+	}
+
+	issuer := v.Issuer(issuerRef)
+	if err := issuer.CheckCRLSignature(crl); err != nil {
+		v.t.Fatalf("issuer %v: %v signature does not verify against issuer certificate: %v", issuerRef, kind, err)
+	}
+
+	if !sameName(crl.TBSCertList.Issuer, issuer.RawSubject) {
+		v.t.Fatalf("issuer %v: %v issuer name does not match issuer certificate's subject", issuerRef, kind)
+	}
+
+	now := time.Now()
+	thisUpdate := crl.TBSCertList.ThisUpdate
+	nextUpdate := crl.TBSCertList.NextUpdate
+	if thisUpdate.After(now.Add(v.MaxClockSkew)) {
+		v.t.Fatalf("issuer %v: %v thisUpdate (%v) is in the future (now: %v)", issuerRef, kind, thisUpdate, now)
+	}
+	if nextUpdate.IsZero() {
+		v.t.Fatalf("issuer %v: %v is missing nextUpdate, which RFC 5280 requires conforming CAs to set", issuerRef, kind)
+	}
+	if nextUpdate.Before(now.Add(-v.MaxClockSkew)) {
+		v.t.Fatalf("issuer %v: %v is stale; nextUpdate (%v) has passed (now: %v)", issuerRef, kind, nextUpdate, now)
+	}
+	if !nextUpdate.After(thisUpdate) {
+		v.t.Fatalf("issuer %v: %v nextUpdate (%v) is not after thisUpdate (%v)", issuerRef, kind, nextUpdate, thisUpdate)
+	}
+
+	haveNumber := false
+	haveDelta := false
+	for _, ext := range crl.TBSCertList.Extensions {
+		switch {
+		case ext.Id.Equal(oidCRLNumber):
+			haveNumber = true
+		case ext.Id.Equal(oidDeltaCRLIndicator):
+			haveDelta = true
+		}
+	}
+	if !haveNumber {
+		v.t.Fatalf("issuer %v: %v is missing the CRL number extension", issuerRef, kind)
+	}
+	if delta != haveDelta {
+		v.t.Fatalf("issuer %v: %v has delta CRL indicator present=%v; expected %v", issuerRef, kind, haveDelta, delta)
+	}
+
+	return crl
+}
+
+// RequireRevokedOnCRL fails the test unless cert appears on its issuer's
+// complete CRL.
+func (v *Validator) RequireRevokedOnCRL(issuerRef string, cert *x509.Certificate) {
+	v.t.Helper()
+
+	crl := v.CRL(issuerRef)
+	if !onCRL(crl, cert.SerialNumber) {
+		v.t.Fatalf("issuer %v: expected serial %v on CRL; CRL contains %v", issuerRef, formatSerial(cert.SerialNumber), crlSerials(crl))
+	}
+}
+
+// RequireNotOnCRL fails the test if cert appears on its issuer's complete CRL.
+func (v *Validator) RequireNotOnCRL(issuerRef string, cert *x509.Certificate) {
+	v.t.Helper()
+
+	crl := v.CRL(issuerRef)
+	if onCRL(crl, cert.SerialNumber) {
+		v.t.Fatalf("issuer %v: expected serial %v to be absent from CRL", issuerRef, formatSerial(cert.SerialNumber))
+	}
+}
+
+// OCSP queries the mount's OCSP responder for cert, sending a random nonce,
+// and validates the response signature, freshness, certificate ID and
+// (when echoed or RequireNonce is set) the nonce.
+func (v *Validator) OCSP(issuerRef string, cert *x509.Certificate) *ocsp.Response {
+	v.t.Helper()
+
+	issuer := v.Issuer(issuerRef)
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		v.t.Fatal(err)
+	}
+
+	reqBytes, err := createRequestWithNonce(cert, issuer, nonce)
+	if err != nil {
+		v.t.Fatalf("unable to create OCSP request: %v", err)
+	}
+
+	req := v.client.NewRequest(http.MethodPost, fmt.Sprintf("/v1/%s/ocsp", v.mount))
+	req.Headers.Set("Content-Type", "application/ocsp-request")
+	req.BodyBytes = reqBytes
+
+	resp, err := v.client.RawRequest(req)
+	if resp == nil {
+		v.t.Fatalf("OCSP request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, readErr := ioutil.ReadAll(resp.Body)
+	if readErr != nil {
+		v.t.Fatalf("unable to read OCSP response: %v", readErr)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/ocsp-response" {
+		v.t.Fatalf("OCSP response had Content-Type %q; expected application/ocsp-response", ct)
+	}
+
+	ocspResp, err := ocsp.ParseResponseForCert(body, cert, issuer)
+	if err != nil {
+		v.t.Fatalf("OCSP response for serial %v failed to parse or verify: %v", formatSerial(cert.SerialNumber), err)
+	}
+
+	if ocspResp.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		v.t.Fatalf("OCSP response serial %v does not match requested serial %v", formatSerial(ocspResp.SerialNumber), formatSerial(cert.SerialNumber))
+	}
+
+	now := time.Now()
+	if ocspResp.ThisUpdate.After(now.Add(v.MaxClockSkew)) {
+		v.t.Fatalf("OCSP response thisUpdate (%v) is in the future (now: %v)", ocspResp.ThisUpdate, now)
+	}
+	if !ocspResp.NextUpdate.IsZero() && ocspResp.NextUpdate.Before(now.Add(-v.MaxClockSkew)) {
+		v.t.Fatalf("OCSP response is stale; nextUpdate (%v) has passed (now: %v)", ocspResp.NextUpdate, now)
+	}
+
+	respNonce, err := responseNonce(body)
+	if err != nil {
+		v.t.Fatalf("unable to parse OCSP response extensions: %v", err)
+	}
+	switch {
+	case respNonce == nil && v.RequireNonce:
+		v.t.Fatalf("OCSP responder did not echo the request nonce")
+	case respNonce != nil && !bytes.Equal(respNonce, nonce):
+		v.t.Fatalf("OCSP responder echoed nonce %x; expected %x", respNonce, nonce)
+	}
+
+	return ocspResp
+}
+
+// RequireOCSPStatus fails the test unless the OCSP responder reports the
+// given status (ocsp.Good, ocsp.Revoked or ocsp.Unknown) for cert.
+func (v *Validator) RequireOCSPStatus(issuerRef string, cert *x509.Certificate, status int) *ocsp.Response {
+	v.t.Helper()
+
+	resp := v.OCSP(issuerRef, cert)
+	if resp.Status != status {
+		v.t.Fatalf("OCSP status for serial %v was %v; expected %v", formatSerial(cert.SerialNumber), statusName(resp.Status), statusName(status))
+	}
+	if status == ocsp.Revoked && resp.RevokedAt.IsZero() {
+		v.t.Fatalf("OCSP response for revoked serial %v lacks a revocation time", formatSerial(cert.SerialNumber))
+	}
+
+	return resp
+}
+
+func (v *Validator) get(path string) []byte {
+	v.t.Helper()
+
+	resp, err := v.client.RawRequest(v.client.NewRequest(http.MethodGet, path))
+	if err != nil {
+		v.t.Fatalf("GET %v failed: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		v.t.Fatalf("GET %v: unable to read body: %v", path, err)
+	}
+	if len(body) == 0 {
+		v.t.Fatalf("GET %v: empty response body (status %v)", path, resp.StatusCode)
+	}
+
+	return body
+}
+
+type certID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+type request struct {
+	Cert certID
+}
+
+type tbsRequest struct {
+	Version           int `asn1:"explicit,tag:0,default:0,optional"`
+	RequestList       []request
+	RequestExtensions []pkix.Extension `asn1:"explicit,tag:2,optional"`
+}
+
+type ocspRequest struct {
+	TBSRequest tbsRequest
+}
+
+// createRequestWithNonce mirrors ocsp.CreateRequest (using SHA-1, as
+// RFC 5019 mandates) but additionally attaches an RFC 8954 nonce, which the
+// x/crypto package has no support for.
+func createRequestWithNonce(cert, issuer *x509.Certificate, nonce []byte) ([]byte, error) {
+	var publicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &publicKeyInfo); err != nil {
+		return nil, err
+	}
+
+	h := crypto.SHA1.New()
+	h.Write(publicKeyInfo.PublicKey.RightAlign())
+	issuerKeyHash := h.Sum(nil)
+
+	h.Reset()
+	h.Write(issuer.RawSubject)
+	issuerNameHash := h.Sum(nil)
+
+	nonceValue, err := asn1.Marshal(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(ocspRequest{
+		TBSRequest: tbsRequest{
+			RequestList: []request{{
+				Cert: certID{
+					HashAlgorithm: pkix.AlgorithmIdentifier{
+						Algorithm:  oidSHA1,
+						Parameters: asn1.RawValue{Tag: 5 /* ASN.1 NULL */},
+					},
+					NameHash:      issuerNameHash,
+					IssuerKeyHash: issuerKeyHash,
+					SerialNumber:  cert.SerialNumber,
+				},
+			}},
+			RequestExtensions: []pkix.Extension{{Id: oidOCSPNonce, Value: nonceValue}},
+		},
+	})
+}
+
+type responseASN1 struct {
+	Status   asn1.Enumerated
+	Response responseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type responseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type basicResponse struct {
+	TBSResponseData    responseData
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type responseData struct {
+	Raw                asn1.RawContent
+	Version            int `asn1:"optional,default:0,explicit,tag:0"`
+	RawResponderID     asn1.RawValue
+	ProducedAt         time.Time `asn1:"generalized"`
+	Responses          asn1.RawValue
+	ResponseExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+// responseNonce extracts the nonce from the responseExtensions of a
+// (previously verified) OCSP response, returning nil if none is present.
+func responseNonce(der []byte) ([]byte, error) {
+	var resp responseASN1
+	if _, err := asn1.Unmarshal(der, &resp); err != nil {
+		return nil, err
+	}
+
+	var basic basicResponse
+	if _, err := asn1.Unmarshal(resp.Response.Response, &basic); err != nil {
+		return nil, err
+	}
+
+	for _, ext := range basic.TBSResponseData.ResponseExtensions {
+		if !ext.Id.Equal(oidOCSPNonce) {
+			continue
+		}
+
+		var nonce []byte
+		if _, err := asn1.Unmarshal(ext.Value, &nonce); err != nil {
+			return nil, fmt.Errorf("malformed nonce extension: %w", err)
+		}
+		return nonce, nil
+	}
+
+	return nil, nil
+}
+
+// sameName compares a parsed name against raw DER by re-encoding both sides,
+// so differences in the original encoding don't cause spurious mismatches.
+func sameName(name pkix.RDNSequence, raw []byte) bool {
+	var other pkix.RDNSequence
+	if _, err := asn1.Unmarshal(raw, &other); err != nil {
+		return false
+	}
+
+	left, err := asn1.Marshal(name)
+	if err != nil {
+		return false
+	}
+	right, err := asn1.Marshal(other)
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(left, right)
+}
+
+func onCRL(crl *pkix.CertificateList, serial *big.Int) bool {
+	for _, entry := range crl.TBSCertList.RevokedCertificates {
+		if entry.SerialNumber.Cmp(serial) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func crlSerials(crl *pkix.CertificateList) []string {
+	serials := make([]string, 0, len(crl.TBSCertList.RevokedCertificates))
+	for _, entry := range crl.TBSCertList.RevokedCertificates {
+		serials = append(serials, formatSerial(entry.SerialNumber))
+	}
+	return serials
+}
+
+func formatSerial(serial *big.Int) string {
+	b := serial.Bytes()
+	parts := make([]string, len(b))
+	for i, octet := range b {
+		parts[i] = fmt.Sprintf("%02x", octet)
+	}
+	return strings.Join(parts, ":")
+}
+
+func statusName(status int) string {
+	switch status {
+	case ocsp.Good:
+		return "good"
+	case ocsp.Revoked:
+		return "revoked"
+	case ocsp.Unknown:
+		return "unknown"
+	default:
+		return fmt.Sprintf("invalid(%d)", status)
+	}
+}
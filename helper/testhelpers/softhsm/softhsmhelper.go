@@ -0,0 +1,124 @@
+package softhsm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/hashicorp/go-uuid"
+)
+
+// Common install locations of the SoftHSM2 PKCS#11 module across the
+// distributions and package managers we see in CI and on developer machines.
+var defaultModulePaths = []string{
+	"/usr/lib/softhsm/libsofthsm2.so",
+	"/usr/lib64/softhsm/libsofthsm2.so",
+	"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+	"/usr/lib/aarch64-linux-gnu/softhsm/libsofthsm2.so",
+	"/usr/local/lib/softhsm/libsofthsm2.so",
+	"/opt/homebrew/lib/softhsm/libsofthsm2.so",
+}
+
+var slotRegex = regexp.MustCompile(`reassigned to slot (\d+)`)
+
+type Config struct {
+	// ModulePath is the path to the PKCS#11 shared library to load.
+	ModulePath string
+	// ConfigPath is the softhsm2.conf used to initialize the token; it is
+	// also exported as SOFTHSM2_CONF for the duration of the test.
+	ConfigPath string
+	TokenLabel string
+	Slot       uint
+	Pin        string
+	SOPin      string
+}
+
+// PrepareTestToken initializes a fresh SoftHSM2 token in a temporary token
+// directory and returns the module path and credentials needed to use it.
+// The module is located via the SOFTHSM2_LIB environment variable, falling
+// back to a list of common install locations; the test is skipped if neither
+// the module nor softhsm2-util can be found.
+//
+// SOFTHSM2_CONF is set for the remainder of the test so that the module,
+// once loaded in-process, sees the same token directory.
+func PrepareTestToken(t *testing.T) *Config {
+	t.Helper()
+
+	modulePath := findModule()
+	if modulePath == "" {
+		t.Skip("SoftHSM2 module not found; set SOFTHSM2_LIB to run this test")
+	}
+
+	util, err := exec.LookPath("softhsm2-util")
+	if err != nil {
+		t.Skip("softhsm2-util not found in PATH; install SoftHSM2 to run this test")
+	}
+
+	dir := t.TempDir()
+	tokenDir := filepath.Join(dir, "tokens")
+	if err := os.Mkdir(tokenDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	configPath := filepath.Join(dir, "softhsm2.conf")
+	conf := fmt.Sprintf("directories.tokendir = %s\nobjectstore.backend = file\nlog.level = INFO\n", tokenDir)
+	if err := ioutil.WriteFile(configPath, []byte(conf), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOFTHSM2_CONF", configPath)
+
+	label, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	label = "vault-" + label[:8]
+
+	cfg := &Config{
+		ModulePath: modulePath,
+		ConfigPath: configPath,
+		TokenLabel: label,
+		Pin:        "1234",
+		SOPin:      "5678",
+	}
+
+	cmd := exec.Command(util, "--init-token", "--free",
+		"--label", cfg.TokenLabel,
+		"--pin", cfg.Pin,
+		"--so-pin", cfg.SOPin)
+	cmd.Env = append(os.Environ(), "SOFTHSM2_CONF="+configPath)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("failed to initialize SoftHSM2 token: %v\n%s", err, out)
+	}
+
+	matches := slotRegex.FindSubmatch(out)
+	if len(matches) != 2 {
+		t.Fatalf("unable to determine SoftHSM2 slot from output:\n%s", out)
+	}
+	slot, err := strconv.ParseUint(string(matches[1]), 10, 64)
+	if err != nil {
+		t.Fatalf("unable to parse SoftHSM2 slot %q: %v", matches[1], err)
+	}
+	cfg.Slot = uint(slot)
+
+	return cfg
+}
+
+func findModule() string {
+	if lib := os.Getenv("SOFTHSM2_LIB"); lib != "" {
+		return lib
+	}
+
+	for _, path := range defaultModulePaths {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+
+	return ""
+}
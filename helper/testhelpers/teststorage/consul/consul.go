@@ -12,7 +12,7 @@ import (
 )
 
 func MakeConsulBackend(t testing.T, logger hclog.Logger) *vault.PhysicalBackendBundle {
-	cleanup, config := consul.PrepareTestContainer(t.(*realtesting.T), "", false, true)
+	cleanup, config := consul.PrepareTestContainerWithACLBootstrap(t.(*realtesting.T), "")
 
 	consulConf := map[string]string{
 		"address":      config.Address(),
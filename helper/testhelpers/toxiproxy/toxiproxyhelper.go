@@ -0,0 +1,233 @@
+package toxiproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/testhelpers/docker"
+)
+
+const (
+	apiPort = "8474/tcp"
+
+	// Proxies listen on a fixed range of container ports so that they can be
+	// published when the container starts.
+	firstProxyPort = 20000
+	maxProxies     = 10
+)
+
+// Config describes a running toxiproxy container.
+type Config struct {
+	APIURL string
+
+	svc        *docker.Service
+	client     *http.Client
+	l          sync.Mutex
+	nextProxy  int
+	proxyNames map[string]bool
+}
+
+// Proxy is a TCP proxy in front of an upstream service. Clients connect to
+// Address instead of the service in order to be subject to injected faults.
+type Proxy struct {
+	Name string
+	// Address is the host:port at which the proxy can be reached from the
+	// test.
+	Address string
+
+	config *Config
+}
+
+// PrepareTestContainer starts a toxiproxy container. If networkID is not
+// empty, the container is attached to that network (e.g. one created with
+// docker.CreateNetwork), so that proxies can use other containers on it as
+// upstreams.
+func PrepareTestContainer(t *testing.T, version, networkID string) (func(), *Config) {
+	if version == "" {
+		version = "2.5.0"
+	}
+
+	ports := []string{apiPort}
+	for i := 0; i < maxProxies; i++ {
+		ports = append(ports, fmt.Sprintf("%d/tcp", firstProxyPort+i))
+	}
+
+	opts := docker.RunOptions{
+		ContainerName: "toxiproxy",
+		ImageRepo:     "ghcr.io/shopify/toxiproxy",
+		ImageTag:      version,
+		Ports:         ports,
+		LogConsumer:   docker.FailureLogConsumer(t, 100),
+	}
+	if networkID != "" {
+		opts.Networks = []string{networkID}
+	}
+
+	runner, err := docker.NewServiceRunner(opts)
+	if err != nil {
+		t.Fatalf("Could not start docker toxiproxy: %s", err)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	svc, err := runner.StartService(context.Background(), func(ctx context.Context, host string, port int) (docker.ServiceConfig, error) {
+		u := url.URL{
+			Scheme: "http",
+			Host:   fmt.Sprintf("%s:%d", host, port),
+		}
+		resp, err := client.Get(u.String() + "/version")
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %d from toxiproxy", resp.StatusCode)
+		}
+		return docker.NewServiceURL(u), nil
+	})
+	if err != nil {
+		t.Fatalf("Could not start docker toxiproxy: %s", err)
+	}
+
+	return svc.Cleanup, &Config{
+		APIURL:     svc.Config.URL().String(),
+		svc:        svc,
+		client:     client,
+		proxyNames: make(map[string]bool),
+	}
+}
+
+// AddProxy creates a proxy forwarding to upstream, a host:port address as
+// seen from inside the toxiproxy container.
+func (c *Config) AddProxy(name, upstream string) (*Proxy, error) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if c.proxyNames[name] {
+		return nil, fmt.Errorf("proxy %q already exists", name)
+	}
+	if c.nextProxy >= maxProxies {
+		return nil, fmt.Errorf("at most %d proxies are supported", maxProxies)
+	}
+	port := strconv.Itoa(firstProxyPort + c.nextProxy)
+
+	address, err := c.svc.MappedAddress(port + "/tcp")
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.do(http.MethodPost, "/proxies", map[string]interface{}{
+		"name":     name,
+		"listen":   "0.0.0.0:" + port,
+		"upstream": upstream,
+		"enabled":  true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.nextProxy++
+	c.proxyNames[name] = true
+	return &Proxy{
+		Name:    name,
+		Address: address,
+		config:  c,
+	}, nil
+}
+
+// ProxyURL returns rawURL with its host and port replaced by the proxy's.
+func (p *Proxy) ProxyURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	u.Host = p.Address
+	return u.String(), nil
+}
+
+// AddLatency delays data flowing from the upstream to the client by latency,
+// plus or minus up to jitter.
+func (p *Proxy) AddLatency(latency, jitter time.Duration) error {
+	return p.config.do(http.MethodPost, "/proxies/"+p.Name+"/toxics", map[string]interface{}{
+		"name":     "latency_downstream",
+		"type":     "latency",
+		"stream":   "downstream",
+		"toxicity": 1.0,
+		"attributes": map[string]interface{}{
+			"latency": latency.Milliseconds(),
+			"jitter":  jitter.Milliseconds(),
+		},
+	})
+}
+
+// Partition disables the proxy: existing connections are closed and new ones
+// are refused until Reset is called.
+func (p *Proxy) Partition() error {
+	return p.setEnabled(false)
+}
+
+// Reset removes all faults from the proxy and re-enables it.
+func (p *Proxy) Reset() error {
+	var toxics []struct {
+		Name string `json:"name"`
+	}
+	if err := p.config.get("/proxies/"+p.Name+"/toxics", &toxics); err != nil {
+		return err
+	}
+	for _, toxic := range toxics {
+		if err := p.config.do(http.MethodDelete, "/proxies/"+p.Name+"/toxics/"+toxic.Name, nil); err != nil {
+			return err
+		}
+	}
+	return p.setEnabled(true)
+}
+
+func (p *Proxy) setEnabled(enabled bool) error {
+	return p.config.do(http.MethodPost, "/proxies/"+p.Name, map[string]interface{}{
+		"enabled": enabled,
+	})
+}
+
+func (c *Config) do(method, path string, body interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, c.APIURL+path, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("toxiproxy %s %s returned status %d", method, path, resp.StatusCode)
+	}
+	return nil
+}
+
+func (c *Config) get(path string, out interface{}) error {
+	resp, err := c.client.Get(c.APIURL + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("toxiproxy GET %s returned status %d", path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,206 @@
+package vaultcontainer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/helper/testhelpers/docker"
+)
+
+const (
+	defaultRepo        = "hashicorp/vault"
+	containerConfigDir = "/vault/config"
+	containerConfig    = containerConfigDir + "/test.hcl"
+)
+
+type Config struct {
+	docker.ServiceURL
+	Token string
+}
+
+// Client returns an API client pointed at the container and authenticated
+// with the root token.
+func (c *Config) Client() (*api.Client, error) {
+	cfg := api.DefaultConfig()
+	cfg.Address = c.URL().String()
+	client, err := api.NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client.SetToken(c.Token)
+	return client, nil
+}
+
+// PrepareTestContainer runs the given released Vault version in dev mode,
+// returning once it is unsealed and ready to serve requests. If version is
+// empty, the tag is given by the environment variable VAULT_DOCKER_VERSION,
+// or "latest" if that is also empty. The image repository may be overridden
+// with VAULT_DOCKER_REPO.
+//
+// This is intended for upgrade and migration tests which need to write data
+// with an older binary and then read it back with the code under test.
+func PrepareTestContainer(t *testing.T, version string) (func(), *Config) {
+	t.Helper()
+
+	rootToken, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatalf("Could not generate root token: %s", err)
+	}
+
+	runner, err := docker.NewServiceRunner(docker.RunOptions{
+		ContainerName: "vault",
+		ImageRepo:     imageRepo(),
+		ImageTag:      imageTag(version),
+		Env:           []string{"SKIP_SETCAP=true"},
+		Cmd: []string{
+			"server", "-dev",
+			"-dev-root-token-id=" + rootToken,
+			"-dev-listen-address=0.0.0.0:8200",
+		},
+		Ports: []string{"8200/tcp"},
+	})
+	if err != nil {
+		t.Fatalf("Could not start docker Vault: %s", err)
+	}
+
+	svc, err := runner.StartService(context.Background(), func(ctx context.Context, host string, port int) (docker.ServiceConfig, error) {
+		c := &Config{
+			ServiceURL: *docker.NewServiceURL(url.URL{Scheme: "http", Host: fmt.Sprintf("%s:%d", host, port)}),
+			Token:      rootToken,
+		}
+		if err := checkReady(ctx, c); err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+	if err != nil {
+		t.Fatalf("Could not start docker Vault: %s", err)
+	}
+
+	return svc.Cleanup, svc.Config.(*Config)
+}
+
+// PrepareTestContainerWithConfig runs the given released Vault version with
+// the provided server configuration (in HCL), then initializes and unseals it
+// with a single Shamir key share. The configuration must define a TCP
+// listener on 0.0.0.0:8200 with TLS disabled, and should set
+// disable_mlock = true.
+func PrepareTestContainerWithConfig(t *testing.T, version string, config string) (func(), *Config) {
+	t.Helper()
+
+	configDir, err := ioutil.TempDir("", "vault-docker-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(configDir)
+
+	configPath := filepath.Join(configDir, "test.hcl")
+	if err := ioutil.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner, err := docker.NewServiceRunner(docker.RunOptions{
+		ContainerName: "vault",
+		ImageRepo:     imageRepo(),
+		ImageTag:      imageTag(version),
+		Env:           []string{"SKIP_SETCAP=true"},
+		Cmd:           []string{"server", "-config=" + containerConfig},
+		CopyFromTo:    map[string]string{configPath: containerConfig},
+		Ports:         []string{"8200/tcp"},
+	})
+	if err != nil {
+		t.Fatalf("Could not start docker Vault: %s", err)
+	}
+
+	var rootToken string
+	svc, err := runner.StartService(context.Background(), func(ctx context.Context, host string, port int) (docker.ServiceConfig, error) {
+		c := &Config{
+			ServiceURL: *docker.NewServiceURL(url.URL{Scheme: "http", Host: fmt.Sprintf("%s:%d", host, port)}),
+			Token:      rootToken,
+		}
+		client, err := c.Client()
+		if err != nil {
+			return nil, err
+		}
+
+		initialized, err := client.Sys().InitStatus()
+		if err != nil {
+			return nil, err
+		}
+
+		if !initialized {
+			resp, err := client.Sys().Init(&api.InitRequest{
+				SecretShares:    1,
+				SecretThreshold: 1,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			if _, err := client.Sys().Unseal(resp.KeysB64[0]); err != nil {
+				return nil, err
+			}
+
+			// Retain the token across retries in case readiness takes a
+			// few attempts after the unseal.
+			rootToken = resp.RootToken
+			c.Token = rootToken
+		}
+
+		if err := checkReady(ctx, c); err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+	if err != nil {
+		t.Fatalf("Could not start docker Vault: %s", err)
+	}
+
+	return svc.Cleanup, svc.Config.(*Config)
+}
+
+func checkReady(ctx context.Context, c *Config) error {
+	client, err := c.Client()
+	if err != nil {
+		return err
+	}
+
+	health, err := client.Sys().HealthWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !health.Initialized || health.Sealed || health.Standby {
+		return fmt.Errorf("vault not yet ready: initialized=%v sealed=%v standby=%v", health.Initialized, health.Sealed, health.Standby)
+	}
+
+	// Health can report ready slightly before the token store is usable.
+	if _, err := client.Auth().Token().LookupSelfWithContext(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func imageRepo() string {
+	if repo := os.Getenv("VAULT_DOCKER_REPO"); repo != "" {
+		return repo
+	}
+	return defaultRepo
+}
+
+func imageTag(version string) string {
+	if version != "" {
+		return version
+	}
+	if envVersion := os.Getenv("VAULT_DOCKER_VERSION"); envVersion != "" {
+		return envVersion
+	}
+	return "latest"
+}
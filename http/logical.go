@@ -104,10 +104,12 @@ func buildLogicalRequestNoAuth(perfStandby bool, w http.ResponseWriter, r *http.
 		r.Body = bufferedBody
 
 		// If we are uploading a snapshot or receiving an ocsp-request (which
-		// is der encoded) we don't want to parse it. Instead, we will simply
+		// is der encoded), an EST enrollment request (a base64 encoded
+		// PKCS#10 CSR), a SCEP message (DER encoded PKCS#7) or a CMP message
+		// (a DER encoded PKIMessage) we don't want to parse it. Instead, we will simply
 		// add the HTTP request to the logical request object for later consumption.
 		contentType := r.Header.Get("Content-Type")
-		if path == "sys/storage/raft/snapshot" || path == "sys/storage/raft/snapshot-force" || isOcspRequest(contentType) {
+		if path == "sys/storage/raft/snapshot" || path == "sys/storage/raft/snapshot-force" || isOcspRequest(contentType) || isPkcs10Request(contentType) || isPkiMessageRequest(contentType) || isPkixCmpRequest(contentType) {
 			passHTTPReq = true
 			origBody = r.Body
 		} else {
@@ -219,6 +221,33 @@ func isOcspRequest(contentType string) bool {
 	return contentType == "application/ocsp-request"
 }
 
+func isPkcs10Request(contentType string) bool {
+	contentType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return contentType == "application/pkcs10"
+}
+
+func isPkiMessageRequest(contentType string) bool {
+	contentType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return contentType == "application/x-pki-message"
+}
+
+func isPkixCmpRequest(contentType string) bool {
+	contentType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return contentType == "application/pkixcmp"
+}
+
 func buildLogicalPath(r *http.Request) (string, int, error) {
 	ns, err := namespace.FromContext(r.Context())
 	if err != nil {
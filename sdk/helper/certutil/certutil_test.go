@@ -910,6 +910,94 @@ func TestNotAfterValues(t *testing.T) {
 	}
 }
 
+func TestSignatureAlgorithmRegistry(t *testing.T) {
+	for _, keyType := range ListKeyTypes() {
+		for _, name := range keyType.SignatureAlgorithms {
+			algorithm, ok := GetSignatureAlgorithm(name)
+			if !ok {
+				t.Fatalf("key type %v lists unknown signature algorithm %v", keyType.Name, name)
+			}
+			if algorithm.KeyType != keyType.Name || algorithm.Available != keyType.Available {
+				t.Fatalf("signature algorithm %v doesn't match key type %v: %#v", name, keyType.Name, algorithm)
+			}
+			if algorithm.Available && algorithm.Algorithm == x509.UnknownSignatureAlgorithm {
+				t.Fatalf("available signature algorithm %v has no x509 identifier", name)
+			}
+		}
+	}
+
+	// Every name usable as a revocation signature algorithm is known.
+	for name := range SignatureAlgorithmNames {
+		if algorithm, ok := GetSignatureAlgorithm(name); !ok || !algorithm.Available {
+			t.Fatalf("signature algorithm %v missing from the registry", name)
+		}
+	}
+
+	err := ValidateKeyTypeLength("ed448", 0)
+	if err == nil || !strings.Contains(err.Error(), "not supported by this build") {
+		t.Fatalf("expected ed448 to be known but unavailable, got: %v", err)
+	}
+	err = ValidateKeyTypeLength("ed9999", 0)
+	if err == nil || !strings.Contains(err.Error(), "unknown key type") {
+		t.Fatalf("expected unknown key type error, got: %v", err)
+	}
+	_, err = CreateKeyBundle("ed448", 0, rand.Reader)
+	if err == nil || !strings.Contains(err.Error(), "not supported by this build") {
+		t.Fatalf("expected ed448 key generation to be unavailable, got: %v", err)
+	}
+}
+
+func TestSerialNumberFormat(t *testing.T) {
+	prefix := []byte{0x42}
+	for i := 0; i < 32; i++ {
+		serial, err := GenerateSerialNumberWithFormat(rand.Reader, prefix, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		serialBytes := serial.Bytes()
+		if len(serialBytes) != 9 || serialBytes[0] != 0x42 {
+			t.Fatalf("expected a 9-byte serial number starting with the prefix, got %x", serialBytes)
+		}
+	}
+
+	serial, err := GenerateSerialNumberWithFormat(rand.Reader, nil, 96)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial.BitLen() > 96 {
+		t.Fatalf("expected at most 96 bits, got %d", serial.BitLen())
+	}
+
+	for _, tc := range []struct {
+		prefix []byte
+		bits   int
+		err    string
+	}{
+		{nil, 63, "at least 64 random bits"},
+		{[]byte{0x00, 0x01}, 64, "zero byte"},
+		{[]byte{0x01}, 65, "multiple of 8"},
+		{[]byte{0xff}, 152, "at most 159 bits"},
+		{[]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d}, 64, "at most 159 bits"},
+	} {
+		_, err := GenerateSerialNumberWithFormat(rand.Reader, tc.prefix, tc.bits)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("expected error containing %q for prefix %x and %d bits, got: %v", tc.err, tc.prefix, tc.bits, err)
+		}
+	}
+	if err := ValidateSerialNumberFormat([]byte{0x7f}, 152); err != nil {
+		t.Fatalf("expected a 1-byte prefix with 152 random bits to fit: %v", err)
+	}
+
+	// Without a number of bits, as many whole bytes as fit follow the prefix.
+	serial, err = GenerateSerialNumberWithFormat(rand.Reader, []byte{0xff, 0x01}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serialBytes := serial.Bytes(); len(serialBytes) != 19 || serialBytes[0] != 0xff || serialBytes[1] != 0x01 {
+		t.Fatalf("expected a 19-byte serial number starting with the prefix, got %x", serialBytes)
+	}
+}
+
 func genRsaKey(t *testing.T) *rsa.PrivateKey {
 	key, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
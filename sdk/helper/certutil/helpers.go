@@ -69,6 +69,13 @@ var SignatureAlgorithmNames = map[string]x509.SignatureAlgorithm{
 // > id-ce-deltaCRLIndicator OBJECT IDENTIFIER ::= { id-ce 27 }
 var DeltaCRLIndicatorOID = asn1.ObjectIdentifier([]int{2, 5, 29, 27})
 
+// OIDs for the RFC 6962 Certificate Transparency extensions: the poison
+// marking precertificates, and the embedded SCT list.
+var (
+	PrecertificatePoisonOID = asn1.ObjectIdentifier([]int{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3})
+	SCTListOID              = asn1.ObjectIdentifier([]int{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2})
+)
+
 // GetHexFormatted returns the byte buffer formatted in hex with
 // the specified separator between bytes.
 func GetHexFormatted(buf []byte, sep string) string {
@@ -359,6 +366,9 @@ func generatePrivateKey(keyType string, keyBits int, container ParsedPrivateKeyC
 			return errutil.InternalError{Err: fmt.Sprintf("error marshalling Ed25519 private key: %v", err)}
 		}
 	default:
+		if info, ok := GetKeyType(keyType); ok && !info.Available {
+			return errutil.UserError{Err: fmt.Sprintf("key type %s is not supported by this build of Vault", keyType)}
+		}
 		return errutil.UserError{Err: fmt.Sprintf("unknown key type: %s", keyType)}
 	}
 
@@ -378,13 +388,71 @@ func GenerateSerialNumberWithRandomSource(randReader io.Reader) (*big.Int, error
 }
 
 func generateSerialNumber(randReader io.Reader) (*big.Int, error) {
-	serial, err := rand.Int(randReader, (&big.Int{}).Exp(big.NewInt(2), big.NewInt(159), nil))
+	serial, err := rand.Int(randReader, (&big.Int{}).Exp(big.NewInt(2), big.NewInt(DefaultSerialNumberBits), nil))
 	if err != nil {
 		return nil, errutil.InternalError{Err: fmt.Sprintf("error generating serial number: %v", err)}
 	}
 	return serial, nil
 }
 
+// ValidateSerialNumberFormat checks that serial numbers made of the given
+// prefix followed by bits random bits carry at least MinSerialNumberBits of
+// entropy, as the CA/Browser Forum Baseline Requirements demand, and fit the
+// 20 octets RFC 5280 allows. Zero bits means as many as fit; see
+// GenerateSerialNumberWithFormat.
+func ValidateSerialNumberFormat(prefix []byte, bits int) error {
+	if len(prefix) > 0 && prefix[0] == 0 {
+		return fmt.Errorf("serial number prefixes must not start with a zero byte")
+	}
+	if bits == 0 {
+		bits = defaultSerialNumberBits(prefix)
+	}
+	if bits < MinSerialNumberBits {
+		return fmt.Errorf("serial numbers must have at least %d random bits; got %d", MinSerialNumberBits, bits)
+	}
+	if len(prefix) > 0 && bits%8 != 0 {
+		return fmt.Errorf("serial numbers with a prefix must have a multiple of 8 random bits, so that the prefix is byte-aligned; got %d", bits)
+	}
+	if total := new(big.Int).SetBytes(prefix).BitLen() + bits; total > MaxSerialNumberBits {
+		return fmt.Errorf("serial numbers can have at most %d bits, but a %d-byte prefix and %d random bits need %d", MaxSerialNumberBits, len(prefix), bits, total)
+	}
+	return nil
+}
+
+// defaultSerialNumberBits returns the number of random bits to follow the
+// prefix with: DefaultSerialNumberBits without one, and otherwise as many
+// whole bytes as fit.
+func defaultSerialNumberBits(prefix []byte) int {
+	if len(prefix) == 0 {
+		return DefaultSerialNumberBits
+	}
+	available := MaxSerialNumberBits - new(big.Int).SetBytes(prefix).BitLen()
+	return available - available%8
+}
+
+// GenerateSerialNumberWithFormat generates a serial number made of the
+// given prefix followed by bits random bits from randReader; zero bits
+// means DefaultSerialNumberBits without a prefix, and as many whole bytes
+// as fit with one. Without a prefix, the serial number is simply random.
+func GenerateSerialNumberWithFormat(randReader io.Reader, prefix []byte, bits int) (*big.Int, error) {
+	if len(prefix) == 0 && (bits == 0 || bits == DefaultSerialNumberBits) {
+		return generateSerialNumber(randReader)
+	}
+	if err := ValidateSerialNumberFormat(prefix, bits); err != nil {
+		return nil, errutil.UserError{Err: err.Error()}
+	}
+	if bits == 0 {
+		bits = defaultSerialNumberBits(prefix)
+	}
+
+	random, err := rand.Int(randReader, new(big.Int).Lsh(big.NewInt(1), uint(bits)))
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("error generating serial number: %v", err)}
+	}
+	serial := new(big.Int).Lsh(new(big.Int).SetBytes(prefix), uint(bits))
+	return serial.Or(serial, random), nil
+}
+
 // ComparePublicKeysAndType compares two public keys and returns true if they match,
 // false if their types or contents differ, and an error on unsupported key types.
 func ComparePublicKeysAndType(key1Iface, key2Iface crypto.PublicKey) (bool, error) {
@@ -491,12 +559,17 @@ func AddPolicyIdentifiers(data *CreationBundle, certTemplate *x509.Certificate)
 			oidOnly = false
 		}
 	}
-	if !oidOnly { // Because all policy information is held in the same extension, when we use an extra extension to
+	// The standard library always marks the PolicyIdentifiers extension
+	// non-critical, so a critical policies extension also has to be built
+	// by hand.
+	critical := data.Params.PolicyIdentifiersCritical && len(data.Params.PolicyIdentifiers) > 0
+	if !oidOnly || critical { // Because all policy information is held in the same extension, when we use an extra extension to
 		// add policy qualifier information, that overwrites any information in the PolicyIdentifiers field on the Cert
 		// Template, so we need to reparse all the policy identifiers here
 		extension, err := CreatePolicyInformationExtensionFromStorageStrings(data.Params.PolicyIdentifiers)
 		if err == nil {
 			// If this errors out, don't add it, rely on the OIDs parsed into PolicyIdentifiers above
+			extension.Critical = critical
 			certTemplate.ExtraExtensions = append(certTemplate.ExtraExtensions, *extension)
 		}
 	}
@@ -512,6 +585,46 @@ func AddExtKeyUsageOids(data *CreationBundle, certTemplate *x509.Certificate) {
 	}
 }
 
+// AddNameConstraints adds the name constraints extension, based on
+// CreationBundle
+func AddNameConstraints(data *CreationBundle, certTemplate *x509.Certificate) {
+	params := data.Params
+	if len(params.PermittedDNSDomains) == 0 && len(params.ExcludedDNSDomains) == 0 &&
+		len(params.PermittedIPRanges) == 0 && len(params.ExcludedIPRanges) == 0 &&
+		len(params.PermittedEmailAddresses) == 0 && len(params.ExcludedEmailAddresses) == 0 &&
+		len(params.PermittedURIDomains) == 0 && len(params.ExcludedURIDomains) == 0 {
+		return
+	}
+
+	certTemplate.PermittedDNSDomains = params.PermittedDNSDomains
+	certTemplate.ExcludedDNSDomains = params.ExcludedDNSDomains
+	certTemplate.PermittedIPRanges = params.PermittedIPRanges
+	certTemplate.ExcludedIPRanges = params.ExcludedIPRanges
+	certTemplate.PermittedEmailAddresses = params.PermittedEmailAddresses
+	certTemplate.ExcludedEmailAddresses = params.ExcludedEmailAddresses
+	certTemplate.PermittedURIDomains = params.PermittedURIDomains
+	certTemplate.ExcludedURIDomains = params.ExcludedURIDomains
+	certTemplate.PermittedDNSDomainsCritical = !params.NonCriticalNameConstraints
+}
+
+// AddCustomExtensions adds the custom extensions to certificate, replacing
+// any extension with the same OID
+func AddCustomExtensions(data *CreationBundle, certTemplate *x509.Certificate) {
+	for _, ext := range data.Params.CustomExtensions {
+		replaced := false
+		for i, existing := range certTemplate.ExtraExtensions {
+			if existing.Id.Equal(ext.Id) {
+				certTemplate.ExtraExtensions[i] = ext
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			certTemplate.ExtraExtensions = append(certTemplate.ExtraExtensions, ext)
+		}
+	}
+}
+
 func HandleOtherCSRSANs(in *x509.CertificateRequest, sans map[string][]string) error {
 	certTemplate := &x509.Certificate{
 		DNSNames:       in.DNSNames,
@@ -764,6 +877,9 @@ func ValidateKeyTypeLength(keyType string, keyBits int) error {
 		}
 	case "any", "ed25519":
 	default:
+		if info, ok := GetKeyType(keyType); ok && !info.Available {
+			return fmt.Errorf("key type %s is not supported by this build of Vault", keyType)
+		}
 		return fmt.Errorf("unknown key type %s", keyType)
 	}
 
@@ -816,7 +932,7 @@ func createCertificate(data *CreationBundle, randReader io.Reader, privateKeyGen
 	var err error
 	result := &ParsedCertBundle{}
 
-	serialNumber, err := GenerateSerialNumber()
+	serialNumber, err := GenerateSerialNumberWithFormat(rand.Reader, data.Params.SerialNumberPrefix, data.Params.SerialNumberBits)
 	if err != nil {
 		return nil, err
 	}
@@ -844,7 +960,9 @@ func createCertificate(data *CreationBundle, randReader io.Reader, privateKeyGen
 		IPAddresses:    data.Params.IPAddresses,
 		URIs:           data.Params.URIs,
 	}
-	if data.Params.NotBeforeDuration > 0 {
+	if !data.Params.NotBefore.IsZero() {
+		certTemplate.NotBefore = data.Params.NotBefore
+	} else if data.Params.NotBeforeDuration > 0 {
 		certTemplate.NotBefore = time.Now().Add(-1 * data.Params.NotBeforeDuration)
 	}
 
@@ -861,10 +979,7 @@ func createCertificate(data *CreationBundle, randReader io.Reader, privateKeyGen
 	}
 
 	// This will only be filled in from the generation paths
-	if len(data.Params.PermittedDNSDomains) > 0 {
-		certTemplate.PermittedDNSDomains = data.Params.PermittedDNSDomains
-		certTemplate.PermittedDNSDomainsCritical = true
-	}
+	AddNameConstraints(data, certTemplate)
 
 	AddPolicyIdentifiers(data, certTemplate)
 
@@ -872,6 +987,8 @@ func createCertificate(data *CreationBundle, randReader io.Reader, privateKeyGen
 
 	AddExtKeyUsageOids(data, certTemplate)
 
+	AddCustomExtensions(data, certTemplate)
+
 	certTemplate.IssuingCertificateURL = data.Params.URLs.IssuingCertificates
 	certTemplate.CRLDistributionPoints = data.Params.URLs.CRLDistributionPoints
 	certTemplate.OCSPServer = data.Params.URLs.OCSPServers
@@ -890,7 +1007,7 @@ func createCertificate(data *CreationBundle, randReader io.Reader, privateKeyGen
 		caCert := data.SigningBundle.Certificate
 		certTemplate.AuthorityKeyId = caCert.SubjectKeyId
 
-		certBytes, err = x509.CreateCertificate(randReader, certTemplate, caCert, result.PrivateKey.Public(), data.SigningBundle.PrivateKey)
+		certBytes, err = createSignedCertificate(randReader, data, certTemplate, result.PrivateKey.Public())
 	} else {
 		// Creating a self-signed root
 		if data.Params.MaxPathLength == 0 {
@@ -1096,14 +1213,16 @@ func signCertificate(data *CreationBundle, randReader io.Reader) (*ParsedCertBun
 		return nil, errutil.UserError{Err: "nil csr given to signCertificate"}
 	}
 
-	err := data.CSR.CheckSignature()
-	if err != nil {
-		return nil, errutil.UserError{Err: "request signature invalid"}
+	if !data.CSRPossessionVerified {
+		err := data.CSR.CheckSignature()
+		if err != nil {
+			return nil, errutil.UserError{Err: "request signature invalid"}
+		}
 	}
 
 	result := &ParsedCertBundle{}
 
-	serialNumber, err := GenerateSerialNumber()
+	serialNumber, err := GenerateSerialNumberWithFormat(rand.Reader, data.Params.SerialNumberPrefix, data.Params.SerialNumberBits)
 	if err != nil {
 		return nil, err
 	}
@@ -1123,7 +1242,9 @@ func signCertificate(data *CreationBundle, randReader io.Reader) (*ParsedCertBun
 		SubjectKeyId:   subjKeyID[:],
 		AuthorityKeyId: caCert.SubjectKeyId,
 	}
-	if data.Params.NotBeforeDuration > 0 {
+	if !data.Params.NotBefore.IsZero() {
+		certTemplate.NotBefore = data.Params.NotBefore
+	} else if data.Params.NotBeforeDuration > 0 {
 		certTemplate.NotBefore = time.Now().Add(-1 * data.Params.NotBeforeDuration)
 	}
 
@@ -1173,6 +1294,8 @@ func signCertificate(data *CreationBundle, randReader io.Reader) (*ParsedCertBun
 
 	AddExtKeyUsageOids(data, certTemplate)
 
+	AddCustomExtensions(data, certTemplate)
+
 	var certBytes []byte
 
 	certTemplate.IssuingCertificateURL = data.Params.URLs.IssuingCertificates
@@ -1197,12 +1320,9 @@ func signCertificate(data *CreationBundle, randReader io.Reader) (*ParsedCertBun
 		certTemplate.IsCA = false
 	}
 
-	if len(data.Params.PermittedDNSDomains) > 0 {
-		certTemplate.PermittedDNSDomains = data.Params.PermittedDNSDomains
-		certTemplate.PermittedDNSDomainsCritical = true
-	}
+	AddNameConstraints(data, certTemplate)
 
-	certBytes, err = x509.CreateCertificate(randReader, certTemplate, caCert, data.CSR.PublicKey, data.SigningBundle.PrivateKey)
+	certBytes, err = createSignedCertificate(randReader, data, certTemplate, data.CSR.PublicKey)
 
 	if err != nil {
 		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to create certificate: %s", err)}
@@ -1219,6 +1339,36 @@ func signCertificate(data *CreationBundle, randReader io.Reader) (*ParsedCertBun
 	return result, nil
 }
 
+// createSignedCertificate signs the certificate with the signing bundle,
+// first handing a precertificate for it to the PrecertificateHandler, if
+// any, and adding the extensions it returns. The precertificate is the
+// certificate to be issued with the critical poison extension added.
+func createSignedCertificate(randReader io.Reader, data *CreationBundle, certTemplate *x509.Certificate, pub crypto.PublicKey) ([]byte, error) {
+	caCert := data.SigningBundle.Certificate
+	signer := data.SigningBundle.PrivateKey
+
+	if data.Params.PrecertificateHandler != nil && !certTemplate.IsCA {
+		precertTemplate := *certTemplate
+		precertTemplate.ExtraExtensions = append(append([]pkix.Extension{}, certTemplate.ExtraExtensions...), pkix.Extension{
+			Id:       PrecertificatePoisonOID,
+			Critical: true,
+			Value:    asn1.NullBytes,
+		})
+		precert, err := x509.CreateCertificate(randReader, &precertTemplate, caCert, pub, signer)
+		if err != nil {
+			return nil, err
+		}
+
+		extensions, err := data.Params.PrecertificateHandler(precert)
+		if err != nil {
+			return nil, err
+		}
+		certTemplate.ExtraExtensions = append(certTemplate.ExtraExtensions, extensions...)
+	}
+
+	return x509.CreateCertificate(randReader, certTemplate, caCert, pub, signer)
+}
+
 func NewCertPool(reader io.Reader) (*x509.CertPool, error) {
 	pemBlock, err := ioutil.ReadAll(reader)
 	if err != nil {
@@ -0,0 +1,142 @@
+package certutil
+
+import (
+	"crypto/x509"
+	"sort"
+)
+
+// KeyTypeInfo describes a key type which may be used for issuers, keys and
+// roles, and the signature algorithms it signs with.
+type KeyTypeInfo struct {
+	// Name is the value of the key_type parameter selecting this key type.
+	Name string
+	// KeyBits lists the valid key_bits values; empty when the key type
+	// has a single, fixed size.
+	KeyBits []int
+	// DefaultKeyBits is used when key_bits is left unset; zero when the
+	// key type has a single, fixed size.
+	DefaultKeyBits int
+	// SignatureAlgorithms lists the names of the signature algorithms
+	// keys of this type sign with.
+	SignatureAlgorithms []string
+	// Available is whether this build of Vault can generate, import and
+	// sign with keys of this type. Key types which are known but not yet
+	// available are rejected with a descriptive error rather than as
+	// unknown.
+	Available bool
+}
+
+// SignatureAlgorithmInfo describes a signature algorithm which may be used
+// to sign certificates and CRLs.
+type SignatureAlgorithmInfo struct {
+	// Name is the value of the revocation_signature_algorithm parameter
+	// selecting this algorithm.
+	Name string
+	// KeyType is the name of the key type signing with this algorithm.
+	KeyType string
+	// Algorithm is the crypto/x509 identifier for this algorithm;
+	// x509.UnknownSignatureAlgorithm when crypto/x509 lacks support.
+	Algorithm x509.SignatureAlgorithm
+	// Available is whether this build of Vault can sign certificates and
+	// CRLs with this algorithm.
+	Available bool
+}
+
+// keyTypes and signatureAlgorithms describe the key types and signature
+// algorithms key generation, ValidateKeyTypeLength and signing support
+// (through crypto/x509), for listing them and for rejecting known but
+// unsupported ones with a descriptive error. They don't extend that
+// support: new entries must be implemented in those code paths as well.
+var (
+	keyTypes = map[string]KeyTypeInfo{
+		"rsa": {
+			Name:                "rsa",
+			KeyBits:             []int{2048, 3072, 4096, 8192},
+			DefaultKeyBits:      2048,
+			SignatureAlgorithms: []string{"sha256withrsa", "sha384withrsa", "sha512withrsa", "sha256withrsapss", "sha384withrsapss", "sha512withrsapss"},
+			Available:           true,
+		},
+		"ec": {
+			Name:                "ec",
+			KeyBits:             []int{224, 256, 384, 521},
+			DefaultKeyBits:      256,
+			SignatureAlgorithms: []string{"ecdsawithsha256", "ecdsawithsha384", "ecdsawithsha512"},
+			Available:           true,
+		},
+		"ed25519": {
+			Name:                "ed25519",
+			SignatureAlgorithms: []string{"pureed25519"},
+			Available:           true,
+		},
+		// crypto/x509 supports neither Ed448 nor ML-DSA, alone or in
+		// composite (hybrid) signatures with a traditional algorithm, so
+		// these are registered as unavailable until it, or another
+		// library, does.
+		"ed448": {
+			Name:                "ed448",
+			SignatureAlgorithms: []string{"pureed448"},
+		},
+		"mldsa44-ed25519": {
+			Name:                "mldsa44-ed25519",
+			SignatureAlgorithms: []string{"mldsa44-ed25519"},
+		},
+		"mldsa65-ecdsa-p256": {
+			Name:                "mldsa65-ecdsa-p256",
+			SignatureAlgorithms: []string{"mldsa65-ecdsa-p256-sha512"},
+		},
+		"mldsa87-ecdsa-p384": {
+			Name:                "mldsa87-ecdsa-p384",
+			SignatureAlgorithms: []string{"mldsa87-ecdsa-p384-sha512"},
+		},
+	}
+
+	signatureAlgorithms = map[string]SignatureAlgorithmInfo{
+		"sha256withrsa":             {Name: "sha256withrsa", KeyType: "rsa", Algorithm: x509.SHA256WithRSA, Available: true},
+		"sha384withrsa":             {Name: "sha384withrsa", KeyType: "rsa", Algorithm: x509.SHA384WithRSA, Available: true},
+		"sha512withrsa":             {Name: "sha512withrsa", KeyType: "rsa", Algorithm: x509.SHA512WithRSA, Available: true},
+		"sha256withrsapss":          {Name: "sha256withrsapss", KeyType: "rsa", Algorithm: x509.SHA256WithRSAPSS, Available: true},
+		"sha384withrsapss":          {Name: "sha384withrsapss", KeyType: "rsa", Algorithm: x509.SHA384WithRSAPSS, Available: true},
+		"sha512withrsapss":          {Name: "sha512withrsapss", KeyType: "rsa", Algorithm: x509.SHA512WithRSAPSS, Available: true},
+		"ecdsawithsha256":           {Name: "ecdsawithsha256", KeyType: "ec", Algorithm: x509.ECDSAWithSHA256, Available: true},
+		"ecdsawithsha384":           {Name: "ecdsawithsha384", KeyType: "ec", Algorithm: x509.ECDSAWithSHA384, Available: true},
+		"ecdsawithsha512":           {Name: "ecdsawithsha512", KeyType: "ec", Algorithm: x509.ECDSAWithSHA512, Available: true},
+		"pureed25519":               {Name: "pureed25519", KeyType: "ed25519", Algorithm: x509.PureEd25519, Available: true},
+		"pureed448":                 {Name: "pureed448", KeyType: "ed448"},
+		"mldsa44-ed25519":           {Name: "mldsa44-ed25519", KeyType: "mldsa44-ed25519"},
+		"mldsa65-ecdsa-p256-sha512": {Name: "mldsa65-ecdsa-p256-sha512", KeyType: "mldsa65-ecdsa-p256"},
+		"mldsa87-ecdsa-p384-sha512": {Name: "mldsa87-ecdsa-p384-sha512", KeyType: "mldsa87-ecdsa-p384"},
+	}
+)
+
+// GetKeyType returns the named key type, if it is known.
+func GetKeyType(name string) (KeyTypeInfo, bool) {
+	keyType, ok := keyTypes[name]
+	return keyType, ok
+}
+
+// ListKeyTypes returns all known key types, available or not, sorted by
+// name.
+func ListKeyTypes() []KeyTypeInfo {
+	ret := make([]KeyTypeInfo, 0, len(keyTypes))
+	for _, keyType := range keyTypes {
+		ret = append(ret, keyType)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// GetSignatureAlgorithm returns the named signature algorithm, if it is
+// known. Names are those of SignatureAlgorithmNames, including its aliases.
+func GetSignatureAlgorithm(name string) (SignatureAlgorithmInfo, bool) {
+	if algorithm, ok := signatureAlgorithms[name]; ok {
+		return algorithm, true
+	}
+	if sigAlg, ok := SignatureAlgorithmNames[name]; ok {
+		for _, algorithm := range signatureAlgorithms {
+			if algorithm.Available && algorithm.Algorithm == sigAlg {
+				return algorithm, true
+			}
+		}
+	}
+	return SignatureAlgorithmInfo{}, false
+}
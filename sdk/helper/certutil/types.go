@@ -36,6 +36,15 @@ const (
 	PrivateKeyTypeP521 = "p521"
 )
 
+// Bounds on the number of random bits in generated serial numbers. Serial
+// numbers are positive and at most 20 octets long (RFC 5280), and must have
+// at least 64 bits of entropy (CA/Browser Forum Baseline Requirements).
+const (
+	DefaultSerialNumberBits = 159
+	MinSerialNumberBits     = 64
+	MaxSerialNumberBits     = 159
+)
+
 // This can be one of a few key types so the different params may or may not be filled
 type ClusterKeyParams struct {
 	Type string   `json:"type" structs:"type" mapstructure:"type"`
@@ -711,6 +720,11 @@ type CAInfoBundle struct {
 	URLs                 *URLEntries
 	LeafNotAfterBehavior NotAfterBehavior
 	RevocationSigAlg     x509.SignatureAlgorithm
+
+	// How serial numbers of the certificates this CA issues are generated;
+	// see CreationParameters.
+	SerialNumberBits   int
+	SerialNumberPrefix []byte
 }
 
 func (b *CAInfoBundle) GetCAChain() []*CertBlock {
@@ -781,14 +795,24 @@ type CreationParameters struct {
 	ExtKeyUsage                   CertExtKeyUsage
 	ExtKeyUsageOIDs               []string
 	PolicyIdentifiers             []string
+	PolicyIdentifiersCritical     bool
+	CustomExtensions              []pkix.Extension
 	BasicConstraintsValidForNonCA bool
 	SignatureBits                 int
 	UsePSS                        bool
 	ForceAppendCaChain            bool
 
 	// Only used when signing a CA cert
-	UseCSRValues        bool
-	PermittedDNSDomains []string
+	UseCSRValues               bool
+	PermittedDNSDomains        []string
+	ExcludedDNSDomains         []string
+	PermittedIPRanges          []*net.IPNet
+	ExcludedIPRanges           []*net.IPNet
+	PermittedEmailAddresses    []string
+	ExcludedEmailAddresses     []string
+	PermittedURIDomains        []string
+	ExcludedURIDomains         []string
+	NonCriticalNameConstraints bool
 
 	// URLs to encode into the certificate
 	URLs *URLEntries
@@ -799,14 +823,37 @@ type CreationParameters struct {
 	// The duration the certificate will use NotBefore
 	NotBeforeDuration time.Duration
 
+	// An explicit NotBefore, overriding NotBeforeDuration when set
+	NotBefore time.Time
+
 	// The explicit SKID to use; especially useful for cross-signing.
 	SKID []byte
+
+	// The serial number's random bits (zero meaning the default) and the
+	// bytes to prefix them with; see GenerateSerialNumberWithFormat.
+	SerialNumberBits   int
+	SerialNumberPrefix []byte
+
+	// If set when signing a leaf certificate with a CA, an RFC 6962
+	// precertificate is signed first and handed to this handler, and the
+	// extensions it returns (such as embedded SCTs) are added to the final
+	// certificate.
+	PrecertificateHandler PrecertificateHandler
 }
 
+// PrecertificateHandler is given the DER encoding of an RFC 6962
+// precertificate, and returns extensions to add to the final certificate.
+type PrecertificateHandler func(precertificate []byte) ([]pkix.Extension, error)
+
 type CreationBundle struct {
 	Params        *CreationParameters
 	SigningBundle *CAInfoBundle
 	CSR           *x509.CertificateRequest
+
+	// CSRPossessionVerified is set when proof of possession of the CSR's
+	// key was established by other means (such as a CRMF request), in which
+	// case the CSR's own signature isn't checked.
+	CSRPossessionVerified bool
 }
 
 // addKeyUsages adds appropriate key usages to the template given the creation